@@ -3,11 +3,13 @@ package analyzer
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/zeace/poisson/crawler/config"
 	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
 	"github.com/zeace/poisson/models"
 )
 
@@ -18,11 +20,16 @@ func AnalyzeWithLLM(prompt, apiKey string) (string, error) {
 	defer cancel()
 
 	client := NewGptLlmClient(apiKey)
-	return client.Analyze(ctx, prompt)
+	response, err := client.Analyze(ctx, prompt, nil, GenerationParams{})
+	if err != nil {
+		return "", err
+	}
+	return response.Content, nil
 }
 
 // parseJSONResponse extracts and parses JSON from the LLM response.
 // It handles cases where the response might be wrapped in markdown code blocks or have extra text.
+// It is only used to repair responses from backends that ignore the structured output schema.
 func parseJSONResponse(response string) (string, error) {
 	// Remove markdown code blocks if present
 	response = strings.TrimSpace(response)
@@ -45,6 +52,23 @@ func parseJSONResponse(response string) (string, error) {
 	return response[startIdx : endIdx+1], nil
 }
 
+// validateResponse checks the raw LLM response against the mode's response schema and returns the JSON to process.
+// Responses that don't validate are repaired once with parseJSONResponse and rejected if they still don't validate.
+func validateResponse(rawResponse string, schema ResponseSchema) (string, error) {
+	if err := schema.Validate(rawResponse); err == nil {
+		return rawResponse, nil
+	}
+
+	repaired, err := parseJSONResponse(rawResponse)
+	if err != nil {
+		return "", fmt.Errorf("error extracting JSON from response: %w", err)
+	}
+	if err := schema.Validate(repaired); err != nil {
+		return "", fmt.Errorf("response does not match %s schema: %w", schema.Name, err)
+	}
+	return repaired, nil
+}
+
 // analyze is the internal function that analyzes content with LLM and returns the parsed analysis result.
 // It uses the lib.DatastoreClient interface directly.
 func analyze(
@@ -55,84 +79,351 @@ func analyze(
 	datastoreClient lib.DatastoreClient,
 	verbose bool,
 ) (*models.AnalysisResult, error) {
-	// Generate prompt fingerprint for this mode
-	fingerprint, err := GeneratePromptFingerprint(mode)
-	if err != nil {
-		return nil, fmt.Errorf("error generating prompt fingerprint: %w", err)
+	return analyzePage(ctx, page, llmClient, mode, LanguagePolicyAsIs, 0, datastoreClient, verbose, false)
+}
+
+// analyzePage analyzes the page with the LLM, serving it from the analysis cache
+// unless refresh is true or the cached result has a different prompt fingerprint.
+// Pages with less content than the minimum of mode are not sent to the LLM.
+// languagePolicy controls how non-English pages are analyzed. Cached results older
+// than maxAge are re-analyzed; zero means cached results never expire.
+func analyzePage(
+	ctx context.Context,
+	page *models.CrawledPage,
+	llmClient LlmClient,
+	mode AnalysisMode,
+	languagePolicy LanguagePolicy,
+	maxAge time.Duration,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+	refresh bool,
+) (*models.AnalysisResult, error) {
+	if page.RobotsExcluded {
+		return nil, fmt.Errorf("page %s is excluded by robots directives", page.URL)
+	}
+
+	ctx = logging.WithAttrs(ctx, "url", page.URL, "mode", mode)
+
+	var cachedResult *models.AnalysisResult
+	if !refresh {
+		var fresh bool
+		var err error
+		cachedResult, fresh, err = readCachedAnalysis(ctx, page, llmClient, mode, maxAge, datastoreClient, verbose)
+		if err != nil {
+			return nil, err
+		}
+		if fresh {
+			return cachedResult, nil
+		}
+	}
+
+	if err := checkContentLength(ctx, page, mode, datastoreClient); err != nil {
+		return nil, err
+	}
+	return analyzeWithLLM(ctx, page, llmClient, mode, languagePolicy, datastoreClient, verbose, cachedResult)
+}
+
+// readCachedAnalysis reads the cached analysis of page in mode.
+// It returns the cached result (nil if there is none) and whether it is fresh enough to use:
+// made with the current prompt, by llmClient's model and provider, and not older than maxAge
+// (see Expired). A fresh result is marked as Cached.
+func readCachedAnalysis(
+	ctx context.Context,
+	page *models.CrawledPage,
+	llmClient LlmClient,
+	mode AnalysisMode,
+	maxAge time.Duration,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+) (*models.AnalysisResult, bool, error) {
+	if _, ok := lookupPromptConfig(mode); !ok {
+		return nil, false, fmt.Errorf("unknown mode: %s", mode)
 	}
 
-	// Check cache in datastore
 	cachedResult, found, err := datastoreClient.ReadAnalysisResult(ctx, page.URL, mode)
 	if err != nil {
-		return nil, fmt.Errorf("error checking analysis cache: %w", err)
+		return nil, false, fmt.Errorf("error checking analysis cache: %w", err)
 	}
+
 	if found {
-		// Verify that the PromptFingerprint matches before using cached result
-		if cachedResult.PromptFingerprint == fingerprint {
+		// Verify that the prompt fingerprint and version match before using cached result
+		stale, err := IsStale(cachedResult)
+		if err != nil {
+			return nil, false, err
+		}
+		if stale {
 			if verbose {
-				log.Printf("Using cached analysis result from Datastore\n")
+				slog.InfoContext(ctx, "Cached result was made with an older prompt")
 			}
-			return cachedResult, nil
+		} else if ModelChanged(cachedResult, llmClient) {
+			if verbose {
+				slog.InfoContext(ctx, "Cached result was made by another model",
+					"cached_model", cachedResult.Model, "cached_provider", cachedResult.Provider)
+			}
+		} else if Expired(cachedResult, maxAge, time.Now()) {
+			if verbose {
+				slog.InfoContext(ctx, "Cached result is older than the maximum age",
+					"analyzed_at", cachedResult.AnalyzedAt, "max_age", maxAge)
+			}
+		} else {
+			if verbose {
+				slog.InfoContext(ctx, "Using cached analysis result from Datastore")
+			}
+			cachedResult.Cached = true
+			return cachedResult, true, nil
 		}
-		// Fingerprint doesn't match, continue to analyze with LLM
+	}
+
+	// The same content may have been analyzed under another URL (a mirror, or a re-crawl
+	// under a new URL)
+	copied, err := copyAnalysisByContentHash(ctx, page, llmClient, mode, maxAge, datastoreClient)
+	if err != nil {
+		return nil, false, err
+	}
+	if copied != nil {
 		if verbose {
-			log.Printf("Cached result has mismatched fingerprint, analyzing with LLM...\n")
+			slog.InfoContext(ctx, "Using analysis of identical content", "copied_from", copied.CopiedFrom)
 		}
+		return copied, true, nil
 	}
 
-	// Cache miss or fingerprint mismatch, analyze with LLM
-	if verbose {
-		log.Printf("Analyzing with LLM...\n")
-	}
-	prompt, err := GeneratePrompt(mode, page.Title, page.Content)
-	if err != nil {
-		return nil, fmt.Errorf("error generating prompt: %w", err)
+	// Not cached or prompt changed, the caller analyzes with LLM
+	return cachedResult, false, nil
+}
+
+// copyAnalysisByContentHash looks for a fresh analysis in mode, by llmClient's model and not older
+// than maxAge, of another page with the same content as page. If there is one, it stores a copy for page, without token usage or cost, and
+// returns it marked as Cached. It returns nil if there is none.
+func copyAnalysisByContentHash(
+	ctx context.Context,
+	page *models.CrawledPage,
+	llmClient LlmClient,
+	mode AnalysisMode,
+	maxAge time.Duration,
+	datastoreClient lib.DatastoreClient,
+) (*models.AnalysisResult, error) {
+	if page.Content == "" {
+		return nil, nil
 	}
-	rawResponse, err := llmClient.Analyze(ctx, prompt)
+	matches, err := datastoreClient.FindAnalysisResultsByContentHash(ctx, lib.ContentHash(page.Content), mode)
 	if err != nil {
-		return nil, fmt.Errorf("error analyzing content: %w", err)
+		return nil, fmt.Errorf("error checking analysis cache by content: %w", err)
 	}
 
-	// Parse JSON from response
-	jsonStr, err := parseJSONResponse(rawResponse)
-	if err != nil {
-		return nil, fmt.Errorf("error extracting JSON from response: %w", err)
+	for _, match := range matches {
+		if lib.NormalizeURL(match.URL) == lib.NormalizeURL(page.URL) {
+			continue
+		}
+		if stale, err := IsStale(match); err != nil || stale || ModelChanged(match, llmClient) ||
+			Expired(match, maxAge, time.Now()) {
+			continue
+		}
+
+		copied := *match
+		copied.CopiedFrom = match.URL
+		copied.PromptTokens = 0
+		copied.CompletionTokens = 0
+		copied.CostUSD = 0
+		copied.Feed = page.Feed
+		if err := datastoreClient.WriteAnalysisResult(ctx, page.URL, &copied); err != nil {
+			slog.WarnContext(ctx, "Error saving copied analysis result", "error", err)
+		}
+		recordAnalysisEvent(ctx, datastoreClient, models.AuditActionCopied, page.URL, &copied,
+			"identical content analyzed as "+match.URL)
+		copied.Cached = true
+		return &copied, nil
 	}
+	return nil, nil
+}
 
-	// Get processing function from prompt config
-	config, ok := PromptTemplates[mode]
+// analyzeWithLLM analyzes the page with the LLM and saves the result to the cache.
+// languagePolicy controls how non-English pages are analyzed.
+// staleResult is the outdated cached result being replaced, or nil.
+func analyzeWithLLM(
+	ctx context.Context,
+	page *models.CrawledPage,
+	llmClient LlmClient,
+	mode AnalysisMode,
+	languagePolicy LanguagePolicy,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+	staleResult *models.AnalysisResult,
+) (*models.AnalysisResult, error) {
+	// Get schema and processing function from prompt config
+	config, ok := lookupPromptConfig(mode)
 	if !ok {
 		return nil, fmt.Errorf("unknown mode: %s", mode)
 	}
+	ctx = withCallSubject(ctx, page.URL, mode)
 
-	// Process response using the mode-specific processing function
-	result, err := config.ProcessResponse(jsonStr, fingerprint)
+	// Fingerprint the template read above, which may be reloaded during the analysis
+	fingerprint := templateFingerprint(mode, config.Template)
+	experiment, variant, inExperiment := assignVariant(mode, page.URL)
+	if inExperiment {
+		config.Template = variant.Template
+		fingerprint = templateFingerprint(mode, variant.Template)
+	} else if template, ok := config.LocalizedTemplates[pageLanguage(page)]; ok {
+		// The localized template is written for the page language, which needs no translation
+		config.Template = template
+		fingerprint = templateFingerprint(mode, template)
+		languagePolicy = LanguagePolicyAsIs
+	}
+
+	// The lead image is analyzed after the text, whose client may be an ensemble
+	vision, hasVision := llmClient.(*VisionLlmClient)
+	if hasVision {
+		llmClient = vision.Text
+	}
+	ensemble, isEnsemble := llmClient.(*EnsembleLlmClient)
+	if isEnsemble && config.AggregateResults == nil {
+		// The mode can't aggregate several results, analyze it once
+		llmClient = ensemble.Members[0]
+		isEnsemble = false
+	}
+
+	maxLength := maxContentLength(config, llmClient)
+	if verbose {
+		slog.InfoContext(ctx, "Analyzing with LLM", "model", llmClient.Model(), "max_content_length", maxLength)
+		if inExperiment {
+			slog.InfoContext(ctx, "Using experiment prompt", "experiment", experiment.ID, "variant", variant.Name)
+		}
+	}
+	localized, translationUsage, err := localizePage(ctx, page, llmClient, languagePolicy, maxLength, verbose)
+	if err != nil {
+		return nil, err
+	}
+	analyzeWith := func(client LlmClient) (*models.AnalysisResult, LlmUsage, error) {
+		if len(localized.Content) > maxLength && config.CombineResults != nil {
+			return analyzeChunks(ctx, mode, config, localized.Title, localized.Content,
+				localized.Instruction, maxLength, client, fingerprint, verbose)
+		}
+		return analyzeContent(ctx, mode, config, localized.Title, localized.Content,
+			localized.Instruction, maxLength, client, fingerprint, verbose)
+	}
+	var result *models.AnalysisResult
+	var usage LlmUsage
+	var cost float64
+	if isEnsemble {
+		result, usage, cost, err = analyzeEnsemble(ctx, ensemble, config.AggregateResults, analyzeWith, verbose)
+	} else {
+		result, usage, err = analyzeWith(llmClient)
+		cost = EstimateCost(llmClient.Model(), usage)
+		// The response of a batch is billed at the Batch API price
+		if replay, ok := llmClient.(*batchReplayClient); ok {
+			cost -= replay.batchDiscount()
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
+	usage.PromptTokens += translationUsage.PromptTokens
+	usage.CompletionTokens += translationUsage.CompletionTokens
+	cost += EstimateCost(costModel(llmClient), translationUsage)
+	result.PromptVersion = config.Version
+	result.Model = llmClient.Model()
+	if hasVision {
+		imageUsage, imageCost := addImageAnalysis(ctx, page, vision, config.Generation, result, verbose)
+		usage.PromptTokens += imageUsage.PromptTokens
+		usage.CompletionTokens += imageUsage.CompletionTokens
+		cost += imageCost
+		result.Model = visionModelName(result.Model, vision.Vision.Model())
+	}
+	result.Provider = llmClient.Provider()
+	result.Seed = clientSeed(llmClient)
+	result.CacheSource = page.CacheSource
+	result.PromptTokens = usage.PromptTokens
+	result.CompletionTokens = usage.CompletionTokens
+	result.CostUSD = cost
+	result.AnalyzedAt = time.Now()
+	result.Language = localized.Language
+	if inExperiment {
+		result.Experiment = experiment.ID
+		result.Variant = variant.Name
+	}
+	result.ContentHash = lib.ContentHash(page.Content)
+	result.Feed = page.Feed
+	if result.Feed == "" && staleResult != nil {
+		// Keep the attribution of a stale result re-run outside its feed
+		result.Feed = staleResult.Feed
+	}
 
 	// Save to cache
 	err = datastoreClient.WriteAnalysisResult(ctx, page.URL, result)
 	if err != nil {
-		log.Printf("Warning: error saving analysis result to cache: %v\n", err)
+		slog.WarnContext(ctx, "Error saving analysis result to cache", "error", err)
 		// The analysis was successful, caching is just an optimization
 	} else if verbose {
-		log.Printf("Saved analysis result to Datastore cache\n")
+		slog.InfoContext(ctx, "Saved analysis result to Datastore cache")
 	}
+	recordAnalysisEvent(ctx, datastoreClient, models.AuditActionAnalyzed, page.URL, result, reanalysisDetail(staleResult))
 
 	return result, nil
 }
 
+// analyzeContent analyzes title and content in a single LLM call, truncating content longer
+// than maxLength. instruction is appended to the prompt.
+// It returns the result and the usage of all calls made.
+func analyzeContent(
+	ctx context.Context,
+	mode AnalysisMode,
+	config PromptConfig,
+	title, content, instruction string,
+	maxLength int,
+	llmClient LlmClient,
+	fingerprint int,
+	verbose bool,
+) (*models.AnalysisResult, LlmUsage, error) {
+	prompt := generatePrompt(config.Template, title, content, maxLength)
+	response, err := llmClient.Analyze(ctx, prompt+instruction, &config.Schema, config.Generation)
+	if err != nil {
+		return nil, LlmUsage{}, wrapLlmError("error analyzing content", err)
+	}
+
+	// Validate the response against the mode's schema and process it, asking the LLM
+	// to correct malformed output once
+	result, usage, err := processWithRepair(ctx, response, llmClient, config, fingerprint, verbose)
+	if err != nil {
+		return nil, usage, err
+	}
+	result.ContentTruncated = len(content) > maxLength
+	return result, usage, nil
+}
+
 // Analyze analyzes content with LLM and returns the parsed analysis result.
+// llmOptions selects the API key, endpoint and model used for the LLM call.
+// If llmOptions.Model is empty, the model configured for the mode is used.
 // If datastoreClient is provided, it will check for cached results and save new results.
 func Analyze(
 	ctx context.Context,
 	page *models.CrawledPage,
-	apiKey string,
+	llmOptions LlmOptions,
 	mode AnalysisMode,
 	datastoreClient lib.DatastoreClient,
 	verbose bool,
 ) (*models.AnalysisResult, error) {
-	llmClient := NewGptLlmClient(apiKey)
-	return analyze(ctx, page, llmClient, mode, datastoreClient, verbose)
+	model, err := ResolveModel(mode, llmOptions.Model)
+	if err != nil {
+		return nil, err
+	}
+	llmOptions.Model = model
+	llmClient := NewLlmClient(llmOptions)
+	return analyzePage(ctx, page, llmClient, mode, llmOptions.Language, llmOptions.MaxAge, datastoreClient, verbose, false)
+}
+
+// Reanalyze is like Analyze but always calls the LLM, replacing any cached result for the page and mode.
+func Reanalyze(
+	ctx context.Context,
+	page *models.CrawledPage,
+	llmOptions LlmOptions,
+	mode AnalysisMode,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+) (*models.AnalysisResult, error) {
+	model, err := ResolveModel(mode, llmOptions.Model)
+	if err != nil {
+		return nil, err
+	}
+	llmOptions.Model = model
+	llmClient := NewLlmClient(llmOptions)
+	return analyzePage(ctx, page, llmClient, mode, llmOptions.Language, llmOptions.MaxAge, datastoreClient, verbose, true)
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/zeace/poisson/lib"
 	"github.com/zeace/poisson/models"
@@ -558,6 +559,7 @@ func TestAnalyze_DatastoreCacheHit(t *testing.T) {
 		JokePercentage:    intPtr(75),
 		JokeReasoning:     stringPtr("This is a test reasoning"),
 		PromptFingerprint: expectedFingerprint,
+		PromptVersion:     2,
 	}
 	mockDS.AnalysisResults[lib.UrlToAnalysisKey(pageURL, AnalysisModeJoke)] = cachedResult
 
@@ -623,19 +625,135 @@ func TestAnalyze_DatastoreCacheHit_MismatchedFingerprint(t *testing.T) {
 	}
 }
 
+func TestAnalyze_DatastoreCacheHit_DifferentModel(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	pageURL := "example.com/article"
+	fingerprint, _ := GeneratePromptFingerprint(AnalysisModeJoke)
+	mockDS.AnalysisResults[lib.UrlToAnalysisKey(pageURL, AnalysisModeJoke)] = &models.AnalysisResult{
+		Mode:              AnalysisModeJoke,
+		JokePercentage:    intPtr(10),
+		PromptFingerprint: fingerprint,
+		PromptVersion:     2,
+		Model:             "gpt-4o",
+		Provider:          "openai",
+	}
+
+	page := &models.CrawledPage{URL: pageURL, Title: "Test Article", Content: "Test content"}
+	mockLLM := &MockLlmClient{
+		Response:     `{"is_joke": true, "confidence": 60, "reasoning": "Local model"}`,
+		ModelName:    "llama-3-8b",
+		ProviderName: "localhost:8000",
+	}
+	result, err := analyze(ctx, page, mockLLM, AnalysisModeJoke, mockDS, false)
+	if err != nil {
+		t.Fatalf("analyze() error = %v, want nil", err)
+	}
+	if mockLLM.Calls != 1 || result.Cached {
+		t.Errorf("Expected a new analysis by the other model, got Calls=%d Cached=%v", mockLLM.Calls, result.Cached)
+	}
+	if result.Model != "llama-3-8b" || result.Provider != "localhost:8000" {
+		t.Errorf("Expected Model/Provider = llama-3-8b/localhost:8000, got %q/%q", result.Model, result.Provider)
+	}
+}
+
+func TestAnalyzePage_MaxAge(t *testing.T) {
+	ctx := context.Background()
+	fingerprint, _ := GeneratePromptFingerprint(AnalysisModeJoke)
+	pageURL := "example.com/article"
+
+	tests := []struct {
+		name          string
+		analyzedAt    time.Time
+		maxAge        time.Duration
+		expectedCalls int
+	}{
+		{"recent result is used", time.Now().Add(-time.Hour), 24 * time.Hour, 0},
+		{"old result is re-analyzed", time.Now().Add(-48 * time.Hour), 24 * time.Hour, 1},
+		{"old result is used without max age", time.Now().Add(-48 * time.Hour), 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDS := lib.NewMockDatastoreClient()
+			mockDS.AnalysisResults[lib.UrlToAnalysisKey(pageURL, AnalysisModeJoke)] = &models.AnalysisResult{
+				Mode:              AnalysisModeJoke,
+				JokePercentage:    intPtr(10),
+				PromptFingerprint: fingerprint,
+				PromptVersion:     2,
+				AnalyzedAt:        tt.analyzedAt,
+			}
+
+			page := &models.CrawledPage{URL: pageURL, Title: "Test Article", Content: "Test content"}
+			mockLLM := &MockLlmClient{Response: `{"is_joke": true, "confidence": 80, "reasoning": "Re-analyzed"}`}
+			result, err := analyzePage(ctx, page, mockLLM, AnalysisModeJoke, LanguagePolicyAsIs, tt.maxAge, mockDS, false, false)
+			if err != nil {
+				t.Fatalf("analyzePage() error = %v, want nil", err)
+			}
+			if mockLLM.Calls != tt.expectedCalls {
+				t.Errorf("LLM calls = %d, want %d", mockLLM.Calls, tt.expectedCalls)
+			}
+			if result.Cached != (tt.expectedCalls == 0) {
+				t.Errorf("Cached = %v, want %v", result.Cached, tt.expectedCalls == 0)
+			}
+		})
+	}
+}
+
+func TestAnalyzePage_RefreshIgnoresCache(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	// Pre-populate cache with a result that has the current fingerprint
+	pageURL := "example.com/article"
+	fingerprint, _ := GeneratePromptFingerprint(AnalysisModeJoke)
+	mockDS.AnalysisResults[lib.UrlToAnalysisKey(pageURL, AnalysisModeJoke)] = &models.AnalysisResult{
+		Mode:              AnalysisModeJoke,
+		JokePercentage:    intPtr(10),
+		PromptFingerprint: fingerprint,
+		PromptVersion:     2,
+	}
+
+	page := &models.CrawledPage{
+		URL:     pageURL,
+		Title:   "Test Article",
+		Content: "Test content",
+	}
+
+	mockLLM := &MockLlmClient{
+		Response: `{"is_joke": true, "confidence": 95, "reasoning": "Refreshed"}`,
+	}
+	result, err := analyzePage(ctx, page, mockLLM, AnalysisModeJoke, LanguagePolicyAsIs, 0, mockDS, false, true)
+	if err != nil {
+		t.Fatalf("analyzePage() error = %v, want nil", err)
+	}
+	if result.Cached || result.JokePercentage == nil || *result.JokePercentage != 95 {
+		t.Errorf("Expected fresh LLM result, got Cached=%v JokePercentage=%v", result.Cached, result.JokePercentage)
+	}
+
+	// The refreshed result replaces the cached one
+	stored, _, _ := mockDS.ReadAnalysisResult(ctx, pageURL, AnalysisModeJoke)
+	if stored == nil || stored.JokePercentage == nil || *stored.JokePercentage != 95 {
+		t.Errorf("Expected stored result to be replaced, got %+v", stored)
+	}
+}
+
 func TestAnalyze_DatastoreCacheMiss(t *testing.T) {
 	ctx := context.Background()
 	mockDS := lib.NewMockDatastoreClient()
 
 	page := &models.CrawledPage{
-		URL:     "example.com/new-article",
-		Title:   "New Article",
-		Content: "New content",
+		URL:         "example.com/new-article",
+		Title:       "New Article",
+		Content:     "New content",
+		CacheSource: models.CacheSourceNetwork,
 	}
 
 	// No cached result exists, so it should call LLM and save the result
 	mockLLM := &MockLlmClient{
-		Response: `{"is_joke": false, "confidence": 70, "reasoning": "This is a serious article"}`,
+		Response:  `{"is_joke": false, "confidence": 70, "reasoning": "This is a serious article"}`,
+		ModelName: "gpt-4o",
 	}
 	result, err := analyze(ctx, page, mockLLM, AnalysisModeJoke, mockDS, false)
 	if err != nil {
@@ -658,6 +776,119 @@ func TestAnalyze_DatastoreCacheMiss(t *testing.T) {
 	if savedResult.JokePercentage == nil || *savedResult.JokePercentage != *result.JokePercentage {
 		t.Errorf("Expected saved JokePercentage to match result, got %v", savedResult.JokePercentage)
 	}
+	if savedResult.Model != "gpt-4o" {
+		t.Errorf("Expected saved Model = %q, got %q", "gpt-4o", savedResult.Model)
+	}
+	if savedResult.CacheSource != models.CacheSourceNetwork {
+		t.Errorf("Expected saved CacheSource = %q, got %q", models.CacheSourceNetwork, savedResult.CacheSource)
+	}
+
+	// Joke scoring runs at temperature 0
+	if mockLLM.LastParams.Temperature == nil || *mockLLM.LastParams.Temperature != 0 {
+		t.Errorf("Expected Temperature = 0, got %v", mockLLM.LastParams.Temperature)
+	}
+}
+
+func TestAnalyze_RecordsFeed(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	page := &models.CrawledPage{
+		URL:     "example.com/feed-article",
+		Title:   "Feed Article",
+		Content: "Content",
+		Feed:    "https://example.com/feed.xml",
+	}
+	mockLLM := &MockLlmClient{Response: `{"is_joke": false, "confidence": 10, "reasoning": "Serious"}`}
+	if _, err := analyze(ctx, page, mockLLM, AnalysisModeJoke, mockDS, false); err != nil {
+		t.Fatalf("analyze() error = %v, want nil", err)
+	}
+
+	saved, found, err := mockDS.ReadAnalysisResult(ctx, page.URL, AnalysisModeJoke)
+	if err != nil || !found {
+		t.Fatalf("ReadAnalysisResult() = %v, %v, want saved result", found, err)
+	}
+	if saved.Feed != page.Feed {
+		t.Errorf("Expected saved Feed = %q, got %q", page.Feed, saved.Feed)
+	}
+}
+
+func TestAnalyze_ReusesAnalysisOfIdenticalContent(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	fingerprint, _ := GeneratePromptFingerprint(AnalysisModeJoke)
+
+	content := "Identical syndicated content"
+	mockDS.AnalysisResults[lib.UrlToAnalysisKey("example.com/original", AnalysisModeJoke)] = &models.AnalysisResult{
+		URL:               "example.com/original",
+		Mode:              AnalysisModeJoke,
+		JokePercentage:    intPtr(80),
+		PromptFingerprint: fingerprint,
+		PromptVersion:     2,
+		ContentHash:       lib.ContentHash(content),
+		PromptTokens:      100,
+		CostUSD:           0.01,
+	}
+
+	page := &models.CrawledPage{
+		URL:     "mirror.example.com/copy",
+		Title:   "Copy",
+		Content: content,
+		Feed:    "https://mirror.example.com/feed.xml",
+	}
+	mockLLM := &MockLlmClient{Response: "should not be used"}
+	result, err := analyze(ctx, page, mockLLM, AnalysisModeJoke, mockDS, false)
+	if err != nil {
+		t.Fatalf("analyze() error = %v, want nil", err)
+	}
+	if mockLLM.Calls != 0 {
+		t.Errorf("Expected no LLM calls, got %d", mockLLM.Calls)
+	}
+	if !result.Cached || result.JokePercentage == nil || *result.JokePercentage != 80 {
+		t.Errorf("Expected copied result, got Cached=%v JokePercentage=%v", result.Cached, result.JokePercentage)
+	}
+	if result.CopiedFrom != "example.com/original" {
+		t.Errorf("Expected CopiedFrom = %q, got %q", "example.com/original", result.CopiedFrom)
+	}
+
+	// The copy is stored under the new URL without usage, so spend isn't counted twice
+	saved, found, err := mockDS.ReadAnalysisResult(ctx, page.URL, AnalysisModeJoke)
+	if err != nil || !found {
+		t.Fatalf("ReadAnalysisResult() = %v, %v, want saved copy", found, err)
+	}
+	if saved.PromptTokens != 0 || saved.CostUSD != 0 {
+		t.Errorf("Expected copy without usage, got PromptTokens=%d CostUSD=%v", saved.PromptTokens, saved.CostUSD)
+	}
+	if saved.Feed != page.Feed {
+		t.Errorf("Expected saved Feed = %q, got %q", page.Feed, saved.Feed)
+	}
+}
+
+func TestAnalyze_IgnoresStaleAnalysisOfIdenticalContent(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	content := "Identical syndicated content"
+	mockDS.AnalysisResults[lib.UrlToAnalysisKey("example.com/original", AnalysisModeJoke)] = &models.AnalysisResult{
+		URL:               "example.com/original",
+		Mode:              AnalysisModeJoke,
+		JokePercentage:    intPtr(80),
+		PromptFingerprint: 999999, // Made with an older prompt
+		ContentHash:       lib.ContentHash(content),
+	}
+
+	page := &models.CrawledPage{URL: "mirror.example.com/copy", Title: "Copy", Content: content}
+	mockLLM := &MockLlmClient{Response: `{"is_joke": false, "confidence": 20, "reasoning": "Serious"}`}
+	result, err := analyze(ctx, page, mockLLM, AnalysisModeJoke, mockDS, false)
+	if err != nil {
+		t.Fatalf("analyze() error = %v, want nil", err)
+	}
+	if mockLLM.Calls != 1 || result.Cached || result.CopiedFrom != "" {
+		t.Errorf("Expected fresh LLM analysis, got Calls=%d Cached=%v CopiedFrom=%q", mockLLM.Calls, result.Cached, result.CopiedFrom)
+	}
+	if result.ContentHash != lib.ContentHash(content) {
+		t.Errorf("Expected ContentHash = %q, got %q", lib.ContentHash(content), result.ContentHash)
+	}
 }
 
 func TestAnalyze_DatastoreReadError(t *testing.T) {
@@ -0,0 +1,49 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// recordAnalysisEvent appends an event describing result, the analysis of url, to the audit
+// trail of url.
+func recordAnalysisEvent(
+	ctx context.Context,
+	datastoreClient lib.DatastoreClient,
+	action models.AuditAction,
+	url string,
+	result *models.AnalysisResult,
+	detail string,
+) {
+	lib.RecordAuditEvent(ctx, datastoreClient, &models.AuditEvent{
+		URL:               url,
+		Action:            action,
+		Mode:              result.Mode,
+		PromptFingerprint: result.PromptFingerprint,
+		PromptVersion:     result.PromptVersion,
+		Model:             result.Model,
+		JokePercentage:    result.JokePercentage,
+		Detail:            detail,
+	})
+}
+
+// reanalysisDetail describes the stored analysis replaced by a new one, "" if there was none.
+func reanalysisDetail(previous *models.AnalysisResult) string {
+	if previous == nil {
+		return ""
+	}
+	percentage := "no joke percentage"
+	if previous.JokePercentage != nil {
+		percentage = fmt.Sprintf("%d%%", *previous.JokePercentage)
+	}
+	analyzedAt := "at an unknown time"
+	if !previous.AnalyzedAt.IsZero() {
+		analyzedAt = "at " + previous.AnalyzedAt.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("replaced the analysis made %s by %q with prompt fingerprint %d, version %d (%s)",
+		analyzedAt, previous.Model, previous.PromptFingerprint, previous.PromptVersion, percentage)
+}
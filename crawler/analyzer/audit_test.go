@@ -0,0 +1,59 @@
+package analyzer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestAnalyzePage_RecordsAuditEvent(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	llm := &MockLlmClient{Response: `{"is_joke": true, "confidence": 80, "reasoning": "Absurd"}`, ModelName: "gpt-4o"}
+	page := &models.CrawledPage{URL: "example.com/cats", Title: "Cats Elected", Content: "Cats took every seat."}
+
+	if _, err := analyzePage(ctx, page, llm, AnalysisModeJoke, LanguagePolicyAsIs, 0, mockDS, false, false); err != nil {
+		t.Fatalf("analyzePage() error = %v", err)
+	}
+	// Cached results are served without a new event
+	if _, err := analyzePage(ctx, page, llm, AnalysisModeJoke, LanguagePolicyAsIs, 0, mockDS, false, false); err != nil {
+		t.Fatalf("analyzePage() error = %v", err)
+	}
+
+	events, err := mockDS.ListAuditEvents(ctx, "example.com/cats")
+	if err != nil {
+		t.Fatalf("ListAuditEvents() error = %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 audit event, got %d", len(events))
+	}
+	event := events[0]
+	if event.Action != models.AuditActionAnalyzed || event.Mode != AnalysisModeJoke || event.Model != "gpt-4o" ||
+		event.JokePercentage == nil || event.PromptFingerprint == 0 || event.CreatedAt.IsZero() {
+		t.Errorf("event = %+v, want an analyzed event of the joke analysis", event)
+	}
+}
+
+func TestReanalysisDetail(t *testing.T) {
+	if got := reanalysisDetail(nil); got != "" {
+		t.Errorf("reanalysisDetail(nil) = %q, want empty", got)
+	}
+
+	previous := &models.AnalysisResult{
+		Model:             "gpt-4o",
+		PromptFingerprint: 42,
+		PromptVersion:     3,
+		JokePercentage:    intPtr(70),
+		AnalyzedAt:        time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC),
+	}
+	got := reanalysisDetail(previous)
+	for _, want := range []string{"2024-04-01T12:00:00Z", `"gpt-4o"`, "fingerprint 42", "version 3", "70%"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("reanalysisDetail() = %q, want it to contain %q", got, want)
+		}
+	}
+}
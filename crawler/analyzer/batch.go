@@ -0,0 +1,305 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+	"github.com/zeace/poisson/models"
+)
+
+// DefaultBatchConcurrency is the default number of LLM calls AnalyzeBatch makes in parallel.
+const DefaultBatchConcurrency = 4
+
+// BatchOptions configures AnalyzeBatch.
+type BatchOptions struct {
+	// LlmOptions selects the API key, endpoint and model used for the LLM calls.
+	// If LlmOptions.Model is empty, the model configured for each mode is used.
+	LlmOptions LlmOptions
+	// Concurrency is the maximum number of LLM calls in flight. Zero means DefaultBatchConcurrency.
+	Concurrency int
+	// Timeout limits each analysis. Zero means no limit beyond ctx.
+	Timeout time.Duration
+	// DeferOnUnavailable stores a PendingAnalysis marker instead of failing when the LLM is
+	// unavailable, so that BackfillPendingAnalyses can analyze the page later. Once the LLM
+	// is found to be unavailable, the remaining analyses of the batch are deferred without
+	// calling it.
+	DeferOnUnavailable bool
+	// QueueForBatch stores a PendingAnalysis marker for the OpenAI Batch API instead of calling
+	// the LLM, so that SubmitLlmBatches can submit the analysis at half the price. Cached
+	// analyses are still served, and headlines are still screened with live calls.
+	QueueForBatch bool
+	// Screening skips the joke analyses of pages whose headline is obviously serious.
+	Screening HeadlineScreening
+}
+
+// BatchResult is the outcome of analyzing one page in one mode with AnalyzeBatch.
+type BatchResult struct {
+	Page   *models.CrawledPage
+	Mode   AnalysisMode
+	Result *models.AnalysisResult
+	Err    error
+	// Deferred is true if the analysis failed because the LLM was unavailable, or was queued for
+	// the Batch API (Err is ErrQueuedForBatch), and a PendingAnalysis marker was stored for it.
+	// Err is set as well.
+	Deferred bool
+	// Headline is the headline screening analysis of the page, nil if it was not screened.
+	Headline *models.AnalysisResult
+	// Screened is true if the joke analysis was skipped because the headline scored below the
+	// screening threshold. Result is then the Headline analysis.
+	Screened bool
+}
+
+// AnalyzeBatch analyzes every page in every mode.
+// Cached analyses are served up front, pages that appear more than once are analyzed once,
+// and the remaining analyses are spread over at most opts.Concurrency parallel LLM calls.
+// Results are returned page by page, with one result per mode in the order of modes.
+func AnalyzeBatch(
+	ctx context.Context,
+	pages []*models.CrawledPage,
+	modes []AnalysisMode,
+	opts BatchOptions,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+) []BatchResult {
+	clients := make(map[AnalysisMode]LlmClient)
+	clientErrs := make(map[AnalysisMode]error)
+	for _, mode := range modes {
+		llmOptions := opts.LlmOptions
+		model, err := ResolveModel(mode, llmOptions.Model)
+		if err != nil {
+			clientErrs[mode] = err
+			continue
+		}
+		llmOptions.Model = model
+		clients[mode] = NewLlmClient(llmOptions)
+	}
+	if opts.Screening.Enabled() {
+		// Screening uses a plain client, without the ensemble or vision of the full analyses
+		llmOptions := opts.LlmOptions
+		llmOptions.Model = opts.Screening.Model
+		if llmOptions.Model == "" {
+			llmOptions.Model, _ = ResolveModel(AnalysisModeHeadline, opts.LlmOptions.Model)
+		}
+		clients[AnalysisModeHeadline] = NewGptLlmClientWithOptions(llmOptions)
+	}
+
+	return analyzeBatch(ctx, pages, modes, opts, datastoreClient, verbose,
+		func(mode AnalysisMode) (LlmClient, error) {
+			return clients[mode], clientErrs[mode]
+		})
+}
+
+// analyzeBatch implements AnalyzeBatch with the LLM client for each mode returned by clientFor.
+func analyzeBatch(
+	ctx context.Context,
+	pages []*models.CrawledPage,
+	modes []AnalysisMode,
+	opts BatchOptions,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+	clientFor func(mode AnalysisMode) (LlmClient, error),
+) []BatchResult {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	// pending is an analysis that needs an LLM call, shared by all results for the same page and mode.
+	type pending struct {
+		page        *models.CrawledPage
+		mode        AnalysisMode
+		staleResult *models.AnalysisResult
+		result      *models.AnalysisResult
+		err         error
+		deferred    bool
+		indexes     []int
+	}
+
+	results := make([]BatchResult, 0, len(pages)*len(modes))
+	var work []*pending
+	seen := make(map[string]*pending)
+
+	for _, page := range pages {
+		for _, mode := range modes {
+			i := len(results)
+			results = append(results, BatchResult{Page: page, Mode: mode})
+
+			key := lib.NormalizeURL(page.URL) + ":" + string(mode)
+			if p, ok := seen[key]; ok {
+				p.indexes = append(p.indexes, i)
+				continue
+			}
+
+			llmClient, err := clientFor(mode)
+			if err != nil {
+				results[i].Err = err
+				continue
+			}
+			if page.RobotsExcluded {
+				results[i].Err = fmt.Errorf("page %s is excluded by robots directives", page.URL)
+				continue
+			}
+
+			pageCtx := logging.WithAttrs(ctx, "url", page.URL, "mode", mode)
+			cachedResult, fresh, err := readCachedAnalysis(pageCtx, page, llmClient, mode, opts.LlmOptions.MaxAge, datastoreClient, verbose)
+			if err != nil {
+				results[i].Err = err
+				continue
+			}
+			if fresh {
+				results[i].Result = cachedResult
+				continue
+			}
+			if err := checkContentLength(pageCtx, page, mode, datastoreClient); err != nil {
+				results[i].Err = err
+				continue
+			}
+
+			p := &pending{page: page, mode: mode, staleResult: cachedResult, indexes: []int{i}}
+			seen[key] = p
+			work = append(work, p)
+		}
+	}
+
+	// Screen the headlines of the pages that need a joke analysis, and skip the obviously serious ones
+	if opts.Screening.Enabled() {
+		var jokePages []*models.CrawledPage
+		for _, p := range work {
+			if p.mode == AnalysisModeJoke {
+				jokePages = append(jokePages, p.page)
+			}
+		}
+		headlines := screenHeadlines(ctx, jokePages, opts, datastoreClient, verbose, clientFor)
+
+		kept := work[:0]
+		for _, p := range work {
+			headline := headlines[p.page]
+			if p.mode != AnalysisModeJoke || headline == nil {
+				kept = append(kept, p)
+				continue
+			}
+			screened := headline.JokePercentage != nil && *headline.JokePercentage < opts.Screening.Threshold
+			for _, i := range p.indexes {
+				results[i].Headline = headline
+				if screened {
+					results[i].Result, results[i].Screened = headline, true
+				}
+			}
+			if !screened {
+				kept = append(kept, p)
+			}
+		}
+		work = kept
+	}
+
+	// unavailable holds the first ErrLlmUnavailable error once the LLM is known to be down
+	var unavailable atomic.Pointer[error]
+
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, p := range work {
+		wg.Add(1)
+		go func(p *pending) {
+			defer wg.Done()
+
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				p.err = ctx.Err()
+				return
+			}
+			defer func() { <-slots }()
+
+			pageCtx := logging.WithAttrs(ctx, "url", p.page.URL, "mode", p.mode)
+			analysisCtx := pageCtx
+			if opts.Timeout > 0 {
+				var cancel context.CancelFunc
+				analysisCtx, cancel = context.WithTimeout(analysisCtx, opts.Timeout)
+				defer cancel()
+			}
+			if opts.QueueForBatch {
+				p.err = ErrQueuedForBatch
+				p.deferred = deferAnalysis(pageCtx, p.page, p.mode, p.err, true, datastoreClient)
+				return
+			}
+			if !opts.DeferOnUnavailable {
+				llmClient, _ := clientFor(p.mode)
+				p.result, p.err = analyzeWithLLM(analysisCtx, p.page, llmClient, p.mode, opts.LlmOptions.Language, datastoreClient, verbose, p.staleResult)
+				return
+			}
+
+			if errPtr := unavailable.Load(); errPtr != nil {
+				p.err = *errPtr
+			} else {
+				llmClient, _ := clientFor(p.mode)
+				p.result, p.err = analyzeWithLLM(analysisCtx, p.page, llmClient, p.mode, opts.LlmOptions.Language, datastoreClient, verbose, p.staleResult)
+				if !errors.Is(p.err, ErrLlmUnavailable) {
+					return
+				}
+				unavailable.CompareAndSwap(nil, &p.err)
+			}
+			// The analysis may have timed out, so store the marker outside its deadline
+			p.deferred = deferAnalysis(pageCtx, p.page, p.mode, p.err, false, datastoreClient)
+		}(p)
+	}
+	wg.Wait()
+
+	for _, p := range work {
+		for _, i := range p.indexes {
+			results[i].Result, results[i].Err, results[i].Deferred = p.result, p.err, p.deferred
+		}
+	}
+	return results
+}
+
+// deferAnalysis stores a PendingAnalysis marker for page and mode after the LLM failed with cause,
+// or for the Batch API if batch is true. A marker already submitted in a batch is kept as it is,
+// since the batch's result will complete the analysis. It returns false if the marker could not be
+// stored.
+func deferAnalysis(
+	ctx context.Context,
+	page *models.CrawledPage,
+	mode AnalysisMode,
+	cause error,
+	batch bool,
+	datastoreClient lib.DatastoreClient,
+) bool {
+	now := time.Now()
+	queued, err := datastoreClient.QueuePendingAnalysis(ctx, &models.PendingAnalysis{
+		URL:       page.URL,
+		Mode:      mode,
+		Feed:      page.Feed,
+		Error:     cause.Error(),
+		Attempts:  1,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Batch:     batch,
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "Error storing pending analysis", "error", err)
+		return false
+	}
+	if !queued {
+		slog.InfoContext(ctx, "Analysis already submitted to the Batch API")
+		return true
+	}
+	lib.RecordAuditEvent(ctx, datastoreClient, &models.AuditEvent{
+		URL:    page.URL,
+		Action: models.AuditActionDeferred,
+		Mode:   mode,
+		Detail: cause.Error(),
+	})
+	if batch {
+		slog.InfoContext(ctx, "Analysis queued for the Batch API")
+	} else {
+		slog.InfoContext(ctx, "LLM unavailable, analysis deferred")
+	}
+	return true
+}
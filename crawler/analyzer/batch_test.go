@@ -0,0 +1,227 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// countingLlmClient is a concurrency-safe LlmClient that records the number of calls
+// and the highest number of calls in flight at once.
+type countingLlmClient struct {
+	mu          sync.Mutex
+	calls       int
+	inFlight    int
+	maxInFlight int
+	delay       time.Duration
+	err         error
+}
+
+func (c *countingLlmClient) Analyze(
+	ctx context.Context,
+	prompt string,
+	schema *ResponseSchema,
+	params GenerationParams,
+) (LlmResponse, error) {
+	c.mu.Lock()
+	c.calls++
+	c.inFlight++
+	c.maxInFlight = max(c.maxInFlight, c.inFlight)
+	c.mu.Unlock()
+
+	time.Sleep(c.delay)
+
+	c.mu.Lock()
+	c.inFlight--
+	c.mu.Unlock()
+	if c.err != nil {
+		return LlmResponse{}, c.err
+	}
+	return LlmResponse{Content: `{"is_joke": true, "confidence": 90, "reasoning": "Absurd"}`}, nil
+}
+
+func (c *countingLlmClient) Model() string {
+	return "test-model"
+}
+
+func (c *countingLlmClient) Provider() string {
+	return DefaultProvider
+}
+
+func TestAnalyzeBatch_CacheHitsAndDuplicates(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	fingerprint, err := GeneratePromptFingerprint(AnalysisModeJoke)
+	if err != nil {
+		t.Fatalf("GeneratePromptFingerprint() error = %v", err)
+	}
+	cachedPercentage := 10
+	mockDS.WriteAnalysisResult(ctx, "example.com/cached", &models.AnalysisResult{
+		Mode:              AnalysisModeJoke,
+		JokePercentage:    &cachedPercentage,
+		PromptFingerprint: fingerprint,
+		PromptVersion:     2,
+	})
+
+	pages := []*models.CrawledPage{
+		{URL: "example.com/cached", Title: "Cached", Content: "Content"},
+		{URL: "example.com/new", Title: "New", Content: "Content"},
+		{URL: "https://example.com/new", Title: "New", Content: "Content"},
+		{URL: "example.com/excluded", Title: "Excluded", Content: "Content", RobotsExcluded: true},
+	}
+	client := &countingLlmClient{}
+	results := analyzeBatch(ctx, pages, []AnalysisMode{AnalysisModeJoke}, BatchOptions{}, mockDS, false,
+		func(mode AnalysisMode) (LlmClient, error) { return client, nil })
+
+	if len(results) != len(pages) {
+		t.Fatalf("Expected %d results, got %d", len(pages), len(results))
+	}
+	if client.calls != 1 {
+		t.Errorf("Expected 1 LLM call, got %d", client.calls)
+	}
+
+	if results[0].Err != nil || !results[0].Result.Cached || *results[0].Result.JokePercentage != 10 {
+		t.Errorf("Expected cached result for first page, got %+v", results[0])
+	}
+	for _, i := range []int{1, 2} {
+		if results[i].Err != nil || results[i].Result == nil || results[i].Result.Cached {
+			t.Errorf("Expected fresh result for page %d, got %+v", i, results[i])
+		}
+		if results[i].Page != pages[i] || results[i].Mode != AnalysisModeJoke {
+			t.Errorf("Expected result %d to refer to its page and mode, got %+v", i, results[i])
+		}
+	}
+	if results[3].Err == nil {
+		t.Error("Expected error for robots-excluded page, got nil")
+	}
+}
+
+func TestAnalyzeBatch_BoundsConcurrency(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	var pages []*models.CrawledPage
+	for _, url := range []string{"a", "b", "c", "d", "e", "f"} {
+		pages = append(pages, &models.CrawledPage{URL: "example.com/" + url, Title: url, Content: "Content"})
+	}
+	client := &countingLlmClient{delay: 20 * time.Millisecond}
+	results := analyzeBatch(ctx, pages, []AnalysisMode{AnalysisModeJoke}, BatchOptions{Concurrency: 2}, mockDS, false,
+		func(mode AnalysisMode) (LlmClient, error) { return client, nil })
+
+	for i, result := range results {
+		if result.Err != nil {
+			t.Errorf("Result %d: unexpected error %v", i, result.Err)
+		}
+	}
+	if client.calls != len(pages) {
+		t.Errorf("Expected %d LLM calls, got %d", len(pages), client.calls)
+	}
+	if client.maxInFlight > 2 {
+		t.Errorf("Expected at most 2 calls in flight, got %d", client.maxInFlight)
+	}
+}
+
+func TestAnalyzeBatch_PerResultErrors(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	pages := []*models.CrawledPage{{URL: "example.com/a", Title: "A", Content: "Content"}}
+	modes := []AnalysisMode{AnalysisModeJoke, AnalysisModeTest}
+	llmErr := errors.New("llm down")
+	results := analyzeBatch(ctx, pages, modes, BatchOptions{}, mockDS, false,
+		func(mode AnalysisMode) (LlmClient, error) {
+			if mode == AnalysisModeTest {
+				return nil, errors.New("no client")
+			}
+			return &countingLlmClient{err: llmErr}, nil
+		})
+
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if !errors.Is(results[0].Err, llmErr) {
+		t.Errorf("Expected LLM error for joke mode, got %v", results[0].Err)
+	}
+	if results[1].Err == nil || results[1].Mode != AnalysisModeTest {
+		t.Errorf("Expected client error for test mode, got %+v", results[1])
+	}
+}
+
+func TestAnalyzeBatch_DefersWhenLlmUnavailable(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	pages := []*models.CrawledPage{
+		{URL: "example.com/a", Title: "A", Content: "Content", Feed: "https://example.com/feed.xml"},
+		{URL: "example.com/b", Title: "B", Content: "Content", Feed: "https://example.com/feed.xml"},
+		{URL: "example.com/c", Title: "C", Content: "Content", Feed: "https://example.com/feed.xml"},
+	}
+	client := &countingLlmClient{err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	opts := BatchOptions{Concurrency: 1, DeferOnUnavailable: true}
+	results := analyzeBatch(ctx, pages, []AnalysisMode{AnalysisModeJoke}, opts, mockDS, false,
+		func(mode AnalysisMode) (LlmClient, error) { return client, nil })
+
+	for i, result := range results {
+		if !result.Deferred || !errors.Is(result.Err, ErrLlmUnavailable) {
+			t.Errorf("Result %d: expected deferred ErrLlmUnavailable, got deferred=%v err=%v", i, result.Deferred, result.Err)
+		}
+	}
+	if client.calls != 1 {
+		t.Errorf("Expected the LLM to be called once before deferring the rest, got %d calls", client.calls)
+	}
+
+	pending, err := mockDS.ListPendingAnalyses(ctx)
+	if err != nil {
+		t.Fatalf("ListPendingAnalyses() error = %v", err)
+	}
+	if len(pending) != len(pages) {
+		t.Fatalf("Expected %d pending analyses, got %d", len(pages), len(pending))
+	}
+	for _, p := range pending {
+		if p.Mode != AnalysisModeJoke || p.Feed != "https://example.com/feed.xml" || p.Attempts != 1 {
+			t.Errorf("Unexpected pending analysis %+v", p)
+		}
+	}
+}
+
+func TestAnalyzeBatch_QueueForBatch(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	pages := []*models.CrawledPage{{URL: "example.com/a", Title: "A", Content: "Content"}}
+	client := &countingLlmClient{}
+	opts := BatchOptions{QueueForBatch: true}
+	results := analyzeBatch(ctx, pages, []AnalysisMode{AnalysisModeJoke}, opts, mockDS, false,
+		func(mode AnalysisMode) (LlmClient, error) { return client, nil })
+
+	if !results[0].Deferred || !errors.Is(results[0].Err, ErrQueuedForBatch) {
+		t.Errorf("expected a deferred ErrQueuedForBatch, got deferred=%v err=%v", results[0].Deferred, results[0].Err)
+	}
+	if client.calls != 0 {
+		t.Errorf("expected no LLM call, got %d", client.calls)
+	}
+	pending, _ := mockDS.ListPendingAnalyses(ctx)
+	if len(pending) != 1 || !pending[0].Batch {
+		t.Errorf("pending = %+v, want one analysis queued for a batch", pending)
+	}
+
+	// Once submitted, the analysis isn't queued again until its batch is collected
+	pending[0].BatchID, pending[0].PromptHash = "batch-1", "hash"
+	mockDS.WritePendingAnalysis(ctx, pending[0])
+	results = analyzeBatch(ctx, pages, []AnalysisMode{AnalysisModeJoke}, opts, mockDS, false,
+		func(mode AnalysisMode) (LlmClient, error) { return client, nil })
+	if !results[0].Deferred {
+		t.Errorf("expected a deferred analysis, got err=%v", results[0].Err)
+	}
+	pending, _ = mockDS.ListPendingAnalyses(ctx)
+	if len(pending) != 1 || pending[0].BatchID != "batch-1" || pending[0].PromptHash != "hash" {
+		t.Errorf("pending = %+v, want the submitted analysis kept", pending)
+	}
+}
@@ -0,0 +1,131 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/zeace/poisson/lib"
+)
+
+// DefaultCalibrationBuckets is the number of confidence buckets of a calibration report.
+const DefaultCalibrationBuckets = 10
+
+// CalibrationPoint is the joke percentage of an analysis paired with the human label of its article.
+type CalibrationPoint struct {
+	JokePercentage int  `json:"jokePercentage"`
+	IsJoke         bool `json:"isJoke"`
+}
+
+// CalibrationBucket is one range of joke percentages of a calibration curve.
+type CalibrationBucket struct {
+	// MinConfidence and MaxConfidence are the inclusive bounds of the bucket's joke percentages.
+	MinConfidence int `json:"minConfidence"`
+	MaxConfidence int `json:"maxConfidence"`
+	// Count is the number of labeled analyses in the bucket.
+	Count int `json:"count"`
+	// MeanConfidence is the mean predicted joke percentage of the bucket, 0 if it is empty.
+	MeanConfidence float64 `json:"meanConfidence"`
+	// ObservedJokeRate is the percentage of the bucket's articles labeled as jokes, 0 if it is empty.
+	// A well calibrated mode has an observed rate close to the mean confidence in every bucket.
+	ObservedJokeRate float64 `json:"observedJokeRate"`
+}
+
+// CalibrationReport compares the joke percentages of a mode with human labels.
+type CalibrationReport struct {
+	Mode AnalysisMode `json:"mode"`
+	// Labeled is the number of labeled articles with an analysis in the mode.
+	Labeled int `json:"labeled"`
+	// Unanalyzed is the number of labeled articles without an analysis with a joke percentage.
+	Unanalyzed int `json:"unanalyzed"`
+	// Buckets is the calibration curve, from the lowest to the highest confidences.
+	Buckets []CalibrationBucket `json:"buckets"`
+	// BrierScore is the mean squared difference between the predicted probabilities and the
+	// labels (1 for a joke, 0 otherwise): 0 is perfect, 0.25 is no better than always guessing 50%.
+	BrierScore float64 `json:"brierScore"`
+	// ExpectedCalibrationError is the mean gap, in percentage points, between the mean confidence
+	// and the observed joke rate of the buckets, weighted by their counts.
+	ExpectedCalibrationError float64 `json:"expectedCalibrationError"`
+}
+
+// BuildCalibrationReport computes the calibration curve of points in the given number of buckets
+// of equal width. Values below 1 mean DefaultCalibrationBuckets.
+func BuildCalibrationReport(mode AnalysisMode, points []CalibrationPoint, buckets int) *CalibrationReport {
+	if buckets < 1 {
+		buckets = DefaultCalibrationBuckets
+	}
+	report := &CalibrationReport{Mode: mode, Labeled: len(points), Buckets: make([]CalibrationBucket, buckets)}
+	for i := range report.Buckets {
+		report.Buckets[i].MinConfidence = i * 100 / buckets
+		report.Buckets[i].MaxConfidence = (i+1)*100/buckets - 1
+	}
+	report.Buckets[buckets-1].MaxConfidence = 100
+
+	jokes := make([]int, buckets)
+	var squaredError float64
+	for _, point := range points {
+		confidence := min(max(point.JokePercentage, 0), 100)
+		i := min(confidence*buckets/100, buckets-1)
+		report.Buckets[i].Count++
+		report.Buckets[i].MeanConfidence += float64(confidence)
+
+		observed := 0.0
+		if point.IsJoke {
+			jokes[i]++
+			observed = 1
+		}
+		squaredError += math.Pow(float64(confidence)/100-observed, 2)
+	}
+
+	var gap float64
+	for i := range report.Buckets {
+		bucket := &report.Buckets[i]
+		if bucket.Count == 0 {
+			continue
+		}
+		bucket.MeanConfidence /= float64(bucket.Count)
+		bucket.ObservedJokeRate = 100 * float64(jokes[i]) / float64(bucket.Count)
+		gap += float64(bucket.Count) * math.Abs(bucket.MeanConfidence-bucket.ObservedJokeRate)
+	}
+	if len(points) > 0 {
+		report.BrierScore = squaredError / float64(len(points))
+		report.ExpectedCalibrationError = gap / float64(len(points))
+	}
+	return report
+}
+
+// Calibrate builds the calibration report of mode from the stored human labels and the stored
+// analyses of the labeled articles.
+func Calibrate(
+	ctx context.Context,
+	datastoreClient lib.DatastoreClient,
+	mode AnalysisMode,
+	buckets int,
+) (*CalibrationReport, error) {
+	if _, ok := lookupPromptConfig(mode); !ok {
+		return nil, fmt.Errorf("unknown mode '%s'", mode)
+	}
+
+	labels, err := datastoreClient.ListJokeLabels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing joke labels: %w", err)
+	}
+
+	var points []CalibrationPoint
+	unanalyzed := 0
+	for _, label := range labels {
+		result, found, err := datastoreClient.ReadAnalysisResult(ctx, label.URL, mode)
+		if err != nil {
+			return nil, fmt.Errorf("error reading analysis of %s: %w", label.URL, err)
+		}
+		if !found || result.JokePercentage == nil {
+			unanalyzed++
+			continue
+		}
+		points = append(points, CalibrationPoint{JokePercentage: *result.JokePercentage, IsJoke: label.IsJoke})
+	}
+
+	report := BuildCalibrationReport(mode, points, buckets)
+	report.Unanalyzed = unanalyzed
+	return report, nil
+}
@@ -0,0 +1,88 @@
+package analyzer
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestBuildCalibrationReport(t *testing.T) {
+	points := []CalibrationPoint{
+		{JokePercentage: 90, IsJoke: true},
+		{JokePercentage: 95, IsJoke: true},
+		{JokePercentage: 85, IsJoke: false},
+		{JokePercentage: 100, IsJoke: true},
+		{JokePercentage: 10, IsJoke: false},
+		{JokePercentage: 0, IsJoke: false},
+	}
+	report := BuildCalibrationReport(AnalysisModeJoke, points, 2)
+
+	if report.Labeled != 6 || len(report.Buckets) != 2 {
+		t.Fatalf("Labeled = %d, buckets = %d, want 6 and 2", report.Labeled, len(report.Buckets))
+	}
+
+	low, high := report.Buckets[0], report.Buckets[1]
+	if low.MinConfidence != 0 || low.MaxConfidence != 49 || high.MinConfidence != 50 || high.MaxConfidence != 100 {
+		t.Errorf("bucket bounds = %d-%d, %d-%d, want 0-49, 50-100",
+			low.MinConfidence, low.MaxConfidence, high.MinConfidence, high.MaxConfidence)
+	}
+	if low.Count != 2 || low.MeanConfidence != 5 || low.ObservedJokeRate != 0 {
+		t.Errorf("low bucket = %+v, want 2 points, mean 5, observed 0", low)
+	}
+	if high.Count != 4 || high.MeanConfidence != 92.5 || high.ObservedJokeRate != 75 {
+		t.Errorf("high bucket = %+v, want 4 points, mean 92.5, observed 75", high)
+	}
+
+	// (0.01 + 0.0025 + 0.7225 + 0 + 0.01 + 0) / 6
+	if math.Abs(report.BrierScore-0.745/6) > 1e-9 {
+		t.Errorf("BrierScore = %v, want %v", report.BrierScore, 0.745/6)
+	}
+	// (2*5 + 4*17.5) / 6
+	if math.Abs(report.ExpectedCalibrationError-80.0/6) > 1e-9 {
+		t.Errorf("ExpectedCalibrationError = %v, want %v", report.ExpectedCalibrationError, 80.0/6)
+	}
+}
+
+func TestBuildCalibrationReport_Empty(t *testing.T) {
+	report := BuildCalibrationReport(AnalysisModeJoke, nil, 0)
+	if len(report.Buckets) != DefaultCalibrationBuckets {
+		t.Errorf("buckets = %d, want %d", len(report.Buckets), DefaultCalibrationBuckets)
+	}
+	if report.Buckets[DefaultCalibrationBuckets-1].MaxConfidence != 100 {
+		t.Errorf("last bucket should include 100, got %+v", report.Buckets[DefaultCalibrationBuckets-1])
+	}
+	if report.BrierScore != 0 || report.ExpectedCalibrationError != 0 {
+		t.Errorf("expected zero scores without points, got %+v", report)
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	mockDS.WriteAnalysisResult(ctx, "example.com/joke", &models.AnalysisResult{Mode: AnalysisModeJoke, JokePercentage: intPtr(80)})
+	mockDS.WriteAnalysisResult(ctx, "example.com/news", &models.AnalysisResult{Mode: AnalysisModeJoke, JokePercentage: intPtr(30)})
+	mockDS.WriteJokeLabel(ctx, &models.JokeLabel{URL: "example.com/joke", IsJoke: true})
+	mockDS.WriteJokeLabel(ctx, &models.JokeLabel{URL: "example.com/news", IsJoke: false})
+	mockDS.WriteJokeLabel(ctx, &models.JokeLabel{URL: "example.com/unanalyzed", IsJoke: true})
+
+	report, err := Calibrate(ctx, mockDS, AnalysisModeJoke, 10)
+	if err != nil {
+		t.Fatalf("Calibrate() error = %v", err)
+	}
+	if report.Labeled != 2 || report.Unanalyzed != 1 {
+		t.Errorf("Labeled = %d, Unanalyzed = %d, want 2 and 1", report.Labeled, report.Unanalyzed)
+	}
+	if report.Buckets[8].Count != 1 || report.Buckets[8].ObservedJokeRate != 100 {
+		t.Errorf("80-89 bucket = %+v, want one joke", report.Buckets[8])
+	}
+	if report.Buckets[3].Count != 1 || report.Buckets[3].ObservedJokeRate != 0 {
+		t.Errorf("30-39 bucket = %+v, want one non-joke", report.Buckets[3])
+	}
+
+	if _, err := Calibrate(ctx, mockDS, AnalysisMode("invalid"), 10); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
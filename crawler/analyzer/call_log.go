@@ -0,0 +1,97 @@
+package analyzer
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// DefaultLlmCallRetention is how long logged LLM calls are kept by default.
+const DefaultLlmCallRetention = 30 * 24 * time.Hour
+
+// maxLoggedResponseLength bounds the logged response of a call, keeping entities small.
+const maxLoggedResponseLength = 32000
+
+// LlmCallLog stores every request to the LLM and its response in the LlmCall collection
+// (see LlmOptions.CallLog).
+type LlmCallLog struct {
+	Datastore lib.DatastoreClient
+	// Retention is how long calls are kept, recorded in their ExpiresAt.
+	// Zero means DefaultLlmCallRetention.
+	Retention time.Duration
+}
+
+// callSubjectKey is the context key of the page and mode whose analysis makes LLM calls.
+type callSubjectKey struct{}
+
+// callSubject identifies the analysis an LLM call is made for.
+type callSubject struct {
+	url  string
+	mode AnalysisMode
+}
+
+// withCallSubject returns a context whose LLM calls are logged as made to analyze url in mode.
+func withCallSubject(ctx context.Context, url string, mode AnalysisMode) context.Context {
+	return context.WithValue(ctx, callSubjectKey{}, callSubject{url: lib.NormalizeURL(url), mode: mode})
+}
+
+// record stores a call of client with prompt (and imageURL, if any) that took latency.
+// Errors are logged rather than returned, since the log must not fail the analysis.
+// It does nothing if l is nil.
+func (l *LlmCallLog) record(
+	ctx context.Context,
+	client LlmClient,
+	prompt, imageURL string,
+	latency time.Duration,
+	response LlmResponse,
+	callErr error,
+) {
+	if l == nil {
+		return
+	}
+	subject, _ := ctx.Value(callSubjectKey{}).(callSubject)
+	retention := l.Retention
+	if retention <= 0 {
+		retention = DefaultLlmCallRetention
+	}
+
+	now := time.Now()
+	call := &models.LlmCall{
+		URL:              subject.url,
+		Mode:             subject.mode,
+		Model:            client.Model(),
+		Provider:         client.Provider(),
+		PromptHash:       lib.ContentHash(prompt),
+		ImageURL:         imageURL,
+		Response:         response.Content,
+		LatencyMillis:    latency.Milliseconds(),
+		PromptTokens:     response.Usage.PromptTokens,
+		CompletionTokens: response.Usage.CompletionTokens,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(retention),
+	}
+	// Screenshots are sent inline, only their media type is worth keeping
+	if mediaType, _, ok := strings.Cut(call.ImageURL, ","); ok && strings.HasPrefix(mediaType, "data:") {
+		call.ImageURL = mediaType + ",..."
+	}
+	if len(call.Response) > maxLoggedResponseLength {
+		call.Response = call.Response[:maxLoggedResponseLength] + "... [truncated]"
+	}
+	if callErr != nil {
+		call.Error = callErr.Error()
+	}
+
+	// The call is logged even if the analysis was canceled
+	if err := l.Datastore.AppendLlmCall(context.WithoutCancel(ctx), call); err != nil {
+		slog.WarnContext(ctx, "Error logging LLM call", "error", err)
+	}
+}
+
+// PurgeLlmCalls deletes the logged LLM calls older than retention and returns how many were deleted.
+func PurgeLlmCalls(ctx context.Context, datastoreClient lib.DatastoreClient, retention time.Duration) (int, error) {
+	return datastoreClient.DeleteLlmCallsBefore(ctx, time.Now().Add(-retention))
+}
@@ -0,0 +1,86 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+)
+
+func TestGptLlmClient_CallLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(r.URL.Path, "/fail/") {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": {"message": "bad prompt", "type": "invalid_request_error"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"id": "1", "object": "chat.completion", "created": 0, "model": "test",
+			"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "{\"result\": \"ok\"}"}}],
+			"usage": {"prompt_tokens": 12, "completion_tokens": 3, "total_tokens": 15}}`)
+	}))
+	defer server.Close()
+
+	mockDS := lib.NewMockDatastoreClient()
+	callLog := &LlmCallLog{Datastore: mockDS, Retention: time.Hour}
+	ctx := withCallSubject(context.Background(), "https://example.com/cats?utm=1", AnalysisModeTest)
+
+	client := NewGptLlmClientWithOptions(LlmOptions{APIKey: "key", BaseURL: server.URL, Model: "test", CallLog: callLog})
+	if _, err := client.Analyze(ctx, "prompt", &TestResponseSchema, GenerationParams{}); err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+	failing := NewGptLlmClientWithOptions(LlmOptions{APIKey: "key", BaseURL: server.URL + "/fail/", Model: "test", CallLog: callLog})
+	if _, err := failing.Analyze(ctx, "prompt", nil, GenerationParams{}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	calls, err := mockDS.ListLlmCalls(context.Background(), "example.com/cats")
+	if err != nil {
+		t.Fatalf("ListLlmCalls() error = %v", err)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 logged calls, got %d", len(calls))
+	}
+	ok, failed := calls[0], calls[1]
+	if ok.Mode != AnalysisModeTest || ok.Model != "test" || ok.PromptHash != lib.ContentHash("prompt") ||
+		ok.Response != `{"result": "ok"}` || ok.PromptTokens != 12 || ok.CompletionTokens != 3 || ok.Error != "" {
+		t.Errorf("successful call = %+v", ok)
+	}
+	if ok.ExpiresAt.Sub(ok.CreatedAt) != time.Hour {
+		t.Errorf("ExpiresAt - CreatedAt = %v, want 1h", ok.ExpiresAt.Sub(ok.CreatedAt))
+	}
+	if failed.Error == "" || failed.Response != "" {
+		t.Errorf("failed call = %+v, want an error and no response", failed)
+	}
+}
+
+func TestLlmCallLog_Disabled(t *testing.T) {
+	var callLog *LlmCallLog
+	// A nil log records nothing and doesn't panic
+	callLog.record(context.Background(), &MockLlmClient{}, "prompt", "", time.Second, LlmResponse{}, nil)
+}
+
+func TestPurgeLlmCalls(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	callLog := &LlmCallLog{Datastore: mockDS}
+	callLog.record(withCallSubject(ctx, "example.com/a", AnalysisModeJoke), &MockLlmClient{}, "prompt", "", 0, LlmResponse{}, nil)
+	mockDS.LlmCalls[0].CreatedAt = time.Now().Add(-48 * time.Hour)
+	callLog.record(withCallSubject(ctx, "example.com/b", AnalysisModeJoke), &MockLlmClient{}, "prompt", "", 0, LlmResponse{}, nil)
+
+	if mockDS.LlmCalls[1].ExpiresAt.Sub(mockDS.LlmCalls[1].CreatedAt) != DefaultLlmCallRetention {
+		t.Errorf("expected the default retention")
+	}
+	deleted, err := PurgeLlmCalls(ctx, mockDS, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("PurgeLlmCalls() error = %v", err)
+	}
+	if deleted != 1 || len(mockDS.LlmCalls) != 1 || mockDS.LlmCalls[0].URL != "example.com/b" {
+		t.Errorf("deleted %d, kept %d calls, want the old call deleted", deleted, len(mockDS.LlmCalls))
+	}
+}
@@ -0,0 +1,174 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zeace/poisson/models"
+)
+
+// maxChunks limits the number of chunks a long article is analyzed in, bounding the cost of
+// one analysis. Content beyond maxChunks times the content length limit is dropped, and the
+// result is marked ContentTruncated. 20 chunks of the 48000 characters of the default models
+// cover nearly a million characters, so only transcripts and feeds mistaken for articles are
+// truncated; the 6 chunks analyzed before the reduction prompt dropped the end of long reports
+// and serialized stories, where a prank is often given away.
+const maxChunks = 20
+
+// splitContent splits content into at most maxChunks chunks of at most size bytes,
+// preferring to break after a sentence, then at a space.
+// It returns the chunks and whether content had to be cut short.
+func splitContent(content string, size int) ([]string, bool) {
+	var chunks []string
+	for len(content) > 0 && len(chunks) < maxChunks {
+		if len(content) <= size {
+			chunks = append(chunks, content)
+			return chunks, false
+		}
+
+		cut := strings.LastIndex(content[:size], ". ") + 1
+		if cut < size/2 {
+			cut = strings.LastIndex(content[:size], " ")
+		}
+		if cut < size/2 {
+			// No break point in the second half of the chunk, cut at a rune boundary
+			cut = size
+			for cut > 0 && !utf8.RuneStart(content[cut]) {
+				cut--
+			}
+		}
+		chunks = append(chunks, strings.TrimSpace(content[:cut]))
+		content = strings.TrimSpace(content[cut:])
+	}
+	return chunks, len(content) > 0
+}
+
+// analyzeChunks analyzes content that is too long for one prompt in chunks, one LLM call
+// per chunk, and combines the chunk results with one more call to the mode's ReducePrompt,
+// or with its CombineResults function if it has none or the reduction fails.
+// Chunks are at most maxLength characters long, and instruction is appended to every chunk prompt.
+// It returns the combined result and the usage of all calls.
+func analyzeChunks(
+	ctx context.Context,
+	mode AnalysisMode,
+	config PromptConfig,
+	title, content, instruction string,
+	maxLength int,
+	llmClient LlmClient,
+	fingerprint int,
+	verbose bool,
+) (*models.AnalysisResult, LlmUsage, error) {
+	chunks, truncated := splitContent(content, maxLength)
+	if truncated {
+		slog.WarnContext(ctx, "Article too long, analyzing only its start", "chunks", len(chunks))
+	}
+	if verbose {
+		slog.InfoContext(ctx, "Analyzing long article in chunks", "chunks", len(chunks))
+	}
+
+	var usage LlmUsage
+	results := make([]*models.AnalysisResult, 0, len(chunks))
+	for i, chunk := range chunks {
+		chunkTitle := fmt.Sprintf("%s (part %d of %d)", title, i+1, len(chunks))
+		prompt := generatePrompt(config.Template, chunkTitle, chunk, maxLength)
+		response, err := llmClient.Analyze(ctx, prompt+instruction, &config.Schema, config.Generation)
+		if err != nil {
+			return nil, usage, wrapLlmError(fmt.Sprintf("error analyzing part %d of %d", i+1, len(chunks)), err)
+		}
+
+		result, chunkUsage, err := processWithRepair(ctx, response, llmClient, config, fingerprint, verbose)
+		usage.PromptTokens += chunkUsage.PromptTokens
+		usage.CompletionTokens += chunkUsage.CompletionTokens
+		if err != nil {
+			return nil, usage, fmt.Errorf("part %d of %d: %w", i+1, len(chunks), err)
+		}
+		results = append(results, result)
+	}
+
+	result := config.CombineResults(results)
+	if config.ReducePrompt != nil && len(results) > 1 {
+		reduced, reduceUsage, err := reduceChunks(ctx, config, title, results, llmClient, fingerprint, verbose)
+		usage.PromptTokens += reduceUsage.PromptTokens
+		usage.CompletionTokens += reduceUsage.CompletionTokens
+		if err != nil {
+			slog.WarnContext(ctx, "Error combining the parts of a long article, using the highest score", "error", err)
+		} else {
+			result = reduced
+		}
+	}
+	result.Chunks = len(chunks)
+	result.ContentTruncated = truncated
+	return result, usage, nil
+}
+
+// reduceChunks asks the LLM to combine the chunk results of an article into one result with
+// the mode's ReducePrompt. It returns the result and the usage of the calls made.
+func reduceChunks(
+	ctx context.Context,
+	config PromptConfig,
+	title string,
+	results []*models.AnalysisResult,
+	llmClient LlmClient,
+	fingerprint int,
+	verbose bool,
+) (*models.AnalysisResult, LlmUsage, error) {
+	if verbose {
+		slog.InfoContext(ctx, "Combining the analyses of the parts", "chunks", len(results))
+	}
+	response, err := llmClient.Analyze(ctx, config.ReducePrompt(title, results), &config.Schema, config.Generation)
+	if err != nil {
+		return nil, LlmUsage{}, wrapLlmError("error combining parts", err)
+	}
+	return processWithRepair(ctx, response, llmClient, config, fingerprint, verbose)
+}
+
+// JokeReducePrompt returns the prompt combining the joke analyses of the chunks of an article,
+// listing the joke percentage and reasoning of each chunk.
+func JokeReducePrompt(title string, results []*models.AnalysisResult) string {
+	var verdicts strings.Builder
+	for i, result := range results {
+		fmt.Fprintf(&verdicts, "- Part %d of %d: ", i+1, len(results))
+		if result.JokePercentage != nil {
+			fmt.Fprintf(&verdicts, "%d%% likely to be a joke.", *result.JokePercentage)
+		} else {
+			verdicts.WriteString("no verdict.")
+		}
+		if result.JokeReasoning != nil && *result.JokeReasoning != "" {
+			fmt.Fprintf(&verdicts, " %s", *result.JokeReasoning)
+		}
+		verdicts.WriteString("\n")
+	}
+	return fmt.Sprintf(JokeReducePromptTemplate, title, strings.TrimSuffix(verdicts.String(), "\n"))
+}
+
+// CombineJokeResults combines the joke analyses of the chunks of an article. The article gets
+// the highest joke percentage of its chunks, since the giveaway of a prank is often confined to
+// one part of it, and the reasoning of every chunk, prefixed with its part number.
+func CombineJokeResults(results []*models.AnalysisResult) *models.AnalysisResult {
+	combined := *results[0]
+	if len(results) == 1 {
+		return &combined
+	}
+
+	var percentage *int
+	var reasoning []string
+	for i, result := range results {
+		if result.JokePercentage != nil && (percentage == nil || *result.JokePercentage > *percentage) {
+			value := *result.JokePercentage
+			percentage = &value
+		}
+		if result.JokeReasoning != nil && *result.JokeReasoning != "" {
+			reasoning = append(reasoning, fmt.Sprintf("Part %d: %s", i+1, *result.JokeReasoning))
+		}
+	}
+	combined.JokePercentage = percentage
+	combined.JokeReasoning = nil
+	if len(reasoning) > 0 {
+		merged := strings.Join(reasoning, " ")
+		combined.JokeReasoning = &merged
+	}
+	return &combined
+}
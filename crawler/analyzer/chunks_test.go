@@ -0,0 +1,205 @@
+package analyzer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestSplitContent(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		size          int
+		wantChunks    []string
+		wantTruncated bool
+	}{
+		{
+			name:       "short content",
+			content:    "One sentence.",
+			size:       100,
+			wantChunks: []string{"One sentence."},
+		},
+		{
+			name:       "breaks after sentences",
+			content:    "First sentence here. Second sentence here. Third one.",
+			size:       30,
+			wantChunks: []string{"First sentence here.", "Second sentence here.", "Third one."},
+		},
+		{
+			name:       "breaks at spaces without sentences",
+			content:    "aaaa bbbb cccc dddd",
+			size:       10,
+			wantChunks: []string{"aaaa bbbb", "cccc dddd"},
+		},
+		{
+			name:       "cuts at rune boundaries without spaces",
+			content:    "ééééé",
+			size:       5,
+			wantChunks: []string{"éé", "éé", "é"},
+		},
+		{
+			name:          "drops content beyond the chunk limit",
+			content:       strings.Repeat("word ", maxChunks*2),
+			size:          5,
+			wantChunks:    strings.Fields(strings.Repeat("word ", maxChunks)),
+			wantTruncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, truncated := splitContent(tt.content, tt.size)
+			if truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", truncated, tt.wantTruncated)
+			}
+			if strings.Join(chunks, "|") != strings.Join(tt.wantChunks, "|") {
+				t.Errorf("splitContent() = %q, want %q", chunks, tt.wantChunks)
+			}
+		})
+	}
+}
+
+func TestCombineJokeResults(t *testing.T) {
+	results := []*models.AnalysisResult{
+		{Mode: AnalysisModeJoke, JokePercentage: intPtr(10), JokeReasoning: stringPtr("Sober report.")},
+		{Mode: AnalysisModeJoke, JokePercentage: intPtr(90), JokeReasoning: stringPtr("Mentions April Fools.")},
+		{Mode: AnalysisModeJoke, JokePercentage: intPtr(30), JokeReasoning: stringPtr("")},
+	}
+
+	combined := CombineJokeResults(results)
+	if combined.JokePercentage == nil || *combined.JokePercentage != 90 {
+		t.Errorf("Expected highest joke percentage 90, got %v", combined.JokePercentage)
+	}
+	want := "Part 1: Sober report. Part 2: Mentions April Fools."
+	if combined.JokeReasoning == nil || *combined.JokeReasoning != want {
+		t.Errorf("Expected reasoning %q, got %v", want, combined.JokeReasoning)
+	}
+	if *results[0].JokePercentage != 10 {
+		t.Error("Expected chunk results to be left unchanged")
+	}
+}
+
+func TestAnalyzeWithLLM_LongArticleInChunks(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	sentence := strings.Repeat("x", 99) + ". "
+	page := &models.CrawledPage{
+		URL:     "example.com/long",
+		Title:   "Long Article",
+		Content: strings.Repeat(sentence, 2*DefaultMaxContentLength/len(sentence)+10),
+	}
+	mockLLM := &MockLlmClient{
+		Responses: []string{
+			`{"is_joke": false, "confidence": 80, "reasoning": "Reads like news."}`,
+			`{"is_joke": true, "confidence": 70, "reasoning": "Ends with a prank."}`,
+		},
+		Response:  `{"is_joke": true, "confidence": 75, "reasoning": "The prank is revealed in the second part."}`,
+		Usage:     LlmUsage{PromptTokens: 1000, CompletionTokens: 20},
+		ModelName: "gpt-4o",
+
+		MaxContentLength: DefaultMaxContentLength,
+	}
+
+	result, err := analyzeWithLLM(ctx, page, mockLLM, AnalysisModeJoke, LanguagePolicyAsIs, mockDS, false, nil)
+	if err != nil {
+		t.Fatalf("analyzeWithLLM() error = %v", err)
+	}
+
+	// 3 chunks and the reduction
+	if mockLLM.Calls != 4 || result.Chunks != 3 || result.ContentTruncated {
+		t.Errorf("Expected 3 chunks analyzed and combined, got %d calls, Chunks = %d and ContentTruncated = %v",
+			mockLLM.Calls, result.Chunks, result.ContentTruncated)
+	}
+	for _, want := range []string{"Article title: Long Article", "- Part 2 of 3: 70% likely to be a joke. Ends with a prank.\n- Part 3 of 3"} {
+		if !strings.Contains(mockLLM.LastPrompt, want) {
+			t.Errorf("Expected reduction prompt to contain %q, got %q", want, mockLLM.LastPrompt)
+		}
+	}
+	if result.JokePercentage == nil || *result.JokePercentage != 75 {
+		t.Errorf("Expected joke percentage 75 from the reduction, got %v", result.JokePercentage)
+	}
+	if result.PromptTokens != 4000 || result.CompletionTokens != 80 {
+		t.Errorf("Expected usage of all 4 calls, got %d prompt and %d completion tokens", result.PromptTokens, result.CompletionTokens)
+	}
+}
+
+func TestAnalyzeWithLLM_ReductionFails(t *testing.T) {
+	sentence := strings.Repeat("x", 99) + ". "
+	page := &models.CrawledPage{
+		URL:     "example.com/long",
+		Title:   "Long Article",
+		Content: strings.Repeat(sentence, DefaultMaxContentLength/len(sentence)+10),
+	}
+	mockLLM := &MockLlmClient{
+		Responses: []string{
+			`{"is_joke": false, "confidence": 80, "reasoning": "Reads like news."}`,
+			`{"is_joke": true, "confidence": 70, "reasoning": "Ends with a prank."}`,
+		},
+		Response:  `not JSON`, // The reduction and its repair
+		ModelName: "gpt-4o",
+
+		MaxContentLength: DefaultMaxContentLength,
+	}
+
+	result, err := analyzeWithLLM(context.Background(), page, mockLLM, AnalysisModeJoke, LanguagePolicyAsIs,
+		lib.NewMockDatastoreClient(), false, nil)
+	if err != nil {
+		t.Fatalf("analyzeWithLLM() error = %v", err)
+	}
+	if result.JokePercentage == nil || *result.JokePercentage != 70 {
+		t.Errorf("Expected the highest joke percentage 70, got %v", result.JokePercentage)
+	}
+	if result.Chunks != 2 {
+		t.Errorf("Chunks = %d, want 2", result.Chunks)
+	}
+}
+
+func TestAnalyzeWithLLM_ContentTruncated(t *testing.T) {
+	page := &models.CrawledPage{
+		URL:     "example.com/long",
+		Title:   "Long Article",
+		Content: strings.Repeat("x", 200),
+	}
+	mockLLM := &MockLlmClient{
+		Response:  `{"result": "ok"}`,
+		ModelName: "gpt-4o",
+
+		MaxContentLength: 100,
+	}
+
+	// Test mode has no CombineResults, so long content is truncated
+	result, err := analyzeWithLLM(context.Background(), page, mockLLM, AnalysisModeTest, LanguagePolicyAsIs,
+		lib.NewMockDatastoreClient(), false, nil)
+	if err != nil {
+		t.Fatalf("analyzeWithLLM() error = %v", err)
+	}
+	if !result.ContentTruncated || !strings.Contains(mockLLM.LastPrompt, "[content truncated]") {
+		t.Errorf("Expected truncated content, got ContentTruncated = %v", result.ContentTruncated)
+	}
+}
+
+func TestGeneratePromptFingerprint_ReduceTemplate(t *testing.T) {
+	before, _ := GeneratePromptFingerprint(AnalysisModeJoke)
+
+	promptTemplatesMu.Lock()
+	config := PromptTemplates[AnalysisModeJoke]
+	original := config.ReduceTemplate
+	config.ReduceTemplate = original + "\nAnswer in one word."
+	PromptTemplates[AnalysisModeJoke] = config
+	promptTemplatesMu.Unlock()
+	defer func() {
+		promptTemplatesMu.Lock()
+		config.ReduceTemplate = original
+		PromptTemplates[AnalysisModeJoke] = config
+		promptTemplatesMu.Unlock()
+	}()
+
+	if after, _ := GeneratePromptFingerprint(AnalysisModeJoke); after == before {
+		t.Error("expected the reduction template to change the joke prompt fingerprint")
+	}
+}
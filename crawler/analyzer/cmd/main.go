@@ -8,20 +8,36 @@ import (
 
 	"github.com/zeace/poisson/crawler/analyzer"
 	"github.com/zeace/poisson/crawler/config"
+	"github.com/zeace/poisson/lib/logging"
 )
 
 func main() {
 	var (
-		apiKey   = flag.String("api-key", "", "OpenAI API key (or set OPENAI_API_KEY environment variable)")
-		filePath = flag.String("file", "", "Path to the file containing article content")
-		mode     = flag.String("mode", "joke", "Analysis mode (joke)")
+		apiKey    = flag.String("api-key", "", "OpenAI API key (or set OPENAI_API_KEY environment variable)")
+		baseURL   = flag.String("base-url", "", "Base URL of an OpenAI-compatible API (or set OPENAI_BASE_URL environment variable)")
+		model     = flag.String("model", "", "LLM model name, overrides the per-mode default (or set OPENAI_MODEL environment variable)")
+		filePath  = flag.String("file", "", "Path to the file containing article content")
+		mode      = flag.String("mode", "joke", "Analysis mode (joke)")
+		prompts   = flag.String("prompts", "", "Directory or gs://bucket/prefix with <mode>.prompt.md templates replacing the embedded ones (or set POISSON_PROMPTS environment variable)")
+		stream    = flag.Bool("stream", false, "Stream the LLM response and stop as soon as the JSON result is complete")
+		logLevel  = flag.String("log-level", "", "Minimum log level: debug, info, warn or error (or set POISSON_LOG_LEVEL environment variable)")
+		logFormat = flag.String("log-format", "", "Log format: text or json (or set POISSON_LOG_FORMAT environment variable)")
+		systemMsg = flag.String("system-prompt", "", "System message sent before the prompt, overrides the per-mode default")
+		maxTokens = flag.Int("max-tokens", 0, "Maximum completion tokens, overrides the per-mode default (0 for no limit)")
 	)
+	var temperature, topP config.OptionalFloat
+	flag.Var(&temperature, "temperature", "Sampling temperature, overrides the per-mode default")
+	flag.Var(&topP, "top-p", "Nucleus sampling probability mass, overrides the per-mode default")
 	flag.Parse()
 
+	if err := logging.Init(*logLevel, *logFormat); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
 	// Validate mode
 	promptMode, err := analyzer.VerifyValidMode(*mode)
 	if err != nil {
-		log.Printf("Error: unknown mode '%s'. Valid modes: joke\n", *mode)
+		log.Printf("Error: unknown mode '%s'. Valid modes: %s\n", *mode, strings.Join(analyzer.ModeNames(), ", "))
 		log.Printf("Usage: %s [flags]\n", os.Args[0])
 		flag.PrintDefaults()
 		log.Fatalf("")
@@ -34,8 +50,35 @@ func main() {
 		log.Fatalf("")
 	}
 
+	if source := config.GetPromptSource(*prompts); source != "" {
+		loadCtx, loadCancel := config.NewPromptLoadContext()
+		loaded, err := analyzer.LoadPromptTemplates(loadCtx, source)
+		loadCancel()
+		if err != nil {
+			log.Fatalf("Error loading prompt templates: %v\n", err)
+		}
+		log.Printf("Loaded %d prompt template(s) from %s\n", len(loaded), source)
+	}
+
+	llmModel, err := analyzer.ResolveModel(promptMode, config.GetOpenAIModel(*model))
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	analyzer.GenerationOverrides = analyzer.GenerationParams{
+		SystemPrompt:        *systemMsg,
+		Temperature:         temperature.Value,
+		TopP:                topP.Value,
+		MaxCompletionTokens: *maxTokens,
+	}
+
 	// Get API key from flag, embedded secrets, or environment
-	apiKeyValue := config.GetOpenAIKey(*apiKey)
+	llmClient := analyzer.NewGptLlmClientWithOptions(analyzer.LlmOptions{
+		APIKey:  config.GetOpenAIKey(*apiKey),
+		BaseURL: config.GetOpenAIBaseURL(*baseURL),
+		Model:   llmModel,
+		Stream:  *stream,
+	})
 
 	// Read content from file
 	log.Printf("Reading content from: %s\n", *filePath)
@@ -53,7 +96,11 @@ func main() {
 	if err != nil {
 		log.Fatalf("Error: %v\n", err)
 	}
-	analysis, err := analyzer.AnalyzeWithLLM(prompt, apiKeyValue)
+	analysisCtx, analysisCancel := config.NewAnalysisContext()
+	defer analysisCancel()
+
+	promptConfig := analyzer.PromptTemplates[promptMode]
+	analysis, err := llmClient.Analyze(analysisCtx, prompt, &promptConfig.Schema, promptConfig.Generation)
 	if err != nil {
 		log.Fatalf("Error: %v\n", err)
 	}
@@ -61,6 +108,9 @@ func main() {
 	log.Printf("\n%s\n", strings.Repeat("=", 60))
 	log.Printf("ANALYSIS RESULTS\n")
 	log.Printf("%s\n", strings.Repeat("=", 60))
-	log.Printf("%s\n", analysis)
+	log.Printf("%s\n", analysis.Content)
+	log.Printf("%s\n", strings.Repeat("=", 60))
+	log.Printf("Tokens: %d prompt, %d completion (estimated cost $%.4f)\n",
+		analysis.Usage.PromptTokens, analysis.Usage.CompletionTokens, analyzer.EstimateCost(llmModel, analysis.Usage))
 	log.Printf("%s\n", strings.Repeat("=", 60))
 }
@@ -0,0 +1,189 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	openai "github.com/openai/openai-go/v3"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// DefaultMaxContentLength is the number of characters of article content sent in one prompt
+// to models not listed in ModelMaxContentLengths, such as small models on local servers.
+const DefaultMaxContentLength = 8000
+
+// ModelMaxContentLengths holds the number of characters of article content sent in one prompt
+// to the models with a large context window. Longer articles are analyzed in chunks or truncated.
+var ModelMaxContentLengths = map[string]int{
+	openai.ChatModelGPT4o:       48000,
+	openai.ChatModelGPT4oMini:   48000,
+	openai.ChatModelGPT4Turbo:   48000,
+	openai.ChatModelGPT4_1:      48000,
+	openai.ChatModelGPT4_1Mini:  48000,
+	openai.ChatModelGPT4_1Nano:  48000,
+	openai.ChatModelGPT3_5Turbo: 8000,
+}
+
+// modelMaxContentLength returns the content length limit of model: its entry in
+// ModelMaxContentLengths or DefaultMaxContentLength.
+func modelMaxContentLength(model string) int {
+	if length, ok := ModelMaxContentLengths[model]; ok {
+		return length
+	}
+	return DefaultMaxContentLength
+}
+
+// modeMaxContentLength returns the content length limit of config with model: the mode's own
+// limit if it sets one, or the model's.
+func modeMaxContentLength(config PromptConfig, model string) int {
+	if config.MaxContentLength > 0 {
+		return config.MaxContentLength
+	}
+	return modelMaxContentLength(model)
+}
+
+// maxContentLength returns the content length limit of the prompts of config sent through
+// llmClient: the limit set in the client's LlmOptions, or the limit of the mode with the
+// client's model. An ensemble is limited by its smallest member.
+func maxContentLength(config PromptConfig, llmClient LlmClient) int {
+	switch client := llmClient.(type) {
+	case *VisionLlmClient:
+		return maxContentLength(config, client.Text)
+	case *EnsembleLlmClient:
+		length := 0
+		for _, member := range client.Members {
+			if memberLength := maxContentLength(config, member); length == 0 || memberLength < length {
+				length = memberLength
+			}
+		}
+		return length
+	case *GptLlmClient:
+		if client.maxContentLength > 0 {
+			return client.maxContentLength
+		}
+	case *MockLlmClient:
+		if client.MaxContentLength > 0 {
+			return client.MaxContentLength
+		}
+	}
+	return modeMaxContentLength(config, llmClient.Model())
+}
+
+// ErrContentTooShort is wrapped by the errors of analyses skipped because the page has less
+// content than the minimums of the mode, which usually means its extraction failed.
+var ErrContentTooShort = errors.New("content too short to analyze")
+
+// DefaultMinContentLengths are the minimum content lengths of the modes used by the binaries
+// unless configured otherwise (see ParseMinContentLengths). Headline screening only reads the
+// title and has no minimum.
+var DefaultMinContentLengths = map[AnalysisMode]int{
+	AnalysisModeJoke: 200,
+}
+
+// ParseMinContentLengths parses per-mode minimum content lengths given as
+// "<mode>=<characters>,..." (e.g. "joke=200,test=0"), where 0 means no minimum. Modes not listed
+// keep the minimum of their PromptConfig. The empty string means DefaultMinContentLengths.
+func ParseMinContentLengths(spec string) (map[AnalysisMode]int, error) {
+	if strings.TrimSpace(spec) == "" {
+		return DefaultMinContentLengths, nil
+	}
+	return parseModeMinimums(spec, "content length", "characters", "joke=200")
+}
+
+// ParseMinWordCounts parses per-mode minimum word counts given as "<mode>=<words>,..."
+// (e.g. "joke=50"), where 0 means no minimum. Modes not listed keep the minimum of their
+// PromptConfig. The empty string means no minimums.
+func ParseMinWordCounts(spec string) (map[AnalysisMode]int, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	return parseModeMinimums(spec, "word count", "words", "joke=50")
+}
+
+// parseModeMinimums parses "<mode>=<count>,..." with non-negative counts. what, unit and example
+// describe the minimum in errors.
+func parseModeMinimums(spec, what, unit, example string) (map[AnalysisMode]int, error) {
+	minimums := make(map[AnalysisMode]int)
+	for _, entry := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid minimum %s %q (want e.g. %s)", what, entry, example)
+		}
+		mode, err := VerifyValidMode(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		minimum, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || minimum < 0 {
+			return nil, fmt.Errorf("invalid minimum %s %q: must be a non-negative number of %s", what, entry, unit)
+		}
+		minimums[mode] = minimum
+	}
+	return minimums, nil
+}
+
+// SetMinContentLengths sets the MinContentLength of the modes in lengths. It must be called
+// before any analysis starts.
+func SetMinContentLengths(lengths map[AnalysisMode]int) {
+	promptTemplatesMu.Lock()
+	defer promptTemplatesMu.Unlock()
+	for mode, length := range lengths {
+		if config, ok := PromptTemplates[mode]; ok {
+			config.MinContentLength = length
+			PromptTemplates[mode] = config
+		}
+	}
+}
+
+// SetMinWordCounts sets the MinWordCount of the modes in counts. It must be called before any
+// analysis starts.
+func SetMinWordCounts(counts map[AnalysisMode]int) {
+	promptTemplatesMu.Lock()
+	defer promptTemplatesMu.Unlock()
+	for mode, count := range counts {
+		if config, ok := PromptTemplates[mode]; ok {
+			config.MinWordCount = count
+			PromptTemplates[mode] = config
+		}
+	}
+}
+
+// checkContentLength returns an error wrapping ErrContentTooShort if page has fewer characters
+// or words of content than the minimums of mode, and records the skip in the audit trail of the
+// page. The words of pages stored before they were counted are counted from their content.
+func checkContentLength(
+	ctx context.Context,
+	page *models.CrawledPage,
+	mode AnalysisMode,
+	datastoreClient lib.DatastoreClient,
+) error {
+	config, _ := lookupPromptConfig(mode)
+	var reason string
+	minLength := config.MinContentLength
+	if length := utf8.RuneCountInString(strings.TrimSpace(page.Content)); minLength > 0 && length < minLength {
+		reason = fmt.Sprintf("%d characters of content, under the minimum of %d in %s mode", length, minLength, mode)
+	} else if config.MinWordCount > 0 {
+		words := page.WordCount
+		if words == 0 {
+			words = lib.WordCount(page.Content)
+		}
+		if words < config.MinWordCount {
+			reason = fmt.Sprintf("%d words of content, under the minimum of %d in %s mode", words, config.MinWordCount, mode)
+		}
+	}
+	if reason == "" {
+		return nil
+	}
+	lib.RecordAuditEvent(ctx, datastoreClient, &models.AuditEvent{
+		URL:    page.URL,
+		Action: models.AuditActionSkipped,
+		Mode:   mode,
+		Detail: reason,
+	})
+	return fmt.Errorf("%w: page %s has %s", ErrContentTooShort, page.URL, reason)
+}
@@ -0,0 +1,234 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	openai "github.com/openai/openai-go/v3"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestMaxContentLength(t *testing.T) {
+	joke := PromptTemplates[AnalysisModeJoke]
+	limited := joke
+	limited.MaxContentLength = 2000
+
+	tests := []struct {
+		name   string
+		config PromptConfig
+		client LlmClient
+		want   int
+	}{
+		{
+			name:   "large context model",
+			config: joke,
+			client: NewGptLlmClientWithOptions(LlmOptions{Model: openai.ChatModelGPT4o}),
+			want:   ModelMaxContentLengths[openai.ChatModelGPT4o],
+		},
+		{
+			name:   "unknown model",
+			config: joke,
+			client: NewGptLlmClientWithOptions(LlmOptions{Model: "llama-3-8b"}),
+			want:   DefaultMaxContentLength,
+		},
+		{
+			name:   "mode limit",
+			config: limited,
+			client: NewGptLlmClientWithOptions(LlmOptions{Model: openai.ChatModelGPT4o}),
+			want:   2000,
+		},
+		{
+			name:   "options override the mode and model",
+			config: limited,
+			client: NewGptLlmClientWithOptions(LlmOptions{Model: openai.ChatModelGPT4o, MaxContentLength: 100000}),
+			want:   100000,
+		},
+		{
+			name:   "ensemble is limited by its smallest model",
+			config: joke,
+			client: NewLlmClient(LlmOptions{
+				Model:    openai.ChatModelGPT4o,
+				Ensemble: EnsembleOptions{Runs: 1, Models: []string{"llama-3-8b"}, Method: EnsembleMean},
+			}),
+			want: DefaultMaxContentLength,
+		},
+		{
+			name:   "vision client uses its text client",
+			config: joke,
+			client: &VisionLlmClient{Text: &MockLlmClient{ModelName: openai.ChatModelGPT4oMini, MaxContentLength: 3000}},
+			want:   3000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := maxContentLength(tt.config, tt.client); got != tt.want {
+				t.Errorf("maxContentLength() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMinContentLengths(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    map[AnalysisMode]int
+		wantErr bool
+	}{
+		{spec: "", want: DefaultMinContentLengths},
+		{spec: "joke=500", want: map[AnalysisMode]int{AnalysisModeJoke: 500}},
+		{spec: " joke = 0 , test=50", want: map[AnalysisMode]int{AnalysisModeJoke: 0, AnalysisModeTest: 50}},
+		{spec: "200", wantErr: true},
+		{spec: "satire=200", wantErr: true},
+		{spec: "joke=-1", wantErr: true},
+		{spec: "joke=many", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseMinContentLengths(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMinContentLengths(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMinContentLengths(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMinWordCounts(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    map[AnalysisMode]int
+		wantErr bool
+	}{
+		{spec: "", want: nil},
+		{spec: "joke=50, test=0", want: map[AnalysisMode]int{AnalysisModeJoke: 50, AnalysisModeTest: 0}},
+		{spec: "50", wantErr: true},
+		{spec: "joke=-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseMinWordCounts(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMinWordCounts(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMinWordCounts(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyze_SkipsShortContent(t *testing.T) {
+	restorePromptTemplates(t)
+	SetMinContentLengths(map[AnalysisMode]int{AnalysisModeJoke: 200})
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	mockLLM := &MockLlmClient{Response: `{"is_joke": false, "confidence": 10, "reasoning": "Serious"}`}
+
+	short := &models.CrawledPage{URL: "example.com/short", Title: "Short", Content: "  Subscribe to read.  "}
+	_, err := analyze(ctx, short, mockLLM, AnalysisModeJoke, mockDS, false)
+	if !errors.Is(err, ErrContentTooShort) {
+		t.Fatalf("analyze() error = %v, want ErrContentTooShort", err)
+	}
+	if mockLLM.Calls != 0 {
+		t.Errorf("LLM called %d times, want 0", mockLLM.Calls)
+	}
+	if _, found, _ := mockDS.ReadAnalysisResult(ctx, short.URL, AnalysisModeJoke); found {
+		t.Error("analysis stored for a skipped page")
+	}
+	events, _ := mockDS.ListAuditEvents(ctx, short.URL)
+	if len(events) != 1 || events[0].Action != models.AuditActionSkipped || !strings.Contains(events[0].Detail, "18 characters") {
+		t.Errorf("audit events = %+v, want one skipped event with the content length", events)
+	}
+
+	// Other modes keep their own minimum
+	if _, err := analyze(ctx, short, mockLLM, AnalysisModeTest, mockDS, false); errors.Is(err, ErrContentTooShort) {
+		t.Errorf("analyze() in test mode error = %v, want no minimum", err)
+	}
+
+	long := &models.CrawledPage{URL: "example.com/long", Title: "Long", Content: strings.Repeat("words", 40)}
+	if _, err := analyze(ctx, long, mockLLM, AnalysisModeJoke, mockDS, false); err != nil {
+		t.Errorf("analyze() error = %v, want nil for content at the minimum", err)
+	}
+}
+
+func TestAnalyze_SkipsFewWords(t *testing.T) {
+	restorePromptTemplates(t)
+	SetMinContentLengths(map[AnalysisMode]int{AnalysisModeJoke: 0})
+	counts, err := ParseMinWordCounts("joke=20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetMinWordCounts(counts)
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	mockLLM := &MockLlmClient{Response: `{"is_joke": false, "confidence": 10, "reasoning": "Serious"}`}
+
+	tests := []struct {
+		name     string
+		page     *models.CrawledPage
+		wantSkip bool
+	}{
+		{
+			name:     "counted words",
+			page:     &models.CrawledPage{URL: "example.com/counted", Title: "Counted", Content: strings.Repeat("word ", 30), WordCount: 12},
+			wantSkip: true,
+		},
+		{
+			name:     "words counted from content",
+			page:     &models.CrawledPage{URL: "example.com/old", Title: "Old", Content: strings.Repeat("word ", 12)},
+			wantSkip: true,
+		},
+		{
+			name: "at the minimum",
+			page: &models.CrawledPage{URL: "example.com/long", Title: "Long", Content: strings.Repeat("word ", 20)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := analyze(ctx, tt.page, mockLLM, AnalysisModeJoke, mockDS, false)
+			if errors.Is(err, ErrContentTooShort) != tt.wantSkip {
+				t.Fatalf("analyze() error = %v, want skipped %v", err, tt.wantSkip)
+			}
+			if !tt.wantSkip {
+				return
+			}
+			events, _ := mockDS.ListAuditEvents(ctx, tt.page.URL)
+			if len(events) != 1 || !strings.Contains(events[0].Detail, "12 words") {
+				t.Errorf("audit events = %+v, want one skipped event with the word count", events)
+			}
+		})
+	}
+}
+
+func TestAnalyzeBatch_SkipsShortContent(t *testing.T) {
+	restorePromptTemplates(t)
+	SetMinContentLengths(map[AnalysisMode]int{AnalysisModeJoke: 200})
+	mockDS := lib.NewMockDatastoreClient()
+	mockLLM := &MockLlmClient{Response: `{"is_joke": false, "confidence": 10, "reasoning": "Serious"}`}
+	pages := []*models.CrawledPage{
+		{URL: "example.com/short", Title: "Short", Content: "Content"},
+		{URL: "example.com/long", Title: "Long", Content: strings.Repeat("content ", 30)},
+	}
+
+	results := analyzeBatch(context.Background(), pages, []AnalysisMode{AnalysisModeJoke}, BatchOptions{}, mockDS, false,
+		func(AnalysisMode) (LlmClient, error) { return mockLLM, nil })
+	if !errors.Is(results[0].Err, ErrContentTooShort) {
+		t.Errorf("short page error = %v, want ErrContentTooShort", results[0].Err)
+	}
+	if results[1].Err != nil || results[1].Result == nil {
+		t.Errorf("long page = %+v, %v, want an analysis", results[1].Result, results[1].Err)
+	}
+	if mockLLM.Calls != 1 {
+		t.Errorf("LLM called %d times, want 1", mockLLM.Calls)
+	}
+}
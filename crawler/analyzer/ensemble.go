@@ -0,0 +1,259 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/zeace/poisson/models"
+)
+
+// EnsembleMethod is how the scores of the runs of an ensemble are combined.
+type EnsembleMethod string
+
+const (
+	// EnsembleMedian takes the median score, which ignores a single outlying run.
+	EnsembleMedian EnsembleMethod = "median"
+	// EnsembleMean takes the mean score, rounded to the nearest integer.
+	EnsembleMean EnsembleMethod = "mean"
+)
+
+// ParseEnsembleMethod converts a string to an EnsembleMethod. The empty string means EnsembleMedian.
+func ParseEnsembleMethod(s string) (EnsembleMethod, error) {
+	switch EnsembleMethod(strings.ToLower(s)) {
+	case "", EnsembleMedian:
+		return EnsembleMedian, nil
+	case EnsembleMean:
+		return EnsembleMean, nil
+	default:
+		return "", fmt.Errorf("unknown ensemble method %q (want median or mean)", s)
+	}
+}
+
+// EnsembleOptions configures ensemble scoring, where each article is analyzed several times
+// and the scores are aggregated. The zero value analyzes each article once.
+type EnsembleOptions struct {
+	// Runs is the number of analyses made with each model. Values below 1 mean 1.
+	// Repeated runs only differ if the mode's temperature is above 0.
+	Runs int
+	// Models are extra models whose analyses join those of LlmOptions.Model. They are served
+	// by the same endpoint.
+	Models []string
+	// Method is how the scores are combined. Empty means EnsembleMedian.
+	Method EnsembleMethod
+}
+
+// Enabled reports whether the options ask for more than one analysis per article.
+func (o EnsembleOptions) Enabled() bool {
+	return o.Runs > 1 || len(o.Models) > 0
+}
+
+// EnsembleLlmClient is an LlmClient made of several members, each analyzing every article.
+// Modes with an AggregateResults function aggregate the members' results; other modes and
+// single calls made through Analyze (e.g. translations) use the first member only.
+type EnsembleLlmClient struct {
+	Members []LlmClient
+	Method  EnsembleMethod
+}
+
+// NewLlmClient creates the LLM client described by opts: a GptLlmClient, or an EnsembleLlmClient
+// of GptLlmClients if opts.Ensemble is enabled. If opts.Vision is enabled, the client is wrapped
+// in a VisionLlmClient.
+func NewLlmClient(opts LlmOptions) LlmClient {
+	client := newTextLlmClient(opts)
+	if !opts.Vision.Enabled() {
+		return client
+	}
+	visionOpts := opts
+	visionOpts.Model = opts.Vision.Model
+	return &VisionLlmClient{Text: client, Vision: NewGptLlmClientWithOptions(visionOpts), Weight: opts.Vision.Weight}
+}
+
+// newTextLlmClient creates the client analyzing article text described by opts. With a
+// generation seed, the members of an ensemble get consecutive seeds, so that repeated runs
+// of a model still differ but the ensemble can be reproduced.
+func newTextLlmClient(opts LlmOptions) LlmClient {
+	if !opts.Ensemble.Enabled() {
+		return NewGptLlmClientWithOptions(opts)
+	}
+
+	runs := max(opts.Ensemble.Runs, 1)
+	ensemble := &EnsembleLlmClient{Method: opts.Ensemble.Method}
+	for _, model := range append([]string{opts.Model}, opts.Ensemble.Models...) {
+		memberOpts := opts
+		memberOpts.Model = model
+		for i := 0; i < runs; i++ {
+			if opts.Generation.Seed != nil {
+				seed := *opts.Generation.Seed + int64(len(ensemble.Members))
+				memberOpts.Generation.Seed = &seed
+			}
+			ensemble.Members = append(ensemble.Members, NewGptLlmClientWithOptions(memberOpts))
+		}
+	}
+	return ensemble
+}
+
+// Analyze analyzes content with the first member.
+func (e *EnsembleLlmClient) Analyze(
+	ctx context.Context,
+	prompt string,
+	schema *ResponseSchema,
+	params GenerationParams,
+) (LlmResponse, error) {
+	return e.Members[0].Analyze(ctx, prompt, schema, params)
+}
+
+// Model returns the distinct models of the members joined with "+", e.g. "gpt-4o+llama-3-8b".
+func (e *EnsembleLlmClient) Model() string {
+	return e.joinMembers(LlmClient.Model)
+}
+
+// Provider returns the distinct providers of the members joined with "+".
+func (e *EnsembleLlmClient) Provider() string {
+	return e.joinMembers(LlmClient.Provider)
+}
+
+// joinMembers joins the distinct values of field over the members, in member order.
+func (e *EnsembleLlmClient) joinMembers(field func(LlmClient) string) string {
+	var values []string
+	for _, member := range e.Members {
+		if value := field(member); !slices.Contains(values, value) {
+			values = append(values, value)
+		}
+	}
+	return strings.Join(values, "+")
+}
+
+// clientSeed returns the generation seed of the calls made through llmClient (the first
+// member's for an ensemble), or zero if it sends none.
+func clientSeed(llmClient LlmClient) int64 {
+	switch client := llmClient.(type) {
+	case *VisionLlmClient:
+		return clientSeed(client.Text)
+	case *EnsembleLlmClient:
+		return clientSeed(client.Members[0])
+	case *GptLlmClient:
+		if client.generation.Seed != nil {
+			return *client.generation.Seed
+		}
+	}
+	return 0
+}
+
+// costModel returns the model whose price applies to single calls made through llmClient.
+func costModel(llmClient LlmClient) string {
+	if vision, ok := llmClient.(*VisionLlmClient); ok {
+		return costModel(vision.Text)
+	}
+	if ensemble, ok := llmClient.(*EnsembleLlmClient); ok {
+		return ensemble.Members[0].Model()
+	}
+	return llmClient.Model()
+}
+
+// analyzeEnsemble analyzes an article once per member of ensemble with analyzeWith, and
+// aggregates the results with aggregate. It returns the aggregated result, with a record of
+// every run, and the total usage and estimated cost of all calls.
+func analyzeEnsemble(
+	ctx context.Context,
+	ensemble *EnsembleLlmClient,
+	aggregate func([]*models.AnalysisResult, EnsembleMethod) *models.AnalysisResult,
+	analyzeWith func(LlmClient) (*models.AnalysisResult, LlmUsage, error),
+	verbose bool,
+) (*models.AnalysisResult, LlmUsage, float64, error) {
+	if verbose {
+		slog.InfoContext(ctx, "Analyzing with ensemble", "runs", len(ensemble.Members), "model", ensemble.Model())
+	}
+
+	var usage LlmUsage
+	var cost float64
+	results := make([]*models.AnalysisResult, 0, len(ensemble.Members))
+	runs := make([]models.EnsembleRun, 0, len(ensemble.Members))
+	for i, member := range ensemble.Members {
+		result, runUsage, err := analyzeWith(member)
+		usage.PromptTokens += runUsage.PromptTokens
+		usage.CompletionTokens += runUsage.CompletionTokens
+		cost += EstimateCost(member.Model(), runUsage)
+		if err != nil {
+			return nil, usage, cost, fmt.Errorf("ensemble run %d of %d: %w", i+1, len(ensemble.Members), err)
+		}
+		results = append(results, result)
+		runs = append(runs, models.EnsembleRun{
+			Model:          member.Model(),
+			Provider:       member.Provider(),
+			JokePercentage: result.JokePercentage,
+		})
+	}
+
+	method := ensemble.Method
+	if method == "" {
+		method = EnsembleMedian
+	}
+	result := aggregate(results, method)
+	if result.Ensemble == nil {
+		result.Ensemble = &models.EnsembleSummary{}
+	}
+	result.Ensemble.Method = string(method)
+	result.Ensemble.Runs = runs
+	return result, usage, cost, nil
+}
+
+// AggregateJokeResults combines the joke analyses of the runs of an ensemble. The joke
+// percentage is the median or mean of the runs' percentages and the reasoning is that of the
+// run closest to it. The variance of the percentages is recorded on the result.
+func AggregateJokeResults(results []*models.AnalysisResult, method EnsembleMethod) *models.AnalysisResult {
+	var scores []float64
+	for _, result := range results {
+		if result.JokePercentage != nil {
+			scores = append(scores, float64(*result.JokePercentage))
+		}
+	}
+	if len(scores) == 0 {
+		aggregated := *results[0]
+		return &aggregated
+	}
+
+	var mean float64
+	for _, score := range scores {
+		mean += score
+	}
+	mean /= float64(len(scores))
+	var variance float64
+	for _, score := range scores {
+		variance += (score - mean) * (score - mean)
+	}
+	variance /= float64(len(scores))
+
+	value := mean
+	if method != EnsembleMean {
+		sorted := slices.Clone(scores)
+		sort.Float64s(sorted)
+		middle := len(sorted) / 2
+		value = sorted[middle]
+		if len(sorted)%2 == 0 {
+			value = (sorted[middle-1] + sorted[middle]) / 2
+		}
+	}
+	percentage := int(math.Round(value))
+
+	// Keep the reasoning of the run that agrees best with the aggregated score
+	closest := results[0]
+	for _, result := range results {
+		if result.JokePercentage == nil {
+			continue
+		}
+		if closest.JokePercentage == nil ||
+			math.Abs(float64(*result.JokePercentage)-value) < math.Abs(float64(*closest.JokePercentage)-value) {
+			closest = result
+		}
+	}
+
+	aggregated := *closest
+	aggregated.JokePercentage = &percentage
+	aggregated.Ensemble = &models.EnsembleSummary{Variance: variance}
+	return &aggregated
+}
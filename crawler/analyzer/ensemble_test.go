@@ -0,0 +1,178 @@
+package analyzer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestParseEnsembleMethod(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    EnsembleMethod
+		wantErr bool
+	}{
+		{"", EnsembleMedian, false},
+		{"median", EnsembleMedian, false},
+		{"MEAN", EnsembleMean, false},
+		{"mode", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseEnsembleMethod(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseEnsembleMethod(%q) = %q, %v; want %q, wantErr %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestAggregateJokeResults(t *testing.T) {
+	results := []*models.AnalysisResult{
+		{JokePercentage: intPtr(10), JokeReasoning: stringPtr("low")},
+		{JokePercentage: intPtr(80), JokeReasoning: stringPtr("high")},
+		{JokePercentage: intPtr(90), JokeReasoning: stringPtr("highest")},
+	}
+
+	tests := []struct {
+		method         EnsembleMethod
+		wantPercentage int
+		wantReasoning  string
+	}{
+		{EnsembleMedian, 80, "high"},
+		{EnsembleMean, 60, "high"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.method), func(t *testing.T) {
+			aggregated := AggregateJokeResults(results, tt.method)
+			if aggregated.JokePercentage == nil || *aggregated.JokePercentage != tt.wantPercentage {
+				t.Errorf("JokePercentage = %v, want %d", aggregated.JokePercentage, tt.wantPercentage)
+			}
+			if aggregated.JokeReasoning == nil || *aggregated.JokeReasoning != tt.wantReasoning {
+				t.Errorf("JokeReasoning = %v, want %q", aggregated.JokeReasoning, tt.wantReasoning)
+			}
+			// Population variance of 10, 80 and 90 around their mean of 60
+			if aggregated.Ensemble == nil || aggregated.Ensemble.Variance != 1266.6666666666667 {
+				t.Errorf("Ensemble = %+v, want Variance 1266.67", aggregated.Ensemble)
+			}
+		})
+	}
+
+	// Even number of runs: median is the mean of the middle two
+	even := AggregateJokeResults(results[:2], EnsembleMedian)
+	if *even.JokePercentage != 45 {
+		t.Errorf("median of 10 and 80 = %d, want 45", *even.JokePercentage)
+	}
+}
+
+func TestNewLlmClient_Ensemble(t *testing.T) {
+	single := NewLlmClient(LlmOptions{Model: "gpt-4o"})
+	if _, ok := single.(*GptLlmClient); !ok {
+		t.Errorf("NewLlmClient without ensemble = %T, want *GptLlmClient", single)
+	}
+
+	client := NewLlmClient(LlmOptions{
+		Model:    "gpt-4o",
+		BaseURL:  "http://localhost:8000/v1",
+		Ensemble: EnsembleOptions{Runs: 2, Models: []string{"llama-3-8b"}, Method: EnsembleMean},
+	})
+	ensemble, ok := client.(*EnsembleLlmClient)
+	if !ok {
+		t.Fatalf("NewLlmClient with ensemble = %T, want *EnsembleLlmClient", client)
+	}
+	if len(ensemble.Members) != 4 || ensemble.Method != EnsembleMean {
+		t.Errorf("got %d members with method %q, want 4 with mean", len(ensemble.Members), ensemble.Method)
+	}
+	if ensemble.Model() != "gpt-4o+llama-3-8b" || ensemble.Provider() != "localhost:8000" {
+		t.Errorf("Model()/Provider() = %q/%q, want gpt-4o+llama-3-8b/localhost:8000", ensemble.Model(), ensemble.Provider())
+	}
+}
+
+func TestNewLlmClient_EnsembleSeeds(t *testing.T) {
+	client := NewLlmClient(LlmOptions{
+		Model:      "gpt-4o",
+		Generation: GenerationParams{Seed: Int64Ptr(42)},
+		Ensemble:   EnsembleOptions{Runs: 2, Models: []string{"gpt-4o-mini"}, Method: EnsembleMean},
+	})
+	ensemble := client.(*EnsembleLlmClient)
+	for i, member := range ensemble.Members {
+		if seed := clientSeed(member); seed != 42+int64(i) {
+			t.Errorf("member %d seed = %d, want %d", i, seed, 42+i)
+		}
+	}
+	if seed := clientSeed(client); seed != 42 {
+		t.Errorf("ensemble seed = %d, want 42", seed)
+	}
+
+	if seed := clientSeed(NewLlmClient(LlmOptions{Model: "gpt-4o"})); seed != 0 {
+		t.Errorf("seed without generation seed = %d, want 0", seed)
+	}
+}
+
+func TestAnalyze_Ensemble(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	members := []*MockLlmClient{
+		{Response: `{"is_joke": true, "confidence": 90, "reasoning": "Absurd"}`, ModelName: "gpt-4o",
+			Usage: LlmUsage{PromptTokens: 1000, CompletionTokens: 100}},
+		{Response: `{"is_joke": true, "confidence": 70, "reasoning": "Odd"}`, ModelName: "gpt-4o",
+			Usage: LlmUsage{PromptTokens: 1000, CompletionTokens: 100}},
+		{Response: `{"is_joke": false, "confidence": 90, "reasoning": "Serious"}`, ModelName: "llama-3-8b",
+			Usage: LlmUsage{PromptTokens: 1000, CompletionTokens: 100}},
+	}
+	ensemble := &EnsembleLlmClient{Members: []LlmClient{members[0], members[1], members[2]}}
+
+	page := &models.CrawledPage{URL: "example.com/ensemble", Title: "Ensemble", Content: "Content"}
+	result, err := analyze(ctx, page, ensemble, AnalysisModeJoke, mockDS, false)
+	if err != nil {
+		t.Fatalf("analyze() error = %v, want nil", err)
+	}
+	for i, member := range members {
+		if member.Calls != 1 {
+			t.Errorf("member %d made %d calls, want 1", i, member.Calls)
+		}
+	}
+
+	// Joke percentages 90, 70 and 10; the median is 70
+	if result.JokePercentage == nil || *result.JokePercentage != 70 {
+		t.Errorf("JokePercentage = %v, want 70", result.JokePercentage)
+	}
+	if result.Model != "gpt-4o+llama-3-8b" {
+		t.Errorf("Model = %q, want %q", result.Model, "gpt-4o+llama-3-8b")
+	}
+	if result.PromptTokens != 3000 || result.CompletionTokens != 300 {
+		t.Errorf("tokens = %d/%d, want 3000/300", result.PromptTokens, result.CompletionTokens)
+	}
+	// Only the gpt-4o runs have a known price
+	if want := 2 * EstimateCost("gpt-4o", LlmUsage{PromptTokens: 1000, CompletionTokens: 100}); result.CostUSD != want {
+		t.Errorf("CostUSD = %v, want %v", result.CostUSD, want)
+	}
+	if result.Ensemble == nil || result.Ensemble.Method != string(EnsembleMedian) || len(result.Ensemble.Runs) != 3 {
+		t.Fatalf("Ensemble = %+v, want median over 3 runs", result.Ensemble)
+	}
+	if run := result.Ensemble.Runs[2]; run.Model != "llama-3-8b" || run.JokePercentage == nil || *run.JokePercentage != 10 {
+		t.Errorf("run 3 = %+v, want llama-3-8b with 10", run)
+	}
+}
+
+func TestAnalyze_EnsembleModeWithoutAggregation(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	first := &MockLlmClient{Response: `{"result": "ok"}`, ModelName: "gpt-4o-mini"}
+	second := &MockLlmClient{Response: `{"result": "ok"}`, ModelName: "llama-3-8b"}
+	ensemble := &EnsembleLlmClient{Members: []LlmClient{first, second}}
+
+	page := &models.CrawledPage{URL: "example.com/test-mode", Title: "Test", Content: "Content"}
+	result, err := analyze(ctx, page, ensemble, AnalysisModeTest, mockDS, false)
+	if err != nil {
+		t.Fatalf("analyze() error = %v, want nil", err)
+	}
+	if first.Calls != 1 || second.Calls != 0 {
+		t.Errorf("calls = %d/%d, want only the first member called", first.Calls, second.Calls)
+	}
+	if result.Model != "gpt-4o-mini" || result.Ensemble != nil {
+		t.Errorf("got Model %q and Ensemble %+v, want a single gpt-4o-mini analysis", result.Model, result.Ensemble)
+	}
+}
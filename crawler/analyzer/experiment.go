@@ -0,0 +1,258 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// ControlVariant is the name of the variant of an experiment that uses the mode's own template.
+const ControlVariant = "control"
+
+// PromptVariant is an experimental prompt template of a mode.
+type PromptVariant struct {
+	Name     string
+	Template string
+}
+
+// Experiment compares prompt variants of a mode on real articles. Articles analyzed while the
+// experiment is registered are assigned either a variant or the control, and their analysis
+// records the experiment ID and variant name (see CompareExperiment).
+type Experiment struct {
+	ID       string
+	Mode     AnalysisMode
+	Variants []PromptVariant
+}
+
+// Experiments holds the running experiment of each mode, registered with RegisterExperiment.
+var Experiments = map[AnalysisMode]Experiment{}
+
+// RegisterExperiment starts experiment, replacing any running experiment of its mode.
+// It must be called before any analysis starts, after LoadPromptTemplates.
+func RegisterExperiment(experiment Experiment) error {
+	if _, ok := lookupPromptConfig(experiment.Mode); !ok {
+		return fmt.Errorf("unknown mode '%s'", experiment.Mode)
+	}
+	if experiment.ID == "" {
+		return fmt.Errorf("experiment ID is required")
+	}
+	if len(experiment.Variants) == 0 {
+		return fmt.Errorf("experiment %s has no variants", experiment.ID)
+	}
+	names := map[string]bool{ControlVariant: true}
+	for _, variant := range experiment.Variants {
+		if variant.Name == "" || names[variant.Name] {
+			return fmt.Errorf("invalid or duplicate variant name %q (%q is reserved)", variant.Name, ControlVariant)
+		}
+		names[variant.Name] = true
+		if err := validatePromptTemplate(variant.Template); err != nil {
+			return fmt.Errorf("invalid template of variant %s: %w", variant.Name, err)
+		}
+	}
+	Experiments[experiment.Mode] = experiment
+	return nil
+}
+
+// LoadExperiment registers the experiment id of mode with the variants of spec, a
+// comma-separated list of <name>=<path> where path is a template file or a gs://bucket/object URL.
+func LoadExperiment(ctx context.Context, id string, mode AnalysisMode, spec string) error {
+	experiment := Experiment{ID: id, Mode: mode}
+	for _, entry := range strings.Split(spec, ",") {
+		name, path, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" || path == "" {
+			return fmt.Errorf("invalid variant %q (want <name>=<path>)", entry)
+		}
+		template, err := readTemplateFile(ctx, path)
+		if err != nil {
+			return fmt.Errorf("error reading variant %s: %w", name, err)
+		}
+		experiment.Variants = append(experiment.Variants, PromptVariant{Name: name, Template: template})
+	}
+	return RegisterExperiment(experiment)
+}
+
+// readTemplateFile reads the template at path, a local file or a gs://bucket/object URL.
+func readTemplateFile(ctx context.Context, path string) (string, error) {
+	if !strings.HasPrefix(path, "gs://") {
+		data, err := os.ReadFile(path)
+		return string(data), err
+	}
+	slash := strings.LastIndex(path, "/") + 1
+	bucket, prefix, err := lib.ParseGCSURL(path[:slash])
+	if err != nil {
+		return "", err
+	}
+	data, found, err := lib.ReadGCSObject(ctx, bucket, prefix+path[slash:])
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("%s not found", path)
+	}
+	return string(data), nil
+}
+
+// assignVariant returns the experiment running in mode and the variant assigned to url, or
+// false if there is no experiment. The control variant has the mode's template. Assignment is
+// random but stable: a URL keeps its variant when it is re-analyzed.
+func assignVariant(mode AnalysisMode, url string) (Experiment, PromptVariant, bool) {
+	experiment, ok := Experiments[mode]
+	if !ok {
+		return Experiment{}, PromptVariant{}, false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(experiment.ID))
+	h.Write([]byte{0})
+	h.Write([]byte(lib.NormalizeURL(url)))
+	i := h.Sum64() % uint64(len(experiment.Variants)+1)
+	if i == 0 {
+		config, _ := lookupPromptConfig(mode)
+		return experiment, PromptVariant{Name: ControlVariant, Template: config.Template}, true
+	}
+	return experiment, experiment.Variants[i-1], true
+}
+
+// variantFingerprint returns the prompt fingerprint of result's experiment variant, or false if
+// result was not made with a variant of the running experiment of its mode.
+func variantFingerprint(result *models.AnalysisResult) (int, bool) {
+	experiment, ok := Experiments[result.Mode]
+	if !ok || result.Experiment != experiment.ID {
+		return 0, false
+	}
+	for _, variant := range experiment.Variants {
+		if variant.Name == result.Variant {
+			return templateFingerprint(result.Mode, variant.Template), true
+		}
+	}
+	return 0, false
+}
+
+// VariantStats summarizes the joke percentages of the analyses made with one variant.
+type VariantStats struct {
+	Variant string `json:"variant"`
+	// Count is the number of analyses with a joke percentage made with the variant.
+	Count int `json:"count"`
+	// Mean, Median and StdDev describe the distribution of the joke percentages.
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	StdDev float64 `json:"stdDev"`
+	// JokeRate is the percentage of analyses scoring 50 or more.
+	JokeRate float64 `json:"jokeRate"`
+	// Histogram counts the joke percentages in ten buckets: 0-9, 10-19, ..., 90-100.
+	Histogram [10]int `json:"histogram"`
+	// Labeled is the number of analyses of articles with a human label, and BrierScore their
+	// Brier score (see CalibrationReport), 0 if none are labeled.
+	Labeled    int     `json:"labeled"`
+	BrierScore float64 `json:"brierScore"`
+}
+
+// ExperimentReport compares the score distributions of the variants of an experiment.
+type ExperimentReport struct {
+	ID   string       `json:"id"`
+	Mode AnalysisMode `json:"mode"`
+	// Variants holds the stats of each variant with analyses, control first, then by name.
+	Variants []VariantStats `json:"variants"`
+}
+
+// BuildVariantStats computes the stats of the joke percentages of a variant. labels maps the
+// normalized URLs of labeled articles to whether they are jokes.
+func BuildVariantStats(variant string, results []*models.AnalysisResult, labels map[string]bool) VariantStats {
+	stats := VariantStats{Variant: variant}
+	var scores []int
+	var points []CalibrationPoint
+	for _, result := range results {
+		if result.JokePercentage == nil {
+			continue
+		}
+		score := min(max(*result.JokePercentage, 0), 100)
+		scores = append(scores, score)
+		stats.Histogram[min(score/10, 9)]++
+		if isJoke, ok := labels[lib.NormalizeURL(result.URL)]; ok {
+			points = append(points, CalibrationPoint{JokePercentage: score, IsJoke: isJoke})
+		}
+	}
+	stats.Count = len(scores)
+	if stats.Count == 0 {
+		return stats
+	}
+
+	sort.Ints(scores)
+	var sum, jokes float64
+	for _, score := range scores {
+		sum += float64(score)
+		if score >= 50 {
+			jokes++
+		}
+	}
+	stats.Mean = sum / float64(stats.Count)
+	stats.Median = float64(scores[(stats.Count-1)/2]+scores[stats.Count/2]) / 2
+	stats.JokeRate = 100 * jokes / float64(stats.Count)
+	var variance float64
+	for _, score := range scores {
+		variance += math.Pow(float64(score)-stats.Mean, 2)
+	}
+	stats.StdDev = math.Sqrt(variance / float64(stats.Count))
+
+	stats.Labeled = len(points)
+	if len(points) > 0 {
+		stats.BrierScore = BuildCalibrationReport("", points, 0).BrierScore
+	}
+	return stats
+}
+
+// CompareExperiment builds the report of experiment id from the stored analyses in mode and the
+// human labels of the analyzed articles. The experiment doesn't need to be registered.
+func CompareExperiment(
+	ctx context.Context,
+	datastoreClient lib.DatastoreClient,
+	mode AnalysisMode,
+	id string,
+) (*ExperimentReport, error) {
+	if _, ok := lookupPromptConfig(mode); !ok {
+		return nil, fmt.Errorf("unknown mode '%s'", mode)
+	}
+
+	results, err := datastoreClient.ListAnalysisResults(ctx, mode)
+	if err != nil {
+		return nil, fmt.Errorf("error listing analysis results: %w", err)
+	}
+	byVariant := make(map[string][]*models.AnalysisResult)
+	for _, result := range results {
+		if result.Experiment == id {
+			byVariant[result.Variant] = append(byVariant[result.Variant], result)
+		}
+	}
+
+	labelList, err := datastoreClient.ListJokeLabels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing joke labels: %w", err)
+	}
+	labels := make(map[string]bool, len(labelList))
+	for _, label := range labelList {
+		labels[lib.NormalizeURL(label.URL)] = label.IsJoke
+	}
+
+	variants := make([]string, 0, len(byVariant))
+	for variant := range byVariant {
+		variants = append(variants, variant)
+	}
+	sort.Slice(variants, func(i, j int) bool {
+		if (variants[i] == ControlVariant) != (variants[j] == ControlVariant) {
+			return variants[i] == ControlVariant
+		}
+		return variants[i] < variants[j]
+	})
+
+	report := &ExperimentReport{ID: id, Mode: mode, Variants: make([]VariantStats, 0, len(variants))}
+	for _, variant := range variants {
+		report.Variants = append(report.Variants, BuildVariantStats(variant, byVariant[variant], labels))
+	}
+	return report, nil
+}
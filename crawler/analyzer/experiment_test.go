@@ -0,0 +1,208 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// registerTestExperiment registers experiment for the duration of the test.
+func registerTestExperiment(t *testing.T, experiment Experiment) {
+	t.Helper()
+	if err := RegisterExperiment(experiment); err != nil {
+		t.Fatalf("RegisterExperiment() error = %v", err)
+	}
+	t.Cleanup(func() { delete(Experiments, experiment.Mode) })
+}
+
+func TestRegisterExperiment_Invalid(t *testing.T) {
+	valid := PromptVariant{Name: "terse", Template: "Title: %s\nContent: %s"}
+	tests := []struct {
+		name       string
+		experiment Experiment
+	}{
+		{"unknown mode", Experiment{ID: "exp", Mode: "invalid", Variants: []PromptVariant{valid}}},
+		{"missing ID", Experiment{Mode: AnalysisModeTest, Variants: []PromptVariant{valid}}},
+		{"no variants", Experiment{ID: "exp", Mode: AnalysisModeTest}},
+		{"reserved name", Experiment{ID: "exp", Mode: AnalysisModeTest, Variants: []PromptVariant{{Name: ControlVariant, Template: valid.Template}}}},
+		{"duplicate name", Experiment{ID: "exp", Mode: AnalysisModeTest, Variants: []PromptVariant{valid, valid}}},
+		{"bad template", Experiment{ID: "exp", Mode: AnalysisModeTest, Variants: []PromptVariant{{Name: "terse", Template: "Title only"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := RegisterExperiment(tt.experiment); err == nil {
+				delete(Experiments, tt.experiment.Mode)
+				t.Error("expected an error")
+			}
+			if _, ok := Experiments[AnalysisModeTest]; ok {
+				t.Error("invalid experiment was registered")
+			}
+		})
+	}
+}
+
+func TestLoadExperiment(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "terse.prompt.md")
+	if err := os.WriteFile(path, []byte("Terse: %s\n%s"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { delete(Experiments, AnalysisModeTest) })
+
+	if err := LoadExperiment(context.Background(), "exp", AnalysisModeTest, "terse="+path); err != nil {
+		t.Fatalf("LoadExperiment() error = %v", err)
+	}
+	if variants := Experiments[AnalysisModeTest].Variants; len(variants) != 1 || variants[0].Template != "Terse: %s\n%s" {
+		t.Errorf("variants = %+v, want the terse template", variants)
+	}
+
+	for _, spec := range []string{"terse", "terse=" + filepath.Join(dir, "missing.md")} {
+		if err := LoadExperiment(context.Background(), "exp", AnalysisModeTest, spec); err == nil {
+			t.Errorf("LoadExperiment(%q) expected an error", spec)
+		}
+	}
+}
+
+func TestAssignVariant(t *testing.T) {
+	if _, _, ok := assignVariant(AnalysisModeTest, "example.com/a"); ok {
+		t.Fatal("expected no variant without an experiment")
+	}
+	registerTestExperiment(t, Experiment{ID: "exp", Mode: AnalysisModeTest, Variants: []PromptVariant{
+		{Name: "terse", Template: "Terse: %s\n%s"},
+	}})
+
+	counts := map[string]int{}
+	for i := 0; i < 200; i++ {
+		url := fmt.Sprintf("example.com/article-%d", i)
+		_, variant, ok := assignVariant(AnalysisModeTest, url)
+		if !ok {
+			t.Fatal("expected a variant")
+		}
+		counts[variant.Name]++
+		if _, again, _ := assignVariant(AnalysisModeTest, "https://"+url); again.Name != variant.Name {
+			t.Errorf("%s assigned %s then %s", url, variant.Name, again.Name)
+		}
+		if variant.Name == ControlVariant && variant.Template != TestPromptTemplate {
+			t.Errorf("control variant should use the mode's template")
+		}
+	}
+	if counts[ControlVariant] < 60 || counts["terse"] < 60 {
+		t.Errorf("unbalanced assignment: %v", counts)
+	}
+}
+
+func TestAnalyzePage_Experiment(t *testing.T) {
+	ctx := context.Background()
+	registerTestExperiment(t, Experiment{ID: "exp", Mode: AnalysisModeTest, Variants: []PromptVariant{
+		{Name: "terse", Template: "Terse variant: %s\n%s"},
+	}})
+
+	// Find an article of each variant
+	urls := map[string]string{}
+	for i := 0; len(urls) < 2; i++ {
+		url := fmt.Sprintf("example.com/article-%d", i)
+		_, variant, _ := assignVariant(AnalysisModeTest, url)
+		urls[variant.Name] = url
+	}
+
+	for name, url := range urls {
+		t.Run(name, func(t *testing.T) {
+			mockDS := lib.NewMockDatastoreClient()
+			llm := &MockLlmClient{Response: `{"result": "ok"}`}
+			page := &models.CrawledPage{URL: url, Title: "Title", Content: "Content"}
+
+			result, err := analyze(ctx, page, llm, AnalysisModeTest, mockDS, false)
+			if err != nil {
+				t.Fatalf("analyze() error = %v", err)
+			}
+			if result.Experiment != "exp" || result.Variant != name {
+				t.Errorf("experiment = %q, variant = %q, want exp and %s", result.Experiment, result.Variant, name)
+			}
+			if isTerse := strings.HasPrefix(llm.LastPrompt, "Terse variant"); isTerse != (name == "terse") {
+				t.Errorf("prompt = %q for variant %s", llm.LastPrompt, name)
+			}
+
+			// The variant's result is fresh while the experiment runs
+			cached, err := analyze(ctx, page, llm, AnalysisModeTest, mockDS, false)
+			if err != nil {
+				t.Fatalf("analyze() error = %v", err)
+			}
+			if !cached.Cached || llm.Calls != 1 {
+				t.Errorf("expected a cached result, got Cached=%v after %d calls", cached.Cached, llm.Calls)
+			}
+			if stale, _ := IsStale(cached); stale {
+				t.Error("IsStale() = true during the experiment")
+			}
+		})
+	}
+
+	// Once the experiment ends, the variant's results are stale
+	delete(Experiments, AnalysisModeTest)
+	fingerprint := templateFingerprint(AnalysisModeTest, "Terse variant: %s\n%s")
+	if stale, _ := IsStale(&models.AnalysisResult{Mode: AnalysisModeTest, PromptFingerprint: fingerprint, Experiment: "exp", Variant: "terse"}); !stale {
+		t.Error("IsStale() = false for a variant result after the experiment")
+	}
+}
+
+func TestBuildVariantStats(t *testing.T) {
+	results := []*models.AnalysisResult{
+		{URL: "example.com/a", JokePercentage: intPtr(10)},
+		{URL: "example.com/b", JokePercentage: intPtr(20)},
+		{URL: "example.com/c", JokePercentage: intPtr(60)},
+		{URL: "example.com/d", JokePercentage: intPtr(100)},
+		{URL: "example.com/e"},
+	}
+	labels := map[string]bool{"example.com/c": true, "example.com/a": false}
+
+	stats := BuildVariantStats("terse", results, labels)
+	if stats.Count != 4 || stats.Mean != 47.5 || stats.Median != 40 || stats.JokeRate != 50 {
+		t.Errorf("stats = %+v, want 4 analyses, mean 47.5, median 40, joke rate 50", stats)
+	}
+	if stats.Histogram != [10]int{0, 1, 1, 0, 0, 0, 1, 0, 0, 1} {
+		t.Errorf("Histogram = %v", stats.Histogram)
+	}
+	// (0.01 + 0.16) / 2
+	if stats.Labeled != 2 || stats.BrierScore < 0.0849 || stats.BrierScore > 0.0851 {
+		t.Errorf("Labeled = %d, BrierScore = %v, want 2 and 0.085", stats.Labeled, stats.BrierScore)
+	}
+	if stats.StdDev < 35.6 || stats.StdDev > 35.8 {
+		t.Errorf("StdDev = %v, want about 35.7", stats.StdDev)
+	}
+}
+
+func TestCompareExperiment(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	write := func(url, experiment, variant string, percentage int) {
+		mockDS.WriteAnalysisResult(ctx, url, &models.AnalysisResult{
+			Mode: AnalysisModeJoke, JokePercentage: intPtr(percentage), Experiment: experiment, Variant: variant,
+		})
+	}
+	write("example.com/a", "exp", "terse", 80)
+	write("example.com/b", "exp", ControlVariant, 20)
+	write("example.com/c", "exp", ControlVariant, 40)
+	write("example.com/d", "other", "terse", 90)
+	write("example.com/e", "", "", 50)
+
+	report, err := CompareExperiment(ctx, mockDS, AnalysisModeJoke, "exp")
+	if err != nil {
+		t.Fatalf("CompareExperiment() error = %v", err)
+	}
+	if len(report.Variants) != 2 || report.Variants[0].Variant != ControlVariant || report.Variants[1].Variant != "terse" {
+		t.Fatalf("Variants = %+v, want control then terse", report.Variants)
+	}
+	if report.Variants[0].Count != 2 || report.Variants[0].Mean != 30 || report.Variants[1].Count != 1 {
+		t.Errorf("Variants = %+v, want 2 control analyses averaging 30 and 1 terse analysis", report.Variants)
+	}
+
+	if _, err := CompareExperiment(ctx, mockDS, AnalysisMode("invalid"), "exp"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
@@ -0,0 +1,100 @@
+package analyzer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	openai "github.com/openai/openai-go/v3"
+)
+
+// GenerationOverrides are the generation parameters set on the command line, which take
+// precedence over those of every mode. Set them at startup, before any analysis. Except for
+// Seed, set overrides are part of every prompt fingerprint, so that analyses made with them
+// aren't taken for analyses made with the defaults of their mode, and the other way around.
+var GenerationOverrides GenerationParams
+
+// GenerationParams controls how the LLM generates its response.
+// Unset fields leave the API default in place.
+type GenerationParams struct {
+	// SystemPrompt, if set, is sent as a system message before the prompt.
+	SystemPrompt string
+	// Temperature is the sampling temperature. Use 0 for reproducible results.
+	Temperature *float64
+	// TopP is the nucleus sampling probability mass.
+	TopP *float64
+	// MaxCompletionTokens limits the length of the response. Zero means no limit.
+	MaxCompletionTokens int
+	// Seed asks the API to sample deterministically, so that a run at a temperature above 0 can be
+	// reproduced. OpenAI supports it on a best-effort basis; other servers may ignore it.
+	Seed *int64
+}
+
+// Merge returns p with every field that is set in overrides replaced by the override.
+func (p GenerationParams) Merge(overrides GenerationParams) GenerationParams {
+	if overrides.SystemPrompt != "" {
+		p.SystemPrompt = overrides.SystemPrompt
+	}
+	if overrides.Temperature != nil {
+		p.Temperature = overrides.Temperature
+	}
+	if overrides.TopP != nil {
+		p.TopP = overrides.TopP
+	}
+	if overrides.MaxCompletionTokens > 0 {
+		p.MaxCompletionTokens = overrides.MaxCompletionTokens
+	}
+	if overrides.Seed != nil {
+		p.Seed = overrides.Seed
+	}
+	return p
+}
+
+// fingerprint returns the fields of p that are set, other than Seed, as a string for prompt
+// fingerprints. It returns "" if none is set.
+func (p GenerationParams) fingerprint() string {
+	var fields []string
+	if p.SystemPrompt != "" {
+		fields = append(fields, "system="+p.SystemPrompt)
+	}
+	if p.Temperature != nil {
+		fields = append(fields, "temperature="+strconv.FormatFloat(*p.Temperature, 'g', -1, 64))
+	}
+	if p.TopP != nil {
+		fields = append(fields, "top_p="+strconv.FormatFloat(*p.TopP, 'g', -1, 64))
+	}
+	if p.MaxCompletionTokens > 0 {
+		fields = append(fields, fmt.Sprintf("max_tokens=%d", p.MaxCompletionTokens))
+	}
+	return strings.Join(fields, "\x00")
+}
+
+// apply sets the generation parameters on a chat completion request.
+// The system message is prepended to the existing messages.
+func (p GenerationParams) apply(params *openai.ChatCompletionNewParams) {
+	if p.SystemPrompt != "" {
+		params.Messages = append([]openai.ChatCompletionMessageParamUnion{openai.SystemMessage(p.SystemPrompt)}, params.Messages...)
+	}
+	if p.Temperature != nil {
+		params.Temperature = openai.Float(*p.Temperature)
+	}
+	if p.TopP != nil {
+		params.TopP = openai.Float(*p.TopP)
+	}
+	if p.MaxCompletionTokens > 0 {
+		params.MaxCompletionTokens = openai.Int(int64(p.MaxCompletionTokens))
+	}
+	if p.Seed != nil {
+		params.Seed = openai.Int(*p.Seed)
+	}
+}
+
+// Float64Ptr returns a pointer to v, for setting optional GenerationParams fields.
+func Float64Ptr(v float64) *float64 {
+	return &v
+}
+
+// Int64Ptr returns a pointer to v, for setting GenerationParams.Seed.
+func Int64Ptr(v int64) *int64 {
+	return &v
+}
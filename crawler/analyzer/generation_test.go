@@ -0,0 +1,141 @@
+package analyzer
+
+import (
+	"testing"
+
+	openai "github.com/openai/openai-go/v3"
+)
+
+func TestGenerationParams_Merge(t *testing.T) {
+	base := GenerationParams{
+		SystemPrompt:        "base",
+		Temperature:         Float64Ptr(0),
+		MaxCompletionTokens: 100,
+	}
+
+	tests := []struct {
+		name      string
+		overrides GenerationParams
+		want      GenerationParams
+	}{
+		{
+			name:      "no overrides",
+			overrides: GenerationParams{},
+			want:      base,
+		},
+		{
+			name:      "override temperature and top_p",
+			overrides: GenerationParams{Temperature: Float64Ptr(0.7), TopP: Float64Ptr(0.9)},
+			want: GenerationParams{
+				SystemPrompt:        "base",
+				Temperature:         Float64Ptr(0.7),
+				TopP:                Float64Ptr(0.9),
+				MaxCompletionTokens: 100,
+			},
+		},
+		{
+			name:      "override system prompt and max tokens",
+			overrides: GenerationParams{SystemPrompt: "other", MaxCompletionTokens: 50},
+			want: GenerationParams{
+				SystemPrompt:        "other",
+				Temperature:         Float64Ptr(0),
+				MaxCompletionTokens: 50,
+			},
+		},
+		{
+			name:      "override seed",
+			overrides: GenerationParams{Seed: Int64Ptr(42)},
+			want: GenerationParams{
+				SystemPrompt:        "base",
+				Temperature:         Float64Ptr(0),
+				MaxCompletionTokens: 100,
+				Seed:                Int64Ptr(42),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := base.Merge(tt.overrides)
+			if got.SystemPrompt != tt.want.SystemPrompt {
+				t.Errorf("SystemPrompt = %q, want %q", got.SystemPrompt, tt.want.SystemPrompt)
+			}
+			if !equalFloatPtr(got.Temperature, tt.want.Temperature) {
+				t.Errorf("Temperature = %v, want %v", got.Temperature, tt.want.Temperature)
+			}
+			if !equalFloatPtr(got.TopP, tt.want.TopP) {
+				t.Errorf("TopP = %v, want %v", got.TopP, tt.want.TopP)
+			}
+			if got.MaxCompletionTokens != tt.want.MaxCompletionTokens {
+				t.Errorf("MaxCompletionTokens = %d, want %d", got.MaxCompletionTokens, tt.want.MaxCompletionTokens)
+			}
+			if (got.Seed == nil) != (tt.want.Seed == nil) || (got.Seed != nil && *got.Seed != *tt.want.Seed) {
+				t.Errorf("Seed = %v, want %v", got.Seed, tt.want.Seed)
+			}
+		})
+	}
+}
+
+func TestGenerationParams_Apply(t *testing.T) {
+	request := openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("prompt")},
+	}
+	GenerationParams{
+		SystemPrompt:        "system",
+		Temperature:         Float64Ptr(0),
+		MaxCompletionTokens: 200,
+		Seed:                Int64Ptr(7),
+	}.apply(&request)
+
+	if len(request.Messages) != 2 || request.Messages[0].OfSystem == nil {
+		t.Fatalf("Expected system message followed by the prompt, got %d message(s)", len(request.Messages))
+	}
+	if !request.Temperature.Valid() || request.Temperature.Value != 0 {
+		t.Errorf("Temperature = %v, want 0", request.Temperature)
+	}
+	if request.TopP.Valid() {
+		t.Errorf("TopP = %v, want unset", request.TopP)
+	}
+	if !request.MaxCompletionTokens.Valid() || request.MaxCompletionTokens.Value != 200 {
+		t.Errorf("MaxCompletionTokens = %v, want 200", request.MaxCompletionTokens)
+	}
+	if !request.Seed.Valid() || request.Seed.Value != 7 {
+		t.Errorf("Seed = %v, want 7", request.Seed)
+	}
+}
+
+func equalFloatPtr(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func TestGeneratePromptFingerprint_GenerationOverrides(t *testing.T) {
+	original := GenerationOverrides
+	defer func() { GenerationOverrides = original }()
+
+	GenerationOverrides = GenerationParams{}
+	defaults, _ := GeneratePromptFingerprint(AnalysisModeJoke)
+
+	// The seed only makes sampling reproducible, so it doesn't change the fingerprint
+	GenerationOverrides = GenerationParams{Seed: Int64Ptr(7)}
+	if fp, _ := GeneratePromptFingerprint(AnalysisModeJoke); fp != defaults {
+		t.Errorf("fingerprint with a seed = %d, want %d", fp, defaults)
+	}
+
+	seen := map[int]string{defaults: "defaults"}
+	for name, overrides := range map[string]GenerationParams{
+		"system prompt": {SystemPrompt: "Answer in JSON."},
+		"temperature":   {Temperature: Float64Ptr(0.7)},
+		"top_p":         {TopP: Float64Ptr(0.9)},
+		"max tokens":    {MaxCompletionTokens: 500},
+	} {
+		GenerationOverrides = overrides
+		fp, _ := GeneratePromptFingerprint(AnalysisModeJoke)
+		if other, ok := seen[fp]; ok {
+			t.Errorf("fingerprint with %s overridden = fingerprint with %s", name, other)
+		}
+		seen[fp] = name
+	}
+}
@@ -0,0 +1,71 @@
+package analyzer
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+	"github.com/zeace/poisson/models"
+)
+
+// HeadlineScreening configures the two-stage pipeline of AnalyzeBatch: the headlines of pages
+// that need a joke analysis are first analyzed in headline mode, a cheap title-only prompt,
+// and pages whose headline scores below Threshold are not analyzed in joke mode. Since most
+// articles in a feed are plainly serious, this saves most full-article LLM calls.
+// The zero value disables screening.
+type HeadlineScreening struct {
+	// Threshold is the headline joke percentage below which the full joke analysis is skipped.
+	// Zero disables screening.
+	Threshold int
+	// Model is the model of the headline analyses. Empty means LlmOptions.Model if set, and
+	// otherwise the default model of headline mode.
+	Model string
+}
+
+// Enabled reports whether headlines are screened.
+func (s HeadlineScreening) Enabled() bool {
+	return s.Threshold > 0
+}
+
+// ProcessHeadlineResponse processes the JSON response from the LLM for headline mode. Headline
+// verdicts are scored like joke verdicts, with JokeScoring.
+func ProcessHeadlineResponse(jsonStr string, fingerprint int) (*models.AnalysisResult, error) {
+	result, err := ProcessJokeResponse(jsonStr, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	result.Mode = AnalysisModeHeadline
+	return result, nil
+}
+
+// screenHeadlines analyzes the headlines of pages in headline mode and returns the results by
+// page. Pages whose headline could not be analyzed are left out, so that they get a full analysis.
+func screenHeadlines(
+	ctx context.Context,
+	pages []*models.CrawledPage,
+	opts BatchOptions,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+	clientFor func(mode AnalysisMode) (LlmClient, error),
+) map[*models.CrawledPage]*models.AnalysisResult {
+	// Headlines are short, so they are analyzed as they are rather than translated, and a
+	// failed screening falls back to the full analysis rather than deferring
+	screeningOpts := BatchOptions{LlmOptions: opts.LlmOptions, Concurrency: opts.Concurrency, Timeout: opts.Timeout}
+	screeningOpts.LlmOptions.Language = LanguagePolicyAsIs
+
+	headlines := make(map[*models.CrawledPage]*models.AnalysisResult)
+	for _, result := range analyzeBatch(ctx, pages, []AnalysisMode{AnalysisModeHeadline}, screeningOpts, datastoreClient, verbose, clientFor) {
+		pageCtx := logging.WithAttrs(ctx, "url", result.Page.URL)
+		if result.Err != nil {
+			slog.WarnContext(pageCtx, "Error screening headline, analyzing the full article", "error", result.Err)
+			continue
+		}
+		headlines[result.Page] = result.Result
+		if verbose && result.Result.JokePercentage != nil {
+			slog.InfoContext(pageCtx, "Screened headline", "headline_percentage", *result.Result.JokePercentage,
+				"threshold", opts.Screening.Threshold)
+		}
+	}
+	return headlines
+}
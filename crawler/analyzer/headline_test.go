@@ -0,0 +1,125 @@
+package analyzer
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// headlineLlmClient is a concurrency-safe LlmClient whose verdict depends on the prompt: prompts
+// mentioning "Parliament" are serious, others are jokes.
+type headlineLlmClient struct {
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (c *headlineLlmClient) Analyze(
+	ctx context.Context,
+	prompt string,
+	schema *ResponseSchema,
+	params GenerationParams,
+) (LlmResponse, error) {
+	c.mu.Lock()
+	c.prompts = append(c.prompts, prompt)
+	c.mu.Unlock()
+	if strings.Contains(prompt, "Parliament") {
+		return LlmResponse{Content: `{"is_joke": false, "confidence": 95, "reasoning": "Routine politics"}`}, nil
+	}
+	return LlmResponse{Content: `{"is_joke": true, "confidence": 70, "reasoning": "Absurd"}`}, nil
+}
+
+func (c *headlineLlmClient) Model() string {
+	return "test-model"
+}
+
+func (c *headlineLlmClient) Provider() string {
+	return DefaultProvider
+}
+
+func TestProcessHeadlineResponse(t *testing.T) {
+	result, err := ProcessHeadlineResponse(`{"is_joke": false, "confidence": 90, "reasoning": "Serious"}`, 42)
+	if err != nil {
+		t.Fatalf("ProcessHeadlineResponse() error = %v", err)
+	}
+	if result.Mode != AnalysisModeHeadline || *result.JokePercentage != 10 || result.PromptFingerprint != 42 {
+		t.Errorf("ProcessHeadlineResponse() = %+v, want headline mode scoring 10", result)
+	}
+}
+
+func TestHeadlinePromptTemplate(t *testing.T) {
+	if err := validatePromptTemplate(HeadlinePromptTemplate); err != nil {
+		t.Fatalf("validatePromptTemplate() error = %v", err)
+	}
+	prompt, err := GeneratePrompt(AnalysisModeHeadline, "Cats Elected", "Long article body")
+	if err != nil {
+		t.Fatalf("GeneratePrompt() error = %v", err)
+	}
+	if !strings.Contains(prompt, "Headline: Cats Elected") || strings.Contains(prompt, "Long article body") {
+		t.Errorf("expected a title-only prompt, got:\n%s", prompt)
+	}
+}
+
+func TestAnalyzeBatch_HeadlineScreening(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	pages := []*models.CrawledPage{
+		{URL: "example.com/budget", Title: "Parliament Passes Budget", Content: "The budget passed."},
+		{URL: "example.com/cats", Title: "Cats Elected Mayor", Content: "Cats took every seat."},
+	}
+	headlineClient := &headlineLlmClient{}
+	jokeClient := &countingLlmClient{}
+	clientFor := func(mode AnalysisMode) (LlmClient, error) {
+		if mode == AnalysisModeHeadline {
+			return headlineClient, nil
+		}
+		return jokeClient, nil
+	}
+	opts := BatchOptions{Screening: HeadlineScreening{Threshold: 20}}
+
+	results := analyzeBatch(ctx, pages, []AnalysisMode{AnalysisModeJoke}, opts, mockDS, false, clientFor)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+
+	serious, joke := results[0], results[1]
+	if !serious.Screened || serious.Err != nil || serious.Result != serious.Headline ||
+		serious.Result.Mode != AnalysisModeHeadline || *serious.Result.JokePercentage != 5 {
+		t.Errorf("serious headline: got %+v, want a screened result scoring 5", serious)
+	}
+	if joke.Screened || joke.Err != nil || joke.Headline == nil || *joke.Headline.JokePercentage != 70 ||
+		joke.Result.Mode != AnalysisModeJoke || *joke.Result.JokePercentage != 90 {
+		t.Errorf("joke headline: got %+v, want a full joke analysis after screening", joke)
+	}
+	if len(headlineClient.prompts) != 2 || jokeClient.calls != 1 {
+		t.Errorf("expected 2 headline calls and 1 joke call, got %d and %d", len(headlineClient.prompts), jokeClient.calls)
+	}
+
+	// Headline analyses are cached like any other, and so are full analyses
+	analyzeBatch(ctx, pages, []AnalysisMode{AnalysisModeJoke}, opts, mockDS, false, clientFor)
+	if len(headlineClient.prompts) != 2 || jokeClient.calls != 1 {
+		t.Errorf("expected no new calls, got %d headline and %d joke calls", len(headlineClient.prompts), jokeClient.calls)
+	}
+}
+
+func TestAnalyzeBatch_HeadlineScreeningOnlyJokeMode(t *testing.T) {
+	pages := []*models.CrawledPage{{URL: "example.com/budget", Title: "Parliament Passes Budget", Content: "The budget passed."}}
+	headlineClient := &headlineLlmClient{}
+	testClient := &MockLlmClient{Response: `{"result": "ok"}`}
+	clientFor := func(mode AnalysisMode) (LlmClient, error) {
+		if mode == AnalysisModeHeadline {
+			return headlineClient, nil
+		}
+		return testClient, nil
+	}
+	opts := BatchOptions{Screening: HeadlineScreening{Threshold: 20}}
+
+	results := analyzeBatch(context.Background(), pages, []AnalysisMode{AnalysisModeTest}, opts,
+		lib.NewMockDatastoreClient(), false, clientFor)
+	if results[0].Screened || results[0].Err != nil || testClient.Calls != 1 || len(headlineClient.prompts) != 0 {
+		t.Errorf("expected test mode to be analyzed without screening, got %+v", results[0])
+	}
+}
@@ -3,6 +3,10 @@ package analyzer
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
 
 	"github.com/zeace/poisson/models"
 )
@@ -14,25 +18,168 @@ type jokeIntermediateResult struct {
 	Reasoning  string `json:"reasoning"`
 }
 
-// ProcessJokeResponse processes the JSON response from the LLM for joke mode and converts it to AnalysisResult.
+// JokeResponseSchema is the structured output schema for joke mode.
+var JokeResponseSchema = ResponseSchema{
+	Name: "joke_analysis",
+	Schema: objectSchema(map[string]string{
+		"is_joke":    "boolean",
+		"confidence": "integer",
+		"reasoning":  "string",
+	}),
+}
+
+// EnglishJokeKeywords are English words whose presence in the reasoning of a "not a joke"
+// verdict suggests the LLM hedged (see JokeScoringPolicy.Keywords).
+var EnglishJokeKeywords = []string{"joke", "prank", "satire", "satirical", "humor", "humorous"}
+
+// DefaultJokeNegations are the words that, shortly before a keyword, say the article is not
+// what the keyword names ("no sign of satire", "not a prank"), in English, French, German and
+// Spanish. Words ending in "n't" are negations too.
+var DefaultJokeNegations = []string{
+	"no", "not", "never", "without", "nor", "neither", "none", "lacks", "lacking",
+	"pas", "aucun", "aucune", "sans", "jamais",
+	"kein", "keine", "keinen", "nicht", "ohne", "nie",
+	"ningún", "ninguna", "sin", "nunca",
+}
+
+// negationWindow is how many words before a keyword a negation applies to.
+const negationWindow = 3
+
+// JokeScoringPolicy turns the verdict of the LLM (is_joke, confidence and reasoning) into the
+// joke percentage of an analysis, the confidence that the article is a joke:
+//
+//   - A "joke" verdict keeps its confidence.
+//   - A "not a joke" verdict is inverted (100 - confidence), so that a confident "not a joke"
+//     scores close to 0, unless its reasoning mentions one of Keywords: the LLM then hedged, and
+//     its confidence is kept as the confidence that the article is a joke. Negated mentions
+//     ("no sign of satire") don't count.
+//   - The result is clamped to 0-100, since LLMs occasionally answer out of range.
+type JokeScoringPolicy struct {
+	// Keywords are the hedging keywords by ISO 639-1 language code, matched case-insensitively
+	// as whole words of the reasoning, so that "humor" doesn't match "humorless". Keywords of
+	// every language are matched, since the reasoning may be in English or in the article's
+	// language. Empty disables the heuristic.
+	Keywords map[string][]string
+	// Negations are the words that negate a keyword mention when they are one of the
+	// negationWindow words before it. Nil means DefaultJokeNegations.
+	Negations []string
+}
+
+// JokeScoring is the policy used by ProcessJokeResponse. Set its Keywords at startup, before any
+// analysis, e.g. with ParseJokeKeywords. Non-empty keywords are part of the joke prompt
+// fingerprint, so changing them invalidates cached joke analyses.
+var JokeScoring JokeScoringPolicy
+
+// Score returns the joke percentage for a verdict.
+func (p JokeScoringPolicy) Score(isJoke bool, confidence int, reasoning string) int {
+	if !isJoke && !p.Mentions(reasoning) {
+		confidence = 100 - confidence
+	}
+	return min(max(confidence, 0), 100)
+}
+
+// Mentions reports whether reasoning mentions one of the policy's keywords without negating it.
+func (p JokeScoringPolicy) Mentions(reasoning string) bool {
+	words := splitWords(reasoning)
+	for _, keywords := range p.Keywords {
+		for _, keyword := range keywords {
+			keywordWords := splitWords(keyword)
+			if len(keywordWords) == 0 {
+				continue
+			}
+			for i := 0; i+len(keywordWords) <= len(words); i++ {
+				if slices.Equal(words[i:i+len(keywordWords)], keywordWords) && !p.negated(words[max(i-negationWindow, 0):i]) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// negated reports whether one of the words preceding a keyword negates it.
+func (p JokeScoringPolicy) negated(preceding []string) bool {
+	negations := p.Negations
+	if negations == nil {
+		negations = DefaultJokeNegations
+	}
+	for _, word := range preceding {
+		if strings.HasSuffix(word, "n't") || slices.Contains(negations, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitWords returns the lowercase words of s, keeping apostrophes within words ("isn't") but
+// not possessive endings ("joke's" is "joke").
+func splitWords(s string) []string {
+	s = strings.ReplaceAll(strings.ToLower(s), "’", "'")
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	for i, word := range words {
+		words[i] = strings.TrimSuffix(strings.Trim(word, "'"), "'s")
+	}
+	return words
+}
+
+// fingerprint returns a stable description of the keywords for the prompt fingerprint,
+// or "" if there are none.
+func (p JokeScoringPolicy) fingerprint() string {
+	languages := make([]string, 0, len(p.Keywords))
+	for language, keywords := range p.Keywords {
+		if len(keywords) > 0 {
+			languages = append(languages, language)
+		}
+	}
+	sort.Strings(languages)
+	if len(languages) == 0 {
+		return ""
+	}
+	parts := make([]string, len(languages))
+	for i, language := range languages {
+		parts[i] = language + ":" + strings.Join(p.Keywords[language], ",")
+	}
+	negations := p.Negations
+	if negations == nil {
+		negations = DefaultJokeNegations
+	}
+	// The negations change the scores as much as the keywords
+	return strings.Join(parts, ";") + "|not:" + strings.Join(negations, ",")
+}
+
+// ParseJokeKeywords parses hedging keywords given as "<language>:<keyword>,<keyword>;..."
+// (e.g. "en:joke,prank;fr:blague,canular"). The empty string means no keywords.
+func ParseJokeKeywords(spec string) (map[string][]string, error) {
+	keywords := make(map[string][]string)
+	for _, group := range strings.Split(spec, ";") {
+		if strings.TrimSpace(group) == "" {
+			continue
+		}
+		language, list, ok := strings.Cut(group, ":")
+		language = strings.ToLower(strings.TrimSpace(language))
+		if !ok || language == "" {
+			return nil, fmt.Errorf("invalid joke keywords %q (want e.g. en:joke,prank;fr:blague)", group)
+		}
+		for _, keyword := range strings.Split(list, ",") {
+			if keyword = strings.TrimSpace(keyword); keyword != "" {
+				keywords[language] = append(keywords[language], keyword)
+			}
+		}
+	}
+	return keywords, nil
+}
+
+// ProcessJokeResponse processes the JSON response from the LLM for joke mode and converts it to
+// AnalysisResult, scoring the verdict with JokeScoring.
 func ProcessJokeResponse(jsonStr string, fingerprint int) (*models.AnalysisResult, error) {
 	var intermediate jokeIntermediateResult
 	if err := json.Unmarshal([]byte(jsonStr), &intermediate); err != nil {
 		return nil, fmt.Errorf("error parsing JSON: %w", err)
 	}
 
-	// Ensure confidence is between 0 and 100
-	confidence := intermediate.Confidence
-	// If it's not a joke, invert the confidence
-	if !intermediate.IsJoke {
-		confidence = 100 - intermediate.Confidence
-	}
-
-	if confidence < 0 {
-		confidence = 0
-	} else if confidence > 100 {
-		confidence = 100
-	}
+	confidence := JokeScoring.Score(intermediate.IsJoke, intermediate.Confidence, intermediate.Reasoning)
 
 	// Convert to AnalysisResult
 	result := &models.AnalysisResult{
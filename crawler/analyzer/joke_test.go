@@ -0,0 +1,109 @@
+package analyzer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJokeScoringPolicy_NoKeywords(t *testing.T) {
+	var policy JokeScoringPolicy
+	tests := []struct {
+		name       string
+		isJoke     bool
+		confidence int
+		reasoning  string
+		expected   int
+	}{
+		{"joke keeps confidence", true, 85, "Clearly a joke", 85},
+		{"not a joke is inverted", false, 90, "Serious reporting", 10},
+		{"keywords are ignored", false, 75, "Could be a prank", 25},
+		{"clamped above", true, 150, "", 100},
+		{"clamped below", false, 120, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Score(tt.isJoke, tt.confidence, tt.reasoning); got != tt.expected {
+				t.Errorf("Score() = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestJokeScoringPolicy_Mentions(t *testing.T) {
+	policy := JokeScoringPolicy{Keywords: map[string][]string{
+		"en": EnglishJokeKeywords,
+		"fr": {"Canular"},
+	}}
+	tests := []struct {
+		reasoning string
+		expected  bool
+	}{
+		{"This appears to be a PRANK", true},
+		{"Probablement un canular", true},
+		{"Serious reporting", false},
+		{"A humorless policy report", false},
+		{"There is no sign of satire here", false},
+		{"This isn't a joke, but the quotes read like satire", true},
+		{"Ce n'est pas un canular", false},
+		{"The joke's on the readers", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reasoning, func(t *testing.T) {
+			if got := policy.Mentions(tt.reasoning); got != tt.expected {
+				t.Errorf("Mentions(%q) = %v, want %v", tt.reasoning, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseJokeKeywords(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        string
+		expected    map[string][]string
+		expectError bool
+	}{
+		{"empty", "", map[string][]string{}, false},
+		{"one language", "en:joke, prank", map[string][]string{"en": {"joke", "prank"}}, false},
+		{"several languages", "EN:joke;fr:blague,canular;", map[string][]string{
+			"en": {"joke"},
+			"fr": {"blague", "canular"},
+		}, false},
+		{"missing language", "joke,prank", nil, true},
+		{"empty language", ":joke", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseJokeKeywords(tt.spec)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ParseJokeKeywords(%q) error = %v, expectError %v", tt.spec, err, tt.expectError)
+			}
+			if !tt.expectError && !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ParseJokeKeywords(%q) = %v, want %v", tt.spec, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGeneratePromptFingerprint_JokeKeywords(t *testing.T) {
+	original := JokeScoring
+	defer func() { JokeScoring = original }()
+
+	JokeScoring = JokeScoringPolicy{}
+	plain, _ := GeneratePromptFingerprint(AnalysisModeJoke)
+	testPlain, _ := GeneratePromptFingerprint(AnalysisModeTest)
+
+	JokeScoring = JokeScoringPolicy{Keywords: map[string][]string{"en": EnglishJokeKeywords}}
+	withKeywords, _ := GeneratePromptFingerprint(AnalysisModeJoke)
+	testWithKeywords, _ := GeneratePromptFingerprint(AnalysisModeTest)
+
+	if plain == withKeywords {
+		t.Error("expected joke keywords to change the joke prompt fingerprint")
+	}
+	if testPlain != testWithKeywords {
+		t.Error("expected joke keywords not to change the test prompt fingerprint")
+	}
+}
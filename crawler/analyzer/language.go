@@ -0,0 +1,137 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/zeace/poisson/crawler/language"
+	"github.com/zeace/poisson/models"
+)
+
+// LanguagePolicy controls how pages that are not in English are analyzed.
+type LanguagePolicy string
+
+const (
+	// LanguagePolicyAsIs analyzes pages in their original language with the unchanged prompt.
+	LanguagePolicyAsIs LanguagePolicy = "as-is"
+	// LanguagePolicyInstruct analyzes pages in their original language and tells the LLM which
+	// language the article is in.
+	LanguagePolicyInstruct LanguagePolicy = "instruct"
+	// LanguagePolicyTranslate asks the LLM to translate pages into English before analyzing them.
+	// This costs an extra LLM call per page.
+	LanguagePolicyTranslate LanguagePolicy = "translate"
+)
+
+// ParseLanguagePolicy converts a string to a LanguagePolicy.
+// An empty string returns LanguagePolicyAsIs.
+func ParseLanguagePolicy(policy string) (LanguagePolicy, error) {
+	switch LanguagePolicy(strings.ToLower(policy)) {
+	case "", LanguagePolicyAsIs:
+		return LanguagePolicyAsIs, nil
+	case LanguagePolicyInstruct:
+		return LanguagePolicyInstruct, nil
+	case LanguagePolicyTranslate:
+		return LanguagePolicyTranslate, nil
+	default:
+		return "", fmt.Errorf("unknown language policy '%s' (valid: as-is, instruct, translate)", policy)
+	}
+}
+
+// languageInstruction is appended to the prompt of non-English pages with LanguagePolicyInstruct.
+// It takes the name of the article language.
+const languageInstruction = `
+
+The article above is written in %s. Judge it in its original language and cultural context, and write your reasoning in English.`
+
+// translationPrompt asks the LLM to translate a page into English.
+// It takes the name of the article language, the title and the content.
+const translationPrompt = `Translate the following %s article into English. Keep its meaning and tone, including any jokes, irony or wordplay, as close to the original as possible.
+
+Title: %s
+
+Content:
+%s`
+
+// TranslationSchema is the schema of translation responses.
+var TranslationSchema = ResponseSchema{
+	Name: "translation",
+	Schema: objectSchema(map[string]string{
+		"title":   "string",
+		"content": "string",
+	}),
+}
+
+// localizedPage is the title and content of a page as sent to the LLM for analysis.
+type localizedPage struct {
+	Title   string
+	Content string
+	// Language is the language the page is analyzed in, empty if unknown.
+	Language string
+	// Instruction is appended to the analysis prompt.
+	Instruction string
+}
+
+// pageLanguage returns the language of page, detected from its content for pages stored before
+// languages were detected. It returns "" if the language is unknown.
+func pageLanguage(page *models.CrawledPage) string {
+	if page.Language != "" {
+		return page.Language
+	}
+	return language.Detect(page.Title + " " + page.Content)
+}
+
+// localizePage prepares page for analysis according to policy. Pages in English or in an
+// unknown language are analyzed as they are.
+// Translations are limited to the first maxLength characters of content.
+// It returns the usage of the translation call, if one was made.
+func localizePage(
+	ctx context.Context,
+	page *models.CrawledPage,
+	llmClient LlmClient,
+	policy LanguagePolicy,
+	maxLength int,
+	verbose bool,
+) (localizedPage, LlmUsage, error) {
+	lang := pageLanguage(page)
+	localized := localizedPage{Title: page.Title, Content: page.Content, Language: lang}
+	if lang == "" || lang == language.English {
+		return localized, LlmUsage{}, nil
+	}
+
+	switch policy {
+	case LanguagePolicyInstruct:
+		localized.Instruction = fmt.Sprintf(languageInstruction, language.Name(lang))
+	case LanguagePolicyTranslate:
+		if verbose {
+			slog.InfoContext(ctx, "Translating content into English", "language", lang)
+		}
+		content := page.Content
+		if len(content) > maxLength {
+			content = content[:maxLength]
+		}
+		prompt := fmt.Sprintf(translationPrompt, language.Name(lang), page.Title, content)
+		response, err := llmClient.Analyze(ctx, prompt, &TranslationSchema, GenerationParams{Temperature: Float64Ptr(0)})
+		if err != nil {
+			return localized, LlmUsage{}, wrapLlmError("error translating content", err)
+		}
+		jsonStr, err := validateResponse(response.Content, TranslationSchema)
+		if err != nil {
+			return localized, response.Usage, fmt.Errorf("error translating content: %w", err)
+		}
+		var translation struct {
+			Title   string `json:"title"`
+			Content string `json:"content"`
+		}
+		if err := json.Unmarshal([]byte(jsonStr), &translation); err != nil {
+			return localized, response.Usage, fmt.Errorf("error parsing translation: %w", err)
+		}
+		localized.Title = translation.Title
+		localized.Content = translation.Content
+		localized.Language = language.English
+		return localized, response.Usage, nil
+	}
+	return localized, LlmUsage{}, nil
+}
@@ -0,0 +1,184 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+const jokeResponse = `{"is_joke": true, "confidence": 80, "reasoning": "Absurd"}`
+
+func TestAnalyzeWithLLM_LanguagePolicies(t *testing.T) {
+	germanPage := &models.CrawledPage{
+		URL:      "example.de/artikel",
+		Title:    "Bürgermeister verkauft Rathaus",
+		Content:  "Der Bürgermeister hat das Rathaus auf eBay verkauft.",
+		Language: "de",
+	}
+
+	tests := []struct {
+		name         string
+		page         *models.CrawledPage
+		policy       LanguagePolicy
+		responses    []string
+		wantCalls    int
+		wantLanguage string
+		wantPrompt   string
+	}{
+		{
+			name:         "as is",
+			page:         germanPage,
+			policy:       LanguagePolicyAsIs,
+			wantCalls:    1,
+			wantLanguage: "de",
+			wantPrompt:   "Der Bürgermeister hat das Rathaus",
+		},
+		{
+			name:         "instruct",
+			page:         germanPage,
+			policy:       LanguagePolicyInstruct,
+			wantCalls:    1,
+			wantLanguage: "de",
+			wantPrompt:   "The article above is written in German.",
+		},
+		{
+			name:   "translate",
+			page:   germanPage,
+			policy: LanguagePolicyTranslate,
+			responses: []string{
+				`{"title": "Mayor sells town hall", "content": "The mayor sold the town hall on eBay."}`,
+				jokeResponse,
+			},
+			wantCalls:    2,
+			wantLanguage: "en",
+			wantPrompt:   "The mayor sold the town hall on eBay.",
+		},
+		{
+			name: "english page is not translated",
+			page: &models.CrawledPage{
+				URL:     "example.com/article",
+				Title:   "Mayor sells town hall",
+				Content: "The mayor said that the town hall was sold on eBay and that it is not for the people.",
+			},
+			policy:       LanguagePolicyTranslate,
+			wantCalls:    1,
+			wantLanguage: "en",
+			wantPrompt:   "The mayor said",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mockDS := lib.NewMockDatastoreClient()
+			mockLLM := &MockLlmClient{
+				Response:  jokeResponse,
+				Responses: tt.responses,
+				Usage:     LlmUsage{PromptTokens: 100, CompletionTokens: 10},
+				ModelName: "gpt-4o",
+			}
+
+			result, err := analyzeWithLLM(ctx, tt.page, mockLLM, AnalysisModeJoke, tt.policy, mockDS, false, nil)
+			if err != nil {
+				t.Fatalf("analyzeWithLLM() error = %v", err)
+			}
+			if mockLLM.Calls != tt.wantCalls {
+				t.Errorf("Expected %d LLM calls, got %d", tt.wantCalls, mockLLM.Calls)
+			}
+			if result.Language != tt.wantLanguage {
+				t.Errorf("Language = %q, want %q", result.Language, tt.wantLanguage)
+			}
+			if !strings.Contains(mockLLM.LastPrompt, tt.wantPrompt) {
+				t.Errorf("Expected prompt to contain %q, got %q", tt.wantPrompt, mockLLM.LastPrompt)
+			}
+			if result.PromptTokens != 100*tt.wantCalls {
+				t.Errorf("Expected usage of all %d calls, got %d prompt tokens", tt.wantCalls, result.PromptTokens)
+			}
+		})
+	}
+}
+
+func TestAnalyzeWithLLM_LocalizedTemplate(t *testing.T) {
+	restorePromptTemplates(t)
+	files := map[string]string{"joke.de.prompt.md": "Ist das ein Scherz? Titel: %s\nInhalt: %s"}
+	if _, err := loadPromptTemplates(func(name string) ([]byte, bool, error) {
+		template, ok := files[name]
+		return []byte(template), ok, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		page       *models.CrawledPage
+		policy     LanguagePolicy
+		wantPrompt string
+	}{
+		{
+			// The localized template replaces the translation
+			name:       "page in the language",
+			page:       &models.CrawledPage{URL: "example.de/artikel", Title: "Rathaus", Content: "Verkauft.", Language: "de"},
+			policy:     LanguagePolicyTranslate,
+			wantPrompt: "Ist das ein Scherz? Titel: Rathaus",
+		},
+		{
+			name:       "page in another language",
+			page:       &models.CrawledPage{URL: "example.fr/article", Title: "Mairie", Content: "Vendue.", Language: "fr"},
+			policy:     LanguagePolicyInstruct,
+			wantPrompt: "written in French",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockLLM := &MockLlmClient{Response: jokeResponse, ModelName: "gpt-4o"}
+			result, err := analyzeWithLLM(context.Background(), tt.page, mockLLM, AnalysisModeJoke,
+				tt.policy, lib.NewMockDatastoreClient(), false, nil)
+			if err != nil {
+				t.Fatalf("analyzeWithLLM() error = %v", err)
+			}
+			if !strings.Contains(mockLLM.LastPrompt, tt.wantPrompt) {
+				t.Errorf("Expected prompt to contain %q, got %q", tt.wantPrompt, mockLLM.LastPrompt)
+			}
+			if stale, err := IsStale(result); err != nil || stale {
+				t.Errorf("IsStale() = %v, %v, want a fresh result", stale, err)
+			}
+		})
+	}
+}
+
+func TestAnalyzeWithLLM_TranslationUnavailable(t *testing.T) {
+	ctx := context.Background()
+	page := &models.CrawledPage{URL: "example.de/artikel", Title: "Titel", Content: "Inhalt", Language: "de"}
+	mockLLM := &MockLlmClient{Error: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+
+	_, err := analyzeWithLLM(ctx, page, mockLLM, AnalysisModeJoke, LanguagePolicyTranslate, lib.NewMockDatastoreClient(), false, nil)
+	if !errors.Is(err, ErrLlmUnavailable) {
+		t.Errorf("Expected ErrLlmUnavailable, got %v", err)
+	}
+}
+
+func TestParseLanguagePolicy(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    LanguagePolicy
+		wantErr bool
+	}{
+		{"", LanguagePolicyAsIs, false},
+		{"as-is", LanguagePolicyAsIs, false},
+		{"Instruct", LanguagePolicyInstruct, false},
+		{"translate", LanguagePolicyTranslate, false},
+		{"auto", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLanguagePolicy(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLanguagePolicy(%q) = %q, %v; want %q, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,538 @@
+package analyzer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	openai "github.com/openai/openai-go/v3"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+	"github.com/zeace/poisson/models"
+)
+
+// ErrQueuedForBatch is the error of analyses queued for the OpenAI Batch API
+// (see BatchOptions.QueueForBatch).
+var ErrQueuedForBatch = errors.New("analysis queued for the OpenAI Batch API")
+
+// MaxBatchRequests is the largest number of requests the Batch API accepts in one batch.
+const MaxBatchRequests = 50000
+
+// batchPriceFactor is the share of the regular price of a model the Batch API bills.
+const batchPriceFactor = 0.5
+
+// errRequestRecorded is returned by batchRecorder once it has recorded a request.
+var errRequestRecorded = errors.New("request recorded for the Batch API")
+
+// batchRecorder is an LlmClient that records the first request of an analysis instead of sending it.
+type batchRecorder struct {
+	client  *GptLlmClient
+	prompt  string
+	request *openai.ChatCompletionNewParams
+}
+
+func (r *batchRecorder) Analyze(
+	ctx context.Context,
+	prompt string,
+	schema *ResponseSchema,
+	params GenerationParams,
+) (LlmResponse, error) {
+	request := r.client.newRequest(openai.UserMessage(prompt), schema, params)
+	r.prompt, r.request = prompt, &request
+	return LlmResponse{}, errRequestRecorded
+}
+
+func (r *batchRecorder) Model() string {
+	return r.client.Model()
+}
+
+func (r *batchRecorder) Provider() string {
+	return r.client.Provider()
+}
+
+// batchReplayClient answers the request submitted in a batch with the batch's response, and
+// sends any other request (a repair, the other chunks of a long article) to the embedded client.
+type batchReplayClient struct {
+	LlmClient
+	promptHash string
+	response   LlmResponse
+	replayed   bool
+}
+
+func (c *batchReplayClient) Analyze(
+	ctx context.Context,
+	prompt string,
+	schema *ResponseSchema,
+	params GenerationParams,
+) (LlmResponse, error) {
+	if !c.replayed && lib.ContentHash(prompt) == c.promptHash {
+		c.replayed = true
+		return c.response, nil
+	}
+	return c.LlmClient.Analyze(ctx, prompt, schema, params)
+}
+
+// batchDiscount returns the part of the regular price of the batch's response that the Batch API
+// doesn't bill, or 0 if the response wasn't replayed.
+func (c *batchReplayClient) batchDiscount() float64 {
+	if !c.replayed {
+		return 0
+	}
+	return EstimateCost(c.Model(), c.response.Usage) * (1 - batchPriceFactor)
+}
+
+// batchAPI is the part of the OpenAI API that runs batches.
+type batchAPI interface {
+	// Submit uploads input, the JSONL requests of a batch, and creates the batch.
+	Submit(ctx context.Context, input []byte) (*openai.Batch, error)
+	Get(ctx context.Context, id string) (*openai.Batch, error)
+	// Download returns the content of a file, e.g. the output of a batch.
+	Download(ctx context.Context, fileID string) ([]byte, error)
+}
+
+// openaiBatchAPI implements batchAPI with the OpenAI API.
+type openaiBatchAPI struct {
+	client openai.Client
+}
+
+func (a *openaiBatchAPI) Submit(ctx context.Context, input []byte) (*openai.Batch, error) {
+	file, err := a.client.Files.New(ctx, openai.FileNewParams{
+		File:    openai.File(bytes.NewReader(input), "batch.jsonl", "application/jsonl"),
+		Purpose: openai.FilePurposeBatch,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error uploading batch input: %w", err)
+	}
+	return a.client.Batches.New(ctx, openai.BatchNewParams{
+		CompletionWindow: openai.BatchNewParamsCompletionWindow24h,
+		Endpoint:         openai.BatchNewParamsEndpointV1ChatCompletions,
+		InputFileID:      file.ID,
+	})
+}
+
+func (a *openaiBatchAPI) Get(ctx context.Context, id string) (*openai.Batch, error) {
+	return a.client.Batches.Get(ctx, id)
+}
+
+func (a *openaiBatchAPI) Download(ctx context.Context, fileID string) ([]byte, error) {
+	response, err := a.client.Files.Content(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	return io.ReadAll(response.Body)
+}
+
+// batchRequestLine is a line of the JSONL input of a batch.
+type batchRequestLine struct {
+	CustomID string                          `json:"custom_id"`
+	Method   string                          `json:"method"`
+	URL      string                          `json:"url"`
+	Body     *openai.ChatCompletionNewParams `json:"body"`
+}
+
+// batchOutputLine is a line of the JSONL output of a batch.
+type batchOutputLine struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// batchAnalysisID identifies the analysis of a pending analysis in the requests of a batch.
+func batchAnalysisID(p *models.PendingAnalysis) string {
+	return lib.UrlToAnalysisKey(p.URL, p.Mode)
+}
+
+// parseBatchOutput returns the responses of the JSONL output of a batch by request ID, or the
+// error of the requests that failed.
+func parseBatchOutput(output []byte) (map[string]LlmResponse, map[string]error, error) {
+	responses := make(map[string]LlmResponse)
+	failures := make(map[string]error)
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var line batchOutputLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, nil, fmt.Errorf("error parsing batch output: %w", err)
+		}
+
+		switch {
+		case line.Error != nil:
+			failures[line.CustomID] = fmt.Errorf("batch request failed: %s: %s", line.Error.Code, line.Error.Message)
+		case line.Response == nil:
+			failures[line.CustomID] = errors.New("batch request has no response")
+		case line.Response.StatusCode != 200:
+			failures[line.CustomID] = fmt.Errorf("batch request failed with status %d: %s",
+				line.Response.StatusCode, line.Response.Body)
+		default:
+			var completion openai.ChatCompletion
+			if err := json.Unmarshal(line.Response.Body, &completion); err != nil {
+				failures[line.CustomID] = fmt.Errorf("error parsing batch response: %w", err)
+			} else if len(completion.Choices) == 0 {
+				failures[line.CustomID] = errors.New("no choices in batch response")
+			} else {
+				responses[line.CustomID] = LlmResponse{
+					Content: completion.Choices[0].Message.Content,
+					Usage: LlmUsage{
+						PromptTokens:     int(completion.Usage.PromptTokens),
+						CompletionTokens: int(completion.Usage.CompletionTokens),
+					},
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error reading batch output: %w", err)
+	}
+	return responses, failures, nil
+}
+
+// BatchSubmission summarizes a SubmitLlmBatches run.
+type BatchSubmission struct {
+	// Batches are the batches created.
+	Batches []*models.LlmBatch
+	// Submitted is the number of analyses submitted.
+	Submitted int
+	// Cached is the number of queued analyses served from the cache without being submitted.
+	Cached int
+	// Failed is the number of queued analyses that could not be prepared, kept for a later
+	// submission or dropped.
+	Failed int
+}
+
+// SubmitLlmBatches submits the analyses queued for the Batch API (see BatchOptions.QueueForBatch)
+// that are not in a batch yet, in one batch per model of at most MaxBatchRequests analyses.
+// Only the first LLM call of each analysis is submitted; the others (repairs, the later chunks of
+// long articles, ...) are made live by CollectLlmBatches.
+func SubmitLlmBatches(
+	ctx context.Context,
+	llmOptions LlmOptions,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+) (BatchSubmission, error) {
+	api := &openaiBatchAPI{client: NewGptLlmClientWithOptions(llmOptions).apiClient()}
+	return submitLlmBatches(ctx, api, llmOptions.Language, llmOptions.MaxAge, datastoreClient, verbose,
+		func(mode AnalysisMode) (*GptLlmClient, error) {
+			options := llmOptions
+			model, err := ResolveModel(mode, options.Model)
+			if err != nil {
+				return nil, err
+			}
+			options.Model = model
+			return NewGptLlmClientWithOptions(options), nil
+		})
+}
+
+// submitLlmBatches implements SubmitLlmBatches with the API client for each mode returned by clientFor.
+func submitLlmBatches(
+	ctx context.Context,
+	api batchAPI,
+	languagePolicy LanguagePolicy,
+	maxAge time.Duration,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+	clientFor func(mode AnalysisMode) (*GptLlmClient, error),
+) (BatchSubmission, error) {
+	var result BatchSubmission
+
+	pending, err := datastoreClient.ListPendingAnalyses(ctx)
+	if err != nil {
+		return result, fmt.Errorf("error listing pending analyses: %w", err)
+	}
+
+	// queued is an analysis ready to be submitted
+	type queued struct {
+		pending    *models.PendingAnalysis
+		line       []byte
+		promptHash string
+	}
+	byModel := make(map[string][]queued)
+	var batchModels []string
+	for _, p := range pending {
+		if !p.Batch || p.BatchID != "" {
+			continue
+		}
+		pageCtx := logging.WithAttrs(ctx, "url", p.URL, "mode", p.Mode)
+
+		recorder, cached, err := recordBatchRequest(pageCtx, p, languagePolicy, maxAge, datastoreClient, verbose, clientFor)
+		if err != nil {
+			result.Failed++
+			if err := retryPendingAnalysis(pageCtx, p, err, datastoreClient); err != nil {
+				return result, err
+			}
+			continue
+		}
+		if recorder == nil {
+			if cached {
+				result.Cached++
+			} else {
+				result.Failed++ // Page is no longer stored
+			}
+			if err := datastoreClient.DeletePendingAnalysis(ctx, p.URL, p.Mode); err != nil {
+				return result, fmt.Errorf("error deleting pending analysis for %s: %w", p.URL, err)
+			}
+			continue
+		}
+
+		line, err := json.Marshal(batchRequestLine{
+			CustomID: batchAnalysisID(p),
+			Method:   "POST",
+			URL:      string(openai.BatchNewParamsEndpointV1ChatCompletions),
+			Body:     recorder.request,
+		})
+		if err != nil {
+			return result, fmt.Errorf("error encoding batch request for %s: %w", p.URL, err)
+		}
+		model := recorder.Model()
+		if _, ok := byModel[model]; !ok {
+			batchModels = append(batchModels, model)
+		}
+		byModel[model] = append(byModel[model], queued{pending: p, line: line, promptHash: lib.ContentHash(recorder.prompt)})
+	}
+
+	for _, model := range batchModels {
+		all := byModel[model]
+		for start := 0; start < len(all); start += MaxBatchRequests {
+			requests := all[start:min(start+MaxBatchRequests, len(all))]
+
+			var input bytes.Buffer
+			for _, q := range requests {
+				input.Write(q.line)
+				input.WriteByte('\n')
+			}
+			batch, err := api.Submit(ctx, input.Bytes())
+			if err != nil {
+				return result, fmt.Errorf("error submitting batch: %w", err)
+			}
+
+			now := time.Now()
+			record := &models.LlmBatch{
+				ID:          batch.ID,
+				Model:       model,
+				Status:      string(batch.Status),
+				InputFileID: batch.InputFileID,
+				Requests:    len(requests),
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}
+			if err := datastoreClient.WriteLlmBatch(ctx, record); err != nil {
+				return result, fmt.Errorf("error saving batch %s: %w", batch.ID, err)
+			}
+			for _, q := range requests {
+				q.pending.BatchID = batch.ID
+				q.pending.PromptHash = q.promptHash
+				q.pending.UpdatedAt = now
+				if err := datastoreClient.WritePendingAnalysis(ctx, q.pending); err != nil {
+					return result, fmt.Errorf("error updating pending analysis for %s: %w", q.pending.URL, err)
+				}
+			}
+			slog.InfoContext(ctx, "Submitted batch", "batch", batch.ID, "model", model, "requests", len(requests))
+			result.Batches = append(result.Batches, record)
+			result.Submitted += len(requests)
+		}
+	}
+
+	return result, nil
+}
+
+// recordBatchRequest runs the analysis of a queued page up to its first LLM call and returns the
+// recorded call. It returns no recorder if the page needs no call: cached is true if the analysis
+// was served from the cache, false if the page is no longer stored.
+func recordBatchRequest(
+	ctx context.Context,
+	pending *models.PendingAnalysis,
+	languagePolicy LanguagePolicy,
+	maxAge time.Duration,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+	clientFor func(mode AnalysisMode) (*GptLlmClient, error),
+) (*batchRecorder, bool, error) {
+	page, found, err := lib.ReadLinkedPage(ctx, datastoreClient, pending.URL)
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading crawled page: %w", err)
+	}
+	if !found {
+		slog.WarnContext(ctx, "Dropping pending analysis: crawled page is no longer stored")
+		return nil, false, nil
+	}
+	page.Feed = pending.Feed
+
+	client, err := clientFor(pending.Mode)
+	if err != nil {
+		return nil, false, err
+	}
+	recorder := &batchRecorder{client: client}
+	_, err = analyzePage(ctx, page, recorder, pending.Mode, languagePolicy, maxAge, datastoreClient, verbose, false)
+	if err == nil {
+		return nil, true, nil
+	}
+	if !errors.Is(err, errRequestRecorded) {
+		return nil, false, err
+	}
+	return recorder, false, nil
+}
+
+// BatchCollection summarizes a CollectLlmBatches run.
+type BatchCollection struct {
+	// Batches are the batches that were open, with their current status.
+	Batches []*models.LlmBatch
+	// Analyzed is the number of analyses completed from batch results.
+	Analyzed int
+	// Failed is the number of analyses of finished batches without a usable result. They are
+	// queued again for the next submission, or dropped after MaxPendingAttempts attempts.
+	Failed int
+	// Usage is the LLM usage of the completed analyses.
+	Usage UsageTotals
+}
+
+// CollectLlmBatches checks the status of the open batches and stores the analyses of the
+// finished ones, removing their pending markers. Analyses a finished batch has no result for
+// (because the batch failed or expired, or the request failed) are queued again.
+func CollectLlmBatches(
+	ctx context.Context,
+	llmOptions LlmOptions,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+) (BatchCollection, error) {
+	api := &openaiBatchAPI{client: NewGptLlmClientWithOptions(llmOptions).apiClient()}
+	return collectLlmBatches(ctx, api, llmOptions.Language, llmOptions.MaxAge, datastoreClient, verbose,
+		func(model string) LlmClient {
+			options := llmOptions
+			options.Model = model
+			return NewGptLlmClientWithOptions(options)
+		})
+}
+
+// collectLlmBatches implements CollectLlmBatches with the LLM client for each model returned by
+// clientFor, which makes the calls that were not submitted in the batch.
+func collectLlmBatches(
+	ctx context.Context,
+	api batchAPI,
+	languagePolicy LanguagePolicy,
+	maxAge time.Duration,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+	clientFor func(model string) LlmClient,
+) (BatchCollection, error) {
+	var result BatchCollection
+
+	batches, err := datastoreClient.ListLlmBatches(ctx)
+	if err != nil {
+		return result, fmt.Errorf("error listing batches: %w", err)
+	}
+
+	for _, record := range batches {
+		if !record.Open() {
+			continue
+		}
+		batchCtx := logging.WithAttrs(ctx, "batch", record.ID)
+
+		batch, err := api.Get(batchCtx, record.ID)
+		if err != nil {
+			return result, fmt.Errorf("error checking batch %s: %w", record.ID, err)
+		}
+		record.Status = string(batch.Status)
+		record.OutputFileID = batch.OutputFileID
+		record.Completed = int(batch.RequestCounts.Completed)
+		record.Failed = int(batch.RequestCounts.Failed)
+		record.UpdatedAt = time.Now()
+		result.Batches = append(result.Batches, record)
+
+		switch batch.Status {
+		case openai.BatchStatusCompleted, openai.BatchStatusFailed, openai.BatchStatusExpired, openai.BatchStatusCancelled:
+			if err := collectLlmBatch(batchCtx, api, record, languagePolicy, maxAge, datastoreClient, verbose,
+				clientFor(record.Model), &result); err != nil {
+				return result, err
+			}
+			record.CollectedAt = time.Now()
+		}
+		if err := datastoreClient.WriteLlmBatch(ctx, record); err != nil {
+			return result, fmt.Errorf("error saving batch %s: %w", record.ID, err)
+		}
+	}
+
+	return result, nil
+}
+
+// collectLlmBatch stores the analyses of the finished batch record, adding them up in result.
+func collectLlmBatch(
+	ctx context.Context,
+	api batchAPI,
+	record *models.LlmBatch,
+	languagePolicy LanguagePolicy,
+	maxAge time.Duration,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+	llmClient LlmClient,
+	result *BatchCollection,
+) error {
+	responses := make(map[string]LlmResponse)
+	failures := make(map[string]error)
+	if record.OutputFileID != "" {
+		output, err := api.Download(ctx, record.OutputFileID)
+		if err != nil {
+			return fmt.Errorf("error downloading results of batch %s: %w", record.ID, err)
+		}
+		if responses, failures, err = parseBatchOutput(output); err != nil {
+			return fmt.Errorf("batch %s: %w", record.ID, err)
+		}
+	}
+
+	pending, err := datastoreClient.ListPendingAnalyses(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing pending analyses: %w", err)
+	}
+	for _, p := range pending {
+		if p.BatchID != record.ID {
+			continue
+		}
+		pageCtx := logging.WithAttrs(ctx, "url", p.URL, "mode", p.Mode)
+
+		id := batchAnalysisID(p)
+		response, ok := responses[id]
+		var analysis *models.AnalysisResult
+		if ok {
+			client := &batchReplayClient{LlmClient: llmClient, promptHash: p.PromptHash, response: response}
+			analysis, err = backfillOne(pageCtx, p, 0, PageSelector{}, languagePolicy, maxAge, datastoreClient, verbose,
+				func(AnalysisMode) (LlmClient, error) { return client, nil })
+		} else if err = failures[id]; err == nil {
+			err = fmt.Errorf("no result in batch %s, which is %s", record.ID, record.Status)
+		}
+		if err != nil {
+			// Queue the analysis for the next submission
+			result.Failed++
+			p.BatchID, p.PromptHash = "", ""
+			if err := retryPendingAnalysis(pageCtx, p, err, datastoreClient); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if analysis != nil {
+			result.Analyzed++
+			result.Usage.Add(analysis)
+		} else {
+			result.Failed++ // Page is no longer stored
+		}
+		if err := datastoreClient.DeletePendingAnalysis(ctx, p.URL, p.Mode); err != nil {
+			return fmt.Errorf("error deleting pending analysis for %s: %w", p.URL, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/openai/openai-go/v3"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// fakeBatchAPI records submitted batches and returns the outputs set by the test.
+type fakeBatchAPI struct {
+	inputs  []string
+	status  openai.BatchStatus
+	outputs map[string]string
+}
+
+func (a *fakeBatchAPI) Submit(ctx context.Context, input []byte) (*openai.Batch, error) {
+	a.inputs = append(a.inputs, string(input))
+	return &openai.Batch{ID: fmt.Sprintf("batch-%d", len(a.inputs)), Status: openai.BatchStatusValidating}, nil
+}
+
+func (a *fakeBatchAPI) Get(ctx context.Context, id string) (*openai.Batch, error) {
+	batch := &openai.Batch{ID: id, Status: a.status}
+	if _, ok := a.outputs[id]; ok {
+		batch.OutputFileID = "output-" + id
+	}
+	return batch, nil
+}
+
+func (a *fakeBatchAPI) Download(ctx context.Context, fileID string) ([]byte, error) {
+	return []byte(a.outputs[strings.TrimPrefix(fileID, "output-")]), nil
+}
+
+// queueBatchAnalysis stores a page and its analysis queued for the Batch API.
+func queueBatchAnalysis(t *testing.T, mockDS *lib.MockDatastoreClient, url string) {
+	t.Helper()
+	ctx := context.Background()
+	mockDS.SaveCrawledPage(ctx, &models.CrawledPage{URL: url, Title: "Title " + url, Content: "Content"})
+	if err := mockDS.WritePendingAnalysis(ctx, &models.PendingAnalysis{
+		URL: url, Mode: AnalysisModeTest, Attempts: 1, Batch: true, CreatedAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLlmBatches(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	queueBatchAnalysis(t, mockDS, "example.com/a")
+	queueBatchAnalysis(t, mockDS, "example.com/b")
+	mockDS.WritePendingAnalysis(ctx, &models.PendingAnalysis{URL: "example.com/gone", Mode: AnalysisModeTest, Batch: true})
+	mockDS.WritePendingAnalysis(ctx, &models.PendingAnalysis{URL: "example.com/deferred", Mode: AnalysisModeTest})
+
+	api := &fakeBatchAPI{status: openai.BatchStatusInProgress}
+	submission, err := submitLlmBatches(ctx, api, LanguagePolicyAsIs, 0, mockDS, false,
+		func(mode AnalysisMode) (*GptLlmClient, error) {
+			return NewGptLlmClientWithOptions(LlmOptions{Model: "gpt-test"}), nil
+		})
+	if err != nil {
+		t.Fatalf("submitLlmBatches() error = %v", err)
+	}
+	if submission.Submitted != 2 || submission.Failed != 1 || len(submission.Batches) != 1 {
+		t.Fatalf("submission = %+v, want 2 analyses in one batch and 1 failure", submission)
+	}
+
+	lines := strings.Split(strings.TrimSpace(api.inputs[0]), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("batch input has %d lines, want 2", len(lines))
+	}
+	var request struct {
+		CustomID string `json:"custom_id"`
+		URL      string `json:"url"`
+		Body     struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		} `json:"body"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &request); err != nil {
+		t.Fatalf("invalid batch request: %v", err)
+	}
+	if request.URL != "/v1/chat/completions" || request.Body.Model != "gpt-test" ||
+		len(request.Body.Messages) != 1 || !strings.Contains(request.Body.Messages[0].Content, "Title example.com/") {
+		t.Errorf("unexpected batch request %s", lines[0])
+	}
+
+	// Submitted analyses are not submitted again
+	if again, _ := submitLlmBatches(ctx, api, LanguagePolicyAsIs, 0, mockDS, false, nil); again.Submitted != 0 {
+		t.Errorf("resubmitted %d analyses", again.Submitted)
+	}
+
+	// An unfinished batch is left open
+	live := &MockLlmClient{Response: `{"result": "live"}`, ModelName: openai.ChatModelGPT4oMini}
+	clientFor := func(model string) LlmClient { return live }
+	collection, err := collectLlmBatches(ctx, api, LanguagePolicyAsIs, 0, mockDS, false, clientFor)
+	if err != nil || collection.Analyzed != 0 || len(collection.Batches) != 1 {
+		t.Fatalf("collectLlmBatches() = %+v, %v, want one open batch", collection, err)
+	}
+
+	// Once complete, a's result is stored and b, which failed, is queued again
+	api.status = openai.BatchStatusCompleted
+	api.outputs = map[string]string{"batch-1": fmt.Sprintf(
+		`{"custom_id": %q, "response": {"status_code": 200, "body": {"choices": [{"message": {"role": "assistant", "content": "{\"result\": \"batched\"}"}}], "usage": {"prompt_tokens": 10, "completion_tokens": 5}}}}`+"\n"+
+			`{"custom_id": %q, "error": {"code": "server_error", "message": "boom"}}`+"\n",
+		lib.UrlToAnalysisKey("example.com/a", AnalysisModeTest), lib.UrlToAnalysisKey("example.com/b", AnalysisModeTest))}
+	collection, err = collectLlmBatches(ctx, api, LanguagePolicyAsIs, 0, mockDS, false, clientFor)
+	if err != nil {
+		t.Fatalf("collectLlmBatches() error = %v", err)
+	}
+	if collection.Analyzed != 1 || collection.Failed != 1 || collection.Batches[0].Open() {
+		t.Errorf("collection = %+v, want 1 analyzed, 1 failed and the batch collected", collection)
+	}
+	if live.Calls != 0 {
+		t.Errorf("made %d live LLM calls, want none", live.Calls)
+	}
+	result, found, _ := mockDS.ReadAnalysisResult(ctx, "example.com/a", AnalysisModeTest)
+	if !found || result.PromptTokens != 10 || result.CompletionTokens != 5 {
+		t.Errorf("result = %+v, want the batch's response", result)
+	}
+	usage := LlmUsage{PromptTokens: 10, CompletionTokens: 5}
+	if want := EstimateCost(openai.ChatModelGPT4oMini, usage) * batchPriceFactor; math.Abs(result.CostUSD-want) > 1e-12 {
+		t.Errorf("CostUSD = %v, want %v at the Batch API price", result.CostUSD, want)
+	}
+
+	pending, _ := mockDS.ListPendingAnalyses(ctx)
+	if len(pending) != 2 {
+		t.Fatalf("pending = %+v, want b and the deferred analysis", pending)
+	}
+	for _, p := range pending {
+		if p.URL == "example.com/b" && (p.BatchID != "" || p.Attempts != 2 || !p.Batch) {
+			t.Errorf("pending = %+v, want b queued for the next batch", p)
+		}
+	}
+	batches, _ := mockDS.ListLlmBatches(ctx)
+	if len(batches) != 1 || batches[0].Open() || batches[0].Status != "completed" {
+		t.Errorf("batches = %+v, want one collected batch", batches)
+	}
+}
+
+func TestBatchReplayClient(t *testing.T) {
+	live := &MockLlmClient{Response: "live"}
+	client := &batchReplayClient{LlmClient: live, promptHash: lib.ContentHash("prompt"), response: LlmResponse{Content: "batched"}}
+
+	for _, tt := range []struct{ prompt, want string }{
+		{"other", "live"},
+		{"prompt", "batched"},
+		{"prompt", "live"}, // The batch response is used once
+	} {
+		response, err := client.Analyze(context.Background(), tt.prompt, nil, GenerationParams{})
+		if err != nil || response.Content != tt.want {
+			t.Errorf("Analyze(%q) = %q, %v, want %q", tt.prompt, response.Content, err, tt.want)
+		}
+	}
+}
@@ -3,59 +3,403 @@ package analyzer
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
 	openai "github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/option"
+	"github.com/openai/openai-go/v3/shared"
 )
 
+// LlmUsage holds the token counts reported by the LLM API for a call.
+type LlmUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// LlmResponse is the result of a single LLM call.
+type LlmResponse struct {
+	// Content is the text returned by the LLM.
+	Content string
+	// Usage is the token usage reported for the call.
+	Usage LlmUsage
+}
+
 // LlmClient defines the interface for LLM operations.
 type LlmClient interface {
 	// Analyze analyzes content using an LLM with the provided prompt.
-	Analyze(ctx context.Context, prompt string) (string, error)
+	// If schema is non-nil, the LLM is asked to respond with JSON matching it.
+	// params sets the system prompt and sampling parameters for the call.
+	Analyze(ctx context.Context, prompt string, schema *ResponseSchema, params GenerationParams) (LlmResponse, error)
+	// Model returns the name of the model used for analysis.
+	Model() string
+	// Provider returns the API serving the model: "openai", or the host of an OpenAI-compatible
+	// server. Together with Model it identifies who produced an analysis.
+	Provider() string
 }
 
-// GptLlmClient is an implementation of LlmClient that uses OpenAI's GPT API.
+// DefaultProvider is the provider name of the official OpenAI endpoint.
+const DefaultProvider = "openai"
+
+// LlmOptions configures how GptLlmClient talks to an OpenAI-compatible API.
+type LlmOptions struct {
+	// APIKey is the API key sent with every request.
+	APIKey string
+	// BaseURL is the base URL of an OpenAI-compatible server (vLLM, OpenRouter, LM Studio, ...).
+	// Empty means the official OpenAI endpoint.
+	BaseURL string
+	// Model is the model name passed to the chat completions API.
+	// Empty means openai.ChatModelGPT4o.
+	Model string
+	// Stream enables streamed responses. Streaming stops as soon as the JSON object
+	// in the response is complete, which cuts latency for long responses.
+	Stream bool
+	// Progress, if set, is called at the start of each streamed response, possibly from several
+	// goroutines at once, and returns the function called with the number of characters of
+	// that response received so far.
+	Progress func() func(received int)
+	// Generation overrides the per-mode generation parameters and GenerationOverrides for every
+	// call of the client, e.g. with the seed of an ensemble member. Unlike GenerationOverrides, it
+	// isn't part of the prompt fingerprints.
+	Generation GenerationParams
+	// Language controls how pages that are not in English are analyzed. It is used by the
+	// analysis functions, not by GptLlmClient. The zero value behaves like LanguagePolicyAsIs.
+	Language LanguagePolicy
+	// Ensemble analyzes each article several times and aggregates the scores. It is used by
+	// NewLlmClient, not by GptLlmClient.
+	Ensemble EnsembleOptions
+	// Vision analyzes the lead image of articles with a vision model and blends its verdict into
+	// the joke percentage. It is used by NewLlmClient, not by GptLlmClient.
+	Vision VisionOptions
+	// MaxAge is how long cached analyses are used before the page is analyzed again, so that
+	// results improve with the prompt and model. It is used by the analysis functions, not by
+	// GptLlmClient. Zero means cached analyses never expire.
+	MaxAge time.Duration
+	// CallLog, if set, stores every request to the LLM and its response. Nil disables it.
+	CallLog *LlmCallLog
+	// MaxContentLength is the number of characters of article content sent in one prompt,
+	// overriding the limits of the modes and models. Zero keeps them (see ModelMaxContentLengths).
+	MaxContentLength int
+}
+
+// GptLlmClient is an implementation of LlmClient that uses OpenAI's GPT API
+// or any server that implements the same chat completions API.
 type GptLlmClient struct {
-	apiKey string
+	apiKey     string
+	baseURL    string
+	model      string
+	stream     bool
+	progress   func() func(received int)
+	generation GenerationParams
+	callLog    *LlmCallLog
+
+	maxContentLength int
 }
 
 // NewGptLlmClient creates a new GptLlmClient with the provided API key.
 func NewGptLlmClient(apiKey string) *GptLlmClient {
-	return &GptLlmClient{apiKey: apiKey}
+	return NewGptLlmClientWithOptions(LlmOptions{APIKey: apiKey})
+}
+
+// NewGptLlmClientWithOptions creates a new GptLlmClient from the provided options.
+func NewGptLlmClientWithOptions(opts LlmOptions) *GptLlmClient {
+	model := opts.Model
+	if model == "" {
+		model = openai.ChatModelGPT4o
+	}
+	return &GptLlmClient{
+		apiKey:     opts.APIKey,
+		baseURL:    opts.BaseURL,
+		model:      model,
+		stream:     opts.Stream,
+		progress:   opts.Progress,
+		generation: opts.Generation,
+		callLog:    opts.CallLog,
+
+		maxContentLength: opts.MaxContentLength,
+	}
+}
+
+// Model returns the model name used by this client.
+func (g *GptLlmClient) Model() string {
+	return g.model
+}
+
+// Provider returns "openai" for the official endpoint, or the host of the configured base URL.
+func (g *GptLlmClient) Provider() string {
+	return ProviderName(g.baseURL)
+}
+
+// ProviderName returns the provider identifying the API at baseURL: "openai" for the official
+// endpoint (empty baseURL), otherwise the host of baseURL.
+func ProviderName(baseURL string) string {
+	if baseURL == "" {
+		return DefaultProvider
+	}
+	parsed, err := url.Parse(baseURL)
+	if err != nil || parsed.Host == "" {
+		return baseURL
+	}
+	return parsed.Host
 }
 
 // Analyze analyzes content using OpenAI's GPT API.
-func (g *GptLlmClient) Analyze(ctx context.Context, prompt string) (string, error) {
-	client := openai.NewClient(option.WithAPIKey(g.apiKey))
+// If schema is non-nil, structured outputs are requested with strict schema adherence.
+// GenerationOverrides and the generation parameters set in the client options take precedence
+// over params.
+func (g *GptLlmClient) Analyze(
+	ctx context.Context,
+	prompt string,
+	schema *ResponseSchema,
+	params GenerationParams,
+) (LlmResponse, error) {
+	start := time.Now()
+	response, err := g.complete(ctx, openai.UserMessage(prompt), schema, params)
+	g.callLog.record(ctx, g, prompt, "", time.Since(start), response, err)
+	return response, err
+}
 
-	chatCompletion, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.UserMessage(prompt),
-		},
-		Model: openai.ChatModelGPT4o,
+// AnalyzeImage analyzes the image at imageURL with the prompt. The model must accept images.
+func (g *GptLlmClient) AnalyzeImage(
+	ctx context.Context,
+	prompt, imageURL string,
+	schema *ResponseSchema,
+	params GenerationParams,
+) (LlmResponse, error) {
+	message := openai.UserMessage([]openai.ChatCompletionContentPartUnionParam{
+		openai.TextContentPart(prompt),
+		openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{URL: imageURL}),
 	})
+	start := time.Now()
+	response, err := g.complete(ctx, message, schema, params)
+	g.callLog.record(ctx, g, prompt, imageURL, time.Since(start), response, err)
+	return response, err
+}
+
+// complete sends message to the chat completions API and returns the response.
+func (g *GptLlmClient) complete(
+	ctx context.Context,
+	message openai.ChatCompletionMessageParamUnion,
+	schema *ResponseSchema,
+	params GenerationParams,
+) (LlmResponse, error) {
+	client := g.apiClient()
+	request := g.newRequest(message, schema, params)
+
+	if g.stream {
+		return g.analyzeStream(ctx, client, request, schema != nil)
+	}
+
+	chatCompletion, err := client.Chat.Completions.New(ctx, request)
 
 	if err != nil {
-		return "", err
+		return LlmResponse{}, err
 	}
 
 	if len(chatCompletion.Choices) == 0 {
-		return "", fmt.Errorf("no choices in OpenAI response")
+		return LlmResponse{}, fmt.Errorf("no choices in OpenAI response")
 	}
 
-	return chatCompletion.Choices[0].Message.Content, nil
+	return LlmResponse{
+		Content: chatCompletion.Choices[0].Message.Content,
+		Usage: LlmUsage{
+			PromptTokens:     int(chatCompletion.Usage.PromptTokens),
+			CompletionTokens: int(chatCompletion.Usage.CompletionTokens),
+		},
+	}, nil
+}
+
+// apiClient returns an OpenAI API client for the configured key and endpoint.
+func (g *GptLlmClient) apiClient() openai.Client {
+	requestOptions := []option.RequestOption{option.WithAPIKey(g.apiKey)}
+	if g.baseURL != "" {
+		requestOptions = append(requestOptions, option.WithBaseURL(g.baseURL))
+	}
+	return openai.NewClient(requestOptions...)
+}
+
+// newRequest returns the chat completion request sending message with the client's model.
+func (g *GptLlmClient) newRequest(
+	message openai.ChatCompletionMessageParamUnion,
+	schema *ResponseSchema,
+	params GenerationParams,
+) openai.ChatCompletionNewParams {
+	request := openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{message},
+		Model:    g.model,
+	}
+	params.Merge(GenerationOverrides).Merge(g.generation).apply(&request)
+	if schema != nil {
+		request.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONSchema: &shared.ResponseFormatJSONSchemaParam{
+				JSONSchema: shared.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:   schema.Name,
+					Schema: schema.Schema,
+					Strict: openai.Bool(true),
+				},
+			},
+		}
+	}
+	return request
+}
+
+// analyzeStream runs the chat completion as a stream. If cutoff is true, the stream is closed
+// as soon as the top-level JSON object in the response is complete.
+// When the stream ends before the final usage chunk, as it does when it is cut off, completion
+// tokens are estimated from the number of content chunks received and prompt tokens from the
+// length of the prompt (see estimateTokens).
+func (g *GptLlmClient) analyzeStream(
+	ctx context.Context,
+	client openai.Client,
+	params openai.ChatCompletionNewParams,
+	cutoff bool,
+) (LlmResponse, error) {
+	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+	stream := client.Chat.Completions.NewStreaming(ctx, params)
+	defer stream.Close()
+
+	var content strings.Builder
+	var usage LlmUsage
+	var scanner jsonObjectScanner
+	chunks := 0
+	complete := false
+	var progress func(received int)
+	if g.progress != nil {
+		progress = g.progress()
+	}
+
+	for stream.Next() {
+		chunk := stream.Current()
+		if chunk.Usage.TotalTokens > 0 {
+			usage.PromptTokens = int(chunk.Usage.PromptTokens)
+			usage.CompletionTokens = int(chunk.Usage.CompletionTokens)
+			break // The usage chunk is the last one
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta.Content
+		if delta == "" {
+			continue
+		}
+		chunks++
+		if cutoff {
+			n, done := scanner.Feed(delta)
+			content.WriteString(delta[:n])
+			complete = done
+		} else {
+			content.WriteString(delta)
+		}
+		if progress != nil {
+			progress(content.Len())
+		}
+		if complete {
+			break
+		}
+	}
+	if err := stream.Err(); err != nil && !complete {
+		return LlmResponse{}, err
+	}
+
+	if usage.CompletionTokens == 0 {
+		usage.CompletionTokens = chunks
+		for _, message := range params.Messages {
+			usage.PromptTokens += estimateTokens(messageText(message))
+		}
+	}
+	return LlmResponse{Content: content.String(), Usage: usage}, nil
+}
+
+// estimateTokens estimates the number of tokens of text, at about four characters per token.
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// messageText returns the text of a user message, without its images.
+func messageText(message openai.ChatCompletionMessageParamUnion) string {
+	if message.OfUser == nil {
+		return ""
+	}
+	content := message.OfUser.Content
+	if content.OfString.Valid() {
+		return content.OfString.Value
+	}
+	var text strings.Builder
+	for _, part := range content.OfArrayOfContentParts {
+		if part.OfText != nil {
+			text.WriteString(part.OfText.Text)
+		}
+	}
+	return text.String()
 }
 
 // MockLlmClient is a mock implementation of LlmClient for testing.
 type MockLlmClient struct {
 	Response string
-	Error    error
+	// Responses, if set, are returned by successive Analyze calls before falling back to Response.
+	Responses []string
+	Usage     LlmUsage
+	Error     error
+	ModelName string
+	// MaxContentLength overrides the content length limit of the model, like
+	// LlmOptions.MaxContentLength. Zero keeps it.
+	MaxContentLength int
+	// ProviderName is returned by Provider. Empty means DefaultProvider.
+	ProviderName string
+	// LastSchema is the schema passed to the most recent Analyze call.
+	LastSchema *ResponseSchema
+	// LastParams is the generation parameters passed to the most recent Analyze call.
+	LastParams GenerationParams
+	// LastPrompt is the prompt passed to the most recent Analyze or AnalyzeImage call.
+	LastPrompt string
+	// LastImageURL is the image URL passed to the most recent AnalyzeImage call.
+	LastImageURL string
+	// Calls is the number of Analyze calls made.
+	Calls int
 }
 
 // Analyze returns the mock response or error.
-func (m *MockLlmClient) Analyze(ctx context.Context, prompt string) (string, error) {
+func (m *MockLlmClient) Analyze(
+	ctx context.Context,
+	prompt string,
+	schema *ResponseSchema,
+	params GenerationParams,
+) (LlmResponse, error) {
+	m.LastSchema = schema
+	m.LastParams = params
+	m.LastPrompt = prompt
+	m.Calls++
 	if m.Error != nil {
-		return "", m.Error
+		return LlmResponse{}, m.Error
+	}
+	if m.Calls <= len(m.Responses) {
+		return LlmResponse{Content: m.Responses[m.Calls-1], Usage: m.Usage}, nil
+	}
+	return LlmResponse{Content: m.Response, Usage: m.Usage}, nil
+}
+
+// AnalyzeImage records imageURL and returns the mock response or error like Analyze.
+func (m *MockLlmClient) AnalyzeImage(
+	ctx context.Context,
+	prompt, imageURL string,
+	schema *ResponseSchema,
+	params GenerationParams,
+) (LlmResponse, error) {
+	m.LastImageURL = imageURL
+	return m.Analyze(ctx, prompt, schema, params)
+}
+
+// Model returns the mock model name.
+func (m *MockLlmClient) Model() string {
+	return m.ModelName
+}
+
+// Provider returns the mock provider name.
+func (m *MockLlmClient) Provider() string {
+	if m.ProviderName == "" {
+		return DefaultProvider
 	}
-	return m.Response, nil
+	return m.ProviderName
 }
@@ -0,0 +1,42 @@
+package analyzer
+
+import (
+	"testing"
+)
+
+func TestNewGptLlmClientWithOptions(t *testing.T) {
+	tests := []struct {
+		name             string
+		opts             LlmOptions
+		expectedModel    string
+		expectedProvider string
+	}{
+		{
+			name:             "defaults to gpt-4o",
+			opts:             LlmOptions{APIKey: "key"},
+			expectedModel:    "gpt-4o",
+			expectedProvider: "openai",
+		},
+		{
+			name:             "custom model and base URL",
+			opts:             LlmOptions{APIKey: "key", BaseURL: "http://localhost:8000/v1", Model: "llama-3-8b"},
+			expectedModel:    "llama-3-8b",
+			expectedProvider: "localhost:8000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewGptLlmClientWithOptions(tt.opts)
+			if client.Model() != tt.expectedModel {
+				t.Errorf("Model() = %q, want %q", client.Model(), tt.expectedModel)
+			}
+			if client.Provider() != tt.expectedProvider {
+				t.Errorf("Provider() = %q, want %q", client.Provider(), tt.expectedProvider)
+			}
+			if client.baseURL != tt.opts.BaseURL {
+				t.Errorf("baseURL = %q, want %q", client.baseURL, tt.opts.BaseURL)
+			}
+		})
+	}
+}
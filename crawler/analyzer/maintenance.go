@@ -0,0 +1,279 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+	"github.com/zeace/poisson/models"
+)
+
+// FindStaleAnalyses returns the stored analyses for mode that were made with a different
+// prompt fingerprint or version than the current one (see IsStale).
+func FindStaleAnalyses(
+	ctx context.Context,
+	datastoreClient lib.DatastoreClient,
+	mode AnalysisMode,
+) ([]*models.AnalysisResult, error) {
+	if _, ok := lookupPromptConfig(mode); !ok {
+		return nil, fmt.Errorf("unknown mode '%s'", mode)
+	}
+
+	results, err := datastoreClient.ListAnalysisResults(ctx, mode)
+	if err != nil {
+		return nil, fmt.Errorf("error listing analysis results: %w", err)
+	}
+
+	var stale []*models.AnalysisResult
+	for _, result := range results {
+		isStale, err := IsStale(result)
+		if err != nil {
+			return nil, err
+		}
+		if isStale {
+			stale = append(stale, result)
+		}
+	}
+	return stale, nil
+}
+
+// FindAnalysesBetween returns the stored analyses for mode made at or after since and before until,
+// oldest first. A zero until means no upper bound. If maxAge is positive, only the analyses older
+// than maxAge are returned (see Expired), which selects the ones due for a scheduled re-analysis.
+func FindAnalysesBetween(
+	ctx context.Context,
+	datastoreClient lib.DatastoreClient,
+	mode AnalysisMode,
+	since, until time.Time,
+	maxAge time.Duration,
+) ([]*models.AnalysisResult, error) {
+	if _, ok := lookupPromptConfig(mode); !ok {
+		return nil, fmt.Errorf("unknown mode '%s'", mode)
+	}
+
+	results, err := datastoreClient.ListAnalysisResults(ctx, mode)
+	if err != nil {
+		return nil, fmt.Errorf("error listing analysis results: %w", err)
+	}
+
+	now := time.Now()
+	var matching []*models.AnalysisResult
+	for _, result := range results {
+		if result.AnalyzedAt.Before(since) || (!until.IsZero() && !result.AnalyzedAt.Before(until)) {
+			continue
+		}
+		if maxAge > 0 && !Expired(result, maxAge, now) {
+			continue
+		}
+		matching = append(matching, result)
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return matching[i].AnalyzedAt.Before(matching[j].AnalyzedAt)
+	})
+	return matching, nil
+}
+
+// PurgeStaleAnalyses deletes the stale analyses for mode and returns how many were deleted.
+// Pages whose analysis was purged are analyzed again the next time they are crawled.
+func PurgeStaleAnalyses(
+	ctx context.Context,
+	datastoreClient lib.DatastoreClient,
+	mode AnalysisMode,
+) (int, error) {
+	stale, err := FindStaleAnalyses(ctx, datastoreClient, mode)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, result := range stale {
+		if err := datastoreClient.DeleteAnalysisResult(ctx, result.URL, mode); err != nil {
+			return deleted, fmt.Errorf("error deleting analysis result for %s: %w", result.URL, err)
+		}
+		recordAnalysisEvent(ctx, datastoreClient, models.AuditActionDeleted, result.URL, result, "purged stale analysis")
+		deleted++
+	}
+	return deleted, nil
+}
+
+// MaxPendingAttempts is the number of analysis attempts after which a pending analysis that keeps
+// failing for reasons other than LLM unavailability is dropped.
+const MaxPendingAttempts = 5
+
+// BackfillResult summarizes a BackfillPendingAnalyses run.
+type BackfillResult struct {
+	// Analyzed is the number of pending analyses completed.
+	Analyzed int
+	// Failed is the number of pending analyses that failed and were kept for a later pass,
+	// or dropped because their page is gone or they failed MaxPendingAttempts times.
+	Failed int
+	// Remaining is the number of pending analyses not attempted because the LLM is still unavailable.
+	Remaining int
+	// Skipped is the number of pending analyses left pending because the selector didn't select
+	// their page.
+	Skipped int
+	// Usage is the LLM usage of the completed analyses.
+	Usage UsageTotals
+}
+
+// BackfillPendingAnalyses analyzes the pages whose analysis was deferred while the LLM was
+// unavailable (see BatchOptions.DeferOnUnavailable), oldest first, and removes their markers.
+// Analyses queued for the Batch API are skipped.
+// It stops as soon as the LLM turns out to be unavailable again; the rest stay pending.
+// Only the pending analyses of the pages selected by selector are run; the others stay pending.
+// timeout limits each analysis.
+func BackfillPendingAnalyses(
+	ctx context.Context,
+	llmOptions LlmOptions,
+	timeout time.Duration,
+	selector PageSelector,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+) (BackfillResult, error) {
+	return backfillPendingAnalyses(ctx, timeout, selector, llmOptions.Language, llmOptions.MaxAge, datastoreClient, verbose,
+		func(mode AnalysisMode) (LlmClient, error) {
+			options := llmOptions
+			model, err := ResolveModel(mode, options.Model)
+			if err != nil {
+				return nil, err
+			}
+			options.Model = model
+			return NewLlmClient(options), nil
+		})
+}
+
+// backfillPendingAnalyses implements BackfillPendingAnalyses with the LLM client for each mode
+// returned by clientFor.
+func backfillPendingAnalyses(
+	ctx context.Context,
+	timeout time.Duration,
+	selector PageSelector,
+	languagePolicy LanguagePolicy,
+	maxAge time.Duration,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+	clientFor func(mode AnalysisMode) (LlmClient, error),
+) (BackfillResult, error) {
+	var result BackfillResult
+
+	all, err := datastoreClient.ListPendingAnalyses(ctx)
+	if err != nil {
+		return result, fmt.Errorf("error listing pending analyses: %w", err)
+	}
+	// Analyses queued for the Batch API are left to SubmitLlmBatches
+	var pending []*models.PendingAnalysis
+	for _, p := range all {
+		if !p.Batch {
+			pending = append(pending, p)
+		}
+	}
+
+	for i, p := range pending {
+		pageCtx := logging.WithAttrs(ctx, "url", p.URL, "mode", p.Mode)
+
+		analysis, err := backfillOne(pageCtx, p, timeout, selector, languagePolicy, maxAge, datastoreClient, verbose, clientFor)
+		if errors.Is(err, errNotSelected) {
+			result.Skipped++
+			continue
+		}
+		if errors.Is(err, ErrLlmUnavailable) {
+			result.Remaining = len(pending) - i
+			slog.WarnContext(pageCtx, "LLM still unavailable, stopping backfill", "remaining", result.Remaining, "error", err)
+			return result, nil
+		}
+		if err != nil {
+			result.Failed++
+			if err := retryPendingAnalysis(pageCtx, p, err, datastoreClient); err != nil {
+				return result, err
+			}
+			continue
+		}
+
+		if analysis != nil {
+			result.Analyzed++
+			result.Usage.Add(analysis)
+		} else {
+			result.Failed++ // Page is no longer stored
+		}
+		if err := datastoreClient.DeletePendingAnalysis(ctx, p.URL, p.Mode); err != nil {
+			return result, fmt.Errorf("error deleting pending analysis for %s: %w", p.URL, err)
+		}
+	}
+
+	return result, nil
+}
+
+// retryPendingAnalysis records that the pending analysis p failed with cause, keeping it for a
+// later attempt, or dropping it after MaxPendingAttempts attempts.
+func retryPendingAnalysis(
+	ctx context.Context,
+	p *models.PendingAnalysis,
+	cause error,
+	datastoreClient lib.DatastoreClient,
+) error {
+	p.Attempts++
+	p.Error = cause.Error()
+	p.UpdatedAt = time.Now()
+	var err error
+	if p.Attempts >= MaxPendingAttempts {
+		slog.WarnContext(ctx, "Dropping pending analysis", "attempts", p.Attempts, "error", cause)
+		err = datastoreClient.DeletePendingAnalysis(ctx, p.URL, p.Mode)
+	} else {
+		slog.WarnContext(ctx, "Pending analysis failed", "attempts", p.Attempts, "error", cause)
+		err = datastoreClient.WritePendingAnalysis(ctx, p)
+	}
+	if err != nil {
+		return fmt.Errorf("error updating pending analysis for %s: %w", p.URL, err)
+	}
+	return nil
+}
+
+// errNotSelected is returned by backfillOne for a page the selector doesn't select.
+var errNotSelected = errors.New("page not selected")
+
+// backfillOne runs one pending analysis. It returns a nil result and no error if the page
+// is no longer stored, in which case the marker can be dropped.
+func backfillOne(
+	ctx context.Context,
+	pending *models.PendingAnalysis,
+	timeout time.Duration,
+	selector PageSelector,
+	languagePolicy LanguagePolicy,
+	maxAge time.Duration,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+	clientFor func(mode AnalysisMode) (LlmClient, error),
+) (*models.AnalysisResult, error) {
+	page, found, err := lib.ReadLinkedPage(ctx, datastoreClient, pending.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error reading crawled page: %w", err)
+	}
+	if !found {
+		slog.WarnContext(ctx, "Dropping pending analysis: crawled page is no longer stored")
+		return nil, nil
+	}
+	page.Feed = pending.Feed
+	if selected, err := selector.Matches(ctx, datastoreClient, page, pending.Mode); err != nil {
+		return nil, err
+	} else if !selected {
+		return nil, errNotSelected
+	}
+
+	llmClient, err := clientFor(pending.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	analysisCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		analysisCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return analyzePage(analysisCtx, page, llmClient, pending.Mode, languagePolicy, maxAge, datastoreClient, verbose, false)
+}
@@ -0,0 +1,225 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestFindStaleAnalyses(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	fingerprint, _ := GeneratePromptFingerprint(AnalysisModeJoke)
+	mockDS.WriteAnalysisResult(ctx, "example.com/current", &models.AnalysisResult{
+		Mode: AnalysisModeJoke, PromptFingerprint: fingerprint, PromptVersion: 2,
+	})
+	mockDS.WriteAnalysisResult(ctx, "example.com/unversioned", &models.AnalysisResult{
+		Mode: AnalysisModeJoke, PromptFingerprint: fingerprint,
+	})
+	mockDS.WriteAnalysisResult(ctx, "example.com/old-template", &models.AnalysisResult{
+		Mode: AnalysisModeJoke, PromptFingerprint: 12345, PromptVersion: 2,
+	})
+	mockDS.WriteAnalysisResult(ctx, "example.com/old-version", &models.AnalysisResult{
+		Mode: AnalysisModeJoke, PromptFingerprint: fingerprint, PromptVersion: 7,
+	})
+	mockDS.WriteAnalysisResult(ctx, "example.com/other-mode", &models.AnalysisResult{
+		Mode: AnalysisModeTest, PromptFingerprint: 12345,
+	})
+
+	stale, err := FindStaleAnalyses(ctx, mockDS, AnalysisModeJoke)
+	if err != nil {
+		t.Fatalf("FindStaleAnalyses returned error: %v", err)
+	}
+
+	var urls []string
+	for _, result := range stale {
+		urls = append(urls, result.URL)
+	}
+	// Results without a version were made with version 1
+	expected := []string{"example.com/old-template", "example.com/old-version", "example.com/unversioned"}
+	if strings.Join(urls, " ") != strings.Join(expected, " ") {
+		t.Errorf("stale URLs = %v, want %v", urls, expected)
+	}
+
+	if _, err := FindStaleAnalyses(ctx, mockDS, AnalysisMode("invalid")); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestFindAnalysesBetween(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	now := time.Now()
+	day := 24 * time.Hour
+	for url, analyzedAt := range map[string]time.Time{
+		"example.com/today":     now.Add(-time.Hour),
+		"example.com/last-week": now.Add(-7 * day),
+		"example.com/last-year": now.Add(-365 * day),
+		"example.com/unknown":   {},
+	} {
+		mockDS.WriteAnalysisResult(ctx, url, &models.AnalysisResult{Mode: AnalysisModeJoke, AnalyzedAt: analyzedAt})
+	}
+	mockDS.WriteAnalysisResult(ctx, "example.com/other-mode", &models.AnalysisResult{
+		Mode: AnalysisModeTest, AnalyzedAt: now.Add(-time.Hour),
+	})
+
+	tests := []struct {
+		name     string
+		since    time.Time
+		until    time.Time
+		maxAge   time.Duration
+		expected []string
+	}{
+		{"everything", time.Time{}, time.Time{}, 0,
+			[]string{"example.com/unknown", "example.com/last-year", "example.com/last-week", "example.com/today"}},
+		{"since", now.Add(-30 * day), time.Time{}, 0, []string{"example.com/last-week", "example.com/today"}},
+		{"range", now.Add(-30 * day), now.Add(-day), 0, []string{"example.com/last-week"}},
+		{"max age", time.Time{}, time.Time{}, 30 * day, []string{"example.com/unknown", "example.com/last-year"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := FindAnalysesBetween(ctx, mockDS, AnalysisModeJoke, tt.since, tt.until, tt.maxAge)
+			if err != nil {
+				t.Fatalf("FindAnalysesBetween returned error: %v", err)
+			}
+			var urls []string
+			for _, result := range results {
+				urls = append(urls, result.URL)
+			}
+			if !slices.Equal(urls, tt.expected) {
+				t.Errorf("URLs = %v, want %v", urls, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPurgeStaleAnalyses(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	fingerprint, _ := GeneratePromptFingerprint(AnalysisModeJoke)
+	mockDS.WriteAnalysisResult(ctx, "example.com/current", &models.AnalysisResult{
+		Mode: AnalysisModeJoke, PromptFingerprint: fingerprint, PromptVersion: 2,
+	})
+	// A legacy result without a stored URL is found through its key
+	mockDS.AnalysisResults[lib.UrlToAnalysisKey("example.com/news/old", AnalysisModeJoke)] = &models.AnalysisResult{
+		Mode: AnalysisModeJoke, PromptFingerprint: 12345,
+	}
+
+	deleted, err := PurgeStaleAnalyses(ctx, mockDS, AnalysisModeJoke)
+	if err != nil {
+		t.Fatalf("PurgeStaleAnalyses returned error: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("deleted = %d, want 1", deleted)
+	}
+	if _, found, _ := mockDS.ReadAnalysisResult(ctx, "example.com/news/old", AnalysisModeJoke); found {
+		t.Error("expected stale result to be deleted")
+	}
+	if _, found, _ := mockDS.ReadAnalysisResult(ctx, "example.com/current", AnalysisModeJoke); !found {
+		t.Error("expected current result to be kept")
+	}
+}
+
+func TestBackfillPendingAnalyses(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	now := time.Now()
+	for i, url := range []string{"example.com/a", "example.com/b"} {
+		mockDS.WriteCrawledPage(ctx, url, "Title", "Content", now)
+		mockDS.WritePendingAnalysis(ctx, &models.PendingAnalysis{
+			URL: url, Mode: AnalysisModeJoke, Feed: "https://example.com/feed.xml",
+			Attempts: 1, CreatedAt: now.Add(time.Duration(i) * time.Second),
+		})
+	}
+	// A pending analysis whose page was deleted is dropped
+	mockDS.WritePendingAnalysis(ctx, &models.PendingAnalysis{
+		URL: "example.com/gone", Mode: AnalysisModeJoke, Attempts: 1, CreatedAt: now.Add(time.Minute),
+	})
+
+	client := &countingLlmClient{}
+	result, err := backfillPendingAnalyses(ctx, 0, PageSelector{}, LanguagePolicyAsIs, 0, mockDS, false,
+		func(mode AnalysisMode) (LlmClient, error) { return client, nil })
+	if err != nil {
+		t.Fatalf("backfillPendingAnalyses() error = %v", err)
+	}
+	if result.Analyzed != 2 || result.Failed != 1 || result.Remaining != 0 {
+		t.Errorf("Expected 2 analyzed, 1 failed, 0 remaining, got %+v", result)
+	}
+
+	pending, _ := mockDS.ListPendingAnalyses(ctx)
+	if len(pending) != 0 {
+		t.Errorf("Expected no pending analyses left, got %d", len(pending))
+	}
+	saved, found, _ := mockDS.ReadAnalysisResult(ctx, "example.com/a", AnalysisModeJoke)
+	if !found || saved.Feed != "https://example.com/feed.xml" {
+		t.Errorf("Expected analysis with feed attribution to be saved, got %+v", saved)
+	}
+}
+
+func TestBackfillPendingAnalyses_StopsWhenLlmUnavailable(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	now := time.Now()
+	for i, url := range []string{"example.com/a", "example.com/b", "example.com/c"} {
+		mockDS.WriteCrawledPage(ctx, url, "Title", "Content", now)
+		mockDS.WritePendingAnalysis(ctx, &models.PendingAnalysis{
+			URL: url, Mode: AnalysisModeJoke, Attempts: 1, CreatedAt: now.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	client := &countingLlmClient{err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	result, err := backfillPendingAnalyses(ctx, 0, PageSelector{}, LanguagePolicyAsIs, 0, mockDS, false,
+		func(mode AnalysisMode) (LlmClient, error) { return client, nil })
+	if err != nil {
+		t.Fatalf("backfillPendingAnalyses() error = %v", err)
+	}
+	if result.Remaining != 3 || client.calls != 1 {
+		t.Errorf("Expected 3 remaining after 1 call, got %+v after %d call(s)", result, client.calls)
+	}
+
+	pending, _ := mockDS.ListPendingAnalyses(ctx)
+	if len(pending) != 3 {
+		t.Errorf("Expected 3 pending analyses kept, got %d", len(pending))
+	}
+}
+
+func TestBackfillPendingAnalyses_Selector(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	now := time.Now()
+	for i, url := range []string{"example.com/a", "other.com/b"} {
+		mockDS.WriteCrawledPage(ctx, url, "Title", "Content", now)
+		mockDS.WritePendingAnalysis(ctx, &models.PendingAnalysis{
+			URL: url, Mode: AnalysisModeJoke, Attempts: 1, CreatedAt: now.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	client := &countingLlmClient{}
+	result, err := backfillPendingAnalyses(ctx, 0, PageSelector{Domain: "example.com"}, LanguagePolicyAsIs, 0, mockDS, false,
+		func(mode AnalysisMode) (LlmClient, error) { return client, nil })
+	if err != nil {
+		t.Fatalf("backfillPendingAnalyses() error = %v", err)
+	}
+	if result.Analyzed != 1 || result.Skipped != 1 || client.calls != 1 {
+		t.Errorf("Expected 1 analyzed and 1 skipped, got %+v after %d call(s)", result, client.calls)
+	}
+
+	pending, _ := mockDS.ListPendingAnalyses(ctx)
+	if len(pending) != 1 || pending[0].URL != "other.com/b" {
+		t.Errorf("Expected the unselected analysis to stay pending, got %+v", pending)
+	}
+}
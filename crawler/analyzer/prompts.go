@@ -4,84 +4,353 @@ import (
 	_ "embed"
 	"fmt"
 	"hash/fnv"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
+	openai "github.com/openai/openai-go/v3"
 	"github.com/zeace/poisson/models"
 )
 
-const maxContentLength = 8000
-
 type AnalysisMode = models.AnalysisMode
 
 const (
 	AnalysisModeJoke AnalysisMode = "joke"
 	AnalysisModeTest AnalysisMode = "test"
+	// AnalysisModeHeadline is a cheap title-only joke screening (see HeadlineScreening).
+	AnalysisModeHeadline AnalysisMode = "headline"
 )
 
 //go:embed prompts/joke.prompt.md
 var JokePromptTemplate string
 
+//go:embed prompts/joke.reduce.prompt.md
+var JokeReducePromptTemplate string
+
 //go:embed prompts/test.prompt.md
 var TestPromptTemplate string
 
-// PromptConfig holds the template and processing function for a prompt mode.
+//go:embed prompts/headline.prompt.md
+var HeadlinePromptTemplate string
+
+// PromptConfig holds the template, model, response schema and processing function for a prompt mode.
 type PromptConfig struct {
-	Template        string
+	// Description tells clients what the mode analyzes (see ListModes).
+	Description string
+	Template    string
+	// LocalizedTemplates are templates used instead of Template for pages in a language, by
+	// ISO 639-1 code (see LoadPromptTemplates).
+	LocalizedTemplates map[string]string
+	// Version is bumped whenever a change to the mode's prompt, schema or response processing
+	// should invalidate cached analyses, even if the template text is unchanged.
+	Version int
+	// Model is the default LLM model for this mode. It can be overridden with the --model flag.
+	Model string
+	// Schema is the JSON schema the LLM response must follow.
+	Schema ResponseSchema
+	// Generation holds the default system prompt and sampling parameters for the mode.
+	// Individual fields can be overridden with CLI flags.
+	Generation      GenerationParams
 	ProcessResponse func(string, int) (*models.AnalysisResult, error)
+	// MaxContentLength is the number of characters of content sent in one prompt. Zero means
+	// the limit of the model (see ModelMaxContentLengths).
+	MaxContentLength int
+	// MinContentLength is the number of characters of content below which pages are skipped
+	// instead of analyzed (see ErrContentTooShort). Zero means no minimum.
+	MinContentLength int
+	// MinWordCount is the number of words of content below which pages are skipped, like
+	// MinContentLength. Zero means no minimum.
+	MinWordCount int
+	// CombineResults merges the results of the chunks of an article too long for one prompt.
+	// If nil, long articles are truncated to the content length limit instead.
+	CombineResults func([]*models.AnalysisResult) *models.AnalysisResult
+	// ReducePrompt, if set, returns a prompt asking the LLM to combine the results of the chunks
+	// of an article into one verdict in Schema, which replaces CombineResults. CombineResults is
+	// still used if the reduction fails.
+	ReducePrompt func(title string, results []*models.AnalysisResult) string
+	// ReduceTemplate is the template of ReducePrompt, part of the prompt fingerprint.
+	ReduceTemplate string
+	// AggregateResults merges the results of the runs of an ensemble (see EnsembleOptions).
+	// If nil, the mode is analyzed once, by the first model of the ensemble.
+	AggregateResults func([]*models.AnalysisResult, EnsembleMethod) *models.AnalysisResult
 }
 
 var PromptTemplates = map[AnalysisMode]PromptConfig{
 	AnalysisModeJoke: {
-		Template:        JokePromptTemplate,
-		ProcessResponse: ProcessJokeResponse,
+		Description:      "Confidence that a news article is a joke, prank or satire rather than real news",
+		Template:         JokePromptTemplate,
+		Version:          2, // 2: long articles combined by ReducePrompt instead of their highest chunk score
+		Model:            openai.ChatModelGPT4o,
+		Schema:           JokeResponseSchema,
+		Generation:       GenerationParams{Temperature: Float64Ptr(0)}, // Reproducible joke scores
+		ProcessResponse:  ProcessJokeResponse,
+		CombineResults:   CombineJokeResults,
+		ReducePrompt:     JokeReducePrompt,
+		ReduceTemplate:   JokeReducePromptTemplate,
+		AggregateResults: AggregateJokeResults,
 	},
 	AnalysisModeTest: {
+		Description:     "Placeholder prompt used by tests and to check the LLM setup",
 		Template:        TestPromptTemplate,
+		Version:         1,
+		Model:           openai.ChatModelGPT4oMini,
+		Schema:          TestResponseSchema,
 		ProcessResponse: ProcessTestResponse,
 	},
+	AnalysisModeHeadline: {
+		Description:     "Quick title-only screening of whether an article could be a joke, used to skip full joke analyses of obviously serious articles",
+		Template:        HeadlinePromptTemplate,
+		Version:         1,
+		Model:           openai.ChatModelGPT4oMini,
+		Schema:          JokeResponseSchema,
+		Generation:      GenerationParams{Temperature: Float64Ptr(0)},
+		ProcessResponse: ProcessHeadlineResponse,
+	},
+}
+
+// promptTemplatesMu guards PromptTemplates, whose templates can be reloaded while analyses run
+// (see WatchPromptTemplates). Code outside of tests and startup reads it through
+// lookupPromptConfig and promptConfigs.
+var promptTemplatesMu sync.RWMutex
+
+// lookupPromptConfig returns the PromptConfig of mode, and whether the mode exists.
+func lookupPromptConfig(mode AnalysisMode) (PromptConfig, bool) {
+	promptTemplatesMu.RLock()
+	defer promptTemplatesMu.RUnlock()
+	config, ok := PromptTemplates[mode]
+	return config, ok
+}
+
+// promptConfigs returns a copy of PromptTemplates.
+func promptConfigs() map[AnalysisMode]PromptConfig {
+	promptTemplatesMu.RLock()
+	defer promptTemplatesMu.RUnlock()
+	configs := make(map[AnalysisMode]PromptConfig, len(PromptTemplates))
+	for mode, config := range PromptTemplates {
+		configs[mode] = config
+	}
+	return configs
+}
+
+// ModeInfo describes an analysis mode for clients choosing a mode.
+type ModeInfo struct {
+	Name        AnalysisMode `json:"name"`
+	Description string       `json:"description"`
+	// Fingerprint and Version identify the current prompt; cached analyses with other values are stale.
+	Fingerprint int `json:"fingerprint"`
+	Version     int `json:"version"`
+	// Model is the mode's default LLM model.
+	Model string `json:"model"`
+	// MaxContentLength is the number of characters of content sent in one prompt with Model.
+	MaxContentLength int `json:"max_content_length"`
+	// MinContentLength is the number of characters of content below which pages are skipped.
+	MinContentLength int `json:"min_content_length"`
+	// MinWordCount is the number of words of content below which pages are skipped.
+	MinWordCount int `json:"min_word_count"`
+	// Languages are the codes of the languages with a localized template, sorted.
+	Languages []string `json:"languages,omitempty"`
+}
+
+// ListModes returns the valid analysis modes sorted by name, with the fingerprint of the
+// templates in use, including templates loaded with LoadPromptTemplates.
+func ListModes() []ModeInfo {
+	configs := promptConfigs()
+	modes := make([]ModeInfo, 0, len(configs))
+	for mode, config := range configs {
+		fingerprint, _ := GeneratePromptFingerprint(mode) // mode exists
+		model, _ := ResolveModel(mode, "")
+		modes = append(modes, ModeInfo{
+			Name:        mode,
+			Description: config.Description,
+			Fingerprint: fingerprint,
+			Version:     config.Version,
+			Model:       model,
+
+			MaxContentLength: modeMaxContentLength(config, model),
+			MinContentLength: config.MinContentLength,
+			MinWordCount:     config.MinWordCount,
+			Languages:        localizedLanguages(config),
+		})
+	}
+	sort.Slice(modes, func(i, j int) bool { return modes[i].Name < modes[j].Name })
+	return modes
+}
+
+// localizedLanguages returns the codes of the languages config has a localized template for,
+// sorted, or nil if it has none.
+func localizedLanguages(config PromptConfig) []string {
+	var languages []string
+	for lang := range config.LocalizedTemplates {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// ModeNames returns the names of the valid analysis modes, sorted.
+func ModeNames() []string {
+	modes := ListModes()
+	names := make([]string, 0, len(modes))
+	for _, mode := range modes {
+		names = append(names, string(mode.Name))
+	}
+	return names
 }
 
 // VerifyValidMode checks if the given mode is valid (exists in PromptTemplates).
 func VerifyValidMode(mode string) (AnalysisMode, error) {
 	analysisMode := AnalysisMode(strings.ToLower(mode))
-	_, ok := PromptTemplates[analysisMode]
+	_, ok := lookupPromptConfig(analysisMode)
 	if !ok {
 		return "", fmt.Errorf("unknown mode '%s'", mode)
 	}
 	return analysisMode, nil
 }
 
+// ResolveModel returns the model to use for the given mode.
+// A non-empty override (e.g. from the --model flag) takes precedence over the mode's configured model.
+func ResolveModel(mode AnalysisMode, override string) (string, error) {
+	config, ok := lookupPromptConfig(mode)
+	if !ok {
+		return "", fmt.Errorf("unknown mode '%s'", mode)
+	}
+	if override != "" {
+		return override, nil
+	}
+	if config.Model != "" {
+		return config.Model, nil
+	}
+	return openai.ChatModelGPT4o, nil
+}
+
 // AddBodyToPrompt merges the title and body content into the prompt template.
 func AddBodyToPrompt(template, title, body string) string {
 	return fmt.Sprintf(template, title, body)
 }
 
 // GeneratePromptFingerprint generates an int fingerprint based on the template text for a given mode.
+// The mode's system prompt and reduction template, if any, the GenerationOverrides and the joke
+// keywords in joke mode are part of the fingerprint.
 func GeneratePromptFingerprint(mode AnalysisMode) (int, error) {
-	config, ok := PromptTemplates[mode]
+	config, ok := lookupPromptConfig(mode)
 	if !ok {
 		return 0, fmt.Errorf("unknown mode '%s'", mode)
 	}
+	return templateFingerprint(mode, config.Template), nil
+}
+
+// templateFingerprint returns the prompt fingerprint of mode with template instead of the
+// mode's own template (see GeneratePromptFingerprint). mode must exist.
+func templateFingerprint(mode AnalysisMode, template string) int {
+	config, _ := lookupPromptConfig(mode)
 
 	// Use FNV-1a hash for 64-bit fingerprint, then convert to int
 	h := fnv.New64a()
-	h.Write([]byte(config.Template))
-	return int(h.Sum64()), nil
+	h.Write([]byte(template))
+	if config.Generation.SystemPrompt != "" {
+		h.Write([]byte{0})
+		h.Write([]byte(config.Generation.SystemPrompt))
+	}
+	if config.ReducePrompt != nil {
+		h.Write([]byte{2})
+		h.Write([]byte(config.ReduceTemplate))
+	}
+	if overrides := GenerationOverrides.fingerprint(); overrides != "" {
+		h.Write([]byte{3})
+		h.Write([]byte(overrides))
+	}
+	if keywords := JokeScoring.fingerprint(); mode == AnalysisModeJoke && keywords != "" {
+		h.Write([]byte{1})
+		h.Write([]byte(keywords))
+	}
+	return int(h.Sum64())
+}
+
+// localizedTemplate returns the template of mode for pages in lang, if the mode has one.
+func localizedTemplate(mode AnalysisMode, lang string) (string, bool) {
+	config, ok := lookupPromptConfig(mode)
+	if !ok || lang == "" {
+		return "", false
+	}
+	template, ok := config.LocalizedTemplates[lang]
+	return template, ok
+}
+
+// PromptVersion returns the current prompt version for the given mode.
+func PromptVersion(mode AnalysisMode) (int, error) {
+	config, ok := lookupPromptConfig(mode)
+	if !ok {
+		return 0, fmt.Errorf("unknown mode '%s'", mode)
+	}
+	return config.Version, nil
+}
+
+// IsStale reports whether a stored analysis was made with a different prompt than the current one
+// for its mode, i.e. its prompt fingerprint or version doesn't match.
+// Results stored before prompts were versioned count as version 1. Results made with a variant
+// of the running experiment of their mode are compared with the variant's prompt, and results
+// in a language with a localized template with that template.
+func IsStale(result *models.AnalysisResult) (bool, error) {
+	fingerprint, err := GeneratePromptFingerprint(result.Mode)
+	if err != nil {
+		return false, err
+	}
+	if variant, ok := variantFingerprint(result); ok {
+		fingerprint = variant
+	} else if template, ok := localizedTemplate(result.Mode, result.Language); ok {
+		fingerprint = templateFingerprint(result.Mode, template)
+	}
+	version, err := PromptVersion(result.Mode)
+	if err != nil {
+		return false, err
+	}
+
+	resultVersion := result.PromptVersion
+	if resultVersion == 0 {
+		resultVersion = 1
+	}
+	return result.PromptFingerprint != fingerprint || resultVersion != version, nil
+}
+
+// ModelChanged reports whether a stored analysis was made by a different model or provider than
+// llmClient's. Results that don't record a model or provider match any, so analyses stored before
+// these were recorded aren't redone.
+func ModelChanged(result *models.AnalysisResult, llmClient LlmClient) bool {
+	if result.Model != "" && llmClient.Model() != "" && result.Model != llmClient.Model() {
+		return true
+	}
+	return result.Provider != "" && result.Provider != llmClient.Provider()
+}
+
+// Expired reports whether a stored analysis is older than maxAge at now. A zero maxAge means
+// analyses never expire; otherwise results that don't record when they were made are expired.
+func Expired(result *models.AnalysisResult, maxAge time.Duration, now time.Time) bool {
+	if maxAge <= 0 {
+		return false
+	}
+	return result.AnalyzedAt.IsZero() || now.Sub(result.AnalyzedAt) > maxAge
 }
 
 // GeneratePrompt generates a prompt by selecting the appropriate template based on mode
-// and merging it with the provided title and content. Content is truncated if it exceeds maxContentLength.
+// and merging it with the provided title and content. Content is truncated if it exceeds the
+// content length limit of the mode with its default model.
 func GeneratePrompt(mode AnalysisMode, title, content string) (string, error) {
-	config, ok := PromptTemplates[mode]
+	config, ok := lookupPromptConfig(mode)
 	if !ok {
 		return "", fmt.Errorf("unknown mode '%s'", mode)
 	}
+	model, _ := ResolveModel(mode, "")
+	return generatePrompt(config.Template, title, content, modeMaxContentLength(config, model)), nil
+}
 
+// generatePrompt merges title and content into template, truncating content that exceeds maxLength.
+func generatePrompt(template, title, content string, maxLength int) string {
 	// Truncate content if too long
 	truncatedContent := content
-	if len(truncatedContent) > maxContentLength {
-		truncatedContent = truncatedContent[:maxContentLength] + "... [content truncated]"
+	if len(truncatedContent) > maxLength {
+		truncatedContent = truncatedContent[:maxLength] + "... [content truncated]"
 	}
 
-	return AddBodyToPrompt(config.Template, title, truncatedContent), nil
+	return AddBodyToPrompt(template, title, truncatedContent)
 }
@@ -3,6 +3,9 @@ package analyzer
 import (
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/zeace/poisson/models"
 )
 
 func TestVerifyValidMode(t *testing.T) {
@@ -141,8 +144,10 @@ func TestGeneratePrompt_InvalidMode(t *testing.T) {
 }
 
 func TestGeneratePrompt_ContentTruncation(t *testing.T) {
-	// Create content longer than maxContentLength
-	longContent := strings.Repeat("a", maxContentLength+1000)
+	// Create content longer than the limit of the joke mode's model
+	config := PromptTemplates[AnalysisModeJoke]
+	maxLength := modeMaxContentLength(config, config.Model)
+	longContent := strings.Repeat("a", maxLength+1000)
 
 	prompt, err := GeneratePrompt(AnalysisModeJoke, "Test Title", longContent)
 	if err != nil {
@@ -156,7 +161,7 @@ func TestGeneratePrompt_ContentTruncation(t *testing.T) {
 
 	// Check that the prompt doesn't exceed reasonable length
 	// (template + truncated content + marker)
-	if len(prompt) > len(JokePromptTemplate)+maxContentLength+100 {
+	if len(prompt) > len(JokePromptTemplate)+maxLength+100 {
 		t.Errorf("Prompt seems too long, length: %d", len(prompt))
 	}
 }
@@ -234,3 +239,119 @@ func TestPromptTemplates_AllModesPresent(t *testing.T) {
 		}
 	}
 }
+
+func TestResolveModel(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     AnalysisMode
+		override string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "joke mode default",
+			mode:     AnalysisModeJoke,
+			expected: "gpt-4o",
+		},
+		{
+			name:     "test mode default",
+			mode:     AnalysisModeTest,
+			expected: "gpt-4o-mini",
+		},
+		{
+			name:     "override wins over mode default",
+			mode:     AnalysisModeTest,
+			override: "llama-3-8b",
+			expected: "llama-3-8b",
+		},
+		{
+			name:    "unknown mode",
+			mode:    AnalysisMode("invalid"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := ResolveModel(tt.mode, tt.override)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveModel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if model != tt.expected {
+				t.Errorf("ResolveModel() = %q, want %q", model, tt.expected)
+			}
+		})
+	}
+}
+
+func TestModelChanged(t *testing.T) {
+	client := &MockLlmClient{ModelName: "gpt-4o"}
+	tests := []struct {
+		name     string
+		result   *models.AnalysisResult
+		expected bool
+	}{
+		{"same model and provider", &models.AnalysisResult{Model: "gpt-4o", Provider: "openai"}, false},
+		{"different model", &models.AnalysisResult{Model: "llama-3-8b", Provider: "openai"}, true},
+		{"different provider", &models.AnalysisResult{Model: "gpt-4o", Provider: "localhost:8000"}, true},
+		{"provider not recorded", &models.AnalysisResult{Model: "gpt-4o"}, false},
+		{"nothing recorded", &models.AnalysisResult{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ModelChanged(tt.result, client); got != tt.expected {
+				t.Errorf("ModelChanged() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		analyzedAt time.Time
+		maxAge     time.Duration
+		expected   bool
+	}{
+		{"no max age", now.Add(-365 * 24 * time.Hour), 0, false},
+		{"within max age", now.Add(-time.Hour), 24 * time.Hour, false},
+		{"older than max age", now.Add(-48 * time.Hour), 24 * time.Hour, true},
+		{"time not recorded", time.Time{}, 24 * time.Hour, true},
+		{"time not recorded, no max age", time.Time{}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &models.AnalysisResult{AnalyzedAt: tt.analyzedAt}
+			if got := Expired(result, tt.maxAge, now); got != tt.expected {
+				t.Errorf("Expired() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestListModes(t *testing.T) {
+	modes := ListModes()
+	if len(modes) != len(PromptTemplates) {
+		t.Fatalf("ListModes() returned %d modes, want %d", len(modes), len(PromptTemplates))
+	}
+	for i, mode := range modes {
+		if i > 0 && modes[i-1].Name >= mode.Name {
+			t.Errorf("modes not sorted by name: %q before %q", modes[i-1].Name, mode.Name)
+		}
+		fingerprint, _ := GeneratePromptFingerprint(mode.Name)
+		if mode.Fingerprint != fingerprint {
+			t.Errorf("%s fingerprint = %d, want %d", mode.Name, mode.Fingerprint, fingerprint)
+		}
+		if mode.Description == "" || mode.Model == "" || mode.Version == 0 {
+			t.Errorf("%s is missing a description, model or version: %+v", mode.Name, mode)
+		}
+	}
+
+	names := ModeNames()
+	if len(names) != 3 || names[0] != "headline" || names[1] != "joke" || names[2] != "test" {
+		t.Errorf("ModeNames() = %v, want [headline joke test]", names)
+	}
+}
@@ -0,0 +1,64 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/zeace/poisson/models"
+)
+
+// jsonRepairPrompt asks the LLM to correct a response that could not be processed.
+// It takes the processing error and the original response.
+const jsonRepairPrompt = `Your previous response could not be processed: %s
+
+Previous response:
+%s
+
+Reply with only the corrected JSON object matching the required schema. Keep the content of your answer unchanged.`
+
+// processResponse validates a raw LLM response against the mode's schema and converts it
+// with the mode's processing function.
+func processResponse(rawResponse string, config PromptConfig, fingerprint int) (*models.AnalysisResult, error) {
+	jsonStr, err := validateResponse(rawResponse, config.Schema)
+	if err != nil {
+		return nil, err
+	}
+	return config.ProcessResponse(jsonStr, fingerprint)
+}
+
+// processWithRepair processes the LLM response and, if that fails, asks the LLM once to correct
+// its output before giving up. It returns the result and the usage of all LLM calls made,
+// including the one that produced response.
+func processWithRepair(
+	ctx context.Context,
+	response LlmResponse,
+	llmClient LlmClient,
+	config PromptConfig,
+	fingerprint int,
+	verbose bool,
+) (*models.AnalysisResult, LlmUsage, error) {
+	usage := response.Usage
+	result, err := processResponse(response.Content, config, fingerprint)
+	if err == nil {
+		return result, usage, nil
+	}
+
+	if verbose {
+		slog.InfoContext(ctx, "Malformed LLM response, asking for a correction", "error", err)
+	}
+	repairPrompt := fmt.Sprintf(jsonRepairPrompt, err, response.Content)
+	repaired, repairErr := llmClient.Analyze(ctx, repairPrompt, &config.Schema, config.Generation)
+	if repairErr != nil {
+		return nil, usage, fmt.Errorf("%w (repair failed: %v)", err, repairErr)
+	}
+	usage.PromptTokens += repaired.Usage.PromptTokens
+	usage.CompletionTokens += repaired.Usage.CompletionTokens
+
+	result, repairErr = processResponse(repaired.Content, config, fingerprint)
+	if repairErr != nil {
+		return nil, usage, fmt.Errorf("%w (repair failed: %v)", err, repairErr)
+	}
+	slog.InfoContext(ctx, "Repaired malformed LLM response")
+	return result, usage, nil
+}
@@ -0,0 +1,71 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestAnalyze_RepairsMalformedResponse(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	page := &models.CrawledPage{URL: "example.com/repair", Title: "Title", Content: "Content"}
+	mockLLM := &MockLlmClient{
+		Responses: []string{
+			`{"is_joke": true, "confidence": 80`,
+			`{"is_joke": true, "confidence": 80, "reasoning": "Absurd claims"}`,
+		},
+		Usage:     LlmUsage{PromptTokens: 100, CompletionTokens: 10},
+		ModelName: "gpt-4o",
+	}
+
+	result, err := analyze(ctx, page, mockLLM, AnalysisModeJoke, mockDS, false)
+	if err != nil {
+		t.Fatalf("analyze() error = %v, want nil", err)
+	}
+	if mockLLM.Calls != 2 {
+		t.Errorf("Expected 2 LLM calls, got %d", mockLLM.Calls)
+	}
+	if !strings.Contains(mockLLM.LastPrompt, `{"is_joke": true, "confidence": 80`) {
+		t.Errorf("Expected repair prompt to contain the original output, got %q", mockLLM.LastPrompt)
+	}
+	if result.JokePercentage == nil || *result.JokePercentage != 80 {
+		t.Errorf("Expected JokePercentage = 80, got %v", result.JokePercentage)
+	}
+	if result.PromptTokens != 200 || result.CompletionTokens != 20 {
+		t.Errorf("Expected usage of both calls (200, 20), got (%d, %d)", result.PromptTokens, result.CompletionTokens)
+	}
+}
+
+func TestAnalyze_RepairGivesUpAfterOneAttempt(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	page := &models.CrawledPage{URL: "example.com/broken", Title: "Title", Content: "Content"}
+	mockLLM := &MockLlmClient{Response: "not json at all"}
+
+	if _, err := analyze(ctx, page, mockLLM, AnalysisModeJoke, mockDS, false); err == nil {
+		t.Fatal("analyze() error = nil, want error")
+	}
+	if mockLLM.Calls != 2 {
+		t.Errorf("Expected 2 LLM calls, got %d", mockLLM.Calls)
+	}
+	if _, found, _ := mockDS.ReadAnalysisResult(ctx, page.URL, AnalysisModeJoke); found {
+		t.Error("Expected no result to be saved")
+	}
+}
+
+func TestProcessWithRepair_RepairCallFails(t *testing.T) {
+	mockLLM := &MockLlmClient{Error: errors.New("connection reset")}
+	config := PromptTemplates[AnalysisModeJoke]
+
+	_, _, err := processWithRepair(context.Background(), LlmResponse{Content: "{"}, mockLLM, config, 1, false)
+	if err == nil || !strings.Contains(err.Error(), "repair failed: connection reset") {
+		t.Errorf("Expected error mentioning the failed repair, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ResponseSchema describes the JSON object the LLM must return for a mode.
+// Schema is a JSON Schema object in the subset supported by OpenAI structured outputs.
+type ResponseSchema struct {
+	Name   string
+	Schema map[string]any
+}
+
+// objectSchema builds a strict JSON Schema for an object whose properties are all required.
+// properties maps each property name to its JSON type ("string", "integer", "number" or "boolean").
+func objectSchema(properties map[string]string) map[string]any {
+	props := make(map[string]any, len(properties))
+	required := make([]string, 0, len(properties))
+	for name, typ := range properties {
+		props[name] = map[string]any{"type": typ}
+		required = append(required, name)
+	}
+	sort.Strings(required)
+
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// Validate checks that jsonStr is a JSON object matching the schema.
+// Only the subset of JSON Schema produced by objectSchema is checked: property types,
+// required properties and additionalProperties.
+func (s ResponseSchema) Validate(jsonStr string) error {
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(jsonStr), &obj); err != nil {
+		return fmt.Errorf("response is not a JSON object: %w", err)
+	}
+
+	properties, _ := s.Schema["properties"].(map[string]any)
+
+	if required, ok := s.Schema["required"].([]string); ok {
+		for _, name := range required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("response is missing required field %q", name)
+			}
+		}
+	}
+
+	for name, value := range obj {
+		property, ok := properties[name].(map[string]any)
+		if !ok {
+			if additional, ok := s.Schema["additionalProperties"].(bool); ok && !additional {
+				return fmt.Errorf("response has unexpected field %q", name)
+			}
+			continue
+		}
+		typ, _ := property["type"].(string)
+		if !matchesJSONType(value, typ) {
+			return fmt.Errorf("response field %q must be of type %s", name, typ)
+		}
+	}
+
+	return nil
+}
+
+// matchesJSONType reports whether a value decoded by encoding/json has the given JSON Schema type.
+func matchesJSONType(value any, typ string) bool {
+	switch typ {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	case "":
+		return true
+	default:
+		return false
+	}
+}
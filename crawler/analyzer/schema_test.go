@@ -0,0 +1,100 @@
+package analyzer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestResponseSchema_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{
+			name:  "valid joke response",
+			input: `{"is_joke": true, "confidence": 85, "reasoning": "Clearly satire"}`,
+		},
+		{
+			name:    "not JSON",
+			input:   `Here is the analysis: {"is_joke": true}`,
+			wantErr: "not a JSON object",
+		},
+		{
+			name:    "missing required field",
+			input:   `{"is_joke": true, "confidence": 85}`,
+			wantErr: `missing required field "reasoning"`,
+		},
+		{
+			name:    "wrong type",
+			input:   `{"is_joke": "yes", "confidence": 85, "reasoning": "Satire"}`,
+			wantErr: `field "is_joke" must be of type boolean`,
+		},
+		{
+			name:    "fractional integer",
+			input:   `{"is_joke": true, "confidence": 85.5, "reasoning": "Satire"}`,
+			wantErr: `field "confidence" must be of type integer`,
+		},
+		{
+			name:    "unexpected field",
+			input:   `{"is_joke": true, "confidence": 85, "reasoning": "Satire", "extra": 1}`,
+			wantErr: `unexpected field "extra"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := JokeResponseSchema.Validate(tt.input)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateResponse_RepairsWrappedJSON(t *testing.T) {
+	input := "```json\n{\"is_joke\": false, \"confidence\": 90, \"reasoning\": \"Serious\"}\n```"
+	result, err := validateResponse(input, JokeResponseSchema)
+	if err != nil {
+		t.Fatalf("validateResponse() error = %v, want nil", err)
+	}
+	if result != `{"is_joke": false, "confidence": 90, "reasoning": "Serious"}` {
+		t.Errorf("validateResponse() = %q", result)
+	}
+}
+
+func TestAnalyze_RejectsResponseNotMatchingSchema(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	page := &models.CrawledPage{
+		URL:     "example.com/article",
+		Title:   "Test Article",
+		Content: "Test content",
+	}
+
+	mockLLM := &MockLlmClient{Response: `{"is_joke": true, "confidence": "high"}`}
+	_, err := analyze(ctx, page, mockLLM, AnalysisModeJoke, mockDS, false)
+	if err == nil {
+		t.Fatal("Expected error for response not matching schema, got nil")
+	}
+	if !strings.Contains(err.Error(), "joke_analysis schema") {
+		t.Errorf("Expected schema error, got: %v", err)
+	}
+	if mockLLM.LastSchema == nil || mockLLM.LastSchema.Name != "joke_analysis" {
+		t.Errorf("Expected joke schema to be passed to the LLM client, got %v", mockLLM.LastSchema)
+	}
+	if len(mockDS.AnalysisResults) != 0 {
+		t.Error("Expected invalid response not to be cached")
+	}
+}
@@ -0,0 +1,269 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// PageSelector selects stored pages for bulk operations. Its zero value selects every page.
+type PageSelector struct {
+	// Domain selects the pages of a host and its subdomains.
+	Domain string
+	// Since and Until select the pages crawled at or after Since and before Until. A zero time
+	// means no bound.
+	Since time.Time
+	Until time.Time
+	// Language selects the pages detected to be in a language (ISO 639-1 code).
+	Language string
+	// HasNoAnalysis selects the pages without an analysis in the mode of the operation.
+	HasNoAnalysis bool
+	// MinLength selects the pages whose content has at least this many characters.
+	MinLength int
+}
+
+// pageSelectorFields are the fields of a selector expression.
+var pageSelectorFields = []string{"domain", "since", "until", "language", "hasNoAnalysis", "minLength"}
+
+// ParsePageSelector parses a selector expression written like GraphQL arguments, e.g.
+// {domain: "example.com", since: "2025-03-01", language: "fr", hasNoAnalysis: true, minLength: 2000}.
+// The braces and the quotes around values without spaces or commas are optional. Dates are
+// YYYY-MM-DD (midnight UTC) or RFC 3339.
+func ParsePageSelector(expr string) (PageSelector, error) {
+	var selector PageSelector
+	s := strings.TrimSpace(expr)
+	if strings.HasPrefix(s, "{") {
+		if !strings.HasSuffix(s, "}") {
+			return selector, fmt.Errorf("invalid selector %q: missing }", expr)
+		}
+		s = s[1 : len(s)-1]
+	}
+
+	seen := make(map[string]bool)
+	for s = trimSelectorSeparators(s); s != ""; s = trimSelectorSeparators(s) {
+		name, rest, ok := strings.Cut(s, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return selector, fmt.Errorf("invalid selector %q: expected <field>: <value>", expr)
+		}
+		if seen[name] {
+			return selector, fmt.Errorf("invalid selector %q: %s is set twice", expr, name)
+		}
+		seen[name] = true
+
+		value, rest, err := selectorValue(strings.TrimSpace(rest))
+		if err != nil {
+			return selector, fmt.Errorf("invalid selector %q: %s: %w", expr, name, err)
+		}
+		if err := selector.set(name, value); err != nil {
+			return selector, fmt.Errorf("invalid selector %q: %w", expr, err)
+		}
+		s = rest
+	}
+	if err := selector.Normalize(); err != nil {
+		return selector, fmt.Errorf("invalid selector %q: %w", expr, err)
+	}
+	return selector, nil
+}
+
+// trimSelectorSeparators removes the spaces and commas at the start of s.
+func trimSelectorSeparators(s string) string {
+	return strings.TrimLeft(s, " \t\r\n,")
+}
+
+// selectorValue returns the value at the start of s, quoted or up to the next separator, and
+// the rest of s.
+func selectorValue(s string) (string, string, error) {
+	if strings.HasPrefix(s, `"`) {
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		value, _ := strconv.Unquote(quoted)
+		return value, s[len(quoted):], nil
+	}
+	end := strings.IndexAny(s, " \t\r\n,")
+	if end < 0 {
+		end = len(s)
+	}
+	if end == 0 {
+		return "", "", fmt.Errorf("missing value")
+	}
+	return s[:end], s[end:], nil
+}
+
+// set sets the field of the selector named name from its expression value.
+func (s *PageSelector) set(name, value string) error {
+	var err error
+	switch name {
+	case "domain":
+		s.Domain = value
+	case "since":
+		s.Since, err = ParseSelectorDate(value)
+	case "until":
+		s.Until, err = ParseSelectorDate(value)
+	case "language":
+		s.Language = value
+	case "hasNoAnalysis":
+		s.HasNoAnalysis, err = strconv.ParseBool(value)
+	case "minLength":
+		s.MinLength, err = strconv.Atoi(value)
+	default:
+		return fmt.Errorf("unknown field %q (valid: %s)", name, strings.Join(pageSelectorFields, ", "))
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", name, value)
+	}
+	return nil
+}
+
+// ParseSelectorDate parses a selector date: YYYY-MM-DD for midnight UTC, or RFC 3339.
+func ParseSelectorDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q (expected YYYY-MM-DD or RFC3339)", value)
+	}
+	return t, nil
+}
+
+// Normalize lowercases the domain and language of the selector and checks its fields.
+func (s *PageSelector) Normalize() error {
+	s.Domain = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s.Domain)), "*"), ".")
+	s.Language = strings.ToLower(strings.TrimSpace(s.Language))
+	if strings.ContainsAny(s.Domain, "/:") {
+		return fmt.Errorf("invalid domain %q: expected a host name", s.Domain)
+	}
+	if s.MinLength < 0 {
+		return fmt.Errorf("minLength must not be negative")
+	}
+	if !s.Since.IsZero() && !s.Until.IsZero() && !s.Since.Before(s.Until) {
+		return fmt.Errorf("since must be before until")
+	}
+	return nil
+}
+
+// IsZero reports whether the selector selects every page.
+func (s PageSelector) IsZero() bool {
+	return s == PageSelector{}
+}
+
+// String returns the selector as an expression parsed by ParsePageSelector.
+func (s PageSelector) String() string {
+	var fields []string
+	if s.Domain != "" {
+		fields = append(fields, fmt.Sprintf("domain: %q", s.Domain))
+	}
+	if !s.Since.IsZero() {
+		fields = append(fields, fmt.Sprintf("since: %q", s.Since.Format(time.RFC3339)))
+	}
+	if !s.Until.IsZero() {
+		fields = append(fields, fmt.Sprintf("until: %q", s.Until.Format(time.RFC3339)))
+	}
+	if s.Language != "" {
+		fields = append(fields, fmt.Sprintf("language: %q", s.Language))
+	}
+	if s.HasNoAnalysis {
+		fields = append(fields, "hasNoAnalysis: true")
+	}
+	if s.MinLength > 0 {
+		fields = append(fields, fmt.Sprintf("minLength: %d", s.MinLength))
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+// matchesPage reports whether page matches the fields of the selector other than HasNoAnalysis.
+func (s PageSelector) matchesPage(page *models.CrawledPage) bool {
+	if s.Domain != "" {
+		host, _, _ := strings.Cut(lib.NormalizeURL(page.URL), "/")
+		host, _, _ = strings.Cut(strings.ToLower(host), ":")
+		if host != s.Domain && !strings.HasSuffix(host, "."+s.Domain) {
+			return false
+		}
+	}
+	if page.DateTime.Before(s.Since) || (!s.Until.IsZero() && !page.DateTime.Before(s.Until)) {
+		return false
+	}
+	if s.Language != "" && page.Language != s.Language {
+		return false
+	}
+	return s.MinLength == 0 || utf8.RuneCountInString(page.Content) >= s.MinLength
+}
+
+// Matches reports whether the selector selects page for an operation in mode.
+func (s PageSelector) Matches(
+	ctx context.Context,
+	datastoreClient lib.DatastoreClient,
+	page *models.CrawledPage,
+	mode AnalysisMode,
+) (bool, error) {
+	if !s.matchesPage(page) {
+		return false, nil
+	}
+	if !s.HasNoAnalysis {
+		return true, nil
+	}
+	_, found, err := datastoreClient.ReadAnalysisResult(ctx, page.URL, mode)
+	if err != nil {
+		return false, fmt.Errorf("error reading analysis result for %s: %w", page.URL, err)
+	}
+	return !found, nil
+}
+
+// selectPagesBatch is the number of pages SelectPages reads from the Datastore at a time.
+const selectPagesBatch = 500
+
+// SelectPages returns the stored pages selected by selector for an operation in mode, sorted
+// by URL. Duplicates of other pages are left out, since their analyses are copied from the
+// pages they duplicate. The dates and language of the selector are queried in the Datastore,
+// a batch of pages at a time; the other fields are checked on each page. The pages are returned
+// without their content.
+func SelectPages(
+	ctx context.Context,
+	datastoreClient lib.DatastoreClient,
+	selector PageSelector,
+	mode AnalysisMode,
+) ([]models.CrawledPage, error) {
+	query := models.CrawledPageQuery{
+		Since:    selector.Since,
+		Until:    selector.Until,
+		Language: selector.Language,
+		Limit:    selectPagesBatch,
+	}
+
+	var selected []models.CrawledPage
+	for {
+		pages, err := datastoreClient.QueryCrawledPages(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("error listing crawled pages: %w", err)
+		}
+		for _, page := range pages {
+			if page.DuplicateOf != "" || page.AliasOf != "" {
+				continue
+			}
+			matched, err := selector.Matches(ctx, datastoreClient, &page, mode)
+			if err != nil {
+				return nil, err
+			}
+			if matched {
+				page.Content = ""
+				selected = append(selected, page)
+			}
+		}
+		if len(pages) < selectPagesBatch {
+			break
+		}
+		query.After = &pages[len(pages)-1]
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].URL < selected[j].URL })
+	return selected, nil
+}
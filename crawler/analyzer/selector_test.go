@@ -0,0 +1,115 @@
+package analyzer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestParsePageSelector(t *testing.T) {
+	march := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expr    string
+		want    PageSelector
+		wantErr bool
+	}{
+		{expr: "", want: PageSelector{}},
+		{expr: "{}", want: PageSelector{}},
+		{
+			expr: `{domain: "Example.com", since: "2025-03-01", until: "2025-04-01T00:00:00Z", language: "FR", hasNoAnalysis: true, minLength: 2000}`,
+			want: PageSelector{Domain: "example.com", Since: march, Until: march.AddDate(0, 1, 0), Language: "fr", HasNoAnalysis: true, MinLength: 2000},
+		},
+		{expr: "domain: *.example.org minLength: 10", want: PageSelector{Domain: "example.org", MinLength: 10}},
+		{expr: `{domain: "example.com"`, wantErr: true},
+		{expr: "{color: red}", wantErr: true},
+		{expr: "{domain: a.com, domain: b.com}", wantErr: true},
+		{expr: "{domain}", wantErr: true},
+		{expr: `{domain: "unterminated}`, wantErr: true},
+		{expr: "{since: yesterday}", wantErr: true},
+		{expr: "{since: 2025-04-01, until: 2025-03-01}", wantErr: true},
+		{expr: "{hasNoAnalysis: maybe}", wantErr: true},
+		{expr: "{minLength: -1}", wantErr: true},
+		{expr: "{domain: https://example.com}", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePageSelector(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePageSelector(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("ParsePageSelector(%q) = %+v, want %+v", tt.expr, got, tt.want)
+		}
+		if err == nil {
+			// String returns an equivalent expression
+			if again, err := ParsePageSelector(got.String()); err != nil || again != got {
+				t.Errorf("ParsePageSelector(%q) = %+v, %v, want %+v", got.String(), again, err, got)
+			}
+		}
+	}
+}
+
+func TestSelectPages(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	march := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	for _, page := range []models.CrawledPage{
+		{URL: "example.com/long", Language: "fr", Content: strings.Repeat("é", 100), DateTime: march},
+		{URL: "news.example.com:8080/short", Language: "fr", Content: "court", DateTime: march},
+		{URL: "example.com/analyzed", Language: "fr", Content: strings.Repeat("a", 100), DateTime: march},
+		{URL: "example.com/english", Language: "en", Content: strings.Repeat("a", 100), DateTime: march},
+		{URL: "example.com/april", Language: "fr", Content: strings.Repeat("a", 100), DateTime: march.AddDate(0, 1, 0)},
+		{URL: "notexample.com/page", Language: "fr", Content: strings.Repeat("a", 100), DateTime: march},
+	} {
+		mockDS.Pages[page.URL] = &page
+	}
+	mockDS.WriteAnalysisResult(ctx, "example.com/analyzed", &models.AnalysisResult{Mode: AnalysisModeJoke})
+
+	selector, err := ParsePageSelector("{domain: example.com, since: 2025-03-01, until: 2025-04-01, language: fr}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		selector func(PageSelector) PageSelector
+		want     []string
+	}{
+		{"domain, dates and language", func(s PageSelector) PageSelector { return s },
+			[]string{"example.com/analyzed", "example.com/long", "news.example.com:8080/short"}},
+		{"min length in characters", func(s PageSelector) PageSelector { s.MinLength = 100; return s },
+			[]string{"example.com/analyzed", "example.com/long"}},
+		{"without an analysis", func(s PageSelector) PageSelector { s.HasNoAnalysis = true; return s },
+			[]string{"example.com/long", "news.example.com:8080/short"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.selector(selector)
+			pages, err := SelectPages(ctx, mockDS, s, AnalysisModeJoke)
+			if err != nil {
+				t.Fatalf("SelectPages() error = %v", err)
+			}
+			var got []string
+			for _, page := range pages {
+				got = append(got, page.URL)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("SelectPages() = %v, want %v", got, tt.want)
+			}
+
+			// Matches agrees with SelectPages
+			for _, page := range mockDS.Pages {
+				matched, err := s.Matches(ctx, mockDS, page, AnalysisModeJoke)
+				if err != nil {
+					t.Fatalf("Matches() error = %v", err)
+				}
+				if want := strings.Contains(" "+strings.Join(tt.want, " ")+" ", " "+page.URL+" "); matched != want {
+					t.Errorf("Matches(%s) = %v, want %v", page.URL, matched, want)
+				}
+			}
+		})
+	}
+}
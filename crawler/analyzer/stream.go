@@ -0,0 +1,48 @@
+package analyzer
+
+// jsonObjectScanner tracks the nesting of a JSON object as text streams in,
+// so a streamed response can be cut off as soon as the top-level object closes.
+type jsonObjectScanner struct {
+	depth    int
+	started  bool
+	inString bool
+	escaped  bool
+}
+
+// Feed scans the next chunk of text. It returns the number of bytes of chunk up to and
+// including the brace that closes the top-level object, and true once that brace is seen.
+func (s *jsonObjectScanner) Feed(chunk string) (int, bool) {
+	for i := 0; i < len(chunk); i++ {
+		c := chunk[i]
+
+		if s.inString {
+			switch {
+			case s.escaped:
+				s.escaped = false
+			case c == '\\':
+				s.escaped = true
+			case c == '"':
+				s.inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			if s.started {
+				s.inString = true
+			}
+		case '{':
+			s.started = true
+			s.depth++
+		case '}':
+			if s.started {
+				s.depth--
+				if s.depth == 0 {
+					return i + 1, true
+				}
+			}
+		}
+	}
+	return len(chunk), false
+}
@@ -0,0 +1,153 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSONObjectScanner(t *testing.T) {
+	tests := []struct {
+		name         string
+		chunks       []string
+		expected     string
+		expectedDone bool
+	}{
+		{
+			name:         "object in one chunk",
+			chunks:       []string{`{"result": "ok"}`},
+			expected:     `{"result": "ok"}`,
+			expectedDone: true,
+		},
+		{
+			name:         "object split across chunks",
+			chunks:       []string{`{"is_joke": tr`, `ue, "confidence": 9`, `0}`},
+			expected:     `{"is_joke": true, "confidence": 90}`,
+			expectedDone: true,
+		},
+		{
+			name:         "trailing text is cut off",
+			chunks:       []string{`{"a": 1}`, ` and some more text`},
+			expected:     `{"a": 1}`,
+			expectedDone: true,
+		},
+		{
+			name:         "braces and escaped quotes inside strings",
+			chunks:       []string{`{"reasoning": "a } and \"{\" `, `inside"}extra`},
+			expected:     `{"reasoning": "a } and \"{\" inside"}`,
+			expectedDone: true,
+		},
+		{
+			name:         "nested objects",
+			chunks:       []string{`{"a": {"b": {}}`, `, "c": 1}`},
+			expected:     `{"a": {"b": {}}, "c": 1}`,
+			expectedDone: true,
+		},
+		{
+			name:         "incomplete object",
+			chunks:       []string{`{"a": {"b": 1}`},
+			expected:     `{"a": {"b": 1}`,
+			expectedDone: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var scanner jsonObjectScanner
+			result := ""
+			done := false
+			for _, chunk := range tt.chunks {
+				n, d := scanner.Feed(chunk)
+				result += chunk[:n]
+				if d {
+					done = true
+					break
+				}
+			}
+			if result != tt.expected {
+				t.Errorf("result = %q, want %q", result, tt.expected)
+			}
+			if done != tt.expectedDone {
+				t.Errorf("done = %v, want %v", done, tt.expectedDone)
+			}
+		})
+	}
+}
+
+func TestGptLlmClient_AnalyzeStream(t *testing.T) {
+	deltas := []string{`{"result": `, `"ok"}`, ` ignored`}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range deltas {
+			fmt.Fprintf(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"created\":0,\"model\":\"test\","+
+				"\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", delta)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	var progress []int
+	client := NewGptLlmClientWithOptions(LlmOptions{
+		APIKey:   "key",
+		BaseURL:  server.URL,
+		Model:    "test",
+		Stream:   true,
+		Progress: func() func(int) { return func(received int) { progress = append(progress, received) } },
+	})
+
+	response, err := client.Analyze(context.Background(), "prompt", &TestResponseSchema, GenerationParams{})
+	if err != nil {
+		t.Fatalf("Analyze() returned error: %v", err)
+	}
+	if response.Content != `{"result": "ok"}` {
+		t.Errorf("Content = %q, want %q", response.Content, `{"result": "ok"}`)
+	}
+	if response.Usage.CompletionTokens != 2 || response.Usage.PromptTokens != 2 {
+		t.Errorf("Usage = %+v, want 2 completion tokens estimated from chunks and 2 prompt tokens from the prompt", response.Usage)
+	}
+	if len(progress) != 2 || progress[1] != len(response.Content) {
+		t.Errorf("progress = %v, want 2 calls ending at %d", progress, len(response.Content))
+	}
+}
+
+func TestGptLlmClient_AnalyzeStreamUsage(t *testing.T) {
+	deltas := []string{`{"result": `, `"ok"}`}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range deltas {
+			fmt.Fprintf(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"created\":0,\"model\":\"test\","+
+				"\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", delta)
+		}
+		fmt.Fprint(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"created\":0,\"model\":\"test\",\"choices\":[],"+
+			"\"usage\":{\"prompt_tokens\":120,\"completion_tokens\":9,\"total_tokens\":129}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client := NewGptLlmClientWithOptions(LlmOptions{APIKey: "key", BaseURL: server.URL, Model: "test", Stream: true})
+
+	// Without a schema, the stream is read to its end
+	response, err := client.Analyze(context.Background(), "prompt", nil, GenerationParams{})
+	if err != nil {
+		t.Fatalf("Analyze() returned error: %v", err)
+	}
+	if response.Content != `{"result": "ok"}` {
+		t.Errorf("Content = %q, want %q", response.Content, `{"result": "ok"}`)
+	}
+	if response.Usage.PromptTokens != 120 || response.Usage.CompletionTokens != 9 {
+		t.Errorf("Usage = %+v, want the usage of the final chunk", response.Usage)
+	}
+
+	// With one, it is closed once the JSON object is complete, before the usage chunk
+	response, err = client.Analyze(context.Background(), "prompt", &TestResponseSchema, GenerationParams{})
+	if err != nil {
+		t.Fatalf("Analyze() returned error: %v", err)
+	}
+	if response.Usage.PromptTokens != 2 || response.Usage.CompletionTokens != 2 {
+		t.Errorf("Usage = %+v, want the usage estimated for a stream cut off", response.Usage)
+	}
+}
@@ -0,0 +1,215 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zeace/poisson/crawler/config"
+	"github.com/zeace/poisson/crawler/language"
+	"github.com/zeace/poisson/lib"
+)
+
+// promptFileSuffix is the file name suffix of prompt templates, as in prompts/joke.prompt.md.
+const promptFileSuffix = ".prompt.md"
+
+// LoadPromptTemplates replaces the embedded prompt templates with the ones found at source,
+// which is either a local directory or a gs://bucket/prefix URL. Templates are read from
+// <mode>.prompt.md; modes without a file keep their embedded template. Templates for pages in
+// a language are read from <mode>.<lang>.prompt.md, e.g. joke.de.prompt.md.
+// Prompt fingerprints are computed from the loaded text, so cached analyses made with a
+// different template are re-analyzed as usual.
+// It must be called before any analysis starts; use WatchPromptTemplates to reload templates
+// while analyses run. Returns the modes whose template was replaced.
+func LoadPromptTemplates(ctx context.Context, source string) ([]AnalysisMode, error) {
+	readFile, err := promptFileReader(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	return loadPromptTemplates(readFile)
+}
+
+// WatchPromptTemplates reads the templates at source again every interval until ctx is done,
+// so that a long-running process picks up prompt changes without a restart. Changed templates
+// are replaced all at once and logged with their new fingerprint, which makes the analyses made
+// with the previous templates stale. If the source can't be read or has an invalid template, the
+// error is logged and all templates are kept. Modes whose file is removed keep their last template.
+func WatchPromptTemplates(ctx context.Context, source string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := reloadPromptTemplates(ctx, source); err != nil {
+				slog.WarnContext(ctx, "Error reloading prompt templates", "source", source, "error", err)
+			}
+		}
+	}
+}
+
+// reloadPromptTemplates loads the templates at source and returns the modes whose template changed.
+func reloadPromptTemplates(ctx context.Context, source string) ([]AnalysisMode, error) {
+	loadCtx, cancel := context.WithTimeout(ctx, config.PromptLoadTimeout)
+	defer cancel()
+	readFile, err := promptFileReader(loadCtx, source)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := readPromptTemplates(readFile)
+	if err != nil {
+		return nil, err
+	}
+	changed := replacePromptTemplates(templates)
+	for _, mode := range changed {
+		fingerprint, _ := GeneratePromptFingerprint(mode)
+		slog.InfoContext(ctx, "Reloaded prompt template", "source", source, "mode", mode, "fingerprint", fingerprint)
+	}
+	return changed, nil
+}
+
+// promptFileReader returns a function reading the files at source, a local directory or a
+// gs://bucket/prefix URL. It reports whether the file exists.
+func promptFileReader(ctx context.Context, source string) (func(name string) ([]byte, bool, error), error) {
+	if strings.HasPrefix(source, "gs://") {
+		bucket, prefix, err := lib.ParseGCSURL(source)
+		if err != nil {
+			return nil, err
+		}
+		return func(name string) ([]byte, bool, error) {
+			return lib.ReadGCSObject(ctx, bucket, prefix+name)
+		}, nil
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("error reading prompt directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("prompt source %s is not a directory", source)
+	}
+	return func(name string) ([]byte, bool, error) {
+		data, err := os.ReadFile(filepath.Join(source, name))
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return data, err == nil, err
+	}, nil
+}
+
+// promptFiles are the templates of a mode read from a prompt source.
+type promptFiles struct {
+	// template is the template of <mode>.prompt.md, empty if there is no such file.
+	template string
+	// localized are the templates of <mode>.<lang>.prompt.md, by language code.
+	localized map[string]string
+}
+
+// loadPromptTemplates reads and validates a template for every mode before replacing any,
+// so a bad file leaves all embedded templates in place.
+func loadPromptTemplates(readFile func(name string) ([]byte, bool, error)) ([]AnalysisMode, error) {
+	templates, err := readPromptTemplates(readFile)
+	if err != nil {
+		return nil, err
+	}
+	replacePromptTemplates(templates)
+
+	loaded := make([]AnalysisMode, 0, len(templates))
+	for mode := range templates {
+		loaded = append(loaded, mode)
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i] < loaded[j] })
+	return loaded, nil
+}
+
+// readPromptTemplates reads and validates the templates of every mode that has a file.
+func readPromptTemplates(readFile func(name string) ([]byte, bool, error)) (map[AnalysisMode]promptFiles, error) {
+	templates := make(map[AnalysisMode]promptFiles)
+	for _, mode := range ModeNames() {
+		var files promptFiles
+		template, found, err := readPromptTemplate(readFile, mode+promptFileSuffix)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			files.template = template
+		}
+		for _, lang := range language.Codes() {
+			template, found, err := readPromptTemplate(readFile, mode+"."+lang+promptFileSuffix)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				continue
+			}
+			if files.localized == nil {
+				files.localized = make(map[string]string)
+			}
+			files.localized[lang] = template
+		}
+		if files.template != "" || files.localized != nil {
+			templates[AnalysisMode(mode)] = files
+		}
+	}
+	return templates, nil
+}
+
+// readPromptTemplate reads and validates the template file name. It reports whether the file exists.
+func readPromptTemplate(readFile func(name string) ([]byte, bool, error), name string) (string, bool, error) {
+	data, found, err := readFile(name)
+	if err != nil {
+		return "", false, fmt.Errorf("error reading prompt template %s: %w", name, err)
+	}
+	if !found {
+		return "", false, nil
+	}
+	template := string(data)
+	if err := validatePromptTemplate(template); err != nil {
+		return "", false, fmt.Errorf("invalid prompt template %s: %w", name, err)
+	}
+	return template, true, nil
+}
+
+// replacePromptTemplates sets the templates of the modes in templates at once, and returns the
+// modes whose templates changed, sorted. A mode keeps its template if it only has localized
+// ones, and its localized templates are replaced by the ones read.
+func replacePromptTemplates(templates map[AnalysisMode]promptFiles) []AnalysisMode {
+	promptTemplatesMu.Lock()
+	defer promptTemplatesMu.Unlock()
+	var changed []AnalysisMode
+	for mode, files := range templates {
+		config := PromptTemplates[mode]
+		template := config.Template
+		if files.template != "" {
+			template = files.template
+		}
+		if config.Template == template && maps.Equal(config.LocalizedTemplates, files.localized) {
+			continue
+		}
+		config.Template = template
+		config.LocalizedTemplates = files.localized
+		PromptTemplates[mode] = config
+		changed = append(changed, mode)
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i] < changed[j] })
+	return changed
+}
+
+// validatePromptTemplate checks that a template takes exactly the title and content arguments.
+// Templates that only use the title refer to it as %[1]s.
+func validatePromptTemplate(template string) error {
+	if strings.TrimSpace(template) == "" {
+		return fmt.Errorf("template is empty")
+	}
+	if out := AddBodyToPrompt(template, "", ""); strings.Contains(out, "%!") {
+		return fmt.Errorf("template must contain exactly two %%s verbs (title and content)")
+	}
+	return nil
+}
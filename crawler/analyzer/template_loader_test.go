@@ -0,0 +1,171 @@
+package analyzer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// restorePromptTemplates resets PromptTemplates after a test that loads templates.
+func restorePromptTemplates(t *testing.T) {
+	saved := make(map[AnalysisMode]PromptConfig, len(PromptTemplates))
+	for mode, config := range PromptTemplates {
+		saved[mode] = config
+	}
+	t.Cleanup(func() {
+		for mode, config := range saved {
+			PromptTemplates[mode] = config
+		}
+	})
+}
+
+func TestLoadPromptTemplates_Directory(t *testing.T) {
+	restorePromptTemplates(t)
+
+	dir := t.TempDir()
+	template := "Reloaded template. Title: %s\nContent: %s"
+	if err := os.WriteFile(filepath.Join(dir, "test.prompt.md"), []byte(template), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	jokeFingerprint, _ := GeneratePromptFingerprint(AnalysisModeJoke)
+	testFingerprint, _ := GeneratePromptFingerprint(AnalysisModeTest)
+
+	loaded, err := LoadPromptTemplates(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("LoadPromptTemplates returned error: %v", err)
+	}
+	if len(loaded) != 1 || loaded[0] != AnalysisModeTest {
+		t.Errorf("loaded = %v, want [test]", loaded)
+	}
+
+	prompt, _ := GeneratePrompt(AnalysisModeTest, "T", "C")
+	if !strings.HasPrefix(prompt, "Reloaded template.") {
+		t.Errorf("expected prompt from loaded template, got: %s", prompt)
+	}
+
+	// Fingerprints follow the template text
+	if fp, _ := GeneratePromptFingerprint(AnalysisModeTest); fp == testFingerprint {
+		t.Error("expected test fingerprint to change after loading a new template")
+	}
+	if fp, _ := GeneratePromptFingerprint(AnalysisModeJoke); fp != jokeFingerprint {
+		t.Error("expected joke fingerprint to stay the same without a template file")
+	}
+}
+
+func TestLoadPromptTemplates_Invalid(t *testing.T) {
+	restorePromptTemplates(t)
+
+	tests := []struct {
+		name     string
+		template string
+	}{
+		{name: "empty", template: "  \n"},
+		{name: "missing content verb", template: "Title only: %s"},
+		{name: "extra verb", template: "%s %s %s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, "joke.prompt.md"), []byte("Valid %s and %s"), 0644)
+			os.WriteFile(filepath.Join(dir, "test.prompt.md"), []byte(tt.template), 0644)
+
+			if _, err := LoadPromptTemplates(context.Background(), dir); err == nil {
+				t.Fatal("expected error for invalid template, got nil")
+			}
+			// Nothing is replaced when any template is invalid
+			if PromptTemplates[AnalysisModeJoke].Template != JokePromptTemplate {
+				t.Error("expected embedded joke template to be kept")
+			}
+		})
+	}
+}
+
+func TestLoadPromptTemplates_BadSource(t *testing.T) {
+	if _, err := LoadPromptTemplates(context.Background(), filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for missing directory")
+	}
+	if _, err := LoadPromptTemplates(context.Background(), "gs://"); err == nil {
+		t.Error("expected error for gs:// URL without bucket")
+	}
+}
+
+func TestReloadPromptTemplates(t *testing.T) {
+	restorePromptTemplates(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.prompt.md")
+	if err := os.WriteFile(path, []byte("First. Title: %s\nContent: %s"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPromptTemplates(ctx, dir); err != nil {
+		t.Fatalf("LoadPromptTemplates returned error: %v", err)
+	}
+	fingerprint, _ := GeneratePromptFingerprint(AnalysisModeTest)
+
+	// Unchanged templates aren't reported
+	if changed, err := reloadPromptTemplates(ctx, dir); err != nil || len(changed) != 0 {
+		t.Errorf("reloadPromptTemplates() = %v, %v, want no change", changed, err)
+	}
+
+	if err := os.WriteFile(path, []byte("Second. Title: %s\nContent: %s"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := reloadPromptTemplates(ctx, dir)
+	if err != nil || len(changed) != 1 || changed[0] != AnalysisModeTest {
+		t.Fatalf("reloadPromptTemplates() = %v, %v, want [test]", changed, err)
+	}
+	if prompt, _ := GeneratePrompt(AnalysisModeTest, "T", "C"); !strings.HasPrefix(prompt, "Second.") {
+		t.Errorf("expected prompt from the reloaded template, got: %s", prompt)
+	}
+	if fp, _ := GeneratePromptFingerprint(AnalysisModeTest); fp == fingerprint {
+		t.Error("expected test fingerprint to change after reloading a new template")
+	}
+
+	// An invalid template keeps the last valid one
+	if err := os.WriteFile(path, []byte("Broken %s"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloadPromptTemplates(ctx, dir); err == nil {
+		t.Error("expected error for an invalid template, got nil")
+	}
+	if prompt, _ := GeneratePrompt(AnalysisModeTest, "T", "C"); !strings.HasPrefix(prompt, "Second.") {
+		t.Errorf("expected the last valid template to be kept, got: %s", prompt)
+	}
+}
+
+func TestLoadPromptTemplates_Localized(t *testing.T) {
+	restorePromptTemplates(t)
+
+	dir := t.TempDir()
+	template := "Ist das ein Scherz? Titel: %s\nInhalt: %s"
+	if err := os.WriteFile(filepath.Join(dir, "joke.de.prompt.md"), []byte(template), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadPromptTemplates(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("LoadPromptTemplates returned error: %v", err)
+	}
+	if len(loaded) != 1 || loaded[0] != AnalysisModeJoke {
+		t.Errorf("loaded = %v, want [joke]", loaded)
+	}
+	// A mode with only localized templates keeps its template
+	if PromptTemplates[AnalysisModeJoke].Template != JokePromptTemplate {
+		t.Error("expected joke template to stay embedded")
+	}
+	if got, ok := localizedTemplate(AnalysisModeJoke, "de"); !ok || got != template {
+		t.Errorf("localizedTemplate(joke, de) = %q, %v, want the loaded template", got, ok)
+	}
+	if _, ok := localizedTemplate(AnalysisModeJoke, "fr"); ok {
+		t.Error("expected no French template")
+	}
+
+	// Invalid localized templates are rejected like the others
+	os.WriteFile(filepath.Join(dir, "joke.fr.prompt.md"), []byte("Titre: %s"), 0644)
+	if _, err := LoadPromptTemplates(context.Background(), dir); err == nil {
+		t.Error("expected error for invalid localized template, got nil")
+	}
+}
@@ -12,6 +12,14 @@ type testIntermediateResult struct {
 	Result string `json:"result"`
 }
 
+// TestResponseSchema is the structured output schema for test mode.
+var TestResponseSchema = ResponseSchema{
+	Name: "test_analysis",
+	Schema: objectSchema(map[string]string{
+		"result": "string",
+	}),
+}
+
 // ProcessTestResponse processes the JSON response from the LLM for test mode and converts it to AnalysisResult.
 func ProcessTestResponse(jsonStr string, fingerprint int) (*models.AnalysisResult, error) {
 	var intermediate testIntermediateResult
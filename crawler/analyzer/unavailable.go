@@ -0,0 +1,40 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	openai "github.com/openai/openai-go/v3"
+)
+
+// ErrLlmUnavailable is wrapped by analysis errors caused by the LLM API being unreachable or
+// failing, as opposed to errors caused by the request or the response.
+var ErrLlmUnavailable = errors.New("LLM unavailable")
+
+// isLlmUnavailable reports whether err from an LLM call means the API is down rather than
+// that the call itself was bad: network errors and server errors. A call that ran out of the
+// time of its analysis or was cancelled says nothing about the API: the HTTP client reports
+// these as network errors too, so they are ruled out first.
+func isLlmUnavailable(err error) bool {
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// wrapLlmError wraps an error returned by an LLM call with msg, adding ErrLlmUnavailable
+// if the error means the API is down.
+func wrapLlmError(msg string, err error) error {
+	if isLlmUnavailable(err) {
+		return fmt.Errorf("%s: %w: %w", msg, ErrLlmUnavailable, err)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
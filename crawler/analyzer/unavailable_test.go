@@ -0,0 +1,39 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	openai "github.com/openai/openai-go/v3"
+)
+
+func TestIsLlmUnavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"server error", &openai.Error{StatusCode: 503}, true},
+		{"wrapped server error", fmt.Errorf("wrapped: %w", &openai.Error{StatusCode: 502}), true},
+		{"rate limited", &openai.Error{StatusCode: 429}, false},
+		{"bad request", &openai.Error{StatusCode: 400}, false},
+		{"unauthorized", &openai.Error{StatusCode: 401}, false},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"analysis deadline", context.DeadlineExceeded, false},
+		{"analysis deadline in the HTTP client", &url.Error{Op: "Post", URL: "https://api.openai.com", Err: context.DeadlineExceeded}, false},
+		{"canceled", context.Canceled, false},
+		{"other", errors.New("invalid response"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isLlmUnavailable(tt.err); got != tt.want {
+				t.Errorf("isLlmUnavailable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
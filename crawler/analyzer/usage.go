@@ -0,0 +1,55 @@
+package analyzer
+
+import (
+	openai "github.com/openai/openai-go/v3"
+	"github.com/zeace/poisson/models"
+)
+
+// ModelPricing is the price of a model in USD per million tokens.
+type ModelPricing struct {
+	InputPerMillion  float64
+	OutputPerMillion float64
+}
+
+// ModelPrices holds the known prices per model. Models not listed here are reported with zero cost.
+var ModelPrices = map[string]ModelPricing{
+	openai.ChatModelGPT4o:     {InputPerMillion: 2.50, OutputPerMillion: 10.00},
+	openai.ChatModelGPT4oMini: {InputPerMillion: 0.15, OutputPerMillion: 0.60},
+}
+
+// EstimateCost returns the estimated cost in USD of a call to model with the given usage.
+func EstimateCost(model string, usage LlmUsage) float64 {
+	pricing, ok := ModelPrices[model]
+	if !ok {
+		return 0
+	}
+	return float64(usage.PromptTokens)*pricing.InputPerMillion/1e6 +
+		float64(usage.CompletionTokens)*pricing.OutputPerMillion/1e6
+}
+
+// UsageTotals aggregates LLM usage over several analyses, e.g. for one crawler run.
+// It is not safe for concurrent use.
+type UsageTotals struct {
+	// Analyses is the number of analyses that called the LLM.
+	Analyses int
+	// CachedAnalyses is the number of analyses served from the cache without an LLM call.
+	CachedAnalyses   int
+	PromptTokens     int
+	CompletionTokens int
+	CostUSD          float64
+}
+
+// Add adds the usage recorded on result. Cached results are counted but add no tokens or cost.
+func (u *UsageTotals) Add(result *models.AnalysisResult) {
+	if result == nil {
+		return
+	}
+	if result.Cached {
+		u.CachedAnalyses++
+		return
+	}
+	u.Analyses++
+	u.PromptTokens += result.PromptTokens
+	u.CompletionTokens += result.CompletionTokens
+	u.CostUSD += result.CostUSD
+}
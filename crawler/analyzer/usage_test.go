@@ -0,0 +1,99 @@
+package analyzer
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestEstimateCost(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    string
+		usage    LlmUsage
+		expected float64
+	}{
+		{
+			name:     "gpt-4o",
+			model:    "gpt-4o",
+			usage:    LlmUsage{PromptTokens: 1_000_000, CompletionTokens: 100_000},
+			expected: 3.50,
+		},
+		{
+			name:     "gpt-4o-mini",
+			model:    "gpt-4o-mini",
+			usage:    LlmUsage{PromptTokens: 2_000_000, CompletionTokens: 1_000_000},
+			expected: 0.90,
+		},
+		{
+			name:     "unknown model",
+			model:    "llama-3-8b",
+			usage:    LlmUsage{PromptTokens: 1000, CompletionTokens: 1000},
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost := EstimateCost(tt.model, tt.usage)
+			if math.Abs(cost-tt.expected) > 1e-9 {
+				t.Errorf("EstimateCost(%q, %+v) = %f, want %f", tt.model, tt.usage, cost, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUsageTotals_Add(t *testing.T) {
+	var totals UsageTotals
+	totals.Add(&models.AnalysisResult{PromptTokens: 100, CompletionTokens: 10, CostUSD: 0.5})
+	totals.Add(&models.AnalysisResult{PromptTokens: 200, CompletionTokens: 20, CostUSD: 0.25})
+	totals.Add(&models.AnalysisResult{PromptTokens: 999, CompletionTokens: 99, CostUSD: 9, Cached: true})
+	totals.Add(nil)
+
+	expected := UsageTotals{Analyses: 2, CachedAnalyses: 1, PromptTokens: 300, CompletionTokens: 30, CostUSD: 0.75}
+	if totals != expected {
+		t.Errorf("UsageTotals = %+v, want %+v", totals, expected)
+	}
+}
+
+func TestAnalyze_RecordsUsage(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	page := &models.CrawledPage{
+		URL:     "example.com/article",
+		Title:   "Test Article",
+		Content: "Test content",
+	}
+
+	mockLLM := &MockLlmClient{
+		Response:  `{"is_joke": true, "confidence": 90, "reasoning": "Satire"}`,
+		Usage:     LlmUsage{PromptTokens: 1000, CompletionTokens: 100},
+		ModelName: "gpt-4o",
+	}
+	result, err := analyze(ctx, page, mockLLM, AnalysisModeJoke, mockDS, false)
+	if err != nil {
+		t.Fatalf("analyze() error = %v, want nil", err)
+	}
+	if result.PromptTokens != 1000 || result.CompletionTokens != 100 {
+		t.Errorf("Expected 1000 prompt and 100 completion tokens, got %d and %d", result.PromptTokens, result.CompletionTokens)
+	}
+	if math.Abs(result.CostUSD-0.0035) > 1e-9 {
+		t.Errorf("Expected cost 0.0035, got %f", result.CostUSD)
+	}
+	if result.Cached {
+		t.Error("Expected fresh result not to be marked cached")
+	}
+
+	// The second call is served from cache
+	cached, err := analyze(ctx, page, mockLLM, AnalysisModeJoke, mockDS, false)
+	if err != nil {
+		t.Fatalf("analyze() error = %v, want nil", err)
+	}
+	if !cached.Cached {
+		t.Error("Expected second result to be marked cached")
+	}
+}
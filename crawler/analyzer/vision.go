@@ -0,0 +1,209 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// DefaultVisionWeight is the share of the lead image verdict in the blended joke percentage.
+const DefaultVisionWeight = 0.25
+
+// VisionOptions configures the analysis of article lead images by a vision-capable model. The
+// image verdict is blended with the text-based joke percentage, since a doctored photo or an
+// absurd illustration often gives a satirical article away. The zero value disables it.
+type VisionOptions struct {
+	// Model is the vision-capable model that analyzes lead images, served by the same endpoint
+	// as the text model. Empty disables image analysis.
+	Model string
+	// Weight is the share of the image verdict in the joke percentage, from 0 to 1.
+	// Zero means DefaultVisionWeight.
+	Weight float64
+}
+
+// Enabled reports whether lead images are analyzed.
+func (o VisionOptions) Enabled() bool {
+	return o.Model != ""
+}
+
+// ImageLlmClient is an LlmClient that can also analyze images.
+type ImageLlmClient interface {
+	LlmClient
+	// AnalyzeImage analyzes the image at imageURL with the prompt. If schema is non-nil, the LLM
+	// is asked to respond with JSON matching it.
+	AnalyzeImage(ctx context.Context, prompt, imageURL string, schema *ResponseSchema, params GenerationParams) (LlmResponse, error)
+}
+
+// VisionLlmClient is an LlmClient that analyzes articles with Text and, in modes with a joke
+// percentage, their lead image with Vision. Single calls made through Analyze use Text.
+type VisionLlmClient struct {
+	Text   LlmClient
+	Vision ImageLlmClient
+	// Weight is the share of the image verdict in the joke percentage (see VisionOptions.Weight).
+	Weight float64
+}
+
+// Analyze analyzes content with the text client.
+func (v *VisionLlmClient) Analyze(
+	ctx context.Context,
+	prompt string,
+	schema *ResponseSchema,
+	params GenerationParams,
+) (LlmResponse, error) {
+	return v.Text.Analyze(ctx, prompt, schema, params)
+}
+
+// Model returns the text model followed by the vision model, e.g. "gpt-4o+vision:gpt-4o-mini",
+// so that analyses made without images are not served from the cache.
+func (v *VisionLlmClient) Model() string {
+	return visionModelName(v.Text.Model(), v.Vision.Model())
+}
+
+// Provider returns the provider of the text client.
+func (v *VisionLlmClient) Provider() string {
+	return v.Text.Provider()
+}
+
+// visionModelName returns the model recorded for analyses blending textModel and visionModel.
+func visionModelName(textModel, visionModel string) string {
+	return textModel + "+vision:" + visionModel
+}
+
+// visionPrompt asks a vision model whether an article's lead image suggests a joke.
+// It takes the article title.
+const visionPrompt = `This is the lead image of an online article titled %q.
+
+Does the image itself suggest that the article is a joke, a prank, satire or an April Fools' article? Look for doctored or absurd photos, humorous illustrations and staged scenes. An ordinary news photo, portrait or stock image does not suggest a joke.
+
+Answer with whether the image suggests a joke, your confidence from 0 to 100, and a short reasoning.`
+
+// screenshotPrompt asks a vision model whether the screenshot of an article without a lead image
+// suggests a joke. It takes the article title.
+const screenshotPrompt = `This is a screenshot of the top of an online article titled %q.
+
+Do the photos, illustrations and layout it shows suggest that the article is a joke, a prank, satire or an April Fools' article? Look for doctored or absurd photos, humorous illustrations and staged scenes. An ordinary news page, photo or advertisement does not suggest a joke.
+
+Answer with whether the page suggests a joke, your confidence from 0 to 100, and a short reasoning.`
+
+// articleImage returns the image of page analyzed by the vision model, its prompt and the URL
+// recorded for it: the lead image, or else the screenshot of the page, sent as a data URL since
+// its gs:// URL or file path can't be loaded by the model. The image URL is empty if the page has
+// neither.
+func articleImage(ctx context.Context, page *models.CrawledPage) (imageURL, prompt, recorded string, err error) {
+	if page.ImageURL != "" {
+		return page.ImageURL, fmt.Sprintf(visionPrompt, page.Title), page.ImageURL, nil
+	}
+	if page.Screenshot == "" {
+		return "", "", "", nil
+	}
+	png, err := readScreenshot(ctx, page.Screenshot)
+	if err != nil {
+		return "", "", "", fmt.Errorf("error reading screenshot %s: %w", page.Screenshot, err)
+	}
+	imageURL = "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+	return imageURL, fmt.Sprintf(screenshotPrompt, page.Title), page.Screenshot, nil
+}
+
+// readScreenshot reads the screenshot stored at location, a gs:// URL or a file path (see
+// models.CrawledPage.Screenshot).
+func readScreenshot(ctx context.Context, location string) ([]byte, error) {
+	rest, ok := strings.CutPrefix(location, "gs://")
+	if !ok {
+		return os.ReadFile(location)
+	}
+	bucket, object, _ := strings.Cut(rest, "/")
+	png, found, err := lib.ReadGCSObject(ctx, bucket, object)
+	if err == nil && !found {
+		err = fmt.Errorf("object not found")
+	}
+	return png, err
+}
+
+// analyzeLeadImage asks client whether the image at imageURL, recorded as recorded, suggests a
+// joke, scoring the verdict with JokeScoring. It returns the image analysis and the usage of the
+// call.
+func analyzeLeadImage(
+	ctx context.Context,
+	prompt, imageURL, recorded string,
+	client ImageLlmClient,
+	params GenerationParams,
+) (*models.ImageAnalysis, LlmUsage, error) {
+	response, err := client.AnalyzeImage(ctx, prompt, imageURL, &JokeResponseSchema, params)
+	if err != nil {
+		return nil, LlmUsage{}, wrapLlmError("error analyzing lead image", err)
+	}
+	jsonStr, err := validateResponse(response.Content, JokeResponseSchema)
+	if err != nil {
+		return nil, response.Usage, err
+	}
+	var verdict jokeIntermediateResult
+	if err := json.Unmarshal([]byte(jsonStr), &verdict); err != nil {
+		return nil, response.Usage, fmt.Errorf("error parsing JSON: %w", err)
+	}
+
+	return &models.ImageAnalysis{
+		URL:            recorded,
+		Model:          client.Model(),
+		JokePercentage: JokeScoring.Score(verdict.IsJoke, verdict.Confidence, verdict.Reasoning),
+		Reasoning:      verdict.Reasoning,
+	}, response.Usage, nil
+}
+
+// BlendImageScore returns the joke percentage blending the text percentage with the image
+// percentage, which counts for weight (0 to 1).
+func BlendImageScore(text, image int, weight float64) int {
+	weight = min(max(weight, 0), 1)
+	return int(math.Round((1-weight)*float64(text) + weight*float64(image)))
+}
+
+// addImageAnalysis analyzes the lead image of page with vision, or its screenshot if it has
+// none (see articleImage), and blends the verdict into the joke percentage of result. A failed
+// image analysis is logged and leaves result unchanged, since the text analysis stands on its own.
+// It returns the usage and estimated cost of the call.
+func addImageAnalysis(
+	ctx context.Context,
+	page *models.CrawledPage,
+	vision *VisionLlmClient,
+	params GenerationParams,
+	result *models.AnalysisResult,
+	verbose bool,
+) (LlmUsage, float64) {
+	if result.JokePercentage == nil {
+		return LlmUsage{}, 0
+	}
+	imageURL, prompt, recorded, err := articleImage(ctx, page)
+	if err != nil {
+		slog.WarnContext(ctx, "Error reading page image, using the text analysis only", "error", err)
+		return LlmUsage{}, 0
+	}
+	if imageURL == "" {
+		return LlmUsage{}, 0
+	}
+	if verbose {
+		slog.InfoContext(ctx, "Analyzing lead image", "image", recorded, "model", vision.Vision.Model())
+	}
+
+	image, usage, err := analyzeLeadImage(ctx, prompt, imageURL, recorded, vision.Vision, params)
+	cost := EstimateCost(vision.Vision.Model(), usage)
+	if err != nil {
+		slog.WarnContext(ctx, "Error analyzing lead image, using the text analysis only", "image", recorded, "error", err)
+		return usage, cost
+	}
+
+	image.Weight = vision.Weight
+	if image.Weight == 0 {
+		image.Weight = DefaultVisionWeight
+	}
+	blended := BlendImageScore(*result.JokePercentage, image.JokePercentage, image.Weight)
+	result.JokePercentage = &blended
+	result.Image = image
+	return usage, cost
+}
@@ -0,0 +1,152 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestBlendImageScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     int
+		image    int
+		weight   float64
+		expected int
+	}{
+		{"default weight", 40, 80, DefaultVisionWeight, 50},
+		{"image ignored", 40, 80, 0, 40},
+		{"image only", 40, 80, 1, 80},
+		{"weight clamped", 40, 80, 2, 80},
+		{"rounded", 33, 0, 0.5, 17},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BlendImageScore(tt.text, tt.image, tt.weight); got != tt.expected {
+				t.Errorf("BlendImageScore(%d, %d, %v) = %d, want %d", tt.text, tt.image, tt.weight, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAnalyzePage_Vision(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	textLLM := &MockLlmClient{
+		Response:  `{"is_joke": true, "confidence": 40, "reasoning": "Odd claims"}`,
+		ModelName: "gpt-4o",
+		Usage:     LlmUsage{PromptTokens: 100, CompletionTokens: 10},
+	}
+	visionLLM := &MockLlmClient{
+		Response:  `{"is_joke": true, "confidence": 80, "reasoning": "A cat in a lab coat"}`,
+		ModelName: "gpt-4o-mini",
+		Usage:     LlmUsage{PromptTokens: 50, CompletionTokens: 5},
+	}
+	client := &VisionLlmClient{Text: textLLM, Vision: visionLLM}
+	page := &models.CrawledPage{
+		URL:      "example.com/cats",
+		Title:    "Cats Elected to Parliament",
+		Content:  "Cats took every seat.",
+		ImageURL: "https://example.com/cat.jpg",
+	}
+
+	result, err := analyzePage(ctx, page, client, AnalysisModeJoke, LanguagePolicyAsIs, 0, mockDS, false, false)
+	if err != nil {
+		t.Fatalf("analyzePage() error = %v", err)
+	}
+	if *result.JokePercentage != 50 {
+		t.Errorf("JokePercentage = %d, want 50 (40 blended with 80 at weight %v)", *result.JokePercentage, DefaultVisionWeight)
+	}
+	if result.Image == nil || result.Image.JokePercentage != 80 || result.Image.URL != page.ImageURL ||
+		result.Image.Model != "gpt-4o-mini" || result.Image.Weight != DefaultVisionWeight {
+		t.Errorf("Image = %+v, want the vision verdict on %s", result.Image, page.ImageURL)
+	}
+	if visionLLM.LastImageURL != page.ImageURL {
+		t.Errorf("vision model got image %q, want %q", visionLLM.LastImageURL, page.ImageURL)
+	}
+	if result.Model != "gpt-4o+vision:gpt-4o-mini" || result.Model != client.Model() {
+		t.Errorf("Model = %q, want %q", result.Model, client.Model())
+	}
+	if result.PromptTokens != 150 || result.CompletionTokens != 15 {
+		t.Errorf("tokens = %d/%d, want 150/15", result.PromptTokens, result.CompletionTokens)
+	}
+
+	// The blended result is served from the cache to the same client
+	cached, err := analyzePage(ctx, page, client, AnalysisModeJoke, LanguagePolicyAsIs, 0, mockDS, false, false)
+	if err != nil {
+		t.Fatalf("analyzePage() error = %v", err)
+	}
+	if !cached.Cached || textLLM.Calls != 1 || visionLLM.Calls != 1 {
+		t.Errorf("expected a cached result, got Cached=%v text calls=%d vision calls=%d",
+			cached.Cached, textLLM.Calls, visionLLM.Calls)
+	}
+}
+
+func TestAnalyzePage_VisionScreenshot(t *testing.T) {
+	screenshot := filepath.Join(t.TempDir(), "page.png")
+	if err := os.WriteFile(screenshot, []byte("PNG"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	textLLM := &MockLlmClient{Response: `{"is_joke": true, "confidence": 40, "reasoning": "Odd claims"}`}
+	visionLLM := &MockLlmClient{Response: `{"is_joke": true, "confidence": 80, "reasoning": "A cat at the lectern"}`}
+	client := &VisionLlmClient{Text: textLLM, Vision: visionLLM}
+	page := &models.CrawledPage{URL: "example.com/cats", Title: "Cats", Content: "Cats.", Screenshot: screenshot}
+
+	result, err := analyzePage(context.Background(), page, client, AnalysisModeJoke, LanguagePolicyAsIs, 0,
+		lib.NewMockDatastoreClient(), false, false)
+	if err != nil {
+		t.Fatalf("analyzePage() error = %v", err)
+	}
+	if result.Image == nil || result.Image.URL != screenshot || *result.JokePercentage != 50 {
+		t.Errorf("result = %d%% with image %+v, want the screenshot verdict blended in", *result.JokePercentage, result.Image)
+	}
+	if want := "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("PNG")); visionLLM.LastImageURL != want {
+		t.Errorf("vision model got image %q, want %q", visionLLM.LastImageURL, want)
+	}
+	if !strings.Contains(visionLLM.LastPrompt, "screenshot") {
+		t.Errorf("vision prompt = %q, want the screenshot prompt", visionLLM.LastPrompt)
+	}
+}
+
+func TestAnalyzePage_VisionSkipped(t *testing.T) {
+	tests := []struct {
+		name       string
+		imageURL   string
+		screenshot string
+		visionErr  error
+		visionRun  int
+	}{
+		{"no lead image", "", "", nil, 0},
+		{"vision error keeps the text score", "https://example.com/cat.jpg", "", errors.New("image too large"), 1},
+		{"missing screenshot", "", "/nonexistent/screenshots/cats.png", nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			textLLM := &MockLlmClient{Response: `{"is_joke": true, "confidence": 40, "reasoning": "Odd claims"}`}
+			visionLLM := &MockLlmClient{Error: tt.visionErr}
+			client := &VisionLlmClient{Text: textLLM, Vision: visionLLM, Weight: 0.5}
+			page := &models.CrawledPage{URL: "example.com/cats", Title: "Cats", Content: "Cats.", ImageURL: tt.imageURL, Screenshot: tt.screenshot}
+
+			result, err := analyzePage(context.Background(), page, client, AnalysisModeJoke, LanguagePolicyAsIs, 0,
+				lib.NewMockDatastoreClient(), false, false)
+			if err != nil {
+				t.Fatalf("analyzePage() error = %v", err)
+			}
+			if *result.JokePercentage != 40 || result.Image != nil {
+				t.Errorf("result = %d%% with image %+v, want the text score only", *result.JokePercentage, result.Image)
+			}
+			if visionLLM.Calls != tt.visionRun {
+				t.Errorf("vision calls = %d, want %d", visionLLM.Calls, tt.visionRun)
+			}
+		})
+	}
+}
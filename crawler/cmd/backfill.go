@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/crawler/config"
+	"github.com/zeace/poisson/lib/logging"
+)
+
+// backfillTimeout bounds a whole backfill run
+const backfillTimeout = 30 * time.Minute
+
+// runBackfill handles the "backfill" subcommand: it analyzes the articles that were stored as
+// pending by --defer-analysis while the LLM was unavailable, only those of the pages matching
+// --select if it is set.
+func runBackfill(args []string) {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	var (
+		prompts   = flags.String("prompts", "", "Directory or gs://bucket/prefix with <mode>.prompt.md templates replacing the embedded ones (or set POISSON_PROMPTS environment variable)")
+		jokeWords = flags.String("joke-keywords", "", "Hedging keywords that keep a \"not a joke\" verdict from being inverted, as <language>:<keyword>,...;... e.g. en:joke,prank,satire (or set POISSON_JOKE_KEYWORDS environment variable)")
+		apiKey    = flags.String("api-key", "", "OpenAI API key (or set OPENAI_API_KEY environment variable)")
+		baseURL   = flags.String("base-url", "", "Base URL of an OpenAI-compatible API (or set OPENAI_BASE_URL environment variable)")
+		model     = flags.String("model", "", "LLM model name, overrides the per-mode default (or set OPENAI_MODEL environment variable)")
+		lang      = flags.String("language", "", "How to analyze non-English articles: as-is, instruct (tell the LLM the article language) or translate (translate into English first) (or set POISSON_LANGUAGE_POLICY environment variable)")
+		selector  = flags.String("select", "", "Only analyze the pending analyses of the stored pages matching this selector, e.g. '{domain: \"example.com\", since: \"2025-03-01\", language: \"fr\", minLength: 2000}' (see the reanalyze subcommand)")
+		verbose   = flags.Bool("verbose", false, "Show verbose output")
+		logLevel  = flags.String("log-level", "", "Minimum log level: debug, info, warn or error (or set POISSON_LOG_LEVEL environment variable)")
+		logFormat = flags.String("log-format", "", "Log format: text or json (or set POISSON_LOG_FORMAT environment variable)")
+	)
+	flags.Parse(args)
+
+	if err := logging.Init(*logLevel, *logFormat); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	languagePolicy, err := analyzer.ParseLanguagePolicy(config.GetLanguagePolicy(*lang))
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	pageSelector, err := analyzer.ParsePageSelector(*selector)
+	if err != nil {
+		log.Fatalf("Error: --select: %v\n", err)
+	}
+
+	loadPromptTemplates(*prompts)
+	loadJokeKeywords(*jokeWords)
+	loadMinContentLengths("", "")
+
+	datastoreClient := setupDatastore()
+	defer datastoreClient.Close()
+
+	llmOptions := analyzer.LlmOptions{
+		APIKey:  config.GetOpenAIKey(*apiKey),
+		BaseURL: config.GetOpenAIBaseURL(*baseURL),
+		Model:   config.GetOpenAIModel(*model),
+
+		Language: languagePolicy,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backfillTimeout)
+	defer cancel()
+
+	result, err := analyzer.BackfillPendingAnalyses(ctx, llmOptions, config.AnalysisTimeout, pageSelector, datastoreClient, *verbose)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	log.Printf("\n%s\n", strings.Repeat("=", 60))
+	log.Printf("Backfilled %d pending analysis(es), %d failed\n", result.Analyzed, result.Failed)
+	if result.Remaining > 0 {
+		log.Printf("LLM still unavailable, %d analysis(es) left pending\n", result.Remaining)
+	}
+	if result.Skipped > 0 {
+		log.Printf("%d analysis(es) of pages not matching --select left pending\n", result.Skipped)
+	}
+	log.Printf("%s\n", strings.Repeat("=", 60))
+	displayUsage(result.Usage)
+}
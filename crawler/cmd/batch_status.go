@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/crawler/config"
+	"github.com/zeace/poisson/lib/logging"
+)
+
+// batchStatusTimeout bounds a single submission or collection pass
+const batchStatusTimeout = 30 * time.Minute
+
+// runBatchStatus handles the "batch-status" subcommand: it submits the analyses queued by
+// --batch-analysis to the OpenAI Batch API, shows the status of the open batches and stores the
+// results of the finished ones.
+func runBatchStatus(args []string) {
+	flags := flag.NewFlagSet("batch-status", flag.ExitOnError)
+	var (
+		submit    = flags.Bool("submit", false, "Submit the analyses queued by --batch-analysis before checking the batches")
+		wait      = flags.Bool("wait", false, "Keep polling until every batch is finished and collected")
+		interval  = flags.Duration("interval", time.Minute, "With --wait, time between polls")
+		prompts   = flags.String("prompts", "", "Directory or gs://bucket/prefix with <mode>.prompt.md templates replacing the embedded ones (or set POISSON_PROMPTS environment variable)")
+		jokeWords = flags.String("joke-keywords", "", "Hedging keywords that keep a \"not a joke\" verdict from being inverted, as <language>:<keyword>,...;... e.g. en:joke,prank,satire (or set POISSON_JOKE_KEYWORDS environment variable)")
+		apiKey    = flags.String("api-key", "", "OpenAI API key (or set OPENAI_API_KEY environment variable)")
+		baseURL   = flags.String("base-url", "", "Base URL of an OpenAI-compatible API with the Batch API (or set OPENAI_BASE_URL environment variable)")
+		model     = flags.String("model", "", "LLM model name, overrides the per-mode default (or set OPENAI_MODEL environment variable)")
+		lang      = flags.String("language", "", "How to analyze non-English articles: as-is, instruct (tell the LLM the article language) or translate (translate into English first) (or set POISSON_LANGUAGE_POLICY environment variable)")
+		verbose   = flags.Bool("verbose", false, "Show verbose output")
+		logLevel  = flags.String("log-level", "", "Minimum log level: debug, info, warn or error (or set POISSON_LOG_LEVEL environment variable)")
+		logFormat = flags.String("log-format", "", "Log format: text or json (or set POISSON_LOG_FORMAT environment variable)")
+	)
+	flags.Parse(args)
+
+	if err := logging.Init(*logLevel, *logFormat); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if *interval <= 0 {
+		log.Fatalf("Error: --interval must be above zero\n")
+	}
+
+	languagePolicy, err := analyzer.ParseLanguagePolicy(config.GetLanguagePolicy(*lang))
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	loadPromptTemplates(*prompts)
+	loadJokeKeywords(*jokeWords)
+	loadMinContentLengths("", "")
+
+	datastoreClient := setupDatastore()
+	defer datastoreClient.Close()
+
+	llmOptions := analyzer.LlmOptions{
+		APIKey:  config.GetOpenAIKey(*apiKey),
+		BaseURL: config.GetOpenAIBaseURL(*baseURL),
+		Model:   config.GetOpenAIModel(*model),
+
+		Language: languagePolicy,
+	}
+
+	if *submit {
+		ctx, cancel := context.WithTimeout(context.Background(), batchStatusTimeout)
+		submission, err := analyzer.SubmitLlmBatches(ctx, llmOptions, datastoreClient, *verbose)
+		cancel()
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		log.Printf("Submitted %d analysis(es) in %d batch(es), %d served from the cache, %d failed\n",
+			submission.Submitted, len(submission.Batches), submission.Cached, submission.Failed)
+	}
+
+	var usage analyzer.UsageTotals
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), batchStatusTimeout)
+		collection, err := analyzer.CollectLlmBatches(ctx, llmOptions, datastoreClient, *verbose)
+		cancel()
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		usage.Analyses += collection.Usage.Analyses
+		usage.CachedAnalyses += collection.Usage.CachedAnalyses
+		usage.PromptTokens += collection.Usage.PromptTokens
+		usage.CompletionTokens += collection.Usage.CompletionTokens
+		usage.CostUSD += collection.Usage.CostUSD
+
+		open := displayBatches(collection)
+		if !*wait || open == 0 {
+			break
+		}
+		log.Printf("Waiting for %d open batch(es)...\n", open)
+		time.Sleep(*interval)
+	}
+	displayUsage(usage)
+}
+
+// displayBatches prints the status of the batches checked by a collection and returns the number
+// still open.
+func displayBatches(collection analyzer.BatchCollection) int {
+	log.Printf("\n%s\n", strings.Repeat("=", 60))
+	if len(collection.Batches) == 0 {
+		log.Printf("No open batches\n")
+	}
+	open := 0
+	for _, batch := range collection.Batches {
+		collected := ""
+		if batch.Open() {
+			open++
+		} else {
+			collected = ", collected"
+		}
+		log.Printf("%s (%s): %s, %d/%d done, %d failed%s\n",
+			batch.ID, batch.Model, batch.Status, batch.Completed+batch.Failed, batch.Requests, batch.Failed, collected)
+	}
+	if collection.Analyzed > 0 || collection.Failed > 0 {
+		log.Printf("Stored %d analysis(es), %d queued again\n", collection.Analyzed, collection.Failed)
+	}
+	log.Printf("%s\n", strings.Repeat("=", 60))
+	return open
+}
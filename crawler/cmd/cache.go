@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/zeace/poisson/crawler/config"
+	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/crawler/utils"
+	"github.com/zeace/poisson/lib/logging"
+)
+
+// cacheTimeout bounds listing and purging the page cache
+const cacheTimeout = 10 * time.Minute
+
+// runCache handles the "cache" subcommand: it shows the size of the disk or Cloud Storage page
+// cache of article texts, trims it to a max size or a max age, or clears it. The Datastore
+// cache is left as is.
+func runCache(args []string) {
+	flags := flag.NewFlagSet("cache", flag.ExitOnError)
+	var (
+		action    = flags.String("action", "stats", "What to do with the page cache: stats, trim or clear")
+		pgCache   = flags.String("page-cache", "", "Page cache to manage: disk (the cache directory) or a gs://bucket/prefix URL (or set POISSON_PAGE_CACHE environment variable, default: disk)")
+		maxSize   = flags.String("max-size", "", "With --action trim, size the cache is trimmed to, least recently used texts first, e.g. 200MB or 2GB (or set POISSON_FILE_CACHE_MAX_SIZE environment variable, default: 512MB)")
+		unusedFor = flags.String("unused-for", "", "With --action trim, also remove the files not used for this long, e.g. 30d or 12h")
+		logLevel  = flags.String("log-level", "", "Minimum log level: debug, info, warn or error (or set POISSON_LOG_LEVEL environment variable)")
+		logFormat = flags.String("log-format", "", "Log format: text or json (or set POISSON_LOG_FORMAT environment variable)")
+	)
+	flags.Parse(args)
+
+	if err := logging.Init(*logLevel, *logFormat); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if *action != "stats" && *action != "trim" && *action != "clear" {
+		log.Printf("Error: unknown action '%s'. Valid actions: stats, trim, clear\n", *action)
+		log.Printf("Usage: %s cache [flags]\n", os.Args[0])
+		flags.PrintDefaults()
+		log.Fatalf("")
+	}
+
+	cache, err := fetcher.OpenPageCache(config.GetPageCache(*pgCache), 0)
+	if err != nil {
+		log.Fatalf("Error: --page-cache: %v\n", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cacheTimeout)
+	defer cancel()
+
+	switch *action {
+	case "stats":
+		stats, err := cache.Usage(ctx)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		log.Printf("%d article text(s), %s\n", stats.Files, formatBytes(stats.Size))
+		if !stats.Oldest.IsZero() {
+			log.Printf("Least recently used text written at %s\n", stats.Oldest.Format(time.RFC3339))
+		}
+
+	case "trim":
+		size, err := fetcher.ParseFileCacheMaxSize(config.GetFileCacheMaxSize(*maxSize))
+		if err != nil {
+			log.Fatalf("Error: --max-size: %v\n", err)
+		}
+		if size == 0 {
+			size = fetcher.DefaultFileCacheMaxSize
+		}
+		unused, err := utils.ParseMaxAge(*unusedFor)
+		if err != nil {
+			log.Fatalf("Error: --unused-for: %v\n", err)
+		}
+		removed, err := cache.Purge(ctx, fetcher.CachePurge{MaxSize: max(size, 0), UnusedFor: unused})
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		log.Printf("Removed %d article text(s), %s\n", removed.Files, formatBytes(removed.Size))
+
+	case "clear":
+		removed, err := cache.Purge(ctx, fetcher.CachePurge{All: true})
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		log.Printf("Removed %d article text(s), %s\n", removed.Files, formatBytes(removed.Size))
+	}
+}
+
+// formatBytes formats size in the largest unit it holds at least one of.
+func formatBytes(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+	"github.com/zeace/poisson/models"
+)
+
+// calibrationTimeout bounds labeling an article or building a calibration report
+const calibrationTimeout = 5 * time.Minute
+
+// runLabel handles the "label" subcommand: it stores a human verdict on whether an article is
+// a joke, which calibration reports compare with the analyses of the article.
+func runLabel(args []string) {
+	flags := flag.NewFlagSet("label", flag.ExitOnError)
+	var (
+		url       = flags.String("url", "", "URL of the article to label")
+		joke      = flags.Bool("joke", false, "Label the article as a joke (the default labels it as not a joke)")
+		labeler   = flags.String("labeler", "", "Name of the person labeling the article")
+		logLevel  = flags.String("log-level", "", "Minimum log level: debug, info, warn or error (or set POISSON_LOG_LEVEL environment variable)")
+		logFormat = flags.String("log-format", "", "Log format: text or json (or set POISSON_LOG_FORMAT environment variable)")
+	)
+	flags.Parse(args)
+
+	if err := logging.Init(*logLevel, *logFormat); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if *url == "" {
+		log.Printf("Error: --url is required\n")
+		log.Printf("Usage: %s label --url <url> [--joke] [flags]\n", os.Args[0])
+		flags.PrintDefaults()
+		log.Fatalf("")
+	}
+
+	datastoreClient := setupDatastore()
+	defer datastoreClient.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), calibrationTimeout)
+	defer cancel()
+
+	label := &models.JokeLabel{
+		URL:       lib.NormalizeURL(*url),
+		IsJoke:    *joke,
+		Labeler:   *labeler,
+		CreatedAt: time.Now(),
+	}
+	if err := datastoreClient.WriteJokeLabel(ctx, label); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	lib.RecordAuditEvent(ctx, datastoreClient, &models.AuditEvent{
+		URL:    label.URL,
+		Action: models.AuditActionLabeled,
+		Detail: models.LabelVerdict(label.IsJoke),
+		Actor:  label.Labeler,
+	})
+	log.Printf("Labeled %s: joke=%v\n", label.URL, label.IsJoke)
+}
+
+// runCalibration handles the "calibration" subcommand: it compares the joke percentages of a
+// mode with the human labels of the analyzed articles.
+func runCalibration(args []string) {
+	flags := flag.NewFlagSet("calibration", flag.ExitOnError)
+	var (
+		mode      = flags.String("mode", "joke", "Analysis mode to calibrate")
+		buckets   = flags.Int("buckets", analyzer.DefaultCalibrationBuckets, "Number of confidence buckets, from 1 to 100")
+		jsonOut   = flags.Bool("json", false, "Print the report as JSON")
+		logLevel  = flags.String("log-level", "", "Minimum log level: debug, info, warn or error (or set POISSON_LOG_LEVEL environment variable)")
+		logFormat = flags.String("log-format", "", "Log format: text or json (or set POISSON_LOG_FORMAT environment variable)")
+	)
+	flags.Parse(args)
+
+	if err := logging.Init(*logLevel, *logFormat); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	promptMode, err := analyzer.VerifyValidMode(*mode)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if *buckets < 1 || *buckets > 100 {
+		log.Fatalf("Error: --buckets must be between 1 and 100, got %d\n", *buckets)
+	}
+
+	datastoreClient := setupDatastore()
+	defer datastoreClient.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), calibrationTimeout)
+	defer cancel()
+
+	report, err := analyzer.Calibrate(ctx, datastoreClient, promptMode, *buckets)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	if *jsonOut {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		return
+	}
+	log.Printf("Calibration of %s mode: %d labeled analyses, %d labeled articles without analysis\n",
+		report.Mode, report.Labeled, report.Unanalyzed)
+	for _, bucket := range report.Buckets {
+		if bucket.Count == 0 {
+			log.Printf("  %3d-%3d%%: no analyses\n", bucket.MinConfidence, bucket.MaxConfidence)
+			continue
+		}
+		log.Printf("  %3d-%3d%%: %4d analyses, mean confidence %5.1f%%, observed jokes %5.1f%%\n",
+			bucket.MinConfidence, bucket.MaxConfidence, bucket.Count, bucket.MeanConfidence, bucket.ObservedJokeRate)
+	}
+	log.Printf("Brier score: %.4f\n", report.BrierScore)
+	log.Printf("Expected calibration error: %.1f percentage points\n", report.ExpectedCalibrationError)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/crawler/config"
+	"github.com/zeace/poisson/crawler/feedpoller"
+	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/crawler/rssfetcher"
+	"github.com/zeace/poisson/crawler/utils"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// runDaemonMode polls the feeds of the registry until SIGINT or SIGTERM, analyzing the articles
+// of each poll like runRSSMode. The poller status is served on --status-addr while it runs.
+func runDaemonMode(cfg *Config, llmOptions analyzer.LlmOptions, datastoreClient lib.DatastoreClient) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Built once so that the polls share the browser of --render
+	options := fetchOptions(cfg)
+
+	// The articles of all the polls are fetched through one queue, so that feeds on the same
+	// host share its --per-host and --host-delay limits. It runs until the polls have ended.
+	queue := fetcher.NewQueue(datastoreClient, cfg.Verbose, fetcher.QueueOptions{
+		Concurrency:        cfg.Concurrency,
+		PerHostConcurrency: cfg.PerHost,
+		HostDelay:          cfg.HostDelay,
+	})
+	queueCtx, stopQueue := context.WithCancel(context.Background())
+	queueDone := make(chan struct{})
+	go func() {
+		queue.Run(queueCtx)
+		close(queueDone)
+	}()
+	defer func() {
+		stopQueue()
+		<-queueDone
+	}()
+	options.Queue = queue
+	poller := feedpoller.New(datastoreClient, func(ctx context.Context, feed *models.FeedSource) (feedpoller.PollResult, error) {
+		return pollFeed(ctx, cfg, llmOptions, options, feed, datastoreClient)
+	}, feedpoller.Options{
+		Interval:      cfg.PollInterval,
+		Concurrency:   cfg.FeedConcurrency,
+		ShutdownGrace: cfg.ShutdownGrace,
+		NoLock:        cfg.NoLock,
+	})
+
+	if cfg.StatusAddr != "" {
+		statusServer := startStatusServer(cfg.StatusAddr, poller)
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := statusServer.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Warning: stopping status server: %v\n", err)
+			}
+		}()
+	}
+
+	log.Printf("Polling the registered feeds every %s unless they have their own interval, press Ctrl+C to stop\n", cfg.PollInterval)
+	poller.Run(ctx)
+	log.Printf("Stopped polling feeds\n")
+}
+
+// startStatusServer serves the status of poller on /status and a health check on /health at addr.
+// It exits if addr can't be listened on.
+func startStatusServer(addr string, poller *feedpoller.Poller) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/status", poller)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		status := "ok"
+		w.Header().Set("Content-Type", "application/json")
+		if poller.Status().ShuttingDown {
+			status = "shutting down"
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": status})
+	})
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Error: status server: %v\n", err)
+		}
+	}()
+	log.Printf("Serving the poller status on %s/status\n", addr)
+	return server
+}
+
+// pollFeed fetches the articles of feed and analyzes those that were not stored before, for the
+// daemon. ctx is cancelled if the feed lease is lost or the shutdown grace period ends.
+func pollFeed(
+	ctx context.Context,
+	cfg *Config,
+	llmOptions analyzer.LlmOptions,
+	options fetcher.Options,
+	feed *models.FeedSource,
+	datastoreClient lib.DatastoreClient,
+) (feedpoller.PollResult, error) {
+	// The settings of the feed replace the flags of the daemon
+	cfg = feedConfig(cfg, feed, nil)
+	options.HostDelay = cfg.HostDelay
+
+	rssCtx, rssCancel := context.WithTimeout(ctx, config.RSSTimeout)
+	defer rssCancel()
+
+	// The filter is built on every poll so that ages given to --since and --until slide
+	pages, summary, err := rssfetcher.FetchRSSArticles(rssCtx, feed.URL, cfg.Max, utils.Sample{}, itemFilterOf(cfg), cfg.Verbose, datastoreClient, options)
+	var result feedpoller.PollResult
+	if summary != nil {
+		displayFetchSummary(summary)
+		result.Fetched = summary.Fetched
+		result.New = summary.New
+	}
+	if err != nil {
+		return result, fmt.Errorf("error fetching RSS articles: %w", err)
+	}
+
+	// The articles stored by an earlier poll were analyzed then
+	var newPages []*models.CrawledPage
+	for _, page := range pages {
+		if summary.IsNew(page) {
+			newPages = append(newPages, page)
+		}
+	}
+	pages = newPages
+	if len(pages) == 0 {
+		return result, nil
+	}
+
+	log.Printf("Analyzing %d new article(s) from %s in %s mode\n", len(pages), feed.URL, modeList(analysisModes(cfg)))
+	result.Analyzed, result.Failed = analyzeAndDisplay(ctx, cfg, llmOptions, pages, datastoreClient)
+	return result, nil
+}
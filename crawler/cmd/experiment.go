@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/lib/logging"
+)
+
+// maxHistogramBar is the length of the longest bar of the score histograms
+const maxHistogramBar = 40
+
+// runExperiment handles the "experiment" subcommand: it compares the score distributions of the
+// variants of a prompt experiment run with --experiment.
+func runExperiment(args []string) {
+	flags := flag.NewFlagSet("experiment", flag.ExitOnError)
+	var (
+		id        = flags.String("id", "", "ID of the experiment to report on")
+		mode      = flags.String("mode", "joke", "Analysis mode of the experiment")
+		jsonOut   = flags.Bool("json", false, "Print the report as JSON")
+		logLevel  = flags.String("log-level", "", "Minimum log level: debug, info, warn or error (or set POISSON_LOG_LEVEL environment variable)")
+		logFormat = flags.String("log-format", "", "Log format: text or json (or set POISSON_LOG_FORMAT environment variable)")
+	)
+	flags.Parse(args)
+
+	if err := logging.Init(*logLevel, *logFormat); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if *id == "" {
+		log.Printf("Error: --id is required\n")
+		log.Printf("Usage: %s experiment --id <experiment> [flags]\n", os.Args[0])
+		flags.PrintDefaults()
+		log.Fatalf("")
+	}
+	promptMode, err := analyzer.VerifyValidMode(*mode)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	datastoreClient := setupDatastore()
+	defer datastoreClient.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), calibrationTimeout)
+	defer cancel()
+
+	report, err := analyzer.CompareExperiment(ctx, datastoreClient, promptMode, *id)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	if *jsonOut {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		return
+	}
+	if len(report.Variants) == 0 {
+		log.Printf("No analyses of experiment %s in %s mode\n", report.ID, report.Mode)
+		return
+	}
+	log.Printf("Experiment %s in %s mode:\n", report.ID, report.Mode)
+	for _, stats := range report.Variants {
+		log.Printf("  %s: %d analyses, mean %.1f%%, median %.1f%%, std dev %.1f, scoring 50%%+ %.1f%%\n",
+			stats.Variant, stats.Count, stats.Mean, stats.Median, stats.StdDev, stats.JokeRate)
+		for i, count := range stats.Histogram {
+			bar := strings.Repeat("#", min(count, maxHistogramBar))
+			if count > maxHistogramBar {
+				bar += "+"
+			}
+			log.Printf("    %3d%%: %4d %s\n", i*10, count, bar)
+		}
+		if stats.Labeled > 0 {
+			log.Printf("    Brier score on %d labeled articles: %.4f\n", stats.Labeled, stats.BrierScore)
+		}
+	}
+}
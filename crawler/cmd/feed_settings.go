@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/crawler/config"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// feedConfig returns a copy of cfg with the settings of the registered feed: its analysis modes,
+// max articles and host delay, except those whose flag is in explicit. Settings the feed leaves
+// unset keep the value of cfg.
+func feedConfig(cfg *Config, feed *models.FeedSource, explicit map[string]bool) *Config {
+	feedCfg := *cfg
+	if len(feed.Modes) > 0 && !explicit["mode"] {
+		feedCfg.Modes = feed.Modes
+	}
+	if feed.MaxArticles > 0 && !explicit["max"] {
+		feedCfg.Max = feed.MaxArticles
+	}
+	if feed.HostDelay > 0 && !explicit["host-delay"] {
+		feedCfg.HostDelay = feed.HostDelay
+	}
+	return &feedCfg
+}
+
+// withRegisteredFeedSettings returns cfg with the settings of its --rss feed if it is in the
+// registry, so that a run of a registered feed analyzes it like the daemon does. Flags given on
+// the command line take precedence. If the registry can't be read, cfg is returned unchanged.
+func withRegisteredFeedSettings(cfg *Config, datastoreClient lib.DatastoreClient) *Config {
+	ctx, cancel := config.NewDatastoreContext()
+	defer cancel()
+	feed, found, err := datastoreClient.ReadFeedSource(ctx, strings.TrimSpace(cfg.RSS))
+	if err != nil {
+		log.Printf("Warning: reading the feed registry: %v\n", err)
+		return cfg
+	}
+	if !found {
+		return cfg
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	feedCfg := feedConfig(cfg, feed, explicit)
+	if feedCfg.Max != cfg.Max || feedCfg.HostDelay != cfg.HostDelay || len(feedCfg.Modes) > 0 {
+		log.Printf("Using the registry settings of %s: modes %s, max %d, host delay %s\n",
+			feed.URL, modeList(analysisModes(feedCfg)), feedCfg.Max, feedCfg.HostDelay)
+	}
+	return feedCfg
+}
+
+// analysisModes returns the analysis modes of cfg, which must have been validated: the modes of
+// its registered feed, or --mode.
+func analysisModes(cfg *Config) []analyzer.AnalysisMode {
+	if len(cfg.Modes) > 0 {
+		return cfg.Modes
+	}
+	mode, _ := analyzer.VerifyValidMode(cfg.Mode)
+	return []analyzer.AnalysisMode{mode}
+}
+
+// modeList formats modes for the output, as a comma-separated list.
+func modeList(modes []analyzer.AnalysisMode) string {
+	names := make([]string, len(modes))
+	for i, mode := range modes {
+		names[i] = string(mode)
+	}
+	return strings.Join(names, ",")
+}
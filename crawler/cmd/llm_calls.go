@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/crawler/utils"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+)
+
+// llmCallsTimeout bounds listing and purging logged LLM calls
+const llmCallsTimeout = 5 * time.Minute
+
+// runLlmCalls handles the "llm-calls" subcommand: it lists the LLM calls logged with
+// --log-llm-calls while analyzing a URL, or deletes the calls older than the retention period.
+func runLlmCalls(args []string) {
+	flags := flag.NewFlagSet("llm-calls", flag.ExitOnError)
+	var (
+		url       = flags.String("url", "", "URL whose logged LLM calls are listed")
+		purge     = flags.Bool("purge", false, "Delete the logged LLM calls older than --retention instead of listing calls")
+		retention = flags.String("retention", "30d", "With --purge, how long LLM calls are kept, e.g. 30d or 12h")
+		logLevel  = flags.String("log-level", "", "Minimum log level: debug, info, warn or error (or set POISSON_LOG_LEVEL environment variable)")
+		logFormat = flags.String("log-format", "", "Log format: text or json (or set POISSON_LOG_FORMAT environment variable)")
+	)
+	flags.Parse(args)
+
+	if err := logging.Init(*logLevel, *logFormat); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if (*url == "") == !*purge {
+		log.Printf("Error: exactly one of --url or --purge must be provided\n")
+		log.Printf("Usage: %s llm-calls --url <url> | --purge [--retention 30d]\n", os.Args[0])
+		flags.PrintDefaults()
+		log.Fatalf("")
+	}
+	maxAge, err := utils.ParseMaxAge(*retention)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if maxAge == 0 {
+		log.Fatalf("Error: --retention must be above zero\n")
+	}
+
+	datastoreClient := setupDatastore()
+	defer datastoreClient.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), llmCallsTimeout)
+	defer cancel()
+
+	if *purge {
+		deleted, err := analyzer.PurgeLlmCalls(ctx, datastoreClient, maxAge)
+		if err != nil {
+			log.Fatalf("Error purging LLM calls: %v\n", err)
+		}
+		log.Printf("Deleted %d LLM call(s) older than %s\n", deleted, *retention)
+		return
+	}
+
+	calls, err := datastoreClient.ListLlmCalls(ctx, lib.NormalizeURL(*url))
+	if err != nil {
+		log.Fatalf("Error listing LLM calls: %v\n", err)
+	}
+	// One JSON object per line, with the raw responses
+	encoder := json.NewEncoder(os.Stdout)
+	for _, call := range calls {
+		if err := encoder.Encode(call); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+	}
+	log.Printf("%d LLM call(s) logged for %s\n", len(calls), lib.NormalizeURL(*url))
+}
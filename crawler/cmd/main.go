@@ -1,65 +1,528 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"math"
+	"math/rand/v2"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/zeace/poisson/crawler/analyzer"
 	"github.com/zeace/poisson/crawler/config"
+	"github.com/zeace/poisson/crawler/embeddings"
+	"github.com/zeace/poisson/crawler/feedpoller"
 	"github.com/zeace/poisson/crawler/fetcher"
 	"github.com/zeace/poisson/crawler/rssfetcher"
+	"github.com/zeace/poisson/crawler/sitecrawler"
+	"github.com/zeace/poisson/crawler/sitemapfetcher"
 	"github.com/zeace/poisson/crawler/utils"
 	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
 	"github.com/zeace/poisson/models"
 )
 
 // Config holds the application configuration parsed from command-line flags
 type Config struct {
 	APIKey  string
+	BaseURL string
+	Model   string
 	Verbose bool
 	URL     string
 	RSS     string
-	Max     int
-	Mode    string
+	// Sitemap is the URL of a sitemap or sitemap index whose articles are analyzed, and
+	// SitemapSince how recently they must have been modified (see utils.ParseMaxAge)
+	Sitemap      string
+	SitemapSince string
+	// Crawl is the seed URL of a site whose articles are found by following its links, at most
+	// CrawlDepth links away and reading at most CrawlPages pages for links
+	Crawl      string
+	CrawlDepth int
+	CrawlPages int
+	// URLsFile is a file with one article URL per line to analyze
+	URLsFile string
+	Max      int
+	// Newsletters is a Maildir or a directory of .eml files whose newsletters are analyzed
+	Newsletters string
+	// Daemon polls the feeds of the registry (see models.FeedSource) until interrupted, every
+	// PollInterval unless a feed has its own, at most FeedConcurrency at once, serving the
+	// poller status on StatusAddr and giving the polls in progress ShutdownGrace to finish
+	Daemon          bool
+	PollInterval    time.Duration
+	FeedConcurrency int
+	StatusAddr      string
+	ShutdownGrace   time.Duration
+	// Sample analyzes a random sample of the feed, sitemap or file instead of its first
+	// Max articles (see utils.ParseSample)
+	Sample string
+	// Include and Exclude select the RSS feed items by their title and description (see
+	// rssfetcher.ParseItemFilter), Since and Until by their publication date (see
+	// rssfetcher.ParsePublishedWindow)
+	Include string
+	Exclude string
+	Since   string
+	Until   string
+	// Seed draws the sample and is sent with the LLM calls, so that a run can be reproduced.
+	// Zero means a random sample seed and no LLM seed.
+	Seed int64
+	Mode string
+	// Modes are the analysis modes of a registered feed, replacing Mode when set (see feedConfig)
+	Modes  []analyzer.AnalysisMode
+	Robots string
+	Stream bool
+	// NoLock disables the per-feed lease that keeps concurrent instances from polling the same feed
+	NoLock bool
+	// Prompts is a directory or gs:// URL with prompt templates replacing the embedded ones
+	Prompts string
+	// Experiment is the ID of a prompt experiment comparing the Variants of the mode's prompt
+	Experiment string
+	// Variants are the experiment's prompt variants, as <name>=<path>,...
+	Variants string
+	// JokeKeywords are the hedging keywords of joke scoring (see analyzer.ParseJokeKeywords)
+	JokeKeywords string
+	// LogLevel and LogFormat configure structured logging (see lib/logging)
+	LogLevel  string
+	LogFormat string
+	// Concurrency limits parallel article fetches in RSS mode
+	Concurrency int
+	// PerHost limits parallel requests to a single host in RSS mode
+	PerHost int
+	// HostDelay is the minimum time between the starts of two requests to the same host
+	HostDelay time.Duration
+	// FetchAttempts is the number of attempts at fetching an article that fails transiently
+	FetchAttempts int
+	// MaxBodyMB is the size in MB above which an article response is abandoned
+	MaxBodyMB int
+	// AllowPrivate lets feeds and articles be fetched from private addresses
+	AllowPrivate bool
+	// FailureCooldown is how long an article whose fetch failed is skipped
+	FailureCooldown time.Duration
+	// LlmConcurrency limits parallel LLM calls in RSS mode
+	LlmConcurrency int
+	// DeferAnalysis stores articles as pending instead of failing when the LLM is unavailable in RSS mode
+	DeferAnalysis bool
+	// BatchAnalysis queues analyses for the OpenAI Batch API instead of calling the LLM in RSS mode
+	BatchAnalysis bool
+	// Generation overrides the per-mode LLM generation parameters
+	Generation analyzer.GenerationParams
+	// MaxContentLength overrides the per-mode and per-model content length limits, if positive
+	MaxContentLength int
+	// MinContentLengths are the per-mode minimum content lengths of analyzed articles (see analyzer.ParseMinContentLengths)
+	MinContentLengths string
+	// MinWordCounts are the per-mode minimum word counts of analyzed articles (see analyzer.ParseMinWordCounts)
+	MinWordCounts string
+	// Language is the policy for non-English articles (see analyzer.LanguagePolicy)
+	Language string
+	// FeedAuth references the credentials of a private feed (see fetcher.ParseFeedAuth)
+	FeedAuth string
+	// StructuredData is the JSON-LD structured data policy (see fetcher.StructuredDataPolicy)
+	StructuredData string
+	// Proxy holds the proxy rules of article fetches (see fetcher.ParseProxy)
+	Proxy string
+	// Revalidate refetches cached articles with conditional requests (see fetcher.Options.Revalidate)
+	Revalidate bool
+	// CacheMaxAge holds the max ages of cached articles (see fetcher.ParseCacheMaxAge)
+	CacheMaxAge string
+	// ForceRefresh fetches every article from its URL, ignoring the cache
+	ForceRefresh bool
+	// PageCache is where article texts are cached (see fetcher.OpenPageCache), and
+	// FileCacheMaxSize its max size (see fetcher.ParseFileCacheMaxSize)
+	PageCache        string
+	FileCacheMaxSize string
+	// Cache is the page cache of the run, opened by main
+	Cache fetcher.PageCache
+	// PaywallFallback reads paywalled articles from their AMP version or ArchiveMirrors (see
+	// fetcher.ParseArchiveMirrors)
+	PaywallFallback bool
+	ArchiveMirrors  string
+	// DomainBoilerplate strips text blocks repeated on many pages of the same site
+	DomainBoilerplate bool
+	// Render loads pages with less than RenderThreshold characters of text in the browser at ChromePath
+	Render          bool
+	RenderThreshold int
+	ChromePath      string
+	// ChromeNoSandbox runs the browser without its sandbox
+	ChromeNoSandbox bool
+	// Screenshots is where a screenshot of every fetched page is stored, with --render (see
+	// fetcher.OpenScreenshotStore)
+	Screenshots string
+	// LogLlmCalls stores every LLM request and response, kept for LlmCallRetention
+	LogLlmCalls      bool
+	LlmCallRetention string
+	// Dedupe skips analyzing articles that are near-duplicates of one seen recently
+	Dedupe bool
+	// DedupeThreshold is the cosine similarity above which an article is a near-duplicate
+	DedupeThreshold float64
+	// EmbeddingModel is the model used to compute article embeddings for Dedupe
+	EmbeddingModel string
+	// EnsembleRuns, EnsembleModels and EnsembleMethod configure ensemble scoring
+	// (see analyzer.EnsembleOptions). EnsembleModels is comma-separated.
+	EnsembleRuns   int
+	EnsembleModels string
+	EnsembleMethod string
+	// VisionModel and VisionWeight configure the analysis of lead images (see analyzer.VisionOptions)
+	VisionModel  string
+	VisionWeight float64
+	// ScreenThreshold and ScreenModel configure headline screening (see analyzer.HeadlineScreening)
+	ScreenThreshold int
+	ScreenModel     string
+	// MaxAge is how long cached analyses are used before re-analyzing (see utils.ParseMaxAge)
+	MaxAge string
+	// WARCDir is a directory receiving a WARC file with the responses fetched during the run
+	WARCDir string
+	// WARC is the writer of the run's WARC file, opened by main if WARCDir is set
+	WARC *fetcher.WARCWriter
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "warm":
+			// Pre-populate the page cache for a feed without analyzing it
+			runWarm(os.Args[2:])
+			return
+		case "backfill":
+			// Analyze articles stored as pending while the LLM was unavailable
+			runBackfill(os.Args[2:])
+			return
+		case "batch-status":
+			// Submit analyses queued for the OpenAI Batch API and collect the finished batches
+			runBatchStatus(os.Args[2:])
+			return
+		case "stale":
+			// List, purge or re-run analyses made with an outdated prompt
+			runStale(os.Args[2:])
+			return
+		case "modes":
+			// List the valid analysis modes
+			runModes(os.Args[2:])
+			return
+		case "reanalyze":
+			// Force new analyses of a URL, a date range or the analyses older than a maximum age
+			runReanalyze(os.Args[2:])
+			return
+		case "label":
+			// Store a human verdict on whether an article is a joke
+			runLabel(os.Args[2:])
+			return
+		case "calibration":
+			// Compare the joke percentages of a mode with human labels
+			runCalibration(os.Args[2:])
+			return
+		case "llm-calls":
+			// List or purge the logged LLM calls
+			runLlmCalls(os.Args[2:])
+			return
+		case "cache":
+			// Show, trim or clear the local file cache of article texts
+			runCache(os.Args[2:])
+			return
+		case "experiment":
+			// Compare the score distributions of the variants of a prompt experiment
+			runExperiment(os.Args[2:])
+			return
+		}
+	}
+
 	cfg := parseFlags()
 	validateConfig(cfg)
 
-	apiKey := config.GetOpenAIKey(cfg.APIKey)
+	if err := logging.Init(cfg.LogLevel, cfg.LogFormat); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	if cfg.Sample != "" && cfg.Seed == 0 {
+		// Pick the seed here rather than in the sampler, so that the run can be reproduced
+		cfg.Seed = rand.Int64N(math.MaxInt64) + 1
+		log.Printf("Sampling with seed %d (pass --seed %d to draw the same sample again)\n", cfg.Seed, cfg.Seed)
+	} else if cfg.Seed != 0 {
+		log.Printf("Run seed: %d\n", cfg.Seed)
+	}
+
+	loadPromptTemplates(cfg.Prompts)
+	loadJokeKeywords(cfg.JokeKeywords)
+	loadMinContentLengths(cfg.MinContentLengths, cfg.MinWordCounts)
+	loadExperiment(cfg)
+	// The seed is sent with the calls of each client, where ensemble members vary it
+	analyzer.GenerationOverrides = cfg.Generation
+	analyzer.GenerationOverrides.Seed = nil
+
+	languagePolicy, _ := analyzer.ParseLanguagePolicy(cfg.Language) // Already validated in validateConfig
+	maxAge, _ := utils.ParseMaxAge(cfg.MaxAge)                      // Already validated in validateConfig
+	llmOptions := analyzer.LlmOptions{
+		APIKey:  config.GetOpenAIKey(cfg.APIKey),
+		BaseURL: config.GetOpenAIBaseURL(cfg.BaseURL),
+		Model:   config.GetOpenAIModel(cfg.Model),
+		Stream:  cfg.Stream,
+
+		Generation: analyzer.GenerationParams{Seed: cfg.Generation.Seed},
+		Language:   languagePolicy,
+		Ensemble:   ensembleOptions(cfg),
+		Vision:     analyzer.VisionOptions{Model: cfg.VisionModel, Weight: cfg.VisionWeight},
+		MaxAge:     maxAge,
+
+		MaxContentLength: cfg.MaxContentLength,
+	}
+	if cfg.Stream && cfg.Verbose {
+		llmOptions.Progress = logStreamProgress
+	}
 	datastoreClient := setupDatastore()
 	defer datastoreClient.Close()
+	if cfg.LogLlmCalls {
+		retention, _ := utils.ParseMaxAge(cfg.LlmCallRetention) // Already validated in validateConfig
+		llmOptions.CallLog = &analyzer.LlmCallLog{Datastore: datastoreClient, Retention: retention}
+	}
+
+	cfg.Cache = openPageCache(cfg.PageCache, cfg.FileCacheMaxSize)
+	if cfg.WARCDir != "" {
+		cfg.WARC = openWARC(cfg.WARCDir)
+		defer cfg.WARC.Close()
+	}
 
-	if cfg.URL != "" {
-		runURLMode(cfg, apiKey, datastoreClient)
+	if cfg.Daemon {
+		// The poller takes the lease of each feed it polls
+		runDaemonMode(cfg, llmOptions, datastoreClient)
+	} else if cfg.URL != "" {
+		runURLMode(cfg, llmOptions, datastoreClient)
+	} else if cfg.URLsFile != "" {
+		runURLsFileMode(cfg, llmOptions, datastoreClient)
+	} else if cfg.Newsletters != "" {
+		withFeedLease(newsletterLeaseName(cfg.Newsletters), cfg.NoLock, datastoreClient, func(ctx context.Context) {
+			runNewsletterMode(ctx, cfg, llmOptions, datastoreClient)
+		})
+	} else if cfg.Sitemap != "" {
+		withFeedLease(cfg.Sitemap, cfg.NoLock, datastoreClient, func(ctx context.Context) {
+			runSitemapMode(ctx, cfg, llmOptions, datastoreClient)
+		})
+	} else if cfg.Crawl != "" {
+		withFeedLease(cfg.Crawl, cfg.NoLock, datastoreClient, func(ctx context.Context) {
+			runCrawlMode(ctx, cfg, llmOptions, datastoreClient)
+		})
 	} else {
-		runRSSMode(cfg, apiKey, datastoreClient)
+		cfg = withRegisteredFeedSettings(cfg, datastoreClient)
+		withFeedLease(cfg.RSS, cfg.NoLock, datastoreClient, func(ctx context.Context) {
+			runRSSMode(ctx, cfg, llmOptions, datastoreClient)
+		})
 	}
 }
 
+// ensembleOptions returns the ensemble scoring options of cfg, which must have been validated.
+func ensembleOptions(cfg *Config) analyzer.EnsembleOptions {
+	method, _ := analyzer.ParseEnsembleMethod(cfg.EnsembleMethod)
+	var models []string
+	for _, model := range strings.Split(cfg.EnsembleModels, ",") {
+		if model = strings.TrimSpace(model); model != "" {
+			models = append(models, model)
+		}
+	}
+	return analyzer.EnsembleOptions{Runs: cfg.EnsembleRuns, Models: models, Method: method}
+}
+
 // parseFlags parses command-line flags and returns a Config struct
 func parseFlags() *Config {
 	var (
 		apiKey  = flag.String("api-key", "", "OpenAI API key (or set OPENAI_API_KEY environment variable)")
+		baseURL = flag.String("base-url", "", "Base URL of an OpenAI-compatible API (or set OPENAI_BASE_URL environment variable)")
+		model   = flag.String("model", "", "LLM model name, overrides the per-mode default (or set OPENAI_MODEL environment variable)")
 		verbose = flag.Bool("verbose", false, "Show verbose output")
 		url     = flag.String("url", "", "URL of the article to analyze")
 		rss     = flag.String("rss", "", "URL of the RSS feed to analyze")
-		max     = flag.Int("max", 5, "Maximum number of articles to fetch from RSS feed")
-		mode    = flag.String("mode", "joke", "Analysis mode (joke)")
+		sitemap = flag.String("sitemap", "", "URL of a sitemap or sitemap index whose most recently modified articles are analyzed, instead of an RSS feed")
+		smSince = flag.String("sitemap-since", "", "Only analyze sitemap articles modified within this period, e.g. 2d or 12h; articles without lastmod are skipped (default: no filter)")
+		crawl   = flag.String("crawl", "", "Seed URL of a site without RSS or sitemap: its same-site links are followed and the first --max articles found, closest to the seed first, are analyzed")
+		crDepth = flag.Int("crawl-depth", sitecrawler.DefaultMaxDepth, "Number of links followed from the --crawl seed URL to reach an article")
+		crPages = flag.Int("crawl-pages", sitecrawler.DefaultMaxPages, "Maximum number of pages read for links by --crawl")
+		urlsIn  = flag.String("urls-file", "", "File with one article URL per line to analyze (blank lines and lines starting with # are ignored)")
+		newsIn  = flag.String("newsletters", "", "Maildir (whose new messages are analyzed, then marked as seen) or directory of .eml files with newsletters whose body and linked articles are analyzed")
+		daemon  = flag.Bool("daemon", false, "Run until interrupted, polling the feeds of the registry (see the feeds query of the server) on their poll interval and analyzing their articles")
+		pollInt = flag.Duration("poll-interval", feedpoller.DefaultInterval, "With --daemon, time between two polls of the feeds registered without a poll interval")
+		feedCon = flag.Int("feed-concurrency", feedpoller.DefaultConcurrency, "With --daemon, maximum number of feeds polled at once")
+		statAdr = flag.String("status-addr", "localhost:8081", "With --daemon, address of the HTTP server of the /status and /health endpoints, which have no authentication (empty to disable)")
+		grace   = flag.Duration("shutdown-grace", feedpoller.DefaultShutdownGrace, "With --daemon, time given to the polls in progress to finish on SIGINT or SIGTERM before they are cancelled")
+		max     = flag.Int("max", 5, "Maximum number of articles to fetch from the RSS feed, sitemap or --crawl, or of links followed per newsletter")
+		sample  = flag.String("sample", "", "Analyze a random sample of the RSS feed, sitemap, --crawl or --urls-file instead of the first --max articles: a number of articles (e.g. 200) or a percentage (e.g. 5%)")
+		include = flag.String("include", "", "Only fetch the feed items whose title or description matches one of these comma-separated keywords (case-insensitive) or /regular expressions/, e.g. \"April Fools,/\\bprank(s|ed)?\\b/\"")
+		exclude = flag.String("exclude", "", "Leave out the feed items whose title or description matches one of these comma-separated keywords (case-insensitive) or /regular expressions/, e.g. sports,horoscope")
+		since   = flag.String("since", "", "Only fetch the feed items published at or after this time: an age such as 7d or 12h, a date such as 2026-04-01 or an RFC 3339 time; items without a date are left out")
+		until   = flag.String("until", "", "Only fetch the feed items published before this time: an age such as 7d or 12h, a date such as 2026-04-01 (included) or an RFC 3339 time; items without a date are left out")
+		seed    = flag.Int64("seed", 0, "Seed of the run: draws the same --sample again and is sent with the LLM calls, for reproducible results at a temperature above 0 (default: random sample, no LLM seed)")
+		mode    = flag.String("mode", "joke", "Analysis mode (see the modes subcommand)")
+		robots  = flag.String("robots", "", "How to handle noindex/noai pages: ignore or respect (or set POISSON_ROBOTS_POLICY environment variable)")
+		lang    = flag.String("language", "", "How to analyze non-English articles: as-is, instruct (tell the LLM the article language) or translate (translate into English first) (or set POISSON_LANGUAGE_POLICY environment variable)")
+		feedAut = flag.String("feed-auth", "", "Credentials for a private feed and its articles: basic:<username>:<secret>, bearer:<secret> or header:<name>:<secret>, where <secret> names a secret in POISSON_SECRET_<NAME> or POISSON_SECRETS_DIR")
+		strData = flag.String("structured-data", "", "How to extract articles: prefer uses schema.org JSON-LD Article data when present, ignore always uses HTML heuristics (or set POISSON_STRUCTURED_DATA environment variable)")
+		conc    = flag.Int("concurrency", fetcher.DefaultConcurrency, "Maximum number of articles fetched in parallel from an RSS feed")
+		perHost = flag.Int("per-host", fetcher.DefaultPerHostConcurrency, "Maximum number of parallel requests to a single host")
+		hostDel = flag.Duration("host-delay", 0, "Minimum time between the starts of two requests to the same host, e.g. 500ms or 2s")
+		proxy   = flag.String("proxy", "", "Proxy of article fetches: an http://, https:// or socks5:// URL, or several separated by | to rotate through, with <domain>=<proxies> or <domain>=direct rules for a domain and its subdomains, e.g. socks5://localhost:1080,intranet.example.com=direct (or set POISSON_PROXY environment variable, default: HTTP_PROXY and HTTPS_PROXY)")
+		fetchAt = flag.Int("fetch-attempts", fetcher.DefaultRetryAttempts, "Number of attempts at fetching an article that times out or gets a 429, 502, 503 or 504 response, with exponential backoff between them (1 disables retries)")
+		maxBody = flag.Int("max-body-mb", fetcher.DefaultMaxBodySize>>20, "Size in MB above which an article response is abandoned without reading the rest of it")
+		private = flag.Bool("allow-private-addresses", false, "Fetch feeds and articles from private, loopback and link-local addresses, which are refused by default")
+		revalid = flag.Bool("revalidate", false, "Refetch articles already in the Datastore with If-None-Match/If-Modified-Since requests, keeping the stored page when the server answers 304 Not Modified")
+		maxPage = flag.String("cache-max-age", "", "Age after which articles in the Datastore are refetched, with If-None-Match/If-Modified-Since requests: a number of days (7d), a Go duration (12h) or never, with <domain>=<age> rules for a domain and its subdomains, e.g. 7d,example.com=1h,archive.example.org=never (or set POISSON_CACHE_MAX_AGE environment variable, default: never)")
+		coolOff = flag.Duration("failure-cooldown", fetcher.DefaultFailureCooldown, "Time an article whose fetch failed is skipped, doubled for each other consecutive failure up to 24h, so that dead links aren't fetched on every poll (--force-refresh ignores it)")
+		pgCache = flag.String("page-cache", "", "Where the text of fetched articles is cached: disk (the cache directory), memory, a gs://bucket/prefix URL or none (or set POISSON_PAGE_CACHE environment variable, default: disk)")
+		fileMax = flag.String("file-cache-max-size", "", "Size of the disk or memory --page-cache above which its least recently used article texts are removed, e.g. 200MB or 2GB, or unlimited (or set POISSON_FILE_CACHE_MAX_SIZE environment variable, default: 512MB on disk, 64MB in memory)")
+		refresh = flag.Bool("force-refresh", false, "Fetch every article from its URL, ignoring and replacing the pages stored in the Datastore and the file cache")
+		paywall = flag.Bool("paywall-fallback", false, "Read articles that look paywalled or truncated (subscription prompts, isAccessibleForFree false, little text) from their AMP version or a web archive when one has more of the article")
+		mirrors = flag.String("archive-mirrors", "", "Comma-separated URL prefixes of the web archives tried by --paywall-fallback, to which the article URL is appended (or set POISSON_ARCHIVE_MIRRORS environment variable, default: https://web.archive.org/web/)")
+		noLock  = flag.Bool("no-lock", false, "Don't take the per-feed lease that prevents other instances from polling the same feed")
+		jokeKws = flag.String("joke-keywords", "", "Hedging keywords that keep a \"not a joke\" verdict from being inverted, as <language>:<keyword>,...;... e.g. en:joke,prank,satire (or set POISSON_JOKE_KEYWORDS environment variable)")
+		prompts = flag.String("prompts", "", "Directory or gs://bucket/prefix with <mode>.prompt.md templates replacing the embedded ones (or set POISSON_PROMPTS environment variable)")
+		experID = flag.String("experiment", "", "ID of a prompt experiment: articles analyzed in the run are randomly assigned the mode's prompt or one of --variants, and the results record the variant (see the experiment subcommand)")
+		variant = flag.String("variants", "", "Prompt variants of --experiment, as <name>=<path>,... where path is a template file or gs://bucket/object")
+		stream  = flag.Bool("stream", false, "Stream LLM responses and stop as soon as the JSON result is complete")
+		logLvl  = flag.String("log-level", "", "Minimum log level: debug, info, warn or error (or set POISSON_LOG_LEVEL environment variable)")
+		logFmt  = flag.String("log-format", "", "Log format: text or json (or set POISSON_LOG_FORMAT environment variable)")
+		system  = flag.String("system-prompt", "", "System message sent before the prompt, overrides the per-mode default")
+		maxTok  = flag.Int("max-tokens", 0, "Maximum completion tokens, overrides the per-mode default (0 for no limit)")
+		maxCont = flag.Int("max-content-length", 0, "Characters of article content sent in one prompt, longer articles are analyzed in chunks or truncated; overrides the per-mode and per-model defaults (see the modes subcommand)")
+		minCont = flag.String("min-content-length", "", "Per-mode minimum characters of article content, as <mode>=<characters>,... (0 for no minimum); shorter articles, usually extraction failures, are skipped instead of analyzed (default joke=200, or set POISSON_MIN_CONTENT_LENGTH environment variable)")
+		minWord = flag.String("min-words", "", "Per-mode minimum words of article content, as <mode>=<words>,... (0 for no minimum); shorter articles are skipped instead of analyzed (or set POISSON_MIN_WORD_COUNT environment variable)")
+		batchAn = flag.Bool("batch-analysis", false, "In RSS and --urls-file mode, store articles as pending for the OpenAI Batch API (half the price, results within 24 hours) instead of analyzing them, see the batch-status subcommand")
+		deferAn = flag.Bool("defer-analysis", false, "In RSS and --urls-file mode, if the LLM is unavailable, store articles as pending for a later 'backfill' run instead of failing")
+		llmConc = flag.Int("llm-concurrency", analyzer.DefaultBatchConcurrency, "Maximum number of articles analyzed in parallel in RSS and --urls-file mode")
+		dedupe  = flag.Bool("dedupe", false, "In RSS and --urls-file mode, skip articles whose embedding is a near-duplicate of an article seen in the last week")
+		dedupeT = flag.Float64("dedupe-threshold", embeddings.DefaultDuplicateThreshold, "Cosine similarity above which an article is a near-duplicate")
+		embedM  = flag.String("embedding-model", "", "Embedding model used by --dedupe (or set OPENAI_EMBEDDING_MODEL environment variable)")
+		ensRuns = flag.Int("ensemble-runs", 1, "Number of joke analyses per article and model, aggregated into one score (use with --temperature above 0)")
+		ensMods = flag.String("ensemble-models", "", "Comma-separated extra models whose joke analyses are aggregated with those of --model")
+		ensMeth = flag.String("ensemble-method", "", "How ensemble scores are aggregated: median (default) or mean")
+		visMod  = flag.String("vision-model", "", "Vision-capable model that also judges the lead image of each article, blending its verdict into the joke percentage (e.g. gpt-4o-mini)")
+		visWgt  = flag.Float64("vision-weight", analyzer.DefaultVisionWeight, "Share of the lead image verdict in the joke percentage, above 0 and at most 1 (use with --vision-model)")
+		scrThr  = flag.Int("screen-threshold", 0, "In RSS and --urls-file mode, skip the full joke analysis of articles whose headline alone scores below this joke percentage (0 disables headline screening)")
+		scrMod  = flag.String("screen-model", "", "Model of the headline screening, overrides --model and the headline mode default")
+		domBoil = flag.Bool("domain-boilerplate", false, "Learn the text blocks repeated across the pages of each site (navigation, footers, newsletter prompts) and strip them from fetched articles")
+		render  = flag.Bool("render", false, "Render pages whose article text is shorter than --render-threshold in a headless Chrome or Chromium, for sites that build their articles with JavaScript")
+		rendThr = flag.Int("render-threshold", fetcher.DefaultRenderThreshold, "Number of characters of article text below which --render loads a page in the browser")
+		chrome  = flag.String("chrome-path", "", "Browser binary used by --render (or set POISSON_CHROME_PATH environment variable, default: the first chromium or google-chrome in PATH)")
+		noSandb = flag.Bool("chrome-no-sandbox", false, "Run the browser of --render without Chrome's sandbox, for containers that don't allow it; always the case as root (or set POISSON_CHROME_NO_SANDBOX=true)")
+		screens = flag.String("screenshots", "", "Where --render stores a screenshot of every fetched page, for article previews and vision analysis: disk for the screenshots directory or a gs://bucket/prefix URL (or set POISSON_SCREENSHOTS environment variable, default: no screenshots)")
+		logCall = flag.Bool("log-llm-calls", false, "Store every LLM request and response (prompt hash, raw response, latency, tokens, error) in the LlmCall collection (see the llm-calls subcommand)")
+		callRet = flag.String("llm-call-retention", "30d", "How long calls logged with --log-llm-calls are kept, e.g. 30d or 12h")
+		warcDir = flag.String("warc", "", "Directory where a WARC file with the HTTP responses fetched during the run is written, for web archive tools")
+		maxAge  = flag.String("max-age", "", "Re-analyze articles whose cached analysis is older than this, e.g. 30d or 12h (or set POISSON_MAX_ANALYSIS_AGE environment variable)")
 	)
+	var temperature, topP config.OptionalFloat
+	flag.Var(&temperature, "temperature", "Sampling temperature, overrides the per-mode default")
+	flag.Var(&topP, "top-p", "Nucleus sampling probability mass, overrides the per-mode default")
 	flag.Parse()
 
 	return &Config{
 		APIKey:  *apiKey,
+		BaseURL: *baseURL,
+		Model:   *model,
 		Verbose: *verbose,
 		URL:     *url,
 		RSS:     *rss,
-		Max:     *max,
-		Mode:    *mode,
+
+		Sitemap:      *sitemap,
+		SitemapSince: *smSince,
+
+		Crawl:      *crawl,
+		CrawlDepth: *crDepth,
+		CrawlPages: *crPages,
+
+		URLsFile: *urlsIn,
+		Max:      *max,
+		Sample:   *sample,
+		Include:  *include,
+		Exclude:  *exclude,
+		Since:    *since,
+		Until:    *until,
+		Seed:     *seed,
+		Mode:     *mode,
+		Robots:   config.GetRobotsPolicy(*robots),
+		Stream:   *stream,
+		Prompts:  *prompts,
+		NoLock:   *noLock,
+
+		Newsletters: *newsIn,
+
+		Daemon:          *daemon,
+		PollInterval:    *pollInt,
+		FeedConcurrency: *feedCon,
+		StatusAddr:      *statAdr,
+		ShutdownGrace:   *grace,
+
+		Proxy:        config.GetProxy(*proxy),
+		Revalidate:   *revalid,
+		CacheMaxAge:  config.GetCacheMaxAge(*maxPage),
+		ForceRefresh: *refresh,
+
+		PageCache:        config.GetPageCache(*pgCache),
+		FileCacheMaxSize: config.GetFileCacheMaxSize(*fileMax),
+
+		PaywallFallback: *paywall,
+		ArchiveMirrors:  config.GetArchiveMirrors(*mirrors),
+
+		Experiment: *experID,
+		Variants:   *variant,
+
+		JokeKeywords: *jokeKws,
+
+		Concurrency:     *conc,
+		PerHost:         *perHost,
+		HostDelay:       *hostDel,
+		FetchAttempts:   *fetchAt,
+		MaxBodyMB:       *maxBody,
+		AllowPrivate:    *private,
+		FailureCooldown: *coolOff,
+		LlmConcurrency:  *llmConc,
+		DeferAnalysis:   *deferAn,
+		BatchAnalysis:   *batchAn,
+		LogLevel:        *logLvl,
+		LogFormat:       *logFmt,
+
+		Language:        config.GetLanguagePolicy(*lang),
+		FeedAuth:        *feedAut,
+		StructuredData:  config.GetStructuredDataPolicy(*strData),
+		Dedupe:          *dedupe,
+		DedupeThreshold: *dedupeT,
+		EmbeddingModel:  config.GetEmbeddingModel(*embedM),
+		EnsembleRuns:    *ensRuns,
+		EnsembleModels:  *ensMods,
+		EnsembleMethod:  *ensMeth,
+		VisionModel:     *visMod,
+		VisionWeight:    *visWgt,
+		ScreenThreshold: *scrThr,
+		ScreenModel:     *scrMod,
+		MaxAge:          config.GetMaxAnalysisAge(*maxAge),
+		WARCDir:         *warcDir,
+
+		DomainBoilerplate: *domBoil,
+		Render:            *render,
+		RenderThreshold:   *rendThr,
+		ChromePath:        config.GetChromePath(*chrome),
+		ChromeNoSandbox:   config.GetChromeNoSandbox(*noSandb),
+		Screenshots:       config.GetScreenshots(*screens),
+		LogLlmCalls:       *logCall,
+		LlmCallRetention:  *callRet,
+		MaxContentLength:  *maxCont,
+		MinContentLengths: config.GetMinContentLengths(*minCont),
+		MinWordCounts:     config.GetMinWordCounts(*minWord),
+		Generation: analyzer.GenerationParams{
+			SystemPrompt:        *system,
+			Temperature:         temperature.Value,
+			TopP:                topP.Value,
+			MaxCompletionTokens: *maxTok,
+			Seed:                seedParam(*seed),
+		},
+	}
+}
+
+// seedParam returns the LLM seed of a --seed, nil if it is zero.
+func seedParam(seed int64) *int64 {
+	if seed == 0 {
+		return nil
 	}
+	return analyzer.Int64Ptr(seed)
 }
 
 // validateConfig validates the configuration and exits with error message if invalid
@@ -67,40 +530,227 @@ func validateConfig(cfg *Config) {
 	// Validate mode
 	_, err := analyzer.VerifyValidMode(cfg.Mode)
 	if err != nil {
-		log.Printf("Error: unknown mode '%s'. Valid modes: joke\n", cfg.Mode)
+		log.Printf("Error: unknown mode '%s'. Valid modes: %s\n", cfg.Mode, strings.Join(analyzer.ModeNames(), ", "))
 		log.Printf("Usage: %s [flags]\n", os.Args[0])
 		flag.PrintDefaults()
 		log.Fatalf("")
 	}
 
-	// Validate that exactly one of --url or --rss is provided
+	if _, err := fetcher.ParseRobotsPolicy(cfg.Robots); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if _, err := fetcher.ParseStructuredDataPolicy(cfg.StructuredData); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if _, err := fetcher.ParseProxy(cfg.Proxy); err != nil {
+		log.Fatalf("Error: --proxy: %v\n", err)
+	}
+	if _, err := fetcher.ParseCacheMaxAge(cfg.CacheMaxAge); err != nil {
+		log.Fatalf("Error: --cache-max-age: %v\n", err)
+	}
+	if _, err := fetcher.ParseArchiveMirrors(cfg.ArchiveMirrors); err != nil {
+		log.Fatalf("Error: --archive-mirrors: %v\n", err)
+	}
+	if _, err := analyzer.ParseLanguagePolicy(cfg.Language); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if _, err := analyzer.ParseEnsembleMethod(cfg.EnsembleMethod); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if _, err := utils.ParseMaxAge(cfg.MaxAge); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if retention, err := utils.ParseMaxAge(cfg.LlmCallRetention); err != nil {
+		log.Fatalf("Error: --llm-call-retention: %v\n", err)
+	} else if retention == 0 {
+		log.Fatalf("Error: --llm-call-retention must be above zero\n")
+	}
+	if cfg.MaxContentLength < 0 {
+		log.Fatalf("Error: --max-content-length must not be negative\n")
+	}
+	if _, err := analyzer.ParseMinContentLengths(cfg.MinContentLengths); err != nil {
+		log.Fatalf("Error: --min-content-length: %v\n", err)
+	}
+	if _, err := analyzer.ParseMinWordCounts(cfg.MinWordCounts); err != nil {
+		log.Fatalf("Error: --min-words: %v\n", err)
+	}
+	if cfg.FetchAttempts < 1 {
+		log.Fatalf("Error: --fetch-attempts must be at least 1\n")
+	}
+	if cfg.MaxBodyMB < 1 {
+		log.Fatalf("Error: --max-body-mb must be at least 1\n")
+	}
+	if cfg.FailureCooldown <= 0 {
+		log.Fatalf("Error: --failure-cooldown must be positive\n")
+	}
+	if cfg.RenderThreshold < 1 {
+		log.Fatalf("Error: --render-threshold must be at least 1\n")
+	}
+	if cfg.Screenshots != "" && !cfg.Render {
+		log.Fatalf("Error: --screenshots requires --render\n")
+	}
+	if _, err := fetcher.OpenScreenshotStore(cfg.Screenshots); err != nil {
+		log.Fatalf("Error: --screenshots: %v\n", err)
+	}
+	if cfg.EnsembleRuns < 1 {
+		log.Fatalf("Error: --ensemble-runs must be at least 1\n")
+	}
+	if cfg.ScreenThreshold < 0 || cfg.ScreenThreshold > 100 {
+		log.Fatalf("Error: --screen-threshold must be between 0 and 100\n")
+	}
+	if cfg.VisionWeight <= 0 || cfg.VisionWeight > 1 {
+		log.Fatalf("Error: --vision-weight must be above 0 and at most 1\n")
+	}
+	if (cfg.Experiment == "") != (cfg.Variants == "") {
+		log.Fatalf("Error: --experiment and --variants must be used together\n")
+	}
+
+	// Validate that exactly one of --url, --rss, --sitemap, --crawl, --urls-file, --newsletters or --daemon is provided
 	urlProvided := cfg.URL != ""
 	rssProvided := cfg.RSS != ""
+	sitemapProvided := cfg.Sitemap != ""
+	crawlProvided := cfg.Crawl != ""
+	fileProvided := cfg.URLsFile != ""
+	newsletterProvided := cfg.Newsletters != ""
 
-	if !urlProvided && !rssProvided {
-		log.Printf("Error: exactly one of --url or --rss must be provided\n")
+	provided := 0
+	for _, p := range []bool{urlProvided, rssProvided, sitemapProvided, crawlProvided, fileProvided, newsletterProvided, cfg.Daemon} {
+		if p {
+			provided++
+		}
+	}
+	if provided != 1 {
+		log.Printf("Error: exactly one of --url, --rss, --sitemap, --crawl, --urls-file, --newsletters or --daemon must be provided\n")
 		log.Printf("Usage: %s [flags]\n", os.Args[0])
 		flag.PrintDefaults()
 		log.Fatalf("")
 	}
 
-	if urlProvided && rssProvided {
-		log.Printf("Error: cannot specify both --url and --rss\n")
-		log.Printf("Usage: %s [flags]\n", os.Args[0])
-		flag.PrintDefaults()
-		log.Fatalf("")
+	if cfg.FeedAuth != "" {
+		if fileProvided || newsletterProvided || cfg.Daemon {
+			log.Fatalf("Error: --feed-auth can only be used with --rss, --sitemap, --crawl or --url\n")
+		}
+		if _, err := fetcher.ParseFeedAuth(cfg.FeedAuth); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
 	}
 
-	// Validate URLs
+	// Validate URLs; the URLs in --urls-file are validated one by one when the file is read
 	if urlProvided {
 		if err := utils.ValidateURL(cfg.URL); err != nil {
 			log.Fatalf("Invalid URL: %v\n", err)
 		}
-	} else {
+	} else if rssProvided {
 		if err := utils.ValidateRSSURL(cfg.RSS); err != nil {
 			log.Fatalf("Invalid RSS feed URL: %v\n", err)
 		}
+	} else if sitemapProvided {
+		if err := utils.ValidateURL(cfg.Sitemap); err != nil {
+			log.Fatalf("Invalid sitemap URL: %v\n", err)
+		}
+	} else if crawlProvided {
+		if err := utils.ValidateURL(cfg.Crawl); err != nil {
+			log.Fatalf("Invalid crawl seed URL: %v\n", err)
+		}
+	}
+	if cfg.CrawlDepth < 1 {
+		log.Fatalf("Error: --crawl-depth must be at least 1\n")
+	}
+	if cfg.CrawlPages < 1 {
+		log.Fatalf("Error: --crawl-pages must be at least 1\n")
+	}
+	if _, err := utils.ParseSample(cfg.Sample); err != nil {
+		log.Fatalf("Error: --sample: %v\n", err)
+	} else if cfg.Sample != "" && (urlProvided || newsletterProvided || cfg.Daemon) {
+		log.Fatalf("Error: --sample can only be used with --rss, --sitemap, --crawl or --urls-file\n")
+	}
+	if _, err := rssfetcher.ParseItemFilter(cfg.Include, cfg.Exclude); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	} else if (cfg.Include != "" || cfg.Exclude != "") && !rssProvided && !cfg.Daemon {
+		log.Fatalf("Error: --include and --exclude can only be used with --rss or --daemon\n")
+	}
+	if _, _, err := rssfetcher.ParsePublishedWindow(cfg.Since, cfg.Until, time.Now()); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	} else if (cfg.Since != "" || cfg.Until != "") && !rssProvided && !cfg.Daemon {
+		log.Fatalf("Error: --since and --until can only be used with --rss or --daemon (see --sitemap-since for sitemaps)\n")
+	}
+	if cfg.Daemon {
+		if cfg.PollInterval < time.Minute {
+			log.Fatalf("Error: --poll-interval must be at least 1m\n")
+		}
+		if cfg.FeedConcurrency < 1 {
+			log.Fatalf("Error: --feed-concurrency must be at least 1\n")
+		}
+		if cfg.ShutdownGrace <= 0 {
+			log.Fatalf("Error: --shutdown-grace must be positive\n")
+		}
+	}
+	if cfg.SitemapSince != "" {
+		if !sitemapProvided {
+			log.Fatalf("Error: --sitemap-since can only be used with --sitemap\n")
+		}
+		if _, err := utils.ParseMaxAge(cfg.SitemapSince); err != nil {
+			log.Fatalf("Error: --sitemap-since: %v\n", err)
+		}
+	}
+}
+
+// loadPromptTemplates replaces the embedded prompt templates with the ones at the configured source, if any.
+func loadPromptTemplates(flagValue string) {
+	source := config.GetPromptSource(flagValue)
+	if source == "" {
+		return
+	}
+
+	loadCtx, loadCancel := config.NewPromptLoadContext()
+	defer loadCancel()
+	loaded, err := analyzer.LoadPromptTemplates(loadCtx, source)
+	if err != nil {
+		log.Fatalf("Error loading prompt templates: %v\n", err)
 	}
+	log.Printf("Loaded %d prompt template(s) from %s\n", len(loaded), source)
+}
+
+// loadExperiment registers the prompt experiment of cfg's mode, if any. Call it after
+// loadPromptTemplates, since the control variant uses the mode's template.
+func loadExperiment(cfg *Config) {
+	if cfg.Experiment == "" {
+		return
+	}
+
+	mode, _ := analyzer.VerifyValidMode(cfg.Mode) // Already validated in validateConfig
+	loadCtx, loadCancel := config.NewPromptLoadContext()
+	defer loadCancel()
+	if err := analyzer.LoadExperiment(loadCtx, cfg.Experiment, mode, cfg.Variants); err != nil {
+		log.Fatalf("Error loading experiment: %v\n", err)
+	}
+	log.Printf("Running prompt experiment %s in %s mode\n", cfg.Experiment, mode)
+}
+
+// loadJokeKeywords sets the hedging keywords of joke scoring from the --joke-keywords flag or
+// POISSON_JOKE_KEYWORDS. Call it before any analysis, since the keywords are part of the joke prompt fingerprint.
+func loadJokeKeywords(flagValue string) {
+	keywords, err := analyzer.ParseJokeKeywords(config.GetJokeKeywords(flagValue))
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	analyzer.JokeScoring.Keywords = keywords
+}
+
+// loadMinContentLengths sets the per-mode minimum content lengths and word counts of analyzed
+// articles from the --min-content-length and --min-words flags or POISSON_MIN_CONTENT_LENGTH and
+// POISSON_MIN_WORD_COUNT.
+func loadMinContentLengths(lengthsFlag, wordsFlag string) {
+	lengths, err := analyzer.ParseMinContentLengths(config.GetMinContentLengths(lengthsFlag))
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	analyzer.SetMinContentLengths(lengths)
+	counts, err := analyzer.ParseMinWordCounts(config.GetMinWordCounts(wordsFlag))
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	analyzer.SetMinWordCounts(counts)
 }
 
 // setupDatastore creates and returns a Datastore client
@@ -115,8 +765,160 @@ func setupDatastore() lib.DatastoreClient {
 	return datastoreClient
 }
 
+// fetchOptions builds the fetcher options from the configuration.
+// It exits if the secret referenced by --feed-auth can't be read.
+func fetchOptions(cfg *Config) fetcher.Options {
+	robotsPolicy, _ := fetcher.ParseRobotsPolicy(cfg.Robots) // Already validated in validateConfig
+	structuredData, _ := fetcher.ParseStructuredDataPolicy(cfg.StructuredData)
+	proxy, _ := fetcher.ParseProxy(cfg.Proxy)
+	cacheMaxAge, _ := fetcher.ParseCacheMaxAge(cfg.CacheMaxAge)
+	archiveMirrors, _ := fetcher.ParseArchiveMirrors(cfg.ArchiveMirrors)
+	feedURL := cfg.RSS
+	if feedURL == "" {
+		feedURL = cfg.Sitemap
+	}
+	if feedURL == "" {
+		feedURL = cfg.Crawl
+	}
+	if feedURL == "" {
+		feedURL = cfg.URL // Credentials for a single private article
+	}
+	return fetcher.Options{
+		RobotsPolicy:          robotsPolicy,
+		StructuredData:        structuredData,
+		Concurrency:           cfg.Concurrency,
+		PerHostConcurrency:    cfg.PerHost,
+		HostDelay:             cfg.HostDelay,
+		RetryAttempts:         cfg.FetchAttempts,
+		MaxBodySize:           int64(cfg.MaxBodyMB) << 20,
+		AllowPrivateAddresses: cfg.AllowPrivate,
+		Credentials:           feedCredentials(cfg.FeedAuth, feedURL),
+		WARC:                  cfg.WARC,
+		DomainBoilerplate:     cfg.DomainBoilerplate,
+		Renderer:              pageRenderer(cfg.Render, cfg.ChromePath, cfg.ChromeNoSandbox, cfg.AllowPrivate, int64(cfg.MaxBodyMB)<<20),
+		RenderThreshold:       cfg.RenderThreshold,
+		Screenshots:           screenshotStore(cfg.Screenshots),
+		Proxy:                 proxy,
+		Revalidate:            cfg.Revalidate,
+		CacheMaxAge:           cacheMaxAge,
+		ForceRefresh:          cfg.ForceRefresh,
+		FailureCooldown:       cfg.FailureCooldown,
+		PaywallFallback:       cfg.PaywallFallback,
+		ArchiveMirrors:        archiveMirrors,
+		Cache:                 cfg.Cache,
+		// Feeds, sitemaps and newsletters record their own source
+		Source: models.SourceRef{Kind: models.SourceKindSubmission, ID: cfg.URLsFile},
+	}
+}
+
+// itemFilterOf returns the --include, --exclude, --since and --until filter of cfg, which must
+// have been validated.
+func itemFilterOf(cfg *Config) rssfetcher.ItemFilter {
+	filter, _ := rssfetcher.ParseItemFilter(cfg.Include, cfg.Exclude)
+	filter.Since, filter.Until, _ = rssfetcher.ParsePublishedWindow(cfg.Since, cfg.Until, time.Now())
+	return filter
+}
+
+// sampleOf returns the --sample of cfg, which must have been validated, drawn with its --seed.
+func sampleOf(cfg *Config) utils.Sample {
+	sample, _ := utils.ParseSample(cfg.Sample)
+	sample.Seed = uint64(cfg.Seed)
+	return sample
+}
+
+// pageRenderer returns the browser renderer of --render, or nil if render is false. Rendered
+// pages load resources from private addresses only if allowPrivate is set, the browser runs
+// without its sandbox if noSandbox is set, and DOMs larger than maxSize bytes are abandoned.
+// It exits if no browser is found.
+func pageRenderer(render bool, chromePath string, noSandbox, allowPrivate bool, maxSize int64) fetcher.Renderer {
+	if !render {
+		return nil
+	}
+	renderer, err := fetcher.NewChromeRenderer(chromePath)
+	if err != nil {
+		log.Fatalf("Error: --render: %v\n", err)
+	}
+	renderer.AllowPrivateAddresses = allowPrivate
+	renderer.NoSandbox = noSandbox
+	renderer.MaxDOMSize = maxSize
+	return renderer
+}
+
+// screenshotStore returns the screenshot store of --screenshots, or nil if spec is empty.
+// It exits if spec is invalid.
+func screenshotStore(spec string) fetcher.ScreenshotStore {
+	store, err := fetcher.OpenScreenshotStore(spec)
+	if err != nil {
+		log.Fatalf("Error: --screenshots: %v\n", err)
+	}
+	return store
+}
+
+// openWARC creates the WARC file of this run in dir, named after the start time.
+func openWARC(dir string) *fetcher.WARCWriter {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Fatalf("Error creating WARC directory: %v\n", err)
+	}
+	path := filepath.Join(dir, "poisson-"+time.Now().UTC().Format("20060102150405")+".warc.gz")
+	warc, err := fetcher.NewWARCWriter(path, "poisson")
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	log.Printf("Archiving fetched pages to %s\n", path)
+	return warc
+}
+
+// openPageCache opens the page cache described by spec with the max size maxSize (see
+// fetcher.OpenPageCache).
+func openPageCache(spec, maxSize string) fetcher.PageCache {
+	size, err := fetcher.ParseFileCacheMaxSize(maxSize)
+	if err != nil {
+		log.Fatalf("Error: --file-cache-max-size: %v\n", err)
+	}
+	cache, err := fetcher.OpenPageCache(spec, size)
+	if err != nil {
+		log.Fatalf("Error: --page-cache: %v\n", err)
+	}
+	return cache
+}
+
+// feedCredentials resolves the --feed-auth reference for feedURL, or returns nil if spec is empty.
+func feedCredentials(spec, feedURL string) *fetcher.Credentials {
+	if spec == "" {
+		return nil
+	}
+	auth, err := fetcher.ParseFeedAuth(spec)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	credentials, err := fetcher.ResolveCredentials(feedURL, auth)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	return credentials
+}
+
+// streamResponses numbers the streamed LLM responses in progress logs.
+var streamResponses atomic.Int64
+
+// logStreamProgress returns the progress callback of a new streamed LLM response, which logs
+// roughly every 200 characters with the number of the response, as responses to the articles
+// of a batch are streamed at the same time.
+func logStreamProgress() func(received int) {
+	const step = 200
+	response := streamResponses.Add(1)
+	next := step
+	return func(received int) {
+		if received < next {
+			return
+		}
+		log.Printf("  ... received %d characters from LLM (response %d)\n", received, response)
+		next = received + step
+	}
+}
+
 // runURLMode handles single URL analysis mode
-func runURLMode(cfg *Config, apiKey string, datastoreClient lib.DatastoreClient) {
+func runURLMode(cfg *Config, llmOptions analyzer.LlmOptions, datastoreClient lib.DatastoreClient) {
 	promptMode, _ := analyzer.VerifyValidMode(cfg.Mode) // Already validated in validateConfig
 
 	// Fetch article with timeout
@@ -124,68 +926,302 @@ func runURLMode(cfg *Config, apiKey string, datastoreClient lib.DatastoreClient)
 	defer fetchCancel()
 
 	log.Printf("Fetching article from: %s\n", cfg.URL)
-	page, cachePath, err := fetcher.FetchArticleContent(fetchCtx, cfg.URL, cfg.Verbose, datastoreClient)
+	page, cachePath, err := fetcher.FetchArticleContent(fetchCtx, cfg.URL, cfg.Verbose, datastoreClient, fetchOptions(cfg))
 	if err != nil {
 		log.Fatalf("Error: %v\n", err)
 	}
 	_ = cachePath // cache path available for future use
 
+	if page.RobotsExcluded {
+		log.Printf("Skipping analysis: page is marked noindex/noai (noindex=%v, noai=%v)\n", page.NoIndex, page.NoAI)
+		return
+	}
+
 	// Analyze with timeout
 	analysisCtx, analysisCancel := config.NewAnalysisContext()
 	defer analysisCancel()
 
-	analysis, err := analyzer.Analyze(analysisCtx, page, apiKey, promptMode, datastoreClient, cfg.Verbose)
+	analysis, err := analyzer.Analyze(analysisCtx, page, llmOptions, promptMode, datastoreClient, cfg.Verbose)
+	if errors.Is(err, analyzer.ErrContentTooShort) {
+		log.Printf("Skipping analysis: %v\n", err)
+		return
+	}
 	if err != nil {
 		log.Fatalf("Error: %v\n", err)
 	}
 	displayAnalysis(analysis, page.Title, page.URL, page.Content, cfg.Verbose, 0, 0)
+
+	var usage analyzer.UsageTotals
+	usage.Add(analysis)
+	displayUsage(usage)
 }
 
-// runRSSMode handles RSS feed analysis mode
-func runRSSMode(cfg *Config, apiKey string, datastoreClient lib.DatastoreClient) {
-	promptMode, _ := analyzer.VerifyValidMode(cfg.Mode) // Already validated in validateConfig
+// withFeedLease runs fn while holding the lease for feedURL, so that only one instance polls
+// the feed at a time. If another instance holds the lease, it logs and returns without running fn.
+// If noLock is true, fn runs without a lease.
+func withFeedLease(feedURL string, noLock bool, datastoreClient lib.DatastoreClient, fn func(ctx context.Context)) {
+	ctx := context.Background()
+	if noLock {
+		fn(ctx)
+		return
+	}
+
+	leaseName := lib.FeedLeaseName(feedURL)
+	acquired, err := lib.RunWithLease(ctx, datastoreClient, leaseName, lib.LeaseHolderID(), config.FeedLeaseTTL,
+		func(ctx context.Context) error {
+			fn(ctx)
+			return nil
+		})
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if !acquired {
+		log.Printf("Feed %s is being polled by another instance, skipping\n", feedURL)
+	}
+}
 
+// displayFetchSummary displays how many articles of a feed were fetched, and the items that
+// were skipped or failed with the reason.
+func displayFetchSummary(summary *rssfetcher.FetchSummary) {
+	log.Printf("Fetched %d of %d article(s) from %s (%d new, %d from cache, %d not modified), %d skipped, %d failed\n",
+		summary.Fetched, summary.Items, summary.Feed, summary.New, summary.CacheHits, summary.Revalidated,
+		len(summary.Skipped), len(summary.Failed))
+	if summary.Filtered > 0 {
+		log.Printf("  %d item(s) left out by --include, --exclude, --since or --until\n", summary.Filtered)
+	}
+	if summary.NotModified {
+		log.Printf("  Feed not modified since the last download, using its recorded items\n")
+	}
+	if summary.Pages > 1 {
+		log.Printf("  Read %d pages of the paginated feed\n", summary.Pages)
+	}
+	for _, skipped := range summary.Skipped {
+		log.Printf("  Skipped %s: %s\n", articleLabel(skipped), skipped.Reason)
+	}
+	for _, failed := range summary.Failed {
+		log.Printf("  Failed %s: %s\n", articleLabel(failed), failed.Reason)
+	}
+}
+
+// displayCrawlSummary displays how many pages a crawl read and how many of the articles it
+// found were fetched, and the articles that were skipped or failed with the reason.
+func displayCrawlSummary(summary *sitecrawler.FetchSummary) {
+	log.Printf("Crawled %d page(s) of %s and found %d article(s): %d fetched, %d skipped, %d failed\n",
+		summary.PagesRead, summary.Seed, summary.Found, summary.Fetched, len(summary.Skipped), len(summary.Failed))
+	for _, skipped := range summary.Skipped {
+		log.Printf("  Skipped %s: %s\n", skipped.URL, skipped.Reason)
+	}
+	for _, failed := range summary.Failed {
+		log.Printf("  Failed %s: %s\n", failed.URL, failed.Reason)
+	}
+}
+
+// articleLabel identifies a feed item in the output: its URL, or its title if it has none.
+func articleLabel(article rssfetcher.ArticleOutcome) string {
+	if article.URL != "" {
+		return article.URL
+	}
+	return fmt.Sprintf("%q", article.Title)
+}
+
+// runRSSMode handles RSS feed analysis mode.
+// ctx is cancelled if the feed lease is lost.
+func runRSSMode(ctx context.Context, cfg *Config, llmOptions analyzer.LlmOptions, datastoreClient lib.DatastoreClient) {
 	// Fetch articles from RSS feed with timeout
-	rssCtx, rssCancel := config.NewRSSContext()
+	rssCtx, rssCancel := context.WithTimeout(ctx, config.RSSTimeout)
 	defer rssCancel()
 
-	pages, err := rssfetcher.FetchRSSArticles(rssCtx, cfg.RSS, cfg.Max, cfg.Verbose, datastoreClient)
+	pages, summary, err := rssfetcher.FetchRSSArticles(rssCtx, cfg.RSS, cfg.Max, sampleOf(cfg), itemFilterOf(cfg), cfg.Verbose, datastoreClient, fetchOptions(cfg))
+	if summary != nil {
+		displayFetchSummary(summary)
+	}
+	if err != nil {
+		log.Fatalf("Error fetching RSS articles: %v\n", err)
+	}
+
+	if len(pages) == 0 {
+		log.Fatalf("Error: no articles fetched from RSS feed\n")
+	}
+
+	log.Printf("\n%s\n", strings.Repeat("=", 60))
+	log.Printf("Analyzing %d article(s) from RSS feed\n", len(pages))
+	log.Printf("%s\n\n", strings.Repeat("=", 60))
+
+	analyzeAndDisplay(ctx, cfg, llmOptions, pages, datastoreClient)
+}
+
+// runSitemapMode handles sitemap analysis mode, like runRSSMode with the articles of a sitemap.
+// ctx is cancelled if the sitemap lease is lost.
+func runSitemapMode(ctx context.Context, cfg *Config, llmOptions analyzer.LlmOptions, datastoreClient lib.DatastoreClient) {
+	var since time.Time
+	if window, _ := utils.ParseMaxAge(cfg.SitemapSince); window > 0 { // Already validated in validateConfig
+		since = time.Now().Add(-window)
+	}
+
+	sitemapCtx, sitemapCancel := context.WithTimeout(ctx, config.RSSTimeout)
+	defer sitemapCancel()
+
+	pages, err := sitemapfetcher.FetchSitemapArticles(sitemapCtx, cfg.Sitemap, cfg.Max, sampleOf(cfg), since, cfg.Verbose,
+		datastoreClient, fetchOptions(cfg))
 	if err != nil {
-		// Check if we got partial success (some pages but also errors)
 		if len(pages) == 0 {
-			// Complete failure - no pages fetched
-			log.Fatalf("Error fetching RSS articles: %v\n", err)
+			log.Fatalf("Error fetching sitemap articles: %v\n", err)
 		}
-		// Partial success - log warning but continue with available pages
 		log.Printf("Warning: %v\n", err)
 	}
 
 	if len(pages) == 0 {
-		log.Fatalf("Error: no articles fetched from RSS feed\n")
+		log.Printf("No articles to analyze in sitemap\n")
+		return
 	}
 
 	log.Printf("\n%s\n", strings.Repeat("=", 60))
-	log.Printf("Analyzing %d article(s) from RSS feed\n", len(pages))
+	log.Printf("Analyzing %d article(s) from sitemap\n", len(pages))
 	log.Printf("%s\n\n", strings.Repeat("=", 60))
 
-	for i, page := range pages {
-		showSeparator := i < len(pages)-1
+	analyzeAndDisplay(ctx, cfg, llmOptions, pages, datastoreClient)
+}
+
+// runCrawlMode handles crawl analysis mode, like runSitemapMode with the articles found by
+// following the links of the --crawl seed URL. ctx is cancelled if the crawl lease is lost.
+func runCrawlMode(ctx context.Context, cfg *Config, llmOptions analyzer.LlmOptions, datastoreClient lib.DatastoreClient) {
+	crawlCtx, crawlCancel := context.WithTimeout(ctx, config.RSSTimeout)
+	defer crawlCancel()
+
+	limits := sitecrawler.Limits{MaxDepth: cfg.CrawlDepth, MaxPages: cfg.CrawlPages}
+	pages, summary, err := sitecrawler.FetchSiteArticles(crawlCtx, cfg.Crawl, cfg.Max, sampleOf(cfg), limits, cfg.Verbose,
+		datastoreClient, fetchOptions(cfg))
+	if summary != nil {
+		displayCrawlSummary(summary)
+	}
+	if err != nil {
+		log.Fatalf("Error crawling site: %v\n", err)
+	}
+
+	if len(pages) == 0 {
+		log.Printf("No articles found by crawling the site\n")
+		return
+	}
+
+	log.Printf("\n%s\n", strings.Repeat("=", 60))
+	log.Printf("Analyzing %d article(s) from crawl\n", len(pages))
+	log.Printf("%s\n\n", strings.Repeat("=", 60))
+
+	analyzeAndDisplay(ctx, cfg, llmOptions, pages, datastoreClient)
+}
+
+// analyzeAndDisplay analyzes pages in parallel and displays each analysis and the total usage.
+// It returns the number of pages analyzed, including those screened out by their headline, and
+// the number whose analysis failed.
+func analyzeAndDisplay(
+	ctx context.Context,
+	cfg *Config,
+	llmOptions analyzer.LlmOptions,
+	pages []*models.CrawledPage,
+	datastoreClient lib.DatastoreClient,
+) (analyzed, failed int) {
+	modes := analysisModes(cfg)
+
+	if cfg.Dedupe {
+		pages = skipDuplicates(ctx, cfg, llmOptions, pages, datastoreClient)
+	}
+
+	// Analyze articles in parallel; each analysis gets its own timeout
+	batchOptions := analyzer.BatchOptions{
+		LlmOptions:  llmOptions,
+		Concurrency: cfg.LlmConcurrency,
+		Timeout:     config.AnalysisTimeout,
+
+		DeferOnUnavailable: cfg.DeferAnalysis,
+		QueueForBatch:      cfg.BatchAnalysis,
+		Screening:          analyzer.HeadlineScreening{Threshold: cfg.ScreenThreshold, Model: cfg.ScreenModel},
+	}
+	results := analyzer.AnalyzeBatch(ctx, pages, modes, batchOptions, datastoreClient, cfg.Verbose)
 
-		// Analyze each article with timeout
-		analysisCtx, analysisCancel := config.NewAnalysisContext()
-		analysis, err := analyzer.Analyze(analysisCtx, page, apiKey, promptMode, datastoreClient, cfg.Verbose)
-		analysisCancel() // Cancel immediately after analysis to free resources
+	var usage analyzer.UsageTotals
+	deferred, queued, screened, tooShort := 0, 0, 0, 0
+	for i, result := range results {
+		showSeparator := i < len(results)-1
 
-		if err != nil {
-			log.Printf("Error analyzing article %d: %v\n", i+1, err)
+		if result.Deferred && errors.Is(result.Err, analyzer.ErrQueuedForBatch) {
+			queued++
+			continue
+		}
+		if result.Deferred {
+			deferred++
+			log.Printf("Article %d deferred, LLM unavailable: %s\n", i+1, result.Page.URL)
+			continue
+		}
+		if errors.Is(result.Err, analyzer.ErrContentTooShort) {
+			tooShort++
+			log.Printf("Article %d skipped: %v\n", i+1, result.Err)
+			continue
+		}
+		if result.Err != nil {
+			failed++
+			log.Printf("Error analyzing article %d: %v\n", i+1, result.Err)
 			log.Printf("%s\n", strings.Repeat("-", 120))
 			if showSeparator {
 				log.Printf("\n")
 			}
 			continue
 		}
-		displayAnalysis(analysis, page.Title, page.URL, page.Content, cfg.Verbose, i+1, len(pages))
+		analyzed++
+		usage.Add(result.Result)
+		if result.Screened {
+			screened++
+			log.Printf("Article %d skipped after headline screening (%d%% < %d%%): %s\n",
+				i+1, *result.Result.JokePercentage, cfg.ScreenThreshold, result.Page.URL)
+			continue
+		}
+		usage.Add(result.Headline)
+		page := result.Page
+		displayAnalysis(result.Result, page.Title, page.URL, page.Content, cfg.Verbose, i+1, len(results))
+	}
+
+	displayUsage(usage)
+	if screened > 0 {
+		log.Printf("%d article(s) skipped after headline screening\n", screened)
+	}
+	if tooShort > 0 {
+		log.Printf("%d article(s) skipped for having too little content, see --min-content-length\n", tooShort)
+	}
+	if deferred > 0 {
+		log.Printf("%d article(s) stored as pending, run the 'backfill' command once the LLM is available\n", deferred)
 	}
+	if queued > 0 {
+		log.Printf("%d article(s) queued for the Batch API, run the 'batch-status --submit' command to submit them\n", queued)
+	}
+	return analyzed, failed
+}
+
+// skipDuplicates returns the pages that are not near-duplicates of an article seen recently,
+// logging the ones skipped. If embeddings can't be computed, all pages are returned.
+func skipDuplicates(
+	ctx context.Context,
+	cfg *Config,
+	llmOptions analyzer.LlmOptions,
+	pages []*models.CrawledPage,
+	datastoreClient lib.DatastoreClient,
+) []*models.CrawledPage {
+	embedder := embeddings.NewOpenAIEmbedder(embeddings.Options{
+		APIKey:  llmOptions.APIKey,
+		BaseURL: llmOptions.BaseURL,
+		Model:   cfg.EmbeddingModel,
+	})
+	embedCtx, embedCancel := context.WithTimeout(ctx, config.AnalysisTimeout)
+	defer embedCancel()
+
+	kept, duplicates, err := embeddings.FindDuplicates(embedCtx, pages, embedder, datastoreClient,
+		embeddings.DuplicateOptions{Threshold: cfg.DedupeThreshold})
+	if err != nil {
+		log.Printf("Warning: skipping duplicate detection: %v\n", err)
+		return pages
+	}
+	for _, d := range duplicates {
+		log.Printf("Skipping near-duplicate (%.0f%% similar to %s): %s\n", d.Similarity*100, d.OriginalURL, d.Page.URL)
+	}
+	return kept
 }
 
 // displayAnalysis displays the analysis results and related information.
@@ -230,5 +1266,25 @@ func displayAnalysis(
 	if analysis.JokeReasoning != nil {
 		log.Printf("Joke Reasoning: %s\n", *analysis.JokeReasoning)
 	}
+	if analysis.Model != "" {
+		log.Printf("Model: %s\n", analysis.Model)
+	}
+	if analysis.Cached {
+		log.Printf("Tokens: none (cached result)\n")
+	} else {
+		log.Printf("Tokens: %d prompt, %d completion (estimated cost $%.4f)\n",
+			analysis.PromptTokens, analysis.CompletionTokens, analysis.CostUSD)
+	}
+	log.Printf("%s\n", strings.Repeat("=", 60))
+}
+
+// displayUsage displays the LLM usage and estimated cost of the run.
+func displayUsage(usage analyzer.UsageTotals) {
+	log.Printf("\n%s\n", strings.Repeat("=", 60))
+	log.Printf("LLM USAGE\n")
+	log.Printf("%s\n", strings.Repeat("=", 60))
+	log.Printf("Analyses: %d (%d served from cache)\n", usage.Analyses+usage.CachedAnalyses, usage.CachedAnalyses)
+	log.Printf("Tokens: %d prompt, %d completion\n", usage.PromptTokens, usage.CompletionTokens)
+	log.Printf("Estimated cost: $%.4f\n", usage.CostUSD)
 	log.Printf("%s\n", strings.Repeat("=", 60))
 }
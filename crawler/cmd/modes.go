@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+)
+
+// runModes handles the "modes" subcommand: it lists the valid analysis modes with their
+// description, default model, content length limit and current prompt fingerprint.
+func runModes(args []string) {
+	flags := flag.NewFlagSet("modes", flag.ExitOnError)
+	var (
+		prompts   = flags.String("prompts", "", "Directory or gs://bucket/prefix with <mode>.prompt.md templates replacing the embedded ones (or set POISSON_PROMPTS environment variable)")
+		jokeWords = flags.String("joke-keywords", "", "Hedging keywords of joke scoring, which are part of the joke prompt fingerprint (or set POISSON_JOKE_KEYWORDS environment variable)")
+		jsonOut   = flags.Bool("json", false, "Print the modes as a JSON array")
+	)
+	flags.Parse(args)
+
+	// Fingerprints depend on the templates and keywords in use
+	loadPromptTemplates(*prompts)
+	loadJokeKeywords(*jokeWords)
+	loadMinContentLengths("", "")
+
+	modes := analyzer.ListModes()
+	if *jsonOut {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(modes); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		return
+	}
+	for _, mode := range modes {
+		log.Printf("%s: %s\n", mode.Name, mode.Description)
+		log.Printf("  model %s, prompt version %d, fingerprint %d, max content length %d, min content length %d, min words %d\n",
+			mode.Model, mode.Version, mode.Fingerprint, mode.MaxContentLength, mode.MinContentLength, mode.MinWordCount)
+		if len(mode.Languages) > 0 {
+			log.Printf("  localized prompts: %s\n", strings.Join(mode.Languages, ", "))
+		}
+	}
+}
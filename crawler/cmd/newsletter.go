@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/crawler/config"
+	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/crawler/newsletterfetcher"
+	"github.com/zeace/poisson/lib"
+)
+
+// runNewsletterMode analyzes the newsletters in the --newsletters Maildir or .eml directory:
+// the body of each one and the articles it links to. Mailboxes are read from a Maildir synced
+// or delivered by another tool rather than over IMAP. A Maildir message is marked as seen once
+// all its articles were fetched and analyzed (or deferred), and left in new/ otherwise, so that
+// the next run tries it again. ctx is cancelled if the mailbox lease is lost.
+func runNewsletterMode(ctx context.Context, cfg *Config, llmOptions analyzer.LlmOptions, datastoreClient lib.DatastoreClient) {
+	messages, err := newsletterfetcher.ReadMailbox(cfg.Newsletters)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if len(messages) == 0 {
+		log.Printf("No new newsletters in %s\n", cfg.Newsletters)
+		return
+	}
+
+	options := fetchOptions(cfg)
+	retried := 0
+	for i, message := range messages {
+		if !analyzeNewsletter(ctx, cfg, llmOptions, options, message, i+1, len(messages), datastoreClient) {
+			retried++
+			continue
+		}
+		if err := newsletterfetcher.MarkSeen(message); err != nil {
+			log.Printf("Warning: %v\n", err)
+		}
+	}
+	if retried > 0 {
+		log.Printf("%d newsletter(s) not fully analyzed are kept as new for the next run\n", retried)
+	}
+}
+
+// analyzeNewsletter fetches and analyzes the articles of message, the index-th of total. It
+// reports whether every article was fetched and analyzed or deferred.
+func analyzeNewsletter(
+	ctx context.Context,
+	cfg *Config,
+	llmOptions analyzer.LlmOptions,
+	options fetcher.Options,
+	message *newsletterfetcher.Message,
+	index, total int,
+	datastoreClient lib.DatastoreClient,
+) bool {
+	fetchCtx, fetchCancel := context.WithTimeout(ctx, config.RSSTimeout)
+	defer fetchCancel()
+
+	pages, err := newsletterfetcher.FetchNewsletterArticles(fetchCtx, []*newsletterfetcher.Message{message}, cfg.Max, cfg.Verbose, datastoreClient, options)
+	if err != nil {
+		log.Printf("Warning: newsletter %q: %v\n", message.Subject, err)
+	}
+	if len(pages) == 0 {
+		if err == nil {
+			log.Printf("No articles to analyze in newsletter %d of %d (%q)\n", index, total, message.Subject)
+		}
+		return err == nil
+	}
+
+	log.Printf("\n%s\n", strings.Repeat("=", 60))
+	log.Printf("Analyzing %d article(s) from newsletter %d of %d (%q)\n", len(pages), index, total, message.Subject)
+	log.Printf("%s\n\n", strings.Repeat("=", 60))
+
+	_, failed := analyzeAndDisplay(ctx, cfg, llmOptions, pages, datastoreClient)
+	return err == nil && failed == 0
+}
+
+// newsletterLeaseName returns the name the lease of the mailbox at dir is taken under: a file://
+// URL of its absolute path, so that instances sharing the mailbox don't analyze it twice.
+func newsletterLeaseName(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return "file://" + filepath.ToSlash(dir)
+}
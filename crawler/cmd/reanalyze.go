@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/crawler/config"
+	"github.com/zeace/poisson/crawler/utils"
+	"github.com/zeace/poisson/lib/logging"
+)
+
+// reanalyzeTimeout bounds a whole reanalyze run
+const reanalyzeTimeout = 30 * time.Minute
+
+// dateLayout is the format of the --since and --until dates
+const dateLayout = "2006-01-02"
+
+// runReanalyze handles the "reanalyze" subcommand: it forces a new analysis of one URL, of the
+// analyses made in a date range, of those older than a maximum age, or of the stored pages matching
+// a selector, replacing the cached results whatever their prompt or model. Run it on a schedule
+// with --max-age to keep results fresh.
+func runReanalyze(args []string) {
+	flags := flag.NewFlagSet("reanalyze", flag.ExitOnError)
+	var (
+		url       = flags.String("url", "", "URL of a crawled article to re-analyze")
+		since     = flags.String("since", "", "Re-analyze the analyses made on or after this date (YYYY-MM-DD, UTC)")
+		until     = flags.String("until", "", "With --since or --max-age, only re-analyze the analyses made before this date (YYYY-MM-DD, UTC)")
+		maxAge    = flags.String("max-age", "", "Re-analyze the analyses older than this, e.g. 30d or 12h")
+		selector  = flags.String("select", "", "Analyze the stored pages matching this selector, e.g. '{domain: \"example.com\", since: \"2025-03-01\", until: \"2025-04-01\", language: \"fr\", hasNoAnalysis: true, minLength: 2000}', where since and until select crawl dates and hasNoAnalysis the pages without an analysis in --mode")
+		mode      = flags.String("mode", "joke", "Analysis mode to re-run")
+		prompts   = flags.String("prompts", "", "Directory or gs://bucket/prefix with <mode>.prompt.md templates replacing the embedded ones (or set POISSON_PROMPTS environment variable)")
+		jokeWords = flags.String("joke-keywords", "", "Hedging keywords that keep a \"not a joke\" verdict from being inverted, as <language>:<keyword>,...;... e.g. en:joke,prank,satire (or set POISSON_JOKE_KEYWORDS environment variable)")
+		apiKey    = flags.String("api-key", "", "OpenAI API key (or set OPENAI_API_KEY environment variable)")
+		baseURL   = flags.String("base-url", "", "Base URL of an OpenAI-compatible API (or set OPENAI_BASE_URL environment variable)")
+		model     = flags.String("model", "", "LLM model name, overrides the per-mode default (or set OPENAI_MODEL environment variable)")
+		lang      = flags.String("language", "", "How to analyze non-English articles: as-is, instruct (tell the LLM the article language) or translate (translate into English first) (or set POISSON_LANGUAGE_POLICY environment variable)")
+		dryRun    = flags.Bool("dry-run", false, "List the analyses that would be re-run without calling the LLM")
+		verbose   = flags.Bool("verbose", false, "Show verbose output")
+		logLevel  = flags.String("log-level", "", "Minimum log level: debug, info, warn or error (or set POISSON_LOG_LEVEL environment variable)")
+		logFormat = flags.String("log-format", "", "Log format: text or json (or set POISSON_LOG_FORMAT environment variable)")
+	)
+	flags.Parse(args)
+
+	if err := logging.Init(*logLevel, *logFormat); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	promptMode, err := analyzer.VerifyValidMode(*mode)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	targets := 0
+	for _, set := range []bool{*url != "", *since != "" || *maxAge != "", *selector != ""} {
+		if set {
+			targets++
+		}
+	}
+	if targets != 1 {
+		log.Printf("Error: exactly one of --url, a range (--since and/or --max-age) or --select must be provided\n")
+		log.Printf("Usage: %s reanalyze [flags]\n", os.Args[0])
+		flags.PrintDefaults()
+		log.Fatalf("")
+	}
+	sinceDate, err := parseDateFlag("since", *since)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	untilDate, err := parseDateFlag("until", *until)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	olderThan, err := utils.ParseMaxAge(*maxAge)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	pageSelector, err := analyzer.ParsePageSelector(*selector)
+	if err != nil {
+		log.Fatalf("Error: --select: %v\n", err)
+	}
+	languagePolicy, err := analyzer.ParseLanguagePolicy(config.GetLanguagePolicy(*lang))
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	loadPromptTemplates(*prompts)
+	loadJokeKeywords(*jokeWords)
+	loadMinContentLengths("", "")
+
+	datastoreClient := setupDatastore()
+	defer datastoreClient.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), reanalyzeTimeout)
+	defer cancel()
+
+	urls := []string{*url}
+	switch {
+	case *selector != "":
+		pages, err := analyzer.SelectPages(ctx, datastoreClient, pageSelector, promptMode)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		urls = make([]string, len(pages))
+		for i, page := range pages {
+			urls[i] = page.URL
+		}
+	case *url == "":
+		results, err := analyzer.FindAnalysesBetween(ctx, datastoreClient, promptMode, sinceDate, untilDate, olderThan)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		urls = resultURLs(results)
+	}
+
+	if *dryRun {
+		for _, url := range urls {
+			log.Printf("  %s\n", url)
+		}
+		log.Printf("%d analysis result(s) would be re-analyzed\n", len(urls))
+		return
+	}
+
+	llmOptions := analyzer.LlmOptions{
+		APIKey:  config.GetOpenAIKey(*apiKey),
+		BaseURL: config.GetOpenAIBaseURL(*baseURL),
+		Model:   config.GetOpenAIModel(*model),
+
+		Language: languagePolicy,
+	}
+	reanalyzeURLs(ctx, promptMode, urls, "selected", llmOptions, datastoreClient, *verbose)
+}
+
+// parseDateFlag parses the YYYY-MM-DD value of the named flag as midnight UTC.
+// An empty value returns the zero time.
+func parseDateFlag(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --%s date %q (want YYYY-MM-DD)", name, value)
+	}
+	return date, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/crawler/config"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+	"github.com/zeace/poisson/models"
+)
+
+// staleTimeout bounds listing and purging stale analyses
+const staleTimeout = 5 * time.Minute
+
+// runStale handles the "stale" subcommand: it finds stored analyses whose prompt fingerprint
+// or version no longer matches the current prompt and lists, deletes or re-runs them.
+func runStale(args []string) {
+	flags := flag.NewFlagSet("stale", flag.ExitOnError)
+	var (
+		mode      = flags.String("mode", "joke", "Analysis mode to check")
+		action    = flags.String("action", "list", "What to do with stale analyses: list, delete or reanalyze")
+		prompts   = flags.String("prompts", "", "Directory or gs://bucket/prefix with <mode>.prompt.md templates replacing the embedded ones (or set POISSON_PROMPTS environment variable)")
+		jokeWords = flags.String("joke-keywords", "", "Hedging keywords that keep a \"not a joke\" verdict from being inverted, as <language>:<keyword>,...;... e.g. en:joke,prank,satire (or set POISSON_JOKE_KEYWORDS environment variable)")
+		apiKey    = flags.String("api-key", "", "OpenAI API key for --action reanalyze (or set OPENAI_API_KEY environment variable)")
+		baseURL   = flags.String("base-url", "", "Base URL of an OpenAI-compatible API (or set OPENAI_BASE_URL environment variable)")
+		model     = flags.String("model", "", "LLM model name, overrides the per-mode default (or set OPENAI_MODEL environment variable)")
+		lang      = flags.String("language", "", "How to analyze non-English articles: as-is, instruct (tell the LLM the article language) or translate (translate into English first) (or set POISSON_LANGUAGE_POLICY environment variable)")
+		verbose   = flags.Bool("verbose", false, "Show verbose output")
+		logLevel  = flags.String("log-level", "", "Minimum log level: debug, info, warn or error (or set POISSON_LOG_LEVEL environment variable)")
+		logFormat = flags.String("log-format", "", "Log format: text or json (or set POISSON_LOG_FORMAT environment variable)")
+	)
+	flags.Parse(args)
+
+	if err := logging.Init(*logLevel, *logFormat); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	promptMode, err := analyzer.VerifyValidMode(*mode)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if *action != "list" && *action != "delete" && *action != "reanalyze" {
+		log.Printf("Error: unknown action '%s'. Valid actions: list, delete, reanalyze\n", *action)
+		log.Printf("Usage: %s stale [flags]\n", os.Args[0])
+		flags.PrintDefaults()
+		log.Fatalf("")
+	}
+
+	languagePolicy, err := analyzer.ParseLanguagePolicy(config.GetLanguagePolicy(*lang))
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	// Staleness is judged against the templates in use, so load overrides first
+	loadPromptTemplates(*prompts)
+	loadJokeKeywords(*jokeWords)
+	loadMinContentLengths("", "")
+
+	datastoreClient := setupDatastore()
+	defer datastoreClient.Close()
+
+	version, _ := analyzer.PromptVersion(promptMode)
+	fingerprint, _ := analyzer.GeneratePromptFingerprint(promptMode)
+	log.Printf("Current %s prompt: version %d, fingerprint %d\n", promptMode, version, fingerprint)
+
+	ctx, cancel := context.WithTimeout(context.Background(), staleTimeout)
+	defer cancel()
+
+	switch *action {
+	case "list":
+		stale, err := analyzer.FindStaleAnalyses(ctx, datastoreClient, promptMode)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		for _, result := range stale {
+			log.Printf("  %s (version %d, fingerprint %d)\n", result.URL, result.PromptVersion, result.PromptFingerprint)
+		}
+		log.Printf("%d stale analysis result(s)\n", len(stale))
+
+	case "delete":
+		deleted, err := analyzer.PurgeStaleAnalyses(ctx, datastoreClient, promptMode)
+		if err != nil {
+			log.Fatalf("Error after deleting %d result(s): %v\n", deleted, err)
+		}
+		log.Printf("Deleted %d stale analysis result(s)\n", deleted)
+
+	case "reanalyze":
+		llmOptions := analyzer.LlmOptions{
+			APIKey:  config.GetOpenAIKey(*apiKey),
+			BaseURL: config.GetOpenAIBaseURL(*baseURL),
+			Model:   config.GetOpenAIModel(*model),
+
+			Language: languagePolicy,
+		}
+		reanalyzeStale(ctx, promptMode, llmOptions, datastoreClient, *verbose)
+	}
+}
+
+// reanalyzeStale re-runs the analysis of every stale result whose page is still stored.
+func reanalyzeStale(
+	ctx context.Context,
+	mode analyzer.AnalysisMode,
+	llmOptions analyzer.LlmOptions,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+) {
+	stale, err := analyzer.FindStaleAnalyses(ctx, datastoreClient, mode)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	reanalyzeURLs(ctx, mode, resultURLs(stale), "stale", llmOptions, datastoreClient, verbose)
+}
+
+// resultURLs returns the URLs of results.
+func resultURLs(results []*models.AnalysisResult) []string {
+	urls := make([]string, len(results))
+	for i, result := range results {
+		urls[i] = result.URL
+	}
+	return urls
+}
+
+// reanalyzeURLs re-runs the analysis of every URL whose page is still stored, replacing the
+// cached results, and shows the LLM usage. kind describes the results in the summary.
+func reanalyzeURLs(
+	ctx context.Context,
+	mode analyzer.AnalysisMode,
+	urls []string,
+	kind string,
+	llmOptions analyzer.LlmOptions,
+	datastoreClient lib.DatastoreClient,
+	verbose bool,
+) {
+	var usage analyzer.UsageTotals
+	failed := 0
+	for i, url := range urls {
+		log.Printf("[%d/%d] %s\n", i+1, len(urls), url)
+
+		page, found, err := lib.ReadLinkedPage(ctx, datastoreClient, url)
+		if err != nil {
+			log.Printf("  Error reading crawled page: %v\n", err)
+			failed++
+			continue
+		}
+		if !found {
+			log.Printf("  Skipping: crawled page is no longer stored\n")
+			failed++
+			continue
+		}
+
+		analysisCtx, analysisCancel := context.WithTimeout(ctx, config.AnalysisTimeout)
+		analysis, err := analyzer.Reanalyze(analysisCtx, page, llmOptions, mode, datastoreClient, verbose)
+		analysisCancel()
+		if err != nil {
+			log.Printf("  Error: %v\n", err)
+			failed++
+			continue
+		}
+		usage.Add(analysis)
+	}
+
+	log.Printf("\n%s\n", strings.Repeat("=", 60))
+	log.Printf("Re-analyzed %d of %d %s result(s), %d failed\n", len(urls)-failed, len(urls), kind, failed)
+	log.Printf("%s\n", strings.Repeat("=", 60))
+	displayUsage(usage)
+}
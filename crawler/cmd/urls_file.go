@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/crawler/config"
+	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/crawler/utils"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// runURLsFileMode analyzes every article listed in the --urls-file file.
+// Invalid and duplicate URLs are reported and skipped.
+func runURLsFileMode(cfg *Config, llmOptions analyzer.LlmOptions, datastoreClient lib.DatastoreClient) {
+	lines, err := readURLsFile(cfg.URLsFile)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	var urls []string
+	for _, result := range utils.BatchValidate(lines) {
+		if result.Err != nil {
+			log.Printf("Skipping %q: %v\n", result.Input, result.Err)
+			continue
+		}
+		urls = append(urls, result.Normalized)
+	}
+	if len(urls) == 0 {
+		log.Fatalf("Error: no valid URLs in %s\n", cfg.URLsFile)
+	}
+	if sample := sampleOf(cfg); sample.Enabled() {
+		urls = utils.SampleItems(urls, sample)
+		log.Printf("Sampled %d of the URLs in %s\n", len(urls), cfg.URLsFile)
+	}
+
+	ctx := context.Background()
+	fetchCtx, fetchCancel := context.WithTimeout(ctx, config.RSSTimeout)
+	defer fetchCancel()
+
+	var pages []*models.CrawledPage
+	for _, result := range fetcher.FetchMany(fetchCtx, urls, cfg.Verbose, datastoreClient, fetchOptions(cfg)) {
+		if result.Err != nil {
+			log.Printf("Error fetching %s: %v\n", result.URL, result.Err)
+			continue
+		}
+		if result.Page.RobotsExcluded {
+			log.Printf("Skipping %s: page is marked noindex/noai\n", result.URL)
+			continue
+		}
+		pages = append(pages, result.Page)
+	}
+	if len(pages) == 0 {
+		log.Fatalf("Error: no articles fetched from %s\n", cfg.URLsFile)
+	}
+
+	log.Printf("\n%s\n", strings.Repeat("=", 60))
+	log.Printf("Analyzing %d article(s) from %s\n", len(pages), cfg.URLsFile)
+	log.Printf("%s\n\n", strings.Repeat("=", 60))
+
+	analyzeAndDisplay(ctx, cfg, llmOptions, pages, datastoreClient)
+}
+
+// readURLsFile returns the non-empty lines of path that don't start with #, trimmed.
+func readURLsFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening URLs file: %w", err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading URLs file: %w", err)
+	}
+	return lines, nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zeace/poisson/crawler/config"
+	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/crawler/rssfetcher"
+	"github.com/zeace/poisson/crawler/utils"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+)
+
+// runWarm handles the "warm" subcommand: it fetches and stores the articles of an RSS feed
+// without calling the LLM, so a later analysis run is served entirely from the Datastore cache.
+func runWarm(args []string) {
+	flags := flag.NewFlagSet("warm", flag.ExitOnError)
+	var (
+		verbose   = flags.Bool("verbose", false, "Show verbose output")
+		rss       = flags.String("rss", "", "URL of the RSS feed to warm")
+		max       = flags.Int("max", 5, "Maximum number of articles to fetch from RSS feed")
+		include   = flags.String("include", "", "Only fetch the feed items whose title or description matches one of these comma-separated keywords (case-insensitive) or /regular expressions/, e.g. \"April Fools,/\\bprank(s|ed)?\\b/\"")
+		exclude   = flags.String("exclude", "", "Leave out the feed items whose title or description matches one of these comma-separated keywords (case-insensitive) or /regular expressions/, e.g. sports,horoscope")
+		since     = flags.String("since", "", "Only fetch the feed items published at or after this time: an age such as 7d or 12h, a date such as 2026-04-01 or an RFC 3339 time; items without a date are left out")
+		until     = flags.String("until", "", "Only fetch the feed items published before this time: an age such as 7d or 12h, a date such as 2026-04-01 (included) or an RFC 3339 time; items without a date are left out")
+		feedAuth  = flags.String("feed-auth", "", "Credentials for a private feed and its articles: basic:<username>:<secret>, bearer:<secret> or header:<name>:<secret>, where <secret> names a secret in POISSON_SECRET_<NAME> or POISSON_SECRETS_DIR")
+		strData   = flags.String("structured-data", "", "How to extract articles: prefer uses schema.org JSON-LD Article data when present, ignore always uses HTML heuristics (or set POISSON_STRUCTURED_DATA environment variable)")
+		robots    = flags.String("robots", "", "How to handle noindex/noai pages: ignore or respect (or set POISSON_ROBOTS_POLICY environment variable)")
+		conc      = flags.Int("concurrency", fetcher.DefaultConcurrency, "Maximum number of articles fetched in parallel")
+		perHost   = flags.Int("per-host", fetcher.DefaultPerHostConcurrency, "Maximum number of parallel requests to a single host")
+		hostDelay = flags.Duration("host-delay", 0, "Minimum time between the starts of two requests to the same host, e.g. 500ms or 2s")
+		proxy     = flags.String("proxy", "", "Proxy of article fetches: an http://, https:// or socks5:// URL, or several separated by | to rotate through, with <domain>=<proxies> or <domain>=direct rules (or set POISSON_PROXY environment variable)")
+		fetchAt   = flags.Int("fetch-attempts", fetcher.DefaultRetryAttempts, "Number of attempts at fetching an article that times out or gets a 429, 502, 503 or 504 response, with exponential backoff between them (1 disables retries)")
+		maxBody   = flags.Int("max-body-mb", fetcher.DefaultMaxBodySize>>20, "Size in MB above which an article response is abandoned without reading the rest of it")
+		private   = flags.Bool("allow-private-addresses", false, "Fetch feeds and articles from private, loopback and link-local addresses, which are refused by default")
+		revalid   = flags.Bool("revalidate", false, "Refetch articles already in the Datastore with If-None-Match/If-Modified-Since requests, keeping the stored page when the server answers 304 Not Modified")
+		maxPage   = flags.String("cache-max-age", "", "Age after which articles in the Datastore are refetched, with If-None-Match/If-Modified-Since requests: a number of days (7d), a Go duration (12h) or never, with <domain>=<age> rules for a domain and its subdomains, e.g. 7d,example.com=1h,archive.example.org=never (or set POISSON_CACHE_MAX_AGE environment variable, default: never)")
+		coolOff   = flags.Duration("failure-cooldown", fetcher.DefaultFailureCooldown, "Time an article whose fetch failed is skipped, doubled for each other consecutive failure up to 24h, so that dead links aren't fetched on every poll (--force-refresh ignores it)")
+		pgCache   = flags.String("page-cache", "", "Where the text of fetched articles is cached: disk (the cache directory), memory, a gs://bucket/prefix URL or none (or set POISSON_PAGE_CACHE environment variable, default: disk)")
+		fileMax   = flags.String("file-cache-max-size", "", "Size of the disk or memory --page-cache above which its least recently used article texts are removed, e.g. 200MB or 2GB, or unlimited (or set POISSON_FILE_CACHE_MAX_SIZE environment variable, default: 512MB on disk, 64MB in memory)")
+		refresh   = flags.Bool("force-refresh", false, "Fetch every article from its URL, ignoring and replacing the pages stored in the Datastore and the file cache")
+		paywall   = flags.Bool("paywall-fallback", false, "Read articles that look paywalled or truncated from their AMP version or a web archive when one has more of the article")
+		mirrors   = flags.String("archive-mirrors", "", "Comma-separated URL prefixes of the web archives tried by --paywall-fallback (or set POISSON_ARCHIVE_MIRRORS environment variable, default: https://web.archive.org/web/)")
+		domBoil   = flags.Bool("domain-boilerplate", false, "Learn the text blocks repeated across the pages of each site and strip them from fetched articles")
+		render    = flags.Bool("render", false, "Render pages whose article text is shorter than --render-threshold in a headless Chrome or Chromium")
+		rendThr   = flags.Int("render-threshold", fetcher.DefaultRenderThreshold, "Number of characters of article text below which --render loads a page in the browser")
+		chrome    = flags.String("chrome-path", "", "Browser binary used by --render (or set POISSON_CHROME_PATH environment variable)")
+		noSandbox = flags.Bool("chrome-no-sandbox", false, "Run the browser of --render without Chrome's sandbox (or set POISSON_CHROME_NO_SANDBOX=true)")
+		screens   = flags.String("screenshots", "", "Where --render stores a screenshot of every fetched page: disk or a gs://bucket/prefix URL (or set POISSON_SCREENSHOTS environment variable)")
+		noLock    = flags.Bool("no-lock", false, "Don't take the per-feed lease that prevents other instances from polling the same feed")
+		logLevel  = flags.String("log-level", "", "Minimum log level: debug, info, warn or error (or set POISSON_LOG_LEVEL environment variable)")
+		logFormat = flags.String("log-format", "", "Log format: text or json (or set POISSON_LOG_FORMAT environment variable)")
+	)
+	flags.Parse(args)
+
+	if err := logging.Init(*logLevel, *logFormat); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	if *rss == "" {
+		log.Printf("Error: --rss must be provided\n")
+		log.Printf("Usage: %s warm [flags]\n", os.Args[0])
+		flags.PrintDefaults()
+		log.Fatalf("")
+	}
+	if err := utils.ValidateRSSURL(*rss); err != nil {
+		log.Fatalf("Invalid RSS feed URL: %v\n", err)
+	}
+	filter, err := rssfetcher.ParseItemFilter(*include, *exclude)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if filter.Since, filter.Until, err = rssfetcher.ParsePublishedWindow(*since, *until, time.Now()); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if *fetchAt < 1 {
+		log.Fatalf("Error: --fetch-attempts must be at least 1\n")
+	}
+	if *maxBody < 1 {
+		log.Fatalf("Error: --max-body-mb must be at least 1\n")
+	}
+	if *coolOff <= 0 {
+		log.Fatalf("Error: --failure-cooldown must be positive\n")
+	}
+	robotsPolicy, err := fetcher.ParseRobotsPolicy(config.GetRobotsPolicy(*robots))
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	structuredData, err := fetcher.ParseStructuredDataPolicy(config.GetStructuredDataPolicy(*strData))
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	fetchProxy, err := fetcher.ParseProxy(config.GetProxy(*proxy))
+	if err != nil {
+		log.Fatalf("Error: --proxy: %v\n", err)
+	}
+	cacheMaxAge, err := fetcher.ParseCacheMaxAge(config.GetCacheMaxAge(*maxPage))
+	if err != nil {
+		log.Fatalf("Error: --cache-max-age: %v\n", err)
+	}
+	archiveMirrors, err := fetcher.ParseArchiveMirrors(config.GetArchiveMirrors(*mirrors))
+	if err != nil {
+		log.Fatalf("Error: --archive-mirrors: %v\n", err)
+	}
+	screenshots := screenshotStore(config.GetScreenshots(*screens))
+	if screenshots != nil && !*render {
+		log.Fatalf("Error: --screenshots requires --render\n")
+	}
+	pageCache := openPageCache(config.GetPageCache(*pgCache), config.GetFileCacheMaxSize(*fileMax))
+
+	datastoreClient := setupDatastore()
+	defer datastoreClient.Close()
+
+	withFeedLease(*rss, *noLock, datastoreClient, func(ctx context.Context) {
+		warmFeed(ctx, *rss, *max, filter, *verbose, datastoreClient, fetcher.Options{
+			RobotsPolicy:          robotsPolicy,
+			StructuredData:        structuredData,
+			Credentials:           feedCredentials(*feedAuth, *rss),
+			Concurrency:           *conc,
+			PerHostConcurrency:    *perHost,
+			HostDelay:             *hostDelay,
+			RetryAttempts:         *fetchAt,
+			MaxBodySize:           int64(*maxBody) << 20,
+			AllowPrivateAddresses: *private,
+			DomainBoilerplate:     *domBoil,
+			Renderer:              pageRenderer(*render, config.GetChromePath(*chrome), config.GetChromeNoSandbox(*noSandbox), *private, int64(*maxBody)<<20),
+			RenderThreshold:       *rendThr,
+			Screenshots:           screenshots,
+			Proxy:                 fetchProxy,
+			Revalidate:            *revalid,
+			CacheMaxAge:           cacheMaxAge,
+			ForceRefresh:          *refresh,
+			FailureCooldown:       *coolOff,
+			PaywallFallback:       *paywall,
+			ArchiveMirrors:        archiveMirrors,
+			Cache:                 pageCache,
+		})
+	})
+}
+
+// warmFeed fetches and stores the articles of feedURL and reports how many were already cached.
+func warmFeed(
+	ctx context.Context,
+	feedURL string,
+	maxArticles int,
+	filter rssfetcher.ItemFilter,
+	verbose bool,
+	datastoreClient lib.DatastoreClient,
+	fetchOptions fetcher.Options,
+) {
+	rssCtx, rssCancel := context.WithTimeout(ctx, config.RSSTimeout)
+	defer rssCancel()
+
+	_, summary, err := rssfetcher.FetchRSSArticles(rssCtx, feedURL, maxArticles, utils.Sample{}, filter, verbose, datastoreClient, fetchOptions)
+	if summary != nil {
+		displayFetchSummary(summary)
+	}
+	if err != nil {
+		log.Fatalf("Error fetching RSS articles: %v\n", err)
+	}
+
+	log.Printf("\n%s\n", strings.Repeat("=", 60))
+	log.Printf("Warmed %d article(s) from RSS feed\n", summary.Fetched)
+	log.Printf("  Fetched and stored: %d (%d new)\n", summary.Fetched-summary.CacheHits-summary.Revalidated, summary.New)
+	log.Printf("  Already in Datastore: %d\n", summary.CacheHits)
+	if fetchOptions.Revalidate || fetchOptions.CacheMaxAge != nil {
+		log.Printf("  Not modified: %d\n", summary.Revalidated)
+	}
+	log.Printf("%s\n", strings.Repeat("=", 60))
+}
@@ -0,0 +1,15 @@
+package config
+
+import "os"
+
+// GetCacheMaxAge returns the max age of pages in the Datastore cache from the following sources
+// in order:
+// 1. flagValue (if provided)
+// 2. POISSON_CACHE_MAX_AGE environment variable
+// An empty result means cached pages never expire.
+func GetCacheMaxAge(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("POISSON_CACHE_MAX_AGE")
+}
@@ -17,6 +17,10 @@ const (
 
 	// RSSTimeout is the timeout for fetching and processing RSS feeds
 	RSSTimeout = 5 * time.Minute
+
+	// FeedLeaseTTL is how long a feed lease lasts without renewal.
+	// Leases are renewed while work is in progress, so this bounds how long a crashed instance blocks a feed.
+	FeedLeaseTTL = 2 * time.Minute
 )
 
 // NewContextWithTimeout creates a new context with the specified timeout
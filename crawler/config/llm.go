@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// GetOpenAIBaseURL returns the base URL of the OpenAI-compatible API from the following sources in order:
+// 1. flagValue (if provided)
+// 2. OPENAI_BASE_URL environment variable
+// 3. The local Ollama server in the nocloud build
+// An empty result means the official OpenAI endpoint is used.
+func GetOpenAIBaseURL(flagValue string) string {
+	return flagOrEnv(flagValue, "OPENAI_BASE_URL", defaultOpenAIBaseURL)
+}
+
+// GetOpenAIModel returns the model name from the following sources in order:
+// 1. flagValue (if provided)
+// 2. OPENAI_MODEL environment variable
+// 3. llama3.1 in the nocloud build
+// An empty result means the model configured for the analysis mode is used.
+func GetOpenAIModel(flagValue string) string {
+	return flagOrEnv(flagValue, "OPENAI_MODEL", defaultOpenAIModel)
+}
+
+// OptionalFloat is a flag.Value for a float flag that may be left unset.
+type OptionalFloat struct {
+	// Value is nil if the flag was not given.
+	Value *float64
+}
+
+// String returns the flag value, or "" if unset.
+func (f *OptionalFloat) String() string {
+	if f == nil || f.Value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f.Value, 'g', -1, 64)
+}
+
+// Set parses and stores the flag value.
+func (f *OptionalFloat) Set(s string) error {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", s)
+	}
+	f.Value = &v
+	return nil
+}
+
+// GetEmbeddingModel returns the embedding model name from the following sources in order:
+// 1. flagValue (if provided)
+// 2. OPENAI_EMBEDDING_MODEL environment variable
+// 3. nomic-embed-text in the nocloud build
+// An empty result means the default embedding model is used.
+func GetEmbeddingModel(flagValue string) string {
+	return flagOrEnv(flagValue, "OPENAI_EMBEDDING_MODEL", defaultEmbeddingModel)
+}
+
+// GetLanguagePolicy returns how non-English articles are analyzed from the following sources in order:
+// 1. flagValue (if provided)
+// 2. POISSON_LANGUAGE_POLICY environment variable
+// An empty result means articles are analyzed in their original language with the unchanged prompt.
+func GetLanguagePolicy(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("POISSON_LANGUAGE_POLICY")
+}
+
+// GetMaxAnalysisAge returns how long cached analyses are used before pages are analyzed again
+// from the following sources in order:
+// 1. flagValue (if provided)
+// 2. POISSON_MAX_ANALYSIS_AGE environment variable
+// An empty result means cached analyses never expire.
+func GetMaxAnalysisAge(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("POISSON_MAX_ANALYSIS_AGE")
+}
+
+// flagOrEnv returns flagValue if provided, else the environment variable env if set, else
+// fallback.
+func flagOrEnv(flagValue, env, fallback string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if value := os.Getenv(env); value != "" {
+		return value
+	}
+	return fallback
+}
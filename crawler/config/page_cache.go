@@ -0,0 +1,27 @@
+package config
+
+import "os"
+
+// GetFileCacheMaxSize returns the max size of the disk or memory page cache from the following
+// sources in order:
+// 1. flagValue (if provided)
+// 2. POISSON_FILE_CACHE_MAX_SIZE environment variable
+// An empty result means the default size of the cache.
+func GetFileCacheMaxSize(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("POISSON_FILE_CACHE_MAX_SIZE")
+}
+
+// GetPageCache returns where the text of fetched articles is cached from the following sources
+// in order:
+// 1. flagValue (if provided)
+// 2. POISSON_PAGE_CACHE environment variable
+// An empty result means the disk cache (see fetcher.OpenPageCache).
+func GetPageCache(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("POISSON_PAGE_CACHE")
+}
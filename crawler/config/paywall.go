@@ -0,0 +1,15 @@
+package config
+
+import "os"
+
+// GetArchiveMirrors returns the web archives tried for paywalled pages from the following
+// sources in order:
+// 1. flagValue (if provided)
+// 2. POISSON_ARCHIVE_MIRRORS environment variable
+// An empty result means the fetcher's default archives are used.
+func GetArchiveMirrors(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("POISSON_ARCHIVE_MIRRORS")
+}
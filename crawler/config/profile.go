@@ -0,0 +1,11 @@
+//go:build !nocloud
+
+package config
+
+// Defaults of the LLM settings when neither a flag nor an environment variable sets them. An
+// empty value keeps the default of the analyzer: the OpenAI API and the models of the modes.
+const (
+	defaultOpenAIBaseURL  = ""
+	defaultOpenAIModel    = ""
+	defaultEmbeddingModel = ""
+)
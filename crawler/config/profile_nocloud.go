@@ -0,0 +1,11 @@
+//go:build nocloud
+
+package config
+
+// Defaults of the LLM settings when neither a flag nor an environment variable sets them. The
+// nocloud build talks to a local Ollama server instead of the OpenAI API.
+const (
+	defaultOpenAIBaseURL  = "http://localhost:11434/v1"
+	defaultOpenAIModel    = "llama3.1"
+	defaultEmbeddingModel = "nomic-embed-text"
+)
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// PromptLoadTimeout is the timeout for loading prompt templates from a directory or GCS bucket
+const PromptLoadTimeout = 30 * time.Second
+
+// DefaultPromptReloadInterval is how often the server reads its prompt templates again to pick up changes
+const DefaultPromptReloadInterval = time.Minute
+
+// GetPromptSource returns the location of runtime prompt templates from the following sources in order:
+// 1. flagValue (if provided)
+// 2. POISSON_PROMPTS environment variable
+// The location is a local directory or a gs://bucket/prefix URL. An empty result means the embedded templates are used.
+func GetPromptSource(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("POISSON_PROMPTS")
+}
+
+// NewPromptLoadContext creates a context with PromptLoadTimeout for loading prompt templates
+func NewPromptLoadContext() (context.Context, context.CancelFunc) {
+	return NewContextWithTimeout(PromptLoadTimeout)
+}
+
+// GetMinContentLengths returns the per-mode minimum content lengths of analyzed pages from the
+// following sources in order:
+// 1. flagValue (if provided)
+// 2. POISSON_MIN_CONTENT_LENGTH environment variable
+// The format is "<mode>=<characters>,..." (see analyzer.ParseMinContentLengths). An empty result means the defaults.
+func GetMinContentLengths(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("POISSON_MIN_CONTENT_LENGTH")
+}
+
+// GetMinWordCounts returns the per-mode minimum word counts of analyzed pages from the
+// following sources in order:
+// 1. flagValue (if provided)
+// 2. POISSON_MIN_WORD_COUNT environment variable
+// The format is "<mode>=<words>,..." (see analyzer.ParseMinWordCounts). An empty result means no minimums.
+func GetMinWordCounts(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("POISSON_MIN_WORD_COUNT")
+}
+
+// GetJokeKeywords returns the hedging keywords of joke scoring from the following sources in order:
+// 1. flagValue (if provided)
+// 2. POISSON_JOKE_KEYWORDS environment variable
+// The format is "<language>:<keyword>,<keyword>;..." (see analyzer.ParseJokeKeywords). An empty result means no keywords.
+func GetJokeKeywords(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("POISSON_JOKE_KEYWORDS")
+}
@@ -0,0 +1,14 @@
+package config
+
+import "os"
+
+// GetProxy returns the proxy rules of the fetcher from the following sources in order:
+// 1. flagValue (if provided)
+// 2. POISSON_PROXY environment variable
+// An empty result means the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are used.
+func GetProxy(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("POISSON_PROXY")
+}
@@ -0,0 +1,34 @@
+package config
+
+import "os"
+
+// GetChromePath returns the browser binary used to render pages from the following sources in order:
+// 1. flagValue (if provided)
+// 2. POISSON_CHROME_PATH environment variable
+// An empty result means the first Chrome or Chromium binary found in PATH.
+func GetChromePath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("POISSON_CHROME_PATH")
+}
+
+// GetChromeNoSandbox returns whether the browser runs without its sandbox from the following
+// sources in order:
+// 1. flagValue (if true)
+// 2. POISSON_CHROME_NO_SANDBOX environment variable ("true")
+func GetChromeNoSandbox(flagValue bool) bool {
+	return flagValue || os.Getenv("POISSON_CHROME_NO_SANDBOX") == "true"
+}
+
+// GetScreenshots returns where the screenshots of rendered pages are stored from the following
+// sources in order:
+// 1. flagValue (if provided)
+// 2. POISSON_SCREENSHOTS environment variable
+// An empty result means no screenshots (see fetcher.OpenScreenshotStore).
+func GetScreenshots(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("POISSON_SCREENSHOTS")
+}
@@ -0,0 +1,14 @@
+package config
+
+import "os"
+
+// GetRobotsPolicy returns the robots directive policy from the following sources in order:
+// 1. flagValue (if provided)
+// 2. POISSON_ROBOTS_POLICY environment variable
+// An empty result means robots directives are recorded but not enforced.
+func GetRobotsPolicy(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("POISSON_ROBOTS_POLICY")
+}
@@ -0,0 +1,14 @@
+package config
+
+import "os"
+
+// GetStructuredDataPolicy returns the JSON-LD structured data policy from the following sources in order:
+// 1. flagValue (if provided)
+// 2. POISSON_STRUCTURED_DATA environment variable
+// An empty result means JSON-LD Article metadata is preferred over HTML heuristics.
+func GetStructuredDataPolicy(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	return os.Getenv("POISSON_STRUCTURED_DATA")
+}
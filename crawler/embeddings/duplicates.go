@@ -0,0 +1,154 @@
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+const (
+	// DefaultDuplicateThreshold is the cosine similarity above which two articles are
+	// considered copies of the same story.
+	DefaultDuplicateThreshold = 0.95
+
+	// DefaultDuplicateWindow is how far back stored embeddings are compared against.
+	DefaultDuplicateWindow = 7 * 24 * time.Hour
+
+	// maxEmbeddingChars limits the text sent to the embeddings API, well below its token limit.
+	maxEmbeddingChars = 8000
+)
+
+// DuplicateOptions configures FindDuplicates.
+type DuplicateOptions struct {
+	// Threshold is the minimum cosine similarity for a near-duplicate. Zero means DefaultDuplicateThreshold.
+	Threshold float64
+	// Window is how far back stored embeddings are considered. Zero means DefaultDuplicateWindow.
+	Window time.Duration
+}
+
+// Duplicate is a page found to be a near-duplicate of an earlier one.
+type Duplicate struct {
+	Page *models.CrawledPage
+	// OriginalURL is the URL of the most similar earlier page.
+	OriginalURL string
+	Similarity  float64
+}
+
+// EmbeddingText returns the text embedded for page: its title and the start of its content.
+func EmbeddingText(page *models.CrawledPage) string {
+	text := page.Title + "\n\n" + page.Content
+	if runes := []rune(text); len(runes) > maxEmbeddingChars {
+		text = string(runes[:maxEmbeddingChars])
+	}
+	return text
+}
+
+// FindDuplicates embeds the pages that don't have a stored embedding yet, stores them, and splits
+// pages into the ones to analyze and the near-duplicates of a page seen earlier, either in a
+// previous run (within opts.Window) or earlier in pages. Pages are compared to other URLs only,
+// so a page that is crawled again is never its own duplicate.
+func FindDuplicates(
+	ctx context.Context,
+	pages []*models.CrawledPage,
+	embedder Embedder,
+	datastoreClient lib.DatastoreClient,
+	opts DuplicateOptions,
+) ([]*models.CrawledPage, []Duplicate, error) {
+	threshold := opts.Threshold
+	if threshold == 0 {
+		threshold = DefaultDuplicateThreshold
+	}
+	window := opts.Window
+	if window == 0 {
+		window = DefaultDuplicateWindow
+	}
+	now := time.Now()
+
+	stored, err := datastoreClient.ListPageEmbeddingsSince(ctx, now.Add(-window))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing page embeddings: %w", err)
+	}
+	var candidates []*models.PageEmbedding
+	byURL := make(map[string]*models.PageEmbedding)
+	for _, embedding := range stored {
+		if embedding.Model != embedder.Model() {
+			continue // Vectors from other models can't be compared
+		}
+		candidates = append(candidates, embedding)
+		byURL[lib.NormalizeURL(embedding.URL)] = embedding
+	}
+
+	// Embed the pages without a stored embedding in one call
+	vectors := make([][]float64, len(pages))
+	embeddedAt := make([]time.Time, len(pages))
+	var missing []int
+	var texts []string
+	for i, page := range pages {
+		if embedding, ok := byURL[lib.NormalizeURL(page.URL)]; ok {
+			vectors[i] = embedding.Vector
+			embeddedAt[i] = embedding.CreatedAt
+			continue
+		}
+		missing = append(missing, i)
+		texts = append(texts, EmbeddingText(page))
+		embeddedAt[i] = now
+	}
+	var embedded [][]float64
+	if len(texts) > 0 {
+		embedded, err = embedder.Embed(ctx, texts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error computing embeddings: %w", err)
+		}
+	}
+	for j, i := range missing {
+		vectors[i] = embedded[j]
+		embedding := &models.PageEmbedding{
+			URL:       pages[i].URL,
+			Model:     embedder.Model(),
+			Vector:    embedded[j],
+			CreatedAt: now,
+		}
+		if err := datastoreClient.WritePageEmbedding(ctx, embedding); err != nil {
+			return nil, nil, fmt.Errorf("error saving embedding for %s: %w", pages[i].URL, err)
+		}
+	}
+
+	// Compare each page to the embeddings stored before its own and to the pages kept before it,
+	// so that a page seen again is not flagged as a copy of a later one
+	var kept []*models.CrawledPage
+	var duplicates []Duplicate
+	var keptEmbeddings []*models.PageEmbedding
+	for i, page := range pages {
+		key := lib.NormalizeURL(page.URL)
+		best := Duplicate{Page: page}
+		compare := func(candidate *models.PageEmbedding) {
+			if lib.NormalizeURL(candidate.URL) == key {
+				return
+			}
+			if similarity := CosineSimilarity(vectors[i], candidate.Vector); similarity > best.Similarity {
+				best.OriginalURL = candidate.URL
+				best.Similarity = similarity
+			}
+		}
+		for _, candidate := range candidates {
+			if candidate.CreatedAt.Before(embeddedAt[i]) {
+				compare(candidate)
+			}
+		}
+		for _, candidate := range keptEmbeddings {
+			compare(candidate)
+		}
+
+		if best.Similarity >= threshold {
+			duplicates = append(duplicates, best)
+			continue
+		}
+		kept = append(kept, page)
+		keptEmbeddings = append(keptEmbeddings, &models.PageEmbedding{URL: page.URL, Vector: vectors[i]})
+	}
+
+	return kept, duplicates, nil
+}
@@ -0,0 +1,167 @@
+package embeddings
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{"identical", []float64{1, 2, 3}, []float64{1, 2, 3}, 1},
+		{"scaled", []float64{1, 2, 3}, []float64{2, 4, 6}, 1},
+		{"orthogonal", []float64{1, 0}, []float64{0, 1}, 0},
+		{"opposite", []float64{1, 0}, []float64{-1, 0}, -1},
+		{"different lengths", []float64{1, 0}, []float64{1, 0, 0}, 0},
+		{"zero vector", []float64{0, 0}, []float64{1, 0}, 0},
+		{"empty", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CosineSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("CosineSimilarity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	// A story stored in a previous run, one stored too long ago, and one from another model
+	mockDS.WritePageEmbedding(ctx, &models.PageEmbedding{
+		URL: "example.com/original", Model: "test-model", Vector: []float64{1, 0, 0}, CreatedAt: time.Now(),
+	})
+	mockDS.WritePageEmbedding(ctx, &models.PageEmbedding{
+		URL: "example.com/old", Model: "test-model", Vector: []float64{0, 1, 0}, CreatedAt: time.Now().Add(-30 * 24 * time.Hour),
+	})
+	mockDS.WritePageEmbedding(ctx, &models.PageEmbedding{
+		URL: "example.com/other-model", Model: "other-model", Vector: []float64{0, 0, 1}, CreatedAt: time.Now(),
+	})
+
+	pages := []*models.CrawledPage{
+		{URL: "https://example.com/original", Title: "Original", Content: "Story"},
+		{URL: "mirror.com/copy", Title: "Copy", Content: "Story"},
+		{URL: "example.com/fresh", Title: "Fresh", Content: "New story"},
+		{URL: "mirror.com/fresh-copy", Title: "Fresh copy", Content: "New story"},
+		{URL: "example.com/unrelated", Title: "Unrelated", Content: "Other"},
+		{URL: "example.com/third", Title: "Third", Content: "Third story"},
+	}
+	embedder := &MockEmbedder{
+		ModelName: "test-model",
+		Vectors: map[string][]float64{
+			EmbeddingText(pages[1]): {0.99, 0.05, 0},
+			EmbeddingText(pages[2]): {0, 1, 0},
+			EmbeddingText(pages[3]): {0, 0.98, 0.1},
+			EmbeddingText(pages[4]): {0.5, 0.5, 0.7},
+			EmbeddingText(pages[5]): {0, 0, 1},
+		},
+	}
+
+	kept, duplicates, err := FindDuplicates(ctx, pages, embedder, mockDS, DuplicateOptions{})
+	if err != nil {
+		t.Fatalf("FindDuplicates() error = %v", err)
+	}
+
+	wantKept := []string{"https://example.com/original", "example.com/fresh", "example.com/unrelated", "example.com/third"}
+	if len(kept) != len(wantKept) {
+		t.Fatalf("Expected %d kept pages, got %d", len(wantKept), len(kept))
+	}
+	for i, url := range wantKept {
+		if kept[i].URL != url {
+			t.Errorf("kept[%d] = %s, want %s", i, kept[i].URL, url)
+		}
+	}
+
+	wantDuplicates := map[string]string{
+		"mirror.com/copy":       "example.com/original",
+		"mirror.com/fresh-copy": "example.com/fresh",
+	}
+	if len(duplicates) != len(wantDuplicates) {
+		t.Fatalf("Expected %d duplicates, got %d", len(wantDuplicates), len(duplicates))
+	}
+	for _, d := range duplicates {
+		if wantDuplicates[d.Page.URL] != d.OriginalURL || d.Similarity < DefaultDuplicateThreshold {
+			t.Errorf("Unexpected duplicate %s of %s (similarity %v)", d.Page.URL, d.OriginalURL, d.Similarity)
+		}
+	}
+
+	if embedder.Calls != 1 {
+		t.Errorf("Expected 1 Embed call, got %d", embedder.Calls)
+	}
+	stored, found, err := mockDS.ReadPageEmbedding(ctx, "example.com/third")
+	if err != nil || !found || stored.Model != "test-model" {
+		t.Errorf("Expected embedding to be stored for example.com/third, got %+v (err %v)", stored, err)
+	}
+}
+
+func TestFindDuplicates_Threshold(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	pages := []*models.CrawledPage{
+		{URL: "example.com/a", Title: "A", Content: "Story"},
+		{URL: "example.com/b", Title: "B", Content: "Story"},
+	}
+	embedder := &MockEmbedder{
+		ModelName: "test-model",
+		Vectors: map[string][]float64{
+			EmbeddingText(pages[0]): {1, 0},
+			EmbeddingText(pages[1]): {1, 0.5},
+		},
+	}
+
+	kept, duplicates, err := FindDuplicates(ctx, pages, embedder, mockDS, DuplicateOptions{})
+	if err != nil {
+		t.Fatalf("FindDuplicates() error = %v", err)
+	}
+	if len(kept) != 2 || len(duplicates) != 0 {
+		t.Errorf("Expected both pages kept at the default threshold, got %d kept and %d duplicates", len(kept), len(duplicates))
+	}
+
+	kept, duplicates, err = FindDuplicates(ctx, pages, embedder, mockDS, DuplicateOptions{Threshold: 0.8})
+	if err != nil {
+		t.Fatalf("FindDuplicates() error = %v", err)
+	}
+	if len(kept) != 1 || len(duplicates) != 1 || duplicates[0].Page.URL != "example.com/b" {
+		t.Errorf("Expected example.com/b to be a duplicate at threshold 0.8, got %d kept and %+v", len(kept), duplicates)
+	}
+	if embedder.Calls != 1 {
+		t.Errorf("Expected stored embeddings to be reused on the second call, got %d Embed calls", embedder.Calls)
+	}
+}
+
+func TestFindDuplicates_Errors(t *testing.T) {
+	ctx := context.Background()
+	pages := []*models.CrawledPage{{URL: "example.com/a", Title: "A", Content: "Story"}}
+
+	embedErr := errors.New("embeddings down")
+	_, _, err := FindDuplicates(ctx, pages, &MockEmbedder{Error: embedErr}, lib.NewMockDatastoreClient(), DuplicateOptions{})
+	if !errors.Is(err, embedErr) {
+		t.Errorf("Expected embedder error, got %v", err)
+	}
+
+	mockDS := lib.NewMockDatastoreClient()
+	mockDS.EmbeddingError = errors.New("datastore down")
+	_, _, err = FindDuplicates(ctx, pages, &MockEmbedder{}, mockDS, DuplicateOptions{})
+	if !errors.Is(err, mockDS.EmbeddingError) {
+		t.Errorf("Expected datastore error, got %v", err)
+	}
+}
+
+func TestEmbeddingText_Truncates(t *testing.T) {
+	page := &models.CrawledPage{Title: "Title", Content: string(make([]rune, 2*maxEmbeddingChars))}
+	if got := len([]rune(EmbeddingText(page))); got != maxEmbeddingChars {
+		t.Errorf("Expected %d runes, got %d", maxEmbeddingChars, got)
+	}
+}
@@ -0,0 +1,132 @@
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	openai "github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+)
+
+// DefaultModel is the embedding model used when Options.Model is empty.
+const DefaultModel = openai.EmbeddingModelTextEmbedding3Small
+
+// Embedder computes embedding vectors for texts.
+type Embedder interface {
+	// Embed returns one vector per text, in the same order.
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+	// Model returns the name of the embedding model.
+	Model() string
+}
+
+// Options configures OpenAIEmbedder.
+type Options struct {
+	// APIKey is the API key sent with every request.
+	APIKey string
+	// BaseURL is the base URL of an OpenAI-compatible server. Empty means the official OpenAI endpoint.
+	BaseURL string
+	// Model is the embedding model name. Empty means DefaultModel.
+	Model string
+}
+
+// OpenAIEmbedder is an Embedder that uses the OpenAI embeddings API
+// or any server that implements the same API.
+type OpenAIEmbedder struct {
+	apiKey  string
+	baseURL string
+	model   string
+}
+
+// NewOpenAIEmbedder creates a new OpenAIEmbedder from the provided options.
+func NewOpenAIEmbedder(opts Options) *OpenAIEmbedder {
+	model := opts.Model
+	if model == "" {
+		model = DefaultModel
+	}
+	return &OpenAIEmbedder{apiKey: opts.APIKey, baseURL: opts.BaseURL, model: model}
+}
+
+// Model returns the embedding model name used by this embedder.
+func (e *OpenAIEmbedder) Model() string {
+	return e.model
+}
+
+// Embed computes the embeddings of texts in a single API call.
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	requestOptions := []option.RequestOption{option.WithAPIKey(e.apiKey)}
+	if e.baseURL != "" {
+		requestOptions = append(requestOptions, option.WithBaseURL(e.baseURL))
+	}
+	client := openai.NewClient(requestOptions...)
+
+	response, err := client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: texts},
+		Model: e.model,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(response.Data))
+	}
+
+	vectors := make([][]float64, len(texts))
+	for _, embedding := range response.Data {
+		if embedding.Index < 0 || int(embedding.Index) >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range", embedding.Index)
+		}
+		vectors[embedding.Index] = embedding.Embedding
+	}
+	return vectors, nil
+}
+
+// CosineSimilarity returns the cosine similarity of a and b, between -1 and 1.
+// It returns 0 if the vectors have different lengths or either is all zeros.
+func CosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// MockEmbedder is a mock implementation of Embedder for testing.
+type MockEmbedder struct {
+	// Vectors maps a text to the vector returned for it. Texts not listed get a zero vector.
+	Vectors   map[string][]float64
+	Error     error
+	ModelName string
+	// Calls is the number of Embed calls made.
+	Calls int
+}
+
+// Embed returns the mock vectors or error.
+func (m *MockEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	m.Calls++
+	if m.Error != nil {
+		return nil, m.Error
+	}
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i] = m.Vectors[text]
+	}
+	return vectors, nil
+}
+
+// Model returns the mock model name.
+func (m *MockEmbedder) Model() string {
+	return m.ModelName
+}
@@ -0,0 +1,388 @@
+// Package feedpoller polls the feeds registered in the Datastore (see models.FeedSource) on
+// per-feed intervals, for the crawler daemon.
+package feedpoller
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zeace/poisson/crawler/config"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+	"github.com/zeace/poisson/models"
+)
+
+const (
+	// DefaultInterval is the time between two polls of a feed registered without an interval.
+	DefaultInterval = 30 * time.Minute
+	// DefaultRefreshInterval is the time between two reads of the registry, after which added,
+	// removed, disabled and updated feeds are taken into account.
+	DefaultRefreshInterval = time.Minute
+	// DefaultConcurrency is the maximum number of feeds polled at once.
+	DefaultConcurrency = 4
+	// DefaultShutdownGrace is how long polls in progress are given to finish on shutdown.
+	DefaultShutdownGrace = 30 * time.Second
+)
+
+// PollFunc polls a feed: fetches its new items and analyzes them.
+type PollFunc func(ctx context.Context, feed *models.FeedSource) (PollResult, error)
+
+// PollResult counts the articles of a poll, for the status.
+type PollResult struct {
+	Fetched  int `json:"fetched"`
+	New      int `json:"new"`
+	Analyzed int `json:"analyzed"`
+	Failed   int `json:"failed"`
+}
+
+// Options configures a Poller. Zero fields take their default.
+type Options struct {
+	// Interval is the time between two polls of the feeds registered without one.
+	Interval        time.Duration
+	RefreshInterval time.Duration
+	// Concurrency is the maximum number of feeds polled at once.
+	Concurrency   int
+	ShutdownGrace time.Duration
+	// NoLock polls feeds without taking their lease (see lib.FeedLeaseName). Otherwise a feed
+	// whose lease is held by another instance is skipped until its next poll.
+	NoLock bool
+}
+
+// Status is the state of a Poller, served as JSON by its ServeHTTP method.
+type Status struct {
+	StartedAt    time.Time `json:"started_at"`
+	ShuttingDown bool      `json:"shutting_down"`
+	// RegistryError is the error of the last read of the registry, empty if it succeeded.
+	RegistryError string       `json:"registry_error,omitempty"`
+	Feeds         []FeedStatus `json:"feeds"`
+}
+
+// FeedStatus is the state of a scheduled feed.
+type FeedStatus struct {
+	URL      string `json:"url"`
+	Name     string `json:"name,omitempty"`
+	Interval string `json:"interval"`
+	// Polling is true while the feed is being polled.
+	Polling    bool       `json:"polling"`
+	Polls      int        `json:"polls"`
+	LastPollAt *time.Time `json:"last_poll_at,omitempty"`
+	NextPollAt time.Time  `json:"next_poll_at"`
+	// LastResult and LastError are the outcome of the last poll made by this instance.
+	LastResult *PollResult `json:"last_result,omitempty"`
+	LastError  string      `json:"last_error,omitempty"`
+	// PolledElsewhere is true if the last poll was skipped because another instance held the
+	// lease of the feed.
+	PolledElsewhere bool `json:"polled_elsewhere,omitempty"`
+}
+
+// Poller polls the enabled feeds of the registry, each on its own interval. It is safe for
+// concurrent use.
+type Poller struct {
+	datastoreClient lib.DatastoreClient
+	poll            PollFunc
+	options         Options
+	holder          string
+	// finished wakes the scheduler when a poll ends, so that a waiting feed can start.
+	finished chan struct{}
+
+	mu            sync.Mutex
+	feeds         map[string]*scheduledFeed
+	startedAt     time.Time
+	shuttingDown  bool
+	registryError string
+}
+
+// scheduledFeed is a registered feed with its schedule and last outcome.
+type scheduledFeed struct {
+	feed     *models.FeedSource
+	nextPoll time.Time
+	running  bool
+
+	polls           int
+	lastPoll        time.Time
+	lastResult      *PollResult
+	lastError       string
+	polledElsewhere bool
+}
+
+// New returns a Poller that polls the registered feeds with poll.
+func New(datastoreClient lib.DatastoreClient, poll PollFunc, options Options) *Poller {
+	if options.Interval <= 0 {
+		options.Interval = DefaultInterval
+	}
+	if options.RefreshInterval <= 0 {
+		options.RefreshInterval = DefaultRefreshInterval
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = DefaultConcurrency
+	}
+	if options.ShutdownGrace <= 0 {
+		options.ShutdownGrace = DefaultShutdownGrace
+	}
+	return &Poller{
+		datastoreClient: datastoreClient,
+		poll:            poll,
+		options:         options,
+		holder:          lib.LeaseHolderID(),
+		finished:        make(chan struct{}, 1),
+		feeds:           make(map[string]*scheduledFeed),
+	}
+}
+
+// Run polls the registered feeds until ctx is done. New feeds are polled as soon as they are
+// read from the registry, then every interval after the start of their last poll. On shutdown
+// no poll is started, and Run waits for the polls in progress, which are cancelled if they
+// last longer than the shutdown grace period.
+func (p *Poller) Run(ctx context.Context) {
+	p.mu.Lock()
+	p.startedAt = time.Now()
+	p.mu.Unlock()
+
+	// Polls outlive ctx until the end of the grace period
+	pollCtx, cancelPolls := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelPolls()
+	var wg sync.WaitGroup
+
+	var refreshedAt time.Time
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			p.shutdown(&wg, cancelPolls)
+			return
+		case <-timer.C:
+		case <-p.finished:
+		}
+
+		now := time.Now()
+		if now.Sub(refreshedAt) >= p.options.RefreshInterval {
+			p.refresh(ctx, now)
+			refreshedAt = now
+		}
+		p.startDue(pollCtx, now, &wg)
+
+		wake := refreshedAt.Add(p.options.RefreshInterval)
+		if next := p.nextPoll(); !next.IsZero() && next.Before(wake) {
+			wake = next
+		}
+		timer.Reset(time.Until(wake))
+	}
+}
+
+// refresh reads the registry and updates the schedule: new feeds are due at now, and removed
+// or disabled feeds are dropped. If the registry can't be read, the schedule is kept.
+func (p *Poller) refresh(ctx context.Context, now time.Time) {
+	feeds, err := p.datastoreClient.ListFeedSources(ctx)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to read the feed registry, keeping the current schedule", "error", err)
+		p.registryError = err.Error()
+		return
+	}
+	p.registryError = ""
+
+	enabled := make(map[string]bool)
+	for _, feed := range feeds {
+		if !feed.Enabled {
+			continue
+		}
+		enabled[feed.URL] = true
+		scheduled, exists := p.feeds[feed.URL]
+		if !exists {
+			p.feeds[feed.URL] = &scheduledFeed{feed: feed, nextPoll: now}
+			continue
+		}
+		scheduled.feed = feed
+		if !scheduled.lastPoll.IsZero() {
+			// The interval may have changed
+			scheduled.nextPoll = scheduled.lastPoll.Add(p.interval(feed))
+		}
+	}
+	for url := range p.feeds {
+		if !enabled[url] {
+			delete(p.feeds, url)
+		}
+	}
+}
+
+// interval returns the time between two polls of feed.
+func (p *Poller) interval(feed *models.FeedSource) time.Duration {
+	if feed.PollInterval > 0 {
+		return feed.PollInterval
+	}
+	return p.options.Interval
+}
+
+// startDue starts polling the feeds due at now, longest overdue first, up to the concurrency
+// limit.
+func (p *Poller) startDue(ctx context.Context, now time.Time, wg *sync.WaitGroup) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	running := 0
+	var due []*scheduledFeed
+	for _, scheduled := range p.feeds {
+		switch {
+		case scheduled.running:
+			running++
+		case !scheduled.nextPoll.After(now):
+			due = append(due, scheduled)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].nextPoll.Before(due[j].nextPoll) })
+
+	for _, scheduled := range due[:max(0, min(len(due), p.options.Concurrency-running))] {
+		scheduled.running = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.pollFeed(ctx, scheduled)
+		}()
+	}
+}
+
+// nextPoll returns when the next feed not being polled is due, or the zero time if there is none.
+func (p *Poller) nextPoll() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var next time.Time
+	for _, scheduled := range p.feeds {
+		if !scheduled.running && (next.IsZero() || scheduled.nextPoll.Before(next)) {
+			next = scheduled.nextPoll
+		}
+	}
+	return next
+}
+
+// pollFeed polls the feed of scheduled under its lease and records the outcome.
+func (p *Poller) pollFeed(ctx context.Context, scheduled *scheduledFeed) {
+	p.mu.Lock()
+	feed := scheduled.feed
+	p.mu.Unlock()
+	ctx = logging.WithAttrs(ctx, "feed", feed.URL)
+
+	started := time.Now()
+	var result PollResult
+	var pollErr error
+	acquired := true
+	if p.options.NoLock {
+		result, pollErr = p.poll(ctx, feed)
+	} else {
+		var err error
+		acquired, err = lib.RunWithLease(ctx, p.datastoreClient, lib.FeedLeaseName(feed.URL), p.holder, config.FeedLeaseTTL,
+			func(ctx context.Context) error {
+				result, pollErr = p.poll(ctx, feed)
+				return nil
+			})
+		if err != nil {
+			pollErr = err
+		}
+	}
+
+	switch {
+	case pollErr != nil:
+		slog.WarnContext(ctx, "Failed to poll feed", "error", pollErr)
+	case !acquired:
+		slog.InfoContext(ctx, "Feed is being polled by another instance, skipping")
+	default:
+		slog.InfoContext(ctx, "Polled feed", "fetched", result.Fetched, "new", result.New,
+			"analyzed", result.Analyzed, "failed", result.Failed, "duration", time.Since(started))
+	}
+
+	p.mu.Lock()
+	scheduled.running = false
+	scheduled.polls++
+	scheduled.lastPoll = started
+	scheduled.nextPoll = started.Add(p.interval(scheduled.feed))
+	scheduled.polledElsewhere = pollErr == nil && !acquired
+	if acquired || pollErr != nil {
+		scheduled.lastResult = &result
+		scheduled.lastError = ""
+		if pollErr != nil {
+			scheduled.lastError = pollErr.Error()
+		}
+	}
+	p.mu.Unlock()
+
+	select {
+	case p.finished <- struct{}{}:
+	default:
+	}
+}
+
+// shutdown waits for the polls in progress, cancelling them after the shutdown grace period.
+func (p *Poller) shutdown(wg *sync.WaitGroup, cancelPolls context.CancelFunc) {
+	p.mu.Lock()
+	p.shuttingDown = true
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(p.options.ShutdownGrace):
+		slog.Warn("Polls still in progress after the shutdown grace period, cancelling them",
+			"grace", p.options.ShutdownGrace)
+		cancelPolls()
+		<-done
+	}
+}
+
+// Status returns the state of the poller, with the scheduled feeds by URL.
+func (p *Poller) Status() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := Status{
+		StartedAt:     p.startedAt,
+		ShuttingDown:  p.shuttingDown,
+		RegistryError: p.registryError,
+		Feeds:         make([]FeedStatus, 0, len(p.feeds)),
+	}
+	for _, scheduled := range p.feeds {
+		feedStatus := FeedStatus{
+			URL:             scheduled.feed.URL,
+			Name:            scheduled.feed.Name,
+			Interval:        p.interval(scheduled.feed).String(),
+			Polling:         scheduled.running,
+			Polls:           scheduled.polls,
+			NextPollAt:      scheduled.nextPoll,
+			LastError:       scheduled.lastError,
+			PolledElsewhere: scheduled.polledElsewhere,
+		}
+		if !scheduled.lastPoll.IsZero() {
+			lastPoll := scheduled.lastPoll
+			feedStatus.LastPollAt = &lastPoll
+		}
+		if scheduled.lastResult != nil {
+			lastResult := *scheduled.lastResult
+			feedStatus.LastResult = &lastResult
+		}
+		status.Feeds = append(status.Feeds, feedStatus)
+	}
+	sort.Slice(status.Feeds, func(i, j int) bool { return status.Feeds[i].URL < status.Feeds[j].URL })
+	return status
+}
+
+// ServeHTTP serves the status of the poller as JSON, with a 503 status code once it is
+// shutting down so that health checks stop routing to it.
+func (p *Poller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := p.Status()
+	w.Header().Set("Content-Type", "application/json")
+	if status.ShuttingDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(status); err != nil {
+		slog.WarnContext(r.Context(), "Failed to write poller status", "error", err)
+	}
+}
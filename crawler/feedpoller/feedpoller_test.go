@@ -0,0 +1,246 @@
+package feedpoller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// recordingPoll is a PollFunc that counts the polls of each feed.
+type recordingPoll struct {
+	mu    sync.Mutex
+	polls map[string]int
+}
+
+func (r *recordingPoll) poll(ctx context.Context, feed *models.FeedSource) (PollResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.polls == nil {
+		r.polls = make(map[string]int)
+	}
+	r.polls[feed.URL]++
+	return PollResult{Fetched: 2, New: 1, Analyzed: 1}, nil
+}
+
+func (r *recordingPoll) count(url string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.polls[url]
+}
+
+func addFeeds(t *testing.T, mockDS *lib.MockDatastoreClient, feeds ...*models.FeedSource) {
+	t.Helper()
+	for _, feed := range feeds {
+		if _, err := mockDS.AddFeedSource(context.Background(), feed); err != nil {
+			t.Fatalf("AddFeedSource(%s): %v", feed.URL, err)
+		}
+	}
+}
+
+// runFor runs poller for d and waits for it to shut down.
+func runFor(poller *Poller, d time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	poller.Run(ctx)
+}
+
+func TestPoller_PollsEnabledFeeds(t *testing.T) {
+	mockDS := lib.NewMockDatastoreClient()
+	addFeeds(t, mockDS,
+		&models.FeedSource{URL: "https://a.example/feed", Enabled: true},
+		&models.FeedSource{URL: "https://b.example/feed", Enabled: false},
+	)
+	recorder := &recordingPoll{}
+	poller := New(mockDS, recorder.poll, Options{Interval: time.Hour})
+
+	runFor(poller, 100*time.Millisecond)
+
+	if got := recorder.count("https://a.example/feed"); got != 1 {
+		t.Errorf("enabled feed polled %d times, want 1", got)
+	}
+	if got := recorder.count("https://b.example/feed"); got != 0 {
+		t.Errorf("disabled feed polled %d times, want 0", got)
+	}
+
+	status := poller.Status()
+	if len(status.Feeds) != 1 {
+		t.Fatalf("status has %d feeds, want 1", len(status.Feeds))
+	}
+	feedStatus := status.Feeds[0]
+	if feedStatus.Polls != 1 || feedStatus.LastPollAt == nil || feedStatus.LastResult == nil || feedStatus.LastResult.New != 1 {
+		t.Errorf("unexpected feed status %+v", feedStatus)
+	}
+	if feedStatus.Interval != "1h0m0s" {
+		t.Errorf("Interval = %q, want 1h0m0s", feedStatus.Interval)
+	}
+	if len(mockDS.Leases) != 0 {
+		t.Errorf("expected the feed lease to be released, got %v", mockDS.Leases)
+	}
+}
+
+func TestPoller_PollsOnFeedInterval(t *testing.T) {
+	mockDS := lib.NewMockDatastoreClient()
+	addFeeds(t, mockDS,
+		&models.FeedSource{URL: "https://fast.example/feed", Enabled: true, PollInterval: 20 * time.Millisecond},
+		&models.FeedSource{URL: "https://slow.example/feed", Enabled: true},
+	)
+	recorder := &recordingPoll{}
+	poller := New(mockDS, recorder.poll, Options{Interval: time.Hour})
+
+	runFor(poller, 150*time.Millisecond)
+
+	if got := recorder.count("https://fast.example/feed"); got < 3 {
+		t.Errorf("feed with a 20ms interval polled %d times, want at least 3", got)
+	}
+	if got := recorder.count("https://slow.example/feed"); got != 1 {
+		t.Errorf("feed with the default interval polled %d times, want 1", got)
+	}
+}
+
+func TestPoller_RefreshesRegistry(t *testing.T) {
+	mockDS := lib.NewMockDatastoreClient()
+	recorder := &recordingPoll{}
+	poller := New(mockDS, recorder.poll, Options{Interval: time.Hour, RefreshInterval: 20 * time.Millisecond})
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		addFeeds(t, mockDS, &models.FeedSource{URL: "https://new.example/feed", Enabled: true})
+	}()
+	runFor(poller, 150*time.Millisecond)
+
+	if got := recorder.count("https://new.example/feed"); got != 1 {
+		t.Errorf("feed added while running polled %d times, want 1", got)
+	}
+}
+
+// failingRegistry is a MockDatastoreClient whose registry can't be read once failing is set.
+type failingRegistry struct {
+	*lib.MockDatastoreClient
+	failing atomic.Bool
+}
+
+func (f *failingRegistry) ListFeedSources(ctx context.Context) ([]*models.FeedSource, error) {
+	if f.failing.Load() {
+		return nil, errors.New("datastore unavailable")
+	}
+	return f.MockDatastoreClient.ListFeedSources(ctx)
+}
+
+func TestPoller_KeepsScheduleOnRegistryError(t *testing.T) {
+	mockDS := &failingRegistry{MockDatastoreClient: lib.NewMockDatastoreClient()}
+	addFeeds(t, mockDS.MockDatastoreClient, &models.FeedSource{URL: "https://a.example/feed", Enabled: true})
+	recorder := &recordingPoll{}
+	poller := New(mockDS, recorder.poll, Options{Interval: time.Hour, RefreshInterval: 20 * time.Millisecond})
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		mockDS.failing.Store(true)
+	}()
+	runFor(poller, 150*time.Millisecond)
+
+	status := poller.Status()
+	if status.RegistryError == "" {
+		t.Error("expected the registry error in the status")
+	}
+	if len(status.Feeds) != 1 {
+		t.Errorf("status has %d feeds after a registry error, want 1", len(status.Feeds))
+	}
+}
+
+func TestPoller_SkipsFeedLeasedElsewhere(t *testing.T) {
+	mockDS := lib.NewMockDatastoreClient()
+	feedURL := "https://a.example/feed"
+	addFeeds(t, mockDS, &models.FeedSource{URL: feedURL, Enabled: true})
+	if _, err := mockDS.AcquireLease(context.Background(), lib.FeedLeaseName(feedURL), "other-instance", time.Hour); err != nil {
+		t.Fatalf("AcquireLease: %v", err)
+	}
+	recorder := &recordingPoll{}
+	poller := New(mockDS, recorder.poll, Options{Interval: time.Hour})
+
+	runFor(poller, 100*time.Millisecond)
+
+	if got := recorder.count(feedURL); got != 0 {
+		t.Errorf("feed leased by another instance polled %d times, want 0", got)
+	}
+	if feedStatus := poller.Status().Feeds[0]; !feedStatus.PolledElsewhere || feedStatus.LastResult != nil {
+		t.Errorf("unexpected feed status %+v", feedStatus)
+	}
+}
+
+func TestPoller_GracefulShutdown(t *testing.T) {
+	mockDS := lib.NewMockDatastoreClient()
+	addFeeds(t, mockDS, &models.FeedSource{URL: "https://a.example/feed", Enabled: true})
+
+	tests := []struct {
+		name          string
+		grace         time.Duration
+		wantCancelled bool
+	}{
+		{name: "poll finishes within grace", grace: time.Second, wantCancelled: false},
+		{name: "poll cancelled after grace", grace: 10 * time.Millisecond, wantCancelled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{})
+			var cancelled bool
+			poll := func(ctx context.Context, feed *models.FeedSource) (PollResult, error) {
+				close(started)
+				select {
+				case <-time.After(100 * time.Millisecond):
+				case <-ctx.Done():
+					cancelled = true
+				}
+				return PollResult{}, ctx.Err()
+			}
+			poller := New(mockDS, poll, Options{Interval: time.Hour, ShutdownGrace: tt.grace})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				poller.Run(ctx)
+				close(done)
+			}()
+			<-started
+			cancel()
+			<-done
+
+			if cancelled != tt.wantCancelled {
+				t.Errorf("poll cancelled = %v, want %v", cancelled, tt.wantCancelled)
+			}
+			if !poller.Status().ShuttingDown {
+				t.Error("expected the status to report the shutdown")
+			}
+		})
+	}
+}
+
+func TestPoller_ServeHTTP(t *testing.T) {
+	mockDS := lib.NewMockDatastoreClient()
+	addFeeds(t, mockDS, &models.FeedSource{URL: "https://a.example/feed", Name: "A", Enabled: true})
+	recorder := &recordingPoll{}
+	poller := New(mockDS, recorder.poll, Options{Interval: time.Hour})
+	runFor(poller, 50*time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	poller.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status code after shutdown = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	var status Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+	}
+	if len(status.Feeds) != 1 || status.Feeds[0].Name != "A" || status.Feeds[0].Polls != 1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
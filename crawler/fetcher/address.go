@@ -0,0 +1,127 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned for requests to private, loopback and link-local addresses,
+// unless Options.AllowPrivateAddresses is set.
+var ErrBlockedAddress = errors.New("blocked address")
+
+// cgnatPrefix is the shared address space of carrier-grade NAT, internal to the network like
+// private addresses.
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// blockedAddress reports whether ip is a private, loopback, link-local, unspecified or
+// multicast address, which feeds have no business pointing to: they reach the services of the
+// machine and of its network, such as cloud metadata servers at 169.254.169.254.
+func blockedAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || cgnatPrefix.Contains(ip)
+}
+
+// checkAddress fails with ErrBlockedAddress if address, an IP and port, is blocked. It has the
+// signature of net.Dialer.Control, which is called after name resolution, so that names
+// resolving to a public address when checked and to a private one when connecting are caught.
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+	}
+	if blockedAddress(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s is private, loopback or link-local", ErrBlockedAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+// checkHost resolves host and fails with ErrBlockedAddress if one of its addresses is blocked.
+// It checks the hosts of requests sent through a proxy, which the fetcher doesn't connect to.
+func checkHost(ctx context.Context, host string) error {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return checkAddress("", netip.AddrPortFrom(ip, 0).String(), nil)
+	}
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("error resolving %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		if blockedAddress(ip) {
+			return fmt.Errorf("%w: %s resolves to %s, which is private, loopback or link-local", ErrBlockedAddress, host, ip.Unmap())
+		}
+	}
+	return nil
+}
+
+// guardedTransport returns a copy of base that refuses to connect to blocked addresses, so
+// that neither the pages of a feed nor the redirects they answer with reach the internal
+// network. Requests sent through a proxy are checked by resolving their host, and the proxies
+// themselves may be private.
+func guardedTransport(base *http.Transport) *http.Transport {
+	transport := base.Clone()
+	var proxies sync.Map // Addresses of the proxies requests were sent through
+	baseProxy := transport.Proxy
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if baseProxy == nil {
+			return nil, nil
+		}
+		proxyURL, err := baseProxy(req)
+		if err != nil || proxyURL == nil {
+			return proxyURL, err
+		}
+		if err := checkHost(req.Context(), req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+		proxies.Store(proxyAddress(proxyURL), true)
+		return proxyURL, nil
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	guarded := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: checkAddress}
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if _, ok := proxies.Load(address); ok {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return guarded.DialContext(ctx, network, address)
+	}
+	return transport
+}
+
+// proxyAddress returns the host and port the transport connects to for proxyURL.
+func proxyAddress(proxyURL *url.URL) string {
+	if port := proxyURL.Port(); port != "" {
+		return net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+	port := map[string]string{"http": "80", "https": "443", "socks5": "1080", "socks5h": "1080"}[proxyURL.Scheme]
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
+
+// defaultTransport returns the transport of requests without a proxy rule, shared so that
+// connections are reused.
+var defaultTransport = sync.OnceValue(func() *http.Transport {
+	return guardedTransport(http.DefaultTransport.(*http.Transport))
+})
+
+// NewHTTPClient returns the client the fetcher sends the requests of opts with: through
+// opts.Proxy if set, and refusing to connect to private, loopback and link-local addresses
+// unless opts.AllowPrivateAddresses is set. Redirects to another host than the one of
+// opts.Credentials don't carry the credentials.
+func NewHTTPClient(opts Options, timeout time.Duration) *http.Client {
+	client := &http.Client{Timeout: timeout, CheckRedirect: opts.Credentials.checkRedirect}
+	switch {
+	case opts.Proxy != nil:
+		client.Transport = opts.Proxy.roundTripper(opts.AllowPrivateAddresses)
+	case !opts.AllowPrivateAddresses:
+		client.Transport = defaultTransport()
+	}
+	return client
+}
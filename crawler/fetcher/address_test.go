@@ -0,0 +1,88 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestBlockedAddress(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", false},
+		{"2606:2800:220:1:248:1893:25c8:1946", false},
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.100.100.200", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"0.0.0.0", true},
+		{"::ffff:127.0.0.1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := blockedAddress(netip.MustParseAddr(tt.ip)); got != tt.want {
+				t.Errorf("blockedAddress(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHTTPClient_BlocksPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "internal")
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(Options{}, 5*time.Second)
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Get(%s) error = %v, want ErrBlockedAddress", server.URL, err)
+	}
+
+	if _, err := client.Get("http://169.254.169.254/latest/meta-data/"); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Get(metadata server) error = %v, want ErrBlockedAddress", err)
+	}
+
+	resp, err := NewHTTPClient(Options{AllowPrivateAddresses: true}, 5*time.Second).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() with AllowPrivateAddresses error = %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestNewHTTPClient_PrivateProxy(t *testing.T) {
+	// A proxy on the local network is used, but requests for private addresses aren't sent to it
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.String())
+		fmt.Fprint(w, "proxied")
+	}))
+	defer server.Close()
+	proxy, err := ParseProxy(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewHTTPClient(Options{Proxy: proxy}, 5*time.Second)
+
+	if _, err := client.Get("http://10.0.0.1/admin"); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Get(private) error = %v, want ErrBlockedAddress", err)
+	}
+	resp, err := client.Get("http://93.184.216.34/story")
+	if err != nil {
+		t.Fatalf("Get(public) error = %v", err)
+	}
+	resp.Body.Close()
+	if len(requested) != 1 || requested[0] != "http://93.184.216.34/story" {
+		t.Errorf("proxy got %v, want only the public page", requested)
+	}
+}
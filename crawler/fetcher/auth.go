@@ -0,0 +1,119 @@
+package fetcher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// Credentials are sent with the requests for a private feed and its articles.
+type Credentials struct {
+	// Host restricts the credentials to requests to this host, so they are not leaked to
+	// articles hosted elsewhere. Empty means every request.
+	Host string
+	// Username and Password enable HTTP basic auth if Username is set.
+	Username string
+	Password string
+	// Headers are sent with every request, e.g. Authorization: Bearer <token>.
+	Headers map[string]string
+}
+
+// Apply adds the credentials to req if req goes to their host. It does nothing if c is nil.
+func (c *Credentials) Apply(req *http.Request) {
+	if !c.appliesTo(req) {
+		return
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	for name, value := range c.Headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// appliesTo reports whether the credentials are sent with req.
+func (c *Credentials) appliesTo(req *http.Request) bool {
+	return c != nil && (c.Host == "" || strings.EqualFold(req.URL.Hostname(), c.Host))
+}
+
+// checkRedirect is the redirect policy of the clients sending the credentials. http.Client
+// copies the headers of a request to its redirects, and only drops Authorization and cookies
+// when they leave the domain: the credential headers are removed from the redirects to another
+// host. Like the default policy, it stops after 10 redirects.
+func (c *Credentials) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if c != nil && !c.appliesTo(req) {
+		if c.Username != "" {
+			req.Header.Del("Authorization")
+		}
+		for name := range c.Headers {
+			req.Header.Del(name)
+		}
+	}
+	return nil
+}
+
+// ParseFeedAuth parses a credentials reference given on the command line:
+// "basic:<username>:<secret>", "bearer:<secret>" or "header:<name>:<secret>",
+// where <secret> is the name of a secret (see lib.ReadSecret), not its value.
+func ParseFeedAuth(spec string) (*models.FeedAuth, error) {
+	authType, rest, _ := strings.Cut(spec, ":")
+	parts := strings.Split(rest, ":")
+	switch models.FeedAuthType(strings.ToLower(authType)) {
+	case models.FeedAuthBasic:
+		if len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+			return &models.FeedAuth{Type: models.FeedAuthBasic, Username: parts[0], SecretName: parts[1]}, nil
+		}
+	case models.FeedAuthBearer:
+		if len(parts) == 1 && parts[0] != "" {
+			return &models.FeedAuth{Type: models.FeedAuthBearer, SecretName: parts[0]}, nil
+		}
+	case models.FeedAuthHeader:
+		if len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+			return &models.FeedAuth{Type: models.FeedAuthHeader, Header: parts[0], SecretName: parts[1]}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid feed auth %q (valid: basic:<username>:<secret>, bearer:<secret>, header:<name>:<secret>)", spec)
+}
+
+// ResolveCredentials reads the secret referenced by auth and returns the credentials to use
+// for feedURL and the articles on the same host. It returns nil if auth is nil.
+func ResolveCredentials(feedURL string, auth *models.FeedAuth) (*Credentials, error) {
+	return resolveCredentials(feedURL, auth, lib.ReadSecret)
+}
+
+// resolveCredentials implements ResolveCredentials with secrets read by readSecret.
+func resolveCredentials(
+	feedURL string,
+	auth *models.FeedAuth,
+	readSecret func(name string) (string, error),
+) (*Credentials, error) {
+	if auth == nil {
+		return nil, nil
+	}
+	secret, err := readSecret(auth.SecretName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading credentials for %s: %w", feedURL, err)
+	}
+
+	host, _, _ := strings.Cut(urlHost(feedURL), ":")
+	credentials := &Credentials{Host: host}
+	switch auth.Type {
+	case models.FeedAuthBasic:
+		credentials.Username = auth.Username
+		credentials.Password = secret
+	case models.FeedAuthBearer:
+		credentials.Headers = map[string]string{"Authorization": "Bearer " + secret}
+	case models.FeedAuthHeader:
+		credentials.Headers = map[string]string{auth.Header: secret}
+	default:
+		return nil, fmt.Errorf("unknown feed auth type '%s'", auth.Type)
+	}
+	return credentials, nil
+}
@@ -0,0 +1,131 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestParseFeedAuth(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    models.FeedAuth
+		wantErr bool
+	}{
+		{"basic:reader:feed-password", models.FeedAuth{Type: models.FeedAuthBasic, Username: "reader", SecretName: "feed-password"}, false},
+		{"bearer:feed-token", models.FeedAuth{Type: models.FeedAuthBearer, SecretName: "feed-token"}, false},
+		{"header:X-Api-Key:feed-key", models.FeedAuth{Type: models.FeedAuthHeader, Header: "X-Api-Key", SecretName: "feed-key"}, false},
+		{"basic:reader", models.FeedAuth{}, true},
+		{"bearer:", models.FeedAuth{}, true},
+		{"digest:secret", models.FeedAuth{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFeedAuth(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFeedAuth(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if err == nil && *got != tt.want {
+			t.Errorf("ParseFeedAuth(%q) = %+v, want %+v", tt.spec, *got, tt.want)
+		}
+	}
+}
+
+func TestResolveCredentials(t *testing.T) {
+	secrets := map[string]string{"feed-token": "s3cret"}
+	readSecret := func(name string) (string, error) {
+		if value, ok := secrets[name]; ok {
+			return value, nil
+		}
+		return "", errors.New("not found")
+	}
+
+	credentials, err := resolveCredentials("https://private.example.com:8443/feed.xml",
+		&models.FeedAuth{Type: models.FeedAuthBearer, SecretName: "feed-token"}, readSecret)
+	if err != nil {
+		t.Fatalf("resolveCredentials() error = %v", err)
+	}
+	if credentials.Host != "private.example.com" || credentials.Headers["Authorization"] != "Bearer s3cret" {
+		t.Errorf("Unexpected credentials %+v", credentials)
+	}
+
+	if _, err := resolveCredentials("https://private.example.com/feed.xml",
+		&models.FeedAuth{Type: models.FeedAuthBearer, SecretName: "missing"}, readSecret); err == nil {
+		t.Error("Expected error for missing secret, got nil")
+	}
+	if credentials, err := resolveCredentials("https://example.com/feed.xml", nil, readSecret); credentials != nil || err != nil {
+		t.Errorf("Expected no credentials for nil auth, got %+v, %v", credentials, err)
+	}
+}
+
+func TestFetchArticleContent_Credentials(t *testing.T) {
+	var gotUser, gotPassword string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, gotPassword, _ = r.BasicAuth()
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Private</title></head><body><main>Members only.</main></body></html>`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		host     string
+		wantUser string
+	}{
+		{"same host", "127.0.0.1", "reader"},
+		{"other host", "elsewhere.example.com", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUser, gotPassword = "", ""
+			opts := Options{Credentials: &Credentials{Host: tt.host, Username: "reader", Password: "s3cret"}}
+			httpClient := &http.Client{Timeout: 5 * time.Second}
+			var cacheWriter bytes.Buffer
+
+			_, _, err := fetchArticleContent(context.Background(), lib.NormalizeURL(server.URL), false,
+				lib.NewMockDatastoreClient(), httpClient, &cacheWriter, "/test/cache/path", opts)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if gotUser != tt.wantUser || (tt.wantUser != "" && gotPassword != "s3cret") {
+				t.Errorf("Server got basic auth %q:%q, want user %q", gotUser, gotPassword, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestNewHTTPClient_RedirectDropsCredentials(t *testing.T) {
+	var gotKey, gotAuthorization string
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey, gotAuthorization = r.Header.Get("X-Api-Key"), r.Header.Get("Authorization")
+	}))
+	defer elsewhere.Close()
+	// Same port, other host name: the credentials are only for 127.0.0.1
+	elsewhereURL := strings.Replace(elsewhere.URL, "127.0.0.1", "localhost", 1)
+	feed := httptest.NewServer(http.RedirectHandler(elsewhereURL, http.StatusFound))
+	defer feed.Close()
+
+	credentials := &Credentials{Host: "127.0.0.1", Username: "reader", Password: "s3cret", Headers: map[string]string{"X-Api-Key": "s3cret"}}
+	httpClient := NewHTTPClient(Options{AllowPrivateAddresses: true, Credentials: credentials}, 5*time.Second)
+	req, err := http.NewRequest("GET", feed.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials.Apply(req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	resp.Body.Close()
+	if gotKey != "" || gotAuthorization != "" {
+		t.Errorf("redirect to another host got X-Api-Key %q and Authorization %q, want none", gotKey, gotAuthorization)
+	}
+}
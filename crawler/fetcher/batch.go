@@ -0,0 +1,100 @@
+package fetcher
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+const (
+	// DefaultConcurrency is the default number of pages fetched in parallel by FetchMany.
+	DefaultConcurrency = 4
+
+	// DefaultPerHostConcurrency is the default number of in-flight requests to a single host.
+	DefaultPerHostConcurrency = 2
+)
+
+// FetchResult is the outcome of fetching a single URL with FetchMany.
+type FetchResult struct {
+	URL       string
+	Page      *models.CrawledPage
+	CachePath string
+	Err       error
+}
+
+// urlHost returns the host part of a URL with or without protocol, lowercased.
+func urlHost(url string) string {
+	host, _, _ := strings.Cut(lib.NormalizeURL(url), "/")
+	return strings.ToLower(host)
+}
+
+// FetchMany fetches several URLs concurrently with FetchArticleContent, through a Queue.
+// At most opts.Concurrency pages are fetched at once, and at most opts.PerHostConcurrency
+// of those go to the same host, started at least opts.HostDelay apart, so high parallelism
+// doesn't hammer a single origin. With opts.Queue, the URLs are fetched through that queue
+// under its limits instead. Results are returned in the same order as urls.
+func FetchMany(
+	ctx context.Context,
+	urls []string,
+	verbose bool,
+	datastoreClient lib.DatastoreClient,
+	opts Options,
+) []FetchResult {
+	if opts.Queue != nil {
+		return fetchThrough(ctx, opts.Queue, urls, opts)
+	}
+	return fetchMany(ctx, urls, opts, func(ctx context.Context, url string) (*models.CrawledPage, string, error) {
+		return FetchArticleContent(ctx, url, verbose, datastoreClient, opts)
+	})
+}
+
+// fetchMany runs fetch for each URL under the limits in opts. The URLs are fetched in order
+// as far as the per-host limits allow.
+func fetchMany(
+	ctx context.Context,
+	urls []string,
+	opts Options,
+	fetch func(ctx context.Context, url string) (*models.CrawledPage, string, error),
+) []FetchResult {
+	if len(urls) == 0 {
+		return []FetchResult{}
+	}
+	queue := newQueue(QueueOptions{
+		Concurrency:        opts.Concurrency,
+		PerHostConcurrency: opts.PerHostConcurrency,
+		HostDelay:          opts.HostDelay,
+	}, func(ctx context.Context, url string, _ Options) (*models.CrawledPage, string, error) {
+		return fetch(ctx, url)
+	})
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		queue.Run(runCtx)
+		close(done)
+	}()
+	results := fetchThrough(ctx, queue, urls, opts)
+	cancel()
+	<-done
+
+	return results
+}
+
+// fetchThrough enqueues urls on queue, which must be running, with ctx and opts, and returns
+// their results in the same order once they are all fetched.
+func fetchThrough(ctx context.Context, queue *Queue, urls []string, opts Options) []FetchResult {
+	results := make([]FetchResult, len(urls))
+	var wg sync.WaitGroup
+	wg.Add(len(urls))
+	for i, url := range urls {
+		queue.Enqueue(FetchRequest{URL: url, Context: ctx, Options: opts, Done: func(result FetchResult) {
+			results[i] = result
+			wg.Done()
+		}})
+	}
+	wg.Wait()
+	return results
+}
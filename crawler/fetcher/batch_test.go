@@ -0,0 +1,135 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/models"
+)
+
+func TestFetchMany_PerHostLimit(t *testing.T) {
+	urls := []string{
+		"https://a.example.com/1", "https://a.example.com/2", "https://a.example.com/3",
+		"https://a.example.com/4", "https://b.example.com/1", "https://b.example.com/2",
+	}
+
+	var mu sync.Mutex
+	inFlight := map[string]int{}
+	maxInFlight := map[string]int{}
+	total, maxTotal := 0, 0
+
+	fetch := func(ctx context.Context, url string) (*models.CrawledPage, string, error) {
+		host := urlHost(url)
+		mu.Lock()
+		inFlight[host]++
+		total++
+		if inFlight[host] > maxInFlight[host] {
+			maxInFlight[host] = inFlight[host]
+		}
+		if total > maxTotal {
+			maxTotal = total
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight[host]--
+		total--
+		mu.Unlock()
+		return &models.CrawledPage{URL: url}, "", nil
+	}
+
+	results := fetchMany(context.Background(), urls, Options{Concurrency: 3, PerHostConcurrency: 2}, fetch)
+
+	if len(results) != len(urls) {
+		t.Fatalf("Expected %d results, got %d", len(urls), len(results))
+	}
+	for i, result := range results {
+		if result.URL != urls[i] || result.Page == nil || result.Page.URL != urls[i] {
+			t.Errorf("Result %d out of order: %+v", i, result)
+		}
+	}
+	for host, max := range maxInFlight {
+		if max > 2 {
+			t.Errorf("Expected at most 2 in-flight requests to %s, got %d", host, max)
+		}
+	}
+	if maxTotal > 3 {
+		t.Errorf("Expected at most 3 in-flight requests overall, got %d", maxTotal)
+	}
+}
+
+func TestFetchMany_SharedQueue(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	q := newQueue(QueueOptions{Concurrency: 4, PerHostConcurrency: 1}, func(ctx context.Context, url string, opts Options) (*models.CrawledPage, string, error) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return &models.CrawledPage{URL: url}, "", nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	// Two batches of the same host are held to its limit together
+	var wg sync.WaitGroup
+	for batch := range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			urls := []string{fmt.Sprintf("https://a.example.com/%d/1", batch), fmt.Sprintf("https://a.example.com/%d/2", batch)}
+			for i, result := range FetchMany(ctx, urls, false, nil, Options{Queue: q}) {
+				if result.Err != nil || result.Page.URL != urls[i] {
+					t.Errorf("result %d = %+v, want %s", i, result, urls[i])
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if maxInFlight != 1 {
+		t.Errorf("Expected at most 1 in-flight request to the host across batches, got %d", maxInFlight)
+	}
+}
+
+func TestFetchMany_CollectsErrors(t *testing.T) {
+	urls := []string{"https://example.com/ok", "https://example.com/fail"}
+	fetch := func(ctx context.Context, url string) (*models.CrawledPage, string, error) {
+		if url == "https://example.com/fail" {
+			return nil, "", errors.New("boom")
+		}
+		return &models.CrawledPage{URL: url}, "/cache/ok", nil
+	}
+
+	results := fetchMany(context.Background(), urls, Options{}, fetch)
+
+	if results[0].Err != nil || results[0].CachePath != "/cache/ok" {
+		t.Errorf("Expected first fetch to succeed, got %+v", results[0])
+	}
+	if results[1].Err == nil || results[1].Page != nil {
+		t.Errorf("Expected second fetch to fail, got %+v", results[1])
+	}
+}
+
+func TestURLHost(t *testing.T) {
+	tests := map[string]string{
+		"https://Example.com/article?x=1": "example.com",
+		"example.com/article":             "example.com",
+		"http://localhost:8080/a":         "localhost:8080",
+	}
+	for input, expected := range tests {
+		if host := urlHost(input); host != expected {
+			t.Errorf("urlHost(%q) = %q, want %q", input, host, expected)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package fetcher
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// minBlockScore is the score below which a block is removed as page furniture (see blockScore).
+	minBlockScore = -3
+	// maxRemovedBlockShare is the largest share of the page text a removed block may hold, so
+	// that the container of the article is never taken for furniture.
+	maxRemovedBlockShare = 0.5
+	// maxFurnitureHeadingLength is the longest heading text compared with furnitureHeadingPattern.
+	maxFurnitureHeadingLength = 60
+)
+
+// blockTagScores are the scores of the tags of blocks that usually hold page furniture or the
+// article. Other tags score 0.
+var blockTagScores = map[string]float64{
+	"nav":     -3,
+	"menu":    -3,
+	"footer":  -3,
+	"aside":   -2,
+	"header":  -1,
+	"ul":      -0.5,
+	"ol":      -0.5,
+	"article": 2,
+	"main":    2,
+}
+
+// furnitureAttrPattern matches the id, class and role of navigation, sidebars, comment sections
+// and lists of other articles.
+var furnitureAttrPattern = regexp.MustCompile(`(?i)(navigation|navbar|menu|footer|sidebar|widget|comment|disqus|most-?(read|popular|viewed|shared)|popular|trending|top-?stories|related|recommend|more-?(from|stories|news)|read-?(more|next)|teaser|complementary|contentinfo)`)
+
+// furnitureHeadingPattern matches the headings of sidebars, comment sections and lists of other
+// articles, such as "Most Read" or "Related stories".
+var furnitureHeadingPattern = regexp.MustCompile(`(?i)^(most (read|popular|viewed|shared|commented)|trending( now| stories)?|popular( now| stories| articles)?|related( articles| stories| content| posts)?|you (may|might) also like|recommended( for you)?|read (more|next)|more (from|stories|news|on)\b.*|top stories|latest( news| stories)?|editor'?s picks|\d* ?comments?|leave a (comment|reply)|share this( article| story)?|follow us|meist ?gelesen|das könnte sie auch interessieren|les plus lus|à lire aussi|lo más leído|i più letti)\s*:?$`)
+
+// removeFurnitureBlocks removes the blocks of doc that score below minBlockScore, such as "Most
+// Read" sidebars, navigation and comment sections left by the other passes, unless they hold
+// more than maxRemovedBlockShare of the page text.
+func removeFurnitureBlocks(doc *goquery.Document) {
+	pageLength := len(normalizedText(doc.Find("body")))
+	if pageLength == 0 {
+		return
+	}
+	doc.Find("nav, menu, footer, aside, header, section, div, ul, ol").Each(func(_ int, s *goquery.Selection) {
+		text := normalizedText(s)
+		if text == "" || float64(len(text)) > maxRemovedBlockShare*float64(pageLength) {
+			return
+		}
+		if blockScore(s, text) < minBlockScore {
+			s.Remove()
+		}
+	})
+}
+
+// blockScore scores the block s with text text: negative for page furniture, positive for
+// article content. It adds up the score of its tag, its id, class and role, its heading, its link
+// density and how much prose it holds.
+func blockScore(s *goquery.Selection, text string) float64 {
+	score := blockTagScores[goquery.NodeName(s)]
+
+	attrs := s.AttrOr("id", "") + " " + s.AttrOr("class", "") + " " + s.AttrOr("role", "")
+	if furnitureAttrPattern.MatchString(attrs) {
+		score -= 2
+	}
+	if positiveClassPattern.MatchString(attrs) {
+		score++
+	}
+
+	heading := normalizedText(s.ChildrenFiltered("h1, h2, h3, h4, h5, h6").First())
+	if heading != "" && len(heading) <= maxFurnitureHeadingLength && furnitureHeadingPattern.MatchString(heading) {
+		score -= 3
+	}
+
+	density := linkDensity(s)
+	score -= 3 * density
+
+	// Sentences with little link text read like the article
+	if density < 0.25 {
+		sentences := strings.Count(text, ". ") + strings.Count(text, ", ")
+		score += min(float64(sentences)/4, 2) + min(float64(len(text))/500, 2)
+	}
+	return score
+}
@@ -0,0 +1,103 @@
+package fetcher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// blockScoreArticle is the article of the pages of TestRemoveFurnitureBlocks.
+const blockScoreArticle = `<article>
+	<h1>Mayor sells town hall</h1>
+	<p>The mayor announced on Tuesday, to the surprise of the council, that the town hall had been sold online.</p>
+	<p>The buyer, who has not been named, plans to turn the building into a bowling alley, according to the listing.</p>
+	<p>Residents, who learned the news from the local paper, gathered in front of the building in the evening.</p>
+</article>`
+
+func TestRemoveFurnitureBlocks(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		keep    []string
+		removed []string
+	}{
+		{
+			name: "most read sidebar with summaries",
+			html: `<body>` + blockScoreArticle + `
+				<div class="trending-box">
+					<h3>Most Read</h3>
+					<ol>
+						<li><a href="/a">Dog elected mayor</a> The dog won by a wide margin.</li>
+						<li><a href="/b">Lottery won twice</a> A lucky winner again.</li>
+						<li><a href="/c">Bridge painted pink</a> Nobody knows who did it.</li>
+					</ol>
+				</div>
+			</body>`,
+			keep:    []string{"The mayor announced", "The buyer", "Residents"},
+			removed: []string{"Most Read", "Dog elected mayor", "Nobody knows"},
+		},
+		{
+			name: "comment section",
+			html: `<body>` + blockScoreArticle + `
+				<section>
+					<h2>3 Comments</h2>
+					<div><a href="/u/1">jdoe</a> Unbelievable!</div>
+					<div><a href="/u/2">asmith</a> Typical.</div>
+				</section>
+			</body>`,
+			keep:    []string{"The mayor announced"},
+			removed: []string{"Unbelievable", "Typical"},
+		},
+		{
+			name: "footer with a sentence",
+			html: `<body>` + blockScoreArticle + `
+				<footer><a href="/about">About us</a> <a href="/contact">Contact</a> Example News is published daily.</footer>
+			</body>`,
+			keep:    []string{"The mayor announced"},
+			removed: []string{"About us", "published daily"},
+		},
+		{
+			name: "prose block with a furniture class",
+			html: `<body>` + blockScoreArticle + `
+				<div class="commentary">
+					<p>In his commentary, the editor argued that the sale, however strange, was legal, since the council had approved it, and that nothing could be done.</p>
+				</div>
+			</body>`,
+			keep: []string{"The mayor announced", "the editor argued"},
+		},
+		{
+			name: `article under a "comments" heading`,
+			html: `<body>
+				<div>
+					<h2>Comments</h2>
+					<p>The mayor announced on Tuesday that the town hall had been sold online.</p>
+				</div>
+			</body>`,
+			keep: []string{"The mayor announced"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+
+			removeFurnitureBlocks(doc)
+			text := doc.Find("body").Text()
+
+			for _, s := range tt.keep {
+				if !strings.Contains(text, s) {
+					t.Errorf("Expected text to contain %q, got: %s", s, text)
+				}
+			}
+			for _, s := range tt.removed {
+				if strings.Contains(text, s) {
+					t.Errorf("Expected %q to be removed, got: %s", s, text)
+				}
+			}
+		})
+	}
+}
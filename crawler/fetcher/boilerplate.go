@@ -0,0 +1,117 @@
+package fetcher
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// maxBoilerplateTextLength is the longest element text that can be removed as a consent or
+	// subscription notice. Longer elements are assumed to contain article content.
+	maxBoilerplateTextLength = 1000
+
+	// maxLinkDensity is the share of an element's text that may be link text before the element
+	// is treated as navigation or a link farm.
+	maxLinkDensity = 0.6
+
+	// minLinkDensityTextLength is the shortest element text the link-density check applies to,
+	// so that short captions and bylines consisting of a single link are kept.
+	minLinkDensityTextLength = 20
+)
+
+// boilerplateAttrPattern matches id and class names used by consent managers and paywalls,
+// anywhere in the name.
+var boilerplateAttrPattern = regexp.MustCompile(`(?i)(cookie|consent|gdpr|onetrust|didomi|usercentrics|quantcast|sp_message|paywall|piano-|newsletter-signup)`)
+
+// boilerplateTokenPattern matches the id and class tokens of consent dialogs, overlays and
+// subscription prompts. The words are generic, so they must start the token, alone or followed
+// by a - or _ (modal, modal-dialog, cmp-banner), so that article-overlay, photo-modal or
+// subscribers-only don't match.
+var boilerplateTokenPattern = regexp.MustCompile(`(?i)^(cmp|overlay|modal|subscribe)([-_]|$)`)
+
+// boilerplateTextPatterns matches the text of consent banners and subscription prompts.
+var boilerplateTextPatterns = []*regexp.Regexp{
+	// English
+	regexp.MustCompile(`(?i)\bwe (use|and our partners use) cookies\b`),
+	regexp.MustCompile(`(?i)\baccept (all )?cookies\b`),
+	regexp.MustCompile(`(?i)\b(manage|cookie) (consent|settings|preferences)\b`),
+	regexp.MustCompile(`(?i)\bsubscribe (now )?to (continue|keep) reading\b`),
+	regexp.MustCompile(`(?i)\balready a subscriber\b`),
+	// German
+	regexp.MustCompile(`(?i)\bwir verwenden cookies\b`),
+	regexp.MustCompile(`(?i)\balle akzeptieren\b`),
+	regexp.MustCompile(`(?i)\bjetzt abonnieren\b`),
+	// French
+	regexp.MustCompile(`(?i)\bnous utilisons des cookies\b`),
+	regexp.MustCompile(`(?i)\btout accepter\b`),
+	// Spanish and Italian
+	regexp.MustCompile(`(?i)\butilizamos cookies\b`),
+	regexp.MustCompile(`(?i)\butilizziamo (i )?cookie\b`),
+}
+
+// removeBoilerplate removes cookie-consent banners, subscription overlays, link-heavy
+// navigation blocks and other page furniture (see removeFurnitureBlocks) from the document so
+// they don't end up in the extracted text.
+func removeBoilerplate(doc *goquery.Document) {
+	// Elements named like consent managers or overlays
+	doc.Find("div, section, aside, form, dialog, iframe").Each(func(_ int, s *goquery.Selection) {
+		attrs := s.AttrOr("id", "") + " " + s.AttrOr("class", "")
+		if isBoilerplateAttrs(attrs) && len(strings.TrimSpace(s.Text())) <= maxBoilerplateTextLength {
+			s.Remove()
+		}
+	})
+
+	// Short elements whose text reads like a consent or subscription prompt
+	doc.Find("p, div, section, aside, form, dialog").Each(func(_ int, s *goquery.Selection) {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || len(text) > maxBoilerplateTextLength {
+			return
+		}
+		for _, pattern := range boilerplateTextPatterns {
+			if pattern.MatchString(text) {
+				s.Remove()
+				return
+			}
+		}
+	})
+
+	// Link-heavy blocks (menus, related-article lists, footers)
+	doc.Find("nav, aside, ul, ol, div, section, footer").Each(func(_ int, s *goquery.Selection) {
+		if linkDensity(s) > maxLinkDensity {
+			s.Remove()
+		}
+	})
+
+	// Sidebars, comment sections and lists of other articles with some prose
+	removeFurnitureBlocks(doc)
+}
+
+// linkDensity returns the share of the selection's text that is inside links.
+// It returns 0 for selections with too little text to judge.
+func linkDensity(s *goquery.Selection) float64 {
+	textLength := len(strings.Join(strings.Fields(s.Text()), " "))
+	if textLength < minLinkDensityTextLength {
+		return 0
+	}
+	linkLength := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		linkLength += len(strings.Join(strings.Fields(a.Text()), " "))
+	})
+	return float64(linkLength) / float64(textLength)
+}
+
+// isBoilerplateAttrs reports whether the id and class names in attrs are those of boilerplate
+// (see boilerplateAttrPattern and boilerplateTokenPattern).
+func isBoilerplateAttrs(attrs string) bool {
+	if boilerplateAttrPattern.MatchString(attrs) {
+		return true
+	}
+	for _, token := range strings.Fields(attrs) {
+		if boilerplateTokenPattern.MatchString(token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package fetcher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestRemoveBoilerplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		keep    []string
+		removed []string
+	}{
+		{
+			name: "consent banner by class name",
+			html: `<body>
+				<div class="cookie-banner">We value your privacy. Click OK to continue.</div>
+				<main><p>The mayor announced a new bridge on Tuesday.</p></main>
+			</body>`,
+			keep:    []string{"The mayor announced a new bridge"},
+			removed: []string{"We value your privacy"},
+		},
+		{
+			name: "consent banner by text (German)",
+			html: `<body>
+				<div><p>Wir verwenden Cookies, um Ihnen ein optimales Erlebnis zu bieten. Alle akzeptieren</p></div>
+				<article><p>Der Bürgermeister kündigte am Dienstag eine neue Brücke an.</p></article>
+			</body>`,
+			keep:    []string{"Der Bürgermeister kündigte"},
+			removed: []string{"Wir verwenden Cookies"},
+		},
+		{
+			name: "subscription prompt",
+			html: `<body>
+				<main>
+					<p>The mayor announced a new bridge on Tuesday.</p>
+					<p>Subscribe now to continue reading. Already a subscriber? Log in.</p>
+				</main>
+			</body>`,
+			keep:    []string{"The mayor announced a new bridge"},
+			removed: []string{"Subscribe now", "Already a subscriber"},
+		},
+		{
+			name: "link-heavy navigation",
+			html: `<body>
+				<ul><li><a href="/news">News</a></li><li><a href="/sport">Sport</a></li><li><a href="/weather">Weather</a></li><li><a href="/culture">Culture</a></li></ul>
+				<main><p>The mayor announced a new bridge on Tuesday, <a href="/bridge">reports say</a>.</p></main>
+			</body>`,
+			keep:    []string{"The mayor announced a new bridge", "reports say"},
+			removed: []string{"Weather", "Culture"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+
+			removeBoilerplate(doc)
+			text := doc.Find("body").Text()
+
+			for _, s := range tt.keep {
+				if !strings.Contains(text, s) {
+					t.Errorf("Expected text to contain %q, got: %s", s, text)
+				}
+			}
+			for _, s := range tt.removed {
+				if strings.Contains(text, s) {
+					t.Errorf("Expected %q to be removed, got: %s", s, text)
+				}
+			}
+		})
+	}
+}
+
+func TestIsBoilerplateAttrs(t *testing.T) {
+	tests := []struct {
+		attrs string
+		want  bool
+	}{
+		{attrs: "onetrust-banner-sdk", want: true},
+		{attrs: "site-header cookie-notice", want: true},
+		{attrs: "cmp-container", want: true},
+		{attrs: " modal fade", want: true},
+		{attrs: "subscribe_box", want: true},
+		{attrs: "main Overlay-dark", want: true},
+		{attrs: "article-overlay", want: false},
+		{attrs: "photo-modal", want: false},
+		{attrs: "subscribers-only", want: false},
+		{attrs: "story-cmp-figure", want: false},
+		{attrs: "article-body", want: false},
+	}
+	for _, tt := range tests {
+		if got := isBoilerplateAttrs(tt.attrs); got != tt.want {
+			t.Errorf("isBoilerplateAttrs(%q) = %v, want %v", tt.attrs, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package fetcher
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zeace/poisson/crawler/utils"
+	"github.com/zeace/poisson/models"
+)
+
+// cacheAgeNever is the max age of pages that never expire.
+const cacheAgeNever = "never"
+
+// CacheMaxAge is the age after which pages in the Datastore cache are fetched again, chosen by
+// the host of each page.
+type CacheMaxAge struct {
+	// rules are the per-domain max ages, longest domain first.
+	rules []cacheAgeRule
+	// fallback is the max age of pages matching no rule, negative if they never expire.
+	fallback time.Duration
+}
+
+// cacheAgeRule is the max age of the pages of a domain and its subdomains, negative if they
+// never expire.
+type cacheAgeRule struct {
+	domain string
+	maxAge time.Duration
+}
+
+// ParseCacheMaxAge parses a comma-separated list of max ages: <age> for all pages, and
+// <domain>=<age> for the pages of a domain and its subdomains, where <age> is a number of days
+// (30d), a Go duration (12h) or "never". Pages matching no rule never expire unless a rule
+// without a domain is given. It returns nil if spec is empty.
+func ParseCacheMaxAge(spec string) (*CacheMaxAge, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	maxAge := &CacheMaxAge{fallback: -1}
+	hasFallback := false
+	domains := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		domain, age, hasDomain := strings.Cut(entry, "=")
+		if !hasDomain {
+			domain, age = "", entry
+		}
+		duration, err := parseCacheAge(strings.TrimSpace(age))
+		if err != nil {
+			return nil, err
+		}
+
+		if !hasDomain {
+			if hasFallback {
+				return nil, fmt.Errorf("invalid cache max age %q: more than one rule without a domain", spec)
+			}
+			maxAge.fallback, hasFallback = duration, true
+			continue
+		}
+		domain = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "*"), ".")
+		if domain == "" || strings.ContainsAny(domain, "/:") {
+			return nil, fmt.Errorf("invalid cache max age rule %q: expected <domain>=<age>", entry)
+		}
+		if domains[domain] {
+			return nil, fmt.Errorf("invalid cache max age %q: more than one rule for %s", spec, domain)
+		}
+		domains[domain] = true
+		maxAge.rules = append(maxAge.rules, cacheAgeRule{domain: domain, maxAge: duration})
+	}
+
+	// Most specific domain first
+	sort.SliceStable(maxAge.rules, func(i, j int) bool { return len(maxAge.rules[i].domain) > len(maxAge.rules[j].domain) })
+	return maxAge, nil
+}
+
+// parseCacheAge parses "never", as a negative duration, or a max age for utils.ParseMaxAge.
+func parseCacheAge(age string) (time.Duration, error) {
+	if age == cacheAgeNever {
+		return -1, nil
+	}
+	if age == "" {
+		return 0, fmt.Errorf("invalid cache max age: missing age")
+	}
+	return utils.ParseMaxAge(age)
+}
+
+// Expired reports whether page, fetched or last validated longer ago than the max age of its
+// host, must be fetched again. It is false for every page if m is nil.
+func (m *CacheMaxAge) Expired(page *models.CrawledPage, now time.Time) bool {
+	if m == nil {
+		return false
+	}
+	maxAge := m.fallback
+	host, _, _ := strings.Cut(page.URL, "/")
+	host, _, _ = strings.Cut(strings.ToLower(host), ":")
+	for _, rule := range m.rules {
+		if inDomain(host, rule.domain) {
+			maxAge = rule.maxAge
+			break
+		}
+	}
+	if maxAge < 0 {
+		return false
+	}
+
+	checked := page.DateTime
+	if page.ValidatedAt.After(checked) {
+		checked = page.ValidatedAt
+	}
+	return now.Sub(checked) >= maxAge
+}
+
+// inDomain reports whether host is domain or one of its subdomains.
+func inDomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
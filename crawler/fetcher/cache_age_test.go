@@ -0,0 +1,73 @@
+package fetcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/models"
+)
+
+func TestParseCacheMaxAge(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{spec: ""},
+		{spec: "7d"},
+		{spec: "12h, example.com=1h, *.example.org=never"},
+		{spec: "example.com=0"},
+		{spec: "soon", wantErr: true},
+		{spec: "-1h", wantErr: true},
+		{spec: "1d,2d", wantErr: true},
+		{spec: "example.com=1h,EXAMPLE.com=2h", wantErr: true},
+		{spec: "=1h", wantErr: true},
+		{spec: "example.com=", wantErr: true},
+		{spec: "https://example.com=1h", wantErr: true},
+	}
+	for _, tt := range tests {
+		maxAge, err := ParseCacheMaxAge(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCacheMaxAge(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+		}
+		if err == nil && (maxAge == nil) != (tt.spec == "") {
+			t.Errorf("ParseCacheMaxAge(%q) = %v", tt.spec, maxAge)
+		}
+	}
+}
+
+func TestCacheMaxAge_Expired(t *testing.T) {
+	maxAge, err := ParseCacheMaxAge("1d,example.com=1h,archive.example.com=never,live.example.org=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tests := []struct {
+		url         string
+		age         time.Duration
+		validatedAt time.Duration
+		want        bool
+	}{
+		{url: "other.com/a", age: 2 * time.Hour, want: false},
+		{url: "other.com/a", age: 25 * time.Hour, want: true},
+		{url: "www.example.com/a", age: 2 * time.Hour, want: true},
+		{url: "www.example.com:8080/a", age: 30 * time.Minute, want: false},
+		{url: "example.com/a", age: 2 * time.Hour, validatedAt: 30 * time.Minute, want: false}, // Validated since
+		{url: "archive.example.com/a", age: 1000 * time.Hour, want: false},
+		{url: "live.example.org/a", want: true},
+	}
+	for _, tt := range tests {
+		page := &models.CrawledPage{URL: tt.url, DateTime: now.Add(-tt.age)}
+		if tt.validatedAt > 0 {
+			page.ValidatedAt = now.Add(-tt.validatedAt)
+		}
+		if got := maxAge.Expired(page, now); got != tt.want {
+			t.Errorf("Expired(%s, %v old) = %v, want %v", tt.url, tt.age, got, tt.want)
+		}
+	}
+
+	// Without a max age, pages never expire
+	var none *CacheMaxAge
+	if none.Expired(&models.CrawledPage{URL: "example.com/a"}, now) {
+		t.Error("Expired() = true without a max age")
+	}
+}
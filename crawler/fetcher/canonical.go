@@ -0,0 +1,62 @@
+package fetcher
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// redirectChain returns the URLs redirected from to reach the final request of resp, starting
+// with the requested one, or nil if the request wasn't redirected.
+func redirectChain(resp *http.Response) []string {
+	var chain []string
+	for req := resp.Request; req.Response != nil; req = req.Response.Request {
+		chain = append(chain, req.Response.Request.URL.String())
+	}
+	slices.Reverse(chain)
+	return chain
+}
+
+// pageKey returns the normalized URL a page read from finalURL is stored under: the canonical
+// URL the page declares if it is on the same site, so that the tracking and syndication variants
+// of an article share one entry, or else finalURL. A canonical URL pointing to the home page,
+// a common template mistake, is ignored for other pages.
+func pageKey(finalURL, canonicalURL string) string {
+	final, err := url.Parse(finalURL)
+	if err != nil || canonicalURL == "" {
+		return lib.NormalizeURL(finalURL)
+	}
+	canonical, err := url.Parse(canonicalURL)
+	if err != nil || !sameSite(final.Hostname(), canonical.Hostname()) || (isHomePage(canonical) && !isHomePage(final)) {
+		return lib.NormalizeURL(finalURL)
+	}
+	return lib.NormalizeURL(canonicalURL)
+}
+
+// sameSite reports whether the hosts a and b are the same, with or without a www. prefix.
+func sameSite(a, b string) bool {
+	a = strings.TrimPrefix(strings.ToLower(a), "www.")
+	b = strings.TrimPrefix(strings.ToLower(b), "www.")
+	return a != "" && a == b
+}
+
+// isHomePage reports whether u is the root of its site.
+func isHomePage(u *url.URL) bool {
+	return strings.Trim(u.Path, "/") == ""
+}
+
+// saveAlias stores requestedURL as an alias of the page stored under key. Failures are logged:
+// the requested URL is then fetched again the next time.
+func saveAlias(ctx context.Context, datastoreClient lib.DatastoreClient, requestedURL, key string, at time.Time) {
+	alias := &models.CrawledPage{URL: requestedURL, AliasOf: key, DateTime: at}
+	if err := datastoreClient.SaveCrawledPage(ctx, alias); err != nil {
+		slog.WarnContext(ctx, "Error saving alias of the page", "alias_of", key, "error", err)
+	}
+}
@@ -0,0 +1,24 @@
+package fetcher
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// toUTF8 converts an HTML body to UTF-8 and returns it with the name of its original charset.
+// The charset is the one declared by contentType, a byte order mark or a <meta charset> in the
+// first 1024 bytes of body. A body without a declared charset is kept if it is valid UTF-8, and
+// otherwise read as Windows-1252, like browsers do.
+func toUTF8(body []byte, contentType string) ([]byte, string) {
+	encoding, name, certain := charset.DetermineEncoding(body, contentType)
+	if name == "utf-8" || (!certain && utf8.Valid(body)) {
+		// Guesses are made from the first 1024 bytes only, a valid body is UTF-8 all along
+		return body, "utf-8"
+	}
+	decoded, err := encoding.NewDecoder().Bytes(body)
+	if err != nil {
+		return body, "utf-8"
+	}
+	return decoded, name
+}
@@ -0,0 +1,87 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+)
+
+func TestToUTF8(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		want        string
+		wantCharset string
+	}{
+		{
+			name:        "ISO-8859-1 from Content-Type",
+			body:        "<p>Caf\xe9 cr\xe8me</p>",
+			contentType: "text/html; charset=ISO-8859-1",
+			want:        "<p>Café crème</p>",
+			wantCharset: "windows-1252", // HTML reads ISO-8859-1 as its superset
+		},
+		{
+			name:        "Windows-1252 from meta charset",
+			body:        "<html><head><meta charset=\"windows-1252\"></head><body><p>\x93Quoted\x94 \x80</p></body></html>",
+			contentType: "text/html",
+			want:        `<html><head><meta charset="windows-1252"></head><body><p>“Quoted” €</p></body></html>`,
+			wantCharset: "windows-1252",
+		},
+		{
+			name:        "GBK from Content-Type",
+			body:        "<p>\xd6\xd0\xce\xc4</p>",
+			contentType: "text/html; charset=gbk",
+			want:        "<p>中文</p>",
+			wantCharset: "gbk",
+		},
+		{
+			name:        "undeclared UTF-8 beyond the first 1024 bytes",
+			body:        strings.Repeat("a", 2000) + "<p>Café</p>",
+			contentType: "text/html",
+			want:        strings.Repeat("a", 2000) + "<p>Café</p>",
+			wantCharset: "utf-8",
+		},
+		{
+			name:        "undeclared legacy charset",
+			body:        "<p>Caf\xe9</p>",
+			contentType: "",
+			want:        "<p>Café</p>",
+			wantCharset: "windows-1252",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotCharset := toUTF8([]byte(tt.body), tt.contentType)
+			if string(got) != tt.want || gotCharset != tt.wantCharset {
+				t.Errorf("toUTF8() = %q, %q, want %q, %q", got, gotCharset, tt.want, tt.wantCharset)
+			}
+		})
+	}
+}
+
+func TestFetchArticleContent_Charset(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+		w.Write([]byte("<html><head><title>Le caf\xe9</title></head><body><main>" +
+			"<p>Le caf\xe9 du village a \xe9t\xe9 r\xe9nov\xe9 cette ann\xe9e.</p></main></body></html>"))
+	}))
+	defer server.Close()
+
+	var cacheWriter bytes.Buffer
+	page, _, err := fetchArticleContent(context.Background(), lib.NormalizeURL(server.URL), false,
+		lib.NewMockDatastoreClient(), &http.Client{Timeout: 5 * time.Second}, &cacheWriter, "/test/cache/path", Options{})
+	if err != nil {
+		t.Fatalf("fetchArticleContent() error = %v", err)
+	}
+	if page.Title != "Le café" || !strings.Contains(page.Content, "a été rénové cette année") {
+		t.Errorf("expected the page converted to UTF-8, got title %q and content %q", page.Title, page.Content)
+	}
+}
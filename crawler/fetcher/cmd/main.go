@@ -11,14 +11,26 @@ import (
 	"github.com/zeace/poisson/crawler/fetcher"
 	"github.com/zeace/poisson/crawler/utils"
 	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
 )
 
 func main() {
 	var (
-		verbose = flag.Bool("verbose", false, "Show verbose output")
+		verbose   = flag.Bool("verbose", false, "Show verbose output")
+		strData   = flag.String("structured-data", "", "How to extract articles: prefer uses schema.org JSON-LD Article data when present, ignore always uses HTML heuristics (or set POISSON_STRUCTURED_DATA environment variable)")
+		robots    = flag.String("robots", "", "How to handle noindex/noai pages: ignore or respect (or set POISSON_ROBOTS_POLICY environment variable)")
+		pgCache   = flag.String("page-cache", "", "Where the text of fetched articles is cached: disk (the cache directory), memory, a gs://bucket/prefix URL or none (or set POISSON_PAGE_CACHE environment variable, default: disk)")
+		fileMax   = flag.String("file-cache-max-size", "", "Size of the disk or memory --page-cache above which its least recently used article texts are removed, e.g. 200MB or 2GB, or unlimited (or set POISSON_FILE_CACHE_MAX_SIZE environment variable, default: 512MB on disk, 64MB in memory)")
+		private   = flag.Bool("allow-private-addresses", false, "Fetch articles from private, loopback and link-local addresses, which are refused by default")
+		logLevel  = flag.String("log-level", "", "Minimum log level: debug, info, warn or error (or set POISSON_LOG_LEVEL environment variable)")
+		logFormat = flag.String("log-format", "", "Log format: text or json (or set POISSON_LOG_FORMAT environment variable)")
 	)
 	flag.Parse()
 
+	if err := logging.Init(*logLevel, *logFormat); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
 	if flag.NArg() == 0 {
 		log.Printf("Error: URL argument required\n")
 		log.Printf("Usage: %s [flags] <url>\n", os.Args[0])
@@ -33,6 +45,23 @@ func main() {
 		log.Fatalf("Invalid URL: %v\n", err)
 	}
 
+	robotsPolicy, err := fetcher.ParseRobotsPolicy(config.GetRobotsPolicy(*robots))
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	structuredData, err := fetcher.ParseStructuredDataPolicy(config.GetStructuredDataPolicy(*strData))
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	fileCacheMaxSize, err := fetcher.ParseFileCacheMaxSize(config.GetFileCacheMaxSize(*fileMax))
+	if err != nil {
+		log.Fatalf("Error: --file-cache-max-size: %v\n", err)
+	}
+	pageCache, err := fetcher.OpenPageCache(config.GetPageCache(*pgCache), fileCacheMaxSize)
+	if err != nil {
+		log.Fatalf("Error: --page-cache: %v\n", err)
+	}
+
 	// Set up Datastore client
 	dsCtx, dsCancel := config.NewDatastoreContext()
 	datastoreClient, err := lib.CreateDatastoreClient(dsCtx)
@@ -47,14 +76,29 @@ func main() {
 	defer fetchCancel()
 
 	log.Printf("Fetching article from: %s\n", url)
-	page, cachePath, err := fetcher.FetchArticleContent(fetchCtx, url, *verbose, datastoreClient)
+	page, cachePath, err := fetcher.FetchArticleContent(fetchCtx, url, *verbose, datastoreClient, fetcher.Options{
+		RobotsPolicy:          robotsPolicy,
+		StructuredData:        structuredData,
+		AllowPrivateAddresses: *private,
+		Cache:                 pageCache,
+	})
 	if err != nil {
 		log.Fatalf("Error: %v\n", err)
 	}
+	if page.RobotsExcluded {
+		log.Printf("Page is marked noindex/noai and was not stored (noindex=%v, noai=%v)\n", page.NoIndex, page.NoAI)
+	}
 
 	log.Printf("Title: %s\n", page.Title)
-	log.Printf("Cache file: %s\n", cachePath)
+	if cachePath != "" {
+		log.Printf("Cached text: %s\n", cachePath)
+	}
+	log.Printf("Source: %s\n", page.CacheSource)
 	log.Printf("Crawled at: %s\n", page.DateTime.Format(time.RFC3339))
+	log.Printf("Extraction: %s\n", page.ExtractionMethod)
+	if page.Author != "" {
+		log.Printf("Author: %s\n", page.Author)
+	}
 
 	log.Printf("\nFetched %d characters of content\n\n", len(page.Content))
 	log.Printf("Content:\n")
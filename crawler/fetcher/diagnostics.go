@@ -0,0 +1,41 @@
+package fetcher
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/zeace/poisson/models"
+)
+
+// diagnosticHeaders are the response headers recorded in models.FetchDiagnostics: those naming
+// the server, CDN or cache that answered, and those describing the content. Content-Encoding
+// isn't one of them, since decodeBody removes it from the response before it is described.
+var diagnosticHeaders = []string{
+	"Server",
+	"Via",
+	"Age",
+	"Cache-Control",
+	"X-Cache",
+	"CF-Cache-Status",
+	"Content-Language",
+	"X-Robots-Tag",
+}
+
+// fetchDiagnostics describes resp, whose decoded body is bodySize bytes and took latency to
+// read.
+func fetchDiagnostics(resp *http.Response, bodySize int, latency time.Duration) models.FetchDiagnostics {
+	var headers []string
+	for _, name := range diagnosticHeaders {
+		for _, value := range resp.Header.Values(name) {
+			headers = append(headers, name+": "+value)
+		}
+	}
+	return models.FetchDiagnostics{
+		Host:          resp.Request.URL.Hostname(),
+		StatusCode:    resp.StatusCode,
+		LatencyMillis: latency.Milliseconds(),
+		ContentType:   resp.Header.Get("Content-Type"),
+		BodyBytes:     bodySize,
+		Headers:       headers,
+	}
+}
@@ -0,0 +1,39 @@
+package fetcher
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/models"
+)
+
+func TestFetchDiagnostics(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header: http.Header{
+			"Content-Type":    {"text/html; charset=utf-8"},
+			"Server":          {"nginx"},
+			"Via":             {"1.1 varnish", "1.1 cdn"},
+			"Cf-Cache-Status": {"HIT"},
+			"Set-Cookie":      {"session=secret"},
+			// Not recorded, since decoding the body removes it
+			"Content-Encoding": {"gzip"},
+		},
+		Request: &http.Request{URL: &url.URL{Scheme: "https", Host: "www.example.com:8443", Path: "/article"}},
+	}
+	got := fetchDiagnostics(resp, 2048, 1500*time.Millisecond)
+	want := models.FetchDiagnostics{
+		Host:          "www.example.com",
+		StatusCode:    http.StatusOK,
+		LatencyMillis: 1500,
+		ContentType:   "text/html; charset=utf-8",
+		BodyBytes:     2048,
+		Headers:       []string{"Server: nginx", "Via: 1.1 varnish", "Via: 1.1 cdn", "CF-Cache-Status: HIT"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fetchDiagnostics() = %+v, want %+v", got, want)
+	}
+}
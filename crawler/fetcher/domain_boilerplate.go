@@ -0,0 +1,160 @@
+package fetcher
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+const (
+	// maxSimhashDistance is the largest number of differing simhash bits of two blocks that
+	// count as the same block, e.g. a footer with a different copyright year.
+	maxSimhashDistance = 3
+
+	// minSegmentWords is the fewest words a block needs to be tracked. Shorter blocks ("Share",
+	// "Read more") have unstable simhashes and are left to removeBoilerplate.
+	minSegmentWords = 4
+
+	// minBoilerplatePages is the fewest pages a block must be seen on to be stripped.
+	minBoilerplatePages = 5
+
+	// minBoilerplateShare is the share of a host's tracked pages a block must be seen on to be stripped.
+	minBoilerplateShare = 0.2
+
+	// maxTrackedSegments bounds the number of blocks tracked per host, keeping the most frequent
+	// and most recently seen ones.
+	maxTrackedSegments = 2000
+
+	// maxTrackedURLs bounds the number of page URLs remembered per host to count each page once.
+	maxTrackedURLs = 5000
+)
+
+// segmentSelector matches the elements whose text can form a block.
+const segmentSelector = "p, li, h1, h2, h3, h4, h5, h6, blockquote, pre, td, th, dd, dt, figcaption, " +
+	"div, section, aside, header, footer, form"
+
+// textSegment is a block of text of a page: an element of segmentSelector without nested blocks.
+type textSegment struct {
+	selection *goquery.Selection
+	simhash   uint64
+}
+
+// collectSegments returns the blocks of text of the document with at least minSegmentWords words.
+func collectSegments(doc *goquery.Document) []textSegment {
+	var segments []textSegment
+	doc.Find(segmentSelector).Each(func(_ int, s *goquery.Selection) {
+		if s.Find(segmentSelector).Length() > 0 {
+			return
+		}
+		if text := s.Text(); len(strings.Fields(text)) >= minSegmentWords {
+			segments = append(segments, textSegment{selection: s, simhash: simhash(text)})
+		}
+	})
+	return segments
+}
+
+// findSegment returns the index of the tracked block matching hash, or -1 if there is none.
+func findSegment(profile *models.DomainBoilerplate, hash uint64) int {
+	for i, segment := range profile.Segments {
+		if hammingDistance(uint64(segment.Simhash), hash) <= maxSimhashDistance {
+			return i
+		}
+	}
+	return -1
+}
+
+// isDomainBoilerplate reports whether a tracked block is seen on enough of the host's pages to be stripped.
+func isDomainBoilerplate(profile *models.DomainBoilerplate, segment models.SegmentCount) bool {
+	return segment.Pages >= minBoilerplatePages &&
+		float64(segment.Pages) >= minBoilerplateShare*float64(profile.Pages)
+}
+
+// removeDomainBoilerplate removes the blocks of segments that are boilerplate of profile's host
+// from their document. It returns the number of blocks removed.
+func removeDomainBoilerplate(profile *models.DomainBoilerplate, segments []textSegment) int {
+	removed := 0
+	for _, segment := range segments {
+		if i := findSegment(profile, segment.simhash); i >= 0 && isDomainBoilerplate(profile, profile.Segments[i]) {
+			segment.selection.Remove()
+			removed++
+		}
+	}
+	return removed
+}
+
+// urlHash returns the hash of a page URL recorded in DomainBoilerplate.URLHashes.
+func urlHash(url string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(url))
+	return int64(h.Sum64())
+}
+
+// trackSegments counts the blocks of the page at url of profile's host, each once per page. A page
+// already counted, e.g. fetched again after its cache expired, is not counted again.
+func trackSegments(profile *models.DomainBoilerplate, url string, segments []textSegment) {
+	hash := urlHash(url)
+	if slices.Contains(profile.URLHashes, hash) {
+		return
+	}
+	profile.URLHashes = append(profile.URLHashes, hash)
+	if len(profile.URLHashes) > maxTrackedURLs {
+		profile.URLHashes = profile.URLHashes[len(profile.URLHashes)-maxTrackedURLs:]
+	}
+
+	profile.Pages++
+	seen := make(map[int]bool)
+	for _, segment := range segments {
+		i := findSegment(profile, segment.simhash)
+		if i < 0 {
+			profile.Segments = append(profile.Segments, models.SegmentCount{Simhash: int64(segment.simhash)})
+			i = len(profile.Segments) - 1
+		}
+		if seen[i] {
+			continue
+		}
+		seen[i] = true
+		profile.Segments[i].Pages++
+		profile.Segments[i].LastSeen = profile.Pages
+	}
+
+	sort.SliceStable(profile.Segments, func(i, j int) bool {
+		a, b := profile.Segments[i], profile.Segments[j]
+		if a.Pages != b.Pages {
+			return a.Pages > b.Pages
+		}
+		return a.LastSeen > b.LastSeen
+	})
+	if len(profile.Segments) > maxTrackedSegments {
+		profile.Segments = profile.Segments[:maxTrackedSegments]
+	}
+}
+
+// stripDomainBoilerplate counts the blocks of doc, the page at url, in the profile of host, then
+// removes those repeated on many earlier pages of host. The profile is updated in a transaction,
+// since pages of the same host are fetched concurrently. Errors are logged, since the page can be
+// extracted without the profile. It returns the number of blocks removed.
+func stripDomainBoilerplate(
+	ctx context.Context,
+	doc *goquery.Document,
+	url, host string,
+	datastoreClient lib.DatastoreClient,
+) int {
+	segments := collectSegments(doc)
+	profile, err := datastoreClient.UpdateDomainBoilerplate(ctx, host, func(profile *models.DomainBoilerplate) {
+		trackSegments(profile, url, segments)
+		profile.UpdatedAt = time.Now()
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "Error updating domain boilerplate", "host", host, "error", err)
+		return 0
+	}
+	return removeDomainBoilerplate(profile, segments)
+}
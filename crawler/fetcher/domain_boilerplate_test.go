@@ -0,0 +1,150 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// siteFooter and siteNewsletter are repeated on every page of the test site.
+const (
+	siteFooter     = "Copyright 2024 Example News. All rights reserved. Contact us or read our privacy policy."
+	siteNewsletter = "Sign up for our morning briefing and get the top stories in your inbox every day."
+)
+
+func TestFetchArticleContent_DomainBoilerplate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><head><title>Article %[1]s</title></head><body><main>
+			<p>Article %[1]s reports that the council voted on proposal number %[1]s this week.</p>
+			<p>%[2]s</p>
+			<p>%[3]s</p>
+		</main></body></html>`, strings.TrimPrefix(r.URL.Path, "/"), siteNewsletter, siteFooter)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	mockDS := lib.NewMockDatastoreClient()
+	host := lib.NormalizeURL(server.URL)
+
+	for i := 1; i <= minBoilerplatePages+1; i++ {
+		var cacheWriter bytes.Buffer
+		normalizedURL := fmt.Sprintf("%s/%d", host, i)
+		page, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, "/test/cache/path",
+			Options{DomainBoilerplate: true})
+		if err != nil {
+			t.Fatalf("fetchArticleContent() error = %v", err)
+		}
+
+		if !strings.Contains(page.Content, fmt.Sprintf("proposal number %d", i)) {
+			t.Errorf("page %d: article text missing from %q", i, page.Content)
+		}
+		// Blocks are stripped once they were seen on minBoilerplatePages earlier pages
+		stripped := i > minBoilerplatePages
+		if strings.Contains(page.Content, "All rights reserved") == stripped ||
+			strings.Contains(page.Content, "morning briefing") == stripped {
+			t.Errorf("page %d: stripped = %v, content %q", i, !stripped, page.Content)
+		}
+	}
+
+	profile, found, _ := mockDS.ReadDomainBoilerplate(ctx, host)
+	if !found || profile.Pages != minBoilerplatePages+1 {
+		t.Fatalf("profile = %+v, want %d pages", profile, minBoilerplatePages+1)
+	}
+	if profile.Segments[0].Pages != minBoilerplatePages+1 || profile.Segments[1].Pages != minBoilerplatePages+1 {
+		t.Errorf("expected the repeated blocks first, got %+v", profile.Segments[:2])
+	}
+}
+
+func TestFetchArticleContent_DomainBoilerplateError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><body><main><p>The council voted on the proposal this week.</p><p>%s</p></main></body></html>`, siteFooter)
+	}))
+	defer server.Close()
+
+	mockDS := lib.NewMockDatastoreClient()
+	mockDS.BoilerplateError = fmt.Errorf("datastore unavailable")
+	var cacheWriter bytes.Buffer
+	page, _, err := fetchArticleContent(context.Background(), lib.NormalizeURL(server.URL), false, mockDS,
+		&http.Client{Timeout: 5 * time.Second}, &cacheWriter, "/test/cache/path", Options{DomainBoilerplate: true})
+	if err != nil {
+		t.Fatalf("fetchArticleContent() error = %v", err)
+	}
+	if !strings.Contains(page.Content, "council voted") || !strings.Contains(page.Content, "All rights reserved") {
+		t.Errorf("expected the whole page without a profile, got %q", page.Content)
+	}
+}
+
+func TestTrackSegments_Limit(t *testing.T) {
+	profile := &models.DomainBoilerplate{Host: "example.com"}
+	for i := 0; i < maxTrackedSegments+10; i++ {
+		profile.Segments = append(profile.Segments, models.SegmentCount{Simhash: int64(i), Pages: 1, LastSeen: 1})
+	}
+	repeated := textSegment{simhash: ^uint64(0)}
+	profile.Segments = append(profile.Segments, models.SegmentCount{Simhash: int64(repeated.simhash), Pages: 3, LastSeen: 1})
+
+	trackSegments(profile, "example.com/1", []textSegment{repeated, repeated})
+	if len(profile.Segments) != maxTrackedSegments {
+		t.Errorf("tracked %d segments, want %d", len(profile.Segments), maxTrackedSegments)
+	}
+	if first := profile.Segments[0]; first.Simhash != int64(repeated.simhash) || first.Pages != 4 || first.LastSeen != 1 {
+		t.Errorf("first segment = %+v, want the repeated block seen on 4 pages", first)
+	}
+}
+
+func TestStripDomainBoilerplate_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><body><p>" + siteFooter + "</p></body></html>"))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			stripDomainBoilerplate(ctx, doc, fmt.Sprintf("example.com/%d", i), "example.com", mockDS)
+		}(i)
+	}
+	wg.Wait()
+
+	// No update is lost to a concurrent one
+	profile, found, _ := mockDS.ReadDomainBoilerplate(ctx, "example.com")
+	if !found || profile.Pages != 20 || profile.Segments[0].Pages != 20 {
+		t.Errorf("profile = %+v, want the footer counted on 20 pages", profile)
+	}
+}
+
+func TestTrackSegments_DistinctURLs(t *testing.T) {
+	profile := &models.DomainBoilerplate{Host: "example.com"}
+	footer := textSegment{simhash: simhash(siteFooter)}
+
+	// A page fetched again isn't counted twice
+	for _, url := range []string{"example.com/1", "example.com/2", "example.com/1"} {
+		trackSegments(profile, url, []textSegment{footer})
+	}
+	if profile.Pages != 2 || len(profile.Segments) != 1 || profile.Segments[0].Pages != 2 {
+		t.Errorf("profile = %+v, want the footer counted on 2 pages", profile)
+	}
+
+	for i := 0; i < maxTrackedURLs+10; i++ {
+		trackSegments(profile, fmt.Sprintf("example.com/other/%d", i), nil)
+	}
+	if len(profile.URLHashes) != maxTrackedURLs {
+		t.Errorf("remembered %d URLs, want %d", len(profile.URLHashes), maxTrackedURLs)
+	}
+}
@@ -0,0 +1,63 @@
+package fetcher
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// acceptEncoding is sent with the fetcher's requests. Setting it turns off the transparent gzip
+// decoding of net/http, so all encodings are decoded by decodeBody.
+const acceptEncoding = "gzip, br, deflate"
+
+// decodeBody returns a reader of the body of resp decoded from its Content-Encoding, and
+// removes the encoding from the headers of resp. Unknown encodings fail instead of being
+// stored as garbled content.
+func decodeBody(resp *http.Response, body io.Reader) (io.Reader, error) {
+	encodings := strings.Split(resp.Header.Get("Content-Encoding"), ",")
+	// Encodings are listed in the order they were applied
+	for i := len(encodings) - 1; i >= 0; i-- {
+		switch encoding := strings.ToLower(strings.TrimSpace(encodings[i])); encoding {
+		case "", "identity":
+		case "gzip", "x-gzip":
+			reader, err := gzip.NewReader(body)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding gzip response: %w", err)
+			}
+			body = reader
+		case "br":
+			body = brotli.NewReader(body)
+		case "deflate":
+			body = inflate(body)
+		default:
+			return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+		}
+	}
+	if resp.Header.Get("Content-Encoding") != "" {
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	return body, nil
+}
+
+// inflate returns a reader of the deflate-encoded body, which servers send either in a zlib
+// stream, as the specification says, or as raw deflate data.
+func inflate(body io.Reader) io.Reader {
+	buffered := bufio.NewReader(body)
+	// A zlib stream starts with a header whose checksum is a multiple of 31, deflate method
+	if header, err := buffered.Peek(2); err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		if reader, err := zlib.NewReader(buffered); err == nil {
+			return reader
+		}
+	}
+	return flate.NewReader(buffered)
+}
@@ -0,0 +1,75 @@
+package fetcher
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestFetchWithRetry_ContentEncoding(t *testing.T) {
+	page := "<html><body><main><p>" + strings.Repeat("Encoded article. ", 20) + "</p></main></body></html>"
+	encode := func(newWriter func(io.Writer) io.WriteCloser) []byte {
+		var buf bytes.Buffer
+		w := newWriter(&buf)
+		w.Write([]byte(page))
+		w.Close()
+		return buf.Bytes()
+	}
+	gzipped := encode(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		maxSize  int64
+		wantErr  error
+	}{
+		{"identity", "", []byte(page), 0, nil},
+		{"gzip", "gzip", gzipped, 0, nil},
+		{"brotli", "br", encode(func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }), 0, nil},
+		{"zlib deflate", "deflate", encode(func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }), 0, nil},
+		{"raw deflate", "deflate", encode(func(w io.Writer) io.WriteCloser { w2, _ := flate.NewWriter(w, flate.DefaultCompression); return w2 }), 0, nil},
+		{"unknown encoding", "zstd", []byte("garbage"), 0, errors.New("unsupported content encoding")},
+		{"over the limit once decoded", "gzip", gzipped, int64(len(gzipped)), ErrBodyTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var accepted string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				accepted = r.Header.Get("Accept-Encoding")
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.Write(tt.body)
+			}))
+			defer server.Close()
+
+			req, _ := http.NewRequest("GET", server.URL, nil)
+			resp, body, err := fetchWithRetry(context.Background(), server.Client(), req, Options{MaxBodySize: tt.maxSize, RetryAttempts: 1}, false)
+			if accepted != acceptEncoding {
+				t.Errorf("Accept-Encoding = %q, want %q", accepted, acceptEncoding)
+			}
+			if tt.wantErr != nil {
+				if err == nil || (!errors.Is(err, tt.wantErr) && !strings.Contains(err.Error(), tt.wantErr.Error())) {
+					t.Errorf("fetchWithRetry() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || string(body) != page {
+				t.Fatalf("fetchWithRetry() = %q, %v, want the decoded page", body, err)
+			}
+			if resp.Header.Get("Content-Encoding") != "" {
+				t.Errorf("Content-Encoding = %q after decoding, want none", resp.Header.Get("Content-Encoding"))
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+const (
+	// DefaultFailureCooldown is the default time a URL whose fetch failed is skipped, doubled
+	// for each other consecutive failure.
+	DefaultFailureCooldown = time.Hour
+	// maxFailureCooldown bounds the time a URL that keeps failing is skipped.
+	maxFailureCooldown = 24 * time.Hour
+)
+
+// ErrFetchCooldown is returned for URLs skipped because their last fetches failed.
+var ErrFetchCooldown = errors.New("skipped after failed fetches")
+
+// failureCooldown returns how long a URL is skipped after failure: opts.FailureCooldown doubled
+// for each consecutive failure after the first, capped at maxFailureCooldown.
+func failureCooldown(failure *models.FetchError, opts Options) time.Duration {
+	cooldown := opts.FailureCooldown
+	if cooldown <= 0 {
+		cooldown = DefaultFailureCooldown
+	}
+	for i := 1; i < failure.Attempts && cooldown < maxFailureCooldown; i++ {
+		cooldown *= 2
+	}
+	return min(cooldown, maxFailureCooldown)
+}
+
+// checkFetchError returns the recorded failures of normalizedURL, if any, and fails with
+// ErrFetchCooldown if the URL is still skipped because of them, unless opts.ForceRefresh is set.
+// Errors reading the record are logged and the URL is fetched.
+func checkFetchError(ctx context.Context, datastoreClient lib.DatastoreClient, normalizedURL string, opts Options) (*models.FetchError, error) {
+	failure, found, err := datastoreClient.ReadFetchError(ctx, normalizedURL)
+	if err != nil {
+		slog.WarnContext(ctx, "Error reading fetch failures", "error", err)
+		return nil, nil
+	}
+	if !found {
+		return nil, nil
+	}
+	if retryAt := failure.FailedAt.Add(failureCooldown(failure, opts)); time.Now().Before(retryAt) && !opts.ForceRefresh {
+		return failure, fmt.Errorf("%w: %d failed fetches, last: %s, retrying after %s",
+			ErrFetchCooldown, failure.Attempts, failure.Error, retryAt.Format(time.RFC3339))
+	}
+	return failure, nil
+}
+
+// recordFetchError records that fetching normalizedURL failed with err, or got statusCode if
+// err is nil, after the earlier failures previous (nil if there are none). Fetches stopped by
+// the cancellation of ctx aren't recorded. Errors recording the failure are logged.
+func recordFetchError(ctx context.Context, datastoreClient lib.DatastoreClient, normalizedURL string, previous *models.FetchError, statusCode int, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	failure := &models.FetchError{URL: normalizedURL, StatusCode: statusCode, Attempts: 1, FailedAt: time.Now()}
+	if err != nil {
+		failure.Error = err.Error()
+	} else {
+		failure.Error = fmt.Sprintf("unexpected status code: %d", statusCode)
+	}
+	if previous != nil {
+		failure.Attempts = previous.Attempts + 1
+	}
+	if err := datastoreClient.WriteFetchError(ctx, failure); err != nil {
+		slog.WarnContext(ctx, "Error recording fetch failure", "error", err)
+	}
+}
+
+// clearFetchError deletes the failures of normalizedURL recorded before it was fetched, if any.
+func clearFetchError(ctx context.Context, datastoreClient lib.DatastoreClient, normalizedURL string, failure *models.FetchError) {
+	if failure == nil {
+		return
+	}
+	if err := datastoreClient.DeleteFetchError(ctx, normalizedURL); err != nil {
+		slog.WarnContext(ctx, "Error deleting fetch failures", "error", err)
+	}
+}
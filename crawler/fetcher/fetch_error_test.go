@@ -0,0 +1,82 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestFetchArticleContent_FailureCooldown(t *testing.T) {
+	status := http.StatusNotFound
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(status)
+		w.Write([]byte("<html><body><main><p>Back online.</p></main></body></html>"))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	mockDS := lib.NewMockDatastoreClient()
+	url := lib.NormalizeURL(server.URL + "/gone")
+	fetch := func(opts Options) (*models.CrawledPage, error) {
+		var cacheWriter bytes.Buffer
+		page, _, err := fetchArticleContent(ctx, url, false, mockDS, httpClient, &cacheWriter, "/test/cache/path", opts)
+		return page, err
+	}
+
+	// The failure is recorded, and the URL is then skipped without a request
+	if _, err := fetch(Options{}); err == nil {
+		t.Fatal("fetchArticleContent() error = nil, want the 404")
+	}
+	if failure := mockDS.FetchErrors[url]; failure == nil || failure.StatusCode != http.StatusNotFound || failure.Attempts != 1 {
+		t.Fatalf("recorded failure = %+v, want a 404 after 1 attempt", failure)
+	}
+	if _, err := fetch(Options{}); !errors.Is(err, ErrFetchCooldown) || requests != 1 {
+		t.Errorf("fetch in cooldown error = %v after %d requests, want ErrFetchCooldown without a request", err, requests)
+	}
+
+	// Once the cooldown is over, another failure is counted
+	mockDS.FetchErrors[url].FailedAt = time.Now().Add(-2 * time.Hour)
+	fetch(Options{})
+	if failure := mockDS.FetchErrors[url]; requests != 2 || failure.Attempts != 2 {
+		t.Errorf("recorded failure = %+v after %d requests, want 2 attempts", failure, requests)
+	}
+
+	// A forced refresh ignores the cooldown, and a successful fetch clears the failures
+	status = http.StatusOK
+	page, err := fetch(Options{ForceRefresh: true})
+	if err != nil || page.Content != "Back online." {
+		t.Fatalf("forced fetch = %+v, %v, want the page", page, err)
+	}
+	if failure, found := mockDS.FetchErrors[url]; found {
+		t.Errorf("recorded failure = %+v after a successful fetch, want none", failure)
+	}
+}
+
+func TestFailureCooldown(t *testing.T) {
+	tests := []struct {
+		attempts int
+		cooldown time.Duration
+		want     time.Duration
+	}{
+		{1, 0, DefaultFailureCooldown},
+		{3, 0, 4 * DefaultFailureCooldown},
+		{2, 10 * time.Minute, 20 * time.Minute},
+		{20, 0, maxFailureCooldown},
+	}
+	for _, tt := range tests {
+		got := failureCooldown(&models.FetchError{Attempts: tt.attempts}, Options{FailureCooldown: tt.cooldown})
+		if got != tt.want {
+			t.Errorf("failureCooldown(%d attempts, %v) = %v, want %v", tt.attempts, tt.cooldown, got, tt.want)
+		}
+	}
+}
@@ -1,43 +1,148 @@
 package fetcher
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
-	"path/filepath"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/zeace/poisson/crawler/language"
 	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
 	"github.com/zeace/poisson/models"
 )
 
 const (
 	cacheDir = "cache"
+	// userAgent is sent with article requests.
+	userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36"
+	// minDuplicateWords is the fewest words a page needs to be linked to a page with the same
+	// content. Shorter texts, such as error or consent pages, are shared by unrelated URLs.
+	minDuplicateWords = 50
 )
 
+// Options configures how pages are fetched and stored.
+type Options struct {
+	// RobotsPolicy controls whether pages marked noindex/noai are stored and analyzed.
+	RobotsPolicy RobotsPolicy
+	// Concurrency is the maximum number of pages FetchMany fetches at once.
+	// Zero means DefaultConcurrency.
+	Concurrency int
+	// PerHostConcurrency is the maximum number of in-flight FetchMany requests to a single host.
+	// Zero means DefaultPerHostConcurrency.
+	PerHostConcurrency int
+	// HostDelay is the minimum time between the starts of two FetchMany requests to the same
+	// host. Zero means no delay.
+	HostDelay time.Duration
+	// Queue, if set, fetches the URLs of FetchMany under its concurrency limits and host delay,
+	// shared with the other fetches through it, instead of a queue of their own, so that
+	// concurrent batches don't add up their requests to the same host. The Concurrency and
+	// PerHostConcurrency above are then ignored. The queue must be running (see Queue.Run).
+	Queue *Queue
+	// StructuredData controls whether JSON-LD Article metadata is preferred over HTML heuristics.
+	// The zero value behaves like StructuredDataPrefer.
+	StructuredData StructuredDataPolicy
+	// Credentials, if set, are sent with requests to their host (see ResolveCredentials).
+	Credentials *Credentials
+	// WARC, if set, receives the HTTP request and response of every page fetched from the network.
+	WARC *WARCWriter
+	// DomainBoilerplate strips the text blocks repeated on many pages of the same host, tracked in
+	// the DomainBoilerplate collection (see stripDomainBoilerplate).
+	DomainBoilerplate bool
+	// Renderer, if set, renders pages whose article text is shorter than RenderThreshold
+	// characters in a browser, for sites that build their articles with JavaScript.
+	Renderer Renderer
+	// RenderThreshold is the text length below which pages are rendered. Zero means
+	// DefaultRenderThreshold.
+	RenderThreshold int
+	// Screenshots, if set along with a Renderer that is a Screenshotter, receives a screenshot
+	// of every page stored after a fetch from the network.
+	Screenshots ScreenshotStore
+	// RetryAttempts is the number of attempts at fetching a page whose request times out or
+	// gets a 429, 502, 503 or 504 response. Zero means DefaultRetryAttempts, 1 disables retries.
+	RetryAttempts int
+	// RetryDelay is the wait before the second attempt, doubled before each other one.
+	// Zero means DefaultRetryDelay.
+	RetryDelay time.Duration
+	// MaxBodySize is the size in bytes above which a response is abandoned, so that huge pages
+	// are never held in memory and parsed. Zero means DefaultMaxBodySize.
+	MaxBodySize int64
+	// Proxy, if set, chooses the proxy of each request (see ParseProxy). Otherwise, requests use
+	// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	Proxy *Proxy
+	// Revalidate refetches the pages found in the Datastore cache with a conditional request
+	// carrying their ETag and Last-Modified validators. A 304 Not Modified response keeps the
+	// stored page, any other one replaces it.
+	Revalidate bool
+	// CacheMaxAge, if set, revalidates the pages of the Datastore cache once they are older than
+	// the max age of their host (see ParseCacheMaxAge), as Revalidate does for all of them.
+	CacheMaxAge *CacheMaxAge
+	// ForceRefresh fetches every page from its URL with an unconditional request, ignoring the
+	// Datastore cache, and replaces the stored page and the file cache.
+	ForceRefresh bool
+	// CacheOnly returns the pages served from the Datastore cache and fails the others with
+	// ErrNotCached, or ErrCacheExpired if they are stored, without requesting them, so that a
+	// batch can return its stored pages before fetching the others.
+	CacheOnly bool
+	// NotStored, if set, are the normalized URLs a batch already looked up in the Datastore and
+	// found not stored, such as the ErrNotCached pages of a CacheOnly pass, so that their fetches
+	// don't read them again.
+	NotStored map[string]bool
+	// FailureCooldown is how long a URL whose fetch failed is skipped, doubled for each other
+	// consecutive failure up to a day, so that dead links in a feed aren't fetched on every
+	// poll. The failures are recorded in the FetchError collection. ForceRefresh ignores them.
+	// Zero means DefaultFailureCooldown.
+	FailureCooldown time.Duration
+	// Source is recorded on the pages stored from the network. Pages found in the cache keep the
+	// source they were first stored from.
+	Source models.SourceRef
+	// FeedItems are the metadata of the feed items the URLs were linked from, by normalized URL
+	// (see lib.NormalizeURL), recorded on the pages stored or revalidated from the network.
+	FeedItems map[string]models.FeedItemMetadata
+	// PaywallFallback replaces the content of pages that look paywalled or truncated with that
+	// of their AMP version or of their copy in ArchiveMirrors, whichever is tried first and has
+	// more of the article (see detectPaywall).
+	PaywallFallback bool
+	// ArchiveMirrors are the URL prefixes of the web archives tried by PaywallFallback (see
+	// ParseArchiveMirrors). Empty means DefaultArchiveMirrors.
+	ArchiveMirrors []string
+	// Cache receives the text of every page FetchArticleContent returns (see OpenPageCache).
+	// Nil means a disk cache in the cache directory of DefaultFileCacheMaxSize.
+	Cache PageCache
+	// OnHTML, if set, receives the HTML of every page fetched from the network, converted to
+	// UTF-8, with the URL it was read from after redirects, before it is rendered or replaced by
+	// a paywall fallback. The site crawler reads the links of the articles it fetches from it.
+	OnHTML func(pageURL *url.URL, body []byte)
+	// AllowPrivateAddresses lets pages be fetched from private, loopback and link-local
+	// addresses, which are refused by default so that a feed can't point the fetcher to the
+	// internal network or to a cloud metadata server.
+	AllowPrivateAddresses bool
+}
+
+// ErrNotCached is returned by CacheOnly fetches of pages that would be requested from their
+// server.
+var ErrNotCached = errors.New("page not in the Datastore cache")
+
+// ErrCacheExpired is the ErrNotCached error of pages that are stored but would be revalidated.
+var ErrCacheExpired = fmt.Errorf("%w: stored page due for revalidation", ErrNotCached)
+
 // urlToCacheFilename converts a URL to a safe cache filename using SHA256 hash.
 func urlToCacheFilename(url string) string {
 	hash := sha256.Sum256([]byte(url))
 	return hex.EncodeToString(hash[:])
 }
 
-// getCachePath returns the full path to the cache file for a given URL.
-func getFileCachePath(url string) (string, error) {
-	// Ensure cache directory exists
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
-		return "", fmt.Errorf("error creating cache directory: %w", err)
-	}
-
-	filename := urlToCacheFilename(url)
-	return filepath.Join(cacheDir, filename), nil
-}
+// defaultPageCache is the page cache of the fetches whose Options have no Cache.
+var defaultPageCache = NewDiskCache(cacheDir, 0)
 
 // fetchArticleContent is an internal function that fetches and extracts text content from a given URL.
 // It checks Datastore first, and uses cached content if available.
@@ -47,6 +152,15 @@ func getFileCachePath(url string) (string, error) {
 // cacheWriter is used for writing content to the file cache.
 // datastoreClient can be nil, in which case Datastore operations will be skipped.
 // normalizedURL is the normalized URL (without protocol and query params) used for Datastore operations.
+// opts controls robots directive handling; excluded pages are returned with RobotsExcluded set but not stored.
+// With opts.Revalidate, or once they are older than opts.CacheMaxAge, cached pages are refetched
+// unless the server answers that they are unchanged. With opts.ForceRefresh, the cache is not read.
+// URLs whose last fetches failed are skipped with ErrFetchCooldown for opts.FailureCooldown.
+// With opts.PaywallFallback, paywalled pages are read from their AMP version or a web archive.
+// A page with the same content as a page stored under another URL is stored as its duplicate,
+// without the content, and returned with DuplicateOf set.
+// Pages are stored under the URL they redirect to, or the canonical URL they declare on the same
+// site (see pageKey), with normalizedURL stored as an alias of it if it differs.
 // Returns a CrawledPage, cache file path, and an error.
 func fetchArticleContent(
 	ctx context.Context,
@@ -56,35 +170,58 @@ func fetchArticleContent(
 	httpClient *http.Client,
 	cacheWriter io.Writer,
 	cachePath string,
+	opts Options,
 ) (*models.CrawledPage, string, error) {
-	var page *models.CrawledPage
+	var page, cached *models.CrawledPage
 
 	// Check Datastore first using normalized URL
-	var found bool
-	var err error
-	page, found, err = datastoreClient.ReadCrawledPage(ctx, normalizedURL)
-	if err != nil {
-		return nil, "", fmt.Errorf("error getting crawled page from Datastore: %w", err)
-	}
-	if found {
-		if verbose {
-			log.Printf("Using cached version from Datastore\n")
+	if !opts.ForceRefresh && !opts.NotStored[normalizedURL] {
+		var found bool
+		var err error
+		page, found, err = lib.ReadLinkedPage(ctx, datastoreClient, normalizedURL)
+		if err != nil {
+			return nil, "", fmt.Errorf("error getting crawled page from Datastore: %w", err)
 		}
-		// Ensure content is also in file cache
-		if _, err := cacheWriter.Write([]byte(page.Content)); err != nil {
-			// Log error but don't fail the request
+		if found {
+			// The page is returned with its cache source and updated if revalidated, so work on a
+			// copy that concurrent fetches of the same URL don't share
+			copied := *page
+			page = &copied
+		}
+		if found && !opts.Revalidate && !opts.CacheMaxAge.Expired(page, time.Now()) {
 			if verbose {
-				log.Printf("Warning: failed to save to file cache: %v\n", err)
+				slog.InfoContext(ctx, "Using cached version from Datastore")
+			}
+			page.CacheSource = models.CacheSourceDatastore
+			if excludeStoredPage(ctx, page, opts, verbose) {
+				return page, cachePath, nil
 			}
+			writeFileCache(ctx, cacheWriter, page.Content, verbose)
+			return page, cachePath, nil
+		}
+		cached = page
+	}
+	if opts.CacheOnly {
+		if cached != nil {
+			return nil, "", ErrCacheExpired
+		}
+		return nil, "", ErrNotCached
+	}
+
+	// URLs that failed recently are skipped, unless forced
+	failure, err := checkFetchError(ctx, datastoreClient, normalizedURL, opts)
+	if err != nil {
+		if verbose {
+			slog.InfoContext(ctx, "Skipping URL after failed fetches", "error", err)
 		}
-		return page, cachePath, nil
+		return nil, "", err
 	}
 
-	// Cache miss, fetch from URL
+	// Cache miss, expired page or forced refresh, fetch from URL
 	// Add protocol back for HTTP request
 	fetchURL := lib.AddProtocol(normalizedURL)
 	if verbose {
-		log.Printf("Fetching from URL...\n")
+		slog.InfoContext(ctx, "Fetching from URL", "revalidate", cached != nil, "force_refresh", opts.ForceRefresh)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "GET", fetchURL, nil)
@@ -92,62 +229,271 @@ func fetchArticleContent(
 		return nil, "", fmt.Errorf("error creating request: %w", err)
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	req.Header.Set("User-Agent", userAgent)
+	if cached != nil {
+		setConditionalHeaders(req, cached)
+	}
+	// Credentials are kept out of the archived request
+	archivedReq := req.Clone(ctx)
+	opts.Credentials.Apply(req)
 
-	resp, err := httpClient.Do(req)
+	start := time.Now()
+	resp, body, err := fetchWithRetry(ctx, httpClient, req, opts, verbose)
 	if err != nil {
-		return nil, "", fmt.Errorf("error fetching URL: %w", err)
+		recordFetchError(ctx, datastoreClient, normalizedURL, failure, 0, err)
+		return nil, "", err
+	}
+	diagnostics := fetchDiagnostics(resp, len(body), time.Since(start))
+	if opts.WARC != nil {
+		if err := opts.WARC.WriteExchange(archivedReq, resp, body); err != nil {
+			slog.WarnContext(ctx, "Failed to archive response", "error", err)
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode != http.StatusOK && (resp.StatusCode != http.StatusNotModified || cached == nil) {
+		recordFetchError(ctx, datastoreClient, normalizedURL, failure, resp.StatusCode, nil)
 		return nil, "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
+	clearFetchError(ctx, datastoreClient, normalizedURL, failure)
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		cached.Fetch = diagnostics
+		cached.FeedItem = feedItem(cached, normalizedURL, opts)
+		if err := markValidated(ctx, datastoreClient, cached, resp.Header); err != nil {
+			return nil, "", err
+		}
+		if verbose {
+			slog.InfoContext(ctx, "Cached version is not modified")
+		}
+		if excludeStoredPage(ctx, cached, opts, verbose) {
+			return cached, cachePath, nil
+		}
+		writeFileCache(ctx, cacheWriter, cached.Content, verbose)
+		return cached, cachePath, nil
+	}
+
+	// goquery reads UTF-8 only, pages in legacy charsets would be stored as mojibake
+	body, pageCharset := toUTF8(body, resp.Header.Get("Content-Type"))
+	if pageCharset != "utf-8" && verbose {
+		slog.InfoContext(ctx, "Converted page to UTF-8", "charset", pageCharset)
+	}
+	if opts.OnHTML != nil {
+		opts.OnHTML(resp.Request.URL, body)
+	}
+
+	// Pages whose article is built by scripts are rendered in a browser, if one is set
+	rendered := false
+	if opts.Renderer != nil {
+		if length := articleTextLength(body, opts); length < renderThreshold(opts) {
+			if verbose {
+				slog.InfoContext(ctx, "Rendering page in browser", "characters", length)
+			}
+			renderedBody, err := opts.Renderer.Render(ctx, fetchURL)
+			switch {
+			case err != nil:
+				slog.WarnContext(ctx, "Failed to render page, using the fetched HTML", "error", err)
+			case articleTextLength(renderedBody, opts) > length:
+				body = renderedBody
+				rendered = true
+			}
+		}
+	}
+
+	// Paywalled pages are read from their AMP version or an archived copy, if one has the article
+	paywalled := false
+	var fallback *paywallFallback
+	if opts.PaywallFallback {
+		if reason := detectPaywall(body, opts); reason != "" {
+			paywalled = true
+			if verbose {
+				slog.InfoContext(ctx, "Page looks paywalled, trying other sources", "reason", reason)
+			}
+			if fallback = fetchPaywallFallback(ctx, httpClient, body, resp.Request.URL.String(), opts, verbose); fallback != nil {
+				body = fallback.body
+			} else {
+				slog.WarnContext(ctx, "No other source has the article of the paywalled page", "reason", reason)
+			}
+		}
+	}
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
 	if err != nil {
 		return nil, "", fmt.Errorf("error parsing HTML: %w", err)
 	}
 
-	// Extract title
-	title := doc.Find("title").First().Text()
-	title = strings.TrimSpace(title)
+	// Read robots directives, the publication date, the lead image, meta tags and JSON-LD before scripts are removed
+	robots := parseRobotsDirectives(resp.Header, doc)
+	publishedAt := extractPublishedTime(doc)
+	image := extractLeadImage(doc)
+	finalURL := resp.Request.URL.String()
+	metadata := extractMetadata(doc, finalURL)
 
-	// Remove script and style elements
-	doc.Find("script, style").Remove()
+	// Shortened and tracking links are stored under the URL they redirect to or declare canonical
+	key := pageKey(finalURL, metadata.CanonicalURL)
+	if key != normalizedURL {
+		if verbose {
+			slog.InfoContext(ctx, "Storing the page under its final or canonical URL", "key", key, "final_url", finalURL)
+		}
+		if cached == nil && !opts.ForceRefresh {
+			if stored, found, err := datastoreClient.ReadCrawledPage(ctx, key); err == nil && found {
+				cached = stored // Keeps the source it was first stored from
+			}
+		}
+	}
 
-	// Try to find main content areas
-	var text string
-	mainContent := doc.Find("main").First()
-	if mainContent.Length() == 0 {
-		mainContent = doc.Find("article").First()
+	// Extract title, preferring og:title which rarely carries the site name, and strip the site name from it
+	host, _, _ := strings.Cut(lib.NormalizeURL(finalURL), "/")
+	rawTitle := metadata.Title
+	if rawTitle == "" {
+		rawTitle = doc.Find("title").First().Text()
 	}
-	if mainContent.Length() == 0 {
-		mainContent = doc.Find("div.content").First()
+	title := cleanTitle(rawTitle, extractSiteName(doc), host)
+	var article jsonLDArticle
+	if opts.StructuredData != StructuredDataIgnore {
+		article, _ = extractJSONLDArticle(doc)
 	}
 
-	if mainContent.Length() > 0 {
-		text = mainContent.Text()
-	} else {
-		// Fallback to body text
-		text = doc.Find("body").Text()
+	// Remove script and style elements
+	doc.Find("script, style").Remove()
+
+	// Remove consent banners, subscription overlays and navigation blocks
+	removeBoilerplate(doc)
+	if opts.DomainBoilerplate {
+		if removed := stripDomainBoilerplate(ctx, doc, key, host, datastoreClient); removed > 0 && verbose {
+			slog.InfoContext(ctx, "Removed blocks repeated across the site", "blocks", removed)
+		}
 	}
 
-	// Clean up whitespace
-	text = strings.Join(strings.Fields(text), " ")
+	text, method := extractMainText(doc)
 
+	// Prefer the JSON-LD Article fields over the heuristics
+	if article.Body != "" {
+		text = article.Body
+		method = models.ExtractionMethodJSONLD
+	}
+	if article.Headline != "" {
+		title = cleanTitle(article.Headline, extractSiteName(doc), host)
+	}
+	if !article.DatePublished.IsZero() {
+		publishedAt = article.DatePublished
+	}
+	author := article.Author
+	if author == "" {
+		author = metadata.Author
+	}
+	if article.Image != "" {
+		image = article.Image
+	}
+	image = resolveImageURL(finalURL, image)
+
+	text = sanitizeText(text)
 	if text == "" {
 		return nil, cachePath, fmt.Errorf("no content extracted from URL")
 	}
 
-	// Save to Datastore using normalized URL
+	// Site templates often declare a default language, so the declared one is only a fallback
+	lang := language.Detect(title + " " + text)
+	if lang == "" {
+		lang = language.Normalize(doc.Find("html").AttrOr("lang", ""))
+	}
+
+	words := lib.WordCount(text)
+
 	crawlTime := time.Now()
-	page, err = datastoreClient.WriteCrawledPage(ctx, normalizedURL, title, text, crawlTime)
-	if err != nil {
+	if robots.excluded(opts.RobotsPolicy) {
+		if verbose {
+			slog.InfoContext(ctx, "Skipping storage: page excluded by robots directives", "noindex", robots.NoIndex, "noai", robots.NoAI)
+		}
+		return &models.CrawledPage{
+			URL:            key,
+			Title:          title,
+			Content:        text,
+			DateTime:       crawlTime,
+			PublishedAt:    publishedAt,
+			Author:         author,
+			Description:    metadata.Description,
+			CanonicalURL:   metadata.CanonicalURL,
+			FinalURL:       finalURL,
+			RedirectChain:  redirectChain(resp),
+			Fetch:          diagnostics,
+			ImageURL:       image,
+			Language:       lang,
+			WordCount:      words,
+			ReadingMinutes: lib.ReadingMinutes(words),
+			NoIndex:        robots.NoIndex,
+			NoAI:           robots.NoAI,
+			RobotsExcluded: true,
+			CacheSource:    models.CacheSourceNetwork,
+			Rendered:       rendered,
+
+			ExtractionMethod: method,
+		}, cachePath, nil
+	}
+
+	screenshot := captureScreenshot(ctx, key, fetchURL, opts, verbose)
+
+	// Save to Datastore using normalized URL
+	page = &models.CrawledPage{
+		URL:         key,
+		Title:       title,
+		Content:     text,
+		DateTime:    crawlTime,
+		PublishedAt: publishedAt,
+		Author:      author,
+		ImageURL:    image,
+		Screenshot:  screenshot,
+		Language:    lang,
+		NoIndex:     robots.NoIndex,
+		NoAI:        robots.NoAI,
+		Rendered:    rendered,
+		WordCount:   words,
+
+		ReadingMinutes:   lib.ReadingMinutes(words),
+		Source:           source(cached, opts),
+		FeedItem:         feedItem(cached, normalizedURL, opts),
+		ContentHash:      lib.ContentHash(text),
+		ETag:             resp.Header.Get("ETag"),
+		LastModified:     resp.Header.Get("Last-Modified"),
+		Description:      metadata.Description,
+		CanonicalURL:     metadata.CanonicalURL,
+		FinalURL:         finalURL,
+		RedirectChain:    redirectChain(resp),
+		Fetch:            diagnostics,
+		ExtractionMethod: method,
+		Paywalled:        paywalled,
+		CacheSource:      models.CacheSourceNetwork,
+	}
+	if fallback != nil {
+		page.PaywallSource = fallback.source
+		page.ContentURL = fallback.url
+		if fallback.source == models.PaywallSourceArchive {
+			page.CacheSource = models.CacheSourceArchive
+		}
+	}
+	page.DuplicateOf = findOriginal(ctx, datastoreClient, page)
+	if err := saveCrawledPage(ctx, datastoreClient, page); err != nil {
 		return nil, "", fmt.Errorf("error saving crawled page to Datastore: %w", err)
 	}
-	if verbose {
-		log.Printf("Saved to Datastore\n")
+	detail := fetchedDetail(len(text), method, rendered)
+	if page.ContentURL != "" {
+		detail += ", paywalled, read from " + page.ContentURL
+	}
+	if page.DuplicateOf != "" {
+		detail += ", identical to " + page.DuplicateOf
+	}
+	if key != normalizedURL {
+		saveAlias(ctx, datastoreClient, normalizedURL, key, crawlTime)
+		detail += ", requested as " + normalizedURL
+	}
+	lib.RecordAuditEvent(ctx, datastoreClient, &models.AuditEvent{
+		URL:    key,
+		Action: models.AuditActionFetched,
+		Detail: detail,
+	})
+	if verbose && page.DuplicateOf != "" {
+		slog.InfoContext(ctx, "Saved to Datastore as a duplicate", "duplicate_of", page.DuplicateOf)
+	} else if verbose {
+		slog.InfoContext(ctx, "Saved to Datastore")
 	}
 
 	// Save to cache
@@ -160,38 +506,168 @@ func fetchArticleContent(
 	return page, cachePath, nil
 }
 
+// feedItem returns the feed item metadata of a page stored from the network: that of opts for
+// normalizedURL, or the one recorded on the cached page if opts has none.
+func feedItem(cached *models.CrawledPage, normalizedURL string, opts Options) models.FeedItemMetadata {
+	if item, ok := opts.FeedItems[normalizedURL]; ok {
+		return item
+	}
+	if cached != nil {
+		return cached.FeedItem
+	}
+	return models.FeedItemMetadata{}
+}
+
+// source returns the source of a page stored from the network: the one it was first stored
+// from if it was cached, or that of opts.
+func source(cached *models.CrawledPage, opts Options) models.SourceRef {
+	if cached != nil && !cached.Source.IsZero() {
+		return cached.Source
+	}
+	return opts.Source
+}
+
+// findOriginal returns the URL of the page stored earlier with the same content as page, or ""
+// if there is none or page has fewer than minDuplicateWords words. Failures are logged and the
+// page is then stored as an original.
+func findOriginal(ctx context.Context, datastoreClient lib.DatastoreClient, page *models.CrawledPage) string {
+	if page.WordCount < minDuplicateWords {
+		return ""
+	}
+	matches, err := datastoreClient.FindCrawledPagesByContentHash(ctx, page.ContentHash)
+	if err != nil {
+		slog.WarnContext(ctx, "Error looking for pages with the same content", "error", err)
+		return ""
+	}
+	// Other duplicates may link to a page whose content changed since, so only originals count
+	for _, match := range matches {
+		if match.DuplicateOf == "" && match.URL != page.URL {
+			return match.URL
+		}
+	}
+	return ""
+}
+
+// saveCrawledPage stores page, without its content if it is a duplicate.
+func saveCrawledPage(ctx context.Context, datastoreClient lib.DatastoreClient, page *models.CrawledPage) error {
+	if page.DuplicateOf == "" {
+		return datastoreClient.SaveCrawledPage(ctx, page)
+	}
+	stored := *page
+	stored.Content = ""
+	if err := datastoreClient.SaveCrawledPage(ctx, &stored); err != nil {
+		return err
+	}
+	page.DateTime = stored.DateTime
+	return nil
+}
+
+// setConditionalHeaders makes req conditional on the validators of the cached page, so that the
+// server answers 304 Not Modified if it is unchanged.
+func setConditionalHeaders(req *http.Request, cached *models.CrawledPage) {
+	if cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+}
+
+// markValidated records that the server confirmed the cached page is current, with the
+// validators of its 304 response if it sent new ones.
+func markValidated(ctx context.Context, datastoreClient lib.DatastoreClient, cached *models.CrawledPage, header http.Header) error {
+	if etag := header.Get("ETag"); etag != "" {
+		cached.ETag = etag
+	}
+	if lastModified := header.Get("Last-Modified"); lastModified != "" {
+		cached.LastModified = lastModified
+	}
+	cached.ValidatedAt = time.Now()
+	cached.CacheSource = models.CacheSourceRevalidated
+	if err := saveCrawledPage(ctx, datastoreClient, cached); err != nil {
+		return fmt.Errorf("error saving crawled page to Datastore: %w", err)
+	}
+	return nil
+}
+
+// writeFileCache writes the content of a page read from the Datastore to the file cache.
+// Failures are logged but don't fail the request.
+func writeFileCache(ctx context.Context, cacheWriter io.Writer, content string, verbose bool) {
+	if _, err := cacheWriter.Write([]byte(content)); err != nil && verbose {
+		slog.WarnContext(ctx, "Failed to save to file cache", "error", err)
+	}
+}
+
+// mainText returns the whitespace-normalized text of the main content element of doc: its
+// first main, article or div.content element, or its body.
+func mainText(doc *goquery.Document) string {
+	mainContent := doc.Find("main").First()
+	if mainContent.Length() == 0 {
+		mainContent = doc.Find("article").First()
+	}
+	if mainContent.Length() == 0 {
+		mainContent = doc.Find("div.content").First()
+	}
+
+	var text string
+	if mainContent.Length() > 0 {
+		text = mainContent.Text()
+	} else {
+		// Fallback to body text
+		text = doc.Find("body").Text()
+	}
+
+	// Clean up whitespace
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// fetchedDetail describes the extraction of a fetched page in its audit event.
+func fetchedDetail(length int, method models.ExtractionMethod, rendered bool) string {
+	detail := fmt.Sprintf("%d characters extracted with the %s method", length, method)
+	if rendered {
+		detail += " after rendering in a browser"
+	}
+	return detail
+}
+
 // FetchArticleContent fetches and extracts text content from a given URL.
 // It checks Datastore first, and uses cached content if available.
 // If verbose is true, it prints whether it's using cached content or fetching from the URL.
-// It will save new pages to Datastore, and into a local file cache.
-// Returns a CrawledPage, cache file path, and an error.
+// It will save new pages to Datastore, and their text into opts.Cache.
+// opts controls robots directive handling; excluded pages are returned with RobotsExcluded set but not stored.
+// Returns a CrawledPage, the location of its text in opts.Cache, and an error.
 func FetchArticleContent(
 	ctx context.Context,
 	url string,
 	verbose bool,
 	datastoreClient lib.DatastoreClient,
+	opts Options,
 ) (*models.CrawledPage, string, error) {
 	// Normalize URL for Datastore operations (remove protocol and query params)
 	normalizedURL := lib.NormalizeURL(url)
+	ctx = logging.WithAttrs(ctx, "url", normalizedURL)
 
-	// Get cache path (used in all return cases) - use normalized URL for cache
-	cachePath, err := getFileCachePath(normalizedURL)
-	if err != nil {
-		return nil, "", fmt.Errorf("error getting cache path: %w", err)
+	cache := opts.Cache
+	if cache == nil {
+		cache = defaultPageCache
 	}
+	// Get cache location (used in all return cases) - use normalized URL for cache
+	cachePath := cache.Location(normalizedURL)
 
-	// Create HTTP client
-	httpClient := &http.Client{
-		Timeout: 10 * time.Second,
+	// Cache-only fetches make no request
+	var httpClient *http.Client
+	if !opts.CacheOnly {
+		httpClient = NewHTTPClient(opts, 10*time.Second)
 	}
 
-	// Open cache file for writing
-	cacheFile, err := os.OpenFile(cachePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		return nil, "", fmt.Errorf("error opening cache file: %w", err)
-	}
-	defer cacheFile.Close()
-
 	// Use normalized URL for all operations
-	return fetchArticleContent(ctx, normalizedURL, verbose, datastoreClient, httpClient, cacheFile, cachePath)
+	var content bytes.Buffer
+	page, path, err := fetchArticleContent(ctx, normalizedURL, verbose, datastoreClient, httpClient, &content, cachePath, opts)
+	// Pages excluded by their robots directives have no text to keep
+	if err == nil && content.Len() > 0 {
+		if err := cache.Put(ctx, normalizedURL, content.Bytes()); err != nil && verbose {
+			slog.WarnContext(ctx, "Failed to save to page cache", "error", err)
+		}
+	}
+	return page, path, err
 }
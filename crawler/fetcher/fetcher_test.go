@@ -6,6 +6,7 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -19,6 +20,8 @@ func TestFetchArticleContent_FromURL(t *testing.T) {
 <html>
 <head>
 	<title>Test Article</title>
+	<meta property="og:image" content="/images/lead.jpg">
+	<meta property="og:description" content="A test article.">
 </head>
 <body>
 	<main>
@@ -41,6 +44,7 @@ func TestFetchArticleContent_FromURL(t *testing.T) {
 			t.Errorf("Expected User-Agent header, got %s", userAgent)
 		}
 		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Server", "test-server")
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(htmlContent))
 	}))
@@ -53,7 +57,7 @@ func TestFetchArticleContent_FromURL(t *testing.T) {
 	mockDS := lib.NewMockDatastoreClient()
 
 	normalizedURL := lib.NormalizeURL(server.URL)
-	page, path, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, cachePath)
+	page, path, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, cachePath, Options{})
 
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
@@ -67,9 +71,40 @@ func TestFetchArticleContent_FromURL(t *testing.T) {
 		t.Errorf("Expected title 'Test Article', got '%s'", page.Title)
 	}
 
+	if page.CacheSource != models.CacheSourceNetwork {
+		t.Errorf("Expected cache source %q, got %q", models.CacheSourceNetwork, page.CacheSource)
+	}
+
+	if page.ImageURL != server.URL+"/images/lead.jpg" {
+		t.Errorf("Expected lead image %q, got %q", server.URL+"/images/lead.jpg", page.ImageURL)
+	}
+
+	if page.Description != "A test article." {
+		t.Errorf("Expected description 'A test article.', got '%s'", page.Description)
+	}
+
 	if !strings.Contains(page.Content, "Test Article Content") {
 		t.Errorf("Expected content to contain 'Test Article Content', got: %s", page.Content)
 	}
+	if words := lib.WordCount(page.Content); page.WordCount != words || page.ReadingMinutes != 1 {
+		t.Errorf("Expected %d words and 1 minute of reading, got %d words and %d minutes", words, page.WordCount, page.ReadingMinutes)
+	}
+	wantFetch := models.FetchDiagnostics{
+		Host:        "127.0.0.1",
+		StatusCode:  http.StatusOK,
+		ContentType: "text/html",
+		BodyBytes:   len(htmlContent),
+		Headers:     []string{"Server: test-server"},
+	}
+	// Latency varies, only its sign is checked
+	fetch := page.Fetch
+	if fetch.LatencyMillis < 0 {
+		t.Errorf("Expected a non-negative fetch latency, got %d", fetch.LatencyMillis)
+	}
+	fetch.LatencyMillis = 0
+	if !reflect.DeepEqual(fetch, wantFetch) {
+		t.Errorf("Expected fetch diagnostics %+v, got %+v", wantFetch, fetch)
+	}
 	// Verify script and style were removed
 	if strings.Contains(page.Content, "console.log") || strings.Contains(page.Content, "color: red") {
 		t.Error("Expected script and style tags to be removed from content")
@@ -113,7 +148,7 @@ func TestFetchArticleContent_FromDatastoreCache(t *testing.T) {
 	var cacheWriter bytes.Buffer
 	cachePath := "/test/cache/path"
 
-	page, path, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, cachePath)
+	page, path, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, cachePath, Options{})
 
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
@@ -127,6 +162,10 @@ func TestFetchArticleContent_FromDatastoreCache(t *testing.T) {
 		t.Errorf("Expected title 'Cached Article', got '%s'", page.Title)
 	}
 
+	if page.CacheSource != models.CacheSourceDatastore {
+		t.Errorf("Expected cache source %q, got %q", models.CacheSourceDatastore, page.CacheSource)
+	}
+
 	if page.Content != "This is cached content from Datastore" {
 		t.Errorf("Expected content 'This is cached content from Datastore', got '%s'", page.Content)
 	}
@@ -142,6 +181,193 @@ func TestFetchArticleContent_FromDatastoreCache(t *testing.T) {
 	}
 }
 
+func TestFetchArticleContent_Revalidate(t *testing.T) {
+	etag, text := `"v1"`, "First version of the article."
+	var conditional []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditional = append(conditional, r.Header.Get("If-None-Match")+" "+r.Header.Get("If-Modified-Since"))
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", "Tue, 01 Apr 2025 08:00:00 GMT")
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("<html><body><main><p>" + text + "</p></main></body></html>"))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	mockDS := lib.NewMockDatastoreClient()
+	normalizedURL := lib.NormalizeURL(server.URL)
+	fetch := func(opts Options) *models.CrawledPage {
+		t.Helper()
+		var cacheWriter bytes.Buffer
+		page, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, "/test/cache/path", opts)
+		if err != nil {
+			t.Fatalf("fetchArticleContent() error = %v", err)
+		}
+		if cacheWriter.String() != page.Content {
+			t.Errorf("file cache = %q, want the page content", cacheWriter.String())
+		}
+		return page
+	}
+
+	feed := models.SourceRef{Kind: models.SourceKindRSS, ID: "https://example.com/feed.xml"}
+	first := fetch(Options{Source: feed})
+	if first.ETag != `"v1"` || first.LastModified != "Tue, 01 Apr 2025 08:00:00 GMT" || first.Source != feed {
+		t.Errorf("stored validators = %q, %q and source %+v", first.ETag, first.LastModified, first.Source)
+	}
+	// Without Revalidate, the cached page is used without a request
+	if page := fetch(Options{}); page.CacheSource != models.CacheSourceDatastore || len(conditional) != 1 {
+		t.Errorf("CacheSource = %q after %d request(s), want the Datastore cache", page.CacheSource, len(conditional))
+	}
+
+	// CacheOnly fetches fail without a request when the page would be requested
+	var cacheWriter bytes.Buffer
+	if _, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, "", Options{CacheOnly: true, Revalidate: true}); !errors.Is(err, ErrCacheExpired) || len(conditional) != 1 {
+		t.Errorf("CacheOnly revalidation error = %v after %d request(s), want ErrCacheExpired without a request", err, len(conditional))
+	}
+	if _, _, err := fetchArticleContent(ctx, normalizedURL+"/other", false, mockDS, httpClient, &cacheWriter, "", Options{CacheOnly: true}); !errors.Is(err, ErrNotCached) || errors.Is(err, ErrCacheExpired) {
+		t.Errorf("CacheOnly error for an unknown page = %v, want ErrNotCached", err)
+	}
+
+	// Unchanged page: the server answers 304 and the stored page is kept
+	page := fetch(Options{Revalidate: true})
+	if conditional[1] != `"v1" Tue, 01 Apr 2025 08:00:00 GMT` {
+		t.Errorf("conditional headers = %q, want the stored validators", conditional[1])
+	}
+	if page.CacheSource != models.CacheSourceRevalidated || page.Content != first.Content || !page.DateTime.Equal(first.DateTime) {
+		t.Errorf("revalidated page = %+v, want the stored page", page)
+	}
+	if stored := mockDS.Pages[normalizedURL]; stored.ValidatedAt.IsZero() || stored.Fetch.StatusCode != http.StatusNotModified {
+		t.Errorf("ValidatedAt = %v and fetch status %d after a 304 response", stored.ValidatedAt, stored.Fetch.StatusCode)
+	}
+
+	// Changed page: the new version replaces the stored one, which keeps its first source
+	etag, text = `"v2"`, "Second version of the article."
+	page = fetch(Options{Revalidate: true, Source: models.SourceRef{Kind: models.SourceKindSubmission}})
+	if page.CacheSource != models.CacheSourceNetwork || page.Content != text || page.ETag != `"v2"` || page.Source != feed {
+		t.Errorf("refetched page = %+v, want the new version", page)
+	}
+	if stored := mockDS.Pages[normalizedURL]; stored.Content != text {
+		t.Errorf("stored content = %q, want the new version", stored.Content)
+	}
+}
+
+func TestFetchArticleContent_CacheMaxAgeAndForceRefresh(t *testing.T) {
+	var conditional []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditional = append(conditional, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("<html><body><main><p>Fresh content.</p></main></body></html>"))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	mockDS := lib.NewMockDatastoreClient()
+	normalizedURL := lib.NormalizeURL(server.URL)
+	mockDS.Pages[normalizedURL] = &models.CrawledPage{
+		URL: normalizedURL, Content: "Stored content.", ETag: `"v1"`, DateTime: time.Now().Add(-2 * time.Hour),
+	}
+	fetch := func(opts Options) *models.CrawledPage {
+		t.Helper()
+		var cacheWriter bytes.Buffer
+		page, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, "/test/cache/path", opts)
+		if err != nil {
+			t.Fatalf("fetchArticleContent() error = %v", err)
+		}
+		return page
+	}
+
+	// A page younger than the max age is served from the cache
+	day, _ := ParseCacheMaxAge("1d")
+	if page := fetch(Options{CacheMaxAge: day}); page.CacheSource != models.CacheSourceDatastore || len(conditional) != 0 {
+		t.Errorf("CacheSource = %q after %d request(s), want the Datastore cache", page.CacheSource, len(conditional))
+	}
+
+	// An older one is revalidated
+	hour, _ := ParseCacheMaxAge("1h")
+	if page := fetch(Options{CacheMaxAge: hour}); page.CacheSource != models.CacheSourceRevalidated || len(conditional) != 1 {
+		t.Errorf("CacheSource = %q after %d request(s), want a revalidation", page.CacheSource, len(conditional))
+	}
+	// Validating it makes it fresh again
+	if page := fetch(Options{CacheMaxAge: hour}); page.CacheSource != models.CacheSourceDatastore {
+		t.Errorf("CacheSource = %q after a revalidation, want the Datastore cache", page.CacheSource)
+	}
+
+	// A forced refresh sends an unconditional request and replaces the stored page
+	page := fetch(Options{ForceRefresh: true})
+	if page.CacheSource != models.CacheSourceNetwork || page.Content != "Fresh content." || conditional[len(conditional)-1] != "" {
+		t.Errorf("refreshed page = %+v after conditional headers %q, want an unconditional fetch", page, conditional)
+	}
+	if stored := mockDS.Pages[normalizedURL]; stored.Content != "Fresh content." {
+		t.Errorf("stored content = %q, want the refreshed one", stored.Content)
+	}
+}
+
+func TestFetchArticleContent_DuplicateContent(t *testing.T) {
+	syndicated := strings.TrimSpace(strings.Repeat("Syndicated article about the council vote. ", 10))
+	texts := map[string]string{"/a": syndicated, "/b": syndicated, "/c": "Access denied.", "/d": "Access denied."}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body><main><p>" + texts[r.URL.Path] + "</p></main></body></html>"))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	mockDS := lib.NewMockDatastoreClient()
+	original, copy := lib.NormalizeURL(server.URL+"/a"), lib.NormalizeURL(server.URL+"/b")
+	fetch := func(url string, opts Options) *models.CrawledPage {
+		t.Helper()
+		var cacheWriter bytes.Buffer
+		page, _, err := fetchArticleContent(ctx, url, false, mockDS, httpClient, &cacheWriter, "/test/cache/path", opts)
+		if err != nil {
+			t.Fatalf("fetchArticleContent(%s) error = %v", url, err)
+		}
+		return page
+	}
+
+	if page := fetch(original, Options{}); page.DuplicateOf != "" || page.ContentHash != lib.ContentHash(syndicated) {
+		t.Errorf("first page = %+v, want an original with its content hash", page)
+	}
+	// The same content under another URL is linked to the first page, without storing it again
+	page := fetch(copy, Options{})
+	if page.DuplicateOf != original || page.Content != syndicated {
+		t.Errorf("duplicate = %+v, want a link to %s with the content", page, original)
+	}
+	if stored := mockDS.Pages[copy]; stored.DuplicateOf != original || stored.Content != "" {
+		t.Errorf("stored duplicate = %+v, want a link without content", stored)
+	}
+	// Refetching the first page keeps it the original
+	if page := fetch(original, Options{ForceRefresh: true}); page.DuplicateOf != "" {
+		t.Errorf("refetched original = %+v, want no link", page)
+	}
+
+	// Cached duplicates are read with the content of the page they link to
+	if page := fetch(copy, Options{}); page.CacheSource != models.CacheSourceDatastore || page.Content != syndicated {
+		t.Errorf("cached duplicate = %+v, want the linked content from the Datastore cache", page)
+	}
+	// Once that page changes, the duplicate is fetched again and stored as an original
+	texts["/a"] = "Updated article."
+	fetch(original, Options{ForceRefresh: true})
+	page = fetch(copy, Options{})
+	if page.CacheSource != models.CacheSourceNetwork || page.DuplicateOf != "" || mockDS.Pages[copy].Content != syndicated {
+		t.Errorf("duplicate of a changed page = %+v, want it refetched and stored with its content", page)
+	}
+
+	// Short texts shared by unrelated pages aren't linked
+	fetch(lib.NormalizeURL(server.URL+"/c"), Options{})
+	if page := fetch(lib.NormalizeURL(server.URL+"/d"), Options{}); page.DuplicateOf != "" {
+		t.Errorf("short page = %+v, want no link to a page with the same text", page)
+	}
+}
+
 func TestFetchArticleContent_HTTPError(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -155,7 +381,7 @@ func TestFetchArticleContent_HTTPError(t *testing.T) {
 	mockDS := lib.NewMockDatastoreClient()
 
 	normalizedURL := lib.NormalizeURL(server.URL)
-	_, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, cachePath)
+	_, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, cachePath, Options{})
 
 	if err == nil {
 		t.Fatal("Expected error for 500 status code, but got nil")
@@ -192,7 +418,7 @@ func TestFetchArticleContent_FallbackToBody(t *testing.T) {
 	mockDS := lib.NewMockDatastoreClient()
 
 	normalizedURL := lib.NormalizeURL(server.URL)
-	page, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, cachePath)
+	page, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, cachePath, Options{})
 
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
@@ -235,7 +461,7 @@ func TestFetchArticleContent_ArticleTag(t *testing.T) {
 	mockDS := lib.NewMockDatastoreClient()
 
 	normalizedURL := lib.NormalizeURL(server.URL)
-	page, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, cachePath)
+	page, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, cachePath, Options{})
 
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
@@ -260,7 +486,7 @@ func TestFetchArticleContent_DatastoreGetError(t *testing.T) {
 	cachePath := "/test/cache/path"
 
 	normalizedURL := lib.NormalizeURL("https://example.com/article")
-	_, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, cachePath)
+	_, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, cachePath, Options{})
 
 	if err == nil {
 		t.Fatal("Expected error from Datastore, but got nil")
@@ -300,7 +526,7 @@ func TestFetchArticleContent_DatastoreCreateError(t *testing.T) {
 	cachePath := "/test/cache/path"
 
 	normalizedURL := lib.NormalizeURL(server.URL)
-	_, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, cachePath)
+	_, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, cachePath, Options{})
 
 	if err == nil {
 		t.Fatal("Expected error from Datastore create, but got nil")
@@ -310,3 +536,135 @@ func TestFetchArticleContent_DatastoreCreateError(t *testing.T) {
 		t.Errorf("Expected error message to contain 'error saving crawled page to Datastore', got: %v", err)
 	}
 }
+
+func TestFetchArticleContent_JSONLD(t *testing.T) {
+	htmlContent := `<!DOCTYPE html>
+<html>
+<head>
+	<title>Page Title | Example</title>
+	<script type="application/ld+json">{"@type": "NewsArticle", "headline": "Structured Headline",
+		"articleBody": "Structured body.", "datePublished": "2024-04-01", "author": {"name": "Jane Doe"}}</script>
+</head>
+<body>
+	<article><p>Heuristic body.</p></article>
+</body>
+</html>`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(htmlContent))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		policy  StructuredDataPolicy
+		title   string
+		content string
+		author  string
+		method  models.ExtractionMethod
+	}{
+		{"prefer", StructuredDataPrefer, "Structured Headline", "Structured body.", "Jane Doe", models.ExtractionMethodJSONLD},
+		{"ignore", StructuredDataIgnore, "Page Title", "Heuristic body.", "", models.ExtractionMethodHeuristic},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			httpClient := &http.Client{Timeout: 5 * time.Second}
+			var cacheWriter bytes.Buffer
+			mockDS := lib.NewMockDatastoreClient()
+
+			normalizedURL := lib.NormalizeURL(server.URL)
+			page, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, "/test/cache/path",
+				Options{StructuredData: tt.policy})
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if page.Title != tt.title || page.Content != tt.content || page.Author != tt.author || page.ExtractionMethod != tt.method {
+				t.Errorf("Got title %q, content %q, author %q, method %q; want %q, %q, %q, %q",
+					page.Title, page.Content, page.Author, page.ExtractionMethod, tt.title, tt.content, tt.author, tt.method)
+			}
+			if tt.policy == StructuredDataPrefer && !page.PublishedAt.Equal(time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("Expected publication date from JSON-LD, got %v", page.PublishedAt)
+			}
+		})
+	}
+}
+
+func TestFetchArticleContent_RedirectAndCanonicalURL(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/short":
+			http.Redirect(w, r, "/article?utm_source=rss", http.StatusMovedPermanently)
+		case "/article":
+			w.Write([]byte(`<html><head><link rel="canonical" href="` + server.URL + `/article"></head>` +
+				`<body><main><p>Redirected article.</p></main></body></html>`))
+		case "/home-canonical":
+			w.Write([]byte(`<html><head><link rel="canonical" href="` + server.URL + `/"></head>` +
+				`<body><main><p>Another article.</p></main></body></html>`))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	mockDS := lib.NewMockDatastoreClient()
+	short, canonical := lib.NormalizeURL(server.URL+"/short"), lib.NormalizeURL(server.URL+"/article")
+
+	var cacheWriter bytes.Buffer
+	page, _, err := fetchArticleContent(ctx, short, false, mockDS, httpClient, &cacheWriter, "/test/cache/path", Options{})
+	if err != nil {
+		t.Fatalf("fetchArticleContent() error = %v", err)
+	}
+	if page.URL != canonical || page.FinalURL != server.URL+"/article?utm_source=rss" {
+		t.Errorf("page URL = %q, final URL = %q, want the canonical and final URLs", page.URL, page.FinalURL)
+	}
+	if want := []string{server.URL + "/short"}; !reflect.DeepEqual(page.RedirectChain, want) {
+		t.Errorf("RedirectChain = %v, want %v", page.RedirectChain, want)
+	}
+	// The page is stored once under its canonical URL, with the requested URL linking to it
+	if stored := mockDS.Pages[canonical]; stored == nil || stored.Content != "Redirected article." {
+		t.Errorf("stored page = %+v, want the content under %s", stored, canonical)
+	}
+	if alias := mockDS.Pages[short]; alias == nil || alias.AliasOf != canonical || alias.Content != "" {
+		t.Errorf("stored alias = %+v, want a link to %s", alias, canonical)
+	}
+
+	// The tracking variant is read from the cache through the alias
+	page, _, err = fetchArticleContent(ctx, short, false, mockDS, httpClient, &cacheWriter, "/test/cache/path", Options{})
+	if err != nil || page.CacheSource != models.CacheSourceDatastore || page.URL != canonical {
+		t.Errorf("refetched page = %+v, %v, want the canonical page from the Datastore cache", page, err)
+	}
+
+	// A canonical URL pointing to the home page is ignored
+	other := lib.NormalizeURL(server.URL + "/home-canonical")
+	page, _, err = fetchArticleContent(ctx, other, false, mockDS, httpClient, &cacheWriter, "/test/cache/path", Options{})
+	if err != nil || page.URL != other || page.RedirectChain != nil {
+		t.Errorf("page with a home page canonical = %+v, %v, want it stored under its own URL", page, err)
+	}
+}
+
+func TestPageKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		finalURL  string
+		canonical string
+		want      string
+	}{
+		{"no canonical", "https://example.com/a?utm_source=rss", "", "example.com/a"},
+		{"same site", "https://example.com/a?utm_source=rss", "https://www.example.com/news/a", "www.example.com/news/a"},
+		{"other site", "https://example.com/a", "https://syndicated.org/a", "example.com/a"},
+		{"home page", "https://example.com/a", "https://example.com/", "example.com/a"},
+		{"home page of home page", "https://example.com/?ref=rss", "https://example.com/", "example.com/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pageKey(tt.finalURL, tt.canonical); got != tt.want {
+				t.Errorf("pageKey(%q, %q) = %q, want %q", tt.finalURL, tt.canonical, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFileCacheMaxSize is the size in bytes of a disk page cache opened with a zero max size.
+	DefaultFileCacheMaxSize = 512 << 20
+	// fileCacheUnlimited is the max size of a file cache that is never trimmed.
+	fileCacheUnlimited = "unlimited"
+	// fileCacheIndexName is the name of the index file in the cache directory.
+	fileCacheIndexName = "index.json"
+	// fileCacheTrimRatio is the share of its max size a full cache is trimmed to, so that it isn't
+	// trimmed again on every write.
+	fileCacheTrimRatio = 0.9
+	// fileCacheIndexInterval is how often the index is written while files are added. It is
+	// always written after the cache is trimmed or purged.
+	fileCacheIndexInterval = 30 * time.Second
+)
+
+// ParseFileCacheMaxSize parses the max size of a disk or memory page cache: a number of bytes
+// with an optional KB, MB or GB suffix (e.g. 512MB), or "unlimited", as a negative size. It
+// returns zero, for the default size of the cache, if spec is empty.
+func ParseFileCacheMaxSize(spec string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(spec))
+	switch upper {
+	case "":
+		return 0, nil
+	case strings.ToUpper(fileCacheUnlimited):
+		return -1, nil
+	}
+	number, unit := upper, int64(1)
+	for _, suffix := range []struct {
+		name string
+		unit int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(upper, suffix.name) {
+			number, unit = strings.TrimSpace(strings.TrimSuffix(upper, suffix.name)), suffix.unit
+			break
+		}
+	}
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid file cache size %q: expected a positive number of bytes with an optional KB, MB or GB suffix, or %s", spec, fileCacheUnlimited)
+	}
+	return size * unit, nil
+}
+
+// fileCacheEntry is a file of the cache in its index.
+type fileCacheEntry struct {
+	// URL is the normalized URL of the page whose text the file holds.
+	URL  string `json:"url"`
+	Size int64  `json:"size"`
+	// UsedAt is when the file was last written, which happens whenever the page is fetched or
+	// read from the Datastore cache.
+	UsedAt time.Time `json:"used_at"`
+}
+
+// diskCache is a PageCache keeping each text in a file of a directory, named after the hash of
+// its URL. It keeps an index of the files to remove the least recently used ones once they add
+// up to more than maxSize bytes. The index is read from the directory on first use and rebuilt
+// from the files if it is missing or out of date, as after a crash or when several processes
+// share the directory.
+type diskCache struct {
+	dir     string
+	maxSize int64
+
+	mu      sync.Mutex
+	loaded  bool
+	entries map[string]*fileCacheEntry // By file name
+	size    int64
+	// dirty is true if entries changed since the index was written at writtenAt.
+	dirty     bool
+	writtenAt time.Time
+}
+
+// NewDiskCache returns a PageCache keeping texts in files of dir, which is created on the first
+// write. Its least recently used files are removed once it is larger than maxSize bytes: zero
+// means DefaultFileCacheMaxSize, a negative size no limit.
+func NewDiskCache(dir string, maxSize int64) PageCache {
+	if maxSize == 0 {
+		maxSize = DefaultFileCacheMaxSize
+	}
+	return &diskCache{dir: dir, maxSize: maxSize}
+}
+
+// Location returns the path of the file of url.
+func (c *diskCache) Location(url string) string {
+	return filepath.Join(c.dir, urlToCacheFilename(url))
+}
+
+// Put writes content to the file of url, adds it to the index, and trims the cache if it is
+// larger than its max size.
+func (c *diskCache) Put(ctx context.Context, url string, content []byte) error {
+	path := c.Location(url)
+	if err := writeFileAtomically(path, content); err != nil {
+		return fmt.Errorf("error writing file cache: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error writing file cache: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.load(); err != nil {
+		return fmt.Errorf("error reading file cache index: %w", err)
+	}
+	name := filepath.Base(path)
+	if entry, ok := c.entries[name]; ok {
+		c.size -= entry.Size
+	}
+	c.entries[name] = &fileCacheEntry{URL: url, Size: info.Size(), UsedAt: info.ModTime()}
+	c.size += info.Size()
+	c.dirty = true
+
+	trim := c.maxSize > 0 && c.size > c.maxSize
+	if trim {
+		c.remove(CachePurge{MaxSize: int64(fileCacheTrimRatio * float64(c.maxSize))})
+	}
+	if trim || (c.dirty && time.Since(c.writtenAt) >= fileCacheIndexInterval) {
+		c.writeIndex()
+	}
+	return nil
+}
+
+// Get reads the file of url.
+func (c *diskCache) Get(ctx context.Context, url string) ([]byte, bool, error) {
+	content, err := os.ReadFile(c.Location(url))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading file cache: %w", err)
+	}
+	return content, true, nil
+}
+
+// Usage describes the files of the cache.
+func (c *diskCache) Usage(ctx context.Context) (CacheStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var stats CacheStats
+	if err := c.load(); err != nil {
+		return stats, fmt.Errorf("error reading file cache index: %w", err)
+	}
+	for _, entry := range c.list() {
+		stats.add(entry)
+	}
+	return stats, nil
+}
+
+// Purge removes the files selected by purge and writes the index.
+func (c *diskCache) Purge(ctx context.Context, purge CachePurge) (CacheStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.load(); err != nil {
+		return CacheStats{}, fmt.Errorf("error reading file cache index: %w", err)
+	}
+	removed := c.remove(purge)
+	if c.dirty {
+		c.writeIndex()
+	}
+	return removed, nil
+}
+
+// load reads the index and reconciles it with the files of the directory, once. Files missing
+// from the index are added with their modification time as last use.
+func (c *diskCache) load() error {
+	if c.loaded {
+		return nil
+	}
+	index := make(map[string]*fileCacheEntry)
+	data, err := os.ReadFile(filepath.Join(c.dir, fileCacheIndexName))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &index); err != nil {
+			slog.Warn("Rebuilding invalid file cache index", "dir", c.dir, "error", err)
+			index = make(map[string]*fileCacheEntry)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	files, err := os.ReadDir(c.dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	c.entries, c.size = make(map[string]*fileCacheEntry), 0
+	for _, file := range files {
+		if file.IsDir() || file.Name() == fileCacheIndexName || strings.HasSuffix(file.Name(), ".tmp") {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		entry := &fileCacheEntry{Size: info.Size(), UsedAt: info.ModTime()}
+		if indexed, ok := index[file.Name()]; ok {
+			entry.URL = indexed.URL
+		}
+		c.entries[file.Name()] = entry
+		c.size += entry.Size
+	}
+	c.loaded = true
+	c.dirty = len(c.entries) != len(index)
+	return nil
+}
+
+// list returns the files of the index.
+func (c *diskCache) list() []cacheEntry {
+	entries := make([]cacheEntry, 0, len(c.entries))
+	for name, entry := range c.entries {
+		entries = append(entries, cacheEntry{key: name, size: entry.Size, usedAt: entry.UsedAt})
+	}
+	return entries
+}
+
+// remove deletes the files selected by purge and returns what was removed. Files that can't be
+// deleted are logged and kept.
+func (c *diskCache) remove(purge CachePurge) CacheStats {
+	var removed CacheStats
+	for _, entry := range purgeSelection(c.list(), purge, time.Now()) {
+		if err := os.Remove(filepath.Join(c.dir, entry.key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("Failed to remove file from the file cache", "file", entry.key, "error", err)
+			continue
+		}
+		delete(c.entries, entry.key)
+		c.size -= entry.size
+		c.dirty = true
+		removed.add(entry)
+	}
+	return removed
+}
+
+// writeIndex replaces the index file with the entries of the cache. Failures are logged, the
+// index being rebuilt from the files when it is out of date.
+func (c *diskCache) writeIndex() {
+	data, err := json.Marshal(c.entries)
+	if err == nil {
+		err = writeFileAtomically(filepath.Join(c.dir, fileCacheIndexName), data)
+	}
+	if err != nil {
+		slog.Warn("Failed to write the file cache index", "dir", c.dir, "error", err)
+		return
+	}
+	c.dirty, c.writtenAt = false, time.Now()
+}
+
+// writeFileAtomically replaces the file at path with data through a temporary file, creating
+// its directory if needed.
+func writeFileAtomically(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
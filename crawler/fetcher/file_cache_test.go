@@ -0,0 +1,165 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseFileCacheMaxSize(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    int64
+		wantErr bool
+	}{
+		{spec: "", want: 0},
+		{spec: "unlimited", want: -1},
+		{spec: "4096", want: 4096},
+		{spec: "100B", want: 100},
+		{spec: "64KB", want: 64 << 10},
+		{spec: "200mb", want: 200 << 20},
+		{spec: " 2 GB ", want: 2 << 30},
+		{spec: "0", wantErr: true},
+		{spec: "-5MB", wantErr: true},
+		{spec: "1.5GB", wantErr: true},
+		{spec: "big", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseFileCacheMaxSize(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFileCacheMaxSize(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFileCacheMaxSize(%q) = %d, want %d", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+// writeCacheFile writes a cache file of size bytes in dir, last used age ago.
+func writeCacheFile(t *testing.T, dir, name string, size int, age time.Duration) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	usedAt := time.Now().Add(-age)
+	if err := os.Chtimes(path, usedAt, usedAt); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// putAged stores size bytes for url in cache, as written age ago.
+func putAged(t *testing.T, cache PageCache, url string, size int, age time.Duration) {
+	t.Helper()
+	if err := cache.Put(context.Background(), url, make([]byte, size)); err != nil {
+		t.Fatalf("Put(%s) error = %v", url, err)
+	}
+	usedAt := time.Now().Add(-age)
+	path := cache.Location(url)
+	if err := os.Chtimes(path, usedAt, usedAt); err != nil {
+		t.Fatal(err)
+	}
+	// The index records the modification time of the file when it is written
+	disk := cache.(*diskCache)
+	disk.mu.Lock()
+	disk.entries[filepath.Base(path)].UsedAt = usedAt
+	disk.mu.Unlock()
+}
+
+func TestDiskCache_PutEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	// Files written before the index existed are found in the directory
+	writeCacheFile(t, dir, urlToCacheFilename("example.com/oldest"), 400, 3*time.Hour)
+	cache := NewDiskCache(dir, 1000)
+	putAged(t, cache, "example.com/older", 400, 2*time.Hour)
+	if _, err := os.Stat(cache.Location("example.com/oldest")); err != nil {
+		t.Fatalf("file removed under the max size: %v", err)
+	}
+
+	putAged(t, cache, "example.com/recent", 400, time.Hour)
+	if _, err := os.Stat(cache.Location("example.com/older")); err != nil {
+		t.Errorf("older file removed, want only the least recently used one removed: %v", err)
+	}
+	if _, found, _ := cache.Get(ctx, "example.com/oldest"); found {
+		t.Errorf("least recently used file kept after the cache went over its max size")
+	}
+	if content, found, err := cache.Get(ctx, "example.com/recent"); err != nil || !found || len(content) != 400 {
+		t.Errorf("Get(recent) = %d bytes, %v, %v, want the stored text", len(content), found, err)
+	}
+
+	// The index is written after trimming, with the URL of the files
+	data, err := os.ReadFile(filepath.Join(dir, fileCacheIndexName))
+	if err != nil {
+		t.Fatalf("index not written after trimming: %v", err)
+	}
+	var index map[string]*fileCacheEntry
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	recent := index[urlToCacheFilename("example.com/recent")]
+	if len(index) != 2 || recent == nil || recent.URL != "example.com/recent" || recent.Size != 400 {
+		t.Errorf("index = %+v, want the older and recent files", index)
+	}
+
+	// Rewriting a file makes it the most recently used one
+	putAged(t, cache, "example.com/older", 400, 0)
+	putAged(t, cache, "example.com/new", 400, 0)
+	if _, found, _ := cache.Get(ctx, "example.com/recent"); found {
+		t.Errorf("least recently used file kept after the cache went over its max size")
+	}
+	if stats, _ := cache.Usage(ctx); stats.Files != 2 || stats.Size != 800 {
+		t.Errorf("Usage() = %+v, want 2 files of 800 bytes", stats)
+	}
+
+	// A new cache of the directory reads the index back
+	reopened := NewDiskCache(dir, -1)
+	putAged(t, reopened, "example.com/big", 5000, 0)
+	if stats, _ := reopened.Usage(ctx); stats.Files != 3 {
+		t.Errorf("Usage() = %+v, want 3 files without a limit", stats)
+	}
+}
+
+func TestDiskCache_Purge(t *testing.T) {
+	tests := []struct {
+		name        string
+		purge       CachePurge
+		wantRemoved int
+		wantKept    []string
+	}{
+		{name: "max size", purge: CachePurge{MaxSize: 150}, wantRemoved: 2, wantKept: []string{"c"}},
+		{name: "unused for", purge: CachePurge{UnusedFor: 90 * time.Minute}, wantRemoved: 1, wantKept: []string{"b", "c"}},
+		{name: "all", purge: CachePurge{All: true}, wantRemoved: 3},
+		{name: "nothing", purge: CachePurge{}, wantKept: []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cache := NewDiskCache(t.TempDir(), 0)
+			putAged(t, cache, "a", 100, 2*time.Hour)
+			putAged(t, cache, "b", 100, time.Hour)
+			putAged(t, cache, "c", 100, 0)
+
+			removed, err := cache.Purge(ctx, tt.purge)
+			if err != nil {
+				t.Fatalf("Purge() error = %v", err)
+			}
+			if removed.Files != tt.wantRemoved || removed.Size != int64(100*tt.wantRemoved) {
+				t.Errorf("Purge() removed %+v, want %d files", removed, tt.wantRemoved)
+			}
+			if stats, _ := cache.Usage(ctx); stats.Files != len(tt.wantKept) {
+				t.Errorf("%d file(s) kept, want %v", stats.Files, tt.wantKept)
+			}
+			for _, url := range tt.wantKept {
+				if _, found, _ := cache.Get(ctx, url); !found {
+					t.Errorf("text of %s removed", url)
+				}
+			}
+		})
+	}
+}
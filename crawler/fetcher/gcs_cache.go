@@ -0,0 +1,91 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+)
+
+// gcsCache is a PageCache keeping each text in a Cloud Storage object under prefix, named after
+// the hash of its URL, so that serverless deployments without a writable disk share one cache.
+// Its size isn't capped on writes, which would list the bucket every time: it is trimmed by
+// Purge, or by a lifecycle rule of the bucket.
+type gcsCache struct {
+	bucket string
+	// prefix is empty or ends with a slash (see lib.ParseGCSURL).
+	prefix string
+}
+
+// Location returns the gs:// URL of the object of url.
+func (c *gcsCache) Location(url string) string {
+	return "gs://" + c.bucket + "/" + c.object(url)
+}
+
+// object returns the name of the object of url.
+func (c *gcsCache) object(url string) string {
+	return c.prefix + urlToCacheFilename(url)
+}
+
+// Put uploads content to the object of url.
+func (c *gcsCache) Put(ctx context.Context, url string, content []byte) error {
+	return lib.WriteGCSObject(ctx, c.bucket, c.object(url), content)
+}
+
+// Get downloads the object of url.
+func (c *gcsCache) Get(ctx context.Context, url string) ([]byte, bool, error) {
+	content, found, err := lib.ReadGCSObject(ctx, c.bucket, c.object(url))
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading %s: %w", c.Location(url), err)
+	}
+	return content, found, nil
+}
+
+// Usage lists the objects of the cache.
+func (c *gcsCache) Usage(ctx context.Context) (CacheStats, error) {
+	var stats CacheStats
+	entries, err := c.list(ctx)
+	if err != nil {
+		return stats, err
+	}
+	for _, entry := range entries {
+		stats.add(entry)
+	}
+	return stats, nil
+}
+
+// Purge deletes the objects selected by purge. It stops at the first object that can't be
+// deleted.
+func (c *gcsCache) Purge(ctx context.Context, purge CachePurge) (CacheStats, error) {
+	var removed CacheStats
+	entries, err := c.list(ctx)
+	if err != nil {
+		return removed, err
+	}
+	for _, entry := range purgeSelection(entries, purge, time.Now()) {
+		if err := lib.DeleteGCSObject(ctx, c.bucket, entry.key); err != nil {
+			return removed, err
+		}
+		removed.add(entry)
+	}
+	return removed, nil
+}
+
+// list returns the objects of the cache. Objects in subdirectories of the prefix aren't part of
+// it.
+func (c *gcsCache) list(ctx context.Context) ([]cacheEntry, error) {
+	objects, err := lib.ListGCSObjects(ctx, c.bucket, c.prefix)
+	if err != nil {
+		return nil, err
+	}
+	var entries []cacheEntry
+	for _, object := range objects {
+		if strings.Contains(strings.TrimPrefix(object.Name, c.prefix), "/") {
+			continue
+		}
+		entries = append(entries, cacheEntry{key: object.Name, size: object.Size, usedAt: object.Updated})
+	}
+	return entries, nil
+}
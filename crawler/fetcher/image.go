@@ -0,0 +1,54 @@
+package fetcher
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// leadImageSelectors are the elements pages use to declare their lead image, most reliable first.
+// The URL is read from the content attribute, or from href for <link> elements.
+var leadImageSelectors = []string{
+	`meta[property="og:image:secure_url"]`,
+	`meta[property="og:image"]`,
+	`meta[name="twitter:image"]`,
+	`meta[name="twitter:image:src"]`,
+	`link[rel="image_src"]`,
+}
+
+// extractLeadImage returns the lead image declared by the page, or "" if it declares none.
+func extractLeadImage(doc *goquery.Document) string {
+	for _, selector := range leadImageSelectors {
+		element := doc.Find(selector).First()
+		value, ok := element.Attr("content")
+		if !ok {
+			value, ok = element.Attr("href")
+		}
+		if ok && strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// resolveImageURL resolves image, which may be relative, against the URL of the page that
+// declares it. It returns "" if image is not a valid http or https URL.
+func resolveImageURL(pageURL, image string) string {
+	if image == "" {
+		return ""
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+	ref, err := url.Parse(image)
+	if err != nil {
+		return ""
+	}
+	resolved := base.ResolveReference(ref)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return ""
+	}
+	return resolved.String()
+}
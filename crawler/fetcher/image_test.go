@@ -0,0 +1,82 @@
+package fetcher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestExtractLeadImage(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{
+			name:     "open graph image",
+			html:     `<head><meta name="twitter:image" content="/twitter.jpg"><meta property="og:image" content=" /og.jpg "></head>`,
+			expected: "/og.jpg",
+		},
+		{
+			name:     "secure open graph image first",
+			html:     `<head><meta property="og:image" content="http://example.com/og.jpg"><meta property="og:image:secure_url" content="https://example.com/og.jpg"></head>`,
+			expected: "https://example.com/og.jpg",
+		},
+		{
+			name:     "twitter image",
+			html:     `<head><meta name="twitter:image" content="https://example.com/twitter.jpg"></head>`,
+			expected: "https://example.com/twitter.jpg",
+		},
+		{
+			name:     "image_src link",
+			html:     `<head><link rel="image_src" href="/lead.png"></head>`,
+			expected: "/lead.png",
+		},
+		{
+			name:     "empty content falls through",
+			html:     `<head><meta property="og:image" content=""><meta name="twitter:image" content="/twitter.jpg"></head>`,
+			expected: "/twitter.jpg",
+		},
+		{
+			name:     "no image",
+			html:     `<body><img src="/inline.jpg"></body>`,
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			if got := extractLeadImage(doc); got != tt.expected {
+				t.Errorf("extractLeadImage() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolveImageURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		image    string
+		expected string
+	}{
+		{"absolute", "https://cdn.example.com/a.jpg", "https://cdn.example.com/a.jpg"},
+		{"root relative", "/images/a.jpg", "https://example.com/images/a.jpg"},
+		{"path relative", "a.jpg", "https://example.com/news/a.jpg"},
+		{"protocol relative", "//cdn.example.com/a.jpg", "https://cdn.example.com/a.jpg"},
+		{"data URL", "data:image/png;base64,AAAA", ""},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveImageURL("https://example.com/news/story", tt.image); got != tt.expected {
+				t.Errorf("resolveImageURL(%q) = %q, want %q", tt.image, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package fetcher
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultMemoryCacheMaxSize is the size in bytes of a memory page cache opened with a zero max
+// size.
+const DefaultMemoryCacheMaxSize = 64 << 20
+
+// memoryCache is a PageCache keeping the texts in memory, for deployments without a writable
+// disk. Once they add up to more than maxSize bytes, the least recently used ones are dropped.
+type memoryCache struct {
+	maxSize int64
+
+	mu sync.Mutex
+	// order holds the *memoryEntry values, most recently used first.
+	order   *list.List
+	entries map[string]*list.Element
+	size    int64
+}
+
+// memoryEntry is a text of a memoryCache.
+type memoryEntry struct {
+	url     string
+	content []byte
+	usedAt  time.Time
+}
+
+// NewMemoryCache returns a PageCache keeping texts in memory. Its least recently used texts are
+// dropped once it is larger than maxSize bytes: zero means DefaultMemoryCacheMaxSize, a
+// negative size no limit.
+func NewMemoryCache(maxSize int64) PageCache {
+	if maxSize == 0 {
+		maxSize = DefaultMemoryCacheMaxSize
+	}
+	return &memoryCache{maxSize: maxSize, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Location returns url prefixed with "memory:".
+func (c *memoryCache) Location(url string) string {
+	return PageCacheMemory + ":" + url
+}
+
+// Put stores a copy of content and drops the least recently used texts past the max size.
+func (c *memoryCache) Put(ctx context.Context, url string, content []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drop(url)
+	entry := &memoryEntry{url: url, content: append([]byte(nil), content...), usedAt: time.Now()}
+	c.entries[url] = c.order.PushFront(entry)
+	c.size += int64(len(content))
+	for c.maxSize > 0 && c.size > c.maxSize && c.order.Len() > 1 {
+		c.drop(c.order.Back().Value.(*memoryEntry).url)
+	}
+	return nil
+}
+
+// Get returns the text of url and marks it as the most recently used one.
+func (c *memoryCache) Get(ctx context.Context, url string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[url]
+	if !ok {
+		return nil, false, nil
+	}
+	c.order.MoveToFront(element)
+	entry := element.Value.(*memoryEntry)
+	entry.usedAt = time.Now()
+	return entry.content, true, nil
+}
+
+// Usage describes the texts in memory.
+func (c *memoryCache) Usage(ctx context.Context) (CacheStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var stats CacheStats
+	for _, entry := range c.list() {
+		stats.add(entry)
+	}
+	return stats, nil
+}
+
+// Purge drops the texts selected by purge.
+func (c *memoryCache) Purge(ctx context.Context, purge CachePurge) (CacheStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var removed CacheStats
+	for _, entry := range purgeSelection(c.list(), purge, time.Now()) {
+		c.drop(entry.key)
+		removed.add(entry)
+	}
+	return removed, nil
+}
+
+// list returns the texts of the cache.
+func (c *memoryCache) list() []cacheEntry {
+	entries := make([]cacheEntry, 0, c.order.Len())
+	for element := c.order.Front(); element != nil; element = element.Next() {
+		entry := element.Value.(*memoryEntry)
+		entries = append(entries, cacheEntry{key: entry.url, size: int64(len(entry.content)), usedAt: entry.usedAt})
+	}
+	return entries
+}
+
+// drop removes the text of url, if there is one.
+func (c *memoryCache) drop(url string) {
+	element, ok := c.entries[url]
+	if !ok {
+		return
+	}
+	c.size -= int64(len(element.Value.(*memoryEntry).content))
+	c.order.Remove(element)
+	delete(c.entries, url)
+}
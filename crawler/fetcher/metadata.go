@@ -0,0 +1,67 @@
+package fetcher
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// pageMetadata is the article metadata a page declares in OpenGraph, Twitter card and standard
+// meta tags. Empty fields are not declared.
+type pageMetadata struct {
+	Title        string
+	Description  string
+	Author       string
+	CanonicalURL string
+}
+
+// metaTitleSelectors, metaDescriptionSelectors and metaAuthorSelectors are the meta tags declaring
+// the article title, summary and author, most reliable first.
+var (
+	metaTitleSelectors = []string{
+		`meta[property="og:title"]`,
+		`meta[name="twitter:title"]`,
+	}
+	metaDescriptionSelectors = []string{
+		`meta[property="og:description"]`,
+		`meta[name="description"]`,
+		`meta[name="twitter:description"]`,
+	}
+	metaAuthorSelectors = []string{
+		`meta[name="author"]`,
+		`meta[property="article:author"]`,
+		`meta[name="dc.creator"]`,
+		`meta[name="parsely-author"]`,
+	}
+)
+
+// extractMetadata returns the metadata declared by the page at pageURL. The canonical URL is
+// taken from <link rel="canonical"> or og:url and resolved against pageURL.
+func extractMetadata(doc *goquery.Document, pageURL string) pageMetadata {
+	metadata := pageMetadata{
+		Title:       firstMetaContent(doc, metaTitleSelectors, false),
+		Description: firstMetaContent(doc, metaDescriptionSelectors, false),
+		// article:author is often the URL of the author's profile rather than a name
+		Author: firstMetaContent(doc, metaAuthorSelectors, true),
+	}
+
+	canonical := strings.TrimSpace(doc.Find(`link[rel="canonical"]`).First().AttrOr("href", ""))
+	if canonical == "" {
+		canonical = strings.TrimSpace(doc.Find(`meta[property="og:url"]`).First().AttrOr("content", ""))
+	}
+	metadata.CanonicalURL = resolveImageURL(pageURL, canonical) // Resolved like image URLs, http(s) only
+	return metadata
+}
+
+// firstMetaContent returns the whitespace-normalized content of the first of selectors found in
+// doc with a non-empty content, skipping URLs if skipURLs is true.
+func firstMetaContent(doc *goquery.Document, selectors []string, skipURLs bool) string {
+	for _, selector := range selectors {
+		content := strings.Join(strings.Fields(doc.Find(selector).First().AttrOr("content", "")), " ")
+		if content == "" || (skipURLs && (strings.HasPrefix(content, "http://") || strings.HasPrefix(content, "https://"))) {
+			continue
+		}
+		return content
+	}
+	return ""
+}
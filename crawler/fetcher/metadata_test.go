@@ -0,0 +1,63 @@
+package fetcher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestExtractMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want pageMetadata
+	}{
+		{
+			name: "OpenGraph tags",
+			head: `<meta property="og:title" content="Bridge to Be Built">
+				<meta property="og:description" content="The city will build a new
+					bridge over the river.">
+				<meta property="og:url" content="https://example.com/news/bridge">
+				<meta name="author" content="Jane Doe">`,
+			want: pageMetadata{
+				Title:        "Bridge to Be Built",
+				Description:  "The city will build a new bridge over the river.",
+				Author:       "Jane Doe",
+				CanonicalURL: "https://example.com/news/bridge",
+			},
+		},
+		{
+			name: "standard tags",
+			head: `<meta name="twitter:title" content="Bridge">
+				<meta name="description" content="A new bridge.">
+				<meta property="article:author" content="https://example.com/authors/jane">
+				<meta name="dc.creator" content="Jane Doe">
+				<link rel="canonical" href="/news/bridge?ref=rss">
+				<meta property="og:url" content="https://example.com/other">`,
+			want: pageMetadata{
+				Title:        "Bridge",
+				Description:  "A new bridge.",
+				Author:       "Jane Doe",
+				CanonicalURL: "https://example.com/news/bridge?ref=rss",
+			},
+		},
+		{
+			name: "no metadata",
+			head: `<title>Bridge</title><meta name="description" content="  ">`,
+			want: pageMetadata{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><head>" + tt.head + "</head><body></body></html>"))
+			if err != nil {
+				t.Fatalf("failed to parse HTML: %v", err)
+			}
+			if got := extractMetadata(doc, "https://example.com/news/bridge-123"); got != tt.want {
+				t.Errorf("extractMetadata() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
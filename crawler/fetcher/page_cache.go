@@ -0,0 +1,135 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+)
+
+const (
+	// PageCacheDisk keeps the page cache in files of the cache directory.
+	PageCacheDisk = "disk"
+	// PageCacheMemory keeps the page cache in memory, for the lifetime of the process.
+	PageCacheMemory = "memory"
+	// PageCacheNone disables the page cache.
+	PageCacheNone = "none"
+)
+
+// PageCache stores the extracted text of the fetched articles by normalized URL, alongside the
+// pages of the Datastore. FetchArticleContent writes the text of every page it returns.
+// Implementations must be safe for concurrent use.
+type PageCache interface {
+	// Put stores content as the text of the page at url, replacing the previous one.
+	Put(ctx context.Context, url string, content []byte) error
+	// Get returns the text stored for the page at url, and whether there is one.
+	Get(ctx context.Context, url string) ([]byte, bool, error)
+	// Location returns where the text of the page at url is stored, such as a file path or a
+	// gs:// URL.
+	Location(url string) string
+	// Usage describes the stored texts.
+	Usage(ctx context.Context) (CacheStats, error)
+	// Purge removes the texts selected by purge and returns what was removed.
+	Purge(ctx context.Context, purge CachePurge) (CacheStats, error)
+}
+
+// CacheStats describes the texts of a page cache.
+type CacheStats struct {
+	Files int
+	Size  int64
+	// Oldest is when the least recently used text was last written, zero for an empty cache.
+	Oldest time.Time
+}
+
+// CachePurge selects the texts a PageCache purges.
+type CachePurge struct {
+	// All removes every text.
+	All bool
+	// MaxSize trims the cache to this many bytes, least recently used texts first. Zero keeps
+	// all the texts.
+	MaxSize int64
+	// UnusedFor removes the texts not written for this long. Zero keeps them.
+	UnusedFor time.Duration
+}
+
+// OpenPageCache returns the page cache described by spec: "disk" (or empty) for files in the
+// cache directory, "memory" for the memory of the process, a gs://bucket/prefix URL for objects
+// in Cloud Storage, or "none" for no cache. The disk and memory caches remove their least
+// recently used texts once they are larger than maxSize (see ParseFileCacheMaxSize).
+func OpenPageCache(spec string, maxSize int64) (PageCache, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == "" || spec == PageCacheDisk:
+		return NewDiskCache(cacheDir, maxSize), nil
+	case spec == PageCacheMemory:
+		return NewMemoryCache(maxSize), nil
+	case spec == PageCacheNone:
+		return noPageCache{}, nil
+	case strings.HasPrefix(spec, "gs://"):
+		bucket, prefix, err := lib.ParseGCSURL(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid page cache %q: %w", spec, err)
+		}
+		return &gcsCache{bucket: bucket, prefix: prefix}, nil
+	}
+	return nil, fmt.Errorf("invalid page cache %q (valid: %s, %s, %s or a gs://bucket/prefix URL)", spec, PageCacheDisk, PageCacheMemory, PageCacheNone)
+}
+
+// cacheEntry is a text of a page cache, as listed for purges.
+type cacheEntry struct {
+	key    string
+	size   int64
+	usedAt time.Time
+}
+
+// purgeSelection returns the entries purge removes, least recently used first. Past the entries
+// not used for purge.UnusedFor, the least recently used ones are selected until the others add
+// up to at most purge.MaxSize bytes.
+func purgeSelection(entries []cacheEntry, purge CachePurge, now time.Time) []cacheEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].usedAt.Equal(entries[j].usedAt) {
+			return entries[i].usedAt.Before(entries[j].usedAt)
+		}
+		return entries[i].key < entries[j].key
+	})
+	var size int64
+	for _, entry := range entries {
+		size += entry.size
+	}
+	cutoff := now.Add(-purge.UnusedFor)
+	var selected []cacheEntry
+	for _, entry := range entries {
+		if purge.All || (purge.UnusedFor > 0 && entry.usedAt.Before(cutoff)) || (purge.MaxSize > 0 && size > purge.MaxSize) {
+			selected = append(selected, entry)
+			size -= entry.size
+		}
+	}
+	return selected
+}
+
+// add counts entry among the texts of stats.
+func (s *CacheStats) add(entry cacheEntry) {
+	s.Files++
+	s.Size += entry.size
+	if s.Oldest.IsZero() || entry.usedAt.Before(s.Oldest) {
+		s.Oldest = entry.usedAt
+	}
+}
+
+// noPageCache is a PageCache that stores nothing.
+type noPageCache struct{}
+
+func (noPageCache) Put(context.Context, string, []byte) error { return nil }
+
+func (noPageCache) Get(context.Context, string) ([]byte, bool, error) { return nil, false, nil }
+
+func (noPageCache) Location(string) string { return "" }
+
+func (noPageCache) Usage(context.Context) (CacheStats, error) { return CacheStats{}, nil }
+
+func (noPageCache) Purge(context.Context, CachePurge) (CacheStats, error) {
+	return CacheStats{}, nil
+}
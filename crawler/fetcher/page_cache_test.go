@@ -0,0 +1,132 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+)
+
+func TestOpenPageCache(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    PageCache
+		wantErr bool
+	}{
+		{spec: "", want: &diskCache{dir: cacheDir, maxSize: DefaultFileCacheMaxSize}},
+		{spec: "disk", want: &diskCache{dir: cacheDir, maxSize: DefaultFileCacheMaxSize}},
+		{spec: "none", want: noPageCache{}},
+		{spec: "gs://bucket/pages", want: &gcsCache{bucket: "bucket", prefix: "pages/"}},
+		{spec: "gs://", wantErr: true},
+		{spec: "redis", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := OpenPageCache(tt.spec, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("OpenPageCache(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("OpenPageCache(%q) = %#v, want %#v", tt.spec, got, tt.want)
+			}
+		})
+	}
+	if cache, _ := OpenPageCache("memory", 0); cache.(*memoryCache).maxSize != DefaultMemoryCacheMaxSize {
+		t.Errorf("memory cache max size = %d, want %d", cache.(*memoryCache).maxSize, DefaultMemoryCacheMaxSize)
+	}
+}
+
+func TestGCSCacheLocation(t *testing.T) {
+	cache := &gcsCache{bucket: "bucket", prefix: "pages/"}
+	if got, want := cache.Location("example.com/a"), "gs://bucket/pages/"+urlToCacheFilename("example.com/a"); got != want {
+		t.Errorf("Location() = %q, want %q", got, want)
+	}
+}
+
+func TestPurgeSelection(t *testing.T) {
+	now := time.Now()
+	entries := []cacheEntry{
+		{key: "new", size: 100, usedAt: now},
+		{key: "old", size: 100, usedAt: now.Add(-3 * time.Hour)},
+		{key: "mid", size: 100, usedAt: now.Add(-time.Hour)},
+	}
+	tests := []struct {
+		name  string
+		purge CachePurge
+		want  []string
+	}{
+		{name: "nothing", purge: CachePurge{}},
+		{name: "all", purge: CachePurge{All: true}, want: []string{"old", "mid", "new"}},
+		{name: "unused for", purge: CachePurge{UnusedFor: 2 * time.Hour}, want: []string{"old"}},
+		{name: "max size", purge: CachePurge{MaxSize: 200}, want: []string{"old"}},
+		{name: "both", purge: CachePurge{UnusedFor: 2 * time.Hour, MaxSize: 100}, want: []string{"old", "mid"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, entry := range purgeSelection(append([]cacheEntry(nil), entries...), tt.purge, now) {
+				got = append(got, entry.key)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("purgeSelection() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache(250)
+	for _, url := range []string{"a", "b"} {
+		cache.Put(ctx, url, make([]byte, 100))
+	}
+	// Reading a makes b the least recently used text
+	if _, found, _ := cache.Get(ctx, "a"); !found {
+		t.Fatal("text of a not found")
+	}
+	cache.Put(ctx, "c", make([]byte, 100))
+	if _, found, _ := cache.Get(ctx, "b"); found {
+		t.Error("least recently used text kept past the max size")
+	}
+	if stats, _ := cache.Usage(ctx); stats.Files != 2 || stats.Size != 200 {
+		t.Errorf("Usage() = %+v, want 2 texts of 200 bytes", stats)
+	}
+
+	// Replacing a text counts its new size only
+	cache.Put(ctx, "a", make([]byte, 50))
+	if stats, _ := cache.Usage(ctx); stats.Size != 150 {
+		t.Errorf("Usage() = %+v, want 150 bytes", stats)
+	}
+	if removed, _ := cache.Purge(ctx, CachePurge{All: true}); removed.Files != 2 {
+		t.Errorf("Purge() removed %+v, want 2 texts", removed)
+	}
+	if _, found, _ := cache.Get(ctx, "c"); found {
+		t.Error("text kept after purging all")
+	}
+}
+
+func TestFetchArticleContent_PageCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body><main><p>The text of the article.</p></main></body></html>"))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	cache := NewMemoryCache(0)
+	page, location, err := FetchArticleContent(ctx, server.URL, false, lib.NewMockDatastoreClient(),
+		Options{Cache: cache, AllowPrivateAddresses: true})
+	if err != nil {
+		t.Fatalf("FetchArticleContent() error = %v", err)
+	}
+	url := lib.NormalizeURL(server.URL)
+	if location != "memory:"+url {
+		t.Errorf("location = %q, want the memory cache", location)
+	}
+	if content, found, _ := cache.Get(ctx, url); !found || string(content) != page.Content {
+		t.Errorf("cached text = %q, want the page content %q", content, page.Content)
+	}
+}
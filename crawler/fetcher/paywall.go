@@ -0,0 +1,165 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/zeace/poisson/models"
+)
+
+// paywallMinLength is the number of characters of article text below which a page is
+// considered truncated.
+const paywallMinLength = 500
+
+// DefaultArchiveMirrors are the web archives tried for paywalled pages when
+// Options.ArchiveMirrors is empty.
+var DefaultArchiveMirrors = []string{"https://web.archive.org/web/"}
+
+// paywallMarkers are phrases of the subscription prompts shown instead of the article of
+// paywalled pages, lowercased.
+var paywallMarkers = []string{
+	"subscribe to continue",
+	"subscribe to read",
+	"subscribe now to read",
+	"subscribers only",
+	"already a subscriber",
+	"to continue reading",
+	"sign in to continue",
+	"create a free account to continue",
+	"réservé aux abonnés",
+	"nur für abonnenten",
+	"exclusivo para suscriptores",
+}
+
+// notAccessibleForFreePattern matches the schema.org declaration of paywalled content.
+var notAccessibleForFreePattern = regexp.MustCompile(`(?i)"isAccessibleForFree"\s*:\s*"?false"?`)
+
+// paywallFallback is another source of the content of a paywalled page.
+type paywallFallback struct {
+	url    string
+	source models.PaywallSource
+	body   []byte
+}
+
+// ParseArchiveMirrors parses a comma-separated list of web archive URL prefixes, to which the
+// URL of a page is appended to get its archived copy (e.g. https://web.archive.org/web/). It
+// returns nil if spec is empty.
+func ParseArchiveMirrors(spec string) ([]string, error) {
+	var mirrors []string
+	for _, prefix := range strings.Split(spec, ",") {
+		prefix = strings.TrimSpace(prefix)
+		if prefix == "" {
+			continue
+		}
+		parsed, err := url.Parse(prefix)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid archive mirror %q: expected an http:// or https:// URL prefix", prefix)
+		}
+		mirrors = append(mirrors, prefix)
+	}
+	return mirrors, nil
+}
+
+// detectPaywall returns why the HTML body looks paywalled or truncated, or "" if it doesn't:
+// it declares that it isn't accessible for free, shows a subscription prompt, or has less than
+// paywallMinLength characters of article text.
+func detectPaywall(body []byte, opts Options) string {
+	if notAccessibleForFreePattern.Match(body) {
+		return "declared not accessible for free"
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	// The prompts are searched before boilerplate removal, which strips paywall overlays
+	doc.Find("script, style").Remove()
+	text := strings.ToLower(strings.Join(strings.Fields(doc.Find("body").Text()), " "))
+	for _, marker := range paywallMarkers {
+		if strings.Contains(text, marker) {
+			return fmt.Sprintf("subscription prompt %q", marker)
+		}
+	}
+	if length := articleTextLength(body, opts); length < paywallMinLength {
+		return fmt.Sprintf("only %d characters of article text", length)
+	}
+	return ""
+}
+
+// paywallAlternatives returns the other sources of the paywalled page at pageURL, in the order
+// they are tried: the AMP version declared in its HTML body, then its archived copies.
+func paywallAlternatives(body []byte, pageURL string, opts Options) []paywallFallback {
+	var alternatives []paywallFallback
+	if doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body)); err == nil {
+		if href := strings.TrimSpace(doc.Find(`link[rel="amphtml"]`).First().AttrOr("href", "")); href != "" {
+			if base, err := url.Parse(pageURL); err == nil {
+				if amp, err := base.Parse(href); err == nil && amp.String() != pageURL {
+					alternatives = append(alternatives, paywallFallback{url: amp.String(), source: models.PaywallSourceAMP})
+				}
+			}
+		}
+	}
+	mirrors := opts.ArchiveMirrors
+	if len(mirrors) == 0 {
+		mirrors = DefaultArchiveMirrors
+	}
+	for _, mirror := range mirrors {
+		alternatives = append(alternatives, paywallFallback{url: mirror + pageURL, source: models.PaywallSourceArchive})
+	}
+	return alternatives
+}
+
+// fetchPaywallFallback tries the alternatives of the paywalled page at pageURL in turn and
+// returns the first one that has more article text than body and doesn't look paywalled, or
+// nil if none does. Credentials are only sent to the AMP version.
+func fetchPaywallFallback(
+	ctx context.Context,
+	httpClient *http.Client,
+	body []byte,
+	pageURL string,
+	opts Options,
+	verbose bool,
+) *paywallFallback {
+	length := articleTextLength(body, opts)
+	for _, alternative := range paywallAlternatives(body, pageURL, opts) {
+		req, err := http.NewRequestWithContext(ctx, "GET", alternative.url, nil)
+		if err != nil {
+			continue
+		}
+		req.Header.Set("User-Agent", userAgent)
+		if alternative.source == models.PaywallSourceAMP {
+			opts.Credentials.Apply(req)
+		}
+		resp, altBody, err := fetchOnce(httpClient, req, opts.maxBodySize())
+		if err != nil || resp.StatusCode != http.StatusOK {
+			if verbose {
+				slog.InfoContext(ctx, "Paywall fallback failed", "source", alternative.source, "fallback_url", alternative.url, "error", err, "status", statusOf(resp))
+			}
+			continue
+		}
+		altBody, _ = toUTF8(altBody, resp.Header.Get("Content-Type"))
+		if reason := detectPaywall(altBody, opts); reason != "" || articleTextLength(altBody, opts) <= length {
+			if verbose {
+				slog.InfoContext(ctx, "Paywall fallback has no more of the article", "source", alternative.source, "fallback_url", alternative.url, "reason", reason)
+			}
+			continue
+		}
+		alternative.body = altBody
+		return &alternative
+	}
+	return nil
+}
+
+// statusOf returns the status code of resp, or 0 if there is no response.
+func statusOf(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
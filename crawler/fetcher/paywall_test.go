@@ -0,0 +1,122 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// longArticle is article text longer than paywallMinLength.
+var longArticle = strings.Repeat("The full story goes on for many paragraphs. ", 20)
+
+func TestDetectPaywall(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"full article", "<html><body><main><p>" + longArticle + "</p></main></body></html>", false},
+		{"short teaser", "<html><body><main><p>The story begins.</p></main></body></html>", true},
+		{"subscription prompt in an overlay", `<html><body><main><p>` + longArticle + `</p></main><div class="paywall">Subscribe to continue reading</div></body></html>`, true},
+		{"declared not accessible for free", `<html><head><script type="application/ld+json">{"@type": "NewsArticle", "isAccessibleForFree": "False"}</script></head><body><main><p>` + longArticle + `</p></main></body></html>`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reason := detectPaywall([]byte(tt.body), Options{}); (reason != "") != tt.want {
+				t.Errorf("detectPaywall() = %q, want paywalled %v", reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArchiveMirrors(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    int
+		wantErr bool
+	}{
+		{spec: "", want: 0},
+		{spec: "https://web.archive.org/web/", want: 1},
+		{spec: "https://web.archive.org/web/, https://archive.ph/newest/", want: 2},
+		{spec: "archive.ph/newest/", wantErr: true},
+		{spec: "ftp://mirror.example.com/", wantErr: true},
+	}
+	for _, tt := range tests {
+		mirrors, err := ParseArchiveMirrors(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseArchiveMirrors(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+		}
+		if err == nil && len(mirrors) != tt.want {
+			t.Errorf("ParseArchiveMirrors(%q) = %v, want %d mirrors", tt.spec, mirrors, tt.want)
+		}
+	}
+}
+
+func TestFetchArticleContent_PaywallFallback(t *testing.T) {
+	teaser := `<html><head><link rel="amphtml" href="/amp%s"></head><body><main><p>The story begins.</p></main>` +
+		`<div class="paywall">Subscribe to continue reading</div></body></html>`
+	full := "<html><body><main><p>" + longArticle + "</p></main></body></html>"
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		switch {
+		case r.URL.Path == "/amp/amp-story":
+			w.Write([]byte(full))
+		case strings.HasPrefix(r.URL.Path, "/amp/"):
+			w.Write([]byte(strings.Replace(teaser, "/amp%s", "", 1))) // The AMP version is paywalled too
+		case strings.HasPrefix(r.URL.Path, "/archive/"):
+			w.Write([]byte(full))
+		default:
+			w.Write([]byte(strings.Replace(teaser, "%s", r.URL.Path, 1)))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	mockDS := lib.NewMockDatastoreClient()
+	opts := Options{PaywallFallback: true, ArchiveMirrors: []string{server.URL + "/archive/"}}
+	fetch := func(path string, opts Options) *models.CrawledPage {
+		t.Helper()
+		var cacheWriter bytes.Buffer
+		page, _, err := fetchArticleContent(ctx, lib.NormalizeURL(server.URL+path), false, mockDS, httpClient, &cacheWriter, "/test/cache/path", opts)
+		if err != nil {
+			t.Fatalf("fetchArticleContent(%s) error = %v", path, err)
+		}
+		return page
+	}
+
+	// The AMP version has the article
+	page := fetch("/amp-story", opts)
+	if !page.Paywalled || page.PaywallSource != models.PaywallSourceAMP || page.ContentURL != server.URL+"/amp/amp-story" ||
+		page.Content != strings.TrimSpace(longArticle) || page.CacheSource != models.CacheSourceNetwork {
+		t.Errorf("page = %+v, want the content of the AMP version", page)
+	}
+
+	// The AMP version is paywalled too, the archived copy has the article
+	requested = nil
+	page = fetch("/archived-story", opts)
+	if !page.Paywalled || page.PaywallSource != models.PaywallSourceArchive || page.ContentURL != server.URL+"/archive/"+server.URL+"/archived-story" ||
+		page.CacheSource != models.CacheSourceArchive {
+		t.Errorf("page = %+v, want the content of the archived copy", page)
+	}
+	if strings.Join(requested, " ") != "/archived-story /amp/archived-story /archive/"+server.URL+"/archived-story" {
+		t.Errorf("requested %v, want the page, its AMP version and its archived copy", requested)
+	}
+	if stored := mockDS.Pages[lib.NormalizeURL(server.URL+"/archived-story")]; stored.PaywallSource != models.PaywallSourceArchive {
+		t.Errorf("stored page = %+v, want the paywall source recorded", stored)
+	}
+
+	// Without the fallback, paywalled pages are stored as fetched
+	page = fetch("/other-story", Options{})
+	if page.Paywalled || page.ContentURL != "" || page.Content != "The story begins." {
+		t.Errorf("page = %+v, want the teaser without paywall detection", page)
+	}
+}
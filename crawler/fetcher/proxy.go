@@ -0,0 +1,148 @@
+package fetcher
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// proxyDirect is the proxy spec of hosts fetched without a proxy.
+const proxyDirect = "direct"
+
+// Proxy routes the requests of the fetcher through HTTP, HTTPS or SOCKS5 proxies chosen by
+// the host of each request. A pool of several proxies is rotated through request by request.
+type Proxy struct {
+	// rules are the per-domain pools, longest domain first.
+	rules []proxyRule
+	// fallback is the pool of hosts matching no rule, or nil to use the HTTP_PROXY,
+	// HTTPS_PROXY and NO_PROXY environment variables.
+	fallback *proxyPool
+
+	transportOnce sync.Once
+	transport     *http.Transport
+	guardedOnce   sync.Once
+	guarded       *http.Transport
+}
+
+// proxyRule is the pool of proxies of a domain and its subdomains.
+type proxyRule struct {
+	domain string
+	pool   *proxyPool
+}
+
+// proxyPool is a set of proxies used in turn, or a direct connection if it has none.
+type proxyPool struct {
+	urls []*url.URL
+	next atomic.Uint64
+}
+
+// ParseProxy parses a comma-separated list of proxy rules: <proxies> for all hosts, and
+// <domain>=<proxies> for a domain and its subdomains, where <proxies> is "direct" or one or
+// more http://, https:// or socks5:// proxy URLs separated by "|", used in turn. Hosts
+// matching no rule use the proxy environment variables unless a rule without a domain is
+// given. It returns nil if spec is empty.
+func ParseProxy(spec string) (*Proxy, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	proxy := &Proxy{}
+	domains := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		domain, proxies, hasDomain := strings.Cut(entry, "=")
+		if !hasDomain {
+			domain, proxies = "", entry
+		}
+		pool, err := parseProxyPool(proxies)
+		if err != nil {
+			return nil, err
+		}
+
+		if !hasDomain {
+			if proxy.fallback != nil {
+				return nil, fmt.Errorf("invalid proxy %q: more than one rule without a domain", spec)
+			}
+			proxy.fallback = pool
+			continue
+		}
+		domain = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "*"), ".")
+		if domain == "" || strings.ContainsAny(domain, "/:") {
+			return nil, fmt.Errorf("invalid proxy rule %q: expected <domain>=<proxies>", entry)
+		}
+		if domains[domain] {
+			return nil, fmt.Errorf("invalid proxy %q: more than one rule for %s", spec, domain)
+		}
+		domains[domain] = true
+		proxy.rules = append(proxy.rules, proxyRule{domain: domain, pool: pool})
+	}
+
+	// Most specific domain first
+	sort.SliceStable(proxy.rules, func(i, j int) bool { return len(proxy.rules[i].domain) > len(proxy.rules[j].domain) })
+	return proxy, nil
+}
+
+// parseProxyPool parses "direct" or "|"-separated proxy URLs.
+func parseProxyPool(spec string) (*proxyPool, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == proxyDirect {
+		return &proxyPool{}, nil
+	}
+	pool := &proxyPool{}
+	for _, raw := range strings.Split(spec, "|") {
+		proxyURL, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", raw)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("invalid proxy URL %q: unsupported scheme %q (valid: http, https, socks5)", proxyURL.Redacted(), proxyURL.Scheme)
+		}
+		pool.urls = append(pool.urls, proxyURL)
+	}
+	return pool, nil
+}
+
+// ProxyURL returns the proxy to send req through, or nil for a direct connection. It has the
+// signature of http.Transport.Proxy.
+func (p *Proxy) ProxyURL(req *http.Request) (*url.URL, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	for _, rule := range p.rules {
+		if inDomain(host, rule.domain) {
+			return rule.pool.pick(), nil
+		}
+	}
+	if p.fallback == nil {
+		return http.ProxyFromEnvironment(req)
+	}
+	return p.fallback.pick(), nil
+}
+
+// pick returns the next proxy of the pool, or nil if it has none.
+func (p *proxyPool) pick() *url.URL {
+	if len(p.urls) == 0 {
+		return nil
+	}
+	return p.urls[(p.next.Add(1)-1)%uint64(len(p.urls))]
+}
+
+// roundTripper returns the transport of the fetcher's requests through p, shared by all of
+// them so that connections to the proxies are reused. Unless allowPrivate is set, it refuses
+// requests to private, loopback and link-local addresses (see guardedTransport).
+func (p *Proxy) roundTripper(allowPrivate bool) http.RoundTripper {
+	p.transportOnce.Do(func() {
+		p.transport = http.DefaultTransport.(*http.Transport).Clone()
+		p.transport.Proxy = p.ProxyURL
+	})
+	if allowPrivate {
+		return p.transport
+	}
+	p.guardedOnce.Do(func() {
+		p.guarded = guardedTransport(p.transport)
+	})
+	return p.guarded
+}
@@ -0,0 +1,59 @@
+package fetcher
+
+import (
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// publishedSelectors are the elements pages use to declare their publication date, most reliable first.
+// The date is read from the content attribute, or from datetime for <time> elements.
+var publishedSelectors = []string{
+	`meta[property="article:published_time"]`,
+	`meta[itemprop="datePublished"]`,
+	`meta[name="date"]`,
+	`meta[name="pubdate"]`,
+	`meta[name="dc.date"]`,
+	`time[itemprop="datePublished"]`,
+	`article time[datetime]`,
+}
+
+// publishedLayouts are the date formats accepted for publication dates.
+var publishedLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	time.DateOnly,
+}
+
+// extractPublishedTime returns the publication date declared by the page, or the zero time if
+// the page declares none or it cannot be parsed.
+func extractPublishedTime(doc *goquery.Document) time.Time {
+	for _, selector := range publishedSelectors {
+		element := doc.Find(selector).First()
+		value, ok := element.Attr("content")
+		if !ok {
+			value, ok = element.Attr("datetime")
+		}
+		if !ok {
+			continue
+		}
+		if published, ok := parsePublishedTime(value); ok {
+			return published
+		}
+	}
+	return time.Time{}
+}
+
+// parsePublishedTime parses a publication date in one of publishedLayouts.
+func parsePublishedTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range publishedLayouts {
+		if published, err := time.Parse(layout, value); err == nil {
+			return published, true
+		}
+	}
+	return time.Time{}, false
+}
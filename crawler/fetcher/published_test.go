@@ -0,0 +1,55 @@
+package fetcher
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestExtractPublishedTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		expected time.Time
+	}{
+		{
+			name:     "open graph article time",
+			html:     `<head><meta property="article:published_time" content="2024-04-01T08:30:00+02:00"></head>`,
+			expected: time.Date(2024, 4, 1, 6, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "schema.org meta date only",
+			html:     `<head><meta itemprop="datePublished" content="2024-04-01"></head>`,
+			expected: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "time element in article",
+			html:     `<body><article><time datetime="2024-04-01T10:00:00Z">April 1</time></article></body>`,
+			expected: time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "unparseable date falls through to the next selector",
+			html:     `<head><meta property="article:published_time" content="yesterday"><meta name="date" content="2024-03-31"></head>`,
+			expected: time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "no date",
+			html:     `<body><p>Hello</p></body>`,
+			expected: time.Time{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			if got := extractPublishedTime(doc); !got.Equal(tt.expected) {
+				t.Errorf("extractPublishedTime() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// ErrQueueClosed is the error of the requests enqueued after Queue.Run returned.
+var ErrQueueClosed = errors.New("fetch queue closed")
+
+// FetchRequest is a URL to fetch through a Queue.
+type FetchRequest struct {
+	URL string
+	// Priority orders the requests: higher first. Requests of equal priority are fetched in
+	// the order they were enqueued.
+	Priority int
+	// NotBefore, if set, holds the request until then, whatever its priority.
+	NotBefore time.Time
+	// Context, if set, is the context of the fetch instead of that of Run. A request whose
+	// context is done before it is fetched fails with its error.
+	Context context.Context
+	// Options are passed to FetchArticleContent. Their concurrency limits are ignored: those of
+	// the queue apply. Their HostDelay applies if it is longer than that of the queue.
+	Options Options
+	// Done, if set, is called with the result of the fetch, from another goroutine.
+	Done func(FetchResult)
+}
+
+// QueueOptions are the politeness and concurrency limits of a Queue.
+type QueueOptions struct {
+	// Concurrency is the maximum number of pages fetched at once. Zero means DefaultConcurrency.
+	Concurrency int
+	// PerHostConcurrency is the maximum number of in-flight requests to a single host. Zero
+	// means DefaultPerHostConcurrency.
+	PerHostConcurrency int
+	// HostDelay is the minimum time between the starts of two requests to the same host. Zero
+	// means no delay.
+	HostDelay time.Duration
+}
+
+// queuedRequest is a request waiting in a Queue.
+type queuedRequest struct {
+	FetchRequest
+	host string
+	// seq is the order in which the request was enqueued.
+	seq uint64
+}
+
+// Queue fetches the URLs enqueued from any number of goroutines, highest priority first, under
+// global and per-host concurrency limits and a delay between the requests to the same host, so
+// that several feeds can share one fetcher without hammering their sites.
+type Queue struct {
+	options QueueOptions
+	fetch   func(ctx context.Context, url string, opts Options) (*models.CrawledPage, string, error)
+
+	mu       sync.Mutex
+	waiting  []*queuedRequest
+	seq      uint64
+	inFlight int
+	hosts    map[string]int
+	// lastStart is when the last request to each host started, for HostDelay.
+	lastStart map[string]time.Time
+	closed    bool
+	// wake is signaled when a request is enqueued or a fetch ends.
+	wake chan struct{}
+}
+
+// NewQueue returns a queue fetching with FetchArticleContent. Requests are fetched while Run runs.
+func NewQueue(datastoreClient lib.DatastoreClient, verbose bool, options QueueOptions) *Queue {
+	return newQueue(options, func(ctx context.Context, url string, opts Options) (*models.CrawledPage, string, error) {
+		return FetchArticleContent(ctx, url, verbose, datastoreClient, opts)
+	})
+}
+
+// newQueue returns a queue fetching with fetch.
+func newQueue(options QueueOptions, fetch func(ctx context.Context, url string, opts Options) (*models.CrawledPage, string, error)) *Queue {
+	if options.Concurrency <= 0 {
+		options.Concurrency = DefaultConcurrency
+	}
+	if options.PerHostConcurrency <= 0 {
+		options.PerHostConcurrency = DefaultPerHostConcurrency
+	}
+	return &Queue{
+		options:   options,
+		fetch:     fetch,
+		hosts:     make(map[string]int),
+		lastStart: make(map[string]time.Time),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Enqueue adds req to the queue. Once Run has returned, req fails with ErrQueueClosed.
+func (q *Queue) Enqueue(req FetchRequest) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		finish(req, FetchResult{URL: req.URL, Err: ErrQueueClosed})
+		return
+	}
+	q.seq++
+	q.waiting = append(q.waiting, &queuedRequest{FetchRequest: req, host: urlHost(req.URL), seq: q.seq})
+	q.mu.Unlock()
+	q.signal()
+	if req.Context != nil {
+		context.AfterFunc(req.Context, q.signal)
+	}
+}
+
+// Len returns the number of requests waiting to be fetched.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiting)
+}
+
+// Run fetches the enqueued requests until ctx is done, then fails the waiting ones with the
+// error of ctx and returns once the fetches in flight have ended. It must be called once.
+func (q *Queue) Run(ctx context.Context) {
+	var fetches sync.WaitGroup
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for ctx.Err() == nil {
+		q.mu.Lock()
+		cancelled := q.cancelled()
+		next, wait := q.next(time.Now())
+		if next != nil {
+			q.start(next)
+		}
+		q.mu.Unlock()
+
+		for _, req := range cancelled {
+			finish(req.FetchRequest, FetchResult{URL: req.URL, Err: req.Context.Err()})
+		}
+
+		if next != nil {
+			fetches.Add(1)
+			go func() {
+				defer fetches.Done()
+				q.run(ctx, next)
+			}()
+			continue
+		}
+
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+		case <-q.wake:
+		case <-timer.C:
+		}
+	}
+	q.close(ctx.Err())
+	fetches.Wait()
+}
+
+// cancelled removes and returns the waiting requests whose context is done.
+func (q *Queue) cancelled() []*queuedRequest {
+	var cancelled []*queuedRequest
+	waiting := q.waiting[:0]
+	for _, req := range q.waiting {
+		if req.Context != nil && req.Context.Err() != nil {
+			cancelled = append(cancelled, req)
+		} else {
+			waiting = append(waiting, req)
+		}
+	}
+	clear(q.waiting[len(waiting):])
+	q.waiting = waiting
+	return cancelled
+}
+
+// next removes and returns the request to fetch now: the first by priority, then order, that is
+// due and whose host is under its limits. If there is none, it returns how long to wait before
+// one may be, or an hour if no request is waiting.
+func (q *Queue) next(now time.Time) (*queuedRequest, time.Duration) {
+	wait := time.Hour
+	if q.inFlight >= q.options.Concurrency {
+		return nil, wait
+	}
+	best := -1
+	for i, req := range q.waiting {
+		readyAt := req.NotBefore
+		delay := max(q.options.HostDelay, req.Options.HostDelay)
+		if last, ok := q.lastStart[req.host]; ok && last.Add(delay).After(readyAt) {
+			readyAt = last.Add(delay)
+		}
+		if readyAt.After(now) {
+			wait = min(wait, readyAt.Sub(now))
+			continue
+		}
+		if q.hosts[req.host] >= q.options.PerHostConcurrency {
+			continue // Woken up when a fetch of the host ends
+		}
+		if best < 0 || req.Priority > q.waiting[best].Priority ||
+			(req.Priority == q.waiting[best].Priority && req.seq < q.waiting[best].seq) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil, wait
+	}
+	req := q.waiting[best]
+	q.waiting = append(q.waiting[:best], q.waiting[best+1:]...)
+	return req, 0
+}
+
+// start counts req as in flight.
+func (q *Queue) start(req *queuedRequest) {
+	q.inFlight++
+	q.hosts[req.host]++
+	q.lastStart[req.host] = time.Now()
+}
+
+// run fetches req and releases its slots.
+func (q *Queue) run(ctx context.Context, req *queuedRequest) {
+	if req.Context != nil {
+		ctx = req.Context
+	}
+	result := FetchResult{URL: req.URL}
+	result.Page, result.CachePath, result.Err = q.fetch(ctx, req.URL, req.Options)
+
+	q.mu.Lock()
+	q.inFlight--
+	if q.hosts[req.host]--; q.hosts[req.host] == 0 {
+		delete(q.hosts, req.host)
+	}
+	q.mu.Unlock()
+	q.signal()
+	finish(req.FetchRequest, result)
+}
+
+// close fails the waiting requests with err and refuses new ones.
+func (q *Queue) close(err error) {
+	q.mu.Lock()
+	waiting := q.waiting
+	q.waiting, q.closed = nil, true
+	q.mu.Unlock()
+	for _, req := range waiting {
+		finish(req.FetchRequest, FetchResult{URL: req.URL, Err: err})
+	}
+}
+
+// signal wakes Run up without blocking.
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// finish calls the Done callback of req, if it has one, with result.
+func finish(req FetchRequest, result FetchResult) {
+	if req.Done != nil {
+		req.Done(result)
+	}
+}
@@ -0,0 +1,174 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/models"
+)
+
+// recordingFetch returns a fetch function recording the URLs it fetches and when.
+func recordingFetch() (func(ctx context.Context, url string, opts Options) (*models.CrawledPage, string, error), func() ([]string, []time.Time)) {
+	var mu sync.Mutex
+	var urls []string
+	var starts []time.Time
+	fetch := func(ctx context.Context, url string, opts Options) (*models.CrawledPage, string, error) {
+		mu.Lock()
+		urls = append(urls, url)
+		starts = append(starts, time.Now())
+		mu.Unlock()
+		return &models.CrawledPage{URL: url}, "", nil
+	}
+	return fetch, func() ([]string, []time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), urls...), append([]time.Time(nil), starts...)
+	}
+}
+
+// runQueue enqueues requests in q, runs it until they are done and returns their results by URL.
+func runQueue(t *testing.T, q *Queue, requests []FetchRequest) map[string]FetchResult {
+	t.Helper()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]FetchResult)
+	wg.Add(len(requests))
+	for _, req := range requests {
+		req.Done = func(result FetchResult) {
+			mu.Lock()
+			results[result.URL] = result
+			mu.Unlock()
+			wg.Done()
+		}
+		q.Enqueue(req)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	wg.Wait()
+	cancel()
+	<-done
+	return results
+}
+
+func TestQueue_Priority(t *testing.T) {
+	fetch, fetched := recordingFetch()
+	q := newQueue(QueueOptions{Concurrency: 1}, fetch)
+	soon := time.Now().Add(50 * time.Millisecond)
+	results := runQueue(t, q, []FetchRequest{
+		{URL: "https://a.example.com/low"},
+		{URL: "https://b.example.com/high", Priority: 10},
+		{URL: "https://c.example.com/later", Priority: 20, NotBefore: soon},
+		{URL: "https://d.example.com/low2"},
+		{URL: "https://e.example.com/high2", Priority: 10},
+	})
+
+	urls, starts := fetched()
+	want := []string{
+		"https://b.example.com/high", "https://e.example.com/high2",
+		"https://a.example.com/low", "https://d.example.com/low2",
+		"https://c.example.com/later",
+	}
+	if len(urls) != len(want) {
+		t.Fatalf("fetched %v, want %v", urls, want)
+	}
+	for i := range want {
+		if urls[i] != want[i] {
+			t.Errorf("fetch %d = %s, want %s", i, urls[i], want[i])
+		}
+	}
+	if starts[4].Before(soon) {
+		t.Errorf("request fetched %v before its NotBefore time", soon.Sub(starts[4]))
+	}
+	for _, url := range want {
+		if result := results[url]; result.Err != nil || result.Page == nil || result.Page.URL != url {
+			t.Errorf("result of %s = %+v", url, result)
+		}
+	}
+}
+
+func TestQueue_HostDelay(t *testing.T) {
+	fetch, fetched := recordingFetch()
+	delay := 30 * time.Millisecond
+	q := newQueue(QueueOptions{Concurrency: 4, PerHostConcurrency: 4, HostDelay: delay}, fetch)
+	runQueue(t, q, []FetchRequest{
+		{URL: "https://a.example.com/1"},
+		{URL: "https://a.example.com/2"},
+		{URL: "https://a.example.com/3"},
+		{URL: "https://b.example.com/1"},
+	})
+
+	urls, starts := fetched()
+	var last time.Time
+	for i, url := range urls {
+		if urlHost(url) != "a.example.com" {
+			continue
+		}
+		if !last.IsZero() && starts[i].Sub(last) < delay {
+			t.Errorf("%s started %v after the previous request to its host, want at least %v", url, starts[i].Sub(last), delay)
+		}
+		last = starts[i]
+	}
+	// The other host isn't held back by the delay of the first one
+	if len(urls) != 4 || urls[2] == "https://b.example.com/1" || urls[3] == "https://b.example.com/1" {
+		t.Errorf("fetched %v, want b.example.com among the first two", urls)
+	}
+}
+
+func TestQueue_Close(t *testing.T) {
+	fetch, fetched := recordingFetch()
+	q := newQueue(QueueOptions{}, fetch)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var result FetchResult
+	q.Enqueue(FetchRequest{URL: "https://example.com/waiting", Done: func(r FetchResult) { result = r }})
+	if q.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", q.Len())
+	}
+	q.Run(ctx)
+	if !errors.Is(result.Err, context.Canceled) {
+		t.Errorf("waiting request error = %v, want %v", result.Err, context.Canceled)
+	}
+
+	q.Enqueue(FetchRequest{URL: "https://example.com/late", Done: func(r FetchResult) { result = r }})
+	if !errors.Is(result.Err, ErrQueueClosed) || result.URL != "https://example.com/late" {
+		t.Errorf("request enqueued after Run error = %v, want %v", result.Err, ErrQueueClosed)
+	}
+	if urls, _ := fetched(); len(urls) != 0 {
+		t.Errorf("fetched %v after the context was done", urls)
+	}
+}
+
+func TestQueue_RequestContext(t *testing.T) {
+	fetch, fetched := recordingFetch()
+	delay := time.Hour
+	q := newQueue(QueueOptions{Concurrency: 1}, fetch)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The second request is held back by its own host delay until its context is cancelled
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		cancel()
+	}()
+	results := runQueue(t, q, []FetchRequest{
+		{URL: "https://a.example.com/1", Options: Options{HostDelay: delay}},
+		{URL: "https://a.example.com/2", Options: Options{HostDelay: delay}, Context: ctx},
+	})
+
+	if urls, _ := fetched(); len(urls) != 1 || urls[0] != "https://a.example.com/1" {
+		t.Errorf("fetched %v, want only the first request", urls)
+	}
+	if err := results["https://a.example.com/2"].Err; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled request error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,176 @@
+package fetcher
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+
+	"github.com/zeace/poisson/models"
+)
+
+const (
+	// minParagraphLength is the shortest paragraph text that counts towards the score of its
+	// ancestors. Shorter ones are usually captions, bylines or buttons.
+	minParagraphLength = 25
+	// siblingScoreShare is the share of the best candidate's score a sibling needs to be
+	// extracted with it, as when an article is split into several containers.
+	siblingScoreShare = 0.2
+	// minSiblingScore is the lowest score of an extracted sibling, whatever the best score.
+	minSiblingScore = 10
+	// classWeight is added to the score of a candidate whose class or id names content,
+	// and subtracted if it names page furniture.
+	classWeight = 25
+)
+
+// unlikelyCandidatePattern matches the id and class names of comment sections, related links,
+// share bars, ads and other blocks around an article.
+var unlikelyCandidatePattern = regexp.MustCompile(`(?i)(ad-break|agegate|banner|breadcrumb|combx|comment|community|disqus|extra|footer|header|menu|outbrain|pagination|pager|popup|promo|recommend|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|taboola|teaser)`)
+
+// maybeCandidatePattern matches id and class names that may hold the article even if they also
+// match unlikelyCandidatePattern, such as "article-header" or "main-column".
+var maybeCandidatePattern = regexp.MustCompile(`(?i)(article|body|column|content|entry|main|post|story)`)
+
+// positiveClassPattern and negativeClassPattern weigh the score of a candidate by its id and class.
+var (
+	positiveClassPattern = regexp.MustCompile(`(?i)(article|body|content|entry|h-?entry|main|page|post|text|blog|story)`)
+	negativeClassPattern = regexp.MustCompile(`(?i)(\bads?\b|advert|banner|combx|comment|com-|contact|foot|footnote|masthead|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|taboola|tool|widget)`)
+)
+
+// unlikelyElements are removed before scoring: they never hold article text.
+const unlikelyElements = "nav, aside, form, button, iframe, noscript, svg, dialog, " +
+	"[role=navigation], [role=complementary], [role=contentinfo], [role=dialog], [aria-hidden=true], [hidden]"
+
+// extractMainText returns the whitespace-normalized article text of doc with the method used: the
+// text found by readabilityText, or if it finds no paragraphs, the text of the main content
+// element (see mainText). It removes the blocks around the article from doc.
+func extractMainText(doc *goquery.Document) (string, models.ExtractionMethod) {
+	if text := readabilityText(doc); text != "" {
+		return text, models.ExtractionMethodReadability
+	}
+	return mainText(doc), models.ExtractionMethodHeuristic
+}
+
+// readabilityText extracts the article of doc like Mozilla's Readability does: after removing
+// navigation, comment sections, related links and similar blocks, the paragraphs of the page
+// give points to their parent and grandparent, and the highest-scoring element is taken with
+// the siblings that score almost as well. It returns "" if doc has no scoring paragraph.
+func readabilityText(doc *goquery.Document) string {
+	body := doc.Find("body")
+	removeUnlikelyCandidates(body)
+
+	scores := make(map[*html.Node]float64)
+	var candidates []*goquery.Selection
+	addScore := func(s *goquery.Selection, points float64) {
+		node := s.Get(0)
+		if node == nil || node.Type != html.ElementNode || node.Data == "html" {
+			return
+		}
+		if _, ok := scores[node]; !ok {
+			scores[node] = initialScore(s)
+			candidates = append(candidates, s)
+		}
+		scores[node] += points
+	}
+
+	// Divs without block children are paragraphs on many sites
+	body.Find("p, pre, td, blockquote, div:not(:has(p, div, section, article, table, ul, ol, blockquote, pre))").
+		Each(func(_ int, s *goquery.Selection) {
+			text := normalizedText(s)
+			if len(text) < minParagraphLength {
+				return
+			}
+			points := 1 + float64(strings.Count(text, ",")+strings.Count(text, "，")) + min(float64(len(text)/100), 3)
+			addScore(s.Parent(), points)
+			addScore(s.Parent().Parent(), points/2)
+		})
+
+	var top *goquery.Selection
+	topScore := 0.0
+	for _, candidate := range candidates {
+		node := candidate.Get(0)
+		scores[node] *= 1 - linkDensity(candidate)
+		if top == nil || scores[node] > topScore {
+			top, topScore = candidate, scores[node]
+		}
+	}
+	if top == nil {
+		return ""
+	}
+
+	// Keep the siblings that look like more of the article
+	threshold := max(minSiblingScore, topScore*siblingScoreShare)
+	topClass := top.AttrOr("class", "")
+	var parts []string
+	top.Parent().Children().Each(func(_ int, sibling *goquery.Selection) {
+		text := normalizedText(sibling)
+		if text == "" {
+			return
+		}
+		include := sibling.IsSelection(top)
+		if score, ok := scores[sibling.Get(0)]; !include && ok {
+			if topClass != "" && sibling.AttrOr("class", "") == topClass {
+				score += topScore * siblingScoreShare
+			}
+			include = score >= threshold
+		}
+		if !include && goquery.NodeName(sibling) == "p" {
+			density := linkDensity(sibling)
+			include = (len(text) > 80 && density < 0.25) ||
+				(density == 0 && strings.ContainsAny(text[len(text)-1:], ".!?"))
+		}
+		if include {
+			parts = append(parts, text)
+		}
+	})
+	return strings.Join(parts, " ")
+}
+
+// removeUnlikelyCandidates removes the elements of s that can't hold the article, and the
+// blocks whose id or class names page furniture rather than content.
+func removeUnlikelyCandidates(s *goquery.Selection) {
+	s.Find(unlikelyElements).Remove()
+	// Headers and footers of the page, not those of the article
+	s.Find("header, footer").Not("article header, main header").Remove()
+
+	s.Find("div, section, ul, ol, table, span, header, footer").Each(func(_ int, block *goquery.Selection) {
+		attrs := block.AttrOr("id", "") + " " + block.AttrOr("class", "")
+		if unlikelyCandidatePattern.MatchString(attrs) && !maybeCandidatePattern.MatchString(attrs) {
+			block.Remove()
+		}
+	})
+}
+
+// initialScore returns the score of a candidate before its paragraphs are counted, from its tag
+// name, id and class.
+func initialScore(s *goquery.Selection) float64 {
+	var score float64
+	switch goquery.NodeName(s) {
+	case "div", "article", "main", "section":
+		score = 5
+	case "pre", "td", "blockquote":
+		score = 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score = -3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score = -5
+	}
+	for _, attr := range []string{s.AttrOr("id", ""), s.AttrOr("class", "")} {
+		if attr == "" {
+			continue
+		}
+		if positiveClassPattern.MatchString(attr) {
+			score += classWeight
+		}
+		if negativeClassPattern.MatchString(attr) {
+			score -= classWeight
+		}
+	}
+	return score
+}
+
+// normalizedText returns the text of s with its whitespace collapsed.
+func normalizedText(s *goquery.Selection) string {
+	return strings.Join(strings.Fields(s.Text()), " ")
+}
@@ -0,0 +1,98 @@
+package fetcher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/zeace/poisson/models"
+)
+
+func TestExtractMainText(t *testing.T) {
+	tests := []struct {
+		name       string
+		html       string
+		wantMethod models.ExtractionMethod
+		keep       []string
+		removed    []string
+	}{
+		{
+			name: "article among page furniture",
+			html: `<body>
+				<header class="site-header"><a href="/">Example News</a> The best news in town, every day of the week.</header>
+				<div class="content-wrapper">
+					<div class="story-body">
+						<p>The mayor announced on Tuesday that the city would build a new bridge over the river.</p>
+						<p>Construction is expected to start next spring, and the bridge should open in three years.</p>
+						<p>Residents, who have long complained about traffic, welcomed the news.</p>
+					</div>
+					<div class="related-stories">
+						<p>Read more: the old bridge, built in 1920, was closed for repairs last year.</p>
+					</div>
+					<section id="comments">
+						<p>Great news, finally something is being done about the traffic in our town!</p>
+					</section>
+				</div>
+				<footer>Copyright 2024 Example News. All rights reserved. Contact us or read our privacy policy.</footer>
+			</body>`,
+			wantMethod: models.ExtractionMethodReadability,
+			keep:       []string{"The mayor announced", "Construction is expected", "Residents, who have long complained"},
+			removed:    []string{"best news in town", "Read more", "Great news", "All rights reserved"},
+		},
+		{
+			name: "div without paragraphs",
+			html: `<body>
+				<nav>Home · World · Sport · Weather · Culture · Opinion · Newsletters</nav>
+				<div class="article-text">
+					<div>The council voted on Monday, after a long debate, to close the library on Sundays.</div>
+					<div>The decision, which saves 20,000 euros a year, was criticized by the opposition.</div>
+				</div>
+			</body>`,
+			wantMethod: models.ExtractionMethodReadability,
+			keep:       []string{"The council voted", "The decision, which saves"},
+			removed:    []string{"Newsletters"},
+		},
+		{
+			name: "article split into sibling containers",
+			html: `<body>
+				<div class="post">
+					<div class="part"><p>The first half of the story, with several clauses, commas, and details.</p><p>More of the first half, which continues the story, is here.</p></div>
+					<div class="part"><p>The second half of the story, also with clauses, commas, and details.</p></div>
+				</div>
+			</body>`,
+			wantMethod: models.ExtractionMethodReadability,
+			keep:       []string{"The first half", "The second half"},
+		},
+		{
+			name:       "no paragraphs falls back to the main element",
+			html:       `<body><div>Menu</div><main><h1>Short</h1><p>Too short.</p></main></body>`,
+			wantMethod: models.ExtractionMethodHeuristic,
+			keep:       []string{"Too short."},
+			removed:    []string{"Menu"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("failed to parse HTML: %v", err)
+			}
+			text, method := extractMainText(doc)
+			if method != tt.wantMethod {
+				t.Errorf("method = %q, want %q", method, tt.wantMethod)
+			}
+			for _, want := range tt.keep {
+				if !strings.Contains(text, want) {
+					t.Errorf("expected %q in %q", want, text)
+				}
+			}
+			for _, unwanted := range tt.removed {
+				if strings.Contains(text, unwanted) {
+					t.Errorf("expected %q to be removed from %q", unwanted, text)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// DefaultRenderThreshold is the number of characters of article text below which a page
+	// is rendered in a browser, when a Renderer is set.
+	DefaultRenderThreshold = 500
+	// defaultVirtualTimeBudget is how long page scripts run before the rendered DOM is read.
+	defaultVirtualTimeBudget = 5 * time.Second
+	// renderTimeout bounds one browser run, including its startup.
+	renderTimeout = 30 * time.Second
+)
+
+// chromeBinaries are the names under which Chrome or Chromium is looked up in PATH.
+var chromeBinaries = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome", "headless-shell"}
+
+// Renderer loads pages in a browser, for sites whose articles are only built by JavaScript.
+type Renderer interface {
+	// Render returns the HTML of the page at url once its scripts have run.
+	Render(ctx context.Context, url string) ([]byte, error)
+}
+
+// ChromeRenderer renders pages with a headless Chrome or Chromium binary, which dumps the
+// DOM of each page after its scripts ran. Credentials are not sent with rendered requests.
+type ChromeRenderer struct {
+	// Path is the browser binary.
+	Path string
+	// AllowPrivateAddresses lets rendered pages load resources from private, loopback and
+	// link-local addresses. Otherwise the browser sends its requests through a local proxy
+	// refusing them.
+	AllowPrivateAddresses bool
+	// NoSandbox runs the browser without Chrome's sandbox, for containers that don't allow the
+	// namespaces it needs. The sandbox is always off when running as root, where Chrome doesn't
+	// start with it.
+	NoSandbox bool
+	// VirtualTimeBudget is how long page scripts run in virtual time before the DOM is read.
+	// Zero means 5 seconds.
+	VirtualTimeBudget time.Duration
+	// MaxDOMSize is the size in bytes above which a dumped DOM is abandoned and the browser
+	// stopped. Zero means DefaultMaxBodySize.
+	MaxDOMSize int64
+}
+
+// NewChromeRenderer returns a renderer using the browser at path, or if path is empty, the
+// first Chrome or Chromium binary found in PATH.
+func NewChromeRenderer(path string) (*ChromeRenderer, error) {
+	if path == "" {
+		for _, name := range chromeBinaries {
+			if found, err := exec.LookPath(name); err == nil {
+				path = found
+				break
+			}
+		}
+		if path == "" {
+			return nil, fmt.Errorf("no Chrome or Chromium browser found in PATH (tried %s)", strings.Join(chromeBinaries, ", "))
+		}
+	} else if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("browser not found: %w", err)
+	}
+	return &ChromeRenderer{Path: path}, nil
+}
+
+// Render runs the browser on url and returns the DOM it dumps.
+func (r *ChromeRenderer) Render(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, renderTimeout)
+	defer cancel()
+
+	// Each run gets its own profile, so that concurrent renders don't share a profile lock
+	profileDir, err := os.MkdirTemp("", "poisson-chrome-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating browser profile: %w", err)
+	}
+	defer os.RemoveAll(profileDir)
+	proxy, err := r.startProxy()
+	if err != nil {
+		return nil, fmt.Errorf("error rendering page: %w", err)
+	}
+	defer proxy.Close()
+
+	maxSize := r.MaxDOMSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBodySize
+	}
+	stdout := &cappedBuffer{max: maxSize, exceeded: cancel}
+	args := append(r.args(profileDir, proxy), "--dump-dom", url)
+	err = r.run(ctx, args, stdout)
+	if stdout.over {
+		return nil, fmt.Errorf("error rendering page: %w: more than %d bytes", ErrBodyTooLarge, maxSize)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error rendering page: %w", err)
+	}
+	if stdout.buf.Len() == 0 {
+		return nil, fmt.Errorf("error rendering page: browser returned no DOM")
+	}
+	return stdout.buf.Bytes(), nil
+}
+
+// cappedBuffer is a buffer of up to max bytes. The bytes written past them are dropped, and
+// exceeded is called once. The buffer isn't embedded, since its ReadFrom would bypass Write.
+type cappedBuffer struct {
+	buf      bytes.Buffer
+	max      int64
+	exceeded func()
+	over     bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if !b.over && int64(b.buf.Len()+len(p)) > b.max {
+		b.over = true
+		b.exceeded()
+	}
+	if b.over {
+		return len(p), nil // Drained until the browser is stopped
+	}
+	return b.buf.Write(p)
+}
+
+// startProxy starts the guard proxy of a browser run, or returns nil if private addresses are
+// allowed.
+func (r *ChromeRenderer) startProxy() (*guardProxy, error) {
+	if r.AllowPrivateAddresses {
+		return nil, nil
+	}
+	proxy, err := startGuardProxy()
+	if err != nil {
+		return nil, fmt.Errorf("error starting browser proxy: %w", err)
+	}
+	return proxy, nil
+}
+
+// args returns the arguments of a headless browser run with the profile in profileDir, sending
+// its requests through proxy if it isn't nil.
+func (r *ChromeRenderer) args(profileDir string, proxy *guardProxy) []string {
+	budget := r.VirtualTimeBudget
+	if budget <= 0 {
+		budget = defaultVirtualTimeBudget
+	}
+	args := []string{
+		"--headless=new",
+		"--disable-gpu",
+		"--no-first-run",
+		"--mute-audio",
+		"--user-data-dir=" + profileDir,
+		"--user-agent=" + userAgent,
+		fmt.Sprintf("--virtual-time-budget=%d", budget.Milliseconds()),
+	}
+	if r.NoSandbox || os.Geteuid() == 0 {
+		args = append(args, "--no-sandbox")
+	}
+	if proxy != nil {
+		// Loopback requests bypass proxies unless <-loopback> is listed, and WebRTC would
+		// send UDP around the proxy
+		args = append(args, "--proxy-server="+proxy.URL(), "--proxy-bypass-list=<-loopback>",
+			"--force-webrtc-ip-handling-policy=disable_non_proxied_udp")
+	}
+	return args
+}
+
+// run runs the browser with args, writing its output to stdout. The error of a failed run ends
+// with the last lines the browser logged.
+func (r *ChromeRenderer) run(ctx context.Context, args []string, stdout io.Writer) error {
+	cmd := exec.CommandContext(ctx, r.Path, args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if len(message) > 200 {
+			message = message[len(message)-200:]
+		}
+		return fmt.Errorf("%w: %s", err, message)
+	}
+	return nil
+}
+
+// articleTextLength returns the length of the article text of the HTML body as it would be
+// extracted without a browser: the JSON-LD article body if opts prefers it, or the text found by
+// extractMainText.
+func articleTextLength(body []byte, opts Options) int {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return 0
+	}
+	if opts.StructuredData != StructuredDataIgnore {
+		if article, _ := extractJSONLDArticle(doc); article.Body != "" {
+			return len(article.Body)
+		}
+	}
+	doc.Find("script, style").Remove()
+	removeBoilerplate(doc)
+	text, _ := extractMainText(doc)
+	return len(text)
+}
+
+// renderThreshold returns the text length below which pages are rendered under opts.
+func renderThreshold(opts Options) int {
+	if opts.RenderThreshold > 0 {
+		return opts.RenderThreshold
+	}
+	return DefaultRenderThreshold
+}
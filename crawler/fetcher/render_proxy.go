@@ -0,0 +1,103 @@
+package fetcher
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"time"
+)
+
+// guardProxy is a local HTTP proxy the browser of a ChromeRenderer sends its requests through,
+// refusing those to private, loopback and link-local addresses as NewHTTPClient does: pages
+// rendered in a browser load subresources, follow redirects and run scripts that could otherwise
+// reach the internal network.
+type guardProxy struct {
+	listener net.Listener
+	server   *http.Server
+	forward  *httputil.ReverseProxy
+	dialer   *net.Dialer
+}
+
+// startGuardProxy starts a guard proxy on a random loopback port.
+func startGuardProxy() (*guardProxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	p := &guardProxy{
+		listener: listener,
+		forward: &httputil.ReverseProxy{
+			Rewrite:   func(r *httputil.ProxyRequest) {}, // Proxied requests carry their absolute URL
+			Transport: defaultTransport(),
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+			},
+		},
+		dialer: &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: checkAddress},
+	}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: 10 * time.Second}
+	go p.server.Serve(listener)
+	return p, nil
+}
+
+// URL returns the address of the proxy, for --proxy-server.
+func (p *guardProxy) URL() string {
+	return "http://" + p.listener.Addr().String()
+}
+
+// Close stops the proxy. It can be called on a nil proxy.
+func (p *guardProxy) Close() error {
+	if p == nil {
+		return nil
+	}
+	return p.server.Close()
+}
+
+func (p *guardProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "proxy requests need an absolute URL", http.StatusBadRequest)
+		return
+	}
+	p.forward.ServeHTTP(w, r)
+}
+
+// tunnel connects to the host of a CONNECT request, if its address isn't blocked, and copies
+// the bytes of the HTTPS connection the browser opens through it both ways.
+func (p *guardProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := p.dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "proxy connections can't be hijacked", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		client.Close()
+		upstream.Close()
+		return
+	}
+
+	// The browser is killed at the end of its run, which ends both copies
+	go func() {
+		io.Copy(upstream, buffered)
+		upstream.Close()
+	}()
+	go func() {
+		io.Copy(client, upstream)
+		client.Close()
+	}()
+}
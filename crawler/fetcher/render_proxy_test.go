@@ -0,0 +1,44 @@
+package fetcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestGuardProxy(t *testing.T) {
+	proxy, err := startGuardProxy()
+	if err != nil {
+		t.Fatalf("startGuardProxy() error = %v", err)
+	}
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("internal")) })
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	tls := httptest.NewTLSServer(handler)
+	defer tls.Close()
+
+	// Both a plain request and an HTTPS tunnel to a loopback server are refused
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	resp, err := client.Get(plain.URL)
+	if err != nil {
+		t.Fatalf("Get() through the proxy error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("plain request to a loopback address answered %d, want %d", resp.StatusCode, http.StatusBadGateway)
+	}
+
+	tlsTransport := tls.Client().Transport.(*http.Transport).Clone()
+	tlsTransport.Proxy = http.ProxyURL(proxyURL)
+	if resp, err := (&http.Client{Transport: tlsTransport}).Get(tls.URL); err == nil {
+		resp.Body.Close()
+		t.Error("tunnel to a loopback address expected an error")
+	}
+}
@@ -0,0 +1,145 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+)
+
+// fakeRenderer returns html for every page, or err, and counts its calls.
+type fakeRenderer struct {
+	html  string
+	err   error
+	calls int
+}
+
+func (r *fakeRenderer) Render(ctx context.Context, url string) ([]byte, error) {
+	r.calls++
+	return []byte(r.html), r.err
+}
+
+func TestFetchArticleContent_Render(t *testing.T) {
+	const shell = `<html><head><title>App</title></head><body><div id="root">Loading...</div></body></html>`
+	article := "<html><head><title>App</title></head><body><main><p>" +
+		strings.Repeat("The article built by scripts. ", 30) + "</p></main></body></html>"
+
+	tests := []struct {
+		name         string
+		html         string
+		renderer     *fakeRenderer
+		wantCalls    int
+		wantRendered bool
+	}{
+		{"thin page is rendered", shell, &fakeRenderer{html: article}, 1, true},
+		{"long page is not rendered", article, &fakeRenderer{html: article}, 0, false},
+		{"render error keeps the fetched HTML", shell, &fakeRenderer{err: errors.New("browser crashed")}, 1, false},
+		{"thinner rendering is ignored", shell, &fakeRenderer{html: "<html><body></body></html>"}, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.html))
+			}))
+			defer server.Close()
+
+			mockDS := lib.NewMockDatastoreClient()
+			var cacheWriter bytes.Buffer
+			page, _, err := fetchArticleContent(context.Background(), lib.NormalizeURL(server.URL), false, mockDS,
+				&http.Client{Timeout: 5 * time.Second}, &cacheWriter, "/test/cache/path", Options{Renderer: tt.renderer})
+			if err != nil {
+				t.Fatalf("fetchArticleContent() error = %v", err)
+			}
+			if tt.renderer.calls != tt.wantCalls {
+				t.Errorf("renderer called %d times, want %d", tt.renderer.calls, tt.wantCalls)
+			}
+			if page.Rendered != tt.wantRendered {
+				t.Errorf("Rendered = %v, want %v", page.Rendered, tt.wantRendered)
+			}
+			if tt.wantRendered && !strings.Contains(page.Content, "The article built by scripts.") {
+				t.Errorf("Content = %q, want the rendered article", page.Content)
+			}
+		})
+	}
+}
+
+func TestArticleTextLength(t *testing.T) {
+	jsonLD := `<html><head><script type="application/ld+json">{"@type":"NewsArticle","articleBody":"Body from JSON-LD"}</script></head><body></body></html>`
+	tests := []struct {
+		name string
+		html string
+		opts Options
+		want int
+	}{
+		{"main content", `<html><body><nav>Menu</nav><main> Some   text </main></body></html>`, Options{}, len("Some text")},
+		{"scripts are not text", `<html><body><script>var x = 1;</script></body></html>`, Options{}, 0},
+		{"JSON-LD body", jsonLD, Options{}, len("Body from JSON-LD")},
+		{"JSON-LD ignored", jsonLD, Options{StructuredData: StructuredDataIgnore}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := articleTextLength([]byte(tt.html), tt.opts); got != tt.want {
+				t.Errorf("articleTextLength() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChromeRenderer(t *testing.T) {
+	// A fake browser printing its arguments in the dumped DOM
+	browser := filepath.Join(t.TempDir(), "chrome")
+	script := "#!/bin/sh\n" +
+		"for arg in \"$@\"; do case \"$arg\" in --screenshot=*) printf PNG > \"${arg#--screenshot=}\";; esac; done\n" +
+		"echo \"<html><body>$*</body></html>\"\n"
+	if err := os.WriteFile(browser, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	renderer, err := NewChromeRenderer(browser)
+	if err != nil {
+		t.Fatalf("NewChromeRenderer() error = %v", err)
+	}
+	dom, err := renderer.Render(context.Background(), "https://example.com/app")
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	for _, want := range []string{"--headless=new", "--dump-dom", "--virtual-time-budget=5000", "--proxy-server=http://127.0.0.1:", "https://example.com/app"} {
+		if !strings.Contains(string(dom), want) {
+			t.Errorf("browser arguments %q missing %s", dom, want)
+		}
+	}
+	// The sandbox is only turned off as root or on request
+	if sandboxOff := strings.Contains(string(dom), "--no-sandbox"); sandboxOff != (os.Geteuid() == 0) {
+		t.Errorf("browser arguments %q: --no-sandbox is %v as uid %d", dom, sandboxOff, os.Geteuid())
+	}
+	renderer.NoSandbox = true
+	if dom, err := renderer.Render(context.Background(), "https://example.com/app"); err != nil || !strings.Contains(string(dom), "--no-sandbox") {
+		t.Errorf("Render() with NoSandbox = %q, %v, want --no-sandbox", dom, err)
+	}
+	renderer.NoSandbox = false
+
+	// DOMs larger than MaxDOMSize are abandoned
+	renderer.MaxDOMSize = 16
+	if _, err := renderer.Render(context.Background(), "https://example.com/app"); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("Render() of a large DOM error = %v, want %v", err, ErrBodyTooLarge)
+	}
+	renderer.MaxDOMSize = 0
+
+	png, err := renderer.Screenshot(context.Background(), "https://example.com/app")
+	if err != nil || string(png) != "PNG" {
+		t.Errorf("Screenshot() = %q, %v, want the image written by the browser", png, err)
+	}
+
+	if _, err := NewChromeRenderer(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("NewChromeRenderer() of a missing binary expected an error")
+	}
+}
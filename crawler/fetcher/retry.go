@@ -0,0 +1,165 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultRetryAttempts is the default number of attempts at fetching a page.
+	DefaultRetryAttempts = 3
+	// DefaultRetryDelay is the default wait before the second attempt, doubled before each other one.
+	DefaultRetryDelay = time.Second
+	// maxRetryDelay bounds the wait between two attempts, including the one a server asks for
+	// in Retry-After.
+	maxRetryDelay = 30 * time.Second
+	// DefaultMaxBodySize is the default maximum size in bytes of a response body.
+	DefaultMaxBodySize = 5 << 20
+)
+
+// ErrBodyTooLarge is returned for responses whose body is larger than Options.MaxBodySize.
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// transientStatusCodes are the HTTP statuses of overloaded or briefly unavailable servers,
+// worth another attempt.
+var transientStatusCodes = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// fetchWithRetry sends req with httpClient and reads the response body, retrying timeouts,
+// reset connections and transient status codes up to opts.RetryAttempts attempts in all, with
+// exponential backoff from opts.RetryDelay or the delay the server asks for in Retry-After.
+// The last response is returned with its body read and closed, whatever its status.
+func fetchWithRetry(ctx context.Context, httpClient *http.Client, req *http.Request, opts Options, verbose bool) (*http.Response, []byte, error) {
+	attempts := opts.RetryAttempts
+	if attempts <= 0 {
+		attempts = DefaultRetryAttempts
+	}
+	delay := opts.RetryDelay
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, body, err := fetchOnce(httpClient, req, opts.maxBodySize())
+		wait := retryWait(delay, attempt)
+		switch {
+		case err != nil && (attempt == attempts || !isTransientError(ctx, err)):
+			return nil, nil, err
+		case err == nil && (attempt == attempts || !transientStatusCodes[resp.StatusCode]):
+			return resp, body, nil
+		case err == nil:
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = retryAfter
+			}
+		}
+
+		if verbose {
+			slog.InfoContext(ctx, "Retrying fetch", "attempt", attempt+1, "wait", wait, "reason", retryReason(resp, err))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, fmt.Errorf("error fetching URL: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// fetchOnce sends req and reads the response body, decoded from its Content-Encoding (see
+// decodeBody). It fails with ErrBodyTooLarge without reading the rest of the body once it is
+// larger than maxSize bytes decoded, or right away if the response declares a larger
+// Content-Length.
+func fetchOnce(httpClient *http.Client, req *http.Request, maxSize int64) (*http.Response, []byte, error) {
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error fetching URL: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.ContentLength > maxSize {
+		return nil, nil, fmt.Errorf("%w: %d bytes declared, limit is %d", ErrBodyTooLarge, resp.ContentLength, maxSize)
+	}
+	decoded, err := decodeBody(resp, resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := io.ReadAll(io.LimitReader(decoded, maxSize+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading response: %w", err)
+	}
+	if int64(len(body)) > maxSize {
+		return nil, nil, fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, maxSize)
+	}
+	return resp, body, nil
+}
+
+// maxBodySize returns the maximum size in bytes of the response bodies of o.
+func (o Options) maxBodySize() int64 {
+	if o.MaxBodySize <= 0 {
+		return DefaultMaxBodySize
+	}
+	return o.MaxBodySize
+}
+
+// isTransientError reports whether err is a timeout or a reset connection worth another
+// attempt. Errors after ctx is done are not.
+func isTransientError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var netErr net.Error
+	return (errors.As(err, &netErr) && netErr.Timeout()) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryWait returns the wait after the given failed attempt: delay doubled for each attempt
+// after the first, capped at maxRetryDelay, with up to half of it taken off at random so that
+// the pages of an overloaded host aren't all fetched again at once.
+func retryWait(delay time.Duration, attempt int) time.Duration {
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxRetryDelay)
+	return delay - time.Duration(rand.Int64N(int64(delay)/2+1))
+}
+
+// parseRetryAfter parses a Retry-After header, in seconds or as an HTTP date, capped at
+// maxRetryDelay. It returns false if the header is missing or invalid.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		wait = time.Until(date)
+	} else {
+		return 0, false
+	}
+	return min(max(wait, 0), maxRetryDelay), true
+}
+
+// retryReason describes why an attempt failed, for logs.
+func retryReason(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return "status " + strconv.Itoa(resp.StatusCode)
+}
@@ -0,0 +1,187 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+)
+
+func TestFetchArticleContent_Retry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		attempts     int
+		wantRequests int32
+		wantErr      string
+	}{
+		{
+			name:         "transient failures then success",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			wantRequests: 3,
+		},
+		{
+			name:         "gives up after the attempts",
+			statuses:     []int{http.StatusBadGateway, http.StatusGatewayTimeout, http.StatusBadGateway, http.StatusOK},
+			wantRequests: 3,
+			wantErr:      "unexpected status code: 502",
+		},
+		{
+			name:         "configured attempts",
+			statuses:     []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK},
+			attempts:     4,
+			wantRequests: 4,
+		},
+		{
+			name:         "permanent failure is not retried",
+			statuses:     []int{http.StatusNotFound, http.StatusOK},
+			wantRequests: 1,
+			wantErr:      "unexpected status code: 404",
+		},
+		{
+			name:         "retries disabled",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusOK},
+			attempts:     1,
+			wantRequests: 1,
+			wantErr:      "unexpected status code: 503",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[requests.Add(1)-1]
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					w.Write([]byte(`<html><head><title>Back</title></head><body><p>The server is back.</p></body></html>`))
+				}
+			}))
+			defer server.Close()
+
+			var cacheWriter bytes.Buffer
+			opts := Options{RetryAttempts: tt.attempts, RetryDelay: time.Millisecond}
+			page, _, err := fetchArticleContent(context.Background(), lib.NormalizeURL(server.URL), false,
+				lib.NewMockDatastoreClient(), &http.Client{Timeout: 5 * time.Second}, &cacheWriter, "/test/cache/path", opts)
+
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("server got %d request(s), want %d", got, tt.wantRequests)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("fetchArticleContent() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetchArticleContent() error = %v", err)
+			}
+			if !strings.Contains(page.Content, "The server is back.") {
+				t.Errorf("unexpected content %q", page.Content)
+			}
+		})
+	}
+}
+
+func TestFetchArticleContent_RetryTimeout(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte(`<html><body><p>Slow at first.</p></body></html>`))
+	}))
+	defer server.Close()
+
+	var cacheWriter bytes.Buffer
+	page, _, err := fetchArticleContent(context.Background(), lib.NormalizeURL(server.URL), false, lib.NewMockDatastoreClient(),
+		&http.Client{Timeout: 50 * time.Millisecond}, &cacheWriter, "/test/cache/path", Options{RetryDelay: time.Millisecond})
+	if err != nil {
+		t.Fatalf("fetchArticleContent() error = %v", err)
+	}
+	if requests.Load() != 2 || !strings.Contains(page.Content, "Slow at first.") {
+		t.Errorf("got %d request(s) and content %q, want a second attempt", requests.Load(), page.Content)
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{3, 2 * time.Second, 4 * time.Second},
+		{10, maxRetryDelay / 2, maxRetryDelay},
+	}
+	for _, tt := range tests {
+		if got := retryWait(time.Second, tt.attempt); got < tt.min || got > tt.max {
+			t.Errorf("retryWait(1s, %d) = %v, want between %v and %v", tt.attempt, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"2", 2 * time.Second, true},
+		{"3600", maxRetryDelay, true},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0, true}, // In the past
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestFetchWithRetry_MaxBodySize(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			// No Content-Length: the limit is only reached while reading
+			w.Write([]byte(body[:50]))
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		maxSize int64
+		wantErr bool
+	}{
+		{"under the limit", "/", 100, false},
+		{"declared over the limit", "/", 99, true},
+		{"read over the limit", "/chunked", 100, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", server.URL+tt.path, nil)
+			_, got, err := fetchWithRetry(context.Background(), server.Client(), req, Options{MaxBodySize: tt.maxSize, RetryAttempts: 1}, false)
+			if tt.wantErr {
+				if !errors.Is(err, ErrBodyTooLarge) {
+					t.Errorf("fetchWithRetry() error = %v, want ErrBodyTooLarge", err)
+				}
+				return
+			}
+			if err != nil || string(got) != body {
+				t.Errorf("fetchWithRetry() = %d bytes, %v, want the whole body", len(got), err)
+			}
+		})
+	}
+}
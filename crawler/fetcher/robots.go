@@ -0,0 +1,93 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/zeace/poisson/models"
+)
+
+// RobotsPolicy controls how pages carrying noindex/noai directives are handled.
+type RobotsPolicy string
+
+const (
+	// RobotsPolicyIgnore stores and analyzes pages regardless of their robots directives.
+	RobotsPolicyIgnore RobotsPolicy = "ignore"
+	// RobotsPolicyRespect skips storing and analyzing pages marked noindex or noai.
+	RobotsPolicyRespect RobotsPolicy = "respect"
+)
+
+// ParseRobotsPolicy converts a string to a RobotsPolicy.
+// An empty string returns RobotsPolicyIgnore.
+func ParseRobotsPolicy(policy string) (RobotsPolicy, error) {
+	switch RobotsPolicy(strings.ToLower(policy)) {
+	case "", RobotsPolicyIgnore:
+		return RobotsPolicyIgnore, nil
+	case RobotsPolicyRespect:
+		return RobotsPolicyRespect, nil
+	default:
+		return "", fmt.Errorf("unknown robots policy '%s' (valid: ignore, respect)", policy)
+	}
+}
+
+// robotsDirectives holds the robots directives relevant to the crawler.
+type robotsDirectives struct {
+	NoIndex bool
+	NoAI    bool
+}
+
+// parseRobotsDirectives reads robots directives from the X-Robots-Tag header and from
+// <meta name="robots"> (and similar crawler-specific) tags in the document.
+func parseRobotsDirectives(header http.Header, doc *goquery.Document) robotsDirectives {
+	var directives robotsDirectives
+
+	for _, value := range header.Values("X-Robots-Tag") {
+		directives.add(value)
+	}
+
+	doc.Find("meta[name]").Each(func(_ int, s *goquery.Selection) {
+		name := strings.ToLower(strings.TrimSpace(s.AttrOr("name", "")))
+		if name == "robots" || name == "googlebot" || name == "bingbot" {
+			directives.add(s.AttrOr("content", ""))
+		}
+	})
+
+	return directives
+}
+
+// add merges a comma-separated directive list into d.
+// Header values may be prefixed with a user agent (e.g. "googlebot: noindex"), which is ignored.
+func (d *robotsDirectives) add(value string) {
+	for _, directive := range strings.Split(value, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		if idx := strings.LastIndex(directive, ":"); idx != -1 {
+			directive = strings.TrimSpace(directive[idx+1:])
+		}
+		switch directive {
+		case "noindex", "none":
+			d.NoIndex = true
+		case "noai":
+			d.NoAI = true
+		}
+	}
+}
+
+// excluded reports whether a page with these directives should be skipped under the given policy.
+func (d robotsDirectives) excluded(policy RobotsPolicy) bool {
+	return policy == RobotsPolicyRespect && (d.NoIndex || d.NoAI)
+}
+
+// excludeStoredPage sets RobotsExcluded on a page read from Datastore from the directives
+// stored with it, as the page may have been stored under another policy, and reports whether
+// it is excluded.
+func excludeStoredPage(ctx context.Context, page *models.CrawledPage, opts Options, verbose bool) bool {
+	page.RobotsExcluded = robotsDirectives{NoIndex: page.NoIndex, NoAI: page.NoAI}.excluded(opts.RobotsPolicy)
+	if page.RobotsExcluded && verbose {
+		slog.InfoContext(ctx, "Skipping stored page excluded by robots directives", "noindex", page.NoIndex, "noai", page.NoAI)
+	}
+	return page.RobotsExcluded
+}
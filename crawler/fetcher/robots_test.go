@@ -0,0 +1,198 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestParseRobotsPolicy(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected RobotsPolicy
+		wantErr  bool
+	}{
+		{input: "", expected: RobotsPolicyIgnore},
+		{input: "ignore", expected: RobotsPolicyIgnore},
+		{input: "Respect", expected: RobotsPolicyRespect},
+		{input: "sometimes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			policy, err := ParseRobotsPolicy(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRobotsPolicy(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if policy != tt.expected {
+				t.Errorf("ParseRobotsPolicy(%q) = %q, want %q", tt.input, policy, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseRobotsDirectives(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		html     string
+		expected robotsDirectives
+	}{
+		{
+			name:     "no directives",
+			html:     `<html><head><meta name="description" content="noindex"></head></html>`,
+			expected: robotsDirectives{},
+		},
+		{
+			name:     "meta robots noindex",
+			html:     `<html><head><meta name="robots" content="noindex, follow"></head></html>`,
+			expected: robotsDirectives{NoIndex: true},
+		},
+		{
+			name:     "meta robots none",
+			html:     `<html><head><meta name="ROBOTS" content="NONE"></head></html>`,
+			expected: robotsDirectives{NoIndex: true},
+		},
+		{
+			name:     "meta robots noai",
+			html:     `<html><head><meta name="robots" content="noai, noimageai"></head></html>`,
+			expected: robotsDirectives{NoAI: true},
+		},
+		{
+			name:     "X-Robots-Tag header with user agent",
+			header:   http.Header{"X-Robots-Tag": []string{"googlebot: noindex", "noai"}},
+			html:     `<html></html>`,
+			expected: robotsDirectives{NoIndex: true, NoAI: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+			directives := parseRobotsDirectives(header, doc)
+			if directives != tt.expected {
+				t.Errorf("parseRobotsDirectives() = %+v, want %+v", directives, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFetchArticleContent_RobotsPolicy(t *testing.T) {
+	const htmlContent = `<!DOCTYPE html>
+<html>
+<head>
+	<title>Private Article</title>
+	<meta name="robots" content="noindex">
+</head>
+<body>
+	<main><p>Please do not index this.</p></main>
+</body>
+</html>`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(htmlContent))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		policy       RobotsPolicy
+		wantExcluded bool
+	}{
+		{name: "ignore stores the page", policy: RobotsPolicyIgnore, wantExcluded: false},
+		{name: "respect skips storage", policy: RobotsPolicyRespect, wantExcluded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			httpClient := &http.Client{Timeout: 5 * time.Second}
+			var cacheWriter bytes.Buffer
+			mockDS := lib.NewMockDatastoreClient()
+
+			normalizedURL := lib.NormalizeURL(server.URL)
+			page, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, "/test/cache/path", Options{RobotsPolicy: tt.policy})
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if !page.NoIndex {
+				t.Error("Expected NoIndex to be recorded on the page")
+			}
+			if page.RobotsExcluded != tt.wantExcluded {
+				t.Errorf("Expected RobotsExcluded = %v, got %v", tt.wantExcluded, page.RobotsExcluded)
+			}
+
+			stored, found, _ := mockDS.ReadCrawledPage(ctx, normalizedURL)
+			if found == tt.wantExcluded {
+				t.Errorf("Expected page stored = %v, got %v", !tt.wantExcluded, found)
+			}
+			if found && !stored.NoIndex {
+				t.Error("Expected NoIndex to be stored with the page")
+			}
+			if tt.wantExcluded && cacheWriter.Len() != 0 {
+				t.Error("Expected excluded page not to be written to the file cache")
+			}
+		})
+	}
+}
+
+func TestFetchArticleContent_RobotsPolicyStoredPage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		opts         Options
+		wantExcluded bool
+	}{
+		{name: "cached under ignore", opts: Options{RobotsPolicy: RobotsPolicyIgnore}},
+		{name: "cached under respect", opts: Options{RobotsPolicy: RobotsPolicyRespect}, wantExcluded: true},
+		{name: "revalidated under respect", opts: Options{RobotsPolicy: RobotsPolicyRespect, Revalidate: true}, wantExcluded: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			normalizedURL := lib.NormalizeURL(server.URL)
+			mockDS := lib.NewMockDatastoreClient()
+			// Stored under a policy recording the directives
+			if err := mockDS.SaveCrawledPage(ctx, &models.CrawledPage{
+				URL: normalizedURL, Title: "Private Article", Content: "Please do not train on this.", NoAI: true, ETag: `"v1"`,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			var cacheWriter bytes.Buffer
+			httpClient := &http.Client{Timeout: 5 * time.Second}
+			page, _, err := fetchArticleContent(ctx, normalizedURL, false, mockDS, httpClient, &cacheWriter, "/test/cache/path", tt.opts)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if page.RobotsExcluded != tt.wantExcluded {
+				t.Errorf("Expected RobotsExcluded = %v, got %v", tt.wantExcluded, page.RobotsExcluded)
+			}
+			if tt.wantExcluded == (cacheWriter.Len() != 0) {
+				t.Errorf("Expected file cache written = %v, got %v", !tt.wantExcluded, cacheWriter.Len() != 0)
+			}
+		})
+	}
+}
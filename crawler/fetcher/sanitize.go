@@ -0,0 +1,56 @@
+package fetcher
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// invisibleRunes are format characters that only break words and searches in stored text. The
+// zero-width joiners are kept: emoji sequences and some scripts need them.
+var invisibleRunes = map[rune]bool{
+	'\u00ad': true, // Soft hyphen
+	'\u200b': true, // Zero-width space
+	'\u2060': true, // Word joiner
+	'\ufeff': true, // Byte order mark
+}
+
+// boilerplatePhrasePatterns match the sharing prompts, advertisement markers and notices left in
+// article text by elements that removeBoilerplate can't tell from the article.
+var boilerplatePhrasePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bshare (this|the) (article|story|post)\b:?`),
+	regexp.MustCompile(`(?i)\b(click to )?share on (facebook|twitter|x|linkedin|whatsapp|reddit|email)( \(opens in new window\))?`),
+	regexp.MustCompile(`(?i)\b(story|article) continues below( this)? advertisement\b`),
+	regexp.MustCompile(`(?i)\b(scroll to continue with content|skip advertisement|continue reading the main story)\b`),
+	regexp.MustCompile(`\bADVERTISEMENT\b`),
+	regexp.MustCompile(`(?i)\bwe use cookies\b[^.!?]{0,300}[.!?]`),
+	regexp.MustCompile(`(?i)\bsign up for our (free )?newsletters?\b[.!]?`),
+}
+
+// sanitizeText cleans extracted article text before it is stored and sent to the LLM: it decodes
+// the HTML entities left in it (JSON-LD bodies and double-encoded pages carry some), normalizes
+// it to Unicode NFC, drops control and invisible characters, removes boilerplate phrases (see
+// boilerplatePhrasePatterns) and collapses whitespace.
+func sanitizeText(text string) string {
+	// Double-encoded entities such as &amp;#8217; take two passes
+	for i := 0; i < 2 && strings.Contains(text, "&"); i++ {
+		text = html.UnescapeString(text)
+	}
+	text = norm.NFC.String(text)
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r), invisibleRunes[r], r == unicode.ReplacementChar:
+			return -1
+		}
+		return r
+	}, text)
+	for _, pattern := range boilerplatePhrasePatterns {
+		text = pattern.ReplaceAllString(text, " ")
+	}
+	return strings.Join(strings.Fields(text), " ")
+}
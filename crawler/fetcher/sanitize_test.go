@@ -0,0 +1,30 @@
+package fetcher
+
+import "testing"
+
+func TestSanitizeText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"clean text", "Cats were elected to the council.", "Cats were elected to the council."},
+		{"entities", "Cats &amp; dogs &#8217;n&#x2019; mice", "Cats & dogs ’n’ mice"},
+		{"double-encoded entities", "The mayor&amp;#8217;s cat", "The mayor’s cat"},
+		{"control characters", "Cats\x00 were\x07 elected\r\n\tto the council.", "Cats were elected to the council."},
+		{"invisible characters", "elec\u00adted\u200b to the\ufeff council", "elected to the council"},
+		{"non-breaking spaces", "the\u00a0council", "the council"},
+		{"unicode normalization", "Cafe\u0301", "Caf\u00e9"},
+		{"sharing prompts", "Share this article: Cats were elected. Share on Facebook Share on X (opens in new window)", "Cats were elected."},
+		{"advertisements", "Cats were elected. ADVERTISEMENT Story continues below advertisement The mayor resigned.", "Cats were elected. The mayor resigned."},
+		{"cookie notices", "We use cookies to improve your experience. Cats were elected.", "Cats were elected."},
+		{"advertisement in a sentence", "The Advertisement of the year featured a cat.", "The Advertisement of the year featured a cat."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeText(tt.text); got != tt.want {
+				t.Errorf("sanitizeText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zeace/poisson/lib"
+)
+
+const (
+	// ScreenshotsDisk keeps the screenshots in files of the screenshots directory.
+	ScreenshotsDisk = "disk"
+	// screenshotDir is the directory of the disk screenshot store.
+	screenshotDir = "screenshots"
+	// screenshotWindowSize is the size of the browser window of screenshots, the top of an
+	// article on a desktop screen.
+	screenshotWindowSize = "1280,1024"
+)
+
+// Screenshotter is a Renderer that can also capture pages as images.
+type Screenshotter interface {
+	Renderer
+	// Screenshot returns a PNG image of the top of the page at url once its scripts have run.
+	Screenshot(ctx context.Context, url string) ([]byte, error)
+}
+
+// ScreenshotStore keeps the screenshots of fetched pages by normalized URL. Implementations must
+// be safe for concurrent use.
+type ScreenshotStore interface {
+	// Put stores png as the screenshot of the page at url, replacing the previous one, and
+	// returns where it is stored, such as a file path or a gs:// URL.
+	Put(ctx context.Context, url string, png []byte) (string, error)
+}
+
+// OpenScreenshotStore returns the screenshot store described by spec: "disk" for files in the
+// screenshots directory or a gs://bucket/prefix URL for objects in Cloud Storage. An empty spec
+// returns nil: no screenshots are taken.
+func OpenScreenshotStore(spec string) (ScreenshotStore, error) {
+	spec = strings.TrimSpace(spec)
+	switch {
+	case spec == "":
+		return nil, nil
+	case spec == ScreenshotsDisk:
+		return diskScreenshots{dir: screenshotDir}, nil
+	case strings.HasPrefix(spec, "gs://"):
+		bucket, prefix, err := lib.ParseGCSURL(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid screenshot store %q: %w", spec, err)
+		}
+		return gcsScreenshots{bucket: bucket, prefix: prefix}, nil
+	}
+	return nil, fmt.Errorf("invalid screenshot store %q (valid: %s or a gs://bucket/prefix URL)", spec, ScreenshotsDisk)
+}
+
+// screenshotName returns the name of the screenshot of url in a store.
+func screenshotName(url string) string {
+	return urlToCacheFilename(url) + ".png"
+}
+
+// diskScreenshots is a ScreenshotStore keeping the screenshots in files of dir.
+type diskScreenshots struct {
+	dir string
+}
+
+// Put writes png to the file of url.
+func (s diskScreenshots) Put(ctx context.Context, url string, png []byte) (string, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating screenshots directory: %w", err)
+	}
+	path := filepath.Join(s.dir, screenshotName(url))
+	if err := writeFileAtomically(path, png); err != nil {
+		return "", fmt.Errorf("error writing screenshot: %w", err)
+	}
+	return path, nil
+}
+
+// gcsScreenshots is a ScreenshotStore keeping the screenshots in Cloud Storage objects under
+// prefix.
+type gcsScreenshots struct {
+	bucket string
+	// prefix is empty or ends with a slash (see lib.ParseGCSURL).
+	prefix string
+}
+
+// Put uploads png to the object of url.
+func (s gcsScreenshots) Put(ctx context.Context, url string, png []byte) (string, error) {
+	object := s.prefix + screenshotName(url)
+	if err := lib.WriteGCSObject(ctx, s.bucket, object, png); err != nil {
+		return "", err
+	}
+	return "gs://" + s.bucket + "/" + object, nil
+}
+
+// captureScreenshot takes a screenshot of the page at fetchURL with the renderer of opts and
+// stores it as the screenshot of key, if opts has a screenshot store and a renderer that can take
+// screenshots. It returns where the screenshot is stored, or an empty string if none was taken: a
+// failed screenshot is logged, since the page stands on its own.
+func captureScreenshot(ctx context.Context, key, fetchURL string, opts Options, verbose bool) string {
+	screenshotter, ok := opts.Renderer.(Screenshotter)
+	if opts.Screenshots == nil || !ok {
+		return ""
+	}
+	if verbose {
+		slog.InfoContext(ctx, "Taking screenshot of page")
+	}
+	png, err := screenshotter.Screenshot(ctx, fetchURL)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to take screenshot of page", "error", err)
+		return ""
+	}
+	location, err := opts.Screenshots.Put(ctx, key, png)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to store screenshot of page", "error", err)
+		return ""
+	}
+	return location
+}
+
+// Screenshot runs the browser on url and returns the screenshot it writes.
+func (r *ChromeRenderer) Screenshot(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, renderTimeout)
+	defer cancel()
+
+	// The profile directory also receives the screenshot
+	profileDir, err := os.MkdirTemp("", "poisson-chrome-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating browser profile: %w", err)
+	}
+	defer os.RemoveAll(profileDir)
+	path := filepath.Join(profileDir, "screenshot.png")
+	proxy, err := r.startProxy()
+	if err != nil {
+		return nil, fmt.Errorf("error taking screenshot: %w", err)
+	}
+	defer proxy.Close()
+
+	args := r.args(profileDir, proxy)
+	args = append(args, "--hide-scrollbars", "--window-size="+screenshotWindowSize, "--screenshot="+path, url)
+	if err := r.run(ctx, args, nil); err != nil {
+		return nil, fmt.Errorf("error taking screenshot: %w", err)
+	}
+	png, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error taking screenshot: browser wrote no image: %w", err)
+	}
+	return png, nil
+}
@@ -0,0 +1,124 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+)
+
+func TestOpenScreenshotStore(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    ScreenshotStore
+		wantErr bool
+	}{
+		{spec: "", want: nil},
+		{spec: "disk", want: diskScreenshots{dir: screenshotDir}},
+		{spec: "gs://bucket/shots", want: gcsScreenshots{bucket: "bucket", prefix: "shots/"}},
+		{spec: "gs://", wantErr: true},
+		{spec: "memory", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := OpenScreenshotStore(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("OpenScreenshotStore(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("OpenScreenshotStore(%q) = %#v, want %#v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiskScreenshots(t *testing.T) {
+	store := diskScreenshots{dir: filepath.Join(t.TempDir(), "screenshots")}
+	path, err := store.Put(context.Background(), "example.com/article", []byte("PNG"))
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if filepath.Base(path) != screenshotName("example.com/article") {
+		t.Errorf("Put() = %s, want the file named after the URL", path)
+	}
+	if content, err := os.ReadFile(path); err != nil || string(content) != "PNG" {
+		t.Errorf("screenshot file = %q, %v, want the image", content, err)
+	}
+}
+
+// fakeScreenshotter is a fakeRenderer that also returns png, or screenshotErr, as screenshot.
+type fakeScreenshotter struct {
+	fakeRenderer
+	png           string
+	screenshotErr error
+	screenshots   int
+}
+
+func (s *fakeScreenshotter) Screenshot(ctx context.Context, url string) ([]byte, error) {
+	s.screenshots++
+	return []byte(s.png), s.screenshotErr
+}
+
+// memoryScreenshots is a ScreenshotStore keeping the screenshots in a map.
+type memoryScreenshots struct {
+	mu    sync.Mutex
+	shots map[string][]byte
+}
+
+func (s *memoryScreenshots) Put(ctx context.Context, url string, png []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shots[url] = png
+	return "memory:" + url, nil
+}
+
+func TestFetchArticleContent_Screenshot(t *testing.T) {
+	const article = `<html><head><title>Cats</title></head><body><main><p>Cats took every seat in parliament.</p></main></body></html>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(article))
+	}))
+	defer server.Close()
+	url := lib.NormalizeURL(server.URL)
+
+	tests := []struct {
+		name           string
+		renderer       Renderer
+		store          bool
+		wantScreenshot string
+	}{
+		{"screenshot stored", &fakeScreenshotter{png: "PNG"}, true, "memory:" + url},
+		{"no store", &fakeScreenshotter{png: "PNG"}, false, ""},
+		{"renderer without screenshots", &fakeRenderer{html: article}, true, ""},
+		{"failed screenshot", &fakeScreenshotter{screenshotErr: errors.New("browser crashed")}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryScreenshots{shots: make(map[string][]byte)}
+			opts := Options{Renderer: tt.renderer}
+			if tt.store {
+				opts.Screenshots = store
+			}
+			var cacheWriter bytes.Buffer
+			page, _, err := fetchArticleContent(context.Background(), url, false, lib.NewMockDatastoreClient(),
+				&http.Client{Timeout: 5 * time.Second}, &cacheWriter, "/test/cache/path", opts)
+			if err != nil {
+				t.Fatalf("fetchArticleContent() error = %v", err)
+			}
+			if page.Screenshot != tt.wantScreenshot {
+				t.Errorf("Screenshot = %q, want %q", page.Screenshot, tt.wantScreenshot)
+			}
+			if tt.wantScreenshot != "" && string(store.shots[url]) != "PNG" {
+				t.Errorf("stored screenshots = %v, want the screenshot of %s", store.shots, url)
+			}
+		})
+	}
+}
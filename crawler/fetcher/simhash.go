@@ -0,0 +1,38 @@
+package fetcher
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+)
+
+// simhash returns the 64-bit simhash of text, computed from its lowercased words. Texts
+// differing in a few words have simhashes differing in few bits.
+func simhash(text string) uint64 {
+	var weights [64]int
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		h := fnv.New64a()
+		h.Write([]byte(word))
+		sum := h.Sum64()
+		for bit := range weights {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var hash uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			hash |= 1 << bit
+		}
+	}
+	return hash
+}
+
+// hammingDistance returns the number of bits that differ between a and b.
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,27 @@
+package fetcher
+
+import "testing"
+
+func TestSimhash(t *testing.T) {
+	footer := "Copyright 2024 Example News. All rights reserved. Contact us or read our privacy policy."
+	tests := []struct {
+		name        string
+		a, b        string
+		maxDistance int
+		minDistance int
+	}{
+		{"identical", footer, footer, 0, 0},
+		{"case and spacing", footer, "COPYRIGHT 2024   Example News. All rights reserved. Contact us or read our privacy policy.", 0, 0},
+		{"one word changed", footer, "Copyright 2025 Example News. All rights reserved. Contact us or read our privacy policy.", maxSimhashDistance, 0},
+		{"unrelated", footer, "The mayor announced on Tuesday that the new bridge over the river will open next spring.", 64, maxSimhashDistance + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distance := hammingDistance(simhash(tt.a), simhash(tt.b))
+			if distance > tt.maxDistance || distance < tt.minDistance {
+				t.Errorf("distance = %d, want %d to %d", distance, tt.minDistance, tt.maxDistance)
+			}
+		})
+	}
+}
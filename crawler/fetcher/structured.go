@@ -0,0 +1,164 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// StructuredDataPolicy controls whether schema.org JSON-LD metadata is used to extract articles.
+type StructuredDataPolicy string
+
+const (
+	// StructuredDataPrefer uses the headline, body, publication date, author and image of a
+	// JSON-LD Article when present, and falls back to HTML heuristics for missing fields.
+	StructuredDataPrefer StructuredDataPolicy = "prefer"
+	// StructuredDataIgnore always extracts articles with HTML heuristics.
+	StructuredDataIgnore StructuredDataPolicy = "ignore"
+)
+
+// ParseStructuredDataPolicy converts a string to a StructuredDataPolicy.
+// An empty string returns StructuredDataPrefer.
+func ParseStructuredDataPolicy(policy string) (StructuredDataPolicy, error) {
+	switch StructuredDataPolicy(strings.ToLower(policy)) {
+	case "", StructuredDataPrefer:
+		return StructuredDataPrefer, nil
+	case StructuredDataIgnore:
+		return StructuredDataIgnore, nil
+	default:
+		return "", fmt.Errorf("unknown structured data policy '%s' (valid: prefer, ignore)", policy)
+	}
+}
+
+// jsonLDArticle holds the fields of a schema.org Article used by the crawler.
+// Fields missing from the JSON-LD are empty.
+type jsonLDArticle struct {
+	Headline      string
+	Body          string
+	DatePublished time.Time
+	Author        string
+	// Image is the URL of the article image, as written in the JSON-LD (possibly relative).
+	Image string
+}
+
+// extractJSONLDArticle returns the first schema.org Article (or subtype such as NewsArticle)
+// found in the <script type="application/ld+json"> elements of doc.
+// Scripts that fail to parse are skipped.
+func extractJSONLDArticle(doc *goquery.Document) (jsonLDArticle, bool) {
+	var article jsonLDArticle
+	found := false
+	doc.Find(`script[type="application/ld+json"]`).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		var data any
+		if err := json.Unmarshal([]byte(s.Text()), &data); err != nil {
+			return true
+		}
+		if object := findArticleObject(data); object != nil {
+			article = parseJSONLDArticle(object)
+			found = true
+		}
+		return !found
+	})
+	return article, found
+}
+
+// findArticleObject returns the first Article object in data, searching arrays and @graph lists.
+func findArticleObject(data any) map[string]any {
+	switch v := data.(type) {
+	case []any:
+		for _, item := range v {
+			if object := findArticleObject(item); object != nil {
+				return object
+			}
+		}
+	case map[string]any:
+		if isArticleType(v["@type"]) {
+			return v
+		}
+		if graph, ok := v["@graph"]; ok {
+			return findArticleObject(graph)
+		}
+	}
+	return nil
+}
+
+// isArticleType reports whether a JSON-LD @type value (a string or a list of strings)
+// names Article or one of its subtypes.
+func isArticleType(value any) bool {
+	switch v := value.(type) {
+	case string:
+		return v == "Article" || v == "BlogPosting" || strings.HasSuffix(v, "NewsArticle")
+	case []any:
+		for _, item := range v {
+			if isArticleType(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseJSONLDArticle reads the fields used by the crawler from a JSON-LD Article object.
+func parseJSONLDArticle(object map[string]any) jsonLDArticle {
+	var article jsonLDArticle
+	if headline, ok := object["headline"].(string); ok {
+		article.Headline = strings.TrimSpace(html.UnescapeString(headline))
+	}
+	if body, ok := object["articleBody"].(string); ok {
+		article.Body = strings.Join(strings.Fields(html.UnescapeString(body)), " ")
+	}
+	if date, ok := object["datePublished"].(string); ok {
+		article.DatePublished, _ = parsePublishedTime(date)
+	}
+	article.Author = strings.Join(authorNames(object["author"]), ", ")
+	article.Image = imageURL(object["image"])
+	return article
+}
+
+// imageURL returns the first URL in a JSON-LD image value, which may be a URL, an ImageObject,
+// or a list of either.
+func imageURL(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]any:
+		if url, ok := v["url"].(string); ok {
+			return strings.TrimSpace(url)
+		}
+		if url, ok := v["contentUrl"].(string); ok {
+			return strings.TrimSpace(url)
+		}
+	case []any:
+		for _, item := range v {
+			if url := imageURL(item); url != "" {
+				return url
+			}
+		}
+	}
+	return ""
+}
+
+// authorNames returns the names in a JSON-LD author value, which may be a name,
+// a Person or Organization object, or a list of either.
+func authorNames(value any) []string {
+	switch v := value.(type) {
+	case string:
+		if name := strings.TrimSpace(v); name != "" {
+			return []string{name}
+		}
+	case map[string]any:
+		if name, ok := v["name"].(string); ok && strings.TrimSpace(name) != "" {
+			return []string{strings.TrimSpace(name)}
+		}
+	case []any:
+		var names []string
+		for _, item := range v {
+			names = append(names, authorNames(item)...)
+		}
+		return names
+	}
+	return nil
+}
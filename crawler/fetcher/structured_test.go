@@ -0,0 +1,89 @@
+package fetcher
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestExtractJSONLDArticle(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		found    bool
+		expected jsonLDArticle
+	}{
+		{
+			name: "news article",
+			html: `<script type="application/ld+json">{"@context": "https://schema.org", "@type": "NewsArticle",
+				"headline": "Cats &amp; dogs", "articleBody": "  Cats and\n dogs agree. ",
+				"datePublished": "2024-04-01T08:30:00Z", "author": {"@type": "Person", "name": "Jane Doe"},
+				"image": [{"@type": "ImageObject", "url": "https://example.com/cat.jpg"}, "https://example.com/dog.jpg"]}</script>`,
+			found: true,
+			expected: jsonLDArticle{
+				Headline:      "Cats & dogs",
+				Body:          "Cats and dogs agree.",
+				DatePublished: time.Date(2024, 4, 1, 8, 30, 0, 0, time.UTC),
+				Author:        "Jane Doe",
+				Image:         "https://example.com/cat.jpg",
+			},
+		},
+		{
+			name: "article in graph after invalid script",
+			html: `<script type="application/ld+json">{not json</script>
+				<script type="application/ld+json">{"@graph": [{"@type": "WebSite", "name": "Site"},
+				{"@type": ["Article"], "headline": "Headline", "author": ["Jane Doe", {"name": "John Roe"}]}]}</script>`,
+			found:    true,
+			expected: jsonLDArticle{Headline: "Headline", Author: "Jane Doe, John Roe"},
+		},
+		{
+			name:  "no article",
+			html:  `<script type="application/ld+json">{"@type": "Organization", "name": "Site"}</script>`,
+			found: false,
+		},
+		{
+			name:  "no JSON-LD",
+			html:  `<script>var headline = "Not this";</script>`,
+			found: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			got, found := extractJSONLDArticle(doc)
+			if found != tt.found {
+				t.Fatalf("extractJSONLDArticle() found = %v, want %v", found, tt.found)
+			}
+			if got.Headline != tt.expected.Headline || got.Body != tt.expected.Body ||
+				!got.DatePublished.Equal(tt.expected.DatePublished) || got.Author != tt.expected.Author ||
+				got.Image != tt.expected.Image {
+				t.Errorf("extractJSONLDArticle() = %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseStructuredDataPolicy(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    StructuredDataPolicy
+		wantErr bool
+	}{
+		{"", StructuredDataPrefer, false},
+		{"prefer", StructuredDataPrefer, false},
+		{"IGNORE", StructuredDataIgnore, false},
+		{"always", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseStructuredDataPolicy(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseStructuredDataPolicy(%q) = %q, %v; want %q, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
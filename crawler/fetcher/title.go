@@ -0,0 +1,110 @@
+package fetcher
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// titleSeparators are the separators sites use between the headline and the site name.
+var titleSeparators = []string{" | ", " - ", " – ", " — ", " :: ", " · ", " • ", " » "}
+
+// notificationCountPattern matches unread counters some sites prepend to the title, e.g. "(3) ".
+var notificationCountPattern = regexp.MustCompile(`^\(\d+\)\s*`)
+
+// maxSiteNameWords is the longest trailing " | " segment that is dropped when no site name is known.
+const maxSiteNameWords = 4
+
+// extractSiteName returns the site name declared by the page (og:site_name or application-name).
+func extractSiteName(doc *goquery.Document) string {
+	if name, ok := doc.Find(`meta[property="og:site_name"]`).First().Attr("content"); ok && strings.TrimSpace(name) != "" {
+		return strings.TrimSpace(name)
+	}
+	if name, ok := doc.Find(`meta[name="application-name"]`).First().Attr("content"); ok {
+		return strings.TrimSpace(name)
+	}
+	return ""
+}
+
+// cleanTitle removes site names, unread counters and extra whitespace from a page title.
+// siteName is the page's declared site name (may be empty) and host is the page host,
+// used to recognize the site name when none is declared.
+func cleanTitle(title, siteName, host string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	title = notificationCountPattern.ReplaceAllString(title, "")
+
+	for _, sep := range titleSeparators {
+		segments := strings.Split(title, sep)
+		if len(segments) < 2 {
+			continue
+		}
+
+		// Strip a site name at the end or the start of the title
+		last := segments[len(segments)-1]
+		if isSiteName(last, siteName, host) {
+			return cleanTitle(strings.Join(segments[:len(segments)-1], sep), siteName, host)
+		}
+		if isSiteName(segments[0], siteName, host) {
+			return cleanTitle(strings.Join(segments[1:], sep), siteName, host)
+		}
+
+		// " | " is almost never part of a headline, so drop a short trailing segment
+		// even when it doesn't match a known site name.
+		if sep == " | " && siteName == "" {
+			rest := strings.Join(segments[:len(segments)-1], sep)
+			if len(strings.Fields(last)) <= maxSiteNameWords && len(rest) > len(last) {
+				return cleanTitle(rest, siteName, host)
+			}
+		}
+	}
+
+	return strings.TrimSpace(title)
+}
+
+// isSiteName reports whether a title segment names the site, either by matching the declared
+// site name or the main label of the host (e.g. "Example News" for "www.examplenews.com").
+func isSiteName(segment, siteName, host string) bool {
+	normalized := normalizeForComparison(segment)
+	if normalized == "" {
+		return false
+	}
+	if siteName != "" && normalized == normalizeForComparison(siteName) {
+		return true
+	}
+	label := hostLabel(host)
+	return label != "" && (normalized == label || normalized == normalizeForComparison(host))
+}
+
+// secondLevelSuffixes are common second-level domains under country-code TLDs.
+var secondLevelSuffixes = map[string]bool{"co": true, "com": true, "org": true, "net": true, "ac": true, "gov": true}
+
+// hostLabel returns the normalized registrable label of a host, e.g. "examplenews" for "www.examplenews.co.uk".
+func hostLabel(host string) string {
+	host = strings.ToLower(host)
+	if idx := strings.IndexAny(host, ":/"); idx != -1 {
+		host = host[:idx]
+	}
+	parts := strings.Split(host, ".")
+	if len(parts) < 2 {
+		return normalizeForComparison(host)
+	}
+	// Drop the TLD and second-level suffixes such as "co" in "co.uk"
+	parts = parts[:len(parts)-1]
+	if len(parts) > 1 && secondLevelSuffixes[parts[len(parts)-1]] {
+		parts = parts[:len(parts)-1]
+	}
+	return normalizeForComparison(parts[len(parts)-1])
+}
+
+// normalizeForComparison lowercases s and drops everything but letters and digits.
+func normalizeForComparison(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package fetcher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		name     string
+		title    string
+		siteName string
+		host     string
+		expected string
+	}{
+		{
+			name:     "declared site name suffix",
+			title:    "Mayor Opens Bridge | The Daily Planet",
+			siteName: "The Daily Planet",
+			host:     "dailyplanet.com",
+			expected: "Mayor Opens Bridge",
+		},
+		{
+			name:     "declared site name prefix with dash",
+			title:    "The Daily Planet - Mayor Opens Bridge",
+			siteName: "The Daily Planet",
+			host:     "dailyplanet.com",
+			expected: "Mayor Opens Bridge",
+		},
+		{
+			name:     "site name derived from host",
+			title:    "Mayor Opens Bridge – Example News",
+			host:     "www.examplenews.co.uk",
+			expected: "Mayor Opens Bridge",
+		},
+		{
+			name:     "short pipe suffix without known site name",
+			title:    "Mayor Opens Bridge After Ten Years | Local | Planet",
+			host:     "planet.example.com",
+			expected: "Mayor Opens Bridge After Ten Years",
+		},
+		{
+			name:     "dash inside headline is kept",
+			title:    "Mayor Opens Bridge - Again",
+			host:     "example.com",
+			expected: "Mayor Opens Bridge - Again",
+		},
+		{
+			name:     "unread counter and whitespace",
+			title:    "(3)   Mayor Opens\n Bridge",
+			host:     "example.com",
+			expected: "Mayor Opens Bridge",
+		},
+		{
+			name:     "title that is only the site name",
+			title:    "Example",
+			host:     "example.com",
+			expected: "Example",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := cleanTitle(tt.title, tt.siteName, tt.host)
+			if result != tt.expected {
+				t.Errorf("cleanTitle(%q, %q, %q) = %q, want %q", tt.title, tt.siteName, tt.host, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExtractSiteName(t *testing.T) {
+	html := `<html><head>
+		<meta name="application-name" content="App Name">
+		<meta property="og:site_name" content=" The Daily Planet ">
+	</head></html>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+	if siteName := extractSiteName(doc); siteName != "The Daily Planet" {
+		t.Errorf("extractSiteName() = %q, want %q", siteName, "The Daily Planet")
+	}
+}
@@ -0,0 +1,165 @@
+package fetcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// warcVersion is the version of the WARC format written by WARCWriter.
+const warcVersion = "WARC/1.1"
+
+// WARCWriter appends the HTTP exchanges of fetched pages to a WARC (Web ARChive, ISO 28500) file,
+// so crawls are preserved in a format that web archive tools can replay. If the file name ends
+// in ".gz", each record is compressed as a separate gzip member, as in .warc.gz files.
+// It is safe for concurrent use.
+type WARCWriter struct {
+	mu       sync.Mutex
+	out      io.WriteCloser
+	compress bool
+}
+
+// NewWARCWriter creates the WARC file at path, replacing any existing file, and writes the
+// warcinfo record describing the crawl. software names the crawler in that record.
+func NewWARCWriter(path, software string) (*WARCWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating WARC file: %w", err)
+	}
+	w := newWARCWriter(file, strings.HasSuffix(path, ".gz"))
+
+	info := fmt.Sprintf("software: %s\r\nformat: WARC File Format 1.1\r\n", software)
+	fields := append(warcFields("warcinfo", time.Now()),
+		warcField{"WARC-Filename", filepath.Base(path)},
+		warcField{"Content-Type", "application/warc-fields"},
+	)
+	if err := w.writeRecord(fields, []byte(info)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// newWARCWriter returns a WARCWriter writing to out.
+func newWARCWriter(out io.WriteCloser, compress bool) *WARCWriter {
+	return &WARCWriter{out: out, compress: compress}
+}
+
+// WriteExchange appends a request record for req and a response record for resp, whose body
+// was read into body. Transfer encodings have already been removed by the HTTP client, so the
+// response is stored decoded. req must not carry credentials, which would end up in the archive.
+func (w *WARCWriter) WriteExchange(req *http.Request, resp *http.Response, body []byte) error {
+	now := time.Now()
+	target := req.URL.String()
+
+	var response bytes.Buffer
+	fmt.Fprintf(&response, "HTTP/%d.%d %s\r\n", resp.ProtoMajor, resp.ProtoMinor, resp.Status)
+	responseHeader := resp.Header.Clone()
+	responseHeader.Del("Transfer-Encoding")
+	responseHeader.Del("Content-Encoding")
+	responseHeader.Set("Content-Length", fmt.Sprint(len(body)))
+	responseHeader.Write(&response)
+	response.WriteString("\r\n")
+	response.Write(body)
+
+	responseFields := append(warcFields("response", now),
+		warcField{"WARC-Target-URI", target},
+		warcField{"WARC-Payload-Digest", warcDigest(body)},
+		warcField{"Content-Type", "application/http;msgtype=response"},
+	)
+
+	var request bytes.Buffer
+	fmt.Fprintf(&request, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	fmt.Fprintf(&request, "Host: %s\r\n", req.URL.Host)
+	req.Header.Write(&request)
+	request.WriteString("\r\n")
+
+	requestFields := append(warcFields("request", now),
+		warcField{"WARC-Target-URI", target},
+		warcField{"WARC-Concurrent-To", responseFields[1].value},
+		warcField{"Content-Type", "application/http;msgtype=request"},
+	)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.writeRecord(responseFields, response.Bytes()); err != nil {
+		return err
+	}
+	return w.writeRecord(requestFields, request.Bytes())
+}
+
+// Close closes the WARC file.
+func (w *WARCWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.out.Close()
+}
+
+// writeRecord writes one record with the given header fields and content block.
+// The caller must hold w.mu, except while the writer is being created.
+func (w *WARCWriter) writeRecord(fields []warcField, block []byte) error {
+	var record bytes.Buffer
+	record.WriteString(warcVersion + "\r\n")
+	for _, field := range fields {
+		fmt.Fprintf(&record, "%s: %s\r\n", field.name, field.value)
+	}
+	fmt.Fprintf(&record, "Content-Length: %d\r\n\r\n", len(block))
+	record.Write(block)
+	record.WriteString("\r\n\r\n")
+
+	if !w.compress {
+		if _, err := w.out.Write(record.Bytes()); err != nil {
+			return fmt.Errorf("error writing WARC record: %w", err)
+		}
+		return nil
+	}
+	gz := gzip.NewWriter(w.out)
+	if _, err := gz.Write(record.Bytes()); err != nil {
+		return fmt.Errorf("error writing WARC record: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("error writing WARC record: %w", err)
+	}
+	return nil
+}
+
+// warcField is a named field of a WARC record header. WARC field names are written as given
+// rather than canonicalized like HTTP header names.
+type warcField struct {
+	name, value string
+}
+
+// warcFields returns the mandatory fields of a new record of the given type, other than
+// Content-Length, which writeRecord adds. The record ID is the second field.
+func warcFields(recordType string, date time.Time) []warcField {
+	return []warcField{
+		{"WARC-Type", recordType},
+		{"WARC-Record-ID", "<urn:uuid:" + newUUID() + ">"},
+		{"WARC-Date", date.UTC().Format(time.RFC3339)},
+	}
+}
+
+// warcDigest returns the SHA-1 digest of data in the base32 form used by WARC files.
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,127 @@
+package fetcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestNewWARCWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+	}{
+		{"plain", "crawl.warc"},
+		{"gzip", "crawl.warc.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.filename)
+			w, err := NewWARCWriter(path, "poisson-test")
+			if err != nil {
+				t.Fatalf("NewWARCWriter() error = %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if strings.HasSuffix(tt.filename, ".gz") {
+				gz, err := gzip.NewReader(bytes.NewReader(data))
+				if err != nil {
+					t.Fatalf("gzip.NewReader() error = %v", err)
+				}
+				if data, err = io.ReadAll(gz); err != nil {
+					t.Fatalf("reading gzip data: %v", err)
+				}
+			}
+
+			record := string(data)
+			for _, want := range []string{"WARC/1.1\r\n", "WARC-Type: warcinfo\r\n", "WARC-Filename: " + tt.filename + "\r\n", "software: poisson-test"} {
+				if !strings.Contains(record, want) {
+					t.Errorf("warcinfo record missing %q:\n%s", want, record)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchArticleContent_WritesWARC(t *testing.T) {
+	const htmlContent = `<html><head><title>Archived</title></head><body><main>Archived content</main></body></html>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(htmlContent))
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	warc := newWARCWriter(nopCloser{&out}, false)
+	opts := Options{
+		WARC:        warc,
+		Credentials: &Credentials{Headers: map[string]string{"Authorization": "Bearer secret-token"}},
+	}
+
+	ctx := context.Background()
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	var cacheWriter bytes.Buffer
+	normalizedURL := lib.NormalizeURL(server.URL)
+	if _, _, err := fetchArticleContent(ctx, normalizedURL, false, lib.NewMockDatastoreClient(), httpClient, &cacheWriter, "", opts); err != nil {
+		t.Fatalf("fetchArticleContent() error = %v", err)
+	}
+
+	archive := out.String()
+	for _, want := range []string{
+		"WARC-Type: response\r\n",
+		"WARC-Type: request\r\n",
+		"WARC-Target-URI: " + lib.AddProtocol(normalizedURL) + "\r\n",
+		"Content-Type: application/http;msgtype=response\r\n",
+		"WARC-Payload-Digest: sha1:",
+		"HTTP/1.1 200 OK\r\n",
+		htmlContent,
+		"GET / HTTP/1.1\r\n",
+	} {
+		if !strings.Contains(archive, want) {
+			t.Errorf("archive missing %q:\n%s", want, archive)
+		}
+	}
+	if strings.Contains(archive, "secret-token") {
+		t.Errorf("archive contains credentials:\n%s", archive)
+	}
+}
+
+func TestFetchArticleContent_CachedPageNotArchived(t *testing.T) {
+	mockDS := lib.NewMockDatastoreClient()
+	mockDS.SaveCrawledPage(context.Background(), &models.CrawledPage{URL: "example.com/cached", Content: "Cached"})
+
+	var out bytes.Buffer
+	opts := Options{WARC: newWARCWriter(nopCloser{&out}, false)}
+	var cacheWriter bytes.Buffer
+	if _, _, err := fetchArticleContent(context.Background(), "example.com/cached", false, mockDS, http.DefaultClient, &cacheWriter, "", opts); err != nil {
+		t.Fatalf("fetchArticleContent() error = %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no WARC records for a page served from Datastore, got:\n%s", out.String())
+	}
+}
+
+// nopCloser is an io.WriteCloser whose Close does nothing.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
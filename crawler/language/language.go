@@ -0,0 +1,111 @@
+// Package language detects the language of article text.
+package language
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// English is the ISO 639-1 code of English, the language analyses are written in.
+const English = "en"
+
+// minMatches is the minimum number of stopwords needed to detect a language.
+const minMatches = 5
+
+// maxWords limits the number of words of a text examined by Detect.
+const maxWords = 2000
+
+// stopwords are frequent words of each supported language. Words shared by several
+// languages count for each of them.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "was", "for", "with", "on", "are", "this", "be", "by", "have", "from", "not", "but", "they", "which", "you", "we", "has", "were", "their", "been", "would", "there"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "den", "mit", "sich", "auf", "für", "ein", "eine", "auch", "dem", "des", "von", "zu", "wird", "sind", "noch", "wie", "einer", "aber", "nach", "bei", "oder", "wurde", "werden", "sie"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "un", "du", "que", "qui", "dans", "pour", "pas", "sur", "au", "avec", "il", "ce", "sont", "par", "plus", "elle", "mais", "ont", "été", "aux", "ses", "nous", "leur"},
+	"es": {"el", "la", "los", "las", "y", "que", "de", "en", "un", "una", "por", "con", "para", "es", "se", "del", "al", "como", "más", "pero", "sus", "le", "ha", "este", "fue", "son", "también", "entre", "cuando", "muy"},
+	"it": {"il", "di", "che", "e", "la", "per", "un", "una", "non", "sono", "del", "della", "gli", "le", "con", "anche", "nel", "alla", "più", "ma", "è", "dei", "delle", "questo", "ha", "come", "dal", "nella", "stato", "essere"},
+	"pt": {"o", "a", "os", "as", "e", "que", "de", "do", "da", "em", "um", "uma", "para", "com", "não", "por", "mais", "dos", "das", "no", "na", "se", "foi", "ao", "como", "mas", "também", "é", "são", "pelo"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "met", "voor", "die", "ook", "er", "aan", "maar", "om", "bij", "nog", "wordt", "werd", "naar", "dan", "uit", "door", "hij", "zij", "deze"},
+}
+
+// names are the English names of the supported languages, used in prompts.
+var names = map[string]string{
+	"en": "English",
+	"de": "German",
+	"fr": "French",
+	"es": "Spanish",
+	"it": "Italian",
+	"pt": "Portuguese",
+	"nl": "Dutch",
+}
+
+// stopwordLanguages maps each stopword to the languages it belongs to.
+var stopwordLanguages = func() map[string][]string {
+	index := make(map[string][]string)
+	for lang, words := range stopwords {
+		for _, word := range words {
+			index[word] = append(index[word], lang)
+		}
+	}
+	return index
+}()
+
+// Detect returns the ISO 639-1 code of the language text is written in, or "" if it
+// can't be told (too little text, or a language without a stopword list).
+func Detect(text string) string {
+	counts := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if len(words) > maxWords {
+		words = words[:maxWords]
+	}
+	for _, word := range words {
+		for _, lang := range stopwordLanguages[word] {
+			counts[lang]++
+		}
+	}
+
+	best, bestCount, secondCount := "", 0, 0
+	for lang, count := range counts {
+		if count > bestCount || (count == bestCount && lang < best) {
+			best, bestCount, secondCount = lang, count, max(bestCount, secondCount)
+		} else if count > secondCount {
+			secondCount = count
+		}
+	}
+	if bestCount < minMatches || bestCount == secondCount {
+		return ""
+	}
+	return best
+}
+
+// Normalize converts a language tag such as "en-US" or "pt_BR" to its lowercase ISO 639-1
+// code ("en", "pt"). It returns "" for tags that don't start with a two-letter code.
+func Normalize(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	code, _, _ := strings.Cut(strings.ReplaceAll(tag, "_", "-"), "-")
+	if len(code) != 2 || code[0] < 'a' || code[0] > 'z' || code[1] < 'a' || code[1] > 'z' {
+		return ""
+	}
+	return code
+}
+
+// Name returns the English name of the language with the given ISO 639-1 code,
+// or the code itself for languages without a known name.
+func Name(code string) string {
+	if name, ok := names[code]; ok {
+		return name
+	}
+	return code
+}
+
+// Codes returns the ISO 639-1 codes of the languages Detect can recognize, sorted.
+func Codes() []string {
+	codes := make([]string, 0, len(names))
+	for code := range names {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
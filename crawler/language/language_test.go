@@ -0,0 +1,87 @@
+package language
+
+import (
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "english",
+			text: "The mayor said that the new bridge was built for the people of the town and that it is not a joke.",
+			want: "en",
+		},
+		{
+			name: "german",
+			text: "Der Bürgermeister sagte, dass die neue Brücke für die Menschen der Stadt gebaut wurde und das ist nicht ein Witz.",
+			want: "de",
+		},
+		{
+			name: "french",
+			text: "Le maire a dit que le nouveau pont est pour les habitants de la ville et que ce n'est pas une blague.",
+			want: "fr",
+		},
+		{
+			name: "spanish",
+			text: "El alcalde dijo que el nuevo puente es para los vecinos de la ciudad y que no es una broma, pero también muy caro.",
+			want: "es",
+		},
+		{
+			name: "too short",
+			text: "The bridge",
+			want: "",
+		},
+		{
+			name: "no stopwords",
+			text: "Lorem ipsum dolor sit amet consectetur adipiscing elit sed eiusmod tempor",
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.text); got != tt.want {
+				t.Errorf("Detect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"en", "en"},
+		{"en-US", "en"},
+		{"pt_BR", "pt"},
+		{" DE ", "de"},
+		{"", ""},
+		{"eng", ""},
+		{"x1", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.tag); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestCodes(t *testing.T) {
+	codes := Codes()
+	if !sort.StringsAreSorted(codes) {
+		t.Errorf("Codes() = %v, want sorted codes", codes)
+	}
+	// Every language Detect recognizes has a name
+	for lang := range stopwords {
+		if !slices.Contains(codes, lang) {
+			t.Errorf("Codes() = %v, missing %q", codes, lang)
+		}
+	}
+}
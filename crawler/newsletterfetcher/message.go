@@ -0,0 +1,148 @@
+package newsletterfetcher
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	// maxPartSize is the largest decoded text part read from a message.
+	maxPartSize = 5 << 20
+	// maxPartDepth is how deeply nested multipart bodies are read.
+	maxPartDepth = 5
+)
+
+// Message is a newsletter email.
+type Message struct {
+	// Path is the file the message was read from.
+	Path string
+	// ID is the Message-ID without angle brackets, empty if the message has none.
+	ID string
+	// From is the address of the sender, e.g. news@example.com.
+	From    string
+	Subject string
+	// Date is when the message was sent, zero if its Date header is missing or invalid.
+	Date time.Time
+	// HTML and Text are the HTML and plain text bodies, decoded to UTF-8. Either may be empty.
+	HTML string
+	Text string
+}
+
+// wordDecoder decodes RFC 2047 encoded headers in any charset known to the html/charset package.
+var wordDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+// parseMessage parses an RFC 5322 message, keeping the first HTML and plain text parts of its
+// body. Attachments are skipped.
+func parseMessage(r io.Reader) (*Message, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing message: %w", err)
+	}
+
+	message := &Message{
+		ID:      strings.Trim(strings.TrimSpace(msg.Header.Get("Message-Id")), "<>"),
+		Subject: decodeHeader(msg.Header.Get("Subject")),
+	}
+	addressParser := mail.AddressParser{WordDecoder: wordDecoder}
+	if from, err := addressParser.Parse(msg.Header.Get("From")); err == nil {
+		message.From = strings.ToLower(from.Address)
+	}
+	if date, err := msg.Header.Date(); err == nil {
+		message.Date = date
+	}
+
+	if err := readPart(textproto.MIMEHeader(msg.Header), msg.Body, message, 0); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// decodeHeader decodes the RFC 2047 encoded words of a header value, returning it as is
+// if it can't be decoded.
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(decoded)
+}
+
+// readPart reads a message body or body part with the given header into message, walking
+// multipart bodies down to maxPartDepth.
+func readPart(header textproto.MIMEHeader, body io.Reader, message *Message, depth int) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil // The default of RFC 2045
+	}
+	if disposition, _, _ := mime.ParseMediaType(header.Get("Content-Disposition")); disposition == "attachment" {
+		return nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxPartDepth || params["boundary"] == "" {
+			return nil
+		}
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("error reading message part: %w", err)
+			}
+			if err := readPart(part.Header, part, message, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	if mediaType != "text/html" && mediaType != "text/plain" {
+		return nil
+	}
+	if (mediaType == "text/html" && message.HTML != "") || (mediaType == "text/plain" && message.Text != "") {
+		return nil
+	}
+	text, err := decodeText(body, header.Get("Content-Transfer-Encoding"), params["charset"])
+	if err != nil {
+		return err
+	}
+	if mediaType == "text/html" {
+		message.HTML = text
+	} else {
+		message.Text = text
+	}
+	return nil
+}
+
+// decodeText reads a text part with the given transfer encoding and charset, and returns it
+// in UTF-8.
+func decodeText(body io.Reader, transferEncoding, charsetLabel string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(transferEncoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body) // Line breaks are skipped
+	}
+	if charsetLabel != "" {
+		// Parts in an unknown charset are read as is
+		if decoded, err := charset.NewReaderLabel(charsetLabel, body); err == nil {
+			body = decoded
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxPartSize))
+	if err != nil {
+		return "", fmt.Errorf("error reading message part: %w", err)
+	}
+	return string(data), nil
+}
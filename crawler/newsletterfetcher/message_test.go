@@ -0,0 +1,103 @@
+package newsletterfetcher
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		wantFrom    string
+		wantSubject string
+		wantHTML    string
+		wantText    string
+	}{
+		{
+			name: "multipart alternative with encoded parts",
+			raw: "From: =?UTF-8?Q?Caf=C3=A9_Weekly?= <News@Example.com>\r\n" +
+				"Subject: =?ISO-8859-1?Q?Les_nouvelles_de_la_semaine_=E0_Paris?=\r\n" +
+				"Date: Mon, 01 Apr 2024 08:00:00 +0000\r\n" +
+				"Message-ID: <abc123@mail.example.com>\r\n" +
+				"MIME-Version: 1.0\r\n" +
+				"Content-Type: multipart/mixed; boundary=outer\r\n" +
+				"\r\n" +
+				"--outer\r\n" +
+				"Content-Type: multipart/alternative; boundary=inner\r\n" +
+				"\r\n" +
+				"--inner\r\n" +
+				"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"\r\n" +
+				"Q2Fm6SBkdSBtYXRpbg==\r\n" +
+				"--inner\r\n" +
+				"Content-Type: text/html; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: quoted-printable\r\n" +
+				"\r\n" +
+				"<p>Caf=C3=A9 du matin, a very long line that was wrapped by the quoted-=\r\n" +
+				"printable encoding</p>\r\n" +
+				"--inner--\r\n" +
+				"--outer\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"Content-Disposition: attachment; filename=notes.txt\r\n" +
+				"\r\n" +
+				"Attached notes\r\n" +
+				"--outer--\r\n",
+			wantFrom:    "news@example.com",
+			wantSubject: "Les nouvelles de la semaine à Paris",
+			wantHTML:    "<p>Café du matin, a very long line that was wrapped by the quoted-printable encoding</p>",
+			wantText:    "Café du matin",
+		},
+		{
+			name: "plain text without MIME headers",
+			raw: "From: digest@example.org\n" +
+				"Subject: Daily digest\n" +
+				"\n" +
+				"Read https://example.org/story today.\n",
+			wantFrom:    "digest@example.org",
+			wantSubject: "Daily digest",
+			wantText:    "Read https://example.org/story today.\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := parseMessage(strings.NewReader(tt.raw))
+			if err != nil {
+				t.Fatalf("parseMessage() error = %v", err)
+			}
+			if message.From != tt.wantFrom {
+				t.Errorf("From = %q, want %q", message.From, tt.wantFrom)
+			}
+			if message.Subject != tt.wantSubject {
+				t.Errorf("Subject = %q, want %q", message.Subject, tt.wantSubject)
+			}
+			if strings.TrimSpace(message.HTML) != tt.wantHTML {
+				t.Errorf("HTML = %q, want %q", message.HTML, tt.wantHTML)
+			}
+			if message.Text != tt.wantText {
+				t.Errorf("Text = %q, want %q", message.Text, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestParseMessage_Headers(t *testing.T) {
+	message, err := parseMessage(strings.NewReader("Message-ID: <abc123@mail.example.com>\r\n" +
+		"Date: Mon, 01 Apr 2024 10:00:00 +0200\r\n\r\nHello\r\n"))
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+	if message.ID != "abc123@mail.example.com" {
+		t.Errorf("ID = %q", message.ID)
+	}
+	if want := time.Date(2024, 4, 1, 8, 0, 0, 0, time.UTC); !message.Date.Equal(want) {
+		t.Errorf("Date = %v, want %v", message.Date, want)
+	}
+
+	if _, err := parseMessage(strings.NewReader("not a message")); err == nil {
+		t.Error("parseMessage() of an invalid message expected an error")
+	}
+}
@@ -0,0 +1,310 @@
+package newsletterfetcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/crawler/language"
+	"github.com/zeace/poisson/crawler/utils"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+	"github.com/zeace/poisson/models"
+)
+
+const (
+	// minBodyLength is the shortest newsletter text analyzed as an article of its own.
+	// Shorter bodies are only a list of links.
+	minBodyLength = 500
+	// seenFlags is appended to the name of a Maildir message moved to cur/ once processed.
+	seenFlags = ":2,S"
+)
+
+// skipLinkPattern matches the URLs and anchor texts of the links of a newsletter that don't lead
+// to an article: unsubscribe and preference pages, web versions of the email and the like.
+var skipLinkPattern = regexp.MustCompile(`(?i)(unsubscribe|opt[-_ ]?out|preferences|manage[-_ ]?(your[-_ ]?)?subscription|view[-_ ](this[-_ ]email[-_ ])?(online|in[-_ ](your[-_ ])?browser)|web[-_ ]?version|forward[-_ ]to[-_ ]a[-_ ]friend|privacy[-_ ]policy|update[-_ ]your[-_ ]profile)`)
+
+// socialHosts are the sites linked from newsletter headers and footers rather than articles.
+var socialHosts = []string{
+	"facebook.com", "twitter.com", "x.com", "instagram.com", "linkedin.com", "youtube.com",
+	"tiktok.com", "pinterest.com", "threads.net", "t.me", "whatsapp.com", "apps.apple.com", "play.google.com",
+}
+
+// textURLPattern matches the URLs of a plain text newsletter.
+var textURLPattern = regexp.MustCompile(`https?://[^\s<>"()\[\]]+`)
+
+// ReadMailbox returns the messages to process in dir. If dir is a Maildir (it has a new/
+// subdirectory), these are the new messages; see MarkSeen. Otherwise they are the .eml files
+// in dir. Messages that can't be parsed are logged and skipped.
+func ReadMailbox(dir string) ([]*Message, error) {
+	messageDir := dir
+	maildir := false
+	if info, err := os.Stat(filepath.Join(dir, "new")); err == nil && info.IsDir() {
+		messageDir = filepath.Join(dir, "new")
+		maildir = true
+	}
+
+	entries, err := os.ReadDir(messageDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading newsletter directory: %w", err)
+	}
+
+	var messages []*Message
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") || (!maildir && !strings.EqualFold(filepath.Ext(name), ".eml")) {
+			continue
+		}
+		path := filepath.Join(messageDir, name)
+		message, err := readMessageFile(path)
+		if err != nil {
+			slog.Warn("Skipping newsletter message", "path", path, "error", err)
+			continue
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// readMessageFile parses the message in the file at path.
+func readMessageFile(path string) (*Message, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening message: %w", err)
+	}
+	defer file.Close()
+
+	message, err := parseMessage(file)
+	if err != nil {
+		return nil, err
+	}
+	message.Path = path
+	return message, nil
+}
+
+// MarkSeen moves a message read from the new/ directory of a Maildir to its cur/ directory
+// with the seen flag, as mail clients do, so that the next ReadMailbox skips it. Messages
+// read from a directory of .eml files are left in place.
+func MarkSeen(message *Message) error {
+	dir, name := filepath.Split(message.Path)
+	dir = filepath.Clean(dir)
+	if filepath.Base(dir) != "new" {
+		return nil
+	}
+	if !strings.Contains(name, ":2,") {
+		name += seenFlags
+	}
+	target := filepath.Join(filepath.Dir(dir), "cur", name)
+	if err := os.Rename(message.Path, target); err != nil {
+		return fmt.Errorf("error marking message as seen: %w", err)
+	}
+	message.Path = target
+	return nil
+}
+
+// Feed returns the feed identifier of the pages of a newsletter, used to attribute their
+// analyses: a mailto: URL of the sender.
+func Feed(message *Message) string {
+	return "mailto:" + message.From
+}
+
+// bodyURL returns the URL of the page holding the newsletter body: a mid: URL of its
+// Message-ID (RFC 2392), or of a hash of its content if it has none.
+func bodyURL(message *Message) string {
+	id := message.ID
+	if id == "" {
+		id = lib.ContentHash(message.From + message.Subject + message.HTML + message.Text)[:32] + "@poisson"
+	}
+	return "mid:" + url.PathEscape(id)
+}
+
+// bodyText returns the whitespace-normalized text of the newsletter body, taken from its
+// HTML part if it has one.
+func bodyText(message *Message) string {
+	if message.HTML == "" {
+		return strings.Join(strings.Fields(message.Text), " ")
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(message.HTML))
+	if err != nil {
+		return strings.Join(strings.Fields(message.Text), " ")
+	}
+	doc.Find("head, script, style").Remove()
+	return strings.Join(strings.Fields(doc.Text()), " ")
+}
+
+// ExtractLinks returns the article links of a newsletter, in order and without duplicates:
+// the http(s) links of its HTML part, or the URLs in its plain text part if it has no HTML.
+// Unsubscribe and preference links, links to social networks and links to the home page of
+// a site are left out.
+func ExtractLinks(message *Message) []string {
+	var candidates []string
+	if message.HTML != "" {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(message.HTML))
+		if err == nil {
+			doc.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+				href := strings.TrimSpace(a.AttrOr("href", ""))
+				if !skipLinkPattern.MatchString(href) && !skipLinkPattern.MatchString(a.Text()) {
+					candidates = append(candidates, href)
+				}
+			})
+		}
+	} else {
+		for _, match := range textURLPattern.FindAllString(message.Text, -1) {
+			match = strings.TrimRight(match, ".,;:!?'")
+			if !skipLinkPattern.MatchString(match) {
+				candidates = append(candidates, match)
+			}
+		}
+	}
+
+	var links []string
+	for _, result := range utils.BatchValidate(candidates) {
+		if result.Err != nil || isSocialHost(result.Host) {
+			continue
+		}
+		if parsed, err := url.Parse(result.Normalized); err != nil || strings.Trim(parsed.Path, "/") == "" {
+			continue
+		}
+		links = append(links, result.Normalized)
+	}
+	return links
+}
+
+// isSocialHost reports whether host is one of socialHosts or a subdomain of one.
+func isSocialHost(host string) bool {
+	for _, social := range socialHosts {
+		if host == social || strings.HasSuffix(host, "."+social) {
+			return true
+		}
+	}
+	return false
+}
+
+// saveBodyPage stores the body of a newsletter as a crawled page and returns it, or returns
+// nil if the body is too short to be analyzed.
+func saveBodyPage(ctx context.Context, message *Message, datastoreClient lib.DatastoreClient) (*models.CrawledPage, error) {
+	text := bodyText(message)
+	if len(text) < minBodyLength {
+		return nil, nil
+	}
+
+	page := &models.CrawledPage{
+		URL:         bodyURL(message),
+		Title:       message.Subject,
+		Content:     text,
+		DateTime:    time.Now(),
+		PublishedAt: message.Date,
+		Author:      message.From,
+		Language:    language.Detect(message.Subject + " " + text),
+		Source:      models.SourceRef{Kind: models.SourceKindNewsletter, ID: Feed(message)},
+		ContentHash: lib.ContentHash(text),
+		WordCount:   lib.WordCount(text),
+
+		ExtractionMethod: models.ExtractionMethodNewsletter,
+	}
+	page.ReadingMinutes = lib.ReadingMinutes(page.WordCount)
+	if err := datastoreClient.SaveCrawledPage(ctx, page); err != nil {
+		return nil, fmt.Errorf("error saving newsletter to Datastore: %w", err)
+	}
+	lib.RecordAuditEvent(ctx, datastoreClient, &models.AuditEvent{
+		URL:    page.URL,
+		Action: models.AuditActionFetched,
+		Detail: fmt.Sprintf("newsletter from %s, %d characters", message.From, len(text)),
+	})
+	page.CacheSource = models.CacheSourceNetwork
+	page.Feed = Feed(message)
+	return page, nil
+}
+
+// FetchNewsletterArticles stores the body of each message as a page and fetches the articles it
+// links to, at most maxLinks per message, concurrently using fetcher.FetchMany like
+// rssfetcher.FetchRSSArticles does for the items of a feed. The pages of a message have its
+// Feed. Bodies shorter than minBodyLength, such as link digests, are not analyzed themselves.
+// Pages excluded by their robots directives under fetchOptions are left out of the result.
+func FetchNewsletterArticles(
+	ctx context.Context,
+	messages []*Message,
+	maxLinks int,
+	verbose bool,
+	datastoreClient lib.DatastoreClient,
+	fetchOptions fetcher.Options,
+) ([]*models.CrawledPage, error) {
+	var pages []*models.CrawledPage
+	var feeds []string
+	feedLinks := make(map[string][]string)
+	linked := make(map[string]bool)
+	var fetchErrors []error
+
+	for _, message := range messages {
+		msgCtx := logging.WithAttrs(ctx, "newsletter", message.From, "subject", message.Subject)
+		page, err := saveBodyPage(msgCtx, message, datastoreClient)
+		if err != nil {
+			fetchErrors = append(fetchErrors, fmt.Errorf("newsletter %q: %w", message.Subject, err))
+		} else if page != nil {
+			pages = append(pages, page)
+		}
+
+		links := ExtractLinks(message)
+		if len(links) > maxLinks {
+			links = links[:maxLinks]
+		}
+		if verbose {
+			slog.InfoContext(msgCtx, "Read newsletter", "body", page != nil, "links", len(links))
+		}
+		for _, link := range links {
+			key := lib.NormalizeURL(link)
+			if linked[key] {
+				continue // Linked from an earlier newsletter
+			}
+			feed := Feed(message)
+			if _, ok := feedLinks[feed]; !ok {
+				feeds = append(feeds, feed)
+			}
+			linked[key] = true
+			feedLinks[feed] = append(feedLinks[feed], link)
+		}
+	}
+
+	// Fetch concurrently, capped globally and per host by fetchOptions, one sender at a time
+	// so that the stored articles record the newsletter they were linked from
+	for _, feed := range feeds {
+		feedOptions := fetchOptions
+		feedOptions.Source = models.SourceRef{Kind: models.SourceKindNewsletter, ID: feed}
+		for _, result := range fetcher.FetchMany(ctx, feedLinks[feed], verbose, datastoreClient, feedOptions) {
+			if result.Err != nil {
+				fetchErrors = append(fetchErrors, fmt.Errorf("article %s: %w", result.URL, result.Err))
+				if verbose {
+					slog.WarnContext(ctx, "Error fetching article", "url", result.URL, "error", result.Err)
+				}
+				continue
+			}
+			if result.Page.RobotsExcluded {
+				if verbose {
+					slog.InfoContext(ctx, "Skipping article: excluded by robots directives", "url", result.URL)
+				}
+				continue
+			}
+
+			result.Page.Feed = feed
+			pages = append(pages, result.Page)
+		}
+	}
+
+	if len(pages) == 0 && len(fetchErrors) > 0 {
+		return nil, fmt.Errorf("failed to fetch any articles: %v", fetchErrors)
+	}
+	if len(pages) > 0 && len(fetchErrors) > 0 {
+		return pages, fmt.Errorf("partial success: fetched %d article(s) but %d error(s) occurred: %v",
+			len(pages), len(fetchErrors), fetchErrors)
+	}
+	return pages, nil
+}
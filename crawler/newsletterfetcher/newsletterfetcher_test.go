@@ -0,0 +1,153 @@
+package newsletterfetcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestExtractLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		message Message
+		want    []string
+	}{
+		{
+			name: "HTML newsletter",
+			message: Message{HTML: `<html><body>
+				<a href="https://news.example.com/view/123">View this email in your browser</a>
+				<h2><a href="https://news.example.com/2024/04/01/bridge?utm_source=newsletter">The city will build a new bridge</a></h2>
+				<a href="https://news.example.com/2024/04/01/bridge">Read more</a>
+				<a href="https://other.example.org/story">Elsewhere</a>
+				<a href="https://news.example.com/">Example News</a>
+				<a href="https://twitter.com/examplenews">Follow us</a>
+				<a href="mailto:editor@example.com">Write to us</a>
+				<a href="https://news.example.com/account">Unsubscribe</a>
+				<a href="https://list.example.com/unsubscribe?id=42">Click here</a>
+			</body></html>`, Text: "https://ignored.example.com/plain-text-part"},
+			want: []string{
+				"https://news.example.com/2024/04/01/bridge?utm_source=newsletter",
+				"https://other.example.org/story",
+			},
+		},
+		{
+			name: "plain text newsletter",
+			message: Message{Text: "Today: https://news.example.com/a-story, and (https://news.example.com/another).\n" +
+				"Manage preferences: https://news.example.com/preferences\n"},
+			want: []string{"https://news.example.com/a-story", "https://news.example.com/another"},
+		},
+		{
+			name:    "no links",
+			message: Message{Text: "Nothing to read this week."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExtractLinks(&tt.message)
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("ExtractLinks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadMailbox_Maildir(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"new", "cur", "tmp"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(dir, "new", "1712000000.1.host"), "Subject: First\r\n\r\nHello\r\n")
+	writeFile(t, filepath.Join(dir, "new", "1712000001.2.host"), "not a message")
+	writeFile(t, filepath.Join(dir, "cur", "1711000000.3.host:2,S"), "Subject: Already seen\r\n\r\nHello\r\n")
+
+	messages, err := ReadMailbox(dir)
+	if err != nil {
+		t.Fatalf("ReadMailbox() error = %v", err)
+	}
+	if len(messages) != 1 || messages[0].Subject != "First" {
+		t.Fatalf("ReadMailbox() = %+v, want the new message only", messages)
+	}
+
+	if err := MarkSeen(messages[0]); err != nil {
+		t.Fatalf("MarkSeen() error = %v", err)
+	}
+	if want := filepath.Join(dir, "cur", "1712000000.1.host:2,S"); messages[0].Path != want {
+		t.Errorf("Path = %q, want %q", messages[0].Path, want)
+	}
+	if messages, _ := ReadMailbox(dir); len(messages) != 0 {
+		t.Errorf("ReadMailbox() after MarkSeen = %d message(s), want none", len(messages))
+	}
+}
+
+func TestReadMailbox_EmlDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "weekly.eml"), "Subject: Weekly\r\n\r\nHello\r\n")
+	writeFile(t, filepath.Join(dir, "notes.txt"), "Subject: Not a message file\r\n\r\nHello\r\n")
+
+	messages, err := ReadMailbox(dir)
+	if err != nil {
+		t.Fatalf("ReadMailbox() error = %v", err)
+	}
+	if len(messages) != 1 || messages[0].Subject != "Weekly" {
+		t.Fatalf("ReadMailbox() = %+v, want weekly.eml only", messages)
+	}
+
+	// .eml files are left in place
+	if err := MarkSeen(messages[0]); err != nil {
+		t.Fatalf("MarkSeen() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "weekly.eml")); err != nil {
+		t.Errorf("MarkSeen() moved an .eml file: %v", err)
+	}
+
+	if _, err := ReadMailbox(filepath.Join(dir, "missing")); err == nil {
+		t.Error("ReadMailbox() of a missing directory expected an error")
+	}
+}
+
+func TestFetchNewsletterArticles_Body(t *testing.T) {
+	essay := &Message{
+		ID:      "essay@mail.example.com",
+		From:    "essays@example.com",
+		Subject: "Why the bridge matters",
+		HTML:    "<html><head><style>p { color: red }</style></head><body><p>" + strings.Repeat("The bridge is long. ", 40) + "</p></body></html>",
+	}
+	digest := &Message{From: "digest@example.com", Subject: "Links of the week", Text: "Nothing but links this week."}
+	datastoreClient := lib.NewMockDatastoreClient()
+
+	pages, err := FetchNewsletterArticles(context.Background(), []*Message{essay, digest}, 5, false, datastoreClient, fetcher.Options{})
+	if err != nil {
+		t.Fatalf("FetchNewsletterArticles() error = %v", err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("FetchNewsletterArticles() returned %d page(s), want the essay only", len(pages))
+	}
+	page := pages[0]
+	if page.URL != "mid:essay@mail.example.com" || page.Title != essay.Subject || page.Feed != "mailto:essays@example.com" {
+		t.Errorf("unexpected page: %+v", page)
+	}
+	if page.ExtractionMethod != models.ExtractionMethodNewsletter || strings.Contains(page.Content, "color") ||
+		!strings.HasPrefix(page.Content, "The bridge is long.") {
+		t.Errorf("unexpected content %q extracted with %q", page.Content, page.ExtractionMethod)
+	}
+	if _, ok := datastoreClient.Pages[page.URL]; !ok {
+		t.Error("newsletter body was not saved")
+	}
+}
+
+// writeFile writes content to path, failing the test on error.
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
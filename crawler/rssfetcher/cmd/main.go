@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"log"
 	"os"
@@ -8,19 +9,39 @@ import (
 	"time"
 
 	"github.com/zeace/poisson/crawler/config"
+	"github.com/zeace/poisson/crawler/fetcher"
 	"github.com/zeace/poisson/crawler/rssfetcher"
 	"github.com/zeace/poisson/crawler/utils"
 	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
 )
 
 func main() {
 	var (
-		verbose = flag.Bool("verbose", false, "Show verbose output")
-		max     = flag.Int("max", 5, "Maximum number of articles to fetch")
-		url     = flag.String("url", "", "URL of the RSS feed")
+		verbose   = flag.Bool("verbose", false, "Show verbose output")
+		max       = flag.Int("max", 5, "Maximum number of articles to fetch")
+		include   = flag.String("include", "", "Only fetch the feed items whose title or description matches one of these comma-separated keywords (case-insensitive) or /regular expressions/, e.g. \"April Fools,/\\bprank(s|ed)?\\b/\"")
+		exclude   = flag.String("exclude", "", "Leave out the feed items whose title or description matches one of these comma-separated keywords (case-insensitive) or /regular expressions/, e.g. sports,horoscope")
+		since     = flag.String("since", "", "Only fetch the feed items published at or after this time: an age such as 7d or 12h, a date such as 2026-04-01 or an RFC 3339 time; items without a date are left out")
+		until     = flag.String("until", "", "Only fetch the feed items published before this time: an age such as 7d or 12h, a date such as 2026-04-01 (included) or an RFC 3339 time; items without a date are left out")
+		url       = flag.String("url", "", "URL of the RSS feed")
+		feedAuth  = flag.String("feed-auth", "", "Credentials for a private feed and its articles: basic:<username>:<secret>, bearer:<secret> or header:<name>:<secret>, where <secret> names a secret in POISSON_SECRET_<NAME> or POISSON_SECRETS_DIR")
+		strData   = flag.String("structured-data", "", "How to extract articles: prefer uses schema.org JSON-LD Article data when present, ignore always uses HTML heuristics (or set POISSON_STRUCTURED_DATA environment variable)")
+		robots    = flag.String("robots", "", "How to handle noindex/noai pages: ignore or respect (or set POISSON_ROBOTS_POLICY environment variable)")
+		conc      = flag.Int("concurrency", fetcher.DefaultConcurrency, "Maximum number of articles fetched in parallel")
+		perHost   = flag.Int("per-host", fetcher.DefaultPerHostConcurrency, "Maximum number of parallel requests to a single host")
+		hostDelay = flag.Duration("host-delay", 0, "Minimum time between the starts of two requests to the same host, e.g. 500ms or 2s")
+		private   = flag.Bool("allow-private-addresses", false, "Fetch feeds and articles from private, loopback and link-local addresses, which are refused by default")
+		logLevel  = flag.String("log-level", "", "Minimum log level: debug, info, warn or error (or set POISSON_LOG_LEVEL environment variable)")
+		logFormat = flag.String("log-format", "", "Log format: text or json (or set POISSON_LOG_FORMAT environment variable)")
+		jsonOut   = flag.Bool("json", false, "Print the fetch summary (fetched, skipped and failed articles, cache hits) as JSON instead of the articles")
 	)
 	flag.Parse()
 
+	if err := logging.Init(*logLevel, *logFormat); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
 	if *url == "" {
 		log.Printf("Error: RSS feed URL required\n")
 		log.Printf("Usage: %s [flags]\n", os.Args[0])
@@ -33,6 +54,33 @@ func main() {
 		log.Fatalf("Invalid RSS feed URL: %v\n", err)
 	}
 
+	filter, err := rssfetcher.ParseItemFilter(*include, *exclude)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if filter.Since, filter.Until, err = rssfetcher.ParsePublishedWindow(*since, *until, time.Now()); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	robotsPolicy, err := fetcher.ParseRobotsPolicy(config.GetRobotsPolicy(*robots))
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	structuredData, err := fetcher.ParseStructuredDataPolicy(config.GetStructuredDataPolicy(*strData))
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	var credentials *fetcher.Credentials
+	if *feedAuth != "" {
+		auth, err := fetcher.ParseFeedAuth(*feedAuth)
+		if err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+		if credentials, err = fetcher.ResolveCredentials(*url, auth); err != nil {
+			log.Fatalf("Error: %v\n", err)
+		}
+	}
+
 	// Set up Datastore client
 	dsCtx, dsCancel := config.NewDatastoreContext()
 	datastoreClient, err := lib.CreateDatastoreClient(dsCtx)
@@ -47,15 +95,30 @@ func main() {
 	rssCtx, rssCancel := config.NewRSSContext()
 	defer rssCancel()
 
-	pages, err := rssfetcher.FetchRSSArticles(rssCtx, *url, *max, *verbose, datastoreClient)
-	if err != nil {
-		// Check if we got partial success (some pages but also errors)
-		if len(pages) == 0 {
-			// Complete failure - no pages fetched
+	pages, summary, err := rssfetcher.FetchRSSArticles(rssCtx, *url, *max, utils.Sample{}, filter, *verbose, datastoreClient, fetcher.Options{
+		RobotsPolicy:          robotsPolicy,
+		StructuredData:        structuredData,
+		Credentials:           credentials,
+		Concurrency:           *conc,
+		PerHostConcurrency:    *perHost,
+		HostDelay:             *hostDelay,
+		AllowPrivateAddresses: *private,
+	})
+	if *jsonOut && summary != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(summary); err != nil {
 			log.Fatalf("Error: %v\n", err)
 		}
-		// Partial success - log warning but continue with available pages
-		log.Printf("Warning: %v\n", err)
+	}
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	if *jsonOut {
+		return
+	}
+	for _, failed := range summary.Failed {
+		log.Printf("Warning: article %s: %s\n", failed.URL, failed.Reason)
 	}
 
 	log.Printf("\n%s\n", strings.Repeat("=", 60))
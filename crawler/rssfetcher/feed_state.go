@@ -0,0 +1,104 @@
+package rssfetcher
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+const (
+	// maxStoredFeedItems bounds the items recorded in a FeedState, keeping entities small.
+	maxStoredFeedItems = 500
+	// maxStoredDescriptionLength is the number of bytes of item descriptions recorded in a
+	// FeedState.
+	maxStoredDescriptionLength = 1000
+)
+
+// readFeedState returns the state recorded for the feed at feedURL, or nil if there is none, the
+// state can't be read, or fetchOptions.ForceRefresh asks for a full download.
+func readFeedState(ctx context.Context, datastoreClient lib.DatastoreClient, feedURL string, fetchOptions fetcher.Options) *models.FeedState {
+	if datastoreClient == nil || fetchOptions.ForceRefresh {
+		return nil
+	}
+	state, found, err := datastoreClient.ReadFeedState(ctx, feedURL)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to read feed state, downloading the feed", "error", err)
+		return nil
+	}
+	if !found || (state.ETag == "" && state.LastModified == "") {
+		return nil
+	}
+	return state
+}
+
+// writeFeedState records state, the validators and next page of a response of its feed, with the
+// items read from the feed, if the server sent validators. Errors are logged, since the next poll
+// only downloads the feed again.
+func writeFeedState(ctx context.Context, datastoreClient lib.DatastoreClient, state *models.FeedState, items []*gofeed.Item) {
+	if datastoreClient == nil || (state.ETag == "" && state.LastModified == "") {
+		return
+	}
+	state.ModifiedAt = time.Now()
+	if len(items) > maxStoredFeedItems {
+		// The next page doesn't follow the recorded items anymore
+		items, state.NextPage = items[:maxStoredFeedItems], ""
+	}
+	for _, item := range items {
+		state.Items = append(state.Items, models.FeedStateItem{
+			Link:        item.Link,
+			Title:       item.Title,
+			Description: truncateDescription(item.Description),
+			Published:   publishedTime(item),
+			Author:      itemAuthor(item),
+			Categories:  itemCategories(item),
+		})
+	}
+	if err := datastoreClient.WriteFeedState(ctx, state); err != nil {
+		slog.WarnContext(ctx, "Failed to record feed state", "error", err)
+	}
+}
+
+// setFeedValidators makes req conditional on the validators of state.
+func setFeedValidators(req *http.Request, state *models.FeedState) {
+	if state.ETag != "" {
+		req.Header.Set("If-None-Match", state.ETag)
+	}
+	if state.LastModified != "" {
+		req.Header.Set("If-Modified-Since", state.LastModified)
+	}
+}
+
+// feedStateItems returns the items recorded in state as feed items.
+func feedStateItems(state *models.FeedState) []*gofeed.Item {
+	items := make([]*gofeed.Item, len(state.Items))
+	for i, item := range state.Items {
+		items[i] = &gofeed.Item{Link: item.Link, Title: item.Title, Description: item.Description, Categories: item.Categories}
+		if !item.Published.IsZero() {
+			items[i].PublishedParsed = &item.Published
+		}
+		if item.Author != "" {
+			items[i].Authors = []*gofeed.Person{{Name: item.Author}}
+		}
+	}
+	return items
+}
+
+// truncateDescription returns the first maxStoredDescriptionLength bytes of description, cut at
+// a rune boundary.
+func truncateDescription(description string) string {
+	if len(description) <= maxStoredDescriptionLength {
+		return description
+	}
+	cut := maxStoredDescriptionLength
+	for cut > 0 && !utf8.RuneStart(description[cut]) {
+		cut--
+	}
+	return description[:cut]
+}
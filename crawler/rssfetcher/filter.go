@@ -0,0 +1,181 @@
+package rssfetcher
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/zeace/poisson/crawler/utils"
+)
+
+// ItemFilter selects the feed items whose articles are fetched by their title, description and
+// publication date, before any request for the articles. The zero ItemFilter selects every item.
+type ItemFilter struct {
+	// Include, if not empty, keeps only the items matching one of its patterns.
+	Include []*regexp.Regexp
+	// Exclude leaves out the items matching one of its patterns, even if they match Include.
+	Exclude []*regexp.Regexp
+	// Since and Until, if not zero, keep only the items published at or after Since and before
+	// Until. Items without a publication date are then left out.
+	Since time.Time
+	Until time.Time
+}
+
+// ParseItemFilter parses the --include and --exclude patterns of an ItemFilter: comma-separated
+// keywords, matched case-insensitively anywhere in the title or description, or regular
+// expressions between slashes such as /April Fools?'? Day/, matched as written (use (?i) for a
+// case-insensitive match). Commas within a regular expression don't separate patterns.
+func ParseItemFilter(include, exclude string) (ItemFilter, error) {
+	var filter ItemFilter
+	var err error
+	if filter.Include, err = parseItemPatterns(include); err != nil {
+		return ItemFilter{}, fmt.Errorf("invalid include filter: %w", err)
+	}
+	if filter.Exclude, err = parseItemPatterns(exclude); err != nil {
+		return ItemFilter{}, fmt.Errorf("invalid exclude filter: %w", err)
+	}
+	return filter, nil
+}
+
+// parseItemPatterns parses a comma-separated list of keywords and /regular expressions/.
+func parseItemPatterns(s string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		var expr string
+		if s[0] == '/' {
+			end := regexEnd(s)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated regular expression %q", s)
+			}
+			expr, s = s[1:end], strings.TrimSpace(s[end+1:])
+			s = strings.TrimPrefix(s, ",")
+		} else {
+			var keyword string
+			keyword, s, _ = strings.Cut(s, ",")
+			if keyword = strings.TrimSpace(keyword); keyword == "" {
+				continue
+			}
+			expr = "(?i)" + regexp.QuoteMeta(keyword)
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// ParsePublishedWindow parses the --since and --until bounds of the publication dates of an
+// ItemFilter. Each is an age before now such as "7d" or "12h" (see utils.ParseMaxAge), a UTC
+// date such as "2026-04-01", or an RFC 3339 time. An --until date includes that whole day. An
+// empty bound is returned as the zero time: no bound.
+func ParsePublishedWindow(since, until string, now time.Time) (time.Time, time.Time, error) {
+	sinceTime, err := parseDateBound(since, now, false)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid --since: %w", err)
+	}
+	untilTime, err := parseDateBound(until, now, true)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid --until: %w", err)
+	}
+	if !sinceTime.IsZero() && !untilTime.IsZero() && !sinceTime.Before(untilTime) {
+		return time.Time{}, time.Time{}, fmt.Errorf("--since %s is not before --until %s", since, until)
+	}
+	return sinceTime, untilTime, nil
+}
+
+// parseDateBound parses a bound of ParsePublishedWindow. A date is the start of the day, or the
+// end of the day if endOfDay is set.
+func parseDateBound(s string, now time.Time, endOfDay bool) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if day, err := time.Parse(time.DateOnly, s); err == nil {
+		if endOfDay {
+			return day.AddDate(0, 0, 1), nil
+		}
+		return day, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	age, err := utils.ParseMaxAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not an age (e.g. 7d or 12h), a date (2006-01-02) or an RFC 3339 time", s)
+	}
+	return now.Add(-age), nil
+}
+
+// regexEnd returns the index of the slash closing the regular expression that starts s: the
+// first slash after the opening one followed by a comma or the end of s, or -1 if there is none.
+func regexEnd(s string) int {
+	for i := 1; i < len(s); i++ {
+		if s[i] != '/' {
+			continue
+		}
+		if rest := strings.TrimSpace(s[i+1:]); rest == "" || rest[0] == ',' {
+			return i
+		}
+	}
+	return -1
+}
+
+// Enabled reports whether f leaves out items.
+func (f ItemFilter) Enabled() bool {
+	return len(f.Include) > 0 || len(f.Exclude) > 0 || !f.Since.IsZero() || !f.Until.IsZero()
+}
+
+// Match reports whether f selects item.
+func (f ItemFilter) Match(item *gofeed.Item) bool {
+	if !f.Since.IsZero() || !f.Until.IsZero() {
+		published := publishedTime(item)
+		if published.IsZero() || published.Before(f.Since) || (!f.Until.IsZero() && !published.Before(f.Until)) {
+			return false
+		}
+	}
+	text := item.Title + "\n" + item.Description
+	if len(f.Include) > 0 && !matchAny(f.Include, text) {
+		return false
+	}
+	return !matchAny(f.Exclude, text)
+}
+
+// publishedTime returns when item was published, or last updated if it has no publication date,
+// or the zero time if it has neither.
+func publishedTime(item *gofeed.Item) time.Time {
+	switch {
+	case item.PublishedParsed != nil:
+		return *item.PublishedParsed
+	case item.UpdatedParsed != nil:
+		return *item.UpdatedParsed
+	}
+	return time.Time{}
+}
+
+// matchAny reports whether one of patterns matches text.
+func matchAny(patterns []*regexp.Regexp, text string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterItems returns the items selected by filter, in feed order.
+func filterItems(items []*gofeed.Item, filter ItemFilter) []*gofeed.Item {
+	if !filter.Enabled() {
+		return items
+	}
+	var selected []*gofeed.Item
+	for _, item := range items {
+		if filter.Match(item) {
+			selected = append(selected, item)
+		}
+	}
+	return selected
+}
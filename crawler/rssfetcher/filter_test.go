@@ -0,0 +1,126 @@
+package rssfetcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestParseItemFilter(t *testing.T) {
+	tests := []struct {
+		name         string
+		include      string
+		exclude      string
+		wantIncludes int
+		wantExcludes int
+		wantErr      bool
+	}{
+		{name: "empty"},
+		{name: "keywords", include: "April Fools, prank ,", exclude: "sports", wantIncludes: 2, wantExcludes: 1},
+		{name: "regex with commas", include: `/\d{1,3} cats/, hoax`, wantIncludes: 2},
+		{name: "regex with slashes", include: `/either/or/`, wantIncludes: 1},
+		{name: "unterminated regex", include: `/prank`, wantErr: true},
+		{name: "invalid regex", exclude: `/(sports/`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseItemFilter(tt.include, tt.exclude)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseItemFilter(%q, %q) error = %v, wantErr %v", tt.include, tt.exclude, err, tt.wantErr)
+			}
+			if len(filter.Include) != tt.wantIncludes || len(filter.Exclude) != tt.wantExcludes {
+				t.Errorf("ParseItemFilter(%q, %q) = %v, want %d include and %d exclude patterns",
+					tt.include, tt.exclude, filter, tt.wantIncludes, tt.wantExcludes)
+			}
+		})
+	}
+}
+
+func TestItemFilter_Match(t *testing.T) {
+	tests := []struct {
+		name    string
+		include string
+		exclude string
+		item    gofeed.Item
+		want    bool
+	}{
+		{name: "no filter", item: gofeed.Item{Title: "Anything"}, want: true},
+		{name: "keyword in title", include: "april fools", item: gofeed.Item{Title: "Our April Fools roundup"}, want: true},
+		{name: "keyword in description", include: "prank", item: gofeed.Item{Title: "News", Description: "<p>A PRANK at city hall</p>"}, want: true},
+		{name: "no include match", include: "prank", item: gofeed.Item{Title: "Budget vote"}, want: false},
+		{name: "excluded", exclude: "sports", item: gofeed.Item{Title: "Sports: cats win the cup"}, want: false},
+		{name: "exclude wins", include: "cats", exclude: "sports", item: gofeed.Item{Title: "Sports: cats win the cup"}, want: false},
+		{name: "case-sensitive regex", include: `/NASA/`, item: gofeed.Item{Title: "nasa finds cats on mars"}, want: false},
+		{name: "case-insensitive regex", include: `/(?i)nasa/`, item: gofeed.Item{Title: "NASA finds cats on Mars"}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseItemFilter(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.Match(&tt.item); got != tt.want {
+				t.Errorf("Match(%+v) = %v, want %v", tt.item, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePublishedWindow(t *testing.T) {
+	now := time.Date(2026, 4, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		since     string
+		until     string
+		wantSince time.Time
+		wantUntil time.Time
+		wantErr   bool
+	}{
+		{name: "empty"},
+		{name: "ages", since: "7d", until: "12h", wantSince: now.AddDate(0, 0, -7), wantUntil: now.Add(-12 * time.Hour)},
+		{name: "dates", since: "2026-04-01", until: "2026-04-01",
+			wantSince: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), wantUntil: time.Date(2026, 4, 2, 0, 0, 0, 0, time.UTC)},
+		{name: "RFC 3339", until: "2026-04-01T09:30:00+02:00", wantUntil: time.Date(2026, 4, 1, 7, 30, 0, 0, time.UTC)},
+		{name: "invalid", since: "last week", wantErr: true},
+		{name: "empty window", since: "1d", until: "2d", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			since, until, err := ParsePublishedWindow(tt.since, tt.until, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePublishedWindow(%q, %q) error = %v, wantErr %v", tt.since, tt.until, err, tt.wantErr)
+			}
+			if !since.Equal(tt.wantSince) || !until.Equal(tt.wantUntil) {
+				t.Errorf("ParsePublishedWindow(%q, %q) = %v, %v, want %v, %v", tt.since, tt.until, since, until, tt.wantSince, tt.wantUntil)
+			}
+		})
+	}
+}
+
+func TestItemFilter_MatchPublished(t *testing.T) {
+	day := func(d int) *time.Time {
+		t := time.Date(2026, 4, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	filter := ItemFilter{Since: *day(2), Until: *day(4)}
+	tests := []struct {
+		name string
+		item gofeed.Item
+		want bool
+	}{
+		{name: "in window", item: gofeed.Item{PublishedParsed: day(3)}, want: true},
+		{name: "at since", item: gofeed.Item{PublishedParsed: day(2)}, want: true},
+		{name: "before since", item: gofeed.Item{PublishedParsed: day(1)}, want: false},
+		{name: "at until", item: gofeed.Item{PublishedParsed: day(4)}, want: false},
+		{name: "updated date", item: gofeed.Item{UpdatedParsed: day(3)}, want: true},
+		{name: "no date", item: gofeed.Item{Title: "Undated"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filter.Match(&tt.item); got != tt.want {
+				t.Errorf("Match(%+v) = %v, want %v", tt.item, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package rssfetcher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/atom"
+	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/crawler/utils"
+)
+
+// maxFeedPages bounds the pages of a paginated feed read in one fetch, including the first, so
+// that a sample or a strict filter doesn't walk an archive of thousands of pages.
+const maxFeedPages = 50
+
+// pageLimit decides how many pages of a paginated feed (RFC 5005) are read: enough for
+// maxArticles items selected by filter, or all of them for a sample.
+type pageLimit struct {
+	maxArticles int
+	sample      utils.Sample
+	filter      ItemFilter
+}
+
+// needMore reports whether the items read so far from a paginated feed are not enough. Feeds list
+// their newest items first, so the pages following an item published before filter.Since are
+// not read either.
+func (l pageLimit) needMore(items []*gofeed.Item) bool {
+	if len(items) > 0 && !l.filter.Since.IsZero() {
+		if published := publishedTime(items[len(items)-1]); !published.IsZero() && published.Before(l.filter.Since) {
+			return false
+		}
+	}
+	return l.sample.Enabled() || len(filterItems(items, l.filter)) < l.maxArticles
+}
+
+// atomPageTranslator translates Atom feeds like gofeed does, keeping the link to their next page
+// that gofeed leaves out.
+type atomPageTranslator struct {
+	gofeed.DefaultAtomTranslator
+	next string
+}
+
+func (t *atomPageTranslator) Translate(feed interface{}) (*gofeed.Feed, error) {
+	if atomFeed, ok := feed.(*atom.Feed); ok {
+		for _, link := range atomFeed.Links {
+			if link.Rel == "next" {
+				t.next = link.Href
+			}
+		}
+	}
+	return t.DefaultAtomTranslator.Translate(feed)
+}
+
+// parseFeedPage parses the feed document at pageURL and returns it with the URL of its next page:
+// its rel="next" link (an atom:link in an RSS feed), resolved against pageURL, or "" if it has
+// none or the link isn't an http(s) URL.
+func parseFeedPage(body io.Reader, pageURL string) (*gofeed.Feed, string, error) {
+	translator := &atomPageTranslator{}
+	parser := gofeed.NewParser()
+	parser.AtomTranslator = translator
+	feed, err := parser.Parse(body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := translator.next
+	for _, key := range []string{"atom", "atom10", "atom03"} {
+		for _, link := range feed.Extensions[key]["link"] {
+			if link.Attrs["rel"] == "next" {
+				next = link.Attrs["href"]
+			}
+		}
+	}
+	next = strings.TrimSpace(next)
+	if next == "" {
+		return feed, "", nil
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return feed, "", nil
+	}
+	nextURL, err := base.Parse(next)
+	if err != nil || (nextURL.Scheme != "http" && nextURL.Scheme != "https") {
+		return feed, "", nil
+	}
+	return feed, nextURL.String(), nil
+}
+
+// readFeedBody reads a feed document from body, up to the MaxBodySize of fetchOptions.
+func readFeedBody(body io.Reader, fetchOptions fetcher.Options) (io.Reader, error) {
+	maxSize := fetchOptions.MaxBodySize
+	if maxSize <= 0 {
+		maxSize = fetcher.DefaultMaxBodySize
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%w: more than %d bytes", fetcher.ErrBodyTooLarge, maxSize)
+	}
+	return bytes.NewReader(data), nil
+}
+
+// fetchFeedPage downloads and parses the page at pageURL of the feed at feedURL and returns its
+// items and the URL of its next page. The credentials of fetchOptions are only sent to the host
+// of the feed.
+func fetchFeedPage(
+	ctx context.Context,
+	httpClient *http.Client,
+	feedURL, pageURL string,
+	fetchOptions fetcher.Options,
+) ([]*gofeed.Item, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating feed page request: %w", err)
+	}
+	req.Header.Set("User-Agent", feedUserAgent)
+	if feed, err := url.Parse(feedURL); err == nil && strings.EqualFold(feed.Hostname(), req.URL.Hostname()) {
+		fetchOptions.Credentials.Apply(req)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("error fetching feed page: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", fmt.Errorf("error fetching feed page: unexpected status code: %d", resp.StatusCode)
+	}
+	body, err := readFeedBody(resp.Body, fetchOptions)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading feed page: %w", err)
+	}
+	feed, next, err := parseFeedPage(body, resp.Request.URL.String())
+	if err != nil {
+		return nil, "", fmt.Errorf("error parsing feed page: %w", err)
+	}
+	return feed.Items, next, nil
+}
+
+// readNextPages follows the next links of a paginated feed from next while limit needs more items
+// than items, up to maxFeedPages pages in total with the pagesRead already read. It returns items
+// with those of the pages read, without the items already listed by an earlier page, the URL
+// of the page that would have been read next ("" at the end of the feed), and the number of pages
+// read. A page that can't be read ends the walk without an error, since the items of the earlier
+// pages can still be fetched; it is read again on the next fetch.
+func readNextPages(
+	ctx context.Context,
+	httpClient *http.Client,
+	feedURL string,
+	items []*gofeed.Item,
+	next string,
+	pagesRead int,
+	limit pageLimit,
+	fetchOptions fetcher.Options,
+) ([]*gofeed.Item, string, int) {
+	links := make(map[string]bool)
+	for _, item := range items {
+		links[item.Link] = true
+	}
+	visited := map[string]bool{feedURL: true}
+	read := 0
+	for next != "" && pagesRead+read < maxFeedPages && limit.needMore(items) {
+		if visited[next] {
+			slog.WarnContext(ctx, "Feed pagination loops, ignoring the next page", "page", next)
+			return items, "", read
+		}
+		visited[next] = true
+
+		pageItems, pageNext, err := fetchFeedPage(ctx, httpClient, feedURL, next, fetchOptions)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to read feed page, using the items of the earlier pages", "page", next, "error", err)
+			return items, next, read
+		}
+		read++
+		for _, item := range pageItems {
+			if item.Link == "" || !links[item.Link] {
+				links[item.Link] = true
+				items = append(items, item)
+			}
+		}
+		next = pageNext
+	}
+	return items, next, read
+}
@@ -0,0 +1,241 @@
+package rssfetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/crawler/utils"
+	"github.com/zeace/poisson/lib"
+)
+
+func TestParseFeedPage(t *testing.T) {
+	tests := []struct {
+		name     string
+		feed     string
+		wantNext string
+	}{
+		{
+			name: "rss atom link",
+			feed: `<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel><title>Feed</title>
+<atom:link rel="self" href="https://example.com/feed.xml"/><atom:link rel="next" href="feed.xml?page=2"/>
+<item><title>One</title><link>https://example.com/1</link></item></channel></rss>`,
+			wantNext: "https://example.com/feeds/feed.xml?page=2",
+		},
+		{
+			name: "atom link",
+			feed: `<feed xmlns="http://www.w3.org/2005/Atom"><title>Feed</title>
+<link rel="self" href="https://example.com/feed.atom"/><link rel="next" href="https://example.com/feed.atom?page=2"/>
+<entry><title>One</title><link href="https://example.com/1"/></entry></feed>`,
+			wantNext: "https://example.com/feed.atom?page=2",
+		},
+		{
+			name:     "last page",
+			feed:     `<rss version="2.0"><channel><title>Feed</title><item><title>One</title><link>https://example.com/1</link></item></channel></rss>`,
+			wantNext: "",
+		},
+		{
+			name: "not http",
+			feed: `<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel><title>Feed</title>
+<atom:link rel="next" href="ftp://example.com/feed.xml"/></channel></rss>`,
+			wantNext: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed, next, err := parseFeedPage(strings.NewReader(tt.feed), "https://example.com/feeds/feed.xml")
+			if err != nil {
+				t.Fatalf("parseFeedPage() error = %v", err)
+			}
+			if next != tt.wantNext {
+				t.Errorf("next = %q, want %q", next, tt.wantNext)
+			}
+			if len(feed.Items) == 0 && tt.name != "not http" {
+				t.Error("expected the items of the page")
+			}
+		})
+	}
+}
+
+func TestReadFeedBody(t *testing.T) {
+	feed := `<rss version="2.0"><channel><title>Feed</title></channel></rss>`
+	if _, err := readFeedBody(strings.NewReader(feed), fetcher.Options{MaxBodySize: int64(len(feed))}); err != nil {
+		t.Errorf("readFeedBody() error = %v", err)
+	}
+	if _, err := readFeedBody(strings.NewReader(feed), fetcher.Options{MaxBodySize: 16}); !errors.Is(err, fetcher.ErrBodyTooLarge) {
+		t.Errorf("readFeedBody() of a large feed error = %v, want %v", err, fetcher.ErrBodyTooLarge)
+	}
+}
+
+func TestPageLimit_NeedMore(t *testing.T) {
+	now := time.Now()
+	item := func(title string, age time.Duration) *gofeed.Item {
+		published := now.Add(-age)
+		return &gofeed.Item{Title: title, Link: "https://example.com/" + title, PublishedParsed: &published}
+	}
+	items := []*gofeed.Item{item("cats", time.Hour), item("dogs", 2*time.Hour), item("cats again", 3*time.Hour)}
+	include, err := ParseItemFilter("cats", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := include
+	since.Since = now.Add(-150 * time.Minute)
+
+	tests := []struct {
+		name  string
+		limit pageLimit
+		want  bool
+	}{
+		{name: "enough items", limit: pageLimit{maxArticles: 3}, want: false},
+		{name: "too few items", limit: pageLimit{maxArticles: 4}, want: true},
+		{name: "too few selected items", limit: pageLimit{maxArticles: 3, filter: include}, want: true},
+		{name: "sample", limit: pageLimit{maxArticles: 1, sample: utils.Sample{Count: 10}}, want: true},
+		{name: "items older than since", limit: pageLimit{maxArticles: 10, filter: since}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.limit.needMore(items); got != tt.want {
+				t.Errorf("needMore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// pagedFeedServer serves an RSS feed of pages pages of perPage items at /feed.xml, the next pages
+// at /feed.xml?page=N, and the articles. With etag, the first page answers conditional requests.
+// The last page links back to the first one if loop is set.
+type pagedFeedServer struct {
+	*httptest.Server
+	pages, perPage int
+	etag           string
+	loop           bool
+
+	mu        sync.Mutex
+	requested map[string]int
+}
+
+func newPagedFeedServer(pages, perPage int, etag string, loop bool) *pagedFeedServer {
+	s := &pagedFeedServer{pages: pages, perPage: perPage, etag: etag, loop: loop, requested: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *pagedFeedServer) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/feed.xml" {
+		fmt.Fprintf(w, "<html><head><title>%s</title></head><body><article><p>%s</p></article></body></html>",
+			r.URL.Path, strings.Repeat("Cats were elected to every seat of the city council. ", 20))
+		return
+	}
+	page := 1
+	if p := r.URL.Query().Get("page"); p != "" {
+		fmt.Sscanf(p, "%d", &page)
+	}
+	s.mu.Lock()
+	s.requested[fmt.Sprintf("page %d", page)]++
+	s.mu.Unlock()
+	if page == 1 && s.etag != "" {
+		if r.Header.Get("If-None-Match") == s.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", s.etag)
+	}
+
+	var b strings.Builder
+	b.WriteString(`<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"><channel><title>Feed</title>`)
+	if page < s.pages {
+		fmt.Fprintf(&b, `<atom:link rel="next" href="/feed.xml?page=%d"/>`, page+1)
+	} else if s.loop {
+		b.WriteString(`<atom:link rel="next" href="/feed.xml"/>`)
+	}
+	for i := 1; i <= s.perPage; i++ {
+		fmt.Fprintf(&b, `<item><title>Item %[1]d-%[2]d</title><link>%[3]s/article-%[1]d-%[2]d</link></item>`, page, i, s.URL)
+	}
+	b.WriteString(`</channel></rss>`)
+	w.Write([]byte(b.String()))
+}
+
+func (s *pagedFeedServer) requests(page int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requested[fmt.Sprintf("page %d", page)]
+}
+
+func TestFetchRSSArticles_Pagination(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxArticles int
+		loop        bool
+		wantPages   int
+		wantItems   int
+	}{
+		{name: "first page is enough", maxArticles: 2, wantPages: 1, wantItems: 2},
+		{name: "stops once enough items", maxArticles: 5, wantPages: 2, wantItems: 5},
+		{name: "whole feed", maxArticles: 20, wantPages: 3, wantItems: 9},
+		{name: "pagination loop", maxArticles: 20, loop: true, wantPages: 3, wantItems: 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newPagedFeedServer(3, 3, "", tt.loop)
+			defer server.Close()
+
+			pages, summary, err := FetchRSSArticles(context.Background(), server.URL+"/feed.xml", tt.maxArticles, utils.Sample{}, ItemFilter{},
+				false, lib.NewMockDatastoreClient(), fetcher.Options{Cache: testCache(t), AllowPrivateAddresses: true})
+			if err != nil {
+				t.Fatalf("FetchRSSArticles() error = %v", err)
+			}
+			if summary.Pages != tt.wantPages || summary.Items != tt.wantItems || len(pages) != tt.wantItems {
+				t.Errorf("got %d page(s), %d item(s) and %d article(s), want %d pages and %d items",
+					summary.Pages, summary.Items, len(pages), tt.wantPages, tt.wantItems)
+			}
+			if got := server.requests(tt.wantPages + 1); got != 0 {
+				t.Errorf("page %d requested %d times, want 0", tt.wantPages+1, got)
+			}
+			if got := server.requests(1); got != 1 {
+				t.Errorf("first page requested %d times, want 1", got)
+			}
+		})
+	}
+}
+
+func TestFetchRSSArticles_PaginationNotModified(t *testing.T) {
+	server := newPagedFeedServer(3, 3, `"v1"`, false)
+	defer server.Close()
+	ctx := context.Background()
+	feedURL := server.URL + "/feed.xml"
+	mockDS := lib.NewMockDatastoreClient()
+	options := fetcher.Options{Cache: testCache(t), AllowPrivateAddresses: true}
+
+	if _, _, err := FetchRSSArticles(ctx, feedURL, 2, utils.Sample{}, ItemFilter{}, false, mockDS, options); err != nil {
+		t.Fatalf("FetchRSSArticles() error = %v", err)
+	}
+	state := mockDS.FeedStates[feedURL]
+	if len(state.Items) != 3 || state.NextPage != feedURL+"?page=2" {
+		t.Fatalf("feed state has %d items and next page %q, want the first page and its next page", len(state.Items), state.NextPage)
+	}
+
+	// The feed is not modified, and the recorded items are completed from the recorded next page
+	_, summary, err := FetchRSSArticles(ctx, feedURL, 5, utils.Sample{}, ItemFilter{}, false, mockDS, options)
+	if err != nil {
+		t.Fatalf("FetchRSSArticles() error = %v", err)
+	}
+	if !summary.NotModified || summary.Pages != 1 || summary.Items != 5 {
+		t.Errorf("unexpected summary %+v, want 5 items after reading one more page of a feed not modified", summary)
+	}
+	state = mockDS.FeedStates[feedURL]
+	if len(state.Items) != 6 || state.NextPage != feedURL+"?page=3" || state.ETag != `"v1"` {
+		t.Errorf("feed state has %d items, next page %q and ETag %q, want 6 items, page 3 and the ETag of the feed",
+			len(state.Items), state.NextPage, state.ETag)
+	}
+	if got := server.requests(2); got != 1 {
+		t.Errorf("page 2 requested %d times, want 1", got)
+	}
+}
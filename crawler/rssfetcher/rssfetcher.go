@@ -2,94 +2,313 @@ package rssfetcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/mmcdole/gofeed"
 	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/crawler/utils"
 	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
 	"github.com/zeace/poisson/models"
 )
 
+// feedUserAgent is sent with feed requests; it is the one gofeed uses by default.
+const feedUserAgent = "Gofeed/1.0"
+
+// fetchFeed downloads and parses the feed at feedURL and returns its items, sending the
+// credentials of fetchOptions if they are set. The feed is fetched through the proxy of the
+// articles, and refused on a private, loopback or link-local address unless
+// fetchOptions.AllowPrivateAddresses is set.
+// The request is conditional on the validators of the last response recorded in the Datastore
+// (see models.FeedState): if the server answers 304 Not Modified, the recorded items are used
+// without parsing anything, and true is returned.
+// If the feed is paginated (RFC 5005), its next pages are read while limit needs more items (see
+// readNextPages). It also returns the number of pages downloaded.
+func fetchFeed(
+	ctx context.Context,
+	feedURL string,
+	limit pageLimit,
+	fetchOptions fetcher.Options,
+	datastoreClient lib.DatastoreClient,
+) ([]*gofeed.Item, int, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("error creating feed request: %w", err)
+	}
+	req.Header.Set("User-Agent", feedUserAgent)
+	state := readFeedState(ctx, datastoreClient, feedURL, fetchOptions)
+	if state != nil {
+		setFeedValidators(req, state)
+	}
+	fetchOptions.Credentials.Apply(req)
+
+	httpClient := fetcher.NewHTTPClient(fetchOptions, 0)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("error fetching RSS feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var items []*gofeed.Item
+	var next string
+	pages := 0
+	newState := &models.FeedState{URL: feedURL}
+	notModified := resp.StatusCode == http.StatusNotModified && state != nil
+	if notModified {
+		// The recorded items are those of every page read last time
+		items, next = feedStateItems(state), state.NextPage
+		newState.ETag, newState.LastModified = state.ETag, state.LastModified
+	} else {
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return nil, 0, false, fmt.Errorf("error fetching RSS feed: unexpected status code: %d", resp.StatusCode)
+		}
+		body, err := readFeedBody(resp.Body, fetchOptions)
+		if err != nil {
+			return nil, 0, false, fmt.Errorf("error reading RSS feed: %w", err)
+		}
+		feed, feedNext, err := parseFeedPage(body, resp.Request.URL.String())
+		if err != nil {
+			return nil, 0, false, fmt.Errorf("error parsing RSS feed: %w", err)
+		}
+		items, next, pages = feed.Items, feedNext, 1
+		newState.ETag, newState.LastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	}
+
+	items, next, read := readNextPages(ctx, httpClient, feedURL, items, next, pages, limit, fetchOptions)
+	if pages+read > 0 {
+		newState.NextPage = next
+		writeFeedState(ctx, datastoreClient, newState, items)
+	}
+	return items, pages + read, notModified, nil
+}
+
+// readStoredArticles returns the results of fetching urls under fetchOptions, in order: the
+// articles served from the Datastore cache are read first, concurrently and without a request,
+// and the others are fetched concurrently using fetcher.FetchMany, which doesn't look up again
+// those found not stored. It counts the former as Cached in summary and also returns which URLs
+// were already stored, fresh or not.
+func readStoredArticles(
+	ctx context.Context,
+	urls []string,
+	verbose bool,
+	datastoreClient lib.DatastoreClient,
+	fetchOptions fetcher.Options,
+	summary *FetchSummary,
+) ([]fetcher.FetchResult, map[string]bool) {
+	results := make([]fetcher.FetchResult, len(urls))
+	errs := make([]error, len(urls))
+	cacheOnly := fetchOptions
+	cacheOnly.CacheOnly = true
+	concurrency := fetchOptions.Concurrency
+	if concurrency <= 0 {
+		concurrency = fetcher.DefaultConcurrency
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			page, cachePath, err := fetcher.FetchArticleContent(ctx, url, false, datastoreClient, cacheOnly)
+			results[i], errs[i] = fetcher.FetchResult{URL: url, Page: page, CachePath: cachePath}, err
+		}()
+	}
+	wg.Wait()
+
+	stored := make(map[string]bool)
+	fetchOptions.NotStored = make(map[string]bool)
+	var toFetch []string
+	var toFetchIndexes []int
+	for i, url := range urls {
+		switch {
+		case errs[i] == nil:
+			stored[url] = true
+			summary.Cached++
+			continue
+		case errors.Is(errs[i], fetcher.ErrCacheExpired):
+			stored[url] = true
+		case errors.Is(errs[i], fetcher.ErrNotCached):
+			fetchOptions.NotStored[lib.NormalizeURL(url)] = true
+		}
+		// Errors reading the Datastore are reported by the fetch
+		toFetch = append(toFetch, url)
+		toFetchIndexes = append(toFetchIndexes, i)
+	}
+	if verbose {
+		slog.InfoContext(ctx, "Read stored articles", "cached", summary.Cached, "to_fetch", len(toFetch))
+	}
+
+	// Fetch concurrently, capped globally and per host by fetchOptions
+	for i, result := range fetcher.FetchMany(ctx, toFetch, verbose, datastoreClient, fetchOptions) {
+		results[toFetchIndexes[i]] = result
+	}
+	return results, stored
+}
+
 // FetchRSSArticles fetches an RSS feed from the given URL and then fetches
-// the content of the first maxArticles articles using FetchArticleContent.
+// the content of the first maxArticles articles concurrently using fetcher.FetchMany. The next
+// pages of a paginated feed are read until it lists enough of them (see pageLimit). Articles
+// already in the Datastore cache are returned without a request (see readStoredArticles).
+// If sample is enabled, a random sample of all the items is fetched instead (see utils.Sample).
+// Only the items selected by filter are considered, before the maximum or the sample.
 // If datastoreClient and ctx are provided, crawled pages will be saved to Datastore.
-// Returns a slice of CrawledPage and any errors encountered.
-func FetchRSSArticles(ctx context.Context, feedURL string, maxArticles int, verbose bool, datastoreClient lib.DatastoreClient) ([]*models.CrawledPage, error) {
+// Pages excluded by their robots directives under fetchOptions are left out of the result.
+// The summary lists the items that were skipped or failed; some failures are not an error.
+// It returns an error, with the summary, only if the feed can't be read (the summary is then
+// nil) or no article could be fetched.
+func FetchRSSArticles(
+	ctx context.Context,
+	feedURL string,
+	maxArticles int,
+	sample utils.Sample,
+	filter ItemFilter,
+	verbose bool,
+	datastoreClient lib.DatastoreClient,
+	fetchOptions fetcher.Options,
+) ([]*models.CrawledPage, *FetchSummary, error) {
+	ctx = logging.WithAttrs(ctx, "feed", feedURL)
 	if verbose {
-		log.Printf("Fetching RSS feed from: %s\n", feedURL)
+		slog.InfoContext(ctx, "Fetching RSS feed")
 	}
 
-	// Parse the RSS feed
-	fp := gofeed.NewParser()
-	feed, err := fp.ParseURL(feedURL)
+	limit := pageLimit{maxArticles: maxArticles, sample: sample, filter: filter}
+	items, feedPages, notModified, err := fetchFeed(ctx, feedURL, limit, fetchOptions, datastoreClient)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing RSS feed: %w", err)
+		return nil, nil, err
 	}
 
-	if verbose {
-		log.Printf("Found %d items in RSS feed\n", len(feed.Items))
+	if verbose && notModified {
+		slog.InfoContext(ctx, "RSS feed not modified, using the recorded items", "items", len(items), "pages", feedPages)
+	} else if verbose {
+		slog.InfoContext(ctx, "Parsed RSS feed", "items", len(items), "pages", feedPages)
 	}
 
-	// Limit to maxArticles
-	itemsToFetch := maxArticles
-	if len(feed.Items) < itemsToFetch {
-		itemsToFetch = len(feed.Items)
+	selected := filterItems(items, filter)
+	filtered := len(items) - len(selected)
+	items = selected
+	if verbose && filter.Enabled() {
+		slog.InfoContext(ctx, "Filtered feed items", "selected", len(items), "filtered", filtered)
 	}
 
-	if verbose {
-		log.Printf("Fetching first %d articles...\n", itemsToFetch)
+	// Limit to maxArticles, or sample the whole feed
+	if sample.Enabled() {
+		items = utils.SampleItems(items, sample)
+		if verbose {
+			slog.InfoContext(ctx, "Sampled feed items", "sample", sample.String(), "sampled", len(items))
+		}
+	} else if len(items) > maxArticles {
+		items = items[:maxArticles]
 	}
+	itemsToFetch := len(items)
+	summary := &FetchSummary{Feed: feedURL, Items: itemsToFetch, Filtered: filtered, NotModified: notModified, Pages: feedPages}
 
-	var pages []*models.CrawledPage
-	var fetchErrors []error
+	if verbose {
+		slog.InfoContext(ctx, "Fetching articles", "count", itemsToFetch)
+	}
 
+	// Collect article URLs, skipping items without a link
+	var articleURLs []string
+	titles := make(map[string]string)
+	fetchOptions.FeedItems = make(map[string]models.FeedItemMetadata)
 	for i := 0; i < itemsToFetch; i++ {
-		item := feed.Items[i]
-		articleURL := item.Link
-
-		if articleURL == "" {
+		item := items[i]
+		if item.Link == "" {
+			summary.Skipped = append(summary.Skipped, ArticleOutcome{Title: item.Title, Reason: "no URL"})
 			if verbose {
-				log.Printf("Skipping item %d: no URL found\n", i+1)
+				slog.InfoContext(ctx, "Skipping item: no URL found", "item", i+1)
 			}
 			continue
 		}
-
 		if verbose {
-			log.Printf("\n[%d/%d] Fetching: %s\n", i+1, itemsToFetch, articleURL)
-			if item.Title != "" {
-				log.Printf("  Title: %s\n", item.Title)
-			}
+			slog.InfoContext(ctx, "Queued article", "item", i+1, "of", itemsToFetch, "url", item.Link, "title", item.Title)
 		}
+		articleURLs = append(articleURLs, item.Link)
+		titles[item.Link] = item.Title
+		fetchOptions.FeedItems[lib.NormalizeURL(item.Link)] = feedItemMetadata(feedURL, item)
+	}
 
-		page, _, err := fetcher.FetchArticleContent(ctx, articleURL, verbose, datastoreClient)
-		if err != nil {
-			fetchErrors = append(fetchErrors, fmt.Errorf("article %s: %w", articleURL, err))
+	var pages []*models.CrawledPage
+
+	fetchOptions.Source = models.SourceRef{Kind: models.SourceKindRSS, ID: feedURL}
+	results, stored := readStoredArticles(ctx, articleURLs, verbose, datastoreClient, fetchOptions, summary)
+	for _, result := range results {
+		if errors.Is(result.Err, fetcher.ErrFetchCooldown) {
+			summary.Skipped = append(summary.Skipped, ArticleOutcome{URL: result.URL, Title: titles[result.URL], Reason: result.Err.Error()})
+			if verbose {
+				slog.InfoContext(ctx, "Skipping article after failed fetches", "url", result.URL, "error", result.Err)
+			}
+			continue
+		}
+		if result.Err != nil {
+			summary.Failed = append(summary.Failed, ArticleOutcome{URL: result.URL, Title: titles[result.URL], Reason: result.Err.Error()})
+			if verbose {
+				slog.WarnContext(ctx, "Error fetching article", "url", result.URL, "error", result.Err)
+			}
+			continue
+		}
+		if result.Page.RobotsExcluded {
+			summary.Skipped = append(summary.Skipped, ArticleOutcome{URL: result.URL, Title: titles[result.URL], Reason: "excluded by robots directives"})
 			if verbose {
-				log.Printf("  Error: %v\n", err)
+				slog.InfoContext(ctx, "Skipping article: excluded by robots directives", "url", result.URL)
 			}
 			continue
 		}
 
-		pages = append(pages, page)
+		result.Page.Feed = feedURL
+		pages = append(pages, result.Page)
+		summary.countPage(result.Page, stored[result.URL])
 	}
 
-	// If we have errors and no pages, return an error
-	if len(pages) == 0 && len(fetchErrors) > 0 {
-		return nil, fmt.Errorf("failed to fetch any articles: %v", fetchErrors)
+	if len(pages) == 0 && len(summary.Failed) > 0 {
+		return nil, summary, fmt.Errorf("failed to fetch any of the %d article(s) of the feed", len(summary.Failed))
+	}
+	if summary.Partial() && verbose {
+		slog.WarnContext(ctx, "Some articles could not be fetched",
+			"fetched", summary.Fetched, "failed", len(summary.Failed))
 	}
 
-	// If we got some pages but also some errors, return pages with an error indicating partial failure
-	if len(pages) > 0 && len(fetchErrors) > 0 {
-		if verbose {
-			log.Printf("\nWarning: %d article(s) fetched successfully, but %d error(s) occurred:\n", len(pages), len(fetchErrors))
-			for _, err := range fetchErrors {
-				log.Printf("  - %v\n", err)
-			}
+	return pages, summary, nil
+}
+
+// feedItemMetadata returns the metadata of item recorded on its page (see models.FeedItemMetadata).
+func feedItemMetadata(feedURL string, item *gofeed.Item) models.FeedItemMetadata {
+	return models.FeedItemMetadata{
+		Feed:        feedURL,
+		PublishedAt: publishedTime(item),
+		Author:      itemAuthor(item),
+		Categories:  itemCategories(item),
+	}
+}
+
+// itemAuthor returns the names of the authors of item, comma-separated, or empty if it names none.
+func itemAuthor(item *gofeed.Item) string {
+	var names []string
+	for _, author := range item.Authors {
+		if author == nil {
+			continue
+		}
+		if name := strings.TrimSpace(author.Name); name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
 		}
-		return pages, fmt.Errorf("partial success: fetched %d article(s) but %d error(s) occurred: %v",
-			len(pages), len(fetchErrors), fetchErrors)
 	}
+	return strings.Join(names, ", ")
+}
 
-	return pages, nil
+// itemCategories returns the categories of item, without blanks and duplicates.
+func itemCategories(item *gofeed.Item) []string {
+	var categories []string
+	for _, category := range item.Categories {
+		if category = strings.TrimSpace(category); category != "" && !slices.Contains(categories, category) {
+			categories = append(categories, category)
+		}
+	}
+	return categories
 }
@@ -0,0 +1,388 @@
+package rssfetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/crawler/utils"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// testCache returns a page cache in a temporary directory, so that the fetches of tests don't
+// fill the cache directory of the package.
+func testCache(t *testing.T) fetcher.PageCache {
+	return fetcher.NewDiskCache(t.TempDir(), 0)
+}
+
+func TestFetchRSSArticles_Summary(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			fmt.Fprintf(w, `<rss version="2.0"><channel><title>Feed</title>
+<item><title>Good</title><link>%[1]s/good</link></item>
+<item><title>Missing</title><link>%[1]s/missing</link></item>
+<item><title>No link</title></item>
+</channel></rss>`, server.URL)
+		case "/good":
+			fmt.Fprintf(w, `<html><head><title>Good</title></head><body><article><p>%s</p></article></body></html>`,
+				strings.Repeat("Cats were elected to every seat of the city council. ", 20))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	pages, summary, err := FetchRSSArticles(ctx, server.URL+"/feed.xml", 10, utils.Sample{}, ItemFilter{}, false, mockDS, fetcher.Options{Cache: testCache(t), AllowPrivateAddresses: true})
+	if err != nil {
+		t.Fatalf("FetchRSSArticles() error = %v, want nil for a partial failure", err)
+	}
+	if len(pages) != 1 || pages[0].Feed != server.URL+"/feed.xml" {
+		t.Fatalf("FetchRSSArticles() pages = %v, want the good article", pages)
+	}
+	if summary.Items != 3 || summary.Fetched != 1 || summary.New != 1 || summary.CacheHits != 0 || !summary.Partial() {
+		t.Errorf("summary = %+v, want 3 items, 1 fetched and new, partial", summary)
+	}
+	if !summary.IsNew(pages[0]) {
+		t.Error("IsNew() = false for the article fetched first")
+	}
+	if len(summary.Skipped) != 1 || summary.Skipped[0].Title != "No link" {
+		t.Errorf("Skipped = %+v, want the item without a link", summary.Skipped)
+	}
+	if len(summary.Failed) != 1 || summary.Failed[0].URL != server.URL+"/missing" || summary.Failed[0].Reason == "" {
+		t.Errorf("Failed = %+v, want the missing article with a reason", summary.Failed)
+	}
+
+	// The second run reads the good article from the Datastore cache
+	pages, summary, err = FetchRSSArticles(ctx, server.URL+"/feed.xml", 10, utils.Sample{}, ItemFilter{}, false, mockDS, fetcher.Options{Cache: testCache(t), AllowPrivateAddresses: true})
+	if err != nil || summary.CacheHits != 1 || summary.Cached != 1 || summary.New != 0 {
+		t.Errorf("second run summary = %+v, %v, want 1 cached article and none new", summary, err)
+	}
+	if len(pages) != 1 || summary.IsNew(pages[0]) {
+		t.Errorf("second run pages = %v, want the stored article, not new", pages)
+	}
+}
+
+func TestFetchRSSArticles_StoredItems(t *testing.T) {
+	var server *httptest.Server
+	var requests sync.Map
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Store(r.URL.Path, true)
+		if r.URL.Path == "/feed.xml" {
+			fmt.Fprintf(w, `<rss version="2.0"><channel><title>Feed</title>
+<item><title>Stored</title><link>%[1]s/stored</link></item>
+<item><title>Stale</title><link>%[1]s/stale</link></item>
+<item><title>New</title><link>%[1]s/new</link></item>
+</channel></rss>`, server.URL)
+			return
+		}
+		fmt.Fprintf(w, `<html><head><title>%s</title></head><body><article><p>%s</p></article></body></html>`,
+			r.URL.Path, strings.Repeat("Cats were elected to every seat of the city council. ", 20))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	mockDS := &countingDatastoreClient{MockDatastoreClient: lib.NewMockDatastoreClient(), reads: make(map[string]int)}
+	now := time.Now()
+	for path, fetched := range map[string]time.Time{"/stored": now, "/stale": now.AddDate(0, 0, -30)} {
+		page := &models.CrawledPage{URL: lib.NormalizeURL(server.URL + path), Title: path, Content: "Stored text.", DateTime: fetched}
+		if err := mockDS.SaveCrawledPage(ctx, page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	maxAge, err := fetcher.ParseCacheMaxAge("7d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages, summary, err := FetchRSSArticles(ctx, server.URL+"/feed.xml", 10, utils.Sample{}, ItemFilter{}, false, mockDS,
+		fetcher.Options{Cache: testCache(t), AllowPrivateAddresses: true, CacheMaxAge: maxAge})
+	if err != nil {
+		t.Fatalf("FetchRSSArticles() error = %v", err)
+	}
+	if len(pages) != 3 || pages[0].Title != "/stored" || pages[0].Feed != server.URL+"/feed.xml" || pages[2].Title != "/new" {
+		t.Fatalf("FetchRSSArticles() pages = %v, want the 3 articles in feed order", pages)
+	}
+	if summary.Fetched != 3 || summary.Cached != 1 || summary.New != 1 || summary.CacheHits != 1 {
+		t.Errorf("summary = %+v, want 3 fetched, 1 cached, 1 new", summary)
+	}
+	if _, requested := requests.Load("/stored"); requested {
+		t.Error("stored article requested from its server")
+	}
+	for _, path := range []string{"/stale", "/new"} {
+		if _, requested := requests.Load(path); !requested {
+			t.Errorf("%s not requested from its server", path)
+		}
+	}
+	// The article found not stored isn't looked up again before it is fetched
+	if reads := mockDS.readsOf(lib.NormalizeURL(server.URL + "/new")); reads != 1 {
+		t.Errorf("new article read %d times from the Datastore, want once", reads)
+	}
+}
+
+// countingDatastoreClient counts the reads of each crawled page.
+type countingDatastoreClient struct {
+	*lib.MockDatastoreClient
+	mu    sync.Mutex
+	reads map[string]int
+}
+
+func (c *countingDatastoreClient) ReadCrawledPage(ctx context.Context, url string) (*models.CrawledPage, bool, error) {
+	c.mu.Lock()
+	c.reads[url]++
+	c.mu.Unlock()
+	return c.MockDatastoreClient.ReadCrawledPage(ctx, url)
+}
+
+func (c *countingDatastoreClient) readsOf(url string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reads[url]
+}
+
+func TestFetchRSSArticles_NotModified(t *testing.T) {
+	const etag = `"v1"`
+	var server *httptest.Server
+	var feedDownloads, conditionalRequests int
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/feed.xml" {
+			fmt.Fprintf(w, `<html><head><title>%s</title></head><body><article><p>%s</p></article></body></html>`,
+				r.URL.Path, strings.Repeat("Cats were elected to every seat of the city council. ", 20))
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			conditionalRequests++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		feedDownloads++
+		w.Header().Set("ETag", etag)
+		fmt.Fprintf(w, `<rss version="2.0"><channel><title>Feed</title>
+<item><title>First</title><link>%[1]s/first</link></item>
+<item><title>Second</title><link>%[1]s/second</link></item>
+</channel></rss>`, server.URL)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	fetchOptions := fetcher.Options{Cache: testCache(t), AllowPrivateAddresses: true}
+	_, summary, err := FetchRSSArticles(ctx, server.URL+"/feed.xml", 10, utils.Sample{}, ItemFilter{}, false, mockDS, fetchOptions)
+	if err != nil || summary.NotModified {
+		t.Fatalf("first run summary = %+v, %v, want the downloaded feed", summary, err)
+	}
+	state := mockDS.FeedStates[server.URL+"/feed.xml"]
+	if state == nil || state.ETag != etag || len(state.Items) != 2 || state.Items[1].Title != "Second" {
+		t.Fatalf("feed state = %+v, want the ETag and the 2 items", state)
+	}
+
+	// The second run sends the ETag and reads the items from the feed state
+	pages, summary, err := FetchRSSArticles(ctx, server.URL+"/feed.xml", 10, utils.Sample{}, ItemFilter{}, false, mockDS, fetchOptions)
+	if err != nil || !summary.NotModified || summary.Items != 2 {
+		t.Fatalf("second run summary = %+v, %v, want the 2 items of the unmodified feed", summary, err)
+	}
+	if len(pages) != 2 || pages[0].Title != "/first" || pages[1].Title != "/second" {
+		t.Errorf("second run pages = %v, want the 2 articles in feed order", pages)
+	}
+	if feedDownloads != 1 || conditionalRequests != 1 {
+		t.Errorf("feed downloaded %d times with %d conditional requests, want 1 and 1", feedDownloads, conditionalRequests)
+	}
+
+	// Forcing a refresh downloads the feed again
+	fetchOptions.ForceRefresh = true
+	if _, summary, err = FetchRSSArticles(ctx, server.URL+"/feed.xml", 10, utils.Sample{}, ItemFilter{}, false, mockDS, fetchOptions); err != nil || summary.NotModified {
+		t.Errorf("forced run summary = %+v, %v, want the downloaded feed", summary, err)
+	}
+	if feedDownloads != 2 {
+		t.Errorf("feed downloaded %d times, want 2 after a forced refresh", feedDownloads)
+	}
+}
+
+func TestFetchRSSArticles_ItemFilter(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/feed.xml" {
+			fmt.Fprintf(w, `<rss version="2.0"><channel><title>Feed</title>
+<item><title>Sports: the cup final</title><link>%[1]s/sports</link></item>
+<item><title>Budget vote</title><link>%[1]s/budget</link></item>
+<item><title>City hall</title><description>An April Fools prank</description><link>%[1]s/prank</link></item>
+<item><title>April Fools sports special</title><link>%[1]s/special</link></item>
+<item><title>More April Fools</title><link>%[1]s/more</link></item>
+</channel></rss>`, server.URL)
+			return
+		}
+		fmt.Fprintf(w, `<html><head><title>%s</title></head><body><article><p>%s</p></article></body></html>`,
+			r.URL.Path, strings.Repeat("Cats were elected to every seat of the city council. ", 20))
+	}))
+	defer server.Close()
+
+	filter, err := ParseItemFilter("april fools", "sports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The maximum applies to the selected items
+	pages, summary, err := FetchRSSArticles(context.Background(), server.URL+"/feed.xml", 1, utils.Sample{}, filter, false,
+		lib.NewMockDatastoreClient(), fetcher.Options{Cache: testCache(t), AllowPrivateAddresses: true})
+	if err != nil {
+		t.Fatalf("FetchRSSArticles() error = %v", err)
+	}
+	if len(pages) != 1 || pages[0].Title != "/prank" {
+		t.Errorf("FetchRSSArticles() pages = %v, want the first selected article", pages)
+	}
+	if summary.Filtered != 3 || summary.Items != 1 {
+		t.Errorf("summary = %+v, want 3 filtered items and 1 considered", summary)
+	}
+}
+
+func TestFetchRSSArticles_PublishedWindow(t *testing.T) {
+	const etag = `"v1"`
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/feed.xml" {
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			fmt.Fprintf(w, `<rss version="2.0"><channel><title>Feed</title>
+<item><title>Today</title><link>%[1]s/today</link><pubDate>Wed, 01 Apr 2026 09:00:00 GMT</pubDate></item>
+<item><title>Last week</title><link>%[1]s/last-week</link><pubDate>Wed, 25 Mar 2026 09:00:00 GMT</pubDate></item>
+<item><title>Undated</title><link>%[1]s/undated</link></item>
+<item><title>Last month</title><link>%[1]s/last-month</link><pubDate>Sun, 01 Mar 2026 09:00:00 GMT</pubDate></item>
+</channel></rss>`, server.URL)
+			return
+		}
+		fmt.Fprintf(w, `<html><head><title>%s</title></head><body><article><p>%s</p></article></body></html>`,
+			r.URL.Path, strings.Repeat("Cats were elected to every seat of the city council. ", 20))
+	}))
+	defer server.Close()
+
+	since, until, err := ParsePublishedWindow("2026-03-20", "2026-03-31", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := ItemFilter{Since: since, Until: until}
+	mockDS := lib.NewMockDatastoreClient()
+	// The second run filters the items recorded in the feed state
+	for _, run := range []string{"first run", "not modified"} {
+		pages, summary, err := FetchRSSArticles(context.Background(), server.URL+"/feed.xml", 10, utils.Sample{}, filter, false,
+			mockDS, fetcher.Options{Cache: testCache(t), AllowPrivateAddresses: true})
+		if err != nil {
+			t.Fatalf("%s: FetchRSSArticles() error = %v", run, err)
+		}
+		if len(pages) != 1 || pages[0].Title != "/last-week" || summary.Filtered != 3 {
+			t.Errorf("%s: FetchRSSArticles() = %v, %+v, want the article of last week and 3 filtered items", run, pages, summary)
+		}
+		if run == "not modified" && !summary.NotModified {
+			t.Errorf("%s: summary = %+v, want a not modified feed", run, summary)
+		}
+	}
+}
+
+func TestFetchRSSArticles_ItemMetadata(t *testing.T) {
+	const etag = `"v1"`
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/feed.xml" {
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			fmt.Fprintf(w, `<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/"><channel><title>Feed</title>
+<item><title>Dated</title><link>%[1]s/dated</link><pubDate>Wed, 01 Apr 2026 09:00:00 GMT</pubDate>
+<dc:creator>Jane Doe</dc:creator><category>Politics</category><category> Cats </category><category>Politics</category></item>
+<item><title>Bare</title><link>%[1]s/bare</link></item>
+</channel></rss>`, server.URL)
+			return
+		}
+		fmt.Fprintf(w, `<html><head><title>%s</title></head><body><article><p>%s</p></article></body></html>`,
+			r.URL.Path, strings.Repeat("Cats were elected to every seat of the city council. ", 20))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	feedURL := server.URL + "/feed.xml"
+	mockDS := lib.NewMockDatastoreClient()
+	want := models.FeedItemMetadata{
+		Feed:        feedURL,
+		PublishedAt: time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC),
+		Author:      "Jane Doe",
+		Categories:  []string{"Politics", "Cats"},
+	}
+	// The second run refetches the articles with the items recorded in the feed state
+	for _, run := range []string{"first run", "not modified"} {
+		if _, _, err := FetchRSSArticles(ctx, feedURL, 10, utils.Sample{}, ItemFilter{}, false, mockDS,
+			fetcher.Options{Cache: testCache(t), AllowPrivateAddresses: true, Revalidate: run == "not modified"}); err != nil {
+			t.Fatalf("%s: FetchRSSArticles() error = %v", run, err)
+		}
+
+		dated, found, err := mockDS.ReadCrawledPage(ctx, lib.NormalizeURL(server.URL+"/dated"))
+		if err != nil || !found {
+			t.Fatalf("%s: ReadCrawledPage() = %v, %v, want the stored article", run, found, err)
+		}
+		got := dated.FeedItem
+		if got.Feed != want.Feed || !got.PublishedAt.Equal(want.PublishedAt) || got.Author != want.Author ||
+			!slices.Equal(got.Categories, want.Categories) {
+			t.Errorf("%s: FeedItem = %+v, want %+v", run, got, want)
+		}
+		if !dated.PublishedTime().Equal(want.PublishedAt) {
+			t.Errorf("%s: PublishedTime() = %v, want the date of the feed item", run, dated.PublishedTime())
+		}
+
+		bare, _, _ := mockDS.ReadCrawledPage(ctx, lib.NormalizeURL(server.URL+"/bare"))
+		if bare.FeedItem.Feed != feedURL || !bare.FeedItem.PublishedAt.IsZero() || bare.FeedItem.Author != "" || len(bare.FeedItem.Categories) != 0 {
+			t.Errorf("%s: FeedItem of an undated item = %+v, want only the feed", run, bare.FeedItem)
+		}
+	}
+
+	state := mockDS.FeedStates[feedURL]
+	if len(state.Items) != 2 || state.Items[0].Author != want.Author || !slices.Equal(state.Items[0].Categories, want.Categories) {
+		t.Errorf("feed state items = %+v, want the author and categories of the items", state.Items)
+	}
+}
+
+func TestFetchRSSArticles_AllFailed(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/feed.xml" {
+			fmt.Fprintf(w, `<rss version="2.0"><channel><item><title>Gone</title><link>%s/gone</link></item></channel></rss>`, server.URL)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	pages, summary, err := FetchRSSArticles(context.Background(), server.URL+"/feed.xml", 10, utils.Sample{}, ItemFilter{}, false, lib.NewMockDatastoreClient(), fetcher.Options{Cache: testCache(t), AllowPrivateAddresses: true})
+	if err == nil || len(pages) != 0 {
+		t.Fatalf("FetchRSSArticles() = %v, %v, want an error", pages, err)
+	}
+	if summary == nil || len(summary.Failed) != 1 {
+		t.Errorf("summary = %+v, want the failed article", summary)
+	}
+}
+
+func TestFetchRSSArticles_PrivateFeed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<rss version="2.0"><channel><title>Feed</title></channel></rss>`)
+	}))
+	defer server.Close()
+
+	// Feeds on the local network are refused unless private addresses are allowed
+	_, summary, err := FetchRSSArticles(context.Background(), server.URL+"/feed.xml", 10, utils.Sample{}, ItemFilter{}, false, lib.NewMockDatastoreClient(), fetcher.Options{Cache: testCache(t)})
+	if !errors.Is(err, fetcher.ErrBlockedAddress) || summary != nil {
+		t.Errorf("FetchRSSArticles() = %+v, %v, want ErrBlockedAddress", summary, err)
+	}
+}
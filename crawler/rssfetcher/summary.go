@@ -0,0 +1,79 @@
+package rssfetcher
+
+import "github.com/zeace/poisson/models"
+
+// FetchSummary is the outcome of fetching the articles of a feed with FetchRSSArticles. It is
+// meant to be serialized as is by JSON output modes.
+type FetchSummary struct {
+	Feed string `json:"feed"`
+	// Items is the number of feed items considered, after applying the maximum or the sample.
+	Items int `json:"items"`
+	// Filtered is the number of feed items left out by the item filter (see ItemFilter).
+	Filtered int `json:"filtered,omitempty"`
+	// NotModified is true if the feed answered 304 Not Modified to a conditional request, and
+	// its items were those recorded at the last download (see models.FeedState).
+	NotModified bool `json:"not_modified,omitempty"`
+	// Pages is the number of feed documents downloaded: more than one for a paginated feed
+	// (RFC 5005), zero if the feed was not modified and no further page was needed.
+	Pages int `json:"pages,omitempty"`
+	// Fetched is the number of articles returned, including those read from the cache.
+	Fetched int `json:"fetched"`
+	// CacheHits is the number of fetched articles read from the Datastore or file cache
+	// without a request to their server.
+	CacheHits int `json:"cache_hits"`
+	// Revalidated is the number of fetched articles read from the Datastore cache after their
+	// server answered that they were not modified.
+	Revalidated int `json:"revalidated"`
+	// New is the number of fetched articles that were not stored before this fetch.
+	New int `json:"new"`
+	// Cached is the number of fetched articles that were already stored and returned from the
+	// Datastore before any request was made. They are also counted in CacheHits.
+	Cached int `json:"cached"`
+	// Skipped are the items left out on purpose: those without a link, articles excluded by
+	// their robots directives, and articles whose last fetches failed (see
+	// fetcher.Options.FailureCooldown).
+	Skipped []ArticleOutcome `json:"skipped,omitempty"`
+	// Failed are the articles that could not be fetched.
+	Failed []ArticleOutcome `json:"failed,omitempty"`
+
+	// newPages are the pages counted in New.
+	newPages map[*models.CrawledPage]bool
+}
+
+// ArticleOutcome is a feed item that was skipped or failed, with the reason.
+type ArticleOutcome struct {
+	// URL is the link of the item, empty for items without one.
+	URL string `json:"url,omitempty"`
+	// Title is the title of the item in the feed.
+	Title  string `json:"title,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Partial reports whether some articles were fetched and others failed.
+func (s *FetchSummary) Partial() bool {
+	return s.Fetched > 0 && len(s.Failed) > 0
+}
+
+// IsNew reports whether page, returned with the summary, was not stored before the fetch.
+func (s *FetchSummary) IsNew(page *models.CrawledPage) bool {
+	return s.newPages[page]
+}
+
+// countPage counts a fetched article by where its content came from, and as new unless it was
+// stored before the fetch.
+func (s *FetchSummary) countPage(page *models.CrawledPage, stored bool) {
+	s.Fetched++
+	if !stored {
+		s.New++
+		if s.newPages == nil {
+			s.newPages = make(map[*models.CrawledPage]bool)
+		}
+		s.newPages[page] = true
+	}
+	switch page.CacheSource {
+	case models.CacheSourceDatastore:
+		s.CacheHits++
+	case models.CacheSourceRevalidated:
+		s.Revalidated++
+	}
+}
@@ -0,0 +1,175 @@
+package sitecrawler
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeace/poisson/crawler/fetcher"
+)
+
+// robotsUserAgent is the user agent token matched against the groups of robots.txt files, in
+// addition to "*".
+const robotsUserAgent = "poisson"
+
+// maxRobotsSize is the largest robots.txt read. Google reads 500 KiB.
+const maxRobotsSize = 500 << 10
+
+// maxCrawlDelay caps the Crawl-delay of robots.txt files, so that a site can't stall a crawl
+// until its timeout.
+const maxCrawlDelay = time.Minute
+
+// robotsRule allows or disallows the paths matching a robots.txt pattern.
+type robotsRule struct {
+	pattern *regexp.Regexp
+	// length is the length of the pattern, which ranks the rules matching a path.
+	length int
+	allow  bool
+}
+
+// robotsRules are the rules of a robots.txt that apply to the crawler. A nil *robotsRules
+// allows everything.
+type robotsRules struct {
+	rules []robotsRule
+	// delay is the Crawl-delay of the group, the minimum time between two requests.
+	delay time.Duration
+}
+
+// fetchRobots reads the robots.txt of the site of seed. A site without one, or whose robots.txt
+// can't be read, may be crawled entirely.
+func fetchRobots(ctx context.Context, httpClient *http.Client, seed *url.URL, credentials *fetcher.Credentials) *robotsRules {
+	robotsURL := (&url.URL{Scheme: seed.Scheme, Host: seed.Host, Path: "/robots.txt"}).String()
+	req, err := http.NewRequestWithContext(ctx, "GET", robotsURL, nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("User-Agent", crawlerUserAgent)
+	credentials.Apply(req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		slog.WarnContext(ctx, "Error fetching robots.txt, crawling without it", "url", robotsURL, "error", err)
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	return parseRobots(io.LimitReader(resp.Body, maxRobotsSize))
+}
+
+// parseRobots returns the rules and Crawl-delay of the robots.txt in r for robotsUserAgent:
+// those of its own group if it has one, or else those of the "*" group.
+func parseRobots(r io.Reader) *robotsRules {
+	var own, wildcard []robotsRule
+	var ownDelay, wildcardDelay time.Duration
+	var hasOwn bool
+	// agents are the user agents of the current group; inRules is true once the group has rules
+	var agents []string
+	inRules := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			if inRules {
+				agents, inRules = nil, false
+			}
+			agent := strings.ToLower(value)
+			agents = append(agents, agent)
+			if strings.Contains(agent, robotsUserAgent) {
+				hasOwn = true
+			}
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue // An empty Disallow allows everything
+			}
+			rule := robotsRule{pattern: robotsPattern(value), length: len(value), allow: field == "allow"}
+			for _, agent := range agents {
+				if strings.Contains(agent, robotsUserAgent) {
+					own = append(own, rule)
+				} else if agent == "*" {
+					wildcard = append(wildcard, rule)
+				}
+			}
+		case "crawl-delay":
+			inRules = true
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds <= 0 {
+				continue
+			}
+			delay := min(time.Duration(seconds*float64(time.Second)), maxCrawlDelay)
+			for _, agent := range agents {
+				if strings.Contains(agent, robotsUserAgent) {
+					ownDelay = delay
+				} else if agent == "*" {
+					wildcardDelay = delay
+				}
+			}
+		}
+	}
+	if hasOwn {
+		return &robotsRules{rules: own, delay: ownDelay}
+	}
+	return &robotsRules{rules: wildcard, delay: wildcardDelay}
+}
+
+// crawlDelay returns the Crawl-delay of the rules, zero if there is none.
+func (r *robotsRules) crawlDelay() time.Duration {
+	if r == nil {
+		return 0
+	}
+	return r.delay
+}
+
+// robotsPattern compiles a robots.txt path pattern, in which * matches any characters and a
+// trailing $ anchors the end of the path.
+func robotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allowed reports whether the crawler may read u: the longest rule matching its path and query
+// decides, and Allow wins ties.
+func (r *robotsRules) allowed(u *url.URL) bool {
+	if r == nil {
+		return true
+	}
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	allow, length := true, -1
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(target) {
+			continue
+		}
+		if rule.length > length || (rule.length == length && rule.allow) {
+			allow, length = rule.allow, rule.length
+		}
+	}
+	return allow
+}
@@ -0,0 +1,72 @@
+package sitecrawler
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	tests := []struct {
+		name   string
+		robots string
+		path   string
+		want   bool
+	}{
+		{name: "no rules", robots: "", path: "/news/a", want: true},
+		{name: "disallowed prefix", robots: "User-agent: *\nDisallow: /private/", path: "/private/a", want: false},
+		{name: "other prefix", robots: "User-agent: *\nDisallow: /private/", path: "/news/a", want: true},
+		{name: "empty disallow", robots: "User-agent: *\nDisallow:", path: "/news/a", want: true},
+		{name: "longer allow wins", robots: "User-agent: *\nDisallow: /news/\nAllow: /news/public", path: "/news/public-story", want: true},
+		{name: "wildcard", robots: "User-agent: *\nDisallow: /*?print=", path: "/news/a?print=1", want: false},
+		{name: "end anchor", robots: "User-agent: *\nDisallow: /*.pdf$", path: "/files/a.pdf", want: false},
+		{name: "end anchor not at end", robots: "User-agent: *\nDisallow: /*.pdf$", path: "/files/a.pdf.html", want: true},
+		{name: "other agent", robots: "User-agent: Googlebot\nDisallow: /", path: "/news/a", want: true},
+		{
+			name:   "own group replaces wildcard group",
+			robots: "User-agent: *\nDisallow: /\n\nUser-agent: poisson\nDisallow: /private/",
+			path:   "/news/a",
+			want:   true,
+		},
+		{
+			name:   "group of several agents",
+			robots: "User-agent: Googlebot\nUser-agent: *\nDisallow: /news/ # comment",
+			path:   "/news/a",
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse("https://example.com" + tt.path)
+			if got := parseRobots(strings.NewReader(tt.robots)).allowed(u); got != tt.want {
+				t.Errorf("allowed(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRobots_CrawlDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		robots string
+		want   time.Duration
+	}{
+		{name: "none", robots: "User-agent: *\nDisallow: /private/", want: 0},
+		{name: "wildcard group", robots: "User-agent: *\nCrawl-delay: 2", want: 2 * time.Second},
+		{name: "fraction", robots: "User-agent: *\nCrawl-delay: 0.5", want: 500 * time.Millisecond},
+		{name: "own group", robots: "User-agent: *\nCrawl-delay: 2\n\nUser-agent: poisson\nCrawl-delay: 1", want: time.Second},
+		{name: "other agent", robots: "User-agent: Googlebot\nCrawl-delay: 5", want: 0},
+		{name: "capped", robots: "User-agent: *\nCrawl-delay: 86400", want: maxCrawlDelay},
+		{name: "invalid", robots: "User-agent: *\nCrawl-delay: soon", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRobots(strings.NewReader(tt.robots)).crawlDelay(); got != tt.want {
+				t.Errorf("crawlDelay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
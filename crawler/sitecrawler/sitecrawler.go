@@ -0,0 +1,429 @@
+// Package sitecrawler finds the articles of sites without a feed or sitemap by following the
+// links of their pages from a seed URL.
+package sitecrawler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/crawler/utils"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+	"github.com/zeace/poisson/models"
+)
+
+const (
+	// crawlerUserAgent is sent with the requests reading pages for links and robots.txt.
+	crawlerUserAgent = "Mozilla/5.0 (compatible; poisson crawler)"
+	// pageTimeout bounds each request reading a page for links.
+	pageTimeout = 30 * time.Second
+
+	// DefaultMaxDepth is the number of links followed from the seed URL when Limits.MaxDepth is zero.
+	DefaultMaxDepth = 2
+	// DefaultMaxPages is the number of pages read for links when Limits.MaxPages is zero.
+	DefaultMaxPages = 50
+)
+
+// Limits bound a crawl.
+type Limits struct {
+	// MaxDepth is the number of links followed from the seed URL to reach an article. Zero means
+	// DefaultMaxDepth.
+	MaxDepth int
+	// MaxPages is the number of pages read for links, the seed URL included. Zero means
+	// DefaultMaxPages.
+	MaxPages int
+	// MaxArticles stops the crawl once that many articles are found. Zero means no limit.
+	MaxArticles int
+}
+
+// nonArticleSegments are path segments of the pages listing articles, or of pages that are not
+// articles at all.
+var nonArticleSegments = map[string]bool{
+	"tag": true, "tags": true, "category": true, "categories": true, "topic": true, "topics": true,
+	"author": true, "authors": true, "page": true, "search": true, "login": true, "signin": true,
+	"register": true, "subscribe": true, "account": true, "about": true, "contact": true,
+	"privacy": true, "terms": true, "feed": true, "rss": true, "newsletter": true, "newsletters": true,
+}
+
+// nonArticleExtensions are the file extensions of links that are not HTML pages.
+var nonArticleExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".svg": true, ".webp": true,
+	".pdf": true, ".zip": true, ".mp3": true, ".mp4": true, ".xml": true, ".rss": true,
+	".css": true, ".js": true, ".ico": true, ".json": true,
+}
+
+// articleIDPattern matches path segments with a numeric ID, as in /12345 or /story-12345.
+var articleIDPattern = regexp.MustCompile(`\d{4,}`)
+
+// datePathPattern matches the dates in the paths of articles, as in /2024/03/31/.
+var datePathPattern = regexp.MustCompile(`/\d{4}/\d{1,2}/`)
+
+// looksLikeArticle reports whether the path of u is that of an article rather than a home,
+// section, tag or utility page: its last segment is a slug of at least three words, has a
+// numeric ID, follows a date, or is an .html page.
+func looksLikeArticle(u *url.URL) bool {
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	last := strings.ToLower(segments[len(segments)-1])
+	if last == "" {
+		return false
+	}
+	for _, segment := range segments {
+		if nonArticleSegments[strings.ToLower(segment)] {
+			return false
+		}
+	}
+	switch ext := path.Ext(last); {
+	case nonArticleExtensions[ext]:
+		return false
+	case ext == ".html" || ext == ".htm":
+		return true
+	}
+	return len(strings.FieldsFunc(last, func(r rune) bool { return r == '-' || r == '_' })) >= 3 ||
+		articleIDPattern.MatchString(last) || datePathPattern.MatchString(u.Path)
+}
+
+// crawlPage is a page of the crawl waiting to be read for links.
+type crawlPage struct {
+	url   string
+	depth int
+	// article is true if the page looks like an article (see looksLikeArticle).
+	article bool
+}
+
+// articleReader fetches an article found by the crawl and returns it with its links. The links
+// are nil if the article wasn't downloaded, having been read from the cache.
+type articleReader func(ctx context.Context, pageURL string) (*models.CrawledPage, []*url.URL, error)
+
+// discovery is what a crawl found.
+type discovery struct {
+	// articles are the URLs of the articles found, the closest to the seed first.
+	articles []string
+	// fetched and failed are the articles read for links by the articleReader, by URL.
+	fetched map[string]*models.CrawledPage
+	failed  map[string]error
+	// pagesRead is the number of pages read for links.
+	pagesRead int
+	// delay is the minimum time between two requests to the site: the HostDelay of the fetch
+	// options or the Crawl-delay of its robots.txt, whichever is longer.
+	delay time.Duration
+}
+
+// DiscoverURLs crawls the site of seedURL breadth-first within limits and returns the URLs of
+// the articles found (see looksLikeArticle), the closest to the seed first. Only links to the
+// host of seedURL (with or without www.) are followed, and the paths disallowed to crawlers by
+// its robots.txt are skipped. Pages are read fetchOptions.HostDelay or the Crawl-delay of the
+// robots.txt apart, whichever is longer. Errors reading pages other than the seed are logged
+// and skipped.
+func DiscoverURLs(
+	ctx context.Context,
+	seedURL string,
+	limits Limits,
+	fetchOptions fetcher.Options,
+	verbose bool,
+) ([]string, error) {
+	found, err := discover(ctx, seedURL, limits, fetchOptions, verbose, nil)
+	if err != nil {
+		return nil, err
+	}
+	return found.articles, nil
+}
+
+// discover crawls the site of seedURL like DiscoverURLs. The articles read for links are read
+// by readArticle if it isn't nil, so that they aren't downloaded again once found.
+func discover(
+	ctx context.Context,
+	seedURL string,
+	limits Limits,
+	fetchOptions fetcher.Options,
+	verbose bool,
+	readArticle articleReader,
+) (*discovery, error) {
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth = DefaultMaxDepth
+	}
+	if limits.MaxPages <= 0 {
+		limits.MaxPages = DefaultMaxPages
+	}
+	seed, err := url.Parse(seedURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid seed URL %s: %w", seedURL, err)
+	}
+	httpClient := fetcher.NewHTTPClient(fetchOptions, pageTimeout)
+	robots := fetchRobots(ctx, httpClient, seed, fetchOptions.Credentials)
+	found := &discovery{
+		fetched: make(map[string]*models.CrawledPage),
+		failed:  make(map[string]error),
+		delay:   max(fetchOptions.HostDelay, robots.crawlDelay()),
+	}
+
+	// Every request to the site waits for the delay since the previous one, robots.txt included
+	lastRequest := time.Now()
+	pace := func() error {
+		if err := waitUntil(ctx, lastRequest.Add(found.delay)); err != nil {
+			return err
+		}
+		lastRequest = time.Now()
+		return nil
+	}
+
+	seen := map[string]bool{lib.NormalizeURL(seedURL): true}
+	if looksLikeArticle(seed) {
+		found.articles = append(found.articles, seedURL)
+	}
+	queue := []crawlPage{{url: seedURL, article: looksLikeArticle(seed)}}
+	for len(queue) > 0 && found.pagesRead < limits.MaxPages {
+		if limits.MaxArticles > 0 && len(found.articles) >= limits.MaxArticles {
+			break
+		}
+		page := queue[0]
+		queue = queue[1:]
+		found.pagesRead++
+		if err := pace(); err != nil {
+			return nil, err
+		}
+
+		var links []*url.URL
+		var err error
+		if page.article && readArticle != nil {
+			var article *models.CrawledPage
+			article, links, err = readArticle(ctx, page.url)
+			if err != nil {
+				found.failed[page.url] = err
+			} else {
+				found.fetched[page.url] = article
+				if links == nil {
+					if err = pace(); err == nil {
+						links, err = readLinks(ctx, httpClient, page.url, fetchOptions)
+					}
+				}
+			}
+		} else {
+			links, err = readLinks(ctx, httpClient, page.url, fetchOptions)
+		}
+		if err != nil {
+			if page.depth == 0 {
+				return nil, err
+			}
+			slog.WarnContext(ctx, "Error reading page for links", "url", page.url, "error", err)
+			continue
+		}
+		if verbose {
+			slog.InfoContext(ctx, "Read page for links", "url", page.url, "depth", page.depth, "links", len(links))
+		}
+
+		for _, link := range links {
+			key := lib.NormalizeURL(link.String())
+			if seen[key] || !sameSite(link.Hostname(), seed.Hostname()) || !robots.allowed(link) {
+				continue
+			}
+			seen[key] = true
+			article := looksLikeArticle(link)
+			if article {
+				found.articles = append(found.articles, link.String())
+			}
+			// Articles are read for links too: they link to more articles
+			if page.depth+1 < limits.MaxDepth {
+				queue = append(queue, crawlPage{url: link.String(), depth: page.depth + 1, article: article})
+			}
+		}
+	}
+	if limits.MaxArticles > 0 && len(found.articles) > limits.MaxArticles {
+		found.articles = found.articles[:limits.MaxArticles]
+	}
+	return found, nil
+}
+
+// waitUntil sleeps until t, or returns the error of ctx if it is done first.
+func waitUntil(ctx context.Context, t time.Time) error {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// readLinks fetches the HTML page at pageURL and returns the links it has (see parseLinks).
+// Pages that aren't HTML have no links.
+func readLinks(ctx context.Context, httpClient *http.Client, pageURL string, fetchOptions fetcher.Options) ([]*url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", crawlerUserAgent)
+	fetchOptions.Credentials.Apply(req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %w", pageURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching %s: unexpected status code: %d", pageURL, resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" && !strings.Contains(contentType, "html") {
+		return nil, nil
+	}
+
+	maxSize := fetchOptions.MaxBodySize
+	if maxSize <= 0 {
+		maxSize = fetcher.DefaultMaxBodySize
+	}
+	// Relative links are resolved against the URL the page was read from after redirects
+	links, err := parseLinks(io.LimitReader(resp.Body, maxSize), resp.Request.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", pageURL, err)
+	}
+	return links, nil
+}
+
+// parseLinks returns the absolute http and https URLs the HTML page in r links to, resolved
+// against base and without fragments. The links are never nil, even if there are none.
+func parseLinks(r io.Reader, base *url.URL) ([]*url.URL, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, err
+	}
+	links := []*url.URL{}
+	doc.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		link, err := base.Parse(strings.TrimSpace(a.AttrOr("href", "")))
+		if err != nil || (link.Scheme != "http" && link.Scheme != "https") {
+			return
+		}
+		link.Fragment = ""
+		links = append(links, link)
+	})
+	return links, nil
+}
+
+// sameSite reports whether the hosts a and b are the same, with or without a www. prefix.
+func sameSite(a, b string) bool {
+	a = strings.TrimPrefix(strings.ToLower(a), "www.")
+	b = strings.TrimPrefix(strings.ToLower(b), "www.")
+	return a != "" && a == b
+}
+
+// FetchSiteArticles discovers article URLs by crawling the site of seedURL (see DiscoverURLs)
+// and fetches the content of the first maxArticles ones, like sitemapfetcher.FetchSitemapArticles
+// does for the pages of a sitemap. The articles read for links during the crawl are fetched
+// then, and their links read from the same download; the others are fetched concurrently
+// using fetcher.FetchMany, fetchOptions.HostDelay or the Crawl-delay of the site apart. If
+// sample is enabled, a random sample of all the articles found within limits is fetched
+// instead, after the crawl.
+// If datastoreClient is provided, crawled pages will be saved to Datastore.
+// Pages excluded by their robots directives under fetchOptions are left out of the result.
+// The summary reports the articles skipped or failed; an error is returned if the crawl fails
+// or if none of the articles found could be fetched.
+func FetchSiteArticles(
+	ctx context.Context,
+	seedURL string,
+	maxArticles int,
+	sample utils.Sample,
+	limits Limits,
+	verbose bool,
+	datastoreClient lib.DatastoreClient,
+	fetchOptions fetcher.Options,
+) ([]*models.CrawledPage, *FetchSummary, error) {
+	ctx = logging.WithAttrs(ctx, "crawl", seedURL)
+	if verbose {
+		slog.InfoContext(ctx, "Crawling site")
+	}
+
+	fetchOptions.Source = models.SourceRef{Kind: models.SourceKindCrawl, ID: seedURL}
+	// A sample is drawn from all the articles found, which are only fetched once sampled
+	var readArticle articleReader
+	if !sample.Enabled() {
+		limits.MaxArticles = maxArticles
+		readArticle = func(ctx context.Context, pageURL string) (*models.CrawledPage, []*url.URL, error) {
+			var links []*url.URL
+			options := fetchOptions
+			options.OnHTML = func(base *url.URL, body []byte) {
+				links, _ = parseLinks(bytes.NewReader(body), base)
+			}
+			page, _, err := fetcher.FetchArticleContent(ctx, pageURL, verbose, datastoreClient, options)
+			return page, links, err
+		}
+	}
+	found, err := discover(ctx, seedURL, limits, fetchOptions, verbose, readArticle)
+	if err != nil {
+		return nil, nil, err
+	}
+	summary := &FetchSummary{Seed: seedURL, PagesRead: found.pagesRead, Found: len(found.articles)}
+
+	articleURLs := found.articles
+	if sample.Enabled() {
+		articleURLs = utils.SampleItems(articleURLs, sample)
+		if verbose {
+			slog.InfoContext(ctx, "Sampled crawled articles", "sample", sample.String(), "sampled", len(articleURLs))
+		}
+	}
+	var remaining []string
+	for _, articleURL := range articleURLs {
+		if _, ok := found.fetched[articleURL]; !ok && found.failed[articleURL] == nil {
+			remaining = append(remaining, articleURL)
+		}
+	}
+	if verbose {
+		slog.InfoContext(ctx, "Fetching articles", "count", len(remaining), "fetched_by_crawl", len(articleURLs)-len(remaining))
+	}
+
+	// Fetch concurrently, capped globally and per host by fetchOptions
+	fetchOptions.HostDelay = found.delay
+	for _, result := range fetcher.FetchMany(ctx, remaining, verbose, datastoreClient, fetchOptions) {
+		if result.Err != nil {
+			found.failed[result.URL] = result.Err
+		} else {
+			found.fetched[result.URL] = result.Page
+		}
+	}
+
+	var pages []*models.CrawledPage
+	for _, articleURL := range articleURLs {
+		if err := found.failed[articleURL]; err != nil {
+			summary.Failed = append(summary.Failed, ArticleOutcome{URL: articleURL, Reason: err.Error()})
+			if verbose {
+				slog.WarnContext(ctx, "Error fetching article", "url", articleURL, "error", err)
+			}
+			continue
+		}
+		page := found.fetched[articleURL]
+		if page.RobotsExcluded {
+			summary.Skipped = append(summary.Skipped, ArticleOutcome{URL: articleURL, Reason: "excluded by robots directives"})
+			if verbose {
+				slog.InfoContext(ctx, "Skipping article: excluded by robots directives", "url", articleURL)
+			}
+			continue
+		}
+
+		page.Feed = seedURL
+		pages = append(pages, page)
+		summary.Fetched++
+	}
+
+	if len(pages) == 0 && len(summary.Failed) > 0 {
+		return nil, summary, fmt.Errorf("failed to fetch any of the %d article(s) found by the crawl", len(summary.Failed))
+	}
+	if summary.Partial() && verbose {
+		slog.WarnContext(ctx, "Some articles could not be fetched",
+			"fetched", summary.Fetched, "failed", len(summary.Failed))
+	}
+
+	return pages, summary, nil
+}
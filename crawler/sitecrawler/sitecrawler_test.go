@@ -0,0 +1,186 @@
+package sitecrawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/crawler/utils"
+	"github.com/zeace/poisson/lib"
+)
+
+func TestLooksLikeArticle(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com/", false},
+		{"https://example.com/sport/", false},
+		{"https://example.com/news/mayor-sells-town-hall", true},
+		{"https://example.com/2024/03/31/mayor", true},
+		{"https://example.com/article/123456", true},
+		{"https://example.com/story.html", true},
+		{"https://example.com/tag/town-hall-sales", false},
+		{"https://example.com/about-us-and-our-team", true},
+		{"https://example.com/about/our-editorial-team", false},
+		{"https://example.com/images/mayor-at-the-town-hall.jpg", false},
+		{"https://example.com/page/2", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, _ := url.Parse(tt.url)
+			if got := looksLikeArticle(u); got != tt.want {
+				t.Errorf("looksLikeArticle(%q) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverURLs(t *testing.T) {
+	pages := map[string]string{
+		"/robots.txt": "User-agent: *\nDisallow: /private/\n",
+		"/": `<a href="/news/mayor-sells-town-hall#comments">Mayor</a>
+			<a href="/sport/">Sport</a>
+			<a href="/tag/town-halls">Town halls</a>
+			<a href="/private/secret-plans-revealed-today">Plans</a>
+			<a href="https://other.example/news/elsewhere-story-today">Elsewhere</a>
+			<a href="mailto:desk@example.com">Contact</a>`,
+		"/news/mayor-sells-town-hall": `<a href="/">Home</a> <a href="/news/buyer-plans-bowling-alley">Buyer</a>`,
+		"/sport/":                     `<a href="/sport/dog-wins-the-race">Dog</a> <a href="/sport/archive/">Archive</a>`,
+		"/sport/archive/":             `<a href="/sport/too-deep-to-reach">Too deep</a>`,
+	}
+	requested := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested[r.URL.Path]++
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path != "/robots.txt" {
+			w.Header().Set("Content-Type", "text/html")
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	opts := fetcher.Options{AllowPrivateAddresses: true}
+
+	tests := []struct {
+		name   string
+		limits Limits
+		want   []string
+	}{
+		{
+			name:   "depth",
+			limits: Limits{MaxDepth: 2},
+			want: []string{"/news/mayor-sells-town-hall", "/news/buyer-plans-bowling-alley",
+				"/sport/dog-wins-the-race"},
+		},
+		{
+			name:   "one link from the seed",
+			limits: Limits{MaxDepth: 1},
+			want:   []string{"/news/mayor-sells-town-hall"},
+		},
+		{
+			name:   "pages read",
+			limits: Limits{MaxDepth: 2, MaxPages: 2},
+			want:   []string{"/news/mayor-sells-town-hall", "/news/buyer-plans-bowling-alley"},
+		},
+		{
+			name:   "articles",
+			limits: Limits{MaxDepth: 3, MaxArticles: 1},
+			want:   []string{"/news/mayor-sells-town-hall"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clear(requested)
+			urls, err := DiscoverURLs(ctx, server.URL+"/", tt.limits, opts, false)
+			if err != nil {
+				t.Fatalf("DiscoverURLs() error = %v", err)
+			}
+			want := make([]string, len(tt.want))
+			for i, path := range tt.want {
+				want[i] = server.URL + path
+			}
+			if got, want := strings.Join(urls, " "), strings.Join(want, " "); got != want {
+				t.Errorf("DiscoverURLs() = %q, want %q", got, want)
+			}
+			if requested["/private/secret-plans-revealed-today"] != 0 || requested["/sport/too-deep-to-reach"] != 0 {
+				t.Errorf("requested = %v, want no disallowed or too deep page", requested)
+			}
+		})
+	}
+
+	if _, err := DiscoverURLs(ctx, server.URL+"/missing/", Limits{}, opts, false); err == nil {
+		t.Error("DiscoverURLs() of a missing seed expected an error")
+	}
+	if _, err := DiscoverURLs(ctx, server.URL+"/", Limits{}, fetcher.Options{}, false); err == nil {
+		t.Error("DiscoverURLs() of a loopback seed expected an error without AllowPrivateAddresses")
+	}
+}
+
+func TestFetchSiteArticles(t *testing.T) {
+	text := strings.Repeat("The mayor sold the town hall to a bowling alley chain. ", 20)
+	pages := map[string]string{
+		"/robots.txt":                     "User-agent: *\nCrawl-delay: 0.02\n",
+		"/":                               `<a href="/news/mayor-sells-town-hall">Mayor</a> <a href="/news/gone-missing-story">Gone</a>`,
+		"/news/mayor-sells-town-hall":     `<article><p>` + text + `</p></article><a href="/news/buyer-plans-bowling-alley">Buyer</a>`,
+		"/news/buyer-plans-bowling-alley": `<article><p>` + text + `</p></article>`,
+	}
+	var mu sync.Mutex
+	requested := make(map[string]int)
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path]++
+		times = append(times, time.Now())
+		mu.Unlock()
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, body)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><title>Page</title></head><body>"+body+"</body></html>")
+	}))
+	defer server.Close()
+
+	opts := fetcher.Options{AllowPrivateAddresses: true, Cache: fetcher.NewDiskCache(t.TempDir(), 0), RetryAttempts: 1}
+	fetched, summary, err := FetchSiteArticles(context.Background(), server.URL+"/", 10, utils.Sample{},
+		Limits{MaxDepth: 3}, false, lib.NewMockDatastoreClient(), opts)
+	if err != nil {
+		t.Fatalf("FetchSiteArticles() error = %v", err)
+	}
+	if len(fetched) != 2 || summary.Fetched != 2 || summary.Found != 3 || len(summary.Failed) != 1 {
+		t.Errorf("got %d page(s) and summary %+v, want 2 articles fetched of the 3 found and 1 failed", len(fetched), summary)
+	}
+	if !summary.Partial() {
+		t.Error("Partial() = false, want true")
+	}
+	for path, count := range requested {
+		if count != 1 {
+			t.Errorf("%s requested %d times, want once", path, count)
+		}
+	}
+	// Requests are paced when sent, and arrive with some jitter
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < 15*time.Millisecond {
+			t.Errorf("requests %d and %d are %v apart, want at least the Crawl-delay", i-1, i, gap)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package sitecrawler
+
+// FetchSummary reports what FetchSiteArticles did with the articles found by a crawl.
+type FetchSummary struct {
+	// Seed is the URL the crawl started from.
+	Seed string `json:"seed"`
+	// PagesRead is the number of pages read for links, the seed included.
+	PagesRead int `json:"pages_read"`
+	// Found is the number of articles found by the crawl, before the sample.
+	Found int `json:"found"`
+	// Fetched is the number of articles returned, including those read from the cache.
+	Fetched int `json:"fetched"`
+	// Skipped are the articles excluded by their robots directives.
+	Skipped []ArticleOutcome `json:"skipped,omitempty"`
+	// Failed are the articles that could not be fetched.
+	Failed []ArticleOutcome `json:"failed,omitempty"`
+}
+
+// ArticleOutcome is an article that was skipped or failed, with the reason.
+type ArticleOutcome struct {
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+// Partial reports whether some articles were fetched and others failed.
+func (s *FetchSummary) Partial() bool {
+	return s.Fetched > 0 && len(s.Failed) > 0
+}
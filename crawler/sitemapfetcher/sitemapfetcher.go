@@ -0,0 +1,298 @@
+package sitemapfetcher
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/crawler/utils"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+	"github.com/zeace/poisson/models"
+)
+
+const (
+	// sitemapUserAgent is sent with sitemap requests.
+	sitemapUserAgent = "Mozilla/5.0 (compatible; poisson sitemap fetcher)"
+	// maxSitemapSize is the largest (uncompressed) sitemap read, the limit of the sitemaps protocol.
+	maxSitemapSize = 50 << 20
+	// maxSitemapDepth is how many levels of sitemap indexes are followed.
+	maxSitemapDepth = 3
+	// maxChildSitemaps bounds the number of sitemaps fetched from indexes in one run.
+	maxChildSitemaps = 50
+)
+
+// urlset is a sitemap listing pages.
+type urlset struct {
+	URLs []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+		// PublicationDate is the date of Google News sitemaps, used if there is no lastmod.
+		PublicationDate string `xml:"news>publication_date"`
+	} `xml:"url"`
+}
+
+// sitemapIndex is a sitemap listing other sitemaps.
+type sitemapIndex struct {
+	Sitemaps []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:"sitemap"`
+}
+
+// Entry is a page listed in a sitemap.
+type Entry struct {
+	URL string
+	// LastMod is when the page was last modified, zero if the sitemap doesn't say.
+	LastMod time.Time
+}
+
+// fetchSitemap downloads the sitemap at sitemapURL with httpClient, decompressing it if it is
+// gzipped, and sending credentials if they are set.
+func fetchSitemap(ctx context.Context, httpClient *http.Client, sitemapURL string, credentials *fetcher.Credentials) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", sitemapURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating sitemap request: %w", err)
+	}
+	req.Header.Set("User-Agent", sitemapUserAgent)
+	credentials.Apply(req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching sitemap %s: %w", sitemapURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("error fetching sitemap %s: unexpected status code: %d", sitemapURL, resp.StatusCode)
+	}
+
+	// Sitemaps are often served as .xml.gz files without a Content-Encoding
+	var body io.Reader = bufio.NewReader(resp.Body)
+	if magic, _ := body.(*bufio.Reader).Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing sitemap %s: %w", sitemapURL, err)
+		}
+		defer gzipReader.Close()
+		body = gzipReader
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxSitemapSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading sitemap %s: %w", sitemapURL, err)
+	}
+	return data, nil
+}
+
+// parseSitemap parses a sitemap or sitemap index, returning its pages and child sitemaps.
+func parseSitemap(data []byte) (pages []Entry, children []Entry, err error) {
+	var root struct{ XMLName xml.Name }
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, nil, fmt.Errorf("error parsing sitemap: %w", err)
+	}
+
+	switch root.XMLName.Local {
+	case "urlset":
+		var set urlset
+		if err := xml.Unmarshal(data, &set); err != nil {
+			return nil, nil, fmt.Errorf("error parsing sitemap: %w", err)
+		}
+		for _, u := range set.URLs {
+			lastMod := parseLastMod(u.LastMod)
+			if lastMod.IsZero() {
+				lastMod = parseLastMod(u.PublicationDate)
+			}
+			if loc := strings.TrimSpace(u.Loc); loc != "" {
+				pages = append(pages, Entry{URL: loc, LastMod: lastMod})
+			}
+		}
+	case "sitemapindex":
+		var index sitemapIndex
+		if err := xml.Unmarshal(data, &index); err != nil {
+			return nil, nil, fmt.Errorf("error parsing sitemap index: %w", err)
+		}
+		for _, s := range index.Sitemaps {
+			if loc := strings.TrimSpace(s.Loc); loc != "" {
+				children = append(children, Entry{URL: loc, LastMod: parseLastMod(s.LastMod)})
+			}
+		}
+	default:
+		return nil, nil, fmt.Errorf("error parsing sitemap: unexpected root element <%s>", root.XMLName.Local)
+	}
+	return pages, children, nil
+}
+
+// parseLastMod parses a W3C datetime as used by sitemaps, with or without a time or seconds.
+// It returns the zero time if s is empty or invalid.
+func parseLastMod(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// DiscoverURLs returns the pages listed in the sitemap at sitemapURL, following sitemap
+// indexes, most recently modified first. If since is non-zero, pages and child sitemaps
+// last modified before since are left out, as are pages without a lastmod. Errors fetching
+// child sitemaps are logged and skipped; only an error on sitemapURL itself is returned.
+// Sitemaps are fetched with the credentials and the proxy of fetchOptions, and refused on a
+// private, loopback or link-local address unless fetchOptions.AllowPrivateAddresses is set.
+func DiscoverURLs(
+	ctx context.Context,
+	sitemapURL string,
+	since time.Time,
+	fetchOptions fetcher.Options,
+	verbose bool,
+) ([]Entry, error) {
+	httpClient := fetcher.NewHTTPClient(fetchOptions, 0)
+	var entries []Entry
+	seen := make(map[string]bool)
+	visited := make(map[string]bool)
+	fetched := 0
+
+	var visit func(sitemapURL string, depth int) error
+	visit = func(sitemapURL string, depth int) error {
+		visited[sitemapURL] = true
+		data, err := fetchSitemap(ctx, httpClient, sitemapURL, fetchOptions.Credentials)
+		if err != nil {
+			return err
+		}
+		pages, children, err := parseSitemap(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", sitemapURL, err)
+		}
+		if verbose {
+			slog.InfoContext(ctx, "Parsed sitemap", "sitemap", sitemapURL, "urls", len(pages), "sitemaps", len(children))
+		}
+
+		for _, page := range pages {
+			if !since.IsZero() && page.LastMod.Before(since) {
+				continue
+			}
+			key := lib.NormalizeURL(page.URL)
+			if !seen[key] {
+				seen[key] = true
+				entries = append(entries, page)
+			}
+		}
+
+		for _, child := range children {
+			switch {
+			case visited[child.URL]:
+				continue
+			case !since.IsZero() && !child.LastMod.IsZero() && child.LastMod.Before(since):
+				continue // Nothing in it changed since
+			case depth >= maxSitemapDepth || fetched >= maxChildSitemaps:
+				slog.WarnContext(ctx, "Skipping sitemap: too many nested sitemaps", "sitemap", child.URL)
+				continue
+			}
+			fetched++
+			if err := visit(child.URL, depth+1); err != nil {
+				slog.WarnContext(ctx, "Error fetching sitemap", "sitemap", child.URL, "error", err)
+			}
+		}
+		return nil
+	}
+	if err := visit(sitemapURL, 1); err != nil {
+		return nil, err
+	}
+
+	// Newest first; pages without lastmod keep their sitemap order after the others
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].LastMod.After(entries[j].LastMod) })
+	return entries, nil
+}
+
+// FetchSitemapArticles discovers article URLs from the sitemap at sitemapURL (see DiscoverURLs)
+// and fetches the content of the maxArticles most recently modified ones concurrently using
+// fetcher.FetchMany, like rssfetcher.FetchRSSArticles does for the items of a feed. If sample
+// is enabled, a random sample of all the discovered articles is fetched instead.
+// If datastoreClient is provided, crawled pages will be saved to Datastore.
+// Pages excluded by their robots directives under fetchOptions are left out of the result.
+func FetchSitemapArticles(
+	ctx context.Context,
+	sitemapURL string,
+	maxArticles int,
+	sample utils.Sample,
+	since time.Time,
+	verbose bool,
+	datastoreClient lib.DatastoreClient,
+	fetchOptions fetcher.Options,
+) ([]*models.CrawledPage, error) {
+	ctx = logging.WithAttrs(ctx, "sitemap", sitemapURL)
+	if verbose {
+		slog.InfoContext(ctx, "Fetching sitemap")
+	}
+
+	entries, err := DiscoverURLs(ctx, sitemapURL, since, fetchOptions, verbose)
+	if err != nil {
+		return nil, err
+	}
+	if sample.Enabled() {
+		entries = utils.SampleItems(entries, sample)
+		if verbose {
+			slog.InfoContext(ctx, "Sampled sitemap articles", "sample", sample.String(), "sampled", len(entries))
+		}
+	} else if len(entries) > maxArticles {
+		entries = entries[:maxArticles]
+	}
+
+	articleURLs := make([]string, len(entries))
+	for i, entry := range entries {
+		articleURLs[i] = entry.URL
+	}
+	if verbose {
+		slog.InfoContext(ctx, "Fetching articles", "count", len(articleURLs))
+	}
+
+	var pages []*models.CrawledPage
+	var fetchErrors []error
+
+	// Fetch concurrently, capped globally and per host by fetchOptions
+	fetchOptions.Source = models.SourceRef{Kind: models.SourceKindSitemap, ID: sitemapURL}
+	for _, result := range fetcher.FetchMany(ctx, articleURLs, verbose, datastoreClient, fetchOptions) {
+		if result.Err != nil {
+			fetchErrors = append(fetchErrors, fmt.Errorf("article %s: %w", result.URL, result.Err))
+			if verbose {
+				slog.WarnContext(ctx, "Error fetching article", "url", result.URL, "error", result.Err)
+			}
+			continue
+		}
+		if result.Page.RobotsExcluded {
+			if verbose {
+				slog.InfoContext(ctx, "Skipping article: excluded by robots directives", "url", result.URL)
+			}
+			continue
+		}
+
+		result.Page.Feed = sitemapURL
+		pages = append(pages, result.Page)
+	}
+
+	// If we have errors and no pages, return an error
+	if len(pages) == 0 && len(fetchErrors) > 0 {
+		return nil, fmt.Errorf("failed to fetch any articles: %v", fetchErrors)
+	}
+
+	// If we got some pages but also some errors, return pages with an error indicating partial failure
+	if len(pages) > 0 && len(fetchErrors) > 0 {
+		if verbose {
+			slog.WarnContext(ctx, "Some articles could not be fetched",
+				"fetched", len(pages), "errors", len(fetchErrors))
+		}
+		return pages, fmt.Errorf("partial success: fetched %d article(s) but %d error(s) occurred: %v",
+			len(pages), len(fetchErrors), fetchErrors)
+	}
+
+	return pages, nil
+}
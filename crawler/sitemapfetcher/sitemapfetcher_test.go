@@ -0,0 +1,174 @@
+package sitemapfetcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/crawler/fetcher"
+)
+
+func TestParseLastMod(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Time
+	}{
+		{"2024-04-01", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"2024-04-01T08:30:00Z", time.Date(2024, 4, 1, 8, 30, 0, 0, time.UTC)},
+		{" 2024-04-01T10:30+02:00 ", time.Date(2024, 4, 1, 8, 30, 0, 0, time.UTC)},
+		{"", time.Time{}},
+		{"yesterday", time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := parseLastMod(tt.input); !got.Equal(tt.want) {
+			t.Errorf("parseLastMod(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseSitemap(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		wantPages    []string
+		wantChildren []string
+		wantErr      bool
+	}{
+		{
+			name: "urlset",
+			data: `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://example.com/a</loc><lastmod>2024-04-01</lastmod></url>
+  <url><loc> https://example.com/b </loc></url>
+  <url><loc></loc></url>
+</urlset>`,
+			wantPages: []string{"https://example.com/a", "https://example.com/b"},
+		},
+		{
+			name: "sitemap index",
+			data: `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://example.com/sitemap-1.xml</loc></sitemap>
+</sitemapindex>`,
+			wantChildren: []string{"https://example.com/sitemap-1.xml"},
+		},
+		{name: "RSS feed", data: `<rss><channel></channel></rss>`, wantErr: true},
+		{name: "not XML", data: `<html`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages, children, err := parseSitemap([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSitemap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := entryURLs(pages); got != strings.Join(tt.wantPages, " ") {
+				t.Errorf("pages = %q, want %q", got, tt.wantPages)
+			}
+			if got := entryURLs(children); got != strings.Join(tt.wantChildren, " ") {
+				t.Errorf("children = %q, want %q", got, tt.wantChildren)
+			}
+		})
+	}
+}
+
+func TestParseSitemap_NewsPublicationDate(t *testing.T) {
+	data := `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:news="http://www.google.com/schemas/sitemap-news/0.9">
+  <url><loc>https://example.com/news</loc><news:news><news:publication_date>2024-04-01T06:00:00Z</news:publication_date></news:news></url>
+</urlset>`
+	pages, _, err := parseSitemap([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 4, 1, 6, 0, 0, 0, time.UTC); len(pages) != 1 || !pages[0].LastMod.Equal(want) {
+		t.Errorf("pages = %+v, want the publication date as lastmod", pages)
+	}
+}
+
+func TestDiscoverURLs(t *testing.T) {
+	var server *httptest.Server
+	sitemaps := map[string]string{
+		"/sitemap.xml": `<sitemapindex>
+  <sitemap><loc>%[1]s/old.xml</loc><lastmod>2023-01-01</lastmod></sitemap>
+  <sitemap><loc>%[1]s/recent.xml.gz</loc><lastmod>2024-04-02</lastmod></sitemap>
+  <sitemap><loc>%[1]s/missing.xml</loc></sitemap>
+  <sitemap><loc>%[1]s/sitemap.xml</loc></sitemap>
+</sitemapindex>`,
+		"/old.xml": `<urlset><url><loc>https://example.com/old</loc><lastmod>2023-01-01</lastmod></url></urlset>`,
+		"/recent.xml.gz": `<urlset>
+  <url><loc>https://example.com/undated</loc></url>
+  <url><loc>https://example.com/april-1</loc><lastmod>2024-04-01</lastmod></url>
+  <url><loc>https://example.com/march</loc><lastmod>2024-03-01</lastmod></url>
+  <url><loc>https://example.com/april-2</loc><lastmod>2024-04-02T09:00:00Z</lastmod></url>
+  <url><loc>http://example.com/april-1</loc><lastmod>2024-04-01</lastmod></url>
+</urlset>`,
+	}
+	requested := make(map[string]int)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested[r.URL.Path]++
+		body, ok := sitemaps[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		body = fmt.Sprintf(body, server.URL)
+		if strings.HasSuffix(r.URL.Path, ".gz") {
+			var buf bytes.Buffer
+			gzipWriter := gzip.NewWriter(&buf)
+			gzipWriter.Write([]byte(body))
+			gzipWriter.Close()
+			w.Write(buf.Bytes())
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	options := fetcher.Options{AllowPrivateAddresses: true}
+
+	entries, err := DiscoverURLs(ctx, server.URL+"/sitemap.xml", time.Time{}, options, false)
+	if err != nil {
+		t.Fatalf("DiscoverURLs() error = %v", err)
+	}
+	want := "https://example.com/april-2 https://example.com/april-1 https://example.com/march " +
+		"https://example.com/old https://example.com/undated"
+	if got := entryURLs(entries); got != want {
+		t.Errorf("DiscoverURLs() = %q, want %q", got, want)
+	}
+	if requested["/sitemap.xml"] != 1 {
+		t.Errorf("index fetched %d times, want once", requested["/sitemap.xml"])
+	}
+
+	// Filtering by lastmod skips the old sitemap and the undated pages
+	requested = make(map[string]int)
+	entries, err = DiscoverURLs(ctx, server.URL+"/sitemap.xml", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), options, false)
+	if err != nil {
+		t.Fatalf("DiscoverURLs() error = %v", err)
+	}
+	if got := entryURLs(entries); got != "https://example.com/april-2 https://example.com/april-1" {
+		t.Errorf("DiscoverURLs() since March 15 = %q", got)
+	}
+	if requested["/old.xml"] != 0 {
+		t.Error("sitemap last modified before since was fetched")
+	}
+
+	if _, err := DiscoverURLs(ctx, server.URL+"/missing.xml", time.Time{}, options, false); err == nil {
+		t.Error("DiscoverURLs() of a missing sitemap expected an error")
+	}
+	if _, err := DiscoverURLs(ctx, server.URL+"/sitemap.xml", time.Time{}, fetcher.Options{}, false); err == nil {
+		t.Error("DiscoverURLs() of a loopback sitemap expected an error without AllowPrivateAddresses")
+	}
+}
+
+// entryURLs returns the URLs of entries separated by spaces.
+func entryURLs(entries []Entry) string {
+	urls := make([]string, len(entries))
+	for i, entry := range entries {
+		urls[i] = entry.URL
+	}
+	return strings.Join(urls, " ")
+}
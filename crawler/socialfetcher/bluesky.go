@@ -0,0 +1,215 @@
+package socialfetcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// blueskyPostCollection is the collection of Bluesky posts in the AT Protocol.
+	blueskyPostCollection = "app.bsky.feed.post"
+	// resolveHandleTimeout bounds the resolution of a Bluesky handle.
+	resolveHandleTimeout = 10 * time.Second
+)
+
+// blueskyHosts are the Bluesky sites whose links are left out of posts.
+var blueskyHosts = []string{"bsky.app", "bsky.social"}
+
+// jetstreamEvent is the part of a Jetstream event read for the links of new posts.
+type jetstreamEvent struct {
+	DID    string `json:"did"`
+	Kind   string `json:"kind"`
+	Commit *struct {
+		Operation  string          `json:"operation"`
+		Collection string          `json:"collection"`
+		RKey       string          `json:"rkey"`
+		Record     json.RawMessage `json:"record"`
+	} `json:"commit"`
+}
+
+// blueskyPost is the part of an app.bsky.feed.post record read for its links and hashtags.
+type blueskyPost struct {
+	Text   string   `json:"text"`
+	Tags   []string `json:"tags"`
+	Facets []struct {
+		Features []struct {
+			Type string `json:"$type"`
+			URI  string `json:"uri"`
+			Tag  string `json:"tag"`
+		} `json:"features"`
+	} `json:"facets"`
+	Embed *blueskyEmbed `json:"embed"`
+}
+
+// blueskyEmbed is a post embed: a link card, or a quoted post with media that may be one.
+type blueskyEmbed struct {
+	External *struct {
+		URI string `json:"uri"`
+	} `json:"external"`
+	Media *blueskyEmbed `json:"media"`
+}
+
+// resolveHandle returns the DID of a Bluesky handle, using the resolveHandle method of api.
+func resolveHandle(ctx context.Context, api, handle string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, resolveHandleTimeout)
+	defer cancel()
+
+	endpoint := strings.TrimSuffix(api, "/") + "/xrpc/com.atproto.identity.resolveHandle?handle=" + url.QueryEscape(handle)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating handle request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error resolving Bluesky handle %s: %w", handle, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error resolving Bluesky handle %s: unexpected status code: %d", handle, resp.StatusCode)
+	}
+
+	var result struct {
+		DID string `json:"did"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.DID == "" {
+		return "", fmt.Errorf("error resolving Bluesky handle %s: invalid response", handle)
+	}
+	return result.DID, nil
+}
+
+// jetstreamURL returns the URL of the Jetstream subscription to new posts. If no source is a
+// hashtag, only the posts of accountDIDs are streamed; otherwise every post is, to be
+// filtered by hashtag.
+func jetstreamURL(base string, sources []Source, accountDIDs map[string]string) string {
+	query := url.Values{"wantedCollections": {blueskyPostCollection}}
+	hashtags := false
+	for _, source := range sources {
+		hashtags = hashtags || source.Hashtag != ""
+	}
+	if !hashtags {
+		for did := range accountDIDs {
+			query.Add("wantedDids", did)
+		}
+	}
+	return base + "?" + query.Encode()
+}
+
+// streamBluesky reads new posts from Jetstream and sends the links of those by the accounts or
+// with the hashtags of sources to links. It returns when the stream fails, or ctx is done.
+func streamBluesky(ctx context.Context, sources []Source, opts Options, links chan<- Link) error {
+	// DIDs of the watched accounts, with their source
+	accountDIDs := make(map[string]string)
+	for _, source := range sources {
+		if source.Account == "" {
+			continue
+		}
+		did, err := resolveHandle(ctx, opts.BlueskyAPI, source.Account)
+		if err != nil {
+			return err
+		}
+		accountDIDs[did] = source.String()
+	}
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, jetstreamURL(opts.JetstreamURL, sources, accountDIDs), nil)
+	if err != nil {
+		return fmt.Errorf("error connecting to Jetstream: %w", err)
+	}
+	defer conn.Close()
+	slog.InfoContext(ctx, "Connected to Jetstream", "sources", len(sources))
+
+	// Unblock ReadMessage when ctx is done
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("error reading Jetstream: %w", err)
+		}
+		for _, link := range jetstreamLinks(message, sources, accountDIDs) {
+			if !send(ctx, links, link) {
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// jetstreamLinks returns the links of the post created in a Jetstream event, if it is by one of
+// accountDIDs or has the hashtag of one of sources.
+func jetstreamLinks(message []byte, sources []Source, accountDIDs map[string]string) []Link {
+	var event jetstreamEvent
+	if err := json.Unmarshal(message, &event); err != nil || event.Kind != "commit" || event.Commit == nil ||
+		event.Commit.Operation != "create" || event.Commit.Collection != blueskyPostCollection {
+		return nil
+	}
+	var post blueskyPost
+	if err := json.Unmarshal(event.Commit.Record, &post); err != nil {
+		return nil
+	}
+
+	source, ok := accountDIDs[event.DID]
+	if !ok {
+		source, ok = matchHashtag(&post, sources)
+	}
+	if !ok {
+		return nil
+	}
+
+	postURL := fmt.Sprintf("https://bsky.app/profile/%s/post/%s", event.DID, event.Commit.RKey)
+	var result []Link
+	for _, link := range blueskyLinks(&post) {
+		result = append(result, Link{URL: link, Source: source, PostURL: postURL})
+	}
+	return result
+}
+
+// matchHashtag returns the first of the hashtag sources whose hashtag post has, in its facets
+// or tags.
+func matchHashtag(post *blueskyPost, sources []Source) (string, bool) {
+	tags := make(map[string]bool)
+	for _, tag := range post.Tags {
+		tags[strings.ToLower(tag)] = true
+	}
+	for _, facet := range post.Facets {
+		for _, feature := range facet.Features {
+			if feature.Type == "app.bsky.richtext.facet#tag" {
+				tags[strings.ToLower(feature.Tag)] = true
+			}
+		}
+	}
+	for _, source := range sources {
+		if source.Hashtag != "" && tags[source.Hashtag] {
+			return source.String(), true
+		}
+	}
+	return "", false
+}
+
+// blueskyLinks returns the article links of a post: its link card and the links in its text.
+func blueskyLinks(post *blueskyPost) []string {
+	var urls []string
+	for embed := post.Embed; embed != nil; embed = embed.Media {
+		if embed.External != nil {
+			urls = append(urls, embed.External.URI)
+		}
+	}
+	for _, facet := range post.Facets {
+		for _, feature := range facet.Features {
+			if feature.Type == "app.bsky.richtext.facet#link" {
+				urls = append(urls, feature.URI)
+			}
+		}
+	}
+	return articleLinks(urls, blueskyHosts...)
+}
@@ -0,0 +1,134 @@
+package socialfetcher
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// mastodonUserAgent is sent with Mastodon streaming requests.
+const mastodonUserAgent = "Mozilla/5.0 (compatible; poisson social watcher)"
+
+// mastodonStatus is the part of a Mastodon status read for its links.
+type mastodonStatus struct {
+	URL     string `json:"url"`
+	Content string `json:"content"`
+	Card    *struct {
+		URL string `json:"url"`
+	} `json:"card"`
+	// Reblog is the boosted status, if this one is a boost.
+	Reblog *mastodonStatus `json:"reblog"`
+}
+
+// mastodonStreamURL returns the URL of the streaming API endpoint of source.
+func mastodonStreamURL(source Source) string {
+	if source.Hashtag != "" {
+		return fmt.Sprintf("https://%s/api/v1/streaming/hashtag?tag=%s", source.Instance, url.QueryEscape(source.Hashtag))
+	}
+	return fmt.Sprintf("https://%s/api/v1/streaming/user", source.Instance)
+}
+
+// streamMastodon reads the server-sent events of the Mastodon stream of source and sends the
+// links of each new status to links. It returns when the stream ends or fails, or ctx is done.
+func streamMastodon(ctx context.Context, source Source, token string, links chan<- Link) error {
+	return streamMastodonURL(ctx, mastodonStreamURL(source), source, token, links)
+}
+
+// streamMastodonURL is streamMastodon with the URL of the stream.
+func streamMastodonURL(ctx context.Context, streamURL string, source Source, token string, links chan<- Link) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", streamURL, nil)
+	if err != nil {
+		return fmt.Errorf("error creating Mastodon stream request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("User-Agent", mastodonUserAgent)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	// No client timeout: the stream stays open
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error connecting to Mastodon stream: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error connecting to Mastodon stream: unexpected status code: %d", resp.StatusCode)
+	}
+	slog.InfoContext(ctx, "Connected to Mastodon stream", "source", source.String())
+
+	var event string
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// A blank line dispatches the event
+			if event == "update" && len(data) > 0 {
+				if !sendStatusLinks(ctx, strings.Join(data, "\n"), source, links) {
+					return ctx.Err()
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, ":"):
+			// Heartbeat comment
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading Mastodon stream: %w", err)
+	}
+	return errors.New("Mastodon stream closed")
+}
+
+// sendStatusLinks sends the links of the status encoded in data to links, returning false if
+// ctx is done first. Statuses that can't be decoded are logged and skipped.
+func sendStatusLinks(ctx context.Context, data string, source Source, links chan<- Link) bool {
+	var status mastodonStatus
+	if err := json.Unmarshal([]byte(data), &status); err != nil {
+		slog.WarnContext(ctx, "Skipping invalid Mastodon status", "source", source.String(), "error", err)
+		return true
+	}
+	postURL := status.URL
+	if status.Reblog != nil {
+		postURL = status.Reblog.URL
+	}
+	for _, link := range mastodonLinks(&status, source.Instance) {
+		if !send(ctx, links, Link{URL: link, Source: source.String(), PostURL: postURL}) {
+			return false
+		}
+	}
+	return true
+}
+
+// mastodonLinks returns the article links of a status, or of the status it boosts: its preview
+// card and the links of its content, leaving out mentions, hashtags and links to instance.
+func mastodonLinks(status *mastodonStatus, instance string) []string {
+	if status.Reblog != nil {
+		status = status.Reblog
+	}
+
+	var urls []string
+	if status.Card != nil && status.Card.URL != "" {
+		urls = append(urls, status.Card.URL)
+	}
+	if doc, err := goquery.NewDocumentFromReader(strings.NewReader(status.Content)); err == nil {
+		doc.Find("a[href]").Not(".mention, .hashtag, [rel~=tag]").Each(func(_ int, a *goquery.Selection) {
+			urls = append(urls, a.AttrOr("href", ""))
+		})
+	}
+	return articleLinks(urls, instance)
+}
@@ -0,0 +1,254 @@
+package socialfetcher
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeace/poisson/crawler/utils"
+)
+
+// Network is a social network whose posts are watched.
+type Network string
+
+const (
+	NetworkMastodon Network = "mastodon"
+	NetworkBluesky  Network = "bluesky"
+)
+
+const (
+	// DefaultJetstreamURL is the Bluesky Jetstream endpoint streaming new posts as JSON.
+	DefaultJetstreamURL = "wss://jetstream2.us-east.bsky.network/subscribe"
+	// DefaultBlueskyAPI is the public Bluesky API used to resolve handles.
+	DefaultBlueskyAPI = "https://public.api.bsky.app"
+	// reconnectDelay is the wait before reconnecting a stream after its first failure,
+	// doubled after each other one up to maxReconnectDelay.
+	reconnectDelay    = time.Second
+	maxReconnectDelay = 5 * time.Minute
+	// MaxSources is the largest number of sources ParseSources accepts.
+	MaxSources = 20
+)
+
+var (
+	// hashtagPattern matches the hashtags accepted in sources, without the #.
+	hashtagPattern = regexp.MustCompile(`^[\pL\pN_]{1,64}$`)
+	// hostnamePattern matches the Mastodon instances and Bluesky handles accepted in sources: a
+	// domain name with at least two labels.
+	hostnamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z][a-z0-9-]{0,61}[a-z0-9]$`)
+)
+
+// Source is a Mastodon or Bluesky account or hashtag whose posts are watched.
+type Source struct {
+	Network Network
+	// Instance is the Mastodon server, e.g. mastodon.social. Empty for Bluesky.
+	Instance string
+	// Account is the handle of a watched Bluesky account, e.g. example.bsky.social. Empty for
+	// hashtags and for Mastodon, where the home timeline of the account of the access token
+	// is watched instead: follow the accounts to watch with it.
+	Account string
+	// Hashtag is a watched hashtag without the #, lowercase.
+	Hashtag string
+}
+
+// String returns the source in the syntax of ParseSources.
+func (s Source) String() string {
+	switch {
+	case s.Network == NetworkMastodon && s.Hashtag != "":
+		return fmt.Sprintf("mastodon:%s#%s", s.Instance, s.Hashtag)
+	case s.Network == NetworkMastodon:
+		return "mastodon:" + s.Instance
+	case s.Hashtag != "":
+		return "bluesky:#" + s.Hashtag
+	default:
+		return "bluesky:@" + s.Account
+	}
+}
+
+// ParseSources parses a comma-separated list of sources:
+//
+//   - mastodon:<instance> for the home timeline of the account of the access token,
+//   - mastodon:<instance>#<hashtag> for a hashtag on a Mastodon server,
+//   - bluesky:@<handle> for a Bluesky account,
+//   - bluesky:#<hashtag> for a Bluesky hashtag.
+//
+// Instances and handles must be domain names, hashtags letters, digits and underscores, and
+// there can be at most MaxSources sources.
+func ParseSources(s string) ([]Source, error) {
+	var sources []Source
+	for _, spec := range strings.Split(s, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		network, target, ok := strings.Cut(spec, ":")
+		if !ok || target == "" {
+			return nil, fmt.Errorf("invalid social source %q: expected <network>:<account or hashtag>", spec)
+		}
+
+		var source Source
+		switch Network(strings.ToLower(network)) {
+		case NetworkMastodon:
+			instance, hashtag, hasHashtag := strings.Cut(strings.ToLower(target), "#")
+			if !hostnamePattern.MatchString(instance) || (hasHashtag && !hashtagPattern.MatchString(hashtag)) {
+				return nil, fmt.Errorf("invalid social source %q: expected mastodon:<instance> or mastodon:<instance>#<hashtag>", spec)
+			}
+			source = Source{Network: NetworkMastodon, Instance: instance, Hashtag: hashtag}
+		case NetworkBluesky:
+			target = strings.ToLower(target)
+			switch {
+			case strings.HasPrefix(target, "@") && hostnamePattern.MatchString(target[1:]):
+				source = Source{Network: NetworkBluesky, Account: target[1:]}
+			case strings.HasPrefix(target, "#") && hashtagPattern.MatchString(target[1:]):
+				source = Source{Network: NetworkBluesky, Hashtag: target[1:]}
+			default:
+				return nil, fmt.Errorf("invalid social source %q: expected bluesky:@<handle> or bluesky:#<hashtag>", spec)
+			}
+		default:
+			return nil, fmt.Errorf("invalid social source %q: unknown network %q (use mastodon or bluesky)", spec, network)
+		}
+		sources = append(sources, source)
+	}
+	if len(sources) > MaxSources {
+		return nil, fmt.Errorf("too many social sources: %d (at most %d)", len(sources), MaxSources)
+	}
+	return sources, nil
+}
+
+// Link is an article link shared in a watched post.
+type Link struct {
+	URL string
+	// Source is the watched account or hashtag the post was found in (see Source.String).
+	Source string
+	// PostURL is the URL of the post on its network.
+	PostURL string
+}
+
+// Options configures Watch.
+type Options struct {
+	// MastodonToken is the access token sent to Mastodon servers. The home timeline needs one,
+	// and many servers require one for hashtag streams too.
+	MastodonToken string
+	// JetstreamURL is the Bluesky Jetstream endpoint. Empty means DefaultJetstreamURL.
+	JetstreamURL string
+	// BlueskyAPI is the Bluesky API resolving handles. Empty means DefaultBlueskyAPI.
+	BlueskyAPI string
+}
+
+// Watch streams the posts of sources and sends the article links they share to links, until ctx
+// is done. Each Mastodon source has its own stream, and all Bluesky sources share one. Streams
+// that fail or end are reconnected with exponential backoff. Links to the networks themselves
+// are left out.
+func Watch(ctx context.Context, sources []Source, opts Options, links chan<- Link) {
+	if opts.JetstreamURL == "" {
+		opts.JetstreamURL = DefaultJetstreamURL
+	}
+	if opts.BlueskyAPI == "" {
+		opts.BlueskyAPI = DefaultBlueskyAPI
+	}
+
+	var wg sync.WaitGroup
+	var bluesky []Source
+	for _, source := range sources {
+		if source.Network == NetworkBluesky {
+			bluesky = append(bluesky, source)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keepStreaming(ctx, source.String(), func() error {
+				return streamMastodon(ctx, source, opts.MastodonToken, links)
+			})
+		}()
+	}
+	if len(bluesky) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keepStreaming(ctx, "bluesky", func() error {
+				return streamBluesky(ctx, bluesky, opts, links)
+			})
+		}()
+	}
+	wg.Wait()
+}
+
+// keepStreaming runs stream until ctx is done, waiting before each new run after a failure. The
+// wait is doubled after each failure, and starts over once a stream has run for longer than
+// maxReconnectDelay.
+func keepStreaming(ctx context.Context, name string, stream func() error) {
+	delay := reconnectDelay
+	for ctx.Err() == nil {
+		started := time.Now()
+		err := stream()
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > maxReconnectDelay {
+			delay = reconnectDelay
+		}
+		slog.WarnContext(ctx, "Social stream ended, reconnecting", "source", name, "error", err, "wait", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// articleLinks returns the valid http(s) URLs among urls, normalized, in order and without
+// duplicates, leaving out those on skipHosts and their subdomains. Anyone can post with a
+// watched hashtag, so only links to the default port of a public domain name are kept.
+func articleLinks(urls []string, skipHosts ...string) []string {
+	var links []string
+	for _, result := range utils.BatchValidate(urls) {
+		if result.Err != nil || !publicLink(result.Normalized, result.Host) || onHosts(result.Host, skipHosts) {
+			continue
+		}
+		links = append(links, result.Normalized)
+	}
+	return links
+}
+
+// publicLink reports whether link, a normalized URL with host host, has neither credentials
+// nor a port, and its host is a domain name rather than an IP address or a local name.
+func publicLink(link, host string) bool {
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.User != nil || parsed.Port() != "" {
+		return false
+	}
+	if _, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return false
+	}
+	return strings.Contains(host, ".") && !strings.HasSuffix(host, ".localhost") && !strings.HasSuffix(host, ".local")
+}
+
+// onHosts reports whether host is one of hosts or a subdomain of one.
+func onHosts(host string, hosts []string) bool {
+	for _, h := range hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// send sends link to links, returning false if ctx is done first.
+func send(ctx context.Context, links chan<- Link, link Link) bool {
+	select {
+	case links <- link:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
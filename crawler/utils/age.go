@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseMaxAge converts a string to an age, such as the maximum age of cached analyses or pages.
+// It accepts a number of days such as "30d" or a Go duration such as "12h". The empty string
+// means no limit and is returned as zero.
+func ParseMaxAge(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	var maxAge time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid max age %q (want e.g. 30d or 12h)", s)
+		}
+		maxAge = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if maxAge, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid max age %q (want e.g. 30d or 12h)", s)
+		}
+	}
+	if maxAge < 0 {
+		return 0, fmt.Errorf("invalid max age %q: must not be negative", s)
+	}
+	return maxAge, nil
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMaxAge(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    time.Duration
+		expectError bool
+	}{
+		{"", 0, false},
+		{"30d", 30 * 24 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"xd", 0, true},
+		{"soon", 0, true},
+		{"-1h", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseMaxAge(tt.input)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ParseMaxAge(%q) error = %v, expectError %v", tt.input, err, tt.expectError)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseMaxAge(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/zeace/poisson/lib"
+)
+
+// ErrDuplicateURL is returned by BatchValidate for a URL that normalizes to the same page as an earlier one.
+var ErrDuplicateURL = errors.New("duplicate URL")
+
+// URLResult is the outcome of validating one URL with BatchValidate.
+type URLResult struct {
+	// Input is the URL as given.
+	Input string
+	// Normalized is the canonical form of the URL (see Normalize). Empty if Err is set
+	// for a reason other than ErrDuplicateURL.
+	Normalized string
+	// Host is the lowercase host name without port. Empty if Normalized is empty.
+	Host string
+	// Err is why the URL was rejected, or nil if it is valid.
+	Err error
+}
+
+// Normalize validates urlStr with ValidateURL and returns its canonical form: surrounding
+// whitespace and the fragment are removed, the scheme and host are lowercased, and the
+// default port for the scheme is dropped. The path and query are kept as given.
+func Normalize(urlStr string) (string, error) {
+	urlStr = strings.TrimSpace(urlStr)
+	if err := ValidateURL(urlStr); err != nil {
+		return "", err
+	}
+
+	parsed, err := url.Parse(urlStr)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL format: %w", err)
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	if port := parsed.Port(); (parsed.Scheme == "http" && port == "80") || (parsed.Scheme == "https" && port == "443") {
+		parsed.Host = parsed.Hostname()
+	}
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	return parsed.String(), nil
+}
+
+// Host validates urlStr with ValidateURL and returns its lowercase host name without port.
+func Host(urlStr string) (string, error) {
+	normalized, err := Normalize(urlStr)
+	if err != nil {
+		return "", err
+	}
+	parsed, err := url.Parse(normalized)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL format: %w", err)
+	}
+	host := parsed.Hostname()
+	if host == "" {
+		return "", fmt.Errorf("URL must include a host")
+	}
+	return host, nil
+}
+
+// BatchValidate validates and normalizes each URL, returning one result per input in the same order.
+// A URL that refers to the same stored page as an earlier one in urls (see lib.NormalizeURL)
+// gets ErrDuplicateURL.
+func BatchValidate(urls []string) []URLResult {
+	results := make([]URLResult, len(urls))
+	seen := make(map[string]bool)
+
+	for i, input := range urls {
+		results[i].Input = input
+
+		normalized, err := Normalize(input)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		host, err := Host(normalized)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].Normalized = normalized
+		results[i].Host = host
+
+		key := lib.NormalizeURL(normalized)
+		if seen[key] {
+			results[i].Err = ErrDuplicateURL
+			continue
+		}
+		seen[key] = true
+	}
+
+	return results
+}
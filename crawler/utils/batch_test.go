@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"already canonical", "https://example.com/a?b=1", "https://example.com/a?b=1", false},
+		{"whitespace and fragment", "  https://example.com/a#section \n", "https://example.com/a", false},
+		{"uppercase scheme and host", "HTTPS://Example.COM/Path", "https://example.com/Path", false},
+		{"default https port", "https://example.com:443/a", "https://example.com/a", false},
+		{"default http port", "http://example.com:80/a", "http://example.com/a", false},
+		{"non-default port kept", "http://localhost:8080/a", "http://localhost:8080/a", false},
+		{"missing scheme", "example.com/a", "", true},
+		{"unsupported scheme", "ftp://example.com/a", "", true},
+		{"empty", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Normalize(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHost(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"https://Example.com/a", "example.com", false},
+		{"http://localhost:8080/a", "localhost", false},
+		{"http://[::1]:8080/", "::1", false},
+		{"http://:80/", "", true},
+		{"not a url", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Host(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Host(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("Host(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBatchValidate(t *testing.T) {
+	results := BatchValidate([]string{
+		"https://example.com/a",
+		"ftp://example.com/b",
+		"http://EXAMPLE.com/a?utm_source=x",
+		"https://other.org/c",
+	})
+
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(results))
+	}
+	if results[0].Err != nil || results[0].Normalized != "https://example.com/a" || results[0].Host != "example.com" {
+		t.Errorf("Unexpected result for valid URL: %+v", results[0])
+	}
+	if results[1].Err == nil || results[1].Normalized != "" {
+		t.Errorf("Expected error for ftp URL, got %+v", results[1])
+	}
+	if !errors.Is(results[2].Err, ErrDuplicateURL) || results[2].Normalized == "" {
+		t.Errorf("Expected ErrDuplicateURL with normalized form, got %+v", results[2])
+	}
+	if results[3].Err != nil || results[3].Host != "other.org" || results[3].Input != "https://other.org/c" {
+		t.Errorf("Unexpected result for valid URL: %+v", results[3])
+	}
+}
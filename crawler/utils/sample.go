@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sample selects a random subset of the items of a large source, such as a firehose sitemap,
+// instead of its first items, so that statistics over the analyzed articles are representative.
+// The zero Sample selects nothing and means sampling is disabled.
+type Sample struct {
+	// Count is the number of items selected, zero if Percent is used.
+	Count int
+	// Percent is the share of items selected, above 0 and at most 100, zero if Count is used.
+	Percent float64
+	// Seed makes the selection reproducible when non-zero; zero picks a random seed.
+	Seed uint64
+}
+
+// ParseSample parses a sample size given on the command line: a number of items such as "200"
+// or a percentage such as "5%". The empty string means no sampling.
+func ParseSample(s string) (Sample, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Sample{}, nil
+	}
+	if percent, ok := strings.CutSuffix(s, "%"); ok {
+		value, err := strconv.ParseFloat(strings.TrimSpace(percent), 64)
+		if err != nil || value <= 0 || value > 100 {
+			return Sample{}, fmt.Errorf("invalid sample %q: percentage must be above 0 and at most 100", s)
+		}
+		return Sample{Percent: value}, nil
+	}
+	count, err := strconv.Atoi(s)
+	if err != nil || count <= 0 {
+		return Sample{}, fmt.Errorf("invalid sample %q (want a number of items such as 200 or a percentage such as 5%%)", s)
+	}
+	return Sample{Count: count}, nil
+}
+
+// Enabled reports whether s selects items.
+func (s Sample) Enabled() bool {
+	return s.Count > 0 || s.Percent > 0
+}
+
+// Size returns how many of n items s selects. A percentage of a non-empty source selects at
+// least one item.
+func (s Sample) Size(n int) int {
+	if s.Percent > 0 {
+		return min(n, max(1, int(math.Round(float64(n)*s.Percent/100))))
+	}
+	return min(n, s.Count)
+}
+
+// String returns s as accepted by ParseSample.
+func (s Sample) String() string {
+	if s.Percent > 0 {
+		return strconv.FormatFloat(s.Percent, 'f', -1, 64) + "%"
+	}
+	return strconv.Itoa(s.Count)
+}
+
+// SampleItems returns a uniformly random subset of items of size s.Size(len(items)), in their
+// original order.
+func SampleItems[T any](items []T, s Sample) []T {
+	seed := s.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	rng := rand.New(rand.NewPCG(seed, seed))
+
+	indexes := rng.Perm(len(items))[:s.Size(len(items))]
+	sort.Ints(indexes)
+	sampled := make([]T, len(indexes))
+	for i, index := range indexes {
+		sampled[i] = items[index]
+	}
+	return sampled
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseSample(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Sample
+		wantErr bool
+	}{
+		{"empty", "", Sample{}, false},
+		{"count", "200", Sample{Count: 200}, false},
+		{"percentage", "5%", Sample{Percent: 5}, false},
+		{"fractional percentage", " 0.5% ", Sample{Percent: 0.5}, false},
+		{"zero", "0", Sample{}, true},
+		{"negative", "-3", Sample{}, true},
+		{"over 100%", "150%", Sample{}, true},
+		{"not a number", "some", Sample{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSample(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSample(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSample(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSample_Size(t *testing.T) {
+	tests := []struct {
+		sample Sample
+		n      int
+		want   int
+	}{
+		{Sample{Count: 10}, 100, 10},
+		{Sample{Count: 10}, 3, 3},
+		{Sample{Percent: 5}, 1000, 50},
+		{Sample{Percent: 5}, 4, 1},
+		{Sample{Percent: 100}, 7, 7},
+		{Sample{Percent: 5}, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.sample.Size(tt.n); got != tt.want {
+			t.Errorf("%v.Size(%d) = %d, want %d", tt.sample, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSampleItems(t *testing.T) {
+	items := make([]int, 1000)
+	for i := range items {
+		items[i] = i
+	}
+
+	sample := Sample{Count: 50, Seed: 42}
+	sampled := SampleItems(items, sample)
+	if len(sampled) != 50 {
+		t.Fatalf("SampleItems() returned %d items, want 50", len(sampled))
+	}
+	if !slices.IsSorted(sampled) {
+		t.Error("SampleItems() didn't keep the order of the items")
+	}
+	if slices.Equal(sampled, items[:50]) {
+		t.Error("SampleItems() returned the first items")
+	}
+	if again := SampleItems(items, sample); !slices.Equal(again, sampled) {
+		t.Error("SampleItems() with the same seed returned another sample")
+	}
+	if sampled[len(sampled)-1] < 500 {
+		t.Errorf("SampleItems() only drew from the start of the items: %v", sampled)
+	}
+}
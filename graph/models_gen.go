@@ -7,20 +7,198 @@ type AnalysisResult struct {
 	JokePercentage    *int    `json:"jokePercentage,omitempty"`
 	JokeReasoning     *string `json:"jokeReasoning,omitempty"`
 	PromptFingerprint int     `json:"promptFingerprint"`
+	PromptVersion     int     `json:"promptVersion"`
+	Model             *string `json:"model,omitempty"`
+	Provider          *string `json:"provider,omitempty"`
+	CacheSource       *string `json:"cacheSource,omitempty"`
+	PromptTokens      int     `json:"promptTokens"`
+	CompletionTokens  int     `json:"completionTokens"`
+	CostUsd           float64 `json:"costUsd"`
+}
+
+type APIStats struct {
+	TotalRequests int              `json:"totalRequests"`
+	Tokens        []*APITokenUsage `json:"tokens"`
+}
+
+type APIToken struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Scopes       []string `json:"scopes"`
+	CreatedAt    string   `json:"createdAt"`
+	RevokedAt    *string  `json:"revokedAt,omitempty"`
+	RequestCount int      `json:"requestCount"`
+	LastUsedAt   *string  `json:"lastUsedAt,omitempty"`
+}
+
+type APITokenUsage struct {
+	ID           string  `json:"id"`
+	Name         string  `json:"name"`
+	RequestCount int     `json:"requestCount"`
+	LastUsedAt   *string `json:"lastUsedAt,omitempty"`
+	Revoked      bool    `json:"revoked"`
+}
+
+type AuditEvent struct {
+	URL               string  `json:"url"`
+	Action            string  `json:"action"`
+	Mode              *string `json:"mode,omitempty"`
+	PromptFingerprint *int    `json:"promptFingerprint,omitempty"`
+	PromptVersion     *int    `json:"promptVersion,omitempty"`
+	Model             *string `json:"model,omitempty"`
+	JokePercentage    *int    `json:"jokePercentage,omitempty"`
+	Detail            *string `json:"detail,omitempty"`
+	Actor             *string `json:"actor,omitempty"`
+	CreatedAt         string  `json:"createdAt"`
+}
+
+type CalibrationBucket struct {
+	MinConfidence    int     `json:"minConfidence"`
+	MaxConfidence    int     `json:"maxConfidence"`
+	Count            int     `json:"count"`
+	MeanConfidence   float64 `json:"meanConfidence"`
+	ObservedJokeRate float64 `json:"observedJokeRate"`
+}
+
+type CalibrationReport struct {
+	Mode                     string               `json:"mode"`
+	Labeled                  int                  `json:"labeled"`
+	Unanalyzed               int                  `json:"unanalyzed"`
+	Buckets                  []*CalibrationBucket `json:"buckets"`
+	BrierScore               float64              `json:"brierScore"`
+	ExpectedCalibrationError float64              `json:"expectedCalibrationError"`
+}
+
+type CrawlJob struct {
+	ID        string  `json:"id"`
+	Type      string  `json:"type"`
+	URL       string  `json:"url"`
+	Mode      string  `json:"mode"`
+	Status    string  `json:"status"`
+	Error     *string `json:"error,omitempty"`
+	CreatedAt string  `json:"createdAt"`
+	UpdatedAt string  `json:"updatedAt"`
 }
 
 type CrawledPage struct {
-	URL      string `json:"url"`
-	Title    string `json:"title"`
-	Content  string `json:"content"`
-	Datetime string `json:"datetime"`
+	URL          string            `json:"url"`
+	Title        string            `json:"title"`
+	Content      string            `json:"content"`
+	Datetime     string            `json:"datetime"`
+	PublishedAt  *string           `json:"publishedAt,omitempty"`
+	Author       *string           `json:"author,omitempty"`
+	Description  *string           `json:"description,omitempty"`
+	CanonicalURL *string           `json:"canonicalUrl,omitempty"`
+	FinalURL     *string           `json:"finalUrl,omitempty"`
+	DuplicateOf  *string           `json:"duplicateOf,omitempty"`
+	Fetch        *FetchDiagnostics `json:"fetch,omitempty"`
+	Screenshot   *string           `json:"screenshot,omitempty"`
+	FeedItem     *FeedItemMetadata `json:"feedItem,omitempty"`
+}
+
+type CreatedAPIToken struct {
+	Token    string    `json:"token"`
+	APIToken *APIToken `json:"apiToken"`
 }
 
 type FeedItem struct {
-	URL            string `json:"url"`
-	Title          string `json:"title"`
-	JokeConfidence int    `json:"jokeConfidence"`
+	URL                 string  `json:"url"`
+	Title               string  `json:"title"`
+	JokeConfidence      int     `json:"jokeConfidence"`
+	Language            *string `json:"language,omitempty"`
+	CacheSource         *string `json:"cacheSource,omitempty"`
+	PublishedAt         *string `json:"publishedAt,omitempty"`
+	PublishedAgeSeconds *int    `json:"publishedAgeSeconds,omitempty"`
+	Description         *string `json:"description,omitempty"`
+	ScreenshotURL       *string `json:"screenshotUrl,omitempty"`
+	WordCount           *int    `json:"wordCount,omitempty"`
+	ReadingMinutes      *int    `json:"readingMinutes,omitempty"`
+	AnalyzedAt          *string `json:"analyzedAt,omitempty"`
+	AnalyzedAgeSeconds  *int    `json:"analyzedAgeSeconds,omitempty"`
+	Stale               bool    `json:"stale"`
+	Source              *Source `json:"source,omitempty"`
+}
+
+type FeedItemMetadata struct {
+	Feed        string   `json:"feed"`
+	PublishedAt *string  `json:"publishedAt,omitempty"`
+	Author      *string  `json:"author,omitempty"`
+	Categories  []string `json:"categories"`
+}
+
+type FeedSource struct {
+	URL          string   `json:"url"`
+	Name         *string  `json:"name,omitempty"`
+	Enabled      bool     `json:"enabled"`
+	PollInterval *string  `json:"pollInterval,omitempty"`
+	Modes        []string `json:"modes"`
+	MaxArticles  *int     `json:"maxArticles,omitempty"`
+	HostDelay    *string  `json:"hostDelay,omitempty"`
+	CreatedAt    string   `json:"createdAt"`
+	UpdatedAt    string   `json:"updatedAt"`
+}
+
+type FeedUsage struct {
+	Feed             *string `json:"feed,omitempty"`
+	Mode             string  `json:"mode"`
+	Analyses         int     `json:"analyses"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	CostUsd          float64 `json:"costUsd"`
+}
+
+type FetchDiagnostics struct {
+	Host          string   `json:"host"`
+	StatusCode    int      `json:"statusCode"`
+	LatencyMillis int      `json:"latencyMillis"`
+	ContentType   *string  `json:"contentType,omitempty"`
+	BodyBytes     int      `json:"bodyBytes"`
+	Headers       []string `json:"headers"`
+}
+
+type JokeLabel struct {
+	URL       string  `json:"url"`
+	IsJoke    bool    `json:"isJoke"`
+	Labeler   *string `json:"labeler,omitempty"`
+	CreatedAt string  `json:"createdAt"`
+}
+
+type Mode struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Fingerprint int    `json:"fingerprint"`
+	Version     int    `json:"version"`
+	Model       string `json:"model"`
+}
+
+type Mutation struct {
+}
+
+type PageSelector struct {
+	Domain        *string `json:"domain,omitempty"`
+	Since         *string `json:"since,omitempty"`
+	Until         *string `json:"until,omitempty"`
+	Language      *string `json:"language,omitempty"`
+	HasNoAnalysis *bool   `json:"hasNoAnalysis,omitempty"`
+	MinLength     *int    `json:"minLength,omitempty"`
 }
 
 type Query struct {
 }
+
+type ReanalyzeSelection struct {
+	Matched int         `json:"matched"`
+	Jobs    []*CrawlJob `json:"jobs"`
+}
+
+type Source struct {
+	Kind string  `json:"kind"`
+	ID   *string `json:"id,omitempty"`
+}
+
+type UsageSummary struct {
+	Analyses         int     `json:"analyses"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	CostUsd          float64 `json:"costUsd"`
+}
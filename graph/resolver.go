@@ -1,17 +1,304 @@
 package graph
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/crawler/utils"
 	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+	"github.com/zeace/poisson/server"
 )
 
 // Resolver handles GraphQL queries and mutations
 type Resolver struct {
 	datastoreClient lib.DatastoreClient
+	jobQueue        *server.JobQueue
+	// feedCache serves the feed query, if set; otherwise every feed is generated on request.
+	feedCache *server.FeedCache
 }
 
-// NewResolver creates a new resolver instance
+// NewResolver creates a new resolver instance.
+// Mutations that queue jobs fail on a resolver created without a job queue.
 func NewResolver(datastoreClient lib.DatastoreClient) *Resolver {
+	return NewResolverWithJobQueue(datastoreClient, nil)
+}
+
+// NewResolverWithJobQueue creates a new resolver instance whose mutations queue jobs on jobQueue.
+func NewResolverWithJobQueue(datastoreClient lib.DatastoreClient, jobQueue *server.JobQueue) *Resolver {
 	return &Resolver{
 		datastoreClient: datastoreClient,
+		jobQueue:        jobQueue,
+	}
+}
+
+// WithFeedCache makes the resolver serve the feed query from cache, and returns it.
+func (r *Resolver) WithFeedCache(cache *server.FeedCache) *Resolver {
+	r.feedCache = cache
+	return r
+}
+
+// enqueueJob validates the arguments of a job mutation and queues the job,
+// using the request's idempotency key if one was sent.
+func (r *Resolver) enqueueJob(ctx context.Context, jobType models.JobType, url string, modeStr *string) (*CrawlJob, error) {
+	if err := server.RequireScope(ctx, models.ScopeWriteCrawl); err != nil {
+		return nil, err
+	}
+	if r.jobQueue == nil {
+		return nil, errors.New("jobs are not enabled on this server")
+	}
+
+	url, err := utils.Normalize(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %v", err)
+	}
+
+	modeName := "joke"
+	if modeStr != nil {
+		modeName = *modeStr
+	}
+	mode, err := analyzer.VerifyValidMode(modeName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mode: %v", err)
+	}
+
+	job, err := r.jobQueue.Enqueue(ctx, jobType, url, mode, models.JobPriorityInteractive, server.SubmissionSource(ctx), server.IdempotencyKeyFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue job: %v", err)
+	}
+
+	return toCrawlJob(job), nil
+}
+
+// toPageSelector converts a GraphQL page selector to the analyzer's.
+func toPageSelector(input PageSelector) (analyzer.PageSelector, error) {
+	var selector analyzer.PageSelector
+	var err error
+	if input.Domain != nil {
+		selector.Domain = *input.Domain
+	}
+	if input.Since != nil {
+		if selector.Since, err = analyzer.ParseSelectorDate(*input.Since); err != nil {
+			return selector, fmt.Errorf("since: %v", err)
+		}
+	}
+	if input.Until != nil {
+		if selector.Until, err = analyzer.ParseSelectorDate(*input.Until); err != nil {
+			return selector, fmt.Errorf("until: %v", err)
+		}
+	}
+	if input.Language != nil {
+		selector.Language = *input.Language
+	}
+	if input.HasNoAnalysis != nil {
+		selector.HasNoAnalysis = *input.HasNoAnalysis
+	}
+	if input.MinLength != nil {
+		selector.MinLength = *input.MinLength
+	}
+	return selector, selector.Normalize()
+}
+
+// toCrawlJob converts a stored job to its GraphQL representation.
+func toCrawlJob(job *models.CrawlJob) *CrawlJob {
+	return &CrawlJob{
+		ID:        job.ID,
+		Type:      string(job.Type),
+		URL:       job.URL,
+		Mode:      string(job.Mode),
+		Status:    string(job.Status),
+		Error:     optionalString(job.Error),
+		CreatedAt: job.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: job.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// toAPIToken converts a stored API token to its GraphQL representation, without its secret hash.
+func toAPIToken(token *models.APIToken) *APIToken {
+	scopes := make([]string, len(token.Scopes))
+	for i, scope := range token.Scopes {
+		scopes[i] = string(scope)
+	}
+	return &APIToken{
+		ID:           token.ID,
+		Name:         token.Name,
+		Scopes:       scopes,
+		CreatedAt:    token.CreatedAt.Format(time.RFC3339),
+		RevokedAt:    optionalTime(token.RevokedAt),
+		RequestCount: token.RequestCount,
+		LastUsedAt:   optionalTime(token.LastUsedAt),
+	}
+}
+
+// toFeedSource converts a registered feed to its GraphQL type.
+func toFeedSource(feed *models.FeedSource) *FeedSource {
+	result := &FeedSource{
+		URL:       feed.URL,
+		Name:      optionalString(feed.Name),
+		Enabled:   feed.Enabled,
+		CreatedAt: feed.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: feed.UpdatedAt.Format(time.RFC3339),
+	}
+	if feed.PollInterval > 0 {
+		interval := feed.PollInterval.String()
+		result.PollInterval = &interval
+	}
+	result.Modes = make([]string, len(feed.Modes))
+	for i, mode := range feed.Modes {
+		result.Modes[i] = string(mode)
+	}
+	if feed.MaxArticles > 0 {
+		result.MaxArticles = &feed.MaxArticles
+	}
+	if feed.HostDelay > 0 {
+		delay := feed.HostDelay.String()
+		result.HostDelay = &delay
+	}
+	return result
+}
+
+// toFeedUpdate converts the arguments of a feed mutation to the changes of a registered feed.
+// A nil modes leaves the modes unchanged, an empty one restores the crawler's default.
+func toFeedUpdate(
+	name *string, enabled *bool, pollInterval *string, modes []string, maxArticles *int, hostDelay *string,
+) (server.FeedUpdate, error) {
+	update := server.FeedUpdate{Name: name, Enabled: enabled, MaxArticles: maxArticles}
+	if pollInterval != nil {
+		interval, err := server.ParsePollInterval(*pollInterval)
+		if err != nil {
+			return server.FeedUpdate{}, err
+		}
+		update.PollInterval = &interval
+	}
+	if modes != nil {
+		feedModes, err := server.ParseFeedModes(modes)
+		if err != nil {
+			return server.FeedUpdate{}, err
+		}
+		update.Modes = &feedModes
+	}
+	if hostDelay != nil {
+		delay, err := server.ParseHostDelay(*hostDelay)
+		if err != nil {
+			return server.FeedUpdate{}, err
+		}
+		update.HostDelay = &delay
+	}
+	return update, nil
+}
+
+// toAuditEvent converts a stored audit event to its GraphQL type. The analysis fields are only
+// set for events about an analysis.
+func toAuditEvent(event *models.AuditEvent) *AuditEvent {
+	result := &AuditEvent{
+		URL:            event.URL,
+		Action:         string(event.Action),
+		Mode:           optionalString(string(event.Mode)),
+		Model:          optionalString(event.Model),
+		JokePercentage: event.JokePercentage,
+		Detail:         optionalString(event.Detail),
+		Actor:          optionalString(event.Actor),
+		CreatedAt:      event.CreatedAt.Format(time.RFC3339),
+	}
+	if event.PromptFingerprint != 0 {
+		result.PromptFingerprint = &event.PromptFingerprint
+		result.PromptVersion = &event.PromptVersion
+	}
+	return result
+}
+
+// optionalString converts an empty string to nil for nullable GraphQL fields.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// optionalInt returns nil for 0 and a pointer to n otherwise.
+func optionalInt(n int) *int {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+// toSource converts the source of a page to its GraphQL representation, nil if it is unknown.
+func toSource(source models.SourceRef) *Source {
+	if source.IsZero() {
+		return nil
+	}
+	return &Source{Kind: string(source.Kind), ID: optionalString(source.ID)}
+}
+
+// fetchDiagnostics converts the fetch diagnostics of a page to their GraphQL representation,
+// nil if they weren't recorded.
+func fetchDiagnostics(fetch models.FetchDiagnostics) *FetchDiagnostics {
+	if fetch.StatusCode == 0 {
+		return nil
+	}
+	headers := fetch.Headers
+	if headers == nil {
+		headers = []string{}
+	}
+	return &FetchDiagnostics{
+		Host:          fetch.Host,
+		StatusCode:    fetch.StatusCode,
+		LatencyMillis: int(fetch.LatencyMillis),
+		ContentType:   optionalString(fetch.ContentType),
+		BodyBytes:     fetch.BodyBytes,
+		Headers:       headers,
+	}
+}
+
+// feedItemMetadata converts the feed item metadata of a page to its GraphQL representation, nil
+// if the page wasn't fetched from a feed.
+func feedItemMetadata(item models.FeedItemMetadata) *FeedItemMetadata {
+	if item.IsZero() {
+		return nil
+	}
+	categories := item.Categories
+	if categories == nil {
+		categories = []string{}
+	}
+	return &FeedItemMetadata{
+		Feed:        item.Feed,
+		PublishedAt: optionalTime(item.PublishedAt),
+		Author:      optionalString(item.Author),
+		Categories:  categories,
+	}
+}
+
+// optionalTime formats t as RFC 3339, or returns nil if t is zero.
+func optionalTime(t time.Time) *string {
+	if t.IsZero() {
+		return nil
+	}
+	s := t.Format(time.RFC3339)
+	return &s
+}
+
+// parseAsOf parses the asOf argument of the feed query: an RFC 3339 time, or a date standing
+// for the end of that day in UTC.
+func parseAsOf(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid asOf: %q (expected YYYY-MM-DD or RFC3339)", s)
+	}
+	return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
+
+// optionalSeconds returns age in whole seconds, or nil if the time it was measured from is zero.
+func optionalSeconds(from time.Time, age time.Duration) *int {
+	if from.IsZero() {
+		return nil
 	}
+	seconds := int(age.Seconds())
+	return &seconds
 }
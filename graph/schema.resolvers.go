@@ -7,13 +7,162 @@ package graph
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
 	"github.com/zeace/poisson/server"
 )
 
+// CrawlURL is the resolver for the crawlUrl field.
+func (r *mutationResolver) CrawlURL(ctx context.Context, url string, mode *string) (*CrawlJob, error) {
+	return r.enqueueJob(ctx, models.JobTypeCrawl, url, mode)
+}
+
+// Reanalyze is the resolver for the reanalyze field.
+func (r *mutationResolver) Reanalyze(ctx context.Context, url string, mode *string) (*CrawlJob, error) {
+	return r.enqueueJob(ctx, models.JobTypeReanalyze, url, mode)
+}
+
+// ReanalyzePages is the resolver for the reanalyzePages field.
+func (r *mutationResolver) ReanalyzePages(ctx context.Context, selector PageSelector, mode *string) (*ReanalyzeSelection, error) {
+	if err := server.RequireScope(ctx, models.ScopeWriteCrawl); err != nil {
+		return nil, err
+	}
+	if r.jobQueue == nil {
+		return nil, errors.New("jobs are not enabled on this server")
+	}
+
+	pageSelector, err := toPageSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector: %v", err)
+	}
+	modeName := "joke"
+	if mode != nil {
+		modeName = *mode
+	}
+	analysisMode, err := analyzer.VerifyValidMode(modeName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mode: %v", err)
+	}
+
+	matched, jobs, err := r.jobQueue.EnqueueSelection(ctx, pageSelector, analysisMode, server.IdempotencyKeyFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue jobs: %v", err)
+	}
+
+	result := &ReanalyzeSelection{Matched: matched, Jobs: make([]*CrawlJob, len(jobs))}
+	for i, job := range jobs {
+		result.Jobs[i] = toCrawlJob(job)
+	}
+	return result, nil
+}
+
+// CreateAPIToken is the resolver for the createApiToken field.
+func (r *mutationResolver) CreateAPIToken(ctx context.Context, name string, scopes []string) (*CreatedAPIToken, error) {
+	if err := server.RequireScope(ctx, models.ScopeAdmin); err != nil {
+		return nil, err
+	}
+
+	parsedScopes, err := server.ParseAPIScopes(scopes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scopes: %v", err)
+	}
+
+	token, raw, err := server.CreateAPIToken(ctx, r.datastoreClient, name, parsedScopes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API token: %v", err)
+	}
+
+	return &CreatedAPIToken{Token: raw, APIToken: toAPIToken(token)}, nil
+}
+
+// RevokeAPIToken is the resolver for the revokeApiToken field.
+func (r *mutationResolver) RevokeAPIToken(ctx context.Context, id string) (*APIToken, error) {
+	if err := server.RequireScope(ctx, models.ScopeAdmin); err != nil {
+		return nil, err
+	}
+
+	token, err := server.RevokeAPIToken(ctx, r.datastoreClient, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke API token: %v", err)
+	}
+
+	return toAPIToken(token), nil
+}
+
+// LabelArticle is the resolver for the labelArticle field.
+func (r *mutationResolver) LabelArticle(ctx context.Context, url string, isJoke bool) (*JokeLabel, error) {
+	if err := server.RequireScope(ctx, models.ScopeWriteLabel); err != nil {
+		return nil, err
+	}
+
+	label, err := server.LabelArticle(ctx, r.datastoreClient, url, isJoke)
+	if err != nil {
+		return nil, fmt.Errorf("failed to label article: %v", err)
+	}
+
+	return &JokeLabel{
+		URL:       label.URL,
+		IsJoke:    label.IsJoke,
+		Labeler:   optionalString(label.Labeler),
+		CreatedAt: label.CreatedAt.Format(time.RFC3339),
+	}, nil
+}
+
+// AddFeed is the resolver for the addFeed field.
+func (r *mutationResolver) AddFeed(ctx context.Context, url string, name *string, pollInterval *string, modes []string, maxArticles *int, hostDelay *string) (*FeedSource, error) {
+	if err := server.RequireScope(ctx, models.ScopeWriteFeeds); err != nil {
+		return nil, err
+	}
+
+	settings, err := toFeedUpdate(name, nil, pollInterval, modes, maxArticles, hostDelay)
+	if err != nil {
+		return nil, err
+	}
+	feed, err := server.AddFeed(ctx, r.datastoreClient, url, settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add feed: %v", err)
+	}
+
+	return toFeedSource(feed), nil
+}
+
+// UpdateFeed is the resolver for the updateFeed field.
+func (r *mutationResolver) UpdateFeed(ctx context.Context, url string, name *string, enabled *bool, pollInterval *string, modes []string, maxArticles *int, hostDelay *string) (*FeedSource, error) {
+	if err := server.RequireScope(ctx, models.ScopeWriteFeeds); err != nil {
+		return nil, err
+	}
+
+	update, err := toFeedUpdate(name, enabled, pollInterval, modes, maxArticles, hostDelay)
+	if err != nil {
+		return nil, err
+	}
+	feed, err := server.UpdateFeed(ctx, r.datastoreClient, url, update)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update feed: %v", err)
+	}
+
+	return toFeedSource(feed), nil
+}
+
+// DeleteFeed is the resolver for the deleteFeed field.
+func (r *mutationResolver) DeleteFeed(ctx context.Context, url string) (*FeedSource, error) {
+	if err := server.RequireScope(ctx, models.ScopeWriteFeeds); err != nil {
+		return nil, err
+	}
+
+	feed, err := server.DeleteFeed(ctx, r.datastoreClient, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete feed: %v", err)
+	}
+
+	return toFeedSource(feed), nil
+}
+
 // Health is the resolver for the health field.
 func (r *queryResolver) Health(ctx context.Context) (string, error) {
 	return "ok", nil
@@ -21,6 +170,10 @@ func (r *queryResolver) Health(ctx context.Context) (string, error) {
 
 // Analysis is the resolver for the analysis field.
 func (r *queryResolver) Analysis(ctx context.Context, url string, modeStr *string) (*AnalysisResult, error) {
+	if err := server.RequireScope(ctx, models.ScopeReadFeed); err != nil {
+		return nil, err
+	}
+
 	if modeStr == nil {
 		var joke string = "joke"
 		modeStr = &joke
@@ -47,12 +200,23 @@ func (r *queryResolver) Analysis(ctx context.Context, url string, modeStr *strin
 		JokePercentage:    result.JokePercentage,
 		JokeReasoning:     result.JokeReasoning,
 		PromptFingerprint: result.PromptFingerprint,
+		PromptVersion:     max(result.PromptVersion, 1),
+		Model:             optionalString(result.Model),
+		Provider:          optionalString(result.Provider),
+		CacheSource:       optionalString(string(result.CacheSource)),
+		PromptTokens:      result.PromptTokens,
+		CompletionTokens:  result.CompletionTokens,
+		CostUsd:           result.CostUSD,
 	}, nil
 }
 
 // CrawledPage is the resolver for the crawledPage field.
 func (r *queryResolver) CrawledPage(ctx context.Context, url string) (*CrawledPage, error) {
-	page, found, err := r.datastoreClient.ReadCrawledPage(ctx, url)
+	if err := server.RequireScope(ctx, models.ScopeReadFeed); err != nil {
+		return nil, err
+	}
+
+	page, found, err := lib.ReadLinkedPage(ctx, r.datastoreClient, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read crawled page: %v", err)
 	}
@@ -66,11 +230,25 @@ func (r *queryResolver) CrawledPage(ctx context.Context, url string) (*CrawledPa
 		Title:    page.Title,
 		Content:  page.Content,
 		Datetime: page.DateTime.Format(time.RFC3339),
+
+		PublishedAt:  optionalTime(page.PublishedAt),
+		Author:       optionalString(page.Author),
+		Description:  optionalString(page.Description),
+		CanonicalURL: optionalString(page.CanonicalURL),
+		FinalURL:     optionalString(page.FinalURL),
+		DuplicateOf:  optionalString(page.DuplicateOf),
+		Fetch:        fetchDiagnostics(page.Fetch),
+		Screenshot:   optionalString(page.Screenshot),
+		FeedItem:     feedItemMetadata(page.FeedItem),
 	}, nil
 }
 
 // Feed is the resolver for the feed field.
-func (r *queryResolver) Feed(ctx context.Context, maxArticles int, oldestDate string, mode string) ([]*FeedItem, error) {
+func (r *queryResolver) Feed(ctx context.Context, maxArticles int, oldestDate string, mode string, language *string, source *string, excludeStale *bool, asOf *string) ([]*FeedItem, error) {
+	if err := server.RequireScope(ctx, models.ScopeReadFeed); err != nil {
+		return nil, err
+	}
+
 	// Parse oldestDate string to time.Time
 	parsedDate, err := time.Parse(time.DateOnly, oldestDate)
 	if err != nil {
@@ -83,8 +261,39 @@ func (r *queryResolver) Feed(ctx context.Context, maxArticles int, oldestDate st
 		return nil, fmt.Errorf("invalid mode: %v", err)
 	}
 
-	// Call GetFeed from server package
-	feedItems, err := server.GetFeed(ctx, r.datastoreClient, maxArticles, parsedDate, mode)
+	languageFilter := ""
+	if language != nil {
+		languageFilter = *language
+	}
+	sourceFilter := ""
+	if source != nil {
+		sourceFilter = *source
+	}
+
+	var asOfTime time.Time
+	if asOf != nil {
+		asOfTime, err = parseAsOf(*asOf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Call GetFeed from server package, through the feed cache if enabled
+	var feedItems []server.FeedItem
+	if r.feedCache != nil {
+		feedItems, err = r.feedCache.Get(ctx, server.FeedQuery{
+			MaxArticles:  maxArticles,
+			OldestDate:   parsedDate,
+			Mode:         mode,
+			Language:     languageFilter,
+			Source:       sourceFilter,
+			ExcludeStale: excludeStale != nil && *excludeStale,
+			AsOf:         asOfTime,
+		})
+	} else {
+		feedItems, err = server.GetFeed(ctx, r.datastoreClient, maxArticles, parsedDate, mode, languageFilter, sourceFilter,
+			excludeStale != nil && *excludeStale, asOfTime)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get feed: %v", err)
 	}
@@ -96,13 +305,248 @@ func (r *queryResolver) Feed(ctx context.Context, maxArticles int, oldestDate st
 			URL:            item.URL,
 			Title:          item.Title,
 			JokeConfidence: item.JokeConfidence,
+			Language:       optionalString(item.Language),
+			CacheSource:    optionalString(item.CacheSource),
+
+			PublishedAt:         optionalTime(item.PublishedAt),
+			PublishedAgeSeconds: optionalSeconds(item.PublishedAt, item.PublishedAge),
+			Description:         optionalString(item.Description),
+			ScreenshotURL:       optionalString(lib.GCSHTTPURL(item.Screenshot)),
+			WordCount:           optionalInt(item.WordCount),
+			ReadingMinutes:      optionalInt(item.ReadingMinutes),
+			AnalyzedAt:          optionalTime(item.AnalyzedAt),
+			AnalyzedAgeSeconds:  optionalSeconds(item.AnalyzedAt, item.AnalyzedAge),
+			Stale:               item.Stale,
+			Source:              toSource(item.Source),
 		}
 	}
 
 	return result, nil
 }
 
+// Usage is the resolver for the usage field.
+func (r *queryResolver) Usage(ctx context.Context, oldestDate string, mode string) (*UsageSummary, error) {
+	if err := server.RequireScope(ctx, models.ScopeReadUsage); err != nil {
+		return nil, err
+	}
+
+	parsedDate, err := time.Parse(time.DateOnly, oldestDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date format: %v (expected YYYY-MM-DD)", err)
+	}
+
+	totals, err := server.GetUsage(ctx, r.datastoreClient, parsedDate, mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %v", err)
+	}
+
+	return &UsageSummary{
+		Analyses:         totals.Analyses,
+		PromptTokens:     totals.PromptTokens,
+		CompletionTokens: totals.CompletionTokens,
+		CostUsd:          totals.CostUSD,
+	}, nil
+}
+
+// UsageByFeed is the resolver for the usageByFeed field.
+func (r *queryResolver) UsageByFeed(ctx context.Context, oldestDate string) ([]*FeedUsage, error) {
+	if err := server.RequireScope(ctx, models.ScopeReadUsage); err != nil {
+		return nil, err
+	}
+
+	parsedDate, err := time.Parse(time.DateOnly, oldestDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date format: %v (expected YYYY-MM-DD)", err)
+	}
+
+	usage, err := server.GetUsageByFeed(ctx, r.datastoreClient, parsedDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %v", err)
+	}
+
+	result := make([]*FeedUsage, len(usage))
+	for i, u := range usage {
+		result[i] = &FeedUsage{
+			Feed:             optionalString(u.Feed),
+			Mode:             string(u.Mode),
+			Analyses:         u.Totals.Analyses,
+			PromptTokens:     u.Totals.PromptTokens,
+			CompletionTokens: u.Totals.CompletionTokens,
+			CostUsd:          u.Totals.CostUSD,
+		}
+	}
+
+	return result, nil
+}
+
+// Job is the resolver for the job field.
+func (r *queryResolver) Job(ctx context.Context, id string) (*CrawlJob, error) {
+	if err := server.RequireScope(ctx, models.ScopeReadFeed); err != nil {
+		return nil, err
+	}
+
+	job, found, err := r.datastoreClient.ReadCrawlJob(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job: %v", err)
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	return toCrawlJob(job), nil
+}
+
+// APITokens is the resolver for the apiTokens field.
+func (r *queryResolver) APITokens(ctx context.Context) ([]*APIToken, error) {
+	if err := server.RequireScope(ctx, models.ScopeAdmin); err != nil {
+		return nil, err
+	}
+
+	tokens, err := r.datastoreClient.ListAPITokens(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API tokens: %v", err)
+	}
+
+	result := make([]*APIToken, len(tokens))
+	for i, token := range tokens {
+		result[i] = toAPIToken(token)
+	}
+
+	return result, nil
+}
+
+// Stats is the resolver for the stats field.
+func (r *queryResolver) Stats(ctx context.Context) (*APIStats, error) {
+	if err := server.RequireScope(ctx, models.ScopeReadUsage); err != nil {
+		return nil, err
+	}
+
+	stats, err := server.GetTokenStats(ctx, r.datastoreClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API token stats: %v", err)
+	}
+
+	result := &APIStats{TotalRequests: stats.Requests, Tokens: make([]*APITokenUsage, len(stats.Tokens))}
+	for i, token := range stats.Tokens {
+		result.Tokens[i] = &APITokenUsage{
+			ID:           token.ID,
+			Name:         token.Name,
+			RequestCount: token.RequestCount,
+			LastUsedAt:   optionalTime(token.LastUsedAt),
+			Revoked:      token.Revoked(),
+		}
+	}
+
+	return result, nil
+}
+
+// Modes is the resolver for the modes field. Like health, it needs no scope: clients
+// discover the modes before choosing what to query.
+func (r *queryResolver) Modes(ctx context.Context) ([]*Mode, error) {
+	modes := analyzer.ListModes()
+	result := make([]*Mode, len(modes))
+	for i, mode := range modes {
+		result[i] = &Mode{
+			Name:        string(mode.Name),
+			Description: mode.Description,
+			Fingerprint: mode.Fingerprint,
+			Version:     mode.Version,
+			Model:       mode.Model,
+		}
+	}
+
+	return result, nil
+}
+
+// Calibration is the resolver for the calibration field.
+func (r *queryResolver) Calibration(ctx context.Context, mode string, buckets *int) (*CalibrationReport, error) {
+	if err := server.RequireScope(ctx, models.ScopeReadUsage); err != nil {
+		return nil, err
+	}
+
+	analysisMode, err := analyzer.VerifyValidMode(mode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mode: %v", err)
+	}
+
+	bucketCount := analyzer.DefaultCalibrationBuckets
+	if buckets != nil {
+		if *buckets < 1 || *buckets > 100 {
+			return nil, fmt.Errorf("buckets must be between 1 and 100, got %d", *buckets)
+		}
+		bucketCount = *buckets
+	}
+
+	report, err := analyzer.Calibrate(ctx, r.datastoreClient, analysisMode, bucketCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build calibration report: %v", err)
+	}
+
+	result := &CalibrationReport{
+		Mode:                     string(report.Mode),
+		Labeled:                  report.Labeled,
+		Unanalyzed:               report.Unanalyzed,
+		Buckets:                  make([]*CalibrationBucket, len(report.Buckets)),
+		BrierScore:               report.BrierScore,
+		ExpectedCalibrationError: report.ExpectedCalibrationError,
+	}
+	for i, bucket := range report.Buckets {
+		result.Buckets[i] = &CalibrationBucket{
+			MinConfidence:    bucket.MinConfidence,
+			MaxConfidence:    bucket.MaxConfidence,
+			Count:            bucket.Count,
+			MeanConfidence:   bucket.MeanConfidence,
+			ObservedJokeRate: bucket.ObservedJokeRate,
+		}
+	}
+
+	return result, nil
+}
+
+// AuditTrail is the resolver for the auditTrail field.
+func (r *queryResolver) AuditTrail(ctx context.Context, url string) ([]*AuditEvent, error) {
+	if err := server.RequireScope(ctx, models.ScopeReadFeed); err != nil {
+		return nil, err
+	}
+
+	events, err := r.datastoreClient.ListAuditEvents(ctx, lib.NormalizeURL(url))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %v", err)
+	}
+
+	result := make([]*AuditEvent, len(events))
+	for i, event := range events {
+		result[i] = toAuditEvent(event)
+	}
+
+	return result, nil
+}
+
+// Feeds is the resolver for the feeds field.
+func (r *queryResolver) Feeds(ctx context.Context) ([]*FeedSource, error) {
+	if err := server.RequireScope(ctx, models.ScopeReadFeed); err != nil {
+		return nil, err
+	}
+
+	feeds, err := r.datastoreClient.ListFeedSources(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feeds: %v", err)
+	}
+
+	result := make([]*FeedSource, len(feeds))
+	for i, feed := range feeds {
+		result[i] = toFeedSource(feed)
+	}
+
+	return result, nil
+}
+
+// Mutation returns MutationResolver implementation.
+func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
+
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
+type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
@@ -0,0 +1,20 @@
+package lib
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/zeace/poisson/models"
+)
+
+// RecordAuditEvent appends event to the audit trail of its URL, normalizing the URL and setting
+// CreatedAt to the current time. Errors are logged rather than returned, since a missing audit
+// entry must not fail the pipeline action it describes.
+func RecordAuditEvent(ctx context.Context, datastoreClient DatastoreClient, event *models.AuditEvent) {
+	event.URL = NormalizeURL(event.URL)
+	event.CreatedAt = time.Now()
+	if err := datastoreClient.AppendAuditEvent(ctx, event); err != nil {
+		slog.WarnContext(ctx, "Error recording audit event", "action", event.Action, "error", err)
+	}
+}
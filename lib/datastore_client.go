@@ -6,11 +6,7 @@ import (
 	"strings"
 	"time"
 
-	"cloud.google.com/go/firestore"
 	"github.com/zeace/poisson/models"
-	"google.golang.org/api/option"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
 // DatastoreClient defines the interface for all Datastore operations needed by the crawler.
@@ -18,277 +14,659 @@ type DatastoreClient interface {
 	// CrawledPage operations
 	ReadCrawledPage(ctx context.Context, url string) (*models.CrawledPage, bool, error)
 	WriteCrawledPage(ctx context.Context, url, title, content string, datetime time.Time) (*models.CrawledPage, error)
+	// SaveCrawledPage stores page with all its persisted metadata. If page.DateTime is zero,
+	// it is set to the current time.
+	SaveCrawledPage(ctx context.Context, page *models.CrawledPage) error
 	GetCrawledPagesSince(ctx context.Context, oldestDate time.Time) ([]models.CrawledPage, error)
+	// FindCrawledPagesByContentHash returns the CrawledPages whose ContentHash is contentHash,
+	// oldest first.
+	FindCrawledPagesByContentHash(ctx context.Context, contentHash string) ([]models.CrawledPage, error)
+	// QueryCrawledPages returns the CrawledPages selected by query, ordered by DateTime and then by
+	// key (see UrlToCrawledPageKey).
+	QueryCrawledPages(ctx context.Context, query models.CrawledPageQuery) ([]models.CrawledPage, error)
 
 	// AnalysisResult operations
 	ReadAnalysisResult(ctx context.Context, url string, mode models.AnalysisMode) (*models.AnalysisResult, bool, error)
 	WriteAnalysisResult(ctx context.Context, url string, result *models.AnalysisResult) error
+	// ListAnalysisResults returns all AnalysisResults for mode, with URL set on each.
+	ListAnalysisResults(ctx context.Context, mode models.AnalysisMode) ([]*models.AnalysisResult, error)
+	DeleteAnalysisResult(ctx context.Context, url string, mode models.AnalysisMode) error
+	// ListAnalysisResultsSince returns the AnalysisResults for mode with AnalyzedAt after since,
+	// oldest first, with URL set on each.
+	ListAnalysisResultsSince(ctx context.Context, mode models.AnalysisMode, since time.Time) ([]*models.AnalysisResult, error)
+	// FindAnalysisResultsByContentHash returns the AnalysisResults for mode whose ContentHash is
+	// contentHash, with URL set on each.
+	FindAnalysisResultsByContentHash(ctx context.Context, contentHash string, mode models.AnalysisMode) ([]*models.AnalysisResult, error)
+
+	// PageEmbedding operations
+	ReadPageEmbedding(ctx context.Context, url string) (*models.PageEmbedding, bool, error)
+	WritePageEmbedding(ctx context.Context, embedding *models.PageEmbedding) error
+	// ListPageEmbeddingsSince returns all PageEmbeddings with CreatedAt >= since.
+	ListPageEmbeddingsSince(ctx context.Context, since time.Time) ([]*models.PageEmbedding, error)
+
+	// PendingAnalysis operations
+	WritePendingAnalysis(ctx context.Context, pending *models.PendingAnalysis) error
+	// QueuePendingAnalysis writes pending unless the PendingAnalysis for the same URL and mode was
+	// already submitted in a batch (has a BatchID), and reports whether it was written.
+	QueuePendingAnalysis(ctx context.Context, pending *models.PendingAnalysis) (bool, error)
+	// ListPendingAnalyses returns all PendingAnalyses, oldest first.
+	ListPendingAnalyses(ctx context.Context) ([]*models.PendingAnalysis, error)
+	DeletePendingAnalysis(ctx context.Context, url string, mode models.AnalysisMode) error
+
+	// Lease operations
+	// AcquireLease takes or renews the named lease for holder until now+ttl.
+	// It returns false if another holder has an unexpired lease.
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	// ReleaseLease drops the named lease if it is held by holder.
+	ReleaseLease(ctx context.Context, name, holder string) error
+
+	// CrawlJob operations
+	ReadCrawlJob(ctx context.Context, id string) (*models.CrawlJob, bool, error)
+	WriteCrawlJob(ctx context.Context, job *models.CrawlJob) error
+	// ClaimIdempotencyKey stores record unless an unexpired record with the same key exists.
+	// It returns the stored record and true, or the existing record and false.
+	ClaimIdempotencyKey(ctx context.Context, record *models.IdempotencyKey) (*models.IdempotencyKey, bool, error)
+	// ReleaseIdempotencyKey deletes the record of key if it still maps to jobID.
+	ReleaseIdempotencyKey(ctx context.Context, key, jobID string) error
+
+	// APIToken operations
+	ReadAPIToken(ctx context.Context, id string) (*models.APIToken, bool, error)
+	WriteAPIToken(ctx context.Context, token *models.APIToken) error
+	// ListAPITokens returns all APITokens, oldest first.
+	ListAPITokens(ctx context.Context) ([]*models.APIToken, error)
+	// RecordAPITokenRequest increments the request count of the token with id and sets its
+	// LastUsedAt to at.
+	RecordAPITokenRequest(ctx context.Context, id string, at time.Time) error
+
+	// JokeLabel operations
+	// WriteJokeLabel stores label, replacing any label for the same URL.
+	WriteJokeLabel(ctx context.Context, label *models.JokeLabel) error
+	// ListJokeLabels returns all JokeLabels, oldest first.
+	ListJokeLabels(ctx context.Context) ([]*models.JokeLabel, error)
+
+	// AuditEvent operations
+	// AppendAuditEvent stores event as a new entry of the audit trail of event.URL.
+	AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error
+	// ListAuditEvents returns the audit trail of url, oldest first.
+	ListAuditEvents(ctx context.Context, url string) ([]*models.AuditEvent, error)
+
+	// DomainBoilerplate operations
+	ReadDomainBoilerplate(ctx context.Context, host string) (*models.DomainBoilerplate, bool, error)
+	// WriteDomainBoilerplate stores profile, replacing any profile for the same host.
+	WriteDomainBoilerplate(ctx context.Context, profile *models.DomainBoilerplate) error
+	// UpdateDomainBoilerplate calls update with the profile of host, or an empty profile if there
+	// is none, and stores it, in one transaction; update may be called again if the profile was
+	// changed meanwhile. It returns the profile as it was before the update.
+	UpdateDomainBoilerplate(ctx context.Context, host string, update func(profile *models.DomainBoilerplate)) (*models.DomainBoilerplate, error)
+
+	// FetchError operations
+	ReadFetchError(ctx context.Context, url string) (*models.FetchError, bool, error)
+	// WriteFetchError stores failure, replacing any FetchError for the same URL.
+	WriteFetchError(ctx context.Context, failure *models.FetchError) error
+	DeleteFetchError(ctx context.Context, url string) error
+
+	// FeedState operations
+	ReadFeedState(ctx context.Context, url string) (*models.FeedState, bool, error)
+	// WriteFeedState stores state, replacing any FeedState for the same URL.
+	WriteFeedState(ctx context.Context, state *models.FeedState) error
+
+	// FeedSource operations. FeedSources are keyed by normalized URL (see NormalizeURL), so that
+	// a feed is registered once whatever the protocol or query of the URL it is given by.
+	// AddFeedSource stores feed unless a FeedSource with the same URL exists.
+	// It returns false if the feed was already registered.
+	AddFeedSource(ctx context.Context, feed *models.FeedSource) (bool, error)
+	ReadFeedSource(ctx context.Context, url string) (*models.FeedSource, bool, error)
+	// ListFeedSources returns all FeedSources, by URL.
+	ListFeedSources(ctx context.Context) ([]*models.FeedSource, error)
+	// UpdateFeedSource calls update with the FeedSource of url and stores it, in one transaction;
+	// update may be called again if the feed was changed meanwhile. It returns the updated feed,
+	// or false if the feed is not registered.
+	UpdateFeedSource(ctx context.Context, url string, update func(feed *models.FeedSource)) (*models.FeedSource, bool, error)
+	DeleteFeedSource(ctx context.Context, url string) error
+
+	// LlmCall operations
+	AppendLlmCall(ctx context.Context, call *models.LlmCall) error
+	// ListLlmCalls returns the LlmCalls made while analyzing url, oldest first.
+	ListLlmCalls(ctx context.Context, url string) ([]*models.LlmCall, error)
+	// DeleteLlmCallsBefore deletes the LlmCalls made before before and returns how many were deleted.
+	DeleteLlmCallsBefore(ctx context.Context, before time.Time) (int, error)
+
+	// LlmBatch operations
+	// WriteLlmBatch stores batch, replacing any batch with the same ID.
+	WriteLlmBatch(ctx context.Context, batch *models.LlmBatch) error
+	// ListLlmBatches returns all LlmBatches, oldest first.
+	ListLlmBatches(ctx context.Context) ([]*models.LlmBatch, error)
+
+	// OutboxMessage operations
+	// CreateOutboxMessage stores message unless a message with the same ID exists.
+	// It returns whether message was stored.
+	CreateOutboxMessage(ctx context.Context, message *models.OutboxMessage) (bool, error)
+	// WriteOutboxMessage stores message, replacing the message with the same ID.
+	WriteOutboxMessage(ctx context.Context, message *models.OutboxMessage) error
+	// ListDueOutboxMessages returns the pending OutboxMessages whose NextAttemptAt is not after
+	// before, earliest due first.
+	ListDueOutboxMessages(ctx context.Context, before time.Time) ([]*models.OutboxMessage, error)
+
+	// EventsCursor operations
+	ReadEventsCursor(ctx context.Context, mode models.AnalysisMode) (*models.EventsCursor, bool, error)
+	// WriteEventsCursor stores cursor, replacing the EventsCursor of the same mode.
+	WriteEventsCursor(ctx context.Context, cursor *models.EventsCursor) error
 
 	// Close closes the underlying datastore client
 	Close() error
 }
 
-// datastoreClientAdapter wraps a *firestore.Client to implement DatastoreClient
-type datastoreClientAdapter struct {
-	client *firestore.Client
+// CreateDatastoreClient creates the DatastoreClient of the binaries. If POISSON_LOCAL_STORE is
+// set, it is a LocalDatastoreClient kept in that file (see NewLocalDatastoreClient); binaries
+// built with the nocloud tag default to poisson-store.json and can't use Firestore. Otherwise it
+// is a Firestore client for the project in GOOGLE_CLOUD_PROJECT (see createCloudDatastoreClient).
+func CreateDatastoreClient(ctx context.Context) (DatastoreClient, error) {
+	path := os.Getenv("POISSON_LOCAL_STORE")
+	if path == "" {
+		path = defaultLocalStore
+	}
+	if path != "" {
+		return NewLocalDatastoreClient(path)
+	}
+	return createCloudDatastoreClient(ctx)
 }
 
-// CreateDatastoreClient creates a new DatastoreClient with embedded credentials or default credentials.
-// It uses the project ID from GOOGLE_CLOUD_PROJECT environment variable, or defaults to "poisson-berkan".
-func CreateDatastoreClient(ctx context.Context) (DatastoreClient, error) {
-	// Get project ID from environment or use default
-	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
-	if projectID == "" {
-		projectID = "poisson-berkan"
-	}
-
-	// Try to use embedded credentials first
-	googleKeyJSON := GoogleKeyJSON()
-	var client *firestore.Client
-	var err error
-	if len(googleKeyJSON) > 0 {
-		client, err = firestore.NewClient(ctx, projectID, option.WithCredentialsJSON(googleKeyJSON))
-	} else {
-		// Fall back to default credentials (e.g., from environment)
-		client, err = firestore.NewClient(ctx, projectID)
-	}
-	if err != nil {
-		return nil, err
+// normalizeURL normalizes a URL by removing the protocol (http:// or https://) and query parameters.
+func normalizeURL(url string) string {
+	// Remove http:// or https:// from the front
+	normalized := strings.TrimPrefix(url, "https://")
+	normalized = strings.TrimPrefix(normalized, "http://")
+
+	// Remove query parameters (everything after ?)
+	if idx := strings.Index(normalized, "?"); idx != -1 {
+		normalized = normalized[:idx]
 	}
 
-	return NewDatastoreClient(client), nil
+	return normalized
 }
 
-// NewDatastoreClient creates a new DatastoreClient from a firestore.Client
-func NewDatastoreClient(client *firestore.Client) DatastoreClient {
-	return &datastoreClientAdapter{client: client}
+// UrlToCrawledPageKey converts a URL to a key suitable for use as a CrawledPage document ID.
+// It removes query parameters, trailing slashes, and converts '/' to '_'.
+func UrlToCrawledPageKey(url string) string {
+	key := url
+
+	// Remove query parameters (everything after ?)
+	if idx := strings.Index(key, "?"); idx != -1 {
+		key = key[:idx]
+	}
+
+	// Remove trailing slashes
+	key = strings.TrimRight(key, "/")
+
+	// Convert '/' to '_'
+	key = strings.ReplaceAll(key, "/", "_")
+
+	return key
 }
 
-func (d *datastoreClientAdapter) ReadCrawledPage(ctx context.Context, url string) (*models.CrawledPage, bool, error) {
+// UrlToAnalysisKey converts a URL to a key suitable for use as an AnalysisResult document ID.
+// It removes query parameters, trailing slashes, and converts '/' to '_'.
+// This is used as part of the key name along with the mode (format: "key:mode").
+func UrlToAnalysisKey(url string, mode models.AnalysisMode) string {
+	// Normalize URL (remove protocol)
 	key := UrlToCrawledPageKey(url)
-	docRef := d.client.Collection(models.CrawledPageKind).Doc(key)
-	doc, err := docRef.Get(ctx)
-	if err != nil {
-		if status.Code(err) == codes.NotFound {
-			return nil, false, nil
-		}
+	key += ":" + string(mode)
+
+	return key
+}
+
+// leaseKey converts a lease name to a key suitable for use as a Lease document ID.
+func leaseKey(name string) string {
+	return strings.ReplaceAll(name, "/", "_")
+}
+
+// idempotencyKey converts a client-supplied idempotency key to a key suitable for use as a document ID.
+func idempotencyKey(key string) string {
+	return strings.ReplaceAll(key, "/", "_")
+}
+
+// analysisKeyToURL recovers a URL from an AnalysisResult key built by UrlToAnalysisKey.
+// Underscores that were part of the URL are turned into slashes, so the URL may not match
+// the original, but converting it back with UrlToAnalysisKey yields the same key.
+func analysisKeyToURL(key string, mode models.AnalysisMode) string {
+	key = strings.TrimSuffix(key, ":"+string(mode))
+	return strings.ReplaceAll(key, "_", "/")
+}
+
+// MockDatastoreClient is a mock implementation of DatastoreClient for testing, keeping its
+// entities in the exported maps of its memory store. Its error fields, when set, are returned
+// by the operations on the matching entities instead of running them.
+// It is safe for concurrent use through its methods.
+type MockDatastoreClient struct {
+	*memoryStore
+	GetError            error
+	CreateError         error
+	GetAnalysisError    error
+	CreateAnalysisError error
+	LeaseError          error
+	JobError            error
+	PendingError        error
+	EmbeddingError      error
+	APITokenError       error
+	JokeLabelError      error
+	AuditEventError     error
+	BoilerplateError    error
+	FetchErrorError     error
+	FeedStateError      error
+	FeedSourceError     error
+	LlmCallError        error
+	LlmBatchError       error
+	OutboxError         error
+}
+
+// NewMockDatastoreClient creates a new MockDatastoreClient
+func NewMockDatastoreClient() *MockDatastoreClient {
+	return &MockDatastoreClient{memoryStore: newMemoryStore()}
+}
+
+// injected returns the error set in *field, read under the lock of the store.
+func (m *MockDatastoreClient) injected(field *error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *field
+}
+
+func (m *MockDatastoreClient) ReadCrawledPage(ctx context.Context, url string) (*models.CrawledPage, bool, error) {
+	if err := m.injected(&m.GetError); err != nil {
 		return nil, false, err
 	}
+	return m.memoryStore.ReadCrawledPage(ctx, url)
+}
 
-	var page models.CrawledPage
-	if err := doc.DataTo(&page); err != nil {
+func (m *MockDatastoreClient) WriteCrawledPage(ctx context.Context, url, title, content string, datetime time.Time) (*models.CrawledPage, error) {
+	if err := m.injected(&m.CreateError); err != nil {
+		return nil, err
+	}
+	return m.memoryStore.WriteCrawledPage(ctx, url, title, content, datetime)
+}
+
+func (m *MockDatastoreClient) SaveCrawledPage(ctx context.Context, page *models.CrawledPage) error {
+	if err := m.injected(&m.CreateError); err != nil {
+		return err
+	}
+	return m.memoryStore.SaveCrawledPage(ctx, page)
+}
+
+func (m *MockDatastoreClient) FindCrawledPagesByContentHash(ctx context.Context, contentHash string) ([]models.CrawledPage, error) {
+	if err := m.injected(&m.GetError); err != nil {
+		return nil, err
+	}
+	return m.memoryStore.FindCrawledPagesByContentHash(ctx, contentHash)
+}
+
+func (m *MockDatastoreClient) QueryCrawledPages(ctx context.Context, query models.CrawledPageQuery) ([]models.CrawledPage, error) {
+	if err := m.injected(&m.GetError); err != nil {
+		return nil, err
+	}
+	return m.memoryStore.QueryCrawledPages(ctx, query)
+}
+
+func (m *MockDatastoreClient) ReadAnalysisResult(ctx context.Context, url string, mode models.AnalysisMode) (*models.AnalysisResult, bool, error) {
+	if err := m.injected(&m.GetAnalysisError); err != nil {
 		return nil, false, err
 	}
-	page.URL = url // Ensure URL is set from original URL (not the key)
+	return m.memoryStore.ReadAnalysisResult(ctx, url, mode)
+}
 
-	return &page, true, nil
+func (m *MockDatastoreClient) WriteAnalysisResult(ctx context.Context, url string, result *models.AnalysisResult) error {
+	if err := m.injected(&m.CreateAnalysisError); err != nil {
+		return err
+	}
+	return m.memoryStore.WriteAnalysisResult(ctx, url, result)
 }
 
-func (d *datastoreClientAdapter) WriteCrawledPage(ctx context.Context, url, title, content string, datetime time.Time) (*models.CrawledPage, error) {
-	if datetime.IsZero() {
-		datetime = time.Now()
+func (m *MockDatastoreClient) ListAnalysisResults(ctx context.Context, mode models.AnalysisMode) ([]*models.AnalysisResult, error) {
+	if err := m.injected(&m.GetAnalysisError); err != nil {
+		return nil, err
 	}
+	return m.memoryStore.ListAnalysisResults(ctx, mode)
+}
 
-	page := &models.CrawledPage{
-		URL:      url,
-		Title:    title,
-		Content:  content,
-		DateTime: datetime,
+func (m *MockDatastoreClient) ListAnalysisResultsSince(
+	ctx context.Context,
+	mode models.AnalysisMode,
+	since time.Time,
+) ([]*models.AnalysisResult, error) {
+	if err := m.injected(&m.GetAnalysisError); err != nil {
+		return nil, err
 	}
+	return m.memoryStore.ListAnalysisResultsSince(ctx, mode, since)
+}
 
-	key := UrlToCrawledPageKey(url)
-	docRef := d.client.Collection(models.CrawledPageKind).Doc(key)
-	_, err := docRef.Set(ctx, page)
-	if err != nil {
+func (m *MockDatastoreClient) FindAnalysisResultsByContentHash(
+	ctx context.Context,
+	contentHash string,
+	mode models.AnalysisMode,
+) ([]*models.AnalysisResult, error) {
+	if err := m.injected(&m.GetAnalysisError); err != nil {
 		return nil, err
 	}
+	return m.memoryStore.FindAnalysisResultsByContentHash(ctx, contentHash, mode)
+}
+
+func (m *MockDatastoreClient) DeleteAnalysisResult(ctx context.Context, url string, mode models.AnalysisMode) error {
+	if err := m.injected(&m.CreateAnalysisError); err != nil {
+		return err
+	}
+	return m.memoryStore.DeleteAnalysisResult(ctx, url, mode)
+}
 
-	return page, nil
+func (m *MockDatastoreClient) ReadPageEmbedding(ctx context.Context, url string) (*models.PageEmbedding, bool, error) {
+	if err := m.injected(&m.EmbeddingError); err != nil {
+		return nil, false, err
+	}
+	return m.memoryStore.ReadPageEmbedding(ctx, url)
 }
 
-// GetCrawledPagesSince returns all CrawledPages with DateTime >= oldestDate.
-func (d *datastoreClientAdapter) GetCrawledPagesSince(ctx context.Context, oldestDate time.Time) ([]models.CrawledPage, error) {
-	query := d.client.Collection(models.CrawledPageKind).
-		Where("DateTime", ">=", oldestDate).OrderBy("DateTime", firestore.Desc)
+func (m *MockDatastoreClient) WritePageEmbedding(ctx context.Context, embedding *models.PageEmbedding) error {
+	if err := m.injected(&m.EmbeddingError); err != nil {
+		return err
+	}
+	return m.memoryStore.WritePageEmbedding(ctx, embedding)
+}
 
-	docs, err := query.Documents(ctx).GetAll()
-	if err != nil {
+func (m *MockDatastoreClient) ListPageEmbeddingsSince(ctx context.Context, since time.Time) ([]*models.PageEmbedding, error) {
+	if err := m.injected(&m.EmbeddingError); err != nil {
 		return nil, err
 	}
+	return m.memoryStore.ListPageEmbeddingsSince(ctx, since)
+}
 
-	var pages []models.CrawledPage
-	for _, doc := range docs {
-		var page models.CrawledPage
-		if err := doc.DataTo(&page); err != nil {
-			continue // Skip invalid documents
-		}
-		// URL is already set from document data when we wrote it
-		pages = append(pages, page)
+func (m *MockDatastoreClient) WritePendingAnalysis(ctx context.Context, pending *models.PendingAnalysis) error {
+	if err := m.injected(&m.PendingError); err != nil {
+		return err
 	}
+	return m.memoryStore.WritePendingAnalysis(ctx, pending)
+}
 
-	return pages, nil
+func (m *MockDatastoreClient) QueuePendingAnalysis(ctx context.Context, pending *models.PendingAnalysis) (bool, error) {
+	if err := m.injected(&m.PendingError); err != nil {
+		return false, err
+	}
+	return m.memoryStore.QueuePendingAnalysis(ctx, pending)
 }
 
-func (d *datastoreClientAdapter) ReadAnalysisResult(
+func (m *MockDatastoreClient) ListPendingAnalyses(ctx context.Context) ([]*models.PendingAnalysis, error) {
+	if err := m.injected(&m.PendingError); err != nil {
+		return nil, err
+	}
+	return m.memoryStore.ListPendingAnalyses(ctx)
+}
+
+func (m *MockDatastoreClient) DeletePendingAnalysis(ctx context.Context, url string, mode models.AnalysisMode) error {
+	if err := m.injected(&m.PendingError); err != nil {
+		return err
+	}
+	return m.memoryStore.DeletePendingAnalysis(ctx, url, mode)
+}
+
+func (m *MockDatastoreClient) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	if err := m.injected(&m.LeaseError); err != nil {
+		return false, err
+	}
+	return m.memoryStore.AcquireLease(ctx, name, holder, ttl)
+}
+
+func (m *MockDatastoreClient) ReleaseLease(ctx context.Context, name, holder string) error {
+	if err := m.injected(&m.LeaseError); err != nil {
+		return err
+	}
+	return m.memoryStore.ReleaseLease(ctx, name, holder)
+}
+
+func (m *MockDatastoreClient) ReadCrawlJob(ctx context.Context, id string) (*models.CrawlJob, bool, error) {
+	if err := m.injected(&m.JobError); err != nil {
+		return nil, false, err
+	}
+	return m.memoryStore.ReadCrawlJob(ctx, id)
+}
+
+func (m *MockDatastoreClient) WriteCrawlJob(ctx context.Context, job *models.CrawlJob) error {
+	if err := m.injected(&m.JobError); err != nil {
+		return err
+	}
+	return m.memoryStore.WriteCrawlJob(ctx, job)
+}
+
+func (m *MockDatastoreClient) ClaimIdempotencyKey(
 	ctx context.Context,
-	url string,
-	mode models.AnalysisMode,
-) (*models.AnalysisResult, bool, error) {
-	// Convert URL to analysis key
-	keyName := UrlToAnalysisKey(url, mode)
-
-	docRef := d.client.Collection(models.AnalysisResultKind).Doc(keyName)
-	doc, err := docRef.Get(ctx)
-	if err != nil {
-		if status.Code(err) == codes.NotFound {
-			return nil, false, nil
-		}
+	record *models.IdempotencyKey,
+) (*models.IdempotencyKey, bool, error) {
+	if err := m.injected(&m.JobError); err != nil {
 		return nil, false, err
 	}
+	return m.memoryStore.ClaimIdempotencyKey(ctx, record)
+}
+
+func (m *MockDatastoreClient) ReleaseIdempotencyKey(ctx context.Context, key, jobID string) error {
+	if err := m.injected(&m.JobError); err != nil {
+		return err
+	}
+	return m.memoryStore.ReleaseIdempotencyKey(ctx, key, jobID)
+}
 
-	var result models.AnalysisResult
-	if err := doc.DataTo(&result); err != nil {
+func (m *MockDatastoreClient) ReadAPIToken(ctx context.Context, id string) (*models.APIToken, bool, error) {
+	if err := m.injected(&m.APITokenError); err != nil {
 		return nil, false, err
 	}
+	return m.memoryStore.ReadAPIToken(ctx, id)
+}
 
-	return &result, true, nil
+func (m *MockDatastoreClient) WriteAPIToken(ctx context.Context, token *models.APIToken) error {
+	if err := m.injected(&m.APITokenError); err != nil {
+		return err
+	}
+	return m.memoryStore.WriteAPIToken(ctx, token)
 }
 
-func (d *datastoreClientAdapter) WriteAnalysisResult(ctx context.Context, url string, result *models.AnalysisResult) error {
-	// Convert URL to analysis key
-	keyName := UrlToAnalysisKey(url, result.Mode)
+func (m *MockDatastoreClient) ListAPITokens(ctx context.Context) ([]*models.APIToken, error) {
+	if err := m.injected(&m.APITokenError); err != nil {
+		return nil, err
+	}
+	return m.memoryStore.ListAPITokens(ctx)
+}
 
-	docRef := d.client.Collection(models.AnalysisResultKind).Doc(keyName)
-	_, err := docRef.Set(ctx, result)
-	if err != nil {
+func (m *MockDatastoreClient) RecordAPITokenRequest(ctx context.Context, id string, at time.Time) error {
+	if err := m.injected(&m.APITokenError); err != nil {
 		return err
 	}
+	return m.memoryStore.RecordAPITokenRequest(ctx, id, at)
+}
 
+func (m *MockDatastoreClient) Close() error {
 	return nil
 }
 
-func (d *datastoreClientAdapter) Close() error {
-	return d.client.Close()
+func (m *MockDatastoreClient) WriteJokeLabel(ctx context.Context, label *models.JokeLabel) error {
+	if err := m.injected(&m.JokeLabelError); err != nil {
+		return err
+	}
+	return m.memoryStore.WriteJokeLabel(ctx, label)
 }
 
-// normalizeURL normalizes a URL by removing the protocol (http:// or https://) and query parameters.
-func normalizeURL(url string) string {
-	// Remove http:// or https:// from the front
-	normalized := strings.TrimPrefix(url, "https://")
-	normalized = strings.TrimPrefix(normalized, "http://")
+func (m *MockDatastoreClient) ListJokeLabels(ctx context.Context) ([]*models.JokeLabel, error) {
+	if err := m.injected(&m.JokeLabelError); err != nil {
+		return nil, err
+	}
+	return m.memoryStore.ListJokeLabels(ctx)
+}
 
-	// Remove query parameters (everything after ?)
-	if idx := strings.Index(normalized, "?"); idx != -1 {
-		normalized = normalized[:idx]
+func (m *MockDatastoreClient) AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	if err := m.injected(&m.AuditEventError); err != nil {
+		return err
 	}
+	return m.memoryStore.AppendAuditEvent(ctx, event)
+}
 
-	return normalized
+func (m *MockDatastoreClient) ListAuditEvents(ctx context.Context, url string) ([]*models.AuditEvent, error) {
+	if err := m.injected(&m.AuditEventError); err != nil {
+		return nil, err
+	}
+	return m.memoryStore.ListAuditEvents(ctx, url)
 }
 
-// UrlToCrawledPageKey converts a URL to a key suitable for use as a CrawledPage document ID.
-// It removes query parameters, trailing slashes, and converts '/' to '_'.
-func UrlToCrawledPageKey(url string) string {
-	key := url
+func (m *MockDatastoreClient) ReadDomainBoilerplate(ctx context.Context, host string) (*models.DomainBoilerplate, bool, error) {
+	if err := m.injected(&m.BoilerplateError); err != nil {
+		return nil, false, err
+	}
+	return m.memoryStore.ReadDomainBoilerplate(ctx, host)
+}
 
-	// Remove query parameters (everything after ?)
-	if idx := strings.Index(key, "?"); idx != -1 {
-		key = key[:idx]
+func (m *MockDatastoreClient) WriteDomainBoilerplate(ctx context.Context, profile *models.DomainBoilerplate) error {
+	if err := m.injected(&m.BoilerplateError); err != nil {
+		return err
 	}
+	return m.memoryStore.WriteDomainBoilerplate(ctx, profile)
+}
 
-	// Remove trailing slashes
-	key = strings.TrimRight(key, "/")
+func (m *MockDatastoreClient) UpdateDomainBoilerplate(ctx context.Context, host string, update func(profile *models.DomainBoilerplate)) (*models.DomainBoilerplate, error) {
+	if err := m.injected(&m.BoilerplateError); err != nil {
+		return nil, err
+	}
+	return m.memoryStore.UpdateDomainBoilerplate(ctx, host, update)
+}
 
-	// Convert '/' to '_'
-	key = strings.ReplaceAll(key, "/", "_")
+func (m *MockDatastoreClient) ReadFetchError(ctx context.Context, url string) (*models.FetchError, bool, error) {
+	if err := m.injected(&m.FetchErrorError); err != nil {
+		return nil, false, err
+	}
+	return m.memoryStore.ReadFetchError(ctx, url)
+}
 
-	return key
+func (m *MockDatastoreClient) WriteFetchError(ctx context.Context, failure *models.FetchError) error {
+	if err := m.injected(&m.FetchErrorError); err != nil {
+		return err
+	}
+	return m.memoryStore.WriteFetchError(ctx, failure)
 }
 
-// UrlToAnalysisKey converts a URL to a key suitable for use as an AnalysisResult document ID.
-// It removes query parameters, trailing slashes, and converts '/' to '_'.
-// This is used as part of the key name along with the mode (format: "key:mode").
-func UrlToAnalysisKey(url string, mode models.AnalysisMode) string {
-	// Normalize URL (remove protocol)
-	key := UrlToCrawledPageKey(url)
-	key += ":" + string(mode)
+func (m *MockDatastoreClient) DeleteFetchError(ctx context.Context, url string) error {
+	if err := m.injected(&m.FetchErrorError); err != nil {
+		return err
+	}
+	return m.memoryStore.DeleteFetchError(ctx, url)
+}
 
-	return key
+func (m *MockDatastoreClient) ReadFeedState(ctx context.Context, url string) (*models.FeedState, bool, error) {
+	if err := m.injected(&m.FeedStateError); err != nil {
+		return nil, false, err
+	}
+	return m.memoryStore.ReadFeedState(ctx, url)
 }
 
-// MockDatastoreClient is a mock implementation of DatastoreClient for testing
-type MockDatastoreClient struct {
-	Pages               map[string]*models.CrawledPage
-	AnalysisResults     map[string]*models.AnalysisResult
-	GetError            error
-	CreateError         error
-	GetAnalysisError    error
-	CreateAnalysisError error
+func (m *MockDatastoreClient) WriteFeedState(ctx context.Context, state *models.FeedState) error {
+	if err := m.injected(&m.FeedStateError); err != nil {
+		return err
+	}
+	return m.memoryStore.WriteFeedState(ctx, state)
 }
 
-// NewMockDatastoreClient creates a new MockDatastoreClient
-func NewMockDatastoreClient() *MockDatastoreClient {
-	return &MockDatastoreClient{
-		Pages:           make(map[string]*models.CrawledPage),
-		AnalysisResults: make(map[string]*models.AnalysisResult),
+func (m *MockDatastoreClient) AddFeedSource(ctx context.Context, feed *models.FeedSource) (bool, error) {
+	if err := m.injected(&m.FeedSourceError); err != nil {
+		return false, err
 	}
+	return m.memoryStore.AddFeedSource(ctx, feed)
 }
 
-func (m *MockDatastoreClient) ReadCrawledPage(ctx context.Context, url string) (*models.CrawledPage, bool, error) {
-	if m.GetError != nil {
-		return nil, false, m.GetError
+func (m *MockDatastoreClient) ReadFeedSource(ctx context.Context, url string) (*models.FeedSource, bool, error) {
+	if err := m.injected(&m.FeedSourceError); err != nil {
+		return nil, false, err
 	}
-	if page, exists := m.Pages[url]; exists {
-		return page, true, nil
+	return m.memoryStore.ReadFeedSource(ctx, url)
+}
+
+func (m *MockDatastoreClient) ListFeedSources(ctx context.Context) ([]*models.FeedSource, error) {
+	if err := m.injected(&m.FeedSourceError); err != nil {
+		return nil, err
 	}
-	return nil, false, nil
+	return m.memoryStore.ListFeedSources(ctx)
 }
 
-func (m *MockDatastoreClient) WriteCrawledPage(ctx context.Context, url, title, content string, datetime time.Time) (*models.CrawledPage, error) {
-	if m.CreateError != nil {
-		return nil, m.CreateError
+func (m *MockDatastoreClient) UpdateFeedSource(ctx context.Context, url string, update func(feed *models.FeedSource)) (*models.FeedSource, bool, error) {
+	if err := m.injected(&m.FeedSourceError); err != nil {
+		return nil, false, err
+	}
+	return m.memoryStore.UpdateFeedSource(ctx, url, update)
+}
+
+func (m *MockDatastoreClient) DeleteFeedSource(ctx context.Context, url string) error {
+	if err := m.injected(&m.FeedSourceError); err != nil {
+		return err
 	}
-	page := &models.CrawledPage{
-		URL:      url,
-		Title:    title,
-		Content:  content,
-		DateTime: datetime,
+	return m.memoryStore.DeleteFeedSource(ctx, url)
+}
+
+func (m *MockDatastoreClient) AppendLlmCall(ctx context.Context, call *models.LlmCall) error {
+	if err := m.injected(&m.LlmCallError); err != nil {
+		return err
 	}
-	m.Pages[url] = page
-	return page, nil
+	return m.memoryStore.AppendLlmCall(ctx, call)
 }
 
-func (m *MockDatastoreClient) GetCrawledPagesSince(ctx context.Context, oldestDate time.Time) ([]models.CrawledPage, error) {
-	var pages []models.CrawledPage
+func (m *MockDatastoreClient) ListLlmCalls(ctx context.Context, url string) ([]*models.LlmCall, error) {
+	if err := m.injected(&m.LlmCallError); err != nil {
+		return nil, err
+	}
+	return m.memoryStore.ListLlmCalls(ctx, url)
+}
 
-	for _, page := range m.Pages {
-		if !page.DateTime.IsZero() && !page.DateTime.Before(oldestDate) {
-			pages = append(pages, *page)
-		}
+func (m *MockDatastoreClient) DeleteLlmCallsBefore(ctx context.Context, before time.Time) (int, error) {
+	if err := m.injected(&m.LlmCallError); err != nil {
+		return 0, err
 	}
+	return m.memoryStore.DeleteLlmCallsBefore(ctx, before)
+}
 
-	return pages, nil
+func (m *MockDatastoreClient) WriteLlmBatch(ctx context.Context, batch *models.LlmBatch) error {
+	if err := m.injected(&m.LlmBatchError); err != nil {
+		return err
+	}
+	return m.memoryStore.WriteLlmBatch(ctx, batch)
 }
 
-func (m *MockDatastoreClient) ReadAnalysisResult(ctx context.Context, url string, mode models.AnalysisMode) (*models.AnalysisResult, bool, error) {
-	if m.GetAnalysisError != nil {
-		return nil, false, m.GetAnalysisError
+func (m *MockDatastoreClient) ListLlmBatches(ctx context.Context) ([]*models.LlmBatch, error) {
+	if err := m.injected(&m.LlmBatchError); err != nil {
+		return nil, err
 	}
-	key := UrlToAnalysisKey(url, mode)
-	if result, exists := m.AnalysisResults[key]; exists {
-		return result, true, nil
+	return m.memoryStore.ListLlmBatches(ctx)
+}
+
+func (m *MockDatastoreClient) CreateOutboxMessage(ctx context.Context, message *models.OutboxMessage) (bool, error) {
+	if err := m.injected(&m.OutboxError); err != nil {
+		return false, err
 	}
-	return nil, false, nil
+	return m.memoryStore.CreateOutboxMessage(ctx, message)
 }
 
-func (m *MockDatastoreClient) WriteAnalysisResult(ctx context.Context, url string, result *models.AnalysisResult) error {
-	if m.CreateAnalysisError != nil {
-		return m.CreateAnalysisError
+func (m *MockDatastoreClient) WriteOutboxMessage(ctx context.Context, message *models.OutboxMessage) error {
+	if err := m.injected(&m.OutboxError); err != nil {
+		return err
 	}
-	key := UrlToAnalysisKey(url, result.Mode)
-	m.AnalysisResults[key] = result
-	return nil
+	return m.memoryStore.WriteOutboxMessage(ctx, message)
 }
 
-func (m *MockDatastoreClient) Close() error {
-	return nil
+func (m *MockDatastoreClient) ListDueOutboxMessages(ctx context.Context, before time.Time) ([]*models.OutboxMessage, error) {
+	if err := m.injected(&m.OutboxError); err != nil {
+		return nil, err
+	}
+	return m.memoryStore.ListDueOutboxMessages(ctx, before)
+}
+
+func (m *MockDatastoreClient) ReadEventsCursor(ctx context.Context, mode models.AnalysisMode) (*models.EventsCursor, bool, error) {
+	if err := m.injected(&m.OutboxError); err != nil {
+		return nil, false, err
+	}
+	return m.memoryStore.ReadEventsCursor(ctx, mode)
+}
+
+func (m *MockDatastoreClient) WriteEventsCursor(ctx context.Context, cursor *models.EventsCursor) error {
+	if err := m.injected(&m.OutboxError); err != nil {
+		return err
+	}
+	return m.memoryStore.WriteEventsCursor(ctx, cursor)
 }
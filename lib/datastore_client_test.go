@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/models"
+)
+
+func TestMockDatastoreClient_CopiesPagesAndResults(t *testing.T) {
+	ctx := context.Background()
+	mockDS := NewMockDatastoreClient()
+
+	page := &models.CrawledPage{URL: "https://example.com/a", Title: "Stored", ContentHash: "hash"}
+	if err := mockDS.SaveCrawledPage(ctx, page); err != nil {
+		t.Fatalf("SaveCrawledPage() error = %v", err)
+	}
+	page.Title = "Changed after saving"
+	read, _, _ := mockDS.ReadCrawledPage(ctx, page.URL)
+	read.CacheSource = models.CacheSourceNetwork
+	if again, _, _ := mockDS.ReadCrawledPage(ctx, page.URL); again.Title != "Stored" || again.CacheSource != "" {
+		t.Errorf("stored page = %+v, want the page as saved", again)
+	}
+
+	percentage := 40
+	result := &models.AnalysisResult{Mode: models.AnalysisMode("joke"), JokePercentage: &percentage, ContentHash: "hash"}
+	if err := mockDS.WriteAnalysisResult(ctx, page.URL, result); err != nil {
+		t.Fatalf("WriteAnalysisResult() error = %v", err)
+	}
+	percentage = 90
+	found, _ := mockDS.FindAnalysisResultsByContentHash(ctx, "hash", result.Mode)
+	if len(found) != 1 || *found[0].JokePercentage != 40 {
+		t.Fatalf("FindAnalysisResultsByContentHash() = %+v, want the result as written", found)
+	}
+	*found[0].JokePercentage = 70
+	if stored, _, _ := mockDS.ReadAnalysisResult(ctx, page.URL, result.Mode); *stored.JokePercentage != 40 {
+		t.Errorf("stored joke percentage = %d, want 40", *stored.JokePercentage)
+	}
+}
+
+func TestMockDatastoreClient_QueryCrawledPages(t *testing.T) {
+	ctx := context.Background()
+	mockDS := NewMockDatastoreClient()
+	march := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	for _, page := range []*models.CrawledPage{
+		{URL: "example.com/b", Language: "fr", DateTime: march},
+		{URL: "example.com/a", Language: "fr", DateTime: march},
+		{URL: "example.com/english", Language: "en", DateTime: march},
+		{URL: "example.com/later", Language: "fr", DateTime: march.Add(time.Hour)},
+		{URL: "example.com/april", Language: "fr", DateTime: march.AddDate(0, 1, 0)},
+	} {
+		if err := mockDS.SaveCrawledPage(ctx, page); err != nil {
+			t.Fatalf("SaveCrawledPage() error = %v", err)
+		}
+	}
+
+	// Batches of two pages continue after the last page of the previous one
+	query := models.CrawledPageQuery{Until: march.AddDate(0, 0, 7), Language: "fr", Limit: 2}
+	var got []string
+	for {
+		pages, err := mockDS.QueryCrawledPages(ctx, query)
+		if err != nil {
+			t.Fatalf("QueryCrawledPages() error = %v", err)
+		}
+		for _, page := range pages {
+			got = append(got, page.URL)
+		}
+		if len(pages) < query.Limit {
+			break
+		}
+		query.After = &pages[len(pages)-1]
+	}
+	if want := "example.com/a example.com/b example.com/later"; strings.Join(got, " ") != want {
+		t.Errorf("QueryCrawledPages() = %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zeace/poisson/models"
+)
+
+// ReadLinkedPage reads the CrawledPage of url like ReadCrawledPage, with the content of a
+// duplicate read from the page it duplicates. A duplicate is reported as not found if that page
+// is no longer stored or its content changed since. The page an alias links to is returned
+// instead of the alias, with its own URL.
+func ReadLinkedPage(ctx context.Context, datastoreClient DatastoreClient, url string) (*models.CrawledPage, bool, error) {
+	page, found, err := datastoreClient.ReadCrawledPage(ctx, url)
+	if err != nil || !found || page.AliasOf == "" {
+		return linkDuplicate(ctx, datastoreClient, page, found, err)
+	}
+	// Aliases always link to the page itself, so only one is followed
+	target := page.AliasOf
+	page, found, err = datastoreClient.ReadCrawledPage(ctx, target)
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading %s, aliased by %s: %w", target, url, err)
+	}
+	if found && page.AliasOf != "" {
+		return nil, false, nil
+	}
+	return linkDuplicate(ctx, datastoreClient, page, found, nil)
+}
+
+// linkDuplicate returns page with the content of the page it duplicates, if it is a duplicate,
+// as read by ReadCrawledPage with found and err.
+func linkDuplicate(
+	ctx context.Context,
+	datastoreClient DatastoreClient,
+	page *models.CrawledPage,
+	found bool,
+	err error,
+) (*models.CrawledPage, bool, error) {
+	if err != nil || !found || page.DuplicateOf == "" {
+		return page, found, err
+	}
+	url := page.URL
+	original, found, err := datastoreClient.ReadCrawledPage(ctx, page.DuplicateOf)
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading %s, duplicated by %s: %w", page.DuplicateOf, url, err)
+	}
+	if !found || original.ContentHash != page.ContentHash {
+		return nil, false, nil
+	}
+	linked := *page
+	linked.Content = original.Content
+	return &linked, true, nil
+}
@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zeace/poisson/models"
+)
+
+func TestReadLinkedPage(t *testing.T) {
+	ctx := context.Background()
+	mockDS := NewMockDatastoreClient()
+	hash := ContentHash("Shared content")
+	mockDS.Pages["example.com/a"] = &models.CrawledPage{URL: "example.com/a", Content: "Shared content", ContentHash: hash}
+	mockDS.Pages["example.com/b"] = &models.CrawledPage{URL: "example.com/b", ContentHash: hash, DuplicateOf: "example.com/a"}
+	mockDS.Pages["example.com/c"] = &models.CrawledPage{URL: "example.com/c", ContentHash: ContentHash("Old content"), DuplicateOf: "example.com/a"}
+	mockDS.Pages["example.com/d"] = &models.CrawledPage{URL: "example.com/d", ContentHash: hash, DuplicateOf: "example.com/gone"}
+	mockDS.Pages["bit.ly/e"] = &models.CrawledPage{URL: "bit.ly/e", AliasOf: "example.com/a"}
+	mockDS.Pages["bit.ly/f"] = &models.CrawledPage{URL: "bit.ly/f", AliasOf: "example.com/b"}
+	mockDS.Pages["bit.ly/g"] = &models.CrawledPage{URL: "bit.ly/g", AliasOf: "example.com/gone"}
+	mockDS.Pages["bit.ly/h"] = &models.CrawledPage{URL: "bit.ly/h", AliasOf: "bit.ly/e"}
+
+	tests := []struct {
+		url         string
+		wantFound   bool
+		wantContent string
+		wantURL     string // Empty means url
+	}{
+		{"example.com/a", true, "Shared content", ""},
+		{"example.com/b", true, "Shared content", ""},
+		{"example.com/c", false, "", ""}, // The linked page changed
+		{"example.com/d", false, "", ""}, // The linked page is gone
+		{"example.com/missing", false, "", ""},
+		{"bit.ly/e", true, "Shared content", "example.com/a"}, // Aliases return the page they link to
+		{"bit.ly/f", true, "Shared content", "example.com/b"},
+		{"bit.ly/g", false, "", ""},
+		{"bit.ly/h", false, "", ""}, // Aliases of aliases are not followed
+	}
+	for _, tt := range tests {
+		page, found, err := ReadLinkedPage(ctx, mockDS, tt.url)
+		if err != nil {
+			t.Fatalf("ReadLinkedPage(%s) error = %v", tt.url, err)
+		}
+		wantURL := tt.wantURL
+		if wantURL == "" {
+			wantURL = tt.url
+		}
+		if found != tt.wantFound || (found && (page.Content != tt.wantContent || page.URL != wantURL)) {
+			t.Errorf("ReadLinkedPage(%s) = %+v, %v, want content %q", tt.url, page, found, tt.wantContent)
+		}
+	}
+	if mockDS.Pages["example.com/b"].Content != "" {
+		t.Error("ReadLinkedPage() modified the stored duplicate")
+	}
+}
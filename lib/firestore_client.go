@@ -0,0 +1,1025 @@
+//go:build !nocloud
+
+package lib
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/zeace/poisson/models"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultLocalStore is the local store used when POISSON_LOCAL_STORE is unset. Binaries built
+// with Firestore support use Firestore by default.
+const defaultLocalStore = ""
+
+// datastoreClientAdapter wraps a *firestore.Client to implement DatastoreClient
+type datastoreClientAdapter struct {
+	client *firestore.Client
+}
+
+// createCloudDatastoreClient creates a DatastoreClient for Firestore with embedded credentials or
+// default credentials. It uses the project ID from GOOGLE_CLOUD_PROJECT environment variable, or
+// defaults to "poisson-berkan", and the Firestore database from POISSON_DATABASE, or the default
+// database.
+// Operations are paused while the quota of the database is exhausted, for up to POISSON_QUOTA_MAX_WAIT
+// (see QuotaDatastoreClient).
+// If POISSON_SHADOW_DATABASE names another database of the project, every operation is mirrored to it
+// (see ShadowDatastoreClient).
+func createCloudDatastoreClient(ctx context.Context) (DatastoreClient, error) {
+	// Get project ID from environment or use default
+	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
+	if projectID == "" {
+		projectID = "poisson-berkan"
+	}
+	databaseID := os.Getenv("POISSON_DATABASE")
+	if databaseID == "" {
+		databaseID = firestore.DefaultDatabaseID
+	}
+
+	var quotaMaxWait time.Duration
+	if value := os.Getenv("POISSON_QUOTA_MAX_WAIT"); value != "" {
+		var err error
+		if quotaMaxWait, err = time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("invalid POISSON_QUOTA_MAX_WAIT: %w", err)
+		}
+	}
+
+	primary, err := createFirestoreClient(ctx, projectID, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	primary = NewQuotaDatastoreClient(primary, quotaMaxWait)
+	shadowDatabaseID := os.Getenv("POISSON_SHADOW_DATABASE")
+	if shadowDatabaseID == "" {
+		return primary, nil
+	}
+	shadow, err := createFirestoreClient(ctx, projectID, shadowDatabaseID)
+	if err != nil {
+		primary.Close()
+		return nil, fmt.Errorf("error creating shadow datastore client: %w", err)
+	}
+	return NewShadowDatastoreClient(primary, shadow), nil
+}
+
+// createFirestoreClient creates a DatastoreClient for a database of projectID.
+func createFirestoreClient(ctx context.Context, projectID, databaseID string) (DatastoreClient, error) {
+	// Try to use embedded credentials first
+	googleKeyJSON := GoogleKeyJSON()
+	var client *firestore.Client
+	var err error
+	if len(googleKeyJSON) > 0 {
+		client, err = firestore.NewClientWithDatabase(ctx, projectID, databaseID, option.WithCredentialsJSON(googleKeyJSON))
+	} else {
+		// Fall back to default credentials (e.g., from environment)
+		client, err = firestore.NewClientWithDatabase(ctx, projectID, databaseID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDatastoreClient(client), nil
+}
+
+// NewDatastoreClient creates a new DatastoreClient from a firestore.Client
+func NewDatastoreClient(client *firestore.Client) DatastoreClient {
+	return &datastoreClientAdapter{client: client}
+}
+
+func (d *datastoreClientAdapter) ReadCrawledPage(ctx context.Context, url string) (*models.CrawledPage, bool, error) {
+	key := UrlToCrawledPageKey(url)
+	docRef := d.client.Collection(models.CrawledPageKind).Doc(key)
+	doc, err := docRef.Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	var page models.CrawledPage
+	if err := doc.DataTo(&page); err != nil {
+		return nil, false, err
+	}
+	page.URL = url // Ensure URL is set from original URL (not the key)
+
+	return &page, true, nil
+}
+
+func (d *datastoreClientAdapter) WriteCrawledPage(ctx context.Context, url, title, content string, datetime time.Time) (*models.CrawledPage, error) {
+	page := &models.CrawledPage{
+		URL:      url,
+		Title:    title,
+		Content:  content,
+		DateTime: datetime,
+	}
+
+	if err := d.SaveCrawledPage(ctx, page); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+func (d *datastoreClientAdapter) SaveCrawledPage(ctx context.Context, page *models.CrawledPage) error {
+	if page.DateTime.IsZero() {
+		page.DateTime = time.Now()
+	}
+
+	key := UrlToCrawledPageKey(page.URL)
+	docRef := d.client.Collection(models.CrawledPageKind).Doc(key)
+	_, err := docRef.Set(ctx, page)
+	return err
+}
+
+// GetCrawledPagesSince returns all CrawledPages with DateTime >= oldestDate.
+func (d *datastoreClientAdapter) GetCrawledPagesSince(ctx context.Context, oldestDate time.Time) ([]models.CrawledPage, error) {
+	query := d.client.Collection(models.CrawledPageKind).
+		Where("DateTime", ">=", oldestDate).OrderBy("DateTime", firestore.Desc)
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []models.CrawledPage
+	for _, doc := range docs {
+		var page models.CrawledPage
+		if err := doc.DataTo(&page); err != nil {
+			continue // Skip invalid documents
+		}
+		// URL is already set from document data when we wrote it
+		pages = append(pages, page)
+	}
+
+	return pages, nil
+}
+
+func (d *datastoreClientAdapter) FindCrawledPagesByContentHash(ctx context.Context, contentHash string) ([]models.CrawledPage, error) {
+	query := d.client.Collection(models.CrawledPageKind).
+		Where("ContentHash", "==", contentHash)
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []models.CrawledPage
+	for _, doc := range docs {
+		var page models.CrawledPage
+		if err := doc.DataTo(&page); err != nil {
+			continue // Skip invalid documents
+		}
+		pages = append(pages, page)
+	}
+
+	// Sorted here rather than in the query, which would need a composite index
+	sort.Slice(pages, func(i, j int) bool { return pages[i].DateTime.Before(pages[j].DateTime) })
+	return pages, nil
+}
+
+func (d *datastoreClientAdapter) QueryCrawledPages(ctx context.Context, query models.CrawledPageQuery) ([]models.CrawledPage, error) {
+	collection := d.client.Collection(models.CrawledPageKind)
+	q := collection.Query
+	if query.Language != "" {
+		q = q.Where("Language", "==", query.Language)
+	}
+	if !query.Since.IsZero() {
+		q = q.Where("DateTime", ">=", query.Since)
+	}
+	if !query.Until.IsZero() {
+		q = q.Where("DateTime", "<", query.Until)
+	}
+	q = q.OrderBy("DateTime", firestore.Asc).OrderBy(firestore.DocumentID, firestore.Asc)
+	if query.After != nil {
+		q = q.StartAfter(query.After.DateTime, collection.Doc(UrlToCrawledPageKey(query.After.URL)))
+	}
+	if query.Limit > 0 {
+		q = q.Limit(query.Limit)
+	}
+
+	docs, err := q.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []models.CrawledPage
+	for _, doc := range docs {
+		var page models.CrawledPage
+		if err := doc.DataTo(&page); err != nil {
+			continue // Skip invalid documents
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+func (d *datastoreClientAdapter) ReadAnalysisResult(
+	ctx context.Context,
+	url string,
+	mode models.AnalysisMode,
+) (*models.AnalysisResult, bool, error) {
+	// Convert URL to analysis key
+	keyName := UrlToAnalysisKey(url, mode)
+
+	docRef := d.client.Collection(models.AnalysisResultKind).Doc(keyName)
+	doc, err := docRef.Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	var result models.AnalysisResult
+	if err := doc.DataTo(&result); err != nil {
+		return nil, false, err
+	}
+
+	return &result, true, nil
+}
+
+func (d *datastoreClientAdapter) WriteAnalysisResult(ctx context.Context, url string, result *models.AnalysisResult) error {
+	// Convert URL to analysis key
+	keyName := UrlToAnalysisKey(url, result.Mode)
+	result.URL = url
+
+	docRef := d.client.Collection(models.AnalysisResultKind).Doc(keyName)
+	_, err := docRef.Set(ctx, result)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListAnalysisResults returns all AnalysisResults for mode. For results stored without a URL,
+// the URL is recovered from the document key.
+func (d *datastoreClientAdapter) ListAnalysisResults(ctx context.Context, mode models.AnalysisMode) ([]*models.AnalysisResult, error) {
+	query := d.client.Collection(models.AnalysisResultKind).Where("Mode", "==", string(mode))
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*models.AnalysisResult
+	for _, doc := range docs {
+		var result models.AnalysisResult
+		if err := doc.DataTo(&result); err != nil {
+			continue // Skip invalid documents
+		}
+		if result.URL == "" {
+			result.URL = analysisKeyToURL(doc.Ref.ID, mode)
+		}
+		results = append(results, &result)
+	}
+
+	return results, nil
+}
+
+func (d *datastoreClientAdapter) DeleteAnalysisResult(ctx context.Context, url string, mode models.AnalysisMode) error {
+	keyName := UrlToAnalysisKey(url, mode)
+	_, err := d.client.Collection(models.AnalysisResultKind).Doc(keyName).Delete(ctx)
+	return err
+}
+
+func (d *datastoreClientAdapter) ListAnalysisResultsSince(
+	ctx context.Context,
+	mode models.AnalysisMode,
+	since time.Time,
+) ([]*models.AnalysisResult, error) {
+	query := d.client.Collection(models.AnalysisResultKind).
+		Where("Mode", "==", string(mode)).Where("AnalyzedAt", ">", since).OrderBy("AnalyzedAt", firestore.Asc)
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*models.AnalysisResult
+	for _, doc := range docs {
+		var result models.AnalysisResult
+		if err := doc.DataTo(&result); err != nil {
+			continue // Skip invalid documents
+		}
+		if result.URL == "" {
+			result.URL = analysisKeyToURL(doc.Ref.ID, mode)
+		}
+		results = append(results, &result)
+	}
+
+	return results, nil
+}
+
+func (d *datastoreClientAdapter) FindAnalysisResultsByContentHash(
+	ctx context.Context,
+	contentHash string,
+	mode models.AnalysisMode,
+) ([]*models.AnalysisResult, error) {
+	query := d.client.Collection(models.AnalysisResultKind).
+		Where("ContentHash", "==", contentHash).Where("Mode", "==", string(mode))
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*models.AnalysisResult
+	for _, doc := range docs {
+		var result models.AnalysisResult
+		if err := doc.DataTo(&result); err != nil {
+			continue // Skip invalid documents
+		}
+		if result.URL == "" {
+			result.URL = analysisKeyToURL(doc.Ref.ID, mode)
+		}
+		results = append(results, &result)
+	}
+
+	return results, nil
+}
+
+func (d *datastoreClientAdapter) ReadPageEmbedding(ctx context.Context, url string) (*models.PageEmbedding, bool, error) {
+	docRef := d.client.Collection(models.PageEmbeddingKind).Doc(UrlToCrawledPageKey(url))
+	doc, err := docRef.Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	var embedding models.PageEmbedding
+	if err := doc.DataTo(&embedding); err != nil {
+		return nil, false, err
+	}
+
+	return &embedding, true, nil
+}
+
+func (d *datastoreClientAdapter) WritePageEmbedding(ctx context.Context, embedding *models.PageEmbedding) error {
+	docRef := d.client.Collection(models.PageEmbeddingKind).Doc(UrlToCrawledPageKey(embedding.URL))
+	_, err := docRef.Set(ctx, embedding)
+	return err
+}
+
+func (d *datastoreClientAdapter) ListPageEmbeddingsSince(ctx context.Context, since time.Time) ([]*models.PageEmbedding, error) {
+	query := d.client.Collection(models.PageEmbeddingKind).Where("CreatedAt", ">=", since)
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var embeddings []*models.PageEmbedding
+	for _, doc := range docs {
+		var embedding models.PageEmbedding
+		if err := doc.DataTo(&embedding); err != nil {
+			continue // Skip invalid documents
+		}
+		embeddings = append(embeddings, &embedding)
+	}
+
+	return embeddings, nil
+}
+
+func (d *datastoreClientAdapter) WritePendingAnalysis(ctx context.Context, pending *models.PendingAnalysis) error {
+	docRef := d.client.Collection(models.PendingAnalysisKind).Doc(UrlToAnalysisKey(pending.URL, pending.Mode))
+	_, err := docRef.Set(ctx, pending)
+	return err
+}
+
+func (d *datastoreClientAdapter) QueuePendingAnalysis(ctx context.Context, pending *models.PendingAnalysis) (bool, error) {
+	docRef := d.client.Collection(models.PendingAnalysisKind).Doc(UrlToAnalysisKey(pending.URL, pending.Mode))
+	queued := false
+
+	err := d.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		queued = false
+
+		doc, err := tx.Get(docRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var existing models.PendingAnalysis
+			if err := doc.DataTo(&existing); err != nil {
+				return err
+			}
+			if existing.BatchID != "" {
+				return nil // Already submitted in a batch
+			}
+		}
+
+		queued = true
+		return tx.Set(docRef, pending)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return queued, nil
+}
+
+func (d *datastoreClientAdapter) ListPendingAnalyses(ctx context.Context) ([]*models.PendingAnalysis, error) {
+	query := d.client.Collection(models.PendingAnalysisKind).OrderBy("CreatedAt", firestore.Asc)
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*models.PendingAnalysis
+	for _, doc := range docs {
+		var p models.PendingAnalysis
+		if err := doc.DataTo(&p); err != nil {
+			continue // Skip invalid documents
+		}
+		pending = append(pending, &p)
+	}
+
+	return pending, nil
+}
+
+func (d *datastoreClientAdapter) DeletePendingAnalysis(ctx context.Context, url string, mode models.AnalysisMode) error {
+	_, err := d.client.Collection(models.PendingAnalysisKind).Doc(UrlToAnalysisKey(url, mode)).Delete(ctx)
+	return err
+}
+
+func (d *datastoreClientAdapter) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	docRef := d.client.Collection(models.LeaseKind).Doc(leaseKey(name))
+	acquired := false
+
+	err := d.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		acquired = false
+		now := time.Now()
+
+		doc, err := tx.Get(docRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var lease models.Lease
+			if err := doc.DataTo(&lease); err != nil {
+				return err
+			}
+			if lease.Holder != holder && !lease.Expired(now) {
+				return nil // Held by another instance
+			}
+		}
+
+		acquired = true
+		return tx.Set(docRef, &models.Lease{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)})
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return acquired, nil
+}
+
+func (d *datastoreClientAdapter) ReleaseLease(ctx context.Context, name, holder string) error {
+	docRef := d.client.Collection(models.LeaseKind).Doc(leaseKey(name))
+
+	return d.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			return err
+		}
+
+		var lease models.Lease
+		if err := doc.DataTo(&lease); err != nil {
+			return err
+		}
+		if lease.Holder != holder {
+			return nil // Lease was taken over after expiring
+		}
+		return tx.Delete(docRef)
+	})
+}
+
+func (d *datastoreClientAdapter) ReadCrawlJob(ctx context.Context, id string) (*models.CrawlJob, bool, error) {
+	docRef := d.client.Collection(models.CrawlJobKind).Doc(id)
+	doc, err := docRef.Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	var job models.CrawlJob
+	if err := doc.DataTo(&job); err != nil {
+		return nil, false, err
+	}
+
+	return &job, true, nil
+}
+
+func (d *datastoreClientAdapter) WriteCrawlJob(ctx context.Context, job *models.CrawlJob) error {
+	docRef := d.client.Collection(models.CrawlJobKind).Doc(job.ID)
+	_, err := docRef.Set(ctx, job)
+	return err
+}
+
+func (d *datastoreClientAdapter) ClaimIdempotencyKey(
+	ctx context.Context,
+	record *models.IdempotencyKey,
+) (*models.IdempotencyKey, bool, error) {
+	docRef := d.client.Collection(models.IdempotencyKeyKind).Doc(idempotencyKey(record.Key))
+	var existing *models.IdempotencyKey
+
+	err := d.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		existing = nil
+
+		doc, err := tx.Get(docRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var stored models.IdempotencyKey
+			if err := doc.DataTo(&stored); err != nil {
+				return err
+			}
+			if !stored.Expired(time.Now()) {
+				existing = &stored
+				return nil
+			}
+		}
+
+		return tx.Set(docRef, record)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if existing != nil {
+		return existing, false, nil
+	}
+	return record, true, nil
+}
+
+func (d *datastoreClientAdapter) ReleaseIdempotencyKey(ctx context.Context, key, jobID string) error {
+	docRef := d.client.Collection(models.IdempotencyKeyKind).Doc(idempotencyKey(key))
+
+	return d.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			return err
+		}
+
+		var record models.IdempotencyKey
+		if err := doc.DataTo(&record); err != nil {
+			return err
+		}
+		if record.JobID != jobID {
+			return nil // Key was claimed again after expiring
+		}
+		return tx.Delete(docRef)
+	})
+}
+
+func (d *datastoreClientAdapter) ReadAPIToken(ctx context.Context, id string) (*models.APIToken, bool, error) {
+	docRef := d.client.Collection(models.APITokenKind).Doc(id)
+	doc, err := docRef.Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	var token models.APIToken
+	if err := doc.DataTo(&token); err != nil {
+		return nil, false, err
+	}
+
+	return &token, true, nil
+}
+
+func (d *datastoreClientAdapter) WriteAPIToken(ctx context.Context, token *models.APIToken) error {
+	docRef := d.client.Collection(models.APITokenKind).Doc(token.ID)
+	_, err := docRef.Set(ctx, token)
+	return err
+}
+
+func (d *datastoreClientAdapter) ListAPITokens(ctx context.Context) ([]*models.APIToken, error) {
+	query := d.client.Collection(models.APITokenKind).OrderBy("CreatedAt", firestore.Asc)
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []*models.APIToken
+	for _, doc := range docs {
+		var token models.APIToken
+		if err := doc.DataTo(&token); err != nil {
+			continue // Skip invalid documents
+		}
+		tokens = append(tokens, &token)
+	}
+
+	return tokens, nil
+}
+
+func (d *datastoreClientAdapter) RecordAPITokenRequest(ctx context.Context, id string, at time.Time) error {
+	docRef := d.client.Collection(models.APITokenKind).Doc(id)
+	_, err := docRef.Update(ctx, []firestore.Update{
+		{Path: "RequestCount", Value: firestore.Increment(1)},
+		{Path: "LastUsedAt", Value: at},
+	})
+	return err
+}
+
+func (d *datastoreClientAdapter) WriteJokeLabel(ctx context.Context, label *models.JokeLabel) error {
+	docRef := d.client.Collection(models.JokeLabelKind).Doc(UrlToCrawledPageKey(label.URL))
+	_, err := docRef.Set(ctx, label)
+	return err
+}
+
+func (d *datastoreClientAdapter) ListJokeLabels(ctx context.Context) ([]*models.JokeLabel, error) {
+	query := d.client.Collection(models.JokeLabelKind).OrderBy("CreatedAt", firestore.Asc)
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var labels []*models.JokeLabel
+	for _, doc := range docs {
+		var label models.JokeLabel
+		if err := doc.DataTo(&label); err != nil {
+			continue // Skip invalid documents
+		}
+		labels = append(labels, &label)
+	}
+
+	return labels, nil
+}
+
+func (d *datastoreClientAdapter) AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	_, _, err := d.client.Collection(models.AuditEventKind).Add(ctx, event)
+	return err
+}
+
+func (d *datastoreClientAdapter) ListAuditEvents(ctx context.Context, url string) ([]*models.AuditEvent, error) {
+	query := d.client.Collection(models.AuditEventKind).
+		Where("URL", "==", url).OrderBy("CreatedAt", firestore.Asc)
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*models.AuditEvent
+	for _, doc := range docs {
+		var event models.AuditEvent
+		if err := doc.DataTo(&event); err != nil {
+			continue // Skip invalid documents
+		}
+		events = append(events, &event)
+	}
+
+	return events, nil
+}
+
+func (d *datastoreClientAdapter) ReadDomainBoilerplate(ctx context.Context, host string) (*models.DomainBoilerplate, bool, error) {
+	docRef := d.client.Collection(models.DomainBoilerplateKind).Doc(host)
+	doc, err := docRef.Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	var profile models.DomainBoilerplate
+	if err := doc.DataTo(&profile); err != nil {
+		return nil, false, err
+	}
+
+	return &profile, true, nil
+}
+
+func (d *datastoreClientAdapter) WriteDomainBoilerplate(ctx context.Context, profile *models.DomainBoilerplate) error {
+	docRef := d.client.Collection(models.DomainBoilerplateKind).Doc(profile.Host)
+	_, err := docRef.Set(ctx, profile)
+	return err
+}
+
+func (d *datastoreClientAdapter) UpdateDomainBoilerplate(ctx context.Context, host string, update func(profile *models.DomainBoilerplate)) (*models.DomainBoilerplate, error) {
+	docRef := d.client.Collection(models.DomainBoilerplateKind).Doc(host)
+	var previous *models.DomainBoilerplate
+
+	err := d.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		previous = &models.DomainBoilerplate{Host: host}
+
+		doc, err := tx.Get(docRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if err := doc.DataTo(previous); err != nil {
+				return err
+			}
+		}
+
+		updated := copyDomainBoilerplate(previous)
+		update(updated)
+		return tx.Set(docRef, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return previous, nil
+}
+
+func (d *datastoreClientAdapter) ReadFetchError(ctx context.Context, url string) (*models.FetchError, bool, error) {
+	docRef := d.client.Collection(models.FetchErrorKind).Doc(UrlToCrawledPageKey(url))
+	doc, err := docRef.Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	var failure models.FetchError
+	if err := doc.DataTo(&failure); err != nil {
+		return nil, false, err
+	}
+
+	return &failure, true, nil
+}
+
+func (d *datastoreClientAdapter) WriteFetchError(ctx context.Context, failure *models.FetchError) error {
+	docRef := d.client.Collection(models.FetchErrorKind).Doc(UrlToCrawledPageKey(failure.URL))
+	_, err := docRef.Set(ctx, failure)
+	return err
+}
+
+func (d *datastoreClientAdapter) DeleteFetchError(ctx context.Context, url string) error {
+	_, err := d.client.Collection(models.FetchErrorKind).Doc(UrlToCrawledPageKey(url)).Delete(ctx)
+	return err
+}
+
+func (d *datastoreClientAdapter) ReadFeedState(ctx context.Context, url string) (*models.FeedState, bool, error) {
+	docRef := d.client.Collection(models.FeedStateKind).Doc(UrlToCrawledPageKey(url))
+	doc, err := docRef.Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	var state models.FeedState
+	if err := doc.DataTo(&state); err != nil {
+		return nil, false, err
+	}
+
+	return &state, true, nil
+}
+
+func (d *datastoreClientAdapter) AddFeedSource(ctx context.Context, feed *models.FeedSource) (bool, error) {
+	docRef := d.client.Collection(models.FeedSourceKind).Doc(UrlToCrawledPageKey(NormalizeURL(feed.URL)))
+	if _, err := docRef.Create(ctx, feed); err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (d *datastoreClientAdapter) ReadFeedSource(ctx context.Context, url string) (*models.FeedSource, bool, error) {
+	docRef := d.client.Collection(models.FeedSourceKind).Doc(UrlToCrawledPageKey(NormalizeURL(url)))
+	doc, err := docRef.Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	var feed models.FeedSource
+	if err := doc.DataTo(&feed); err != nil {
+		return nil, false, err
+	}
+
+	return &feed, true, nil
+}
+
+func (d *datastoreClientAdapter) ListFeedSources(ctx context.Context) ([]*models.FeedSource, error) {
+	query := d.client.Collection(models.FeedSourceKind).OrderBy("URL", firestore.Asc)
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var feeds []*models.FeedSource
+	for _, doc := range docs {
+		var feed models.FeedSource
+		if err := doc.DataTo(&feed); err != nil {
+			continue // Skip invalid documents
+		}
+		feeds = append(feeds, &feed)
+	}
+
+	return feeds, nil
+}
+
+func (d *datastoreClientAdapter) UpdateFeedSource(ctx context.Context, url string, update func(feed *models.FeedSource)) (*models.FeedSource, bool, error) {
+	docRef := d.client.Collection(models.FeedSourceKind).Doc(UrlToCrawledPageKey(NormalizeURL(url)))
+	var updated *models.FeedSource
+
+	err := d.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		updated = nil
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			return err
+		}
+
+		var feed models.FeedSource
+		if err := doc.DataTo(&feed); err != nil {
+			return err
+		}
+		update(&feed)
+		updated = &feed
+		return tx.Set(docRef, &feed)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return updated, updated != nil, nil
+}
+
+func (d *datastoreClientAdapter) DeleteFeedSource(ctx context.Context, url string) error {
+	_, err := d.client.Collection(models.FeedSourceKind).Doc(UrlToCrawledPageKey(NormalizeURL(url))).Delete(ctx)
+	return err
+}
+
+func (d *datastoreClientAdapter) WriteFeedState(ctx context.Context, state *models.FeedState) error {
+	docRef := d.client.Collection(models.FeedStateKind).Doc(UrlToCrawledPageKey(state.URL))
+	_, err := docRef.Set(ctx, state)
+	return err
+}
+
+func (d *datastoreClientAdapter) AppendLlmCall(ctx context.Context, call *models.LlmCall) error {
+	_, _, err := d.client.Collection(models.LlmCallKind).Add(ctx, call)
+	return err
+}
+
+func (d *datastoreClientAdapter) ListLlmCalls(ctx context.Context, url string) ([]*models.LlmCall, error) {
+	query := d.client.Collection(models.LlmCallKind).
+		Where("URL", "==", url).
+		OrderBy("CreatedAt", firestore.Asc)
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var calls []*models.LlmCall
+	for _, doc := range docs {
+		var call models.LlmCall
+		if err := doc.DataTo(&call); err != nil {
+			continue // Skip invalid documents
+		}
+		calls = append(calls, &call)
+	}
+
+	return calls, nil
+}
+
+func (d *datastoreClientAdapter) DeleteLlmCallsBefore(ctx context.Context, before time.Time) (int, error) {
+	query := d.client.Collection(models.LlmCallKind).Where("CreatedAt", "<", before)
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, doc := range docs {
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+func (d *datastoreClientAdapter) WriteLlmBatch(ctx context.Context, batch *models.LlmBatch) error {
+	docRef := d.client.Collection(models.LlmBatchKind).Doc(batch.ID)
+	_, err := docRef.Set(ctx, batch)
+	return err
+}
+
+func (d *datastoreClientAdapter) ListLlmBatches(ctx context.Context) ([]*models.LlmBatch, error) {
+	query := d.client.Collection(models.LlmBatchKind).OrderBy("CreatedAt", firestore.Asc)
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var batches []*models.LlmBatch
+	for _, doc := range docs {
+		var batch models.LlmBatch
+		if err := doc.DataTo(&batch); err != nil {
+			continue // Skip invalid documents
+		}
+		batches = append(batches, &batch)
+	}
+
+	return batches, nil
+}
+
+func (d *datastoreClientAdapter) CreateOutboxMessage(ctx context.Context, message *models.OutboxMessage) (bool, error) {
+	docRef := d.client.Collection(models.OutboxMessageKind).Doc(message.ID)
+	if _, err := docRef.Create(ctx, message); err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (d *datastoreClientAdapter) WriteOutboxMessage(ctx context.Context, message *models.OutboxMessage) error {
+	docRef := d.client.Collection(models.OutboxMessageKind).Doc(message.ID)
+	_, err := docRef.Set(ctx, message)
+	return err
+}
+
+func (d *datastoreClientAdapter) ListDueOutboxMessages(ctx context.Context, before time.Time) ([]*models.OutboxMessage, error) {
+	query := d.client.Collection(models.OutboxMessageKind).
+		Where("Status", "==", string(models.OutboxStatusPending)).
+		Where("NextAttemptAt", "<=", before).
+		OrderBy("NextAttemptAt", firestore.Asc)
+
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []*models.OutboxMessage
+	for _, doc := range docs {
+		var message models.OutboxMessage
+		if err := doc.DataTo(&message); err != nil {
+			continue // Skip invalid documents
+		}
+		messages = append(messages, &message)
+	}
+
+	return messages, nil
+}
+
+func (d *datastoreClientAdapter) ReadEventsCursor(ctx context.Context, mode models.AnalysisMode) (*models.EventsCursor, bool, error) {
+	docRef := d.client.Collection(models.EventsCursorKind).Doc(string(mode))
+	doc, err := docRef.Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	var cursor models.EventsCursor
+	if err := doc.DataTo(&cursor); err != nil {
+		return nil, false, err
+	}
+
+	return &cursor, true, nil
+}
+
+func (d *datastoreClientAdapter) WriteEventsCursor(ctx context.Context, cursor *models.EventsCursor) error {
+	docRef := d.client.Collection(models.EventsCursorKind).Doc(string(cursor.Mode))
+	_, err := docRef.Set(ctx, cursor)
+	return err
+}
+
+func (d *datastoreClientAdapter) Close() error {
+	return d.client.Close()
+}
@@ -0,0 +1,44 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GCSObjectInfo describes an object of a Google Cloud Storage bucket.
+type GCSObjectInfo struct {
+	Name string
+	Size int64
+	// Updated is when the object was last written.
+	Updated time.Time
+}
+
+// GCSHTTPURL returns the https://storage.googleapis.com URL of the object at the gs:// URL url,
+// which browsers can load if the object is public, or an empty string if url isn't a gs:// URL
+// of an object.
+func GCSHTTPURL(url string) string {
+	bucket, object, ok := strings.Cut(strings.TrimPrefix(url, "gs://"), "/")
+	if !strings.HasPrefix(url, "gs://") || !ok || bucket == "" || object == "" {
+		return ""
+	}
+	return "https://storage.googleapis.com/" + bucket + "/" + object
+}
+
+// ParseGCSURL splits a gs://bucket/prefix URL into bucket and object prefix.
+// The prefix has no leading slash and, if non-empty, ends with a slash.
+func ParseGCSURL(url string) (bucket, prefix string, err error) {
+	rest, ok := strings.CutPrefix(url, "gs://")
+	if !ok {
+		return "", "", fmt.Errorf("not a gs:// URL: %s", url)
+	}
+	bucket, prefix, _ = strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("missing bucket in %s", url)
+	}
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return bucket, prefix, nil
+}
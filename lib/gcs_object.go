@@ -0,0 +1,106 @@
+//go:build !nocloud
+
+package lib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// newStorageService returns a Cloud Storage client with embedded or default credentials and scope.
+func newStorageService(ctx context.Context, scope string) (*storage.Service, error) {
+	var opts []option.ClientOption
+	if googleKeyJSON := GoogleKeyJSON(); len(googleKeyJSON) > 0 {
+		opts = append(opts, option.WithCredentialsJSON(googleKeyJSON))
+	}
+	opts = append(opts, option.WithScopes(scope))
+
+	service, err := storage.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating storage client: %w", err)
+	}
+	return service, nil
+}
+
+// ReadGCSObject downloads an object from Google Cloud Storage with embedded or default credentials.
+// Returns the content and true if found, or nil and false if the object does not exist.
+func ReadGCSObject(ctx context.Context, bucket, object string) ([]byte, bool, error) {
+	service, err := newStorageService(ctx, storage.DevstorageReadOnlyScope)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp, err := service.Objects.Get(bucket, object).Context(ctx).Download()
+	if err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// WriteGCSObject uploads data as an object to Google Cloud Storage, replacing any previous one.
+func WriteGCSObject(ctx context.Context, bucket, object string, data []byte) error {
+	service, err := newStorageService(ctx, storage.DevstorageReadWriteScope)
+	if err != nil {
+		return err
+	}
+	if _, err := service.Objects.Insert(bucket, &storage.Object{Name: object}).Media(bytes.NewReader(data)).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("error writing gs://%s/%s: %w", bucket, object, err)
+	}
+	return nil
+}
+
+// DeleteGCSObject deletes an object from Google Cloud Storage. Deleting a missing object is
+// not an error.
+func DeleteGCSObject(ctx context.Context, bucket, object string) error {
+	service, err := newStorageService(ctx, storage.DevstorageReadWriteScope)
+	if err != nil {
+		return err
+	}
+	if err := service.Objects.Delete(bucket, object).Context(ctx).Do(); err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("error deleting gs://%s/%s: %w", bucket, object, err)
+	}
+	return nil
+}
+
+// ListGCSObjects lists the objects of a Google Cloud Storage bucket whose names start with prefix.
+func ListGCSObjects(ctx context.Context, bucket, prefix string) ([]GCSObjectInfo, error) {
+	service, err := newStorageService(ctx, storage.DevstorageReadOnlyScope)
+	if err != nil {
+		return nil, err
+	}
+	var objects []GCSObjectInfo
+	err = service.Objects.List(bucket).Prefix(prefix).Pages(ctx, func(page *storage.Objects) error {
+		for _, item := range page.Items {
+			updated, _ := time.Parse(time.RFC3339, item.Updated)
+			objects = append(objects, GCSObjectInfo{Name: item.Name, Size: int64(item.Size), Updated: updated})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing gs://%s/%s: %w", bucket, prefix, err)
+	}
+	return objects, nil
+}
@@ -0,0 +1,53 @@
+package lib
+
+import "testing"
+
+func TestParseGCSURL(t *testing.T) {
+	tests := []struct {
+		url            string
+		expectedBucket string
+		expectedPrefix string
+		wantErr        bool
+	}{
+		{url: "gs://bucket", expectedBucket: "bucket", expectedPrefix: ""},
+		{url: "gs://bucket/", expectedBucket: "bucket", expectedPrefix: ""},
+		{url: "gs://bucket/prompts", expectedBucket: "bucket", expectedPrefix: "prompts/"},
+		{url: "gs://bucket/a/b/", expectedBucket: "bucket", expectedPrefix: "a/b/"},
+		{url: "gs://", wantErr: true},
+		{url: "/local/dir", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			bucket, prefix, err := ParseGCSURL(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseGCSURL(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+			if bucket != tt.expectedBucket || prefix != tt.expectedPrefix {
+				t.Errorf("ParseGCSURL(%q) = %q, %q; want %q, %q", tt.url, bucket, prefix, tt.expectedBucket, tt.expectedPrefix)
+			}
+		})
+	}
+}
+
+func TestGCSHTTPURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "gs://bucket/shots/abc.png", want: "https://storage.googleapis.com/bucket/shots/abc.png"},
+		{url: "gs://bucket/abc.png", want: "https://storage.googleapis.com/bucket/abc.png"},
+		{url: "gs://bucket", want: ""},
+		{url: "gs://bucket/", want: ""},
+		{url: "screenshots/abc.png", want: ""},
+		{url: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := GCSHTTPURL(tt.url); got != tt.want {
+				t.Errorf("GCSHTTPURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// ContentHash returns the hex-encoded SHA-256 of page content, used to recognize identical
+// content stored under different URLs.
+func ContentHash(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// FeedLeaseName returns the lease name used to lock polling of an RSS feed.
+func FeedLeaseName(feedURL string) string {
+	return "feed:" + UrlToCrawledPageKey(NormalizeURL(feedURL))
+}
+
+// LeaseHolderID returns an identifier for this process, unique across running instances.
+// On Cloud Run jobs it includes the execution and task index.
+func LeaseHolderID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	id := fmt.Sprintf("%s-%d", host, os.Getpid())
+	if execution := os.Getenv("CLOUD_RUN_EXECUTION"); execution != "" {
+		id = fmt.Sprintf("%s-%s-%s", execution, os.Getenv("CLOUD_RUN_TASK_INDEX"), id)
+	}
+	return id
+}
+
+// RunWithLease runs fn while holding the named lease. The lease is renewed every ttl/3
+// while fn runs and released when it returns; if renewal fails, fn's context is cancelled.
+// It returns false without calling fn if another holder has the lease.
+func RunWithLease(
+	ctx context.Context,
+	datastoreClient DatastoreClient,
+	name, holder string,
+	ttl time.Duration,
+	fn func(ctx context.Context) error,
+) (bool, error) {
+	acquired, err := datastoreClient.AcquireLease(ctx, name, holder, ttl)
+	if err != nil {
+		return false, fmt.Errorf("error acquiring lease %s: %w", name, err)
+	}
+	if !acquired {
+		return false, nil
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				renewed, err := datastoreClient.AcquireLease(runCtx, name, holder, ttl)
+				if err != nil || !renewed {
+					slog.WarnContext(runCtx, "Lost lease, stopping work", "lease", name, "error", err)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	fnErr := fn(runCtx)
+	close(done)
+	cancel()
+
+	// Release with a fresh context so an expired ctx doesn't leave the lease behind
+	releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer releaseCancel()
+	if err := datastoreClient.ReleaseLease(releaseCtx, name, holder); err != nil {
+		slog.WarnContext(ctx, "Error releasing lease", "lease", name, "error", err)
+	}
+
+	return true, fnErr
+}
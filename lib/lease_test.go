@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/models"
+)
+
+func TestMockDatastoreClient_AcquireLease(t *testing.T) {
+	ctx := context.Background()
+	mockDS := NewMockDatastoreClient()
+
+	acquired, err := mockDS.AcquireLease(ctx, "feed:a", "instance-1", time.Minute)
+	if err != nil || !acquired {
+		t.Fatalf("first AcquireLease = %v, %v; want true, nil", acquired, err)
+	}
+
+	acquired, _ = mockDS.AcquireLease(ctx, "feed:a", "instance-2", time.Minute)
+	if acquired {
+		t.Error("expected second holder to be refused while lease is held")
+	}
+
+	acquired, _ = mockDS.AcquireLease(ctx, "feed:a", "instance-1", time.Minute)
+	if !acquired {
+		t.Error("expected holder to be able to renew its own lease")
+	}
+
+	acquired, _ = mockDS.AcquireLease(ctx, "feed:b", "instance-2", time.Minute)
+	if !acquired {
+		t.Error("expected leases on different feeds to be independent")
+	}
+
+	// An expired lease can be taken over
+	mockDS.Leases["feed:a"].ExpiresAt = time.Now().Add(-time.Second)
+	acquired, _ = mockDS.AcquireLease(ctx, "feed:a", "instance-2", time.Minute)
+	if !acquired {
+		t.Error("expected expired lease to be taken over")
+	}
+
+	// Releasing someone else's lease is a no-op
+	if err := mockDS.ReleaseLease(ctx, "feed:a", "instance-1"); err != nil {
+		t.Fatalf("ReleaseLease returned error: %v", err)
+	}
+	if mockDS.Leases["feed:a"] == nil {
+		t.Error("expected lease held by another instance to survive release")
+	}
+}
+
+func TestRunWithLease(t *testing.T) {
+	ctx := context.Background()
+	mockDS := NewMockDatastoreClient()
+
+	ran := false
+	acquired, err := RunWithLease(ctx, mockDS, "feed:a", "instance-1", time.Minute, func(ctx context.Context) error {
+		ran = true
+		if _, held := mockDS.Leases["feed:a"]; !held {
+			t.Error("expected lease to be held while fn runs")
+		}
+		return nil
+	})
+	if err != nil || !acquired || !ran {
+		t.Fatalf("RunWithLease = %v, %v (ran=%v); want true, nil (ran=true)", acquired, err, ran)
+	}
+	if _, held := mockDS.Leases["feed:a"]; held {
+		t.Error("expected lease to be released after fn returns")
+	}
+}
+
+func TestRunWithLease_HeldElsewhere(t *testing.T) {
+	ctx := context.Background()
+	mockDS := NewMockDatastoreClient()
+	mockDS.Leases["feed:a"] = &models.Lease{Name: "feed:a", Holder: "instance-2", ExpiresAt: time.Now().Add(time.Minute)}
+
+	acquired, err := RunWithLease(ctx, mockDS, "feed:a", "instance-1", time.Minute, func(ctx context.Context) error {
+		t.Error("fn should not run when the lease is held by another instance")
+		return nil
+	})
+	if err != nil || acquired {
+		t.Errorf("RunWithLease = %v, %v; want false, nil", acquired, err)
+	}
+}
+
+func TestRunWithLease_Errors(t *testing.T) {
+	ctx := context.Background()
+	mockDS := NewMockDatastoreClient()
+	mockDS.LeaseError = errors.New("datastore unavailable")
+
+	if _, err := RunWithLease(ctx, mockDS, "feed:a", "instance-1", time.Minute, func(ctx context.Context) error { return nil }); err == nil {
+		t.Error("expected error when the lease cannot be acquired")
+	}
+
+	mockDS.LeaseError = nil
+	fnErr := errors.New("fetch failed")
+	acquired, err := RunWithLease(ctx, mockDS, "feed:a", "instance-1", time.Minute, func(ctx context.Context) error { return fnErr })
+	if !acquired || !errors.Is(err, fnErr) {
+		t.Errorf("RunWithLease = %v, %v; want true, %v", acquired, err, fnErr)
+	}
+}
+
+func TestFeedLeaseName(t *testing.T) {
+	a := FeedLeaseName("https://example.com/feed.xml?utm=1")
+	b := FeedLeaseName("http://example.com/feed.xml")
+	if a != b {
+		t.Errorf("FeedLeaseName differs for equivalent URLs: %q vs %q", a, b)
+	}
+	if a != "feed:example.com_feed.xml" {
+		t.Errorf("FeedLeaseName = %q, want %q", a, "feed:example.com_feed.xml")
+	}
+}
@@ -0,0 +1,212 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/zeace/poisson/models"
+)
+
+// localStoreFlushInterval is how often a LocalDatastoreClient checks for changes to write to its
+// file.
+const localStoreFlushInterval = 5 * time.Second
+
+// LocalDatastoreClient is a DatastoreClient that keeps all entities in memory and in a JSON file,
+// to run the binaries without Firestore. The file is read when the client is created and
+// rewritten after changes, every few seconds and on Close. It must only be used by one process
+// at a time.
+type LocalDatastoreClient struct {
+	*memoryStore
+	path string
+
+	flushMu sync.Mutex
+	// saved is the number of changes of the store when the file was last written or read.
+	saved uint64
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// localSnapshot is the content of the file of a LocalDatastoreClient.
+type localSnapshot struct {
+	Pages           map[string]*models.CrawledPage       `json:"pages,omitempty"`
+	AnalysisResults map[string]*models.AnalysisResult    `json:"analysis_results,omitempty"`
+	Leases          map[string]*models.Lease             `json:"leases,omitempty"`
+	CrawlJobs       map[string]*models.CrawlJob          `json:"crawl_jobs,omitempty"`
+	IdempotencyKeys map[string]*models.IdempotencyKey    `json:"idempotency_keys,omitempty"`
+	PendingAnalyses map[string]*models.PendingAnalysis   `json:"pending_analyses,omitempty"`
+	Embeddings      map[string]*models.PageEmbedding     `json:"embeddings,omitempty"`
+	APITokens       map[string]*models.APIToken          `json:"api_tokens,omitempty"`
+	JokeLabels      map[string]*models.JokeLabel         `json:"joke_labels,omitempty"`
+	AuditEvents     []*models.AuditEvent                 `json:"audit_events,omitempty"`
+	Boilerplate     map[string]*models.DomainBoilerplate `json:"boilerplate,omitempty"`
+	FetchErrors     map[string]*models.FetchError        `json:"fetch_errors,omitempty"`
+	FeedStates      map[string]*models.FeedState         `json:"feed_states,omitempty"`
+	FeedSources     map[string]*models.FeedSource        `json:"feed_sources,omitempty"`
+	LlmCalls        []*models.LlmCall                    `json:"llm_calls,omitempty"`
+	LlmBatches      map[string]*models.LlmBatch          `json:"llm_batches,omitempty"`
+	OutboxMessages  map[string]*models.OutboxMessage     `json:"outbox_messages,omitempty"`
+	EventsCursors   map[string]*models.EventsCursor      `json:"events_cursors,omitempty"`
+}
+
+// NewLocalDatastoreClient returns a LocalDatastoreClient kept in the JSON file at path, which is
+// created on the first change if it doesn't exist.
+func NewLocalDatastoreClient(path string) (*LocalDatastoreClient, error) {
+	client := &LocalDatastoreClient{
+		memoryStore: newMemoryStore(),
+		path:        path,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading local store: %w", err)
+	}
+	if len(data) > 0 {
+		var snapshot localSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("error reading local store %s: %w", path, err)
+		}
+		client.restore(&snapshot)
+	}
+
+	go client.flushPeriodically()
+	return client, nil
+}
+
+// restore replaces the entities of the client with those of snapshot, which aren't changes.
+func (l *LocalDatastoreClient) restore(snapshot *localSnapshot) {
+	m := l.memoryStore
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	restoreMap(m.Pages, snapshot.Pages)
+	restoreMap(m.AnalysisResults, snapshot.AnalysisResults)
+	restoreMap(m.Leases, snapshot.Leases)
+	restoreMap(m.CrawlJobs, snapshot.CrawlJobs)
+	restoreMap(m.IdempotencyKeys, snapshot.IdempotencyKeys)
+	restoreMap(m.PendingAnalyses, snapshot.PendingAnalyses)
+	restoreMap(m.Embeddings, snapshot.Embeddings)
+	restoreMap(m.APITokens, snapshot.APITokens)
+	restoreMap(m.JokeLabels, snapshot.JokeLabels)
+	restoreMap(m.Boilerplate, snapshot.Boilerplate)
+	restoreMap(m.FetchErrors, snapshot.FetchErrors)
+	restoreMap(m.FeedStates, snapshot.FeedStates)
+	restoreMap(m.FeedSources, snapshot.FeedSources)
+	restoreMap(m.LlmBatches, snapshot.LlmBatches)
+	restoreMap(m.OutboxMessages, snapshot.OutboxMessages)
+	restoreMap(m.EventsCursors, snapshot.EventsCursors)
+	m.AuditEvents = snapshot.AuditEvents
+	m.LlmCalls = snapshot.LlmCalls
+}
+
+// restoreMap copies the entities of from into to.
+func restoreMap[T any](to, from map[string]*T) {
+	for key, value := range from {
+		to[key] = value
+	}
+}
+
+// snapshot returns the entities of the client as the content of its file, and the number of
+// changes of the store they include. The store holds its own copies of the entities, which are
+// replaced rather than changed, so that encoding them can't race with their users.
+func (l *LocalDatastoreClient) snapshot() ([]byte, uint64, error) {
+	m := l.memoryStore
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, err := json.MarshalIndent(localSnapshot{
+		Pages:           m.Pages,
+		AnalysisResults: m.AnalysisResults,
+		Leases:          m.Leases,
+		CrawlJobs:       m.CrawlJobs,
+		IdempotencyKeys: m.IdempotencyKeys,
+		PendingAnalyses: m.PendingAnalyses,
+		Embeddings:      m.Embeddings,
+		APITokens:       m.APITokens,
+		JokeLabels:      m.JokeLabels,
+		AuditEvents:     m.AuditEvents,
+		Boilerplate:     m.Boilerplate,
+		FetchErrors:     m.FetchErrors,
+		FeedStates:      m.FeedStates,
+		FeedSources:     m.FeedSources,
+		LlmCalls:        m.LlmCalls,
+		LlmBatches:      m.LlmBatches,
+		OutboxMessages:  m.OutboxMessages,
+		EventsCursors:   m.EventsCursors,
+	}, "", " ")
+	return data, m.changes, err
+}
+
+// changed reports whether the store changed since the file was last written or read.
+func (l *LocalDatastoreClient) changed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.changes != l.saved
+}
+
+// Flush writes the entities of the client to its file if they changed since it was last
+// read or written. The file is replaced atomically.
+func (l *LocalDatastoreClient) Flush() error {
+	l.flushMu.Lock()
+	defer l.flushMu.Unlock()
+	if !l.changed() {
+		return nil
+	}
+	data, changes, err := l.snapshot()
+	if err != nil {
+		return fmt.Errorf("error encoding local store: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error writing local store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing local store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing local store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return fmt.Errorf("error writing local store: %w", err)
+	}
+	l.saved = changes
+	return nil
+}
+
+// flushPeriodically flushes the client every localStoreFlushInterval until it is closed.
+func (l *LocalDatastoreClient) flushPeriodically() {
+	defer close(l.done)
+	ticker := time.NewTicker(localStoreFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if err := l.Flush(); err != nil {
+				slog.Warn("Error flushing local store", "path", l.path, "error", err)
+			}
+		}
+	}
+}
+
+// Close stops the periodic flushes and writes the last changes to the file.
+func (l *LocalDatastoreClient) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.stop)
+		<-l.done
+		err = l.Flush()
+	})
+	return err
+}
@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/models"
+)
+
+func TestLocalDatastoreClient_PersistsEntities(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	client, err := NewLocalDatastoreClient(path)
+	if err != nil {
+		t.Fatalf("NewLocalDatastoreClient() error = %v", err)
+	}
+	crawled := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	if _, err := client.WriteCrawledPage(ctx, "example.com/a", "Title", "Content", crawled); err != nil {
+		t.Fatal(err)
+	}
+	percentage := 80
+	if err := client.WriteAnalysisResult(ctx, "example.com/a", &models.AnalysisResult{Mode: "joke", JokePercentage: &percentage}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AppendAuditEvent(ctx, &models.AuditEvent{URL: "example.com/a", Action: "analyzed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	reopened, err := NewLocalDatastoreClient(path)
+	if err != nil {
+		t.Fatalf("NewLocalDatastoreClient() error = %v", err)
+	}
+	defer reopened.Close()
+	page, found, err := reopened.ReadCrawledPage(ctx, "example.com/a")
+	if err != nil || !found || page.Title != "Title" || !page.DateTime.Equal(crawled) {
+		t.Errorf("ReadCrawledPage() = %+v, %v, %v, want the written page", page, found, err)
+	}
+	result, found, err := reopened.ReadAnalysisResult(ctx, "example.com/a", "joke")
+	if err != nil || !found || result.JokePercentage == nil || *result.JokePercentage != 80 {
+		t.Errorf("ReadAnalysisResult() = %+v, %v, %v, want the written result", result, found, err)
+	}
+	if events, err := reopened.ListAuditEvents(ctx, "example.com/a"); err != nil || len(events) != 1 {
+		t.Errorf("ListAuditEvents() = %v, %v, want 1 event", events, err)
+	}
+}
+
+func TestLocalDatastoreClient_Flush(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.json")
+	client, err := NewLocalDatastoreClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Nothing is written until something changes
+	if err := client.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Flush() created the store without changes: %v", err)
+	}
+
+	if _, err := client.WriteCrawledPage(ctx, "example.com/a", "Title", "Content", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Flush() didn't write the store: %v", err)
+	}
+
+	// An unchanged store isn't written again
+	os.Chtimes(path, time.Time{}, time.Unix(0, 0))
+	if err := client.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if again, _ := os.Stat(path); !again.ModTime().Equal(time.Unix(0, 0)) {
+		t.Error("Flush() rewrote an unchanged store")
+	}
+}
+
+func TestLocalDatastoreClient_FlushWhileInUse(t *testing.T) {
+	ctx := context.Background()
+	client, err := NewLocalDatastoreClient(filepath.Join(t.TempDir(), "store.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Pages keep being changed by their users after they are saved, while the store is written
+	page := &models.CrawledPage{URL: "example.com/a", Title: "Title"}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			page.Title = fmt.Sprintf("Title %d", i)
+			if err := client.SaveCrawledPage(ctx, page); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		if err := client.Flush(); err != nil {
+			t.Fatalf("Flush() error = %v", err)
+		}
+	}
+	<-done
+	if err := client.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if client.changed() {
+		t.Error("store still has changes after Flush()")
+	}
+}
+
+func TestNewLocalDatastoreClient_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewLocalDatastoreClient(path); err == nil {
+		t.Error("NewLocalDatastoreClient() error = nil, want an error for an invalid store")
+	}
+}
@@ -0,0 +1,186 @@
+// Package logging configures structured logging (log/slog) shared by the crawler and server binaries.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// LevelEnvVar names the environment variable holding the minimum log level
+	LevelEnvVar = "POISSON_LOG_LEVEL"
+	// FormatEnvVar names the environment variable holding the log format (text or json)
+	FormatEnvVar = "POISSON_LOG_FORMAT"
+)
+
+// Format selects how log records are written.
+type Format string
+
+const (
+	// FormatText writes key=value records, suited to terminals
+	FormatText Format = "text"
+	// FormatJSON writes one JSON object per record using the field names Cloud Logging expects
+	FormatJSON Format = "json"
+)
+
+// Options configures a logger.
+type Options struct {
+	Level  slog.Level
+	Format Format
+	// Writer receives the log output. Nil means os.Stderr.
+	Writer io.Writer
+}
+
+// ParseLevel converts a level name (debug, info, warn, error) to a slog.Level.
+// An empty string means info.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q (valid: debug, info, warn, error)", s)
+	}
+}
+
+// ParseFormat converts a format name to a Format.
+// An empty string means json when running on Cloud Run (K_SERVICE is set) and text otherwise.
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(strings.TrimSpace(s))) {
+	case "":
+		if os.Getenv("K_SERVICE") != "" {
+			return FormatJSON, nil
+		}
+		return FormatText, nil
+	case FormatText:
+		return FormatText, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	default:
+		return FormatText, fmt.Errorf("unknown log format %q (valid: text, json)", s)
+	}
+}
+
+// NewLogger creates a logger for opts. Attributes stored in the context with WithAttrs
+// are added to every record logged with a context.
+func NewLogger(opts Options) *slog.Logger {
+	w := opts.Writer
+	if w == nil {
+		w = os.Stderr
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: opts.Level}
+	var handler slog.Handler
+	if opts.Format == FormatJSON {
+		handlerOpts.ReplaceAttr = cloudLoggingAttr
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	} else {
+		handler = slog.NewTextHandler(w, handlerOpts)
+	}
+	return slog.New(contextHandler{handler})
+}
+
+// Init installs the default slog logger. level and format fall back to the
+// POISSON_LOG_LEVEL and POISSON_LOG_FORMAT environment variables when empty.
+// The standard log package keeps writing plain text, so CLI output printed with log.Printf is unchanged.
+func Init(level, format string) error {
+	if level == "" {
+		level = os.Getenv(LevelEnvVar)
+	}
+	if format == "" {
+		format = os.Getenv(FormatEnvVar)
+	}
+
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	f, err := ParseFormat(format)
+	if err != nil {
+		return err
+	}
+
+	flags := log.Flags()
+	slog.SetDefault(NewLogger(Options{Level: lvl, Format: f}))
+	// slog.SetDefault redirects the log package through the handler; restore it
+	log.SetOutput(os.Stderr)
+	log.SetFlags(flags)
+	return nil
+}
+
+type contextKey struct{}
+
+// WithAttrs returns a context carrying the given attributes (alternating keys and values,
+// as for slog.Logger.With). They are added to every record logged with the context.
+func WithAttrs(ctx context.Context, args ...any) context.Context {
+	existing, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	record := slog.NewRecord(time.Time{}, 0, "", 0)
+	record.Add(args...)
+
+	attrs := make([]slog.Attr, 0, len(existing)+record.NumAttrs())
+	attrs = append(attrs, existing...)
+	record.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, contextKey{}, attrs)
+}
+
+// contextHandler adds the attributes stored by WithAttrs to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		if attrs, ok := ctx.Value(contextKey{}).([]slog.Attr); ok {
+			r.AddAttrs(attrs...)
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// cloudLoggingAttr renames the level and message keys to the ones Cloud Logging
+// recognizes and maps levels to its severity names.
+func cloudLoggingAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.MessageKey:
+		a.Key = "message"
+	case slog.LevelKey:
+		a.Key = "severity"
+		level, _ := a.Value.Any().(slog.Level)
+		switch {
+		case level >= slog.LevelError:
+			a.Value = slog.StringValue("ERROR")
+		case level >= slog.LevelWarn:
+			a.Value = slog.StringValue("WARNING")
+		case level >= slog.LevelInfo:
+			a.Value = slog.StringValue("INFO")
+		default:
+			a.Value = slog.StringValue("DEBUG")
+		}
+	}
+	return a
+}
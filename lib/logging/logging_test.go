@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected slog.Level
+		wantErr  bool
+	}{
+		{input: "", expected: slog.LevelInfo},
+		{input: "debug", expected: slog.LevelDebug},
+		{input: "INFO", expected: slog.LevelInfo},
+		{input: "warning", expected: slog.LevelWarn},
+		{input: "error", expected: slog.LevelError},
+		{input: "loud", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			level, err := ParseLevel(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLevel(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && level != tt.expected {
+				t.Errorf("ParseLevel(%q) = %v, want %v", tt.input, level, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	t.Setenv("K_SERVICE", "")
+	if f, err := ParseFormat(""); err != nil || f != FormatText {
+		t.Errorf("ParseFormat(\"\") = %q, %v; want text", f, err)
+	}
+	if f, err := ParseFormat("JSON"); err != nil || f != FormatJSON {
+		t.Errorf("ParseFormat(\"JSON\") = %q, %v; want json", f, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("ParseFormat(\"xml\") expected error, got nil")
+	}
+
+	t.Setenv("K_SERVICE", "poisson-server")
+	if f, _ := ParseFormat(""); f != FormatJSON {
+		t.Errorf("ParseFormat(\"\") on Cloud Run = %q, want json", f)
+	}
+}
+
+func TestNewLogger_JSONWithContextAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(Options{Level: slog.LevelInfo, Format: FormatJSON, Writer: &buf})
+
+	ctx := WithAttrs(context.Background(), "url", "example.com/article")
+	ctx = WithAttrs(ctx, "mode", "joke")
+	logger.WarnContext(ctx, "cache write failed", "attempt", 2)
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("output is not JSON: %v (%s)", err, buf.String())
+	}
+
+	expected := map[string]any{
+		"severity": "WARNING",
+		"message":  "cache write failed",
+		"url":      "example.com/article",
+		"mode":     "joke",
+		"attempt":  float64(2),
+	}
+	for key, want := range expected {
+		if record[key] != want {
+			t.Errorf("record[%q] = %v, want %v", key, record[key], want)
+		}
+	}
+}
+
+func TestNewLogger_LevelFilter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(Options{Level: slog.LevelWarn, Format: FormatText, Writer: &buf})
+
+	logger.Info("hidden")
+	logger.Error("shown")
+
+	if strings.Contains(buf.String(), "hidden") {
+		t.Errorf("expected info record to be filtered, got: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "shown") {
+		t.Errorf("expected error record to be written, got: %s", buf.String())
+	}
+}
@@ -0,0 +1,809 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zeace/poisson/models"
+)
+
+// memoryStore implements the operations of DatastoreClient on entities kept in memory, for
+// MockDatastoreClient and LocalDatastoreClient. Entities are copied when they are stored and
+// when they are returned, so that like with Firestore, changing an entity after writing or
+// reading it changes neither the stored entity nor the entities read concurrently, and the
+// stored entities can be encoded while the store is in use.
+type memoryStore struct {
+	mu              sync.Mutex
+	Pages           map[string]*models.CrawledPage
+	AnalysisResults map[string]*models.AnalysisResult
+	Leases          map[string]*models.Lease
+	CrawlJobs       map[string]*models.CrawlJob
+	IdempotencyKeys map[string]*models.IdempotencyKey
+	PendingAnalyses map[string]*models.PendingAnalysis
+	Embeddings      map[string]*models.PageEmbedding
+	APITokens       map[string]*models.APIToken
+	JokeLabels      map[string]*models.JokeLabel
+	AuditEvents     []*models.AuditEvent
+	Boilerplate     map[string]*models.DomainBoilerplate
+	FetchErrors     map[string]*models.FetchError
+	FeedStates      map[string]*models.FeedState
+	FeedSources     map[string]*models.FeedSource
+	LlmCalls        []*models.LlmCall
+	LlmBatches      map[string]*models.LlmBatch
+	OutboxMessages  map[string]*models.OutboxMessage
+	EventsCursors   map[string]*models.EventsCursor
+
+	// changes counts the writes to the store, for LocalDatastoreClient to only save it after
+	// changes.
+	changes uint64
+}
+
+// newMemoryStore returns an empty memoryStore.
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		Pages:           make(map[string]*models.CrawledPage),
+		AnalysisResults: make(map[string]*models.AnalysisResult),
+		Leases:          make(map[string]*models.Lease),
+		CrawlJobs:       make(map[string]*models.CrawlJob),
+		IdempotencyKeys: make(map[string]*models.IdempotencyKey),
+		PendingAnalyses: make(map[string]*models.PendingAnalysis),
+		Embeddings:      make(map[string]*models.PageEmbedding),
+		APITokens:       make(map[string]*models.APIToken),
+		JokeLabels:      make(map[string]*models.JokeLabel),
+		Boilerplate:     make(map[string]*models.DomainBoilerplate),
+		FetchErrors:     make(map[string]*models.FetchError),
+		FeedStates:      make(map[string]*models.FeedState),
+		FeedSources:     make(map[string]*models.FeedSource),
+		LlmBatches:      make(map[string]*models.LlmBatch),
+		OutboxMessages:  make(map[string]*models.OutboxMessage),
+		EventsCursors:   make(map[string]*models.EventsCursor),
+	}
+}
+
+// copyCrawledPage returns a copy of page sharing no slice with it.
+func copyCrawledPage(page *models.CrawledPage) *models.CrawledPage {
+	pageCopy := *page
+	pageCopy.FeedItem.Categories = append([]string(nil), page.FeedItem.Categories...)
+	pageCopy.Fetch.Headers = append([]string(nil), page.Fetch.Headers...)
+	pageCopy.RedirectChain = append([]string(nil), page.RedirectChain...)
+	return &pageCopy
+}
+
+// copyAnalysisResult returns a copy of result sharing no pointer or slice with it, like
+// copyCrawledPage.
+func copyAnalysisResult(result *models.AnalysisResult) *models.AnalysisResult {
+	resultCopy := *result
+	if result.JokePercentage != nil {
+		percentage := *result.JokePercentage
+		resultCopy.JokePercentage = &percentage
+	}
+	if result.JokeReasoning != nil {
+		reasoning := *result.JokeReasoning
+		resultCopy.JokeReasoning = &reasoning
+	}
+	if result.Ensemble != nil {
+		ensemble := *result.Ensemble
+		ensemble.Runs = append([]models.EnsembleRun(nil), result.Ensemble.Runs...)
+		resultCopy.Ensemble = &ensemble
+	}
+	if result.Image != nil {
+		image := *result.Image
+		resultCopy.Image = &image
+	}
+	return &resultCopy
+}
+
+// copyPageEmbedding returns a copy of embedding sharing no slice with it.
+func copyPageEmbedding(embedding *models.PageEmbedding) *models.PageEmbedding {
+	embeddingCopy := *embedding
+	embeddingCopy.Vector = append([]float64(nil), embedding.Vector...)
+	return &embeddingCopy
+}
+
+// copyAPIToken returns a copy of token sharing no slice with it.
+func copyAPIToken(token *models.APIToken) *models.APIToken {
+	tokenCopy := *token
+	tokenCopy.Scopes = append([]models.APIScope(nil), token.Scopes...)
+	return &tokenCopy
+}
+
+// copyAuditEvent returns a copy of event sharing no pointer with it.
+func copyAuditEvent(event *models.AuditEvent) *models.AuditEvent {
+	eventCopy := *event
+	if event.JokePercentage != nil {
+		percentage := *event.JokePercentage
+		eventCopy.JokePercentage = &percentage
+	}
+	return &eventCopy
+}
+
+// copyFeedState returns a copy of state sharing no slice with it.
+func copyFeedState(state *models.FeedState) *models.FeedState {
+	stateCopy := *state
+	stateCopy.Items = nil
+	for _, item := range state.Items {
+		item.Categories = append([]string(nil), item.Categories...)
+		stateCopy.Items = append(stateCopy.Items, item)
+	}
+	return &stateCopy
+}
+
+// copyDomainBoilerplate returns a copy of profile sharing no slice with it.
+func copyDomainBoilerplate(profile *models.DomainBoilerplate) *models.DomainBoilerplate {
+	profileCopy := *profile
+	profileCopy.Segments = append([]models.SegmentCount(nil), profile.Segments...)
+	profileCopy.URLHashes = append([]int64(nil), profile.URLHashes...)
+	return &profileCopy
+}
+
+// copyOutboxMessage returns a copy of message sharing no slice with it.
+func copyOutboxMessage(message *models.OutboxMessage) *models.OutboxMessage {
+	messageCopy := *message
+	messageCopy.Payload = append([]byte(nil), message.Payload...)
+	return &messageCopy
+}
+
+func (m *memoryStore) ReadCrawledPage(ctx context.Context, url string) (*models.CrawledPage, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if page, exists := m.Pages[url]; exists {
+		return copyCrawledPage(page), true, nil
+	}
+	return nil, false, nil
+}
+
+func (m *memoryStore) WriteCrawledPage(ctx context.Context, url, title, content string, datetime time.Time) (*models.CrawledPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	page := &models.CrawledPage{
+		URL:      url,
+		Title:    title,
+		Content:  content,
+		DateTime: datetime,
+	}
+	m.Pages[url] = copyCrawledPage(page)
+	return page, nil
+}
+
+func (m *memoryStore) SaveCrawledPage(ctx context.Context, page *models.CrawledPage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	if page.DateTime.IsZero() {
+		page.DateTime = time.Now()
+	}
+	m.Pages[page.URL] = copyCrawledPage(page)
+	return nil
+}
+
+func (m *memoryStore) GetCrawledPagesSince(ctx context.Context, oldestDate time.Time) ([]models.CrawledPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pages []models.CrawledPage
+
+	for _, page := range m.Pages {
+		if !page.DateTime.IsZero() && !page.DateTime.Before(oldestDate) {
+			pages = append(pages, *copyCrawledPage(page))
+		}
+	}
+
+	return pages, nil
+}
+
+func (m *memoryStore) FindCrawledPagesByContentHash(ctx context.Context, contentHash string) ([]models.CrawledPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pages []models.CrawledPage
+	for _, page := range m.Pages {
+		if page.ContentHash == contentHash {
+			pages = append(pages, *copyCrawledPage(page))
+		}
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		if !pages[i].DateTime.Equal(pages[j].DateTime) {
+			return pages[i].DateTime.Before(pages[j].DateTime)
+		}
+		return pages[i].URL < pages[j].URL
+	})
+	return pages, nil
+}
+
+func (m *memoryStore) QueryCrawledPages(ctx context.Context, query models.CrawledPageQuery) ([]models.CrawledPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pages []models.CrawledPage
+	for _, page := range m.Pages {
+		if page.DateTime.IsZero() || page.DateTime.Before(query.Since) ||
+			(!query.Until.IsZero() && !page.DateTime.Before(query.Until)) ||
+			(query.Language != "" && page.Language != query.Language) ||
+			(query.After != nil && !crawledPageAfter(page, query.After)) {
+			continue
+		}
+		pages = append(pages, *copyCrawledPage(page))
+	}
+	sort.Slice(pages, func(i, j int) bool { return crawledPageAfter(&pages[j], &pages[i]) })
+	if query.Limit > 0 && len(pages) > query.Limit {
+		pages = pages[:query.Limit]
+	}
+	return pages, nil
+}
+
+// crawledPageAfter reports whether page comes after other in the order of QueryCrawledPages.
+func crawledPageAfter(page, other *models.CrawledPage) bool {
+	if !page.DateTime.Equal(other.DateTime) {
+		return page.DateTime.After(other.DateTime)
+	}
+	return UrlToCrawledPageKey(page.URL) > UrlToCrawledPageKey(other.URL)
+}
+
+func (m *memoryStore) ReadAnalysisResult(ctx context.Context, url string, mode models.AnalysisMode) (*models.AnalysisResult, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := UrlToAnalysisKey(url, mode)
+	if result, exists := m.AnalysisResults[key]; exists {
+		return copyAnalysisResult(result), true, nil
+	}
+	return nil, false, nil
+}
+
+func (m *memoryStore) WriteAnalysisResult(ctx context.Context, url string, result *models.AnalysisResult) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	key := UrlToAnalysisKey(url, result.Mode)
+	result.URL = url
+	m.AnalysisResults[key] = copyAnalysisResult(result)
+	return nil
+}
+
+func (m *memoryStore) ListAnalysisResults(ctx context.Context, mode models.AnalysisMode) ([]*models.AnalysisResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var results []*models.AnalysisResult
+	for key, result := range m.AnalysisResults {
+		if result.Mode != mode {
+			continue
+		}
+		result = copyAnalysisResult(result)
+		if result.URL == "" {
+			result.URL = analysisKeyToURL(key, mode)
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].URL < results[j].URL })
+	return results, nil
+}
+
+func (m *memoryStore) ListAnalysisResultsSince(
+	ctx context.Context,
+	mode models.AnalysisMode,
+	since time.Time,
+) ([]*models.AnalysisResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var results []*models.AnalysisResult
+	for key, result := range m.AnalysisResults {
+		if result.Mode != mode || !result.AnalyzedAt.After(since) {
+			continue
+		}
+		result = copyAnalysisResult(result)
+		if result.URL == "" {
+			result.URL = analysisKeyToURL(key, mode)
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].AnalyzedAt.Before(results[j].AnalyzedAt) })
+	return results, nil
+}
+
+func (m *memoryStore) FindAnalysisResultsByContentHash(
+	ctx context.Context,
+	contentHash string,
+	mode models.AnalysisMode,
+) ([]*models.AnalysisResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var results []*models.AnalysisResult
+	for key, result := range m.AnalysisResults {
+		if result.Mode != mode || result.ContentHash != contentHash {
+			continue
+		}
+		result = copyAnalysisResult(result)
+		if result.URL == "" {
+			result.URL = analysisKeyToURL(key, mode)
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].URL < results[j].URL })
+	return results, nil
+}
+
+func (m *memoryStore) DeleteAnalysisResult(ctx context.Context, url string, mode models.AnalysisMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	delete(m.AnalysisResults, UrlToAnalysisKey(url, mode))
+	return nil
+}
+
+func (m *memoryStore) ReadPageEmbedding(ctx context.Context, url string) (*models.PageEmbedding, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if embedding, exists := m.Embeddings[UrlToCrawledPageKey(url)]; exists {
+		return copyPageEmbedding(embedding), true, nil
+	}
+	return nil, false, nil
+}
+
+func (m *memoryStore) WritePageEmbedding(ctx context.Context, embedding *models.PageEmbedding) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	m.Embeddings[UrlToCrawledPageKey(embedding.URL)] = copyPageEmbedding(embedding)
+	return nil
+}
+
+func (m *memoryStore) ListPageEmbeddingsSince(ctx context.Context, since time.Time) ([]*models.PageEmbedding, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var embeddings []*models.PageEmbedding
+	for _, embedding := range m.Embeddings {
+		if !embedding.CreatedAt.Before(since) {
+			embeddings = append(embeddings, copyPageEmbedding(embedding))
+		}
+	}
+	sort.Slice(embeddings, func(i, j int) bool { return embeddings[i].URL < embeddings[j].URL })
+	return embeddings, nil
+}
+
+func (m *memoryStore) WritePendingAnalysis(ctx context.Context, pending *models.PendingAnalysis) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	pendingCopy := *pending
+	m.PendingAnalyses[UrlToAnalysisKey(pending.URL, pending.Mode)] = &pendingCopy
+	return nil
+}
+
+func (m *memoryStore) QueuePendingAnalysis(ctx context.Context, pending *models.PendingAnalysis) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := UrlToAnalysisKey(pending.URL, pending.Mode)
+	if existing, ok := m.PendingAnalyses[key]; ok && existing.BatchID != "" {
+		return false, nil
+	}
+	m.changes++
+	pendingCopy := *pending
+	m.PendingAnalyses[key] = &pendingCopy
+	return true, nil
+}
+
+func (m *memoryStore) ListPendingAnalyses(ctx context.Context) ([]*models.PendingAnalysis, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pending []*models.PendingAnalysis
+	for _, p := range m.PendingAnalyses {
+		pendingCopy := *p
+		pending = append(pending, &pendingCopy)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if !pending[i].CreatedAt.Equal(pending[j].CreatedAt) {
+			return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+		}
+		return pending[i].URL < pending[j].URL
+	})
+	return pending, nil
+}
+
+func (m *memoryStore) DeletePendingAnalysis(ctx context.Context, url string, mode models.AnalysisMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	delete(m.PendingAnalyses, UrlToAnalysisKey(url, mode))
+	return nil
+}
+
+func (m *memoryStore) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if lease, exists := m.Leases[name]; exists && lease.Holder != holder && !lease.Expired(now) {
+		return false, nil
+	}
+	m.Leases[name] = &models.Lease{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)}
+	m.changes++
+	return true, nil
+}
+
+func (m *memoryStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if lease, exists := m.Leases[name]; exists && lease.Holder == holder {
+		delete(m.Leases, name)
+		m.changes++
+	}
+	return nil
+}
+
+func (m *memoryStore) ReadCrawlJob(ctx context.Context, id string) (*models.CrawlJob, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if job, exists := m.CrawlJobs[id]; exists {
+		jobCopy := *job
+		return &jobCopy, true, nil
+	}
+	return nil, false, nil
+}
+
+func (m *memoryStore) WriteCrawlJob(ctx context.Context, job *models.CrawlJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	jobCopy := *job
+	m.CrawlJobs[job.ID] = &jobCopy
+	return nil
+}
+
+func (m *memoryStore) ClaimIdempotencyKey(
+	ctx context.Context,
+	record *models.IdempotencyKey,
+) (*models.IdempotencyKey, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, exists := m.IdempotencyKeys[record.Key]; exists && !existing.Expired(time.Now()) {
+		existingCopy := *existing
+		return &existingCopy, false, nil
+	}
+	recordCopy := *record
+	m.IdempotencyKeys[record.Key] = &recordCopy
+	m.changes++
+	return record, true, nil
+}
+
+func (m *memoryStore) ReleaseIdempotencyKey(ctx context.Context, key, jobID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, exists := m.IdempotencyKeys[key]; exists && existing.JobID == jobID {
+		delete(m.IdempotencyKeys, key)
+		m.changes++
+	}
+	return nil
+}
+
+func (m *memoryStore) ReadAPIToken(ctx context.Context, id string) (*models.APIToken, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if token, exists := m.APITokens[id]; exists {
+		return copyAPIToken(token), true, nil
+	}
+	return nil, false, nil
+}
+
+func (m *memoryStore) WriteAPIToken(ctx context.Context, token *models.APIToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	m.APITokens[token.ID] = copyAPIToken(token)
+	return nil
+}
+
+func (m *memoryStore) ListAPITokens(ctx context.Context) ([]*models.APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tokens := make([]*models.APIToken, 0, len(m.APITokens))
+	for _, token := range m.APITokens {
+		tokens = append(tokens, copyAPIToken(token))
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens, nil
+}
+
+func (m *memoryStore) RecordAPITokenRequest(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, exists := m.APITokens[id]
+	if !exists {
+		return fmt.Errorf("no API token %q", id)
+	}
+	token.RequestCount++
+	token.LastUsedAt = at
+	m.changes++
+	return nil
+}
+
+func (m *memoryStore) WriteJokeLabel(ctx context.Context, label *models.JokeLabel) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	labelCopy := *label
+	m.JokeLabels[UrlToCrawledPageKey(label.URL)] = &labelCopy
+	return nil
+}
+
+func (m *memoryStore) ListJokeLabels(ctx context.Context) ([]*models.JokeLabel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	labels := make([]*models.JokeLabel, 0, len(m.JokeLabels))
+	for _, label := range m.JokeLabels {
+		labelCopy := *label
+		labels = append(labels, &labelCopy)
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].CreatedAt.Before(labels[j].CreatedAt) })
+	return labels, nil
+}
+
+func (m *memoryStore) AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	m.AuditEvents = append(m.AuditEvents, copyAuditEvent(event))
+	return nil
+}
+
+func (m *memoryStore) ListAuditEvents(ctx context.Context, url string) ([]*models.AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []*models.AuditEvent
+	for _, event := range m.AuditEvents {
+		if event.URL == url {
+			events = append(events, copyAuditEvent(event))
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].CreatedAt.Before(events[j].CreatedAt) })
+	return events, nil
+}
+
+func (m *memoryStore) ReadDomainBoilerplate(ctx context.Context, host string) (*models.DomainBoilerplate, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if profile, exists := m.Boilerplate[host]; exists {
+		return copyDomainBoilerplate(profile), true, nil
+	}
+	return nil, false, nil
+}
+
+func (m *memoryStore) WriteDomainBoilerplate(ctx context.Context, profile *models.DomainBoilerplate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	m.Boilerplate[profile.Host] = copyDomainBoilerplate(profile)
+	return nil
+}
+
+func (m *memoryStore) UpdateDomainBoilerplate(ctx context.Context, host string, update func(profile *models.DomainBoilerplate)) (*models.DomainBoilerplate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	previous := &models.DomainBoilerplate{Host: host}
+	if profile, exists := m.Boilerplate[host]; exists {
+		previous = copyDomainBoilerplate(profile)
+	}
+	updated := copyDomainBoilerplate(previous)
+	update(updated)
+	m.changes++
+	m.Boilerplate[host] = copyDomainBoilerplate(updated)
+	return previous, nil
+}
+
+func (m *memoryStore) ReadFetchError(ctx context.Context, url string) (*models.FetchError, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if failure, exists := m.FetchErrors[url]; exists {
+		failureCopy := *failure
+		return &failureCopy, true, nil
+	}
+	return nil, false, nil
+}
+
+func (m *memoryStore) WriteFetchError(ctx context.Context, failure *models.FetchError) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	failureCopy := *failure
+	m.FetchErrors[failure.URL] = &failureCopy
+	return nil
+}
+
+func (m *memoryStore) DeleteFetchError(ctx context.Context, url string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	delete(m.FetchErrors, url)
+	return nil
+}
+
+func (m *memoryStore) ReadFeedState(ctx context.Context, url string) (*models.FeedState, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if state, exists := m.FeedStates[url]; exists {
+		return copyFeedState(state), true, nil
+	}
+	return nil, false, nil
+}
+
+func (m *memoryStore) WriteFeedState(ctx context.Context, state *models.FeedState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	m.FeedStates[state.URL] = copyFeedState(state)
+	return nil
+}
+
+func (m *memoryStore) AddFeedSource(ctx context.Context, feed *models.FeedSource) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := NormalizeURL(feed.URL)
+	if _, exists := m.FeedSources[key]; exists {
+		return false, nil
+	}
+	feedCopy := *feed
+	feedCopy.Modes = append([]models.AnalysisMode(nil), feed.Modes...)
+	m.FeedSources[key] = &feedCopy
+	m.changes++
+	return true, nil
+}
+
+func (m *memoryStore) ReadFeedSource(ctx context.Context, url string) (*models.FeedSource, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if feed, exists := m.FeedSources[NormalizeURL(url)]; exists {
+		feedCopy := *feed
+		feedCopy.Modes = append([]models.AnalysisMode(nil), feed.Modes...)
+		return &feedCopy, true, nil
+	}
+	return nil, false, nil
+}
+
+func (m *memoryStore) ListFeedSources(ctx context.Context) ([]*models.FeedSource, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	feeds := make([]*models.FeedSource, 0, len(m.FeedSources))
+	for _, feed := range m.FeedSources {
+		feedCopy := *feed
+		feedCopy.Modes = append([]models.AnalysisMode(nil), feed.Modes...)
+		feeds = append(feeds, &feedCopy)
+	}
+	sort.Slice(feeds, func(i, j int) bool { return feeds[i].URL < feeds[j].URL })
+	return feeds, nil
+}
+
+func (m *memoryStore) UpdateFeedSource(ctx context.Context, url string, update func(feed *models.FeedSource)) (*models.FeedSource, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := NormalizeURL(url)
+	feed, exists := m.FeedSources[key]
+	if !exists {
+		return nil, false, nil
+	}
+	m.changes++
+	updated := *feed
+	updated.Modes = append([]models.AnalysisMode(nil), feed.Modes...)
+	update(&updated)
+	stored := updated
+	stored.Modes = append([]models.AnalysisMode(nil), updated.Modes...)
+	m.FeedSources[key] = &stored
+	return &updated, true, nil
+}
+
+func (m *memoryStore) DeleteFeedSource(ctx context.Context, url string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	delete(m.FeedSources, NormalizeURL(url))
+	return nil
+}
+
+func (m *memoryStore) AppendLlmCall(ctx context.Context, call *models.LlmCall) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	callCopy := *call
+	m.LlmCalls = append(m.LlmCalls, &callCopy)
+	return nil
+}
+
+func (m *memoryStore) ListLlmCalls(ctx context.Context, url string) ([]*models.LlmCall, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var calls []*models.LlmCall
+	for _, call := range m.LlmCalls {
+		if call.URL == url {
+			callCopy := *call
+			calls = append(calls, &callCopy)
+		}
+	}
+	sort.SliceStable(calls, func(i, j int) bool { return calls[i].CreatedAt.Before(calls[j].CreatedAt) })
+	return calls, nil
+}
+
+func (m *memoryStore) DeleteLlmCallsBefore(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.LlmCalls[:0]
+	for _, call := range m.LlmCalls {
+		if !call.CreatedAt.Before(before) {
+			kept = append(kept, call)
+		}
+	}
+	deleted := len(m.LlmCalls) - len(kept)
+	m.LlmCalls = kept
+	if deleted > 0 {
+		m.changes++
+	}
+	return deleted, nil
+}
+
+func (m *memoryStore) WriteLlmBatch(ctx context.Context, batch *models.LlmBatch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	batchCopy := *batch
+	m.LlmBatches[batch.ID] = &batchCopy
+	return nil
+}
+
+func (m *memoryStore) ListLlmBatches(ctx context.Context) ([]*models.LlmBatch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	batches := make([]*models.LlmBatch, 0, len(m.LlmBatches))
+	for _, batch := range m.LlmBatches {
+		batchCopy := *batch
+		batches = append(batches, &batchCopy)
+	}
+	sort.Slice(batches, func(i, j int) bool { return batches[i].CreatedAt.Before(batches[j].CreatedAt) })
+	return batches, nil
+}
+
+func (m *memoryStore) CreateOutboxMessage(ctx context.Context, message *models.OutboxMessage) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.OutboxMessages[message.ID]; exists {
+		return false, nil
+	}
+	m.OutboxMessages[message.ID] = copyOutboxMessage(message)
+	m.changes++
+	return true, nil
+}
+
+func (m *memoryStore) WriteOutboxMessage(ctx context.Context, message *models.OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	m.OutboxMessages[message.ID] = copyOutboxMessage(message)
+	return nil
+}
+
+func (m *memoryStore) ListDueOutboxMessages(ctx context.Context, before time.Time) ([]*models.OutboxMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var messages []*models.OutboxMessage
+	for _, message := range m.OutboxMessages {
+		if message.Status == models.OutboxStatusPending && !message.NextAttemptAt.After(before) {
+			messages = append(messages, copyOutboxMessage(message))
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].NextAttemptAt.Before(messages[j].NextAttemptAt) })
+	return messages, nil
+}
+
+func (m *memoryStore) ReadEventsCursor(ctx context.Context, mode models.AnalysisMode) (*models.EventsCursor, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cursor, exists := m.EventsCursors[string(mode)]; exists {
+		cursorCopy := *cursor
+		return &cursorCopy, true, nil
+	}
+	return nil, false, nil
+}
+
+func (m *memoryStore) WriteEventsCursor(ctx context.Context, cursor *models.EventsCursor) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes++
+	cursorCopy := *cursor
+	m.EventsCursors[string(cursor.Mode)] = &cursorCopy
+	return nil
+}
@@ -0,0 +1,47 @@
+//go:build nocloud
+
+package lib
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+)
+
+// The nocloud build leaves out Firestore, Cloud Storage and the embedded credentials, so that
+// the binaries only keep their data in a local store and have no Google Cloud dependency.
+
+// ErrNoCloud is returned by the operations that need Google Cloud in the nocloud build.
+var ErrNoCloud = errors.New("not available in the nocloud build")
+
+// defaultLocalStore is the local store used when POISSON_LOCAL_STORE is unset.
+const defaultLocalStore = "poisson-store.json"
+
+// secretsFS is empty: the nocloud build embeds no credentials.
+var secretsFS embed.FS
+
+// createCloudDatastoreClient fails with ErrNoCloud.
+func createCloudDatastoreClient(ctx context.Context) (DatastoreClient, error) {
+	return nil, fmt.Errorf("error creating Firestore client: %w", ErrNoCloud)
+}
+
+// ReadGCSObject fails with ErrNoCloud.
+func ReadGCSObject(ctx context.Context, bucket, object string) ([]byte, bool, error) {
+	return nil, false, fmt.Errorf("error reading gs://%s/%s: %w", bucket, object, ErrNoCloud)
+}
+
+// WriteGCSObject fails with ErrNoCloud.
+func WriteGCSObject(ctx context.Context, bucket, object string, data []byte) error {
+	return fmt.Errorf("error writing gs://%s/%s: %w", bucket, object, ErrNoCloud)
+}
+
+// DeleteGCSObject fails with ErrNoCloud.
+func DeleteGCSObject(ctx context.Context, bucket, object string) error {
+	return fmt.Errorf("error deleting gs://%s/%s: %w", bucket, object, ErrNoCloud)
+}
+
+// ListGCSObjects fails with ErrNoCloud.
+func ListGCSObjects(ctx context.Context, bucket, prefix string) ([]GCSObjectInfo, error) {
+	return nil, fmt.Errorf("error listing gs://%s/%s: %w", bucket, prefix, ErrNoCloud)
+}
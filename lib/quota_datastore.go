@@ -0,0 +1,528 @@
+//go:build !nocloud
+
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zeace/poisson/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultQuotaMaxWait is how long an operation waits for the datastore quota to be available
+	// again before failing with ErrQuotaExhausted.
+	DefaultQuotaMaxWait = 15 * time.Minute
+	// minQuotaPause and maxQuotaPause bound the pause after the quota was exhausted, which doubles
+	// each time it is still exhausted after a pause.
+	minQuotaPause = 30 * time.Second
+	maxQuotaPause = 5 * time.Minute
+	// QuotaExhaustedAlert is the alert attribute of the log of an exhausted quota, for log-based
+	// metrics and alerting policies.
+	QuotaExhaustedAlert = "firestore_quota_exhausted"
+)
+
+// ErrQuotaExhausted is returned by a QuotaDatastoreClient operation that couldn't run within
+// its maximum wait because the datastore quota was exhausted.
+var ErrQuotaExhausted = errors.New("datastore quota exhausted")
+
+// QuotaDatastoreClient pauses every operation of a backend whose quota was exhausted, instead
+// of letting each one fail. When an operation fails with RESOURCE_EXHAUSTED, all operations
+// wait for a pause, then the failed one is retried; the pause doubles while the quota is still
+// exhausted, and the client resumes as soon as an operation succeeds. An operation that would
+// wait longer than maxWait fails with ErrQuotaExhausted.
+type QuotaDatastoreClient struct {
+	client   DatastoreClient
+	maxWait  time.Duration
+	minPause time.Duration
+	maxPause time.Duration
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+	pause       time.Duration
+	// throttled is true from an exhausted quota until the next successful operation.
+	throttled atomic.Bool
+
+	exhaustions atomic.Int64
+	pauses      atomic.Int64
+}
+
+// QuotaStats counts the exhausted quota errors a QuotaDatastoreClient got and the pauses they
+// caused.
+type QuotaStats struct {
+	Exhaustions int64
+	Pauses      int64
+}
+
+// NewQuotaDatastoreClient returns a client that sends every operation to client, pausing them
+// while its quota is exhausted. A non-positive maxWait means DefaultQuotaMaxWait.
+func NewQuotaDatastoreClient(client DatastoreClient, maxWait time.Duration) *QuotaDatastoreClient {
+	if maxWait <= 0 {
+		maxWait = DefaultQuotaMaxWait
+	}
+	return &QuotaDatastoreClient{client: client, maxWait: maxWait, minPause: minQuotaPause, maxPause: maxQuotaPause}
+}
+
+// Stats returns the number of exhausted quota errors and pauses so far.
+func (q *QuotaDatastoreClient) Stats() QuotaStats {
+	return QuotaStats{Exhaustions: q.exhaustions.Load(), Pauses: q.pauses.Load()}
+}
+
+// quotaWrite runs call once the client isn't paused, and again after a pause each time it fails
+// with an exhausted quota.
+func (q *QuotaDatastoreClient) quotaWrite(ctx context.Context, op string, call func() error) error {
+	deadline := time.Now().Add(q.maxWait)
+	for {
+		if err := q.wait(ctx, op, deadline); err != nil {
+			return err
+		}
+		err := call()
+		if status.Code(err) != codes.ResourceExhausted {
+			if err == nil {
+				q.resume(ctx)
+			}
+			return err
+		}
+		q.exhausted(ctx, op, err)
+	}
+}
+
+// quotaRead is quotaWrite for operations with a result.
+func quotaRead[T any](ctx context.Context, q *QuotaDatastoreClient, op string, call func() (T, error)) (T, error) {
+	var result T
+	err := q.quotaWrite(ctx, op, func() error {
+		var err error
+		result, err = call()
+		return err
+	})
+	return result, err
+}
+
+// quotaFind is quotaRead for reads of a single entity that may not exist.
+func quotaFind[T any](ctx context.Context, q *QuotaDatastoreClient, op string, call func() (T, bool, error)) (T, bool, error) {
+	result, err := quotaRead(ctx, q, op, func() (lookup[T], error) {
+		value, found, err := call()
+		return lookup[T]{Value: value, Found: found}, err
+	})
+	return result.Value, result.Found, err
+}
+
+// wait blocks until the client isn't paused. It fails with ErrQuotaExhausted if the pause ends
+// after deadline.
+func (q *QuotaDatastoreClient) wait(ctx context.Context, op string, deadline time.Time) error {
+	q.mu.Lock()
+	pausedUntil := q.pausedUntil
+	q.mu.Unlock()
+
+	delay := time.Until(pausedUntil)
+	if delay <= 0 {
+		return nil
+	}
+	if pausedUntil.After(deadline) {
+		return fmt.Errorf("%s: %w (paused until %s)", op, ErrQuotaExhausted, pausedUntil.Format(time.RFC3339))
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// exhausted records an exhausted quota error and pauses the client, unless it was already
+// paused by another operation.
+func (q *QuotaDatastoreClient) exhausted(ctx context.Context, op string, err error) {
+	q.exhaustions.Add(1)
+	q.throttled.Store(true)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	if now.Before(q.pausedUntil) {
+		return
+	}
+	q.pause = min(max(2*q.pause, q.minPause), q.maxPause)
+	q.pausedUntil = now.Add(q.pause)
+	q.pauses.Add(1)
+	slog.ErrorContext(ctx, "Datastore quota exhausted, pausing datastore operations",
+		"alert", QuotaExhaustedAlert, "operation", op, "pause", q.pause, "error", err)
+}
+
+// resume resets the pause after an operation succeeded while the client was throttled.
+func (q *QuotaDatastoreClient) resume(ctx context.Context) {
+	if !q.throttled.CompareAndSwap(true, false) {
+		return
+	}
+	q.mu.Lock()
+	q.pause = 0
+	q.mu.Unlock()
+	slog.InfoContext(ctx, "Datastore quota available again, resuming datastore operations")
+}
+
+func (q *QuotaDatastoreClient) ReadCrawledPage(ctx context.Context, url string) (*models.CrawledPage, bool, error) {
+	return quotaFind(ctx, q, "ReadCrawledPage", func() (*models.CrawledPage, bool, error) {
+		return q.client.ReadCrawledPage(ctx, url)
+	})
+}
+
+func (q *QuotaDatastoreClient) WriteCrawledPage(ctx context.Context, url, title, content string, datetime time.Time) (*models.CrawledPage, error) {
+	return quotaRead(ctx, q, "WriteCrawledPage", func() (*models.CrawledPage, error) {
+		return q.client.WriteCrawledPage(ctx, url, title, content, datetime)
+	})
+}
+
+func (q *QuotaDatastoreClient) SaveCrawledPage(ctx context.Context, page *models.CrawledPage) error {
+	return q.quotaWrite(ctx, "SaveCrawledPage", func() error {
+		return q.client.SaveCrawledPage(ctx, page)
+	})
+}
+
+func (q *QuotaDatastoreClient) GetCrawledPagesSince(ctx context.Context, oldestDate time.Time) ([]models.CrawledPage, error) {
+	return quotaRead(ctx, q, "GetCrawledPagesSince", func() ([]models.CrawledPage, error) {
+		return q.client.GetCrawledPagesSince(ctx, oldestDate)
+	})
+}
+
+func (q *QuotaDatastoreClient) FindCrawledPagesByContentHash(ctx context.Context, contentHash string) ([]models.CrawledPage, error) {
+	return quotaRead(ctx, q, "FindCrawledPagesByContentHash", func() ([]models.CrawledPage, error) {
+		return q.client.FindCrawledPagesByContentHash(ctx, contentHash)
+	})
+}
+
+func (q *QuotaDatastoreClient) QueryCrawledPages(ctx context.Context, query models.CrawledPageQuery) ([]models.CrawledPage, error) {
+	return quotaRead(ctx, q, "QueryCrawledPages", func() ([]models.CrawledPage, error) {
+		return q.client.QueryCrawledPages(ctx, query)
+	})
+}
+
+func (q *QuotaDatastoreClient) ReadAnalysisResult(
+	ctx context.Context,
+	url string,
+	mode models.AnalysisMode,
+) (*models.AnalysisResult, bool, error) {
+	return quotaFind(ctx, q, "ReadAnalysisResult", func() (*models.AnalysisResult, bool, error) {
+		return q.client.ReadAnalysisResult(ctx, url, mode)
+	})
+}
+
+func (q *QuotaDatastoreClient) WriteAnalysisResult(ctx context.Context, url string, result *models.AnalysisResult) error {
+	return q.quotaWrite(ctx, "WriteAnalysisResult", func() error {
+		return q.client.WriteAnalysisResult(ctx, url, result)
+	})
+}
+
+func (q *QuotaDatastoreClient) ListAnalysisResults(ctx context.Context, mode models.AnalysisMode) ([]*models.AnalysisResult, error) {
+	return quotaRead(ctx, q, "ListAnalysisResults", func() ([]*models.AnalysisResult, error) {
+		return q.client.ListAnalysisResults(ctx, mode)
+	})
+}
+
+func (q *QuotaDatastoreClient) DeleteAnalysisResult(ctx context.Context, url string, mode models.AnalysisMode) error {
+	return q.quotaWrite(ctx, "DeleteAnalysisResult", func() error {
+		return q.client.DeleteAnalysisResult(ctx, url, mode)
+	})
+}
+
+func (q *QuotaDatastoreClient) ListAnalysisResultsSince(
+	ctx context.Context,
+	mode models.AnalysisMode,
+	since time.Time,
+) ([]*models.AnalysisResult, error) {
+	return quotaRead(ctx, q, "ListAnalysisResultsSince", func() ([]*models.AnalysisResult, error) {
+		return q.client.ListAnalysisResultsSince(ctx, mode, since)
+	})
+}
+
+func (q *QuotaDatastoreClient) FindAnalysisResultsByContentHash(
+	ctx context.Context,
+	contentHash string,
+	mode models.AnalysisMode,
+) ([]*models.AnalysisResult, error) {
+	return quotaRead(ctx, q, "FindAnalysisResultsByContentHash", func() ([]*models.AnalysisResult, error) {
+		return q.client.FindAnalysisResultsByContentHash(ctx, contentHash, mode)
+	})
+}
+
+func (q *QuotaDatastoreClient) ReadPageEmbedding(ctx context.Context, url string) (*models.PageEmbedding, bool, error) {
+	return quotaFind(ctx, q, "ReadPageEmbedding", func() (*models.PageEmbedding, bool, error) {
+		return q.client.ReadPageEmbedding(ctx, url)
+	})
+}
+
+func (q *QuotaDatastoreClient) WritePageEmbedding(ctx context.Context, embedding *models.PageEmbedding) error {
+	return q.quotaWrite(ctx, "WritePageEmbedding", func() error {
+		return q.client.WritePageEmbedding(ctx, embedding)
+	})
+}
+
+func (q *QuotaDatastoreClient) ListPageEmbeddingsSince(ctx context.Context, since time.Time) ([]*models.PageEmbedding, error) {
+	return quotaRead(ctx, q, "ListPageEmbeddingsSince", func() ([]*models.PageEmbedding, error) {
+		return q.client.ListPageEmbeddingsSince(ctx, since)
+	})
+}
+
+func (q *QuotaDatastoreClient) WritePendingAnalysis(ctx context.Context, pending *models.PendingAnalysis) error {
+	return q.quotaWrite(ctx, "WritePendingAnalysis", func() error {
+		return q.client.WritePendingAnalysis(ctx, pending)
+	})
+}
+
+func (q *QuotaDatastoreClient) QueuePendingAnalysis(ctx context.Context, pending *models.PendingAnalysis) (bool, error) {
+	return quotaRead(ctx, q, "QueuePendingAnalysis", func() (bool, error) {
+		return q.client.QueuePendingAnalysis(ctx, pending)
+	})
+}
+
+func (q *QuotaDatastoreClient) ListPendingAnalyses(ctx context.Context) ([]*models.PendingAnalysis, error) {
+	return quotaRead(ctx, q, "ListPendingAnalyses", func() ([]*models.PendingAnalysis, error) {
+		return q.client.ListPendingAnalyses(ctx)
+	})
+}
+
+func (q *QuotaDatastoreClient) DeletePendingAnalysis(ctx context.Context, url string, mode models.AnalysisMode) error {
+	return q.quotaWrite(ctx, "DeletePendingAnalysis", func() error {
+		return q.client.DeletePendingAnalysis(ctx, url, mode)
+	})
+}
+
+func (q *QuotaDatastoreClient) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	return quotaRead(ctx, q, "AcquireLease", func() (bool, error) {
+		return q.client.AcquireLease(ctx, name, holder, ttl)
+	})
+}
+
+func (q *QuotaDatastoreClient) ReleaseLease(ctx context.Context, name, holder string) error {
+	return q.quotaWrite(ctx, "ReleaseLease", func() error {
+		return q.client.ReleaseLease(ctx, name, holder)
+	})
+}
+
+func (q *QuotaDatastoreClient) ReadCrawlJob(ctx context.Context, id string) (*models.CrawlJob, bool, error) {
+	return quotaFind(ctx, q, "ReadCrawlJob", func() (*models.CrawlJob, bool, error) {
+		return q.client.ReadCrawlJob(ctx, id)
+	})
+}
+
+func (q *QuotaDatastoreClient) WriteCrawlJob(ctx context.Context, job *models.CrawlJob) error {
+	return q.quotaWrite(ctx, "WriteCrawlJob", func() error {
+		return q.client.WriteCrawlJob(ctx, job)
+	})
+}
+
+func (q *QuotaDatastoreClient) ClaimIdempotencyKey(
+	ctx context.Context,
+	record *models.IdempotencyKey,
+) (*models.IdempotencyKey, bool, error) {
+	return quotaFind(ctx, q, "ClaimIdempotencyKey", func() (*models.IdempotencyKey, bool, error) {
+		return q.client.ClaimIdempotencyKey(ctx, record)
+	})
+}
+
+func (q *QuotaDatastoreClient) ReleaseIdempotencyKey(ctx context.Context, key, jobID string) error {
+	return q.quotaWrite(ctx, "ReleaseIdempotencyKey", func() error {
+		return q.client.ReleaseIdempotencyKey(ctx, key, jobID)
+	})
+}
+
+func (q *QuotaDatastoreClient) ReadAPIToken(ctx context.Context, id string) (*models.APIToken, bool, error) {
+	return quotaFind(ctx, q, "ReadAPIToken", func() (*models.APIToken, bool, error) {
+		return q.client.ReadAPIToken(ctx, id)
+	})
+}
+
+func (q *QuotaDatastoreClient) WriteAPIToken(ctx context.Context, token *models.APIToken) error {
+	return q.quotaWrite(ctx, "WriteAPIToken", func() error {
+		return q.client.WriteAPIToken(ctx, token)
+	})
+}
+
+func (q *QuotaDatastoreClient) ListAPITokens(ctx context.Context) ([]*models.APIToken, error) {
+	return quotaRead(ctx, q, "ListAPITokens", func() ([]*models.APIToken, error) {
+		return q.client.ListAPITokens(ctx)
+	})
+}
+
+func (q *QuotaDatastoreClient) RecordAPITokenRequest(ctx context.Context, id string, at time.Time) error {
+	return q.quotaWrite(ctx, "RecordAPITokenRequest", func() error {
+		return q.client.RecordAPITokenRequest(ctx, id, at)
+	})
+}
+
+func (q *QuotaDatastoreClient) WriteJokeLabel(ctx context.Context, label *models.JokeLabel) error {
+	return q.quotaWrite(ctx, "WriteJokeLabel", func() error {
+		return q.client.WriteJokeLabel(ctx, label)
+	})
+}
+
+func (q *QuotaDatastoreClient) ListJokeLabels(ctx context.Context) ([]*models.JokeLabel, error) {
+	return quotaRead(ctx, q, "ListJokeLabels", func() ([]*models.JokeLabel, error) {
+		return q.client.ListJokeLabels(ctx)
+	})
+}
+
+func (q *QuotaDatastoreClient) AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	return q.quotaWrite(ctx, "AppendAuditEvent", func() error {
+		return q.client.AppendAuditEvent(ctx, event)
+	})
+}
+
+func (q *QuotaDatastoreClient) ListAuditEvents(ctx context.Context, url string) ([]*models.AuditEvent, error) {
+	return quotaRead(ctx, q, "ListAuditEvents", func() ([]*models.AuditEvent, error) {
+		return q.client.ListAuditEvents(ctx, url)
+	})
+}
+
+func (q *QuotaDatastoreClient) ReadDomainBoilerplate(ctx context.Context, host string) (*models.DomainBoilerplate, bool, error) {
+	return quotaFind(ctx, q, "ReadDomainBoilerplate", func() (*models.DomainBoilerplate, bool, error) {
+		return q.client.ReadDomainBoilerplate(ctx, host)
+	})
+}
+
+func (q *QuotaDatastoreClient) WriteDomainBoilerplate(ctx context.Context, profile *models.DomainBoilerplate) error {
+	return q.quotaWrite(ctx, "WriteDomainBoilerplate", func() error {
+		return q.client.WriteDomainBoilerplate(ctx, profile)
+	})
+}
+
+func (q *QuotaDatastoreClient) UpdateDomainBoilerplate(ctx context.Context, host string, update func(profile *models.DomainBoilerplate)) (*models.DomainBoilerplate, error) {
+	return quotaRead(ctx, q, "UpdateDomainBoilerplate", func() (*models.DomainBoilerplate, error) {
+		return q.client.UpdateDomainBoilerplate(ctx, host, update)
+	})
+}
+
+func (q *QuotaDatastoreClient) ReadFetchError(ctx context.Context, url string) (*models.FetchError, bool, error) {
+	return quotaFind(ctx, q, "ReadFetchError", func() (*models.FetchError, bool, error) {
+		return q.client.ReadFetchError(ctx, url)
+	})
+}
+
+func (q *QuotaDatastoreClient) WriteFetchError(ctx context.Context, failure *models.FetchError) error {
+	return q.quotaWrite(ctx, "WriteFetchError", func() error {
+		return q.client.WriteFetchError(ctx, failure)
+	})
+}
+
+func (q *QuotaDatastoreClient) DeleteFetchError(ctx context.Context, url string) error {
+	return q.quotaWrite(ctx, "DeleteFetchError", func() error {
+		return q.client.DeleteFetchError(ctx, url)
+	})
+}
+
+func (q *QuotaDatastoreClient) ReadFeedState(ctx context.Context, url string) (*models.FeedState, bool, error) {
+	return quotaFind(ctx, q, "ReadFeedState", func() (*models.FeedState, bool, error) {
+		return q.client.ReadFeedState(ctx, url)
+	})
+}
+
+func (q *QuotaDatastoreClient) WriteFeedState(ctx context.Context, state *models.FeedState) error {
+	return q.quotaWrite(ctx, "WriteFeedState", func() error {
+		return q.client.WriteFeedState(ctx, state)
+	})
+}
+
+func (q *QuotaDatastoreClient) AddFeedSource(ctx context.Context, feed *models.FeedSource) (bool, error) {
+	return quotaRead(ctx, q, "AddFeedSource", func() (bool, error) {
+		return q.client.AddFeedSource(ctx, feed)
+	})
+}
+
+func (q *QuotaDatastoreClient) ReadFeedSource(ctx context.Context, url string) (*models.FeedSource, bool, error) {
+	return quotaFind(ctx, q, "ReadFeedSource", func() (*models.FeedSource, bool, error) {
+		return q.client.ReadFeedSource(ctx, url)
+	})
+}
+
+func (q *QuotaDatastoreClient) ListFeedSources(ctx context.Context) ([]*models.FeedSource, error) {
+	return quotaRead(ctx, q, "ListFeedSources", func() ([]*models.FeedSource, error) {
+		return q.client.ListFeedSources(ctx)
+	})
+}
+
+func (q *QuotaDatastoreClient) UpdateFeedSource(ctx context.Context, url string, update func(feed *models.FeedSource)) (*models.FeedSource, bool, error) {
+	return quotaFind(ctx, q, "UpdateFeedSource", func() (*models.FeedSource, bool, error) {
+		return q.client.UpdateFeedSource(ctx, url, update)
+	})
+}
+
+func (q *QuotaDatastoreClient) DeleteFeedSource(ctx context.Context, url string) error {
+	return q.quotaWrite(ctx, "DeleteFeedSource", func() error {
+		return q.client.DeleteFeedSource(ctx, url)
+	})
+}
+
+func (q *QuotaDatastoreClient) AppendLlmCall(ctx context.Context, call *models.LlmCall) error {
+	return q.quotaWrite(ctx, "AppendLlmCall", func() error {
+		return q.client.AppendLlmCall(ctx, call)
+	})
+}
+
+func (q *QuotaDatastoreClient) ListLlmCalls(ctx context.Context, url string) ([]*models.LlmCall, error) {
+	return quotaRead(ctx, q, "ListLlmCalls", func() ([]*models.LlmCall, error) {
+		return q.client.ListLlmCalls(ctx, url)
+	})
+}
+
+func (q *QuotaDatastoreClient) DeleteLlmCallsBefore(ctx context.Context, before time.Time) (int, error) {
+	return quotaRead(ctx, q, "DeleteLlmCallsBefore", func() (int, error) {
+		return q.client.DeleteLlmCallsBefore(ctx, before)
+	})
+}
+
+func (q *QuotaDatastoreClient) WriteLlmBatch(ctx context.Context, batch *models.LlmBatch) error {
+	return q.quotaWrite(ctx, "WriteLlmBatch", func() error {
+		return q.client.WriteLlmBatch(ctx, batch)
+	})
+}
+
+func (q *QuotaDatastoreClient) ListLlmBatches(ctx context.Context) ([]*models.LlmBatch, error) {
+	return quotaRead(ctx, q, "ListLlmBatches", func() ([]*models.LlmBatch, error) {
+		return q.client.ListLlmBatches(ctx)
+	})
+}
+
+func (q *QuotaDatastoreClient) CreateOutboxMessage(ctx context.Context, message *models.OutboxMessage) (bool, error) {
+	return quotaRead(ctx, q, "CreateOutboxMessage", func() (bool, error) {
+		return q.client.CreateOutboxMessage(ctx, message)
+	})
+}
+
+func (q *QuotaDatastoreClient) WriteOutboxMessage(ctx context.Context, message *models.OutboxMessage) error {
+	return q.quotaWrite(ctx, "WriteOutboxMessage", func() error {
+		return q.client.WriteOutboxMessage(ctx, message)
+	})
+}
+
+func (q *QuotaDatastoreClient) ListDueOutboxMessages(ctx context.Context, before time.Time) ([]*models.OutboxMessage, error) {
+	return quotaRead(ctx, q, "ListDueOutboxMessages", func() ([]*models.OutboxMessage, error) {
+		return q.client.ListDueOutboxMessages(ctx, before)
+	})
+}
+
+func (q *QuotaDatastoreClient) ReadEventsCursor(ctx context.Context, mode models.AnalysisMode) (*models.EventsCursor, bool, error) {
+	return quotaFind(ctx, q, "ReadEventsCursor", func() (*models.EventsCursor, bool, error) {
+		return q.client.ReadEventsCursor(ctx, mode)
+	})
+}
+
+func (q *QuotaDatastoreClient) WriteEventsCursor(ctx context.Context, cursor *models.EventsCursor) error {
+	return q.quotaWrite(ctx, "WriteEventsCursor", func() error {
+		return q.client.WriteEventsCursor(ctx, cursor)
+	})
+}
+
+// Close logs the exhausted quota errors, if any, and closes the backend.
+func (q *QuotaDatastoreClient) Close() error {
+	if stats := q.Stats(); stats.Exhaustions > 0 {
+		slog.Warn("Datastore quota summary", "alert", QuotaExhaustedAlert, "exhaustions", stats.Exhaustions, "pauses", stats.Pauses)
+	}
+	return q.client.Close()
+}
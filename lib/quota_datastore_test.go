@@ -0,0 +1,108 @@
+//go:build !nocloud
+
+package lib
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// exhaustedDatastoreClient fails reads of crawled pages with an exhausted quota while
+// failures is positive.
+type exhaustedDatastoreClient struct {
+	*MockDatastoreClient
+	failures atomic.Int32
+	calls    atomic.Int32
+}
+
+func (c *exhaustedDatastoreClient) ReadCrawledPage(ctx context.Context, url string) (*models.CrawledPage, bool, error) {
+	c.calls.Add(1)
+	if c.failures.Add(-1) >= 0 {
+		return nil, false, status.Error(codes.ResourceExhausted, "quota exceeded")
+	}
+	return c.MockDatastoreClient.ReadCrawledPage(ctx, url)
+}
+
+// newTestQuotaClient returns a quota client over backend with short pauses.
+func newTestQuotaClient(backend DatastoreClient, maxWait time.Duration) *QuotaDatastoreClient {
+	client := NewQuotaDatastoreClient(backend, maxWait)
+	client.minPause = 10 * time.Millisecond
+	client.maxPause = 40 * time.Millisecond
+	return client
+}
+
+func TestQuotaDatastoreClient_Resumes(t *testing.T) {
+	ctx := context.Background()
+	backend := &exhaustedDatastoreClient{MockDatastoreClient: NewMockDatastoreClient()}
+	backend.WriteCrawledPage(ctx, "example.com/a", "Title", "Content", time.Time{})
+	client := newTestQuotaClient(backend, time.Second)
+
+	// Paused twice, then retried successfully
+	backend.failures.Store(2)
+	page, found, err := client.ReadCrawledPage(ctx, "example.com/a")
+	if err != nil || !found || page.Title != "Title" {
+		t.Fatalf("ReadCrawledPage() = %+v, %v, %v, want the page", page, found, err)
+	}
+	if stats := client.Stats(); stats.Exhaustions != 2 || stats.Pauses != 2 {
+		t.Errorf("Stats() = %+v, want 2 exhaustions and 2 pauses", stats)
+	}
+	if client.pause != 0 || client.throttled.Load() {
+		t.Errorf("pause = %v after a successful operation, want it reset", client.pause)
+	}
+
+	// Operations of other kinds wait for the pause too
+	backend.failures.Store(1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		client.ReadCrawledPage(ctx, "example.com/a")
+	}()
+	for client.Stats().Exhaustions < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	start := time.Now()
+	if err := client.WriteCrawlJob(ctx, &models.CrawlJob{ID: "job-1"}); err != nil {
+		t.Errorf("WriteCrawlJob() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Errorf("WriteCrawlJob() ran after %v, want it to wait for the pause", elapsed)
+	}
+	wg.Wait()
+}
+
+func TestQuotaDatastoreClient_MaxWait(t *testing.T) {
+	ctx := context.Background()
+	backend := &exhaustedDatastoreClient{MockDatastoreClient: NewMockDatastoreClient()}
+	backend.failures.Store(1000)
+	client := newTestQuotaClient(backend, 50*time.Millisecond)
+
+	_, _, err := client.ReadCrawledPage(ctx, "example.com/a")
+	if !errors.Is(err, ErrQuotaExhausted) {
+		t.Fatalf("ReadCrawledPage() error = %v, want ErrQuotaExhausted", err)
+	}
+	// Pauses of 10ms and 20ms fit in 50ms, but not the following one of 40ms
+	if calls := backend.calls.Load(); calls < 2 || calls > 4 {
+		t.Errorf("backend called %d time(s), want 2 to 4", calls)
+	}
+
+	// Other errors are returned as is, without pausing
+	pauses := client.Stats().Pauses
+	backend.failures.Store(0)
+	client.pausedUntil = time.Time{}
+	backend.GetError = errors.New("unavailable")
+	if _, _, err := client.ReadCrawledPage(ctx, "example.com/a"); err == nil || errors.Is(err, ErrQuotaExhausted) {
+		t.Errorf("ReadCrawledPage() error = %v, want the backend's error", err)
+	}
+	if stats := client.Stats(); stats.Pauses != pauses {
+		t.Errorf("Stats() = %+v after another error, want %d pause(s)", stats, pauses)
+	}
+}
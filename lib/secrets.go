@@ -1,13 +1,12 @@
 package lib
 
 import (
-	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
-//go:embed secrets/openai_key secrets/poisson-berkan-ace77ca9cd3c.json
-var secretsFS embed.FS
-
 // OpenAIKey returns the embedded OpenAI API key, trimmed of whitespace
 func OpenAIKey() string {
 	data, err := secretsFS.ReadFile("secrets/openai_key")
@@ -25,3 +24,24 @@ func GoogleKeyJSON() []byte {
 	}
 	return data
 }
+
+// ReadSecret returns the secret with the given name from the following sources in order:
+// 1. POISSON_SECRET_<NAME> environment variable, with the name uppercased and - and . replaced by _
+// 2. The file <name> in the directory set by POISSON_SECRETS_DIR (e.g. a mounted Secret Manager volume)
+// The value is trimmed of whitespace.
+func ReadSecret(name string) (string, error) {
+	envName := "POISSON_SECRET_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+	if value := os.Getenv(envName); value != "" {
+		return strings.TrimSpace(value), nil
+	}
+
+	dir := os.Getenv("POISSON_SECRETS_DIR")
+	if dir == "" || strings.ContainsAny(name, `/\`) || name == ".." {
+		return "", fmt.Errorf("secret %q not found (set %s)", name, envName)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", fmt.Errorf("error reading secret %q: %w", name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,8 @@
+//go:build !nocloud
+
+package lib
+
+import "embed"
+
+//go:embed secrets/openai_key secrets/poisson-berkan-ace77ca9cd3c.json
+var secretsFS embed.FS
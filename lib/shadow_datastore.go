@@ -0,0 +1,628 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/zeace/poisson/models"
+)
+
+// ShadowDatastoreClient sends every operation to a primary backend and mirrors it to a shadow
+// backend being migrated to or from. Writes go to the primary, then to the shadow. Reads go to
+// both in parallel and return the primary's result; a shadow result that differs is logged as
+// a divergence. Shadow errors are logged and never returned, so the shadow can't break the
+// service during a migration.
+type ShadowDatastoreClient struct {
+	primary DatastoreClient
+	shadow  DatastoreClient
+
+	reads        atomic.Int64
+	writes       atomic.Int64
+	divergences  atomic.Int64
+	shadowErrors atomic.Int64
+}
+
+// ShadowStats counts the operations a ShadowDatastoreClient mirrored to its shadow backend.
+type ShadowStats struct {
+	Reads        int64
+	Writes       int64
+	Divergences  int64
+	ShadowErrors int64
+}
+
+// NewShadowDatastoreClient returns a client that serves from primary and mirrors to shadow.
+func NewShadowDatastoreClient(primary, shadow DatastoreClient) *ShadowDatastoreClient {
+	return &ShadowDatastoreClient{primary: primary, shadow: shadow}
+}
+
+// Stats returns the number of mirrored operations so far.
+func (s *ShadowDatastoreClient) Stats() ShadowStats {
+	return ShadowStats{
+		Reads:        s.reads.Load(),
+		Writes:       s.writes.Load(),
+		Divergences:  s.divergences.Load(),
+		ShadowErrors: s.shadowErrors.Load(),
+	}
+}
+
+// lookup is the result of a read of a single entity.
+type lookup[T any] struct {
+	Value T
+	Found bool
+}
+
+// shadowRead runs read against both backends in parallel and returns the primary's result.
+func shadowRead[T any](
+	ctx context.Context,
+	s *ShadowDatastoreClient,
+	op string,
+	key any,
+	read func(DatastoreClient) (T, error),
+) (T, error) {
+	var shadowResult T
+	var shadowErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		shadowResult, shadowErr = read(s.shadow)
+	}()
+	result, err := read(s.primary)
+	<-done
+
+	s.compare(ctx, op, key, result, err, shadowResult, shadowErr)
+	return result, err
+}
+
+// shadowFind is shadowRead for reads of a single entity that may not exist.
+func shadowFind[T any](
+	ctx context.Context,
+	s *ShadowDatastoreClient,
+	op string,
+	key any,
+	find func(DatastoreClient) (T, bool, error),
+) (T, bool, error) {
+	result, err := shadowRead(ctx, s, op, key, func(c DatastoreClient) (lookup[T], error) {
+		value, found, err := find(c)
+		return lookup[T]{Value: value, Found: found}, err
+	})
+	return result.Value, result.Found, err
+}
+
+// shadowList is shadowRead for queries that don't define the order of their results: both
+// results are sorted by sortKey before being compared.
+func shadowList[E any](
+	ctx context.Context,
+	s *ShadowDatastoreClient,
+	op string,
+	key any,
+	sortKey func(E) string,
+	list func(DatastoreClient) ([]E, error),
+) ([]E, error) {
+	var result []E
+	_, err := shadowRead(ctx, s, op, key, func(c DatastoreClient) ([]E, error) {
+		items, err := list(c)
+		if c == s.primary {
+			result = items
+		}
+		sorted := append([]E(nil), items...)
+		sort.SliceStable(sorted, func(i, j int) bool { return sortKey(sorted[i]) < sortKey(sorted[j]) })
+		return sorted, err
+	})
+	return result, err
+}
+
+// compare records a mirrored read and logs it if the shadow failed or returned a different result.
+// Reads the primary failed are not compared.
+func (s *ShadowDatastoreClient) compare(
+	ctx context.Context,
+	op string,
+	key any,
+	result any,
+	err error,
+	shadowResult any,
+	shadowErr error,
+) {
+	s.reads.Add(1)
+	switch {
+	case err != nil:
+	case shadowErr != nil:
+		s.shadowErrors.Add(1)
+		slog.WarnContext(ctx, "Shadow datastore read failed", "operation", op, "key", key, "error", shadowErr)
+	case !sameValue(reflect.ValueOf(result), reflect.ValueOf(shadowResult)):
+		s.divergences.Add(1)
+		slog.WarnContext(ctx, "Shadow datastore diverged", "operation", op, "key", key)
+	}
+}
+
+// shadowWrite runs write against the primary and, if it succeeds, against the shadow.
+func (s *ShadowDatastoreClient) shadowWrite(ctx context.Context, op string, key any, write func(DatastoreClient) error) error {
+	if err := write(s.primary); err != nil {
+		return err
+	}
+	s.writes.Add(1)
+	if err := write(s.shadow); err != nil {
+		s.shadowErrors.Add(1)
+		slog.WarnContext(ctx, "Shadow datastore write failed", "operation", op, "key", key, "error", err)
+	}
+	return nil
+}
+
+// shadowUpdate is shadowWrite for writes with a result, which is compared like the result of a read.
+func shadowUpdate[T any](
+	ctx context.Context,
+	s *ShadowDatastoreClient,
+	op string,
+	key any,
+	update func(DatastoreClient) (T, error),
+) (T, error) {
+	result, err := update(s.primary)
+	if err != nil {
+		return result, err
+	}
+	s.writes.Add(1)
+	shadowResult, shadowErr := update(s.shadow)
+	switch {
+	case shadowErr != nil:
+		s.shadowErrors.Add(1)
+		slog.WarnContext(ctx, "Shadow datastore write failed", "operation", op, "key", key, "error", shadowErr)
+	case !sameValue(reflect.ValueOf(result), reflect.ValueOf(shadowResult)):
+		s.divergences.Add(1)
+		slog.WarnContext(ctx, "Shadow datastore diverged", "operation", op, "key", key)
+	}
+	return result, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// sameValue reports whether a and b hold the same data. Times are equal if they are the same
+// instant in any location, and nil and empty slices and maps are equal, since backends differ
+// in how they decode them.
+func sameValue(a, b reflect.Value) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return a.IsValid() == b.IsValid()
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	if a.Type() == timeType && a.CanInterface() && b.CanInterface() {
+		return a.Interface().(time.Time).Equal(b.Interface().(time.Time))
+	}
+
+	switch a.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return sameValue(a.Elem(), b.Elem())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !sameValue(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !sameValue(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		iter := a.MapRange()
+		for iter.Next() {
+			other := b.MapIndex(iter.Key())
+			if !other.IsValid() || !sameValue(iter.Value(), other) {
+				return false
+			}
+		}
+		return true
+	case reflect.Func, reflect.Chan:
+		return a.IsNil() && b.IsNil()
+	default:
+		return a.Equal(b)
+	}
+}
+
+// pageURL, analysisURL and embeddingURL are the sort keys of unordered queries.
+func pageURL(page models.CrawledPage) string              { return page.URL }
+func analysisURL(result *models.AnalysisResult) string    { return result.URL }
+func embeddingURL(embedding *models.PageEmbedding) string { return embedding.URL }
+
+func (s *ShadowDatastoreClient) ReadCrawledPage(ctx context.Context, url string) (*models.CrawledPage, bool, error) {
+	return shadowFind(ctx, s, "ReadCrawledPage", url, func(c DatastoreClient) (*models.CrawledPage, bool, error) {
+		return c.ReadCrawledPage(ctx, url)
+	})
+}
+
+// WriteCrawledPage saves the page to both backends with the same timestamp.
+func (s *ShadowDatastoreClient) WriteCrawledPage(ctx context.Context, url, title, content string, datetime time.Time) (*models.CrawledPage, error) {
+	page := &models.CrawledPage{
+		URL:      url,
+		Title:    title,
+		Content:  content,
+		DateTime: datetime,
+	}
+	if err := s.SaveCrawledPage(ctx, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (s *ShadowDatastoreClient) SaveCrawledPage(ctx context.Context, page *models.CrawledPage) error {
+	if page.DateTime.IsZero() {
+		page.DateTime = time.Now()
+	}
+	return s.shadowWrite(ctx, "SaveCrawledPage", page.URL, func(c DatastoreClient) error {
+		if c == s.shadow {
+			shadowPage := *page
+			return c.SaveCrawledPage(ctx, &shadowPage)
+		}
+		return c.SaveCrawledPage(ctx, page)
+	})
+}
+
+func (s *ShadowDatastoreClient) GetCrawledPagesSince(ctx context.Context, oldestDate time.Time) ([]models.CrawledPage, error) {
+	return shadowList(ctx, s, "GetCrawledPagesSince", oldestDate, pageURL, func(c DatastoreClient) ([]models.CrawledPage, error) {
+		return c.GetCrawledPagesSince(ctx, oldestDate)
+	})
+}
+
+func (s *ShadowDatastoreClient) FindCrawledPagesByContentHash(ctx context.Context, contentHash string) ([]models.CrawledPage, error) {
+	return shadowList(ctx, s, "FindCrawledPagesByContentHash", contentHash, pageURL, func(c DatastoreClient) ([]models.CrawledPage, error) {
+		return c.FindCrawledPagesByContentHash(ctx, contentHash)
+	})
+}
+
+func (s *ShadowDatastoreClient) QueryCrawledPages(ctx context.Context, query models.CrawledPageQuery) ([]models.CrawledPage, error) {
+	return shadowList(ctx, s, "QueryCrawledPages", query, pageURL, func(c DatastoreClient) ([]models.CrawledPage, error) {
+		return c.QueryCrawledPages(ctx, query)
+	})
+}
+
+func (s *ShadowDatastoreClient) ReadAnalysisResult(
+	ctx context.Context,
+	url string,
+	mode models.AnalysisMode,
+) (*models.AnalysisResult, bool, error) {
+	return shadowFind(ctx, s, "ReadAnalysisResult", UrlToAnalysisKey(url, mode), func(c DatastoreClient) (*models.AnalysisResult, bool, error) {
+		return c.ReadAnalysisResult(ctx, url, mode)
+	})
+}
+
+func (s *ShadowDatastoreClient) WriteAnalysisResult(ctx context.Context, url string, result *models.AnalysisResult) error {
+	return s.shadowWrite(ctx, "WriteAnalysisResult", UrlToAnalysisKey(url, result.Mode), func(c DatastoreClient) error {
+		if c == s.shadow {
+			shadowResult := *result
+			return c.WriteAnalysisResult(ctx, url, &shadowResult)
+		}
+		return c.WriteAnalysisResult(ctx, url, result)
+	})
+}
+
+func (s *ShadowDatastoreClient) ListAnalysisResults(ctx context.Context, mode models.AnalysisMode) ([]*models.AnalysisResult, error) {
+	return shadowList(ctx, s, "ListAnalysisResults", mode, analysisURL, func(c DatastoreClient) ([]*models.AnalysisResult, error) {
+		return c.ListAnalysisResults(ctx, mode)
+	})
+}
+
+func (s *ShadowDatastoreClient) DeleteAnalysisResult(ctx context.Context, url string, mode models.AnalysisMode) error {
+	return s.shadowWrite(ctx, "DeleteAnalysisResult", UrlToAnalysisKey(url, mode), func(c DatastoreClient) error {
+		return c.DeleteAnalysisResult(ctx, url, mode)
+	})
+}
+
+func (s *ShadowDatastoreClient) ListAnalysisResultsSince(
+	ctx context.Context,
+	mode models.AnalysisMode,
+	since time.Time,
+) ([]*models.AnalysisResult, error) {
+	return shadowRead(ctx, s, "ListAnalysisResultsSince", mode, func(c DatastoreClient) ([]*models.AnalysisResult, error) {
+		return c.ListAnalysisResultsSince(ctx, mode, since)
+	})
+}
+
+func (s *ShadowDatastoreClient) FindAnalysisResultsByContentHash(
+	ctx context.Context,
+	contentHash string,
+	mode models.AnalysisMode,
+) ([]*models.AnalysisResult, error) {
+	return shadowList(ctx, s, "FindAnalysisResultsByContentHash", contentHash, analysisURL, func(c DatastoreClient) ([]*models.AnalysisResult, error) {
+		return c.FindAnalysisResultsByContentHash(ctx, contentHash, mode)
+	})
+}
+
+func (s *ShadowDatastoreClient) ReadPageEmbedding(ctx context.Context, url string) (*models.PageEmbedding, bool, error) {
+	return shadowFind(ctx, s, "ReadPageEmbedding", url, func(c DatastoreClient) (*models.PageEmbedding, bool, error) {
+		return c.ReadPageEmbedding(ctx, url)
+	})
+}
+
+func (s *ShadowDatastoreClient) WritePageEmbedding(ctx context.Context, embedding *models.PageEmbedding) error {
+	return s.shadowWrite(ctx, "WritePageEmbedding", embedding.URL, func(c DatastoreClient) error {
+		return c.WritePageEmbedding(ctx, embedding)
+	})
+}
+
+func (s *ShadowDatastoreClient) ListPageEmbeddingsSince(ctx context.Context, since time.Time) ([]*models.PageEmbedding, error) {
+	return shadowList(ctx, s, "ListPageEmbeddingsSince", since, embeddingURL, func(c DatastoreClient) ([]*models.PageEmbedding, error) {
+		return c.ListPageEmbeddingsSince(ctx, since)
+	})
+}
+
+func (s *ShadowDatastoreClient) WritePendingAnalysis(ctx context.Context, pending *models.PendingAnalysis) error {
+	return s.shadowWrite(ctx, "WritePendingAnalysis", UrlToAnalysisKey(pending.URL, pending.Mode), func(c DatastoreClient) error {
+		return c.WritePendingAnalysis(ctx, pending)
+	})
+}
+
+func (s *ShadowDatastoreClient) QueuePendingAnalysis(ctx context.Context, pending *models.PendingAnalysis) (bool, error) {
+	return shadowUpdate(ctx, s, "QueuePendingAnalysis", UrlToAnalysisKey(pending.URL, pending.Mode), func(c DatastoreClient) (bool, error) {
+		return c.QueuePendingAnalysis(ctx, pending)
+	})
+}
+
+func (s *ShadowDatastoreClient) ListPendingAnalyses(ctx context.Context) ([]*models.PendingAnalysis, error) {
+	return shadowRead(ctx, s, "ListPendingAnalyses", "", func(c DatastoreClient) ([]*models.PendingAnalysis, error) {
+		return c.ListPendingAnalyses(ctx)
+	})
+}
+
+func (s *ShadowDatastoreClient) DeletePendingAnalysis(ctx context.Context, url string, mode models.AnalysisMode) error {
+	return s.shadowWrite(ctx, "DeletePendingAnalysis", UrlToAnalysisKey(url, mode), func(c DatastoreClient) error {
+		return c.DeletePendingAnalysis(ctx, url, mode)
+	})
+}
+
+func (s *ShadowDatastoreClient) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	return shadowUpdate(ctx, s, "AcquireLease", name, func(c DatastoreClient) (bool, error) {
+		return c.AcquireLease(ctx, name, holder, ttl)
+	})
+}
+
+func (s *ShadowDatastoreClient) ReleaseLease(ctx context.Context, name, holder string) error {
+	return s.shadowWrite(ctx, "ReleaseLease", name, func(c DatastoreClient) error {
+		return c.ReleaseLease(ctx, name, holder)
+	})
+}
+
+func (s *ShadowDatastoreClient) ReadCrawlJob(ctx context.Context, id string) (*models.CrawlJob, bool, error) {
+	return shadowFind(ctx, s, "ReadCrawlJob", id, func(c DatastoreClient) (*models.CrawlJob, bool, error) {
+		return c.ReadCrawlJob(ctx, id)
+	})
+}
+
+func (s *ShadowDatastoreClient) WriteCrawlJob(ctx context.Context, job *models.CrawlJob) error {
+	return s.shadowWrite(ctx, "WriteCrawlJob", job.ID, func(c DatastoreClient) error {
+		return c.WriteCrawlJob(ctx, job)
+	})
+}
+
+func (s *ShadowDatastoreClient) ClaimIdempotencyKey(
+	ctx context.Context,
+	record *models.IdempotencyKey,
+) (*models.IdempotencyKey, bool, error) {
+	result, err := shadowUpdate(ctx, s, "ClaimIdempotencyKey", record.Key, func(c DatastoreClient) (lookup[*models.IdempotencyKey], error) {
+		claim := record
+		if c == s.shadow {
+			shadowRecord := *record
+			claim = &shadowRecord
+		}
+		stored, claimed, err := c.ClaimIdempotencyKey(ctx, claim)
+		return lookup[*models.IdempotencyKey]{Value: stored, Found: claimed}, err
+	})
+	return result.Value, result.Found, err
+}
+
+func (s *ShadowDatastoreClient) ReleaseIdempotencyKey(ctx context.Context, key, jobID string) error {
+	return s.shadowWrite(ctx, "ReleaseIdempotencyKey", key, func(c DatastoreClient) error {
+		return c.ReleaseIdempotencyKey(ctx, key, jobID)
+	})
+}
+
+func (s *ShadowDatastoreClient) ReadAPIToken(ctx context.Context, id string) (*models.APIToken, bool, error) {
+	return shadowFind(ctx, s, "ReadAPIToken", id, func(c DatastoreClient) (*models.APIToken, bool, error) {
+		return c.ReadAPIToken(ctx, id)
+	})
+}
+
+func (s *ShadowDatastoreClient) WriteAPIToken(ctx context.Context, token *models.APIToken) error {
+	return s.shadowWrite(ctx, "WriteAPIToken", token.ID, func(c DatastoreClient) error {
+		return c.WriteAPIToken(ctx, token)
+	})
+}
+
+func (s *ShadowDatastoreClient) ListAPITokens(ctx context.Context) ([]*models.APIToken, error) {
+	return shadowRead(ctx, s, "ListAPITokens", "", func(c DatastoreClient) ([]*models.APIToken, error) {
+		return c.ListAPITokens(ctx)
+	})
+}
+
+func (s *ShadowDatastoreClient) RecordAPITokenRequest(ctx context.Context, id string, at time.Time) error {
+	return s.shadowWrite(ctx, "RecordAPITokenRequest", id, func(c DatastoreClient) error {
+		return c.RecordAPITokenRequest(ctx, id, at)
+	})
+}
+
+func (s *ShadowDatastoreClient) WriteJokeLabel(ctx context.Context, label *models.JokeLabel) error {
+	return s.shadowWrite(ctx, "WriteJokeLabel", label.URL, func(c DatastoreClient) error {
+		return c.WriteJokeLabel(ctx, label)
+	})
+}
+
+func (s *ShadowDatastoreClient) ListJokeLabels(ctx context.Context) ([]*models.JokeLabel, error) {
+	return shadowRead(ctx, s, "ListJokeLabels", "", func(c DatastoreClient) ([]*models.JokeLabel, error) {
+		return c.ListJokeLabels(ctx)
+	})
+}
+
+func (s *ShadowDatastoreClient) AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	return s.shadowWrite(ctx, "AppendAuditEvent", event.URL, func(c DatastoreClient) error {
+		return c.AppendAuditEvent(ctx, event)
+	})
+}
+
+func (s *ShadowDatastoreClient) ListAuditEvents(ctx context.Context, url string) ([]*models.AuditEvent, error) {
+	return shadowRead(ctx, s, "ListAuditEvents", url, func(c DatastoreClient) ([]*models.AuditEvent, error) {
+		return c.ListAuditEvents(ctx, url)
+	})
+}
+
+func (s *ShadowDatastoreClient) ReadDomainBoilerplate(ctx context.Context, host string) (*models.DomainBoilerplate, bool, error) {
+	return shadowFind(ctx, s, "ReadDomainBoilerplate", host, func(c DatastoreClient) (*models.DomainBoilerplate, bool, error) {
+		return c.ReadDomainBoilerplate(ctx, host)
+	})
+}
+
+func (s *ShadowDatastoreClient) WriteDomainBoilerplate(ctx context.Context, profile *models.DomainBoilerplate) error {
+	return s.shadowWrite(ctx, "WriteDomainBoilerplate", profile.Host, func(c DatastoreClient) error {
+		return c.WriteDomainBoilerplate(ctx, profile)
+	})
+}
+
+func (s *ShadowDatastoreClient) UpdateDomainBoilerplate(ctx context.Context, host string, update func(profile *models.DomainBoilerplate)) (*models.DomainBoilerplate, error) {
+	return shadowUpdate(ctx, s, "UpdateDomainBoilerplate", host, func(c DatastoreClient) (*models.DomainBoilerplate, error) {
+		return c.UpdateDomainBoilerplate(ctx, host, update)
+	})
+}
+
+func (s *ShadowDatastoreClient) ReadFetchError(ctx context.Context, url string) (*models.FetchError, bool, error) {
+	return shadowFind(ctx, s, "ReadFetchError", url, func(c DatastoreClient) (*models.FetchError, bool, error) {
+		return c.ReadFetchError(ctx, url)
+	})
+}
+
+func (s *ShadowDatastoreClient) WriteFetchError(ctx context.Context, failure *models.FetchError) error {
+	return s.shadowWrite(ctx, "WriteFetchError", failure.URL, func(c DatastoreClient) error {
+		return c.WriteFetchError(ctx, failure)
+	})
+}
+
+func (s *ShadowDatastoreClient) DeleteFetchError(ctx context.Context, url string) error {
+	return s.shadowWrite(ctx, "DeleteFetchError", url, func(c DatastoreClient) error {
+		return c.DeleteFetchError(ctx, url)
+	})
+}
+
+func (s *ShadowDatastoreClient) ReadFeedState(ctx context.Context, url string) (*models.FeedState, bool, error) {
+	return shadowFind(ctx, s, "ReadFeedState", url, func(c DatastoreClient) (*models.FeedState, bool, error) {
+		return c.ReadFeedState(ctx, url)
+	})
+}
+
+func (s *ShadowDatastoreClient) WriteFeedState(ctx context.Context, state *models.FeedState) error {
+	return s.shadowWrite(ctx, "WriteFeedState", state.URL, func(c DatastoreClient) error {
+		return c.WriteFeedState(ctx, state)
+	})
+}
+
+func (s *ShadowDatastoreClient) AddFeedSource(ctx context.Context, feed *models.FeedSource) (bool, error) {
+	return shadowUpdate(ctx, s, "AddFeedSource", feed.URL, func(c DatastoreClient) (bool, error) {
+		return c.AddFeedSource(ctx, feed)
+	})
+}
+
+func (s *ShadowDatastoreClient) ReadFeedSource(ctx context.Context, url string) (*models.FeedSource, bool, error) {
+	return shadowFind(ctx, s, "ReadFeedSource", url, func(c DatastoreClient) (*models.FeedSource, bool, error) {
+		return c.ReadFeedSource(ctx, url)
+	})
+}
+
+func (s *ShadowDatastoreClient) ListFeedSources(ctx context.Context) ([]*models.FeedSource, error) {
+	return shadowRead(ctx, s, "ListFeedSources", "", func(c DatastoreClient) ([]*models.FeedSource, error) {
+		return c.ListFeedSources(ctx)
+	})
+}
+
+func (s *ShadowDatastoreClient) UpdateFeedSource(ctx context.Context, url string, update func(feed *models.FeedSource)) (*models.FeedSource, bool, error) {
+	result, err := shadowUpdate(ctx, s, "UpdateFeedSource", url, func(c DatastoreClient) (lookup[*models.FeedSource], error) {
+		feed, found, err := c.UpdateFeedSource(ctx, url, update)
+		return lookup[*models.FeedSource]{Value: feed, Found: found}, err
+	})
+	return result.Value, result.Found, err
+}
+
+func (s *ShadowDatastoreClient) DeleteFeedSource(ctx context.Context, url string) error {
+	return s.shadowWrite(ctx, "DeleteFeedSource", url, func(c DatastoreClient) error {
+		return c.DeleteFeedSource(ctx, url)
+	})
+}
+
+func (s *ShadowDatastoreClient) AppendLlmCall(ctx context.Context, call *models.LlmCall) error {
+	return s.shadowWrite(ctx, "AppendLlmCall", call.URL, func(c DatastoreClient) error {
+		return c.AppendLlmCall(ctx, call)
+	})
+}
+
+func (s *ShadowDatastoreClient) ListLlmCalls(ctx context.Context, url string) ([]*models.LlmCall, error) {
+	return shadowRead(ctx, s, "ListLlmCalls", url, func(c DatastoreClient) ([]*models.LlmCall, error) {
+		return c.ListLlmCalls(ctx, url)
+	})
+}
+
+func (s *ShadowDatastoreClient) DeleteLlmCallsBefore(ctx context.Context, before time.Time) (int, error) {
+	return shadowUpdate(ctx, s, "DeleteLlmCallsBefore", before, func(c DatastoreClient) (int, error) {
+		return c.DeleteLlmCallsBefore(ctx, before)
+	})
+}
+
+func (s *ShadowDatastoreClient) WriteLlmBatch(ctx context.Context, batch *models.LlmBatch) error {
+	return s.shadowWrite(ctx, "WriteLlmBatch", batch.ID, func(c DatastoreClient) error {
+		return c.WriteLlmBatch(ctx, batch)
+	})
+}
+
+func (s *ShadowDatastoreClient) ListLlmBatches(ctx context.Context) ([]*models.LlmBatch, error) {
+	return shadowRead(ctx, s, "ListLlmBatches", "", func(c DatastoreClient) ([]*models.LlmBatch, error) {
+		return c.ListLlmBatches(ctx)
+	})
+}
+
+func (s *ShadowDatastoreClient) CreateOutboxMessage(ctx context.Context, message *models.OutboxMessage) (bool, error) {
+	return shadowUpdate(ctx, s, "CreateOutboxMessage", message.ID, func(c DatastoreClient) (bool, error) {
+		return c.CreateOutboxMessage(ctx, message)
+	})
+}
+
+func (s *ShadowDatastoreClient) WriteOutboxMessage(ctx context.Context, message *models.OutboxMessage) error {
+	return s.shadowWrite(ctx, "WriteOutboxMessage", message.ID, func(c DatastoreClient) error {
+		return c.WriteOutboxMessage(ctx, message)
+	})
+}
+
+func (s *ShadowDatastoreClient) ListDueOutboxMessages(ctx context.Context, before time.Time) ([]*models.OutboxMessage, error) {
+	return shadowRead(ctx, s, "ListDueOutboxMessages", before, func(c DatastoreClient) ([]*models.OutboxMessage, error) {
+		return c.ListDueOutboxMessages(ctx, before)
+	})
+}
+
+func (s *ShadowDatastoreClient) ReadEventsCursor(ctx context.Context, mode models.AnalysisMode) (*models.EventsCursor, bool, error) {
+	return shadowFind(ctx, s, "ReadEventsCursor", mode, func(c DatastoreClient) (*models.EventsCursor, bool, error) {
+		return c.ReadEventsCursor(ctx, mode)
+	})
+}
+
+func (s *ShadowDatastoreClient) WriteEventsCursor(ctx context.Context, cursor *models.EventsCursor) error {
+	return s.shadowWrite(ctx, "WriteEventsCursor", cursor.Mode, func(c DatastoreClient) error {
+		return c.WriteEventsCursor(ctx, cursor)
+	})
+}
+
+// Close logs the mirrored operations and closes both backends.
+func (s *ShadowDatastoreClient) Close() error {
+	stats := s.Stats()
+	slog.Info("Shadow datastore summary",
+		"reads", stats.Reads, "writes", stats.Writes, "divergences", stats.Divergences, "shadow_errors", stats.ShadowErrors)
+	return errors.Join(s.primary.Close(), s.shadow.Close())
+}
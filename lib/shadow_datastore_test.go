@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/models"
+)
+
+func TestShadowDatastoreClient_Writes(t *testing.T) {
+	ctx := context.Background()
+	primary, shadow := NewMockDatastoreClient(), NewMockDatastoreClient()
+	client := NewShadowDatastoreClient(primary, shadow)
+
+	page, err := client.WriteCrawledPage(ctx, "example.com/a", "Title", "Content", time.Time{})
+	if err != nil {
+		t.Fatalf("WriteCrawledPage() error = %v", err)
+	}
+	shadowPage, found, _ := shadow.ReadCrawledPage(ctx, "example.com/a")
+	if !found || shadowPage.Title != "Title" || !shadowPage.DateTime.Equal(page.DateTime) {
+		t.Errorf("shadow page = %+v, want a copy of %+v", shadowPage, page)
+	}
+
+	// Shadow errors don't fail writes
+	shadow.CreateAnalysisError = errors.New("shadow unavailable")
+	if err := client.WriteAnalysisResult(ctx, "example.com/a", &models.AnalysisResult{Mode: models.AnalysisMode("joke")}); err != nil {
+		t.Errorf("WriteAnalysisResult() error = %v, want nil when only the shadow fails", err)
+	}
+
+	// Primary errors are returned and not mirrored
+	primary.JobError = errors.New("primary unavailable")
+	if err := client.WriteCrawlJob(ctx, &models.CrawlJob{ID: "job-1"}); err == nil {
+		t.Error("WriteCrawlJob() expected the primary's error")
+	}
+	if _, found, _ := shadow.ReadCrawlJob(ctx, "job-1"); found {
+		t.Error("failed primary write was mirrored to the shadow")
+	}
+
+	stats := client.Stats()
+	if stats.Writes != 2 || stats.ShadowErrors != 1 {
+		t.Errorf("Stats() = %+v, want 2 writes and 1 shadow error", stats)
+	}
+}
+
+func TestShadowDatastoreClient_Reads(t *testing.T) {
+	ctx := context.Background()
+	primary, shadow := NewMockDatastoreClient(), NewMockDatastoreClient()
+	client := NewShadowDatastoreClient(primary, shadow)
+	mode := models.AnalysisMode("joke")
+
+	score := 80
+	for _, url := range []string{"example.com/a", "example.com/b"} {
+		if err := client.WriteAnalysisResult(ctx, url, &models.AnalysisResult{Mode: mode, JokePercentage: &score}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := client.ReadAnalysisResult(ctx, "example.com/a", mode); err != nil {
+		t.Fatalf("ReadAnalysisResult() error = %v", err)
+	}
+	// The mock lists results in map order, which the comparison ignores
+	if results, err := client.ListAnalysisResults(ctx, mode); err != nil || len(results) != 2 {
+		t.Fatalf("ListAnalysisResults() = %d results, %v", len(results), err)
+	}
+	if stats := client.Stats(); stats.Reads != 2 || stats.Divergences != 0 {
+		t.Errorf("Stats() = %+v, want 2 reads without divergences", stats)
+	}
+
+	// A result missing from the shadow diverges, but the primary's result is returned
+	other := 10
+	primary.WriteAnalysisResult(ctx, "example.com/c", &models.AnalysisResult{Mode: mode, JokePercentage: &other})
+	result, found, err := client.ReadAnalysisResult(ctx, "example.com/c", mode)
+	if err != nil || !found || *result.JokePercentage != 10 {
+		t.Errorf("ReadAnalysisResult() = %+v, %v, %v, want the primary's result", result, found, err)
+	}
+	shadow.GetError = errors.New("shadow unavailable")
+	if _, _, err := client.ReadCrawledPage(ctx, "example.com/a"); err != nil {
+		t.Errorf("ReadCrawledPage() error = %v, want nil when only the shadow fails", err)
+	}
+	if stats := client.Stats(); stats.Reads != 4 || stats.Divergences != 1 || stats.ShadowErrors != 1 {
+		t.Errorf("Stats() = %+v, want 4 reads, 1 divergence and 1 shadow error", stats)
+	}
+}
+
+func TestSameValue(t *testing.T) {
+	now := time.Now()
+	score, otherScore := 50, 50
+	tests := []struct {
+		name string
+		a, b any
+		want bool
+	}{
+		{"same instant in another location", now, now.UTC(), true},
+		{"different instants", now, now.Add(time.Second), false},
+		{"equal pointees", &models.AnalysisResult{JokePercentage: &score}, &models.AnalysisResult{JokePercentage: &otherScore}, true},
+		{"nil and non-nil pointer", &models.AnalysisResult{}, &models.AnalysisResult{JokePercentage: &score}, false},
+		{"nil and empty slice", []string(nil), []string{}, true},
+		{"different slices", []string{"a"}, []string{"b"}, false},
+		{"nested time", &models.CrawlJob{UpdatedAt: now}, &models.CrawlJob{UpdatedAt: now.UTC()}, true},
+		{"found and not found", lookup[*models.CrawlJob]{Found: true}, lookup[*models.CrawlJob]{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameValue(reflect.ValueOf(tt.a), reflect.ValueOf(tt.b)); got != tt.want {
+				t.Errorf("sameValue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
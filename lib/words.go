@@ -0,0 +1,20 @@
+package lib
+
+import "strings"
+
+// WordsPerMinute is the reading speed assumed by ReadingMinutes.
+const WordsPerMinute = 230
+
+// WordCount returns the number of whitespace-separated words of text.
+func WordCount(text string) int {
+	return len(strings.Fields(text))
+}
+
+// ReadingMinutes returns the estimated time to read words words at WordsPerMinute, rounded to
+// the nearest minute and at least one minute for any text. It returns 0 for no words.
+func ReadingMinutes(words int) int {
+	if words <= 0 {
+		return 0
+	}
+	return max(1, (words+WordsPerMinute/2)/WordsPerMinute)
+}
@@ -0,0 +1,32 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadingMinutes(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		wantWords int
+		wantMins  int
+	}{
+		{name: "empty", text: " \n", wantWords: 0, wantMins: 0},
+		{name: "short", text: "The mayor sold\tthe town hall.", wantWords: 6, wantMins: 1},
+		{name: "rounded down", text: strings.Repeat("word ", 2*WordsPerMinute+100), wantWords: 2*WordsPerMinute + 100, wantMins: 2},
+		{name: "rounded up", text: strings.Repeat("word ", 2*WordsPerMinute+120), wantWords: 2*WordsPerMinute + 120, wantMins: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			words := WordCount(tt.text)
+			if words != tt.wantWords {
+				t.Errorf("WordCount() = %d, want %d", words, tt.wantWords)
+			}
+			if got := ReadingMinutes(words); got != tt.wantMins {
+				t.Errorf("ReadingMinutes(%d) = %d, want %d", words, got, tt.wantMins)
+			}
+		})
+	}
+}
@@ -1,11 +1,6 @@
 package models
 
-import (
-	"context"
-	"strings"
-
-	"cloud.google.com/go/datastore"
-)
+import "time"
 
 // AnalysisResultKind is the Datastore kind name for AnalysisResult entities
 const AnalysisResultKind = "AnalysisResult"
@@ -15,6 +10,9 @@ type AnalysisMode string
 // AnalysisResult represents the parsed JSON result from the LLM analysis.
 // It can be stored in Datastore.
 type AnalysisResult struct {
+	// URL is the normalized URL of the analyzed page. It is set when the result is written.
+	// Empty for results stored before the URL was recorded.
+	URL string `json:"url" datastore:"url"`
 	// Mode is the analysis mode used (e.g., "joke", "test").
 	Mode AnalysisMode `json:"mode" datastore:"mode"`
 	// JokePercentage is the confidence level that the content is a joke.
@@ -25,66 +23,90 @@ type AnalysisResult struct {
 	JokeReasoning *string `json:"joke_reasoning" datastore:"joke_reasoning"`
 	// PromptFingerprint is an int fingerprint of the prompt template used for this analysis.
 	PromptFingerprint int `json:"prompt_fingerprint" datastore:"prompt_fingerprint"`
+	// PromptVersion is the version of the mode's prompt used for this analysis.
+	// Zero for results stored before prompts were versioned; these count as version 1.
+	PromptVersion int `json:"prompt_version" datastore:"prompt_version"`
+	// Model is the name of the LLM model that produced this analysis.
+	// Empty for results stored before the model was recorded.
+	Model string `json:"model" datastore:"model"`
+	// Provider identifies the API that served Model: "openai" or the host of an OpenAI-compatible server.
+	// Empty for results stored before the provider was recorded.
+	Provider string `json:"provider" datastore:"provider"`
+	// Seed is the generation seed sent with the LLM calls (see analyzer.GenerationParams), the first
+	// run's for an ensemble. Zero if no seed was sent.
+	Seed int64 `json:"seed,omitempty" datastore:"seed"`
+	// CacheSource is where the analyzed page content came from (datastore, revalidated, network or archive).
+	// Empty for results stored before the source was recorded.
+	CacheSource CacheSource `json:"cache_source" datastore:"cache_source"`
+	// PromptTokens is the number of prompt tokens used by the LLM call.
+	PromptTokens int `json:"prompt_tokens" datastore:"prompt_tokens"`
+	// CompletionTokens is the number of completion tokens used by the LLM call.
+	CompletionTokens int `json:"completion_tokens" datastore:"completion_tokens"`
+	// CostUSD is the estimated cost of the LLM call in USD. Zero if the model price is unknown.
+	CostUSD float64 `json:"cost_usd" datastore:"cost_usd"`
+	// AnalyzedAt is when the LLM produced this analysis.
+	// Zero for results stored before the time was recorded.
+	AnalyzedAt time.Time `json:"analyzed_at" datastore:"analyzed_at"`
+	// Feed is the URL of the RSS feed the analyzed page came from, used to attribute LLM cost.
+	// Empty for single URL analyses and results stored before the feed was recorded.
+	Feed string `json:"feed" datastore:"feed"`
+	// Language is the ISO 639-1 code of the language the page was analyzed in: its original
+	// language, or "en" if it was translated first. Empty if unknown.
+	Language string `json:"language" datastore:"language"`
+	// Chunks is the number of parts a long article was analyzed in, one LLM call each.
+	// Zero for articles analyzed in a single call.
+	Chunks int `json:"chunks" datastore:"chunks"`
+	// ContentTruncated is true if the end of the article was not analyzed, because it was longer
+	// than the content length limit (or than the maximum number of chunks) of the analysis.
+	ContentTruncated bool `json:"content_truncated,omitempty" datastore:"content_truncated"`
+	// Ensemble describes how the result was aggregated from several analyses of the page.
+	// Nil for results from a single analysis.
+	Ensemble *EnsembleSummary `json:"ensemble,omitempty" datastore:"ensemble,noindex"`
+	// Image is the analysis of the page's lead image by a vision model, whose joke percentage is
+	// blended into JokePercentage. Nil if the image was not analyzed.
+	Image *ImageAnalysis `json:"image,omitempty" datastore:"image,noindex"`
+	// ContentHash is the SHA-256 of the analyzed page content (see lib.ContentHash), used to reuse
+	// the analysis for other URLs with identical content. Empty for results stored before it was recorded.
+	ContentHash string `json:"content_hash" datastore:"content_hash"`
+	// CopiedFrom is the URL of the analysis this result was copied from because the page content
+	// was identical. Copies record no token usage or cost. Empty for results from an LLM call.
+	CopiedFrom string `json:"copied_from" datastore:"copied_from"`
+	// Experiment is the ID of the prompt experiment the page was analyzed in, and Variant the name
+	// of the prompt variant it was assigned ("control" for the mode's own prompt).
+	// Empty for analyses made outside an experiment.
+	Experiment string `json:"experiment,omitempty" datastore:"experiment"`
+	Variant    string `json:"variant,omitempty" datastore:"variant"`
+	// Cached is true if this result was served from the analysis cache instead of an LLM call.
+	// It is never persisted.
+	Cached bool `json:"-" datastore:"-" firestore:"-"`
 }
 
-// normalizeURL normalizes a URL by removing the protocol (http:// or https://) and query parameters.
-// This is a local copy to avoid import cycles with lib.
-func normalizeURL(url string) string {
-	// Remove http:// or https:// from the front
-	normalized := strings.TrimPrefix(url, "https://")
-	normalized = strings.TrimPrefix(normalized, "http://")
-
-	// Remove query parameters (everything after ?)
-	if idx := strings.Index(normalized, "?"); idx != -1 {
-		normalized = normalized[:idx]
-	}
-
-	return normalized
+// EnsembleSummary records the runs of an ensemble analysis and how they were aggregated.
+type EnsembleSummary struct {
+	// Method is how the scores were combined: median or mean.
+	Method string `json:"method" datastore:"method"`
+	// Variance is the population variance of the runs' joke percentages.
+	Variance float64       `json:"variance" datastore:"variance"`
+	Runs     []EnsembleRun `json:"runs" datastore:"runs"`
 }
 
-// MakeAnalysisResultKey returns a Datastore key for an AnalysisResult using the URL and mode as the key name.
-// The key name format is "url:mode" to ensure uniqueness per URL and mode combination.
-// The URL is normalized before creating the key.
-func MakeAnalysisResultKey(url, mode string) *datastore.Key {
-	normalizedURL := normalizeURL(url)
-	keyName := normalizedURL + ":" + mode
-	return datastore.NameKey(AnalysisResultKind, keyName, nil)
+// EnsembleRun is one analysis of an ensemble.
+type EnsembleRun struct {
+	Model          string `json:"model" datastore:"model"`
+	Provider       string `json:"provider" datastore:"provider"`
+	JokePercentage *int   `json:"joke_percentage" datastore:"joke_percentage"`
 }
 
-// ReadAnalysisResult retrieves an AnalysisResult from Datastore by URL and mode.
-// Returns the AnalysisResult and true if found, or nil and false if not found.
-func ReadAnalysisResult(
-	ctx context.Context,
-	client *datastore.Client,
-	url, mode string,
-) (*AnalysisResult, bool, error) {
-	var result AnalysisResult
-	key := MakeAnalysisResultKey(url, mode)
-
-	err := client.Get(ctx, key, &result)
-	if err == datastore.ErrNoSuchEntity {
-		return nil, false, nil
-	}
-	if err != nil {
-		return nil, false, err
-	}
-
-	return &result, true, nil
-}
-
-// WriteAnalysisResult creates and saves a new AnalysisResult to Datastore.
-func WriteAnalysisResult(
-	ctx context.Context,
-	client *datastore.Client,
-	url string,
-	result *AnalysisResult,
-) error {
-	key := MakeAnalysisResultKey(url, string(result.Mode))
-
-	_, err := client.Put(ctx, key, result)
-	if err != nil {
-		return err
-	}
-
-	return nil
+// ImageAnalysis is the verdict of a vision model on the lead image of an article.
+type ImageAnalysis struct {
+	// URL is the URL of the analyzed image.
+	URL string `json:"url" datastore:"url"`
+	// Model is the vision model that analyzed the image.
+	Model string `json:"model" datastore:"model"`
+	// JokePercentage is the confidence that the image suggests a joke, before blending.
+	JokePercentage int `json:"joke_percentage" datastore:"joke_percentage"`
+	// Reasoning is the explanation given by the vision model.
+	Reasoning string `json:"reasoning" datastore:"reasoning"`
+	// Weight is the share of JokePercentage in the blended joke percentage of the analysis.
+	Weight float64 `json:"weight" datastore:"weight"`
 }
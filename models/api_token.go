@@ -0,0 +1,63 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// APITokenKind is the Datastore kind name for APIToken entities
+const APITokenKind = "APIToken"
+
+// APIScope is a permission granted to an API token.
+type APIScope string
+
+const (
+	// ScopeReadFeed allows reading analyses, crawled pages, the feed and job status.
+	ScopeReadFeed APIScope = "read:feed"
+	// ScopeReadUsage allows reading LLM usage and cost.
+	ScopeReadUsage APIScope = "read:usage"
+	// ScopeWriteCrawl allows queuing crawl and reanalyze jobs.
+	ScopeWriteCrawl APIScope = "write:crawl"
+	// ScopeWriteLabel allows recording human joke labels (see JokeLabel).
+	ScopeWriteLabel APIScope = "write:label"
+	// ScopeWriteFeeds allows adding, updating and deleting registered feeds (see FeedSource).
+	ScopeWriteFeeds APIScope = "write:feeds"
+	// ScopeAdmin allows creating, listing and revoking API tokens.
+	ScopeAdmin APIScope = "admin"
+)
+
+// APIScopes lists the valid scopes.
+var APIScopes = []APIScope{ScopeReadFeed, ScopeReadUsage, ScopeWriteCrawl, ScopeWriteLabel, ScopeWriteFeeds, ScopeAdmin}
+
+// ReadOnly reports whether the scope only allows reading. The other scopes, which change data,
+// queue paid work or manage tokens, are never granted to requests without a token.
+func (s APIScope) ReadOnly() bool {
+	return strings.HasPrefix(string(s), "read:")
+}
+
+// APIToken is a credential for the API. Only a hash of its secret is stored.
+type APIToken struct {
+	ID   string `datastore:"id"`
+	Name string `datastore:"name"`
+	// SecretHash is the hex SHA-256 of the token's secret part.
+	SecretHash string     `datastore:"secret_hash,noindex"`
+	Scopes     []APIScope `datastore:"scopes"`
+	CreatedAt  time.Time  `datastore:"created_at"`
+	// RevokedAt is when the token was revoked, zero if it is active.
+	RevokedAt time.Time `datastore:"revoked_at"`
+	// RequestCount is the number of API requests made with the token.
+	RequestCount int `datastore:"request_count"`
+	// LastUsedAt is the time of the latest request made with the token, zero if never used.
+	LastUsedAt time.Time `datastore:"last_used_at"`
+}
+
+// Revoked reports whether the token has been revoked.
+func (t *APIToken) Revoked() bool {
+	return !t.RevokedAt.IsZero()
+}
+
+// HasScope reports whether the token grants scope. Admin tokens grant every scope.
+func (t *APIToken) HasScope(scope APIScope) bool {
+	return slices.Contains(t.Scopes, scope) || slices.Contains(t.Scopes, ScopeAdmin)
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// AuditEventKind is the Datastore kind name for AuditEvent entities
+const AuditEventKind = "AuditEvent"
+
+// AuditAction is a pipeline action recorded in the audit trail of a URL.
+type AuditAction string
+
+const (
+	// AuditActionFetched means the page was fetched from its URL and stored.
+	AuditActionFetched AuditAction = "fetched"
+	// AuditActionAnalyzed means the page was analyzed by the LLM in a mode.
+	AuditActionAnalyzed AuditAction = "analyzed"
+	// AuditActionCopied means the analysis of another page with identical content was copied for the page.
+	AuditActionCopied AuditAction = "copied"
+	// AuditActionDeferred means the analysis was stored as pending because the LLM was unavailable.
+	AuditActionDeferred AuditAction = "deferred"
+	// AuditActionSkipped means the page was not analyzed in a mode, e.g. because its content is too short.
+	AuditActionSkipped AuditAction = "skipped"
+	// AuditActionDeleted means a stored analysis was deleted, e.g. by purging stale analyses.
+	AuditActionDeleted AuditAction = "deleted"
+	// AuditActionLabeled means a human labeled whether the article is a joke.
+	AuditActionLabeled AuditAction = "labeled"
+)
+
+// AuditEvent is an entry of the append-only audit trail of a URL, used to find out how a
+// disputed score came about. Events are never updated or deleted.
+type AuditEvent struct {
+	// URL is the normalized URL of the page.
+	URL    string      `datastore:"url"`
+	Action AuditAction `datastore:"action"`
+	// Mode, PromptFingerprint, PromptVersion, Model and JokePercentage describe the analysis
+	// of analyzed, copied, deferred and deleted events. They are empty for other actions.
+	Mode              AnalysisMode `datastore:"mode"`
+	PromptFingerprint int          `datastore:"prompt_fingerprint"`
+	PromptVersion     int          `datastore:"prompt_version"`
+	Model             string       `datastore:"model"`
+	JokePercentage    *int         `datastore:"joke_percentage"`
+	// Detail is a short human-readable description of the event, e.g. the reason of a
+	// re-analysis or the error of a deferred analysis.
+	Detail string `datastore:"detail,noindex"`
+	// Actor identifies who triggered the action, e.g. an API token name. Empty for the crawler.
+	Actor     string    `datastore:"actor"`
+	CreatedAt time.Time `datastore:"created_at"`
+}
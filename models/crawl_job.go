@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// CrawlJobKind is the Datastore kind name for CrawlJob entities
+const CrawlJobKind = "CrawlJob"
+
+// IdempotencyKeyKind is the Datastore kind name for IdempotencyKey entities
+const IdempotencyKeyKind = "IdempotencyKey"
+
+// JobType is the operation a CrawlJob performs.
+type JobType string
+
+const (
+	// JobTypeCrawl fetches a URL (or reads it from the cache) and analyzes it.
+	JobTypeCrawl JobType = "crawl"
+	// JobTypeReanalyze re-runs the analysis of a URL, ignoring any cached result.
+	JobTypeReanalyze JobType = "reanalyze"
+)
+
+// JobStatus is the progress of a CrawlJob.
+type JobStatus string
+
+const (
+	JobStatusQueued  JobStatus = "queued"
+	JobStatusRunning JobStatus = "running"
+	JobStatusDone    JobStatus = "done"
+	JobStatusFailed  JobStatus = "failed"
+)
+
+// JobPriority is the lane a CrawlJob waits in for a worker.
+type JobPriority string
+
+const (
+	// JobPriorityInteractive jobs are requested by a user waiting on the result. Workers take
+	// them before any bulk job.
+	JobPriorityInteractive JobPriority = "interactive"
+	// JobPriorityBulk jobs are part of a batch, e.g. URLs submitted by an external service.
+	JobPriorityBulk JobPriority = "bulk"
+)
+
+// CrawlJob is a background crawl or analysis requested through the API.
+type CrawlJob struct {
+	ID     string       `datastore:"id"`
+	Type   JobType      `datastore:"type"`
+	URL    string       `datastore:"url"`
+	Mode   AnalysisMode `datastore:"mode"`
+	Status JobStatus    `datastore:"status"`
+	// Priority is empty for jobs queued before priorities, which ran as interactive jobs.
+	Priority JobPriority `datastore:"priority"`
+	// Source is recorded on the page if the job fetches it (see CrawledPage.Source).
+	Source SourceRef `datastore:"source"`
+	// Error is the failure message of a failed job.
+	Error     string    `datastore:"error,noindex"`
+	CreatedAt time.Time `datastore:"created_at"`
+	UpdatedAt time.Time `datastore:"updated_at"`
+}
+
+// IdempotencyKey records the job created for a client-supplied idempotency key,
+// so that a retried request returns the same job instead of creating a new one.
+type IdempotencyKey struct {
+	Key string `datastore:"key"`
+	// RequestHash identifies the operation and arguments the key was first used with.
+	RequestHash string `datastore:"request_hash"`
+	JobID       string `datastore:"job_id"`
+	// ExpiresAt is when the key may be reused. A Firestore TTL policy on this field can delete expired keys.
+	ExpiresAt time.Time `datastore:"expires_at"`
+}
+
+// Expired reports whether the key has lapsed at time now.
+func (k *IdempotencyKey) Expired(now time.Time) bool {
+	return !now.Before(k.ExpiresAt)
+}
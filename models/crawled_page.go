@@ -1,70 +1,238 @@
 package models
 
-import (
-	"context"
-	"time"
-
-	"cloud.google.com/go/datastore"
-)
+import "time"
 
 // CrawledPageKind is the Datastore kind name for CrawledPage entities
 const CrawledPageKind = "CrawledPage"
 
-// CrawledPage represents a crawled web page stored in Datastore
-type CrawledPage struct {
-	URL      string    `datastore:"url"`
-	Title    string    `datastore:"title"`
-	Content  string    `datastore:"content,noindex"`
-	DateTime time.Time `datastore:"datetime"`
-}
+// CacheSource identifies where the content of a fetch result came from.
+type CacheSource string
+
+const (
+	// CacheSourceDatastore means the page was read from the Datastore cache.
+	CacheSourceDatastore CacheSource = "datastore"
+	// CacheSourceNetwork means the page was freshly fetched from its URL.
+	CacheSourceNetwork CacheSource = "network"
+	// CacheSourceArchive means the page was fetched from a web archive instead of its URL.
+	CacheSourceArchive CacheSource = "archive"
+	// CacheSourceRevalidated means the page was read from the Datastore cache after its server
+	// answered a conditional request with 304 Not Modified.
+	CacheSourceRevalidated CacheSource = "revalidated"
+)
+
+// ExtractionMethod identifies how the content of a page was extracted from its HTML.
+type ExtractionMethod string
+
+const (
+	// ExtractionMethodHeuristic means the content was taken from the main content element of the page.
+	ExtractionMethodHeuristic ExtractionMethod = "heuristic"
+	// ExtractionMethodReadability means the content was taken from the elements of the page with
+	// the most paragraph text, after removing navigation, comments and related links.
+	ExtractionMethodReadability ExtractionMethod = "readability"
+	// ExtractionMethodJSONLD means the content was taken from a schema.org Article in JSON-LD.
+	ExtractionMethodJSONLD ExtractionMethod = "json-ld"
+	// ExtractionMethodNewsletter means the content is the body of a newsletter email.
+	ExtractionMethodNewsletter ExtractionMethod = "newsletter"
+)
+
+// PaywallSource identifies where the content of a paywalled page was fetched from instead of its URL.
+type PaywallSource string
+
+const (
+	// PaywallSourceAMP means the content was fetched from the AMP version of the page.
+	PaywallSourceAMP PaywallSource = "amp"
+	// PaywallSourceArchive means the content was fetched from a copy of the page in a web archive.
+	PaywallSourceArchive PaywallSource = "archive"
+)
+
+// SourceKind is the kind of source a page came from.
+type SourceKind string
 
-// Key returns a Datastore key for a CrawledPage using the URL as the key name
-func MakeKey(url string) *datastore.Key {
-	return datastore.NameKey(CrawledPageKind, url, nil)
+const (
+	// SourceKindRSS means the page was an item of an RSS or Atom feed.
+	SourceKindRSS SourceKind = "rss"
+	// SourceKindSitemap means the page was listed in a sitemap.
+	SourceKindSitemap SourceKind = "sitemap"
+	// SourceKindCrawl means the page was found by following the links of a site from a seed URL.
+	SourceKindCrawl SourceKind = "crawl"
+	// SourceKindNewsletter means the page is the body of a newsletter or was linked from one.
+	SourceKindNewsletter SourceKind = "newsletter"
+	// SourceKindSocial means the page was shared in a watched social media account or hashtag.
+	SourceKindSocial SourceKind = "social"
+	// SourceKindSubmission means the URL was submitted manually, on the command line or through
+	// the API.
+	SourceKindSubmission SourceKind = "submission"
+)
+
+// SourceRef identifies the source a page came from.
+type SourceRef struct {
+	Kind SourceKind `datastore:"kind"`
+	// ID identifies the source within its kind: the URL of the feed, sitemap or crawl seed, the mailto: URL
+	// of the newsletter sender, the social watch (e.g. "bluesky:#april"), or the URL list file or
+	// API token name of a submission. It may be empty for submissions.
+	ID string `datastore:"id"`
 }
 
-// ReadCrawledPage retrieves a CrawledPage from Datastore by URL
-// Returns the CrawledPage and true if found, or nil and false if not found
-func ReadCrawledPage(ctx context.Context, client *datastore.Client, url string) (*CrawledPage, bool, error) {
-	var page CrawledPage
-	key := MakeKey(url)
+// IsZero reports whether the source is unknown, as for pages stored before sources were recorded.
+func (s SourceRef) IsZero() bool {
+	return s == SourceRef{}
+}
 
-	err := client.Get(ctx, key, &page)
-	if err == datastore.ErrNoSuchEntity {
-		return nil, false, nil
-	}
-	if err != nil {
-		return nil, false, err
-	}
+// Matches reports whether the source is filter: its ID, or its kind.
+func (s SourceRef) Matches(filter string) bool {
+	return !s.IsZero() && (s.ID == filter || string(s.Kind) == filter)
+}
 
-	return &page, true, nil
+// FeedItemMetadata is what the feed item a page was linked from says about it, which the page
+// itself may not declare.
+type FeedItemMetadata struct {
+	// Feed is the URL of the feed.
+	Feed string `datastore:"feed"`
+	// PublishedAt is the publication date of the item (its update date if it has none), zero if
+	// the item is undated.
+	PublishedAt time.Time `datastore:"published_at"`
+	// Author is the item author (comma-separated if several), empty if unknown.
+	Author string `datastore:"author,noindex"`
+	// Categories are the categories or tags of the item.
+	Categories []string `datastore:"categories"`
 }
 
-// WriteCrawledPage writes a new CrawledPage to Datastore
-// If datetime is zero, it will be set to the current time
-func WriteCrawledPage(
-	ctx context.Context,
-	client *datastore.Client,
-	url, title, content string,
-	datetime time.Time,
-) (*CrawledPage, error) {
-	if datetime.IsZero() {
-		datetime = time.Now()
-	}
+// IsZero reports whether the page was not linked from a feed item, or was stored before feed
+// items were recorded.
+func (f FeedItemMetadata) IsZero() bool {
+	return f.Feed == ""
+}
 
-	page := &CrawledPage{
-		URL:      url,
-		Title:    title,
-		Content:  content,
-		DateTime: datetime,
-	}
+// FetchDiagnostics describes the HTTP response a page was last fetched from, to debug
+// extraction problems and follow the health of sites.
+type FetchDiagnostics struct {
+	// Host is the host of the final URL, to group fetches by site.
+	Host string `datastore:"host"`
+	// StatusCode is the HTTP status of the response: 200, or 304 when the page was revalidated.
+	StatusCode int `datastore:"status_code"`
+	// LatencyMillis is the time from sending the request to reading the whole body, retries
+	// included.
+	LatencyMillis int64 `datastore:"latency_millis"`
+	// ContentType is the Content-Type header of the response.
+	ContentType string `datastore:"content_type,noindex"`
+	// BodyBytes is the size of the decoded response body.
+	BodyBytes int `datastore:"body_bytes,noindex"`
+	// Headers are the response headers useful to tell servers, CDNs and caches apart, as
+	// "Name: value" lines.
+	Headers []string `datastore:"headers,noindex"`
+}
 
-	key := MakeKey(url)
+// CrawledPage represents a crawled web page stored in Datastore
+type CrawledPage struct {
+	URL      string    `datastore:"url"`
+	Title    string    `datastore:"title"`
+	Content  string    `datastore:"content,noindex"`
+	DateTime time.Time `datastore:"datetime"`
+	// PublishedAt is when the article was published, as declared by the page.
+	// Zero if the page declares no publication date.
+	PublishedAt time.Time `datastore:"published_at"`
+	// Author is the article author (comma-separated if several), empty if unknown.
+	Author string `datastore:"author"`
+	// Description is the summary the page declares in og:description or its meta description,
+	// empty if it declares none.
+	Description string `datastore:"description,noindex"`
+	// CanonicalURL is the absolute URL the page declares as its canonical one (<link rel="canonical">
+	// or og:url), empty if it declares none.
+	CanonicalURL string `datastore:"canonical_url,noindex"`
+	// FinalURL is the absolute URL the page was read from after following redirects, and
+	// RedirectChain the URLs redirected from to reach it, starting with the requested one.
+	// RedirectChain is empty if the request wasn't redirected.
+	FinalURL      string   `datastore:"final_url,noindex"`
+	RedirectChain []string `datastore:"redirect_chain,noindex"`
+	// Fetch describes the response the page was last fetched or revalidated from. Zero for
+	// pages stored before it was recorded and for pages that weren't fetched over HTTP.
+	Fetch FetchDiagnostics `datastore:"fetch"`
+	// ExtractionMethod is how Content was extracted. Empty for pages stored before it was recorded.
+	ExtractionMethod ExtractionMethod `datastore:"extraction_method"`
+	// Rendered is true if the page was loaded in a browser because its HTML had too little text.
+	Rendered bool `datastore:"rendered"`
+	// Language is the ISO 639-1 code of the page language (e.g. "en", "de").
+	// Empty if the language has not been detected.
+	Language string `datastore:"language"`
+	// WordCount is the number of words of Content and ReadingMinutes the estimated time to read
+	// it (see lib.ReadingMinutes). Both are zero for pages stored before they were recorded.
+	WordCount      int `datastore:"word_count"`
+	ReadingMinutes int `datastore:"reading_minutes"`
+	// ImageURL is the absolute URL of the article's lead image, as declared by the page
+	// (JSON-LD Article image, og:image or twitter:image). Empty if the page declares none.
+	ImageURL string `datastore:"image_url"`
+	// Screenshot is where the screenshot of the page taken in a headless browser is stored: a
+	// gs:// URL or a file path. Empty if no screenshot was taken.
+	Screenshot string `datastore:"screenshot,noindex"`
+	// NoIndex is true if the page carries a robots noindex directive.
+	NoIndex bool `datastore:"noindex"`
+	// NoAI is true if the page carries a noai directive.
+	NoAI bool `datastore:"noai"`
+	// ETag and LastModified are the validators of the fetched response, sent back in
+	// If-None-Match and If-Modified-Since when the page is revalidated. Empty if the server
+	// sent none.
+	ETag         string `datastore:"etag,noindex"`
+	LastModified string `datastore:"last_modified,noindex"`
+	// ValidatedAt is when the server last confirmed that the stored content is current, zero if
+	// it never was. DateTime stays the time the content was fetched.
+	ValidatedAt time.Time `datastore:"validated_at"`
+	// Source is the feed, sitemap, newsletter, social watch or submission the page was stored
+	// from. Zero for pages stored before sources were recorded.
+	Source SourceRef `datastore:"source"`
+	// FeedItem is the metadata of the feed item the page was last fetched from, zero if it was
+	// not fetched from a feed.
+	FeedItem FeedItemMetadata `datastore:"feed_item"`
+	// ContentHash is the SHA-256 of Content (see lib.ContentHash). Empty for pages stored before
+	// it was recorded.
+	ContentHash string `datastore:"content_hash"`
+	// DuplicateOf is the URL of the page stored earlier with the same content, empty if the page
+	// is not a duplicate. The content of a duplicate is not stored again: Content is empty until
+	// it is read from that page (see lib.ReadLinkedPage).
+	DuplicateOf string `datastore:"duplicate_of"`
+	// AliasOf is the URL the page is stored under when this URL redirects to it or declares it
+	// as its canonical URL, as shortened and tracking links from feeds do. The entity of an alias
+	// only records the link and when it was made; the page is read from that URL (see
+	// lib.ReadLinkedPage).
+	AliasOf string `datastore:"alias_of"`
+	// Paywalled is true if the page looked paywalled or truncated when it was fetched, whether
+	// or not another source of its content was found. Only detected when the fetcher falls back
+	// on other sources.
+	Paywalled bool `datastore:"paywalled"`
+	// PaywallSource is where the content of a paywalled page was fetched from, and ContentURL
+	// its URL. Both are empty if the content was fetched from the page URL.
+	PaywallSource PaywallSource `datastore:"paywall_source"`
+	ContentURL    string        `datastore:"content_url,noindex"`
+	// RobotsExcluded is true if the page was not stored because of its robots directives, or was
+	// read from Datastore with directives excluding it under the policy of the fetch.
+	// It is only set on fetch results and never persisted.
+	RobotsExcluded bool `datastore:"-" firestore:"-"`
+	// CacheSource is where the content of this fetch result came from.
+	// It is only set on fetch results and never persisted.
+	CacheSource CacheSource `datastore:"-" firestore:"-"`
+	// Feed is the URL of the RSS feed the page was fetched from, empty for single URL fetches.
+	// It is only set on fetch results and never persisted.
+	Feed string `datastore:"-" firestore:"-"`
+}
 
-	_, err := client.Put(ctx, key, page)
-	if err != nil {
-		return nil, err
+// PublishedTime returns when the article was published: the date the page declares, or that of
+// the feed item it was linked from. Zero if neither is known.
+func (p *CrawledPage) PublishedTime() time.Time {
+	if !p.PublishedAt.IsZero() {
+		return p.PublishedAt
 	}
+	return p.FeedItem.PublishedAt
+}
 
-	return page, nil
+// CrawledPageQuery selects stored CrawledPages, ordered by DateTime and then key, a batch at a time.
+type CrawledPageQuery struct {
+	// Since and Until select the pages crawled at or after Since and before Until. A zero time
+	// means no bound.
+	Since time.Time
+	Until time.Time
+	// Language, if set, selects the pages detected to be in a language (ISO 639-1 code).
+	Language string
+	// Limit is the most pages returned. Zero means no limit.
+	Limit int
+	// After, if set, is the last page of the previous batch: the query continues after it.
+	After *CrawledPage
 }
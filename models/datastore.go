@@ -0,0 +1,124 @@
+//go:build !nocloud
+
+package models
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// Key returns a Datastore key for a CrawledPage using the URL as the key name
+func MakeKey(url string) *datastore.Key {
+	return datastore.NameKey(CrawledPageKind, url, nil)
+}
+
+// ReadCrawledPage retrieves a CrawledPage from Datastore by URL
+// Returns the CrawledPage and true if found, or nil and false if not found
+func ReadCrawledPage(ctx context.Context, client *datastore.Client, url string) (*CrawledPage, bool, error) {
+	var page CrawledPage
+	key := MakeKey(url)
+
+	err := client.Get(ctx, key, &page)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &page, true, nil
+}
+
+// WriteCrawledPage writes a new CrawledPage to Datastore
+// If datetime is zero, it will be set to the current time
+func WriteCrawledPage(
+	ctx context.Context,
+	client *datastore.Client,
+	url, title, content string,
+	datetime time.Time,
+) (*CrawledPage, error) {
+	if datetime.IsZero() {
+		datetime = time.Now()
+	}
+
+	page := &CrawledPage{
+		URL:      url,
+		Title:    title,
+		Content:  content,
+		DateTime: datetime,
+	}
+
+	key := MakeKey(url)
+
+	_, err := client.Put(ctx, key, page)
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// normalizeURL normalizes a URL by removing the protocol (http:// or https://) and query parameters.
+// This is a local copy to avoid import cycles with lib.
+func normalizeURL(url string) string {
+	// Remove http:// or https:// from the front
+	normalized := strings.TrimPrefix(url, "https://")
+	normalized = strings.TrimPrefix(normalized, "http://")
+
+	// Remove query parameters (everything after ?)
+	if idx := strings.Index(normalized, "?"); idx != -1 {
+		normalized = normalized[:idx]
+	}
+
+	return normalized
+}
+
+// MakeAnalysisResultKey returns a Datastore key for an AnalysisResult using the URL and mode as the key name.
+// The key name format is "url:mode" to ensure uniqueness per URL and mode combination.
+// The URL is normalized before creating the key.
+func MakeAnalysisResultKey(url, mode string) *datastore.Key {
+	normalizedURL := normalizeURL(url)
+	keyName := normalizedURL + ":" + mode
+	return datastore.NameKey(AnalysisResultKind, keyName, nil)
+}
+
+// ReadAnalysisResult retrieves an AnalysisResult from Datastore by URL and mode.
+// Returns the AnalysisResult and true if found, or nil and false if not found.
+func ReadAnalysisResult(
+	ctx context.Context,
+	client *datastore.Client,
+	url, mode string,
+) (*AnalysisResult, bool, error) {
+	var result AnalysisResult
+	key := MakeAnalysisResultKey(url, mode)
+
+	err := client.Get(ctx, key, &result)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &result, true, nil
+}
+
+// WriteAnalysisResult creates and saves a new AnalysisResult to Datastore.
+func WriteAnalysisResult(
+	ctx context.Context,
+	client *datastore.Client,
+	url string,
+	result *AnalysisResult,
+) error {
+	key := MakeAnalysisResultKey(url, string(result.Mode))
+
+	_, err := client.Put(ctx, key, result)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// DomainBoilerplateKind is the Datastore kind name for DomainBoilerplate entities
+const DomainBoilerplateKind = "DomainBoilerplate"
+
+// DomainBoilerplate tracks the text blocks seen on the pages fetched from a host, so that blocks
+// repeated on many pages (navigation, footers, newsletter prompts) can be stripped from articles.
+type DomainBoilerplate struct {
+	// Host is the host name of the pages, e.g. www.example.com.
+	Host string `datastore:"host"`
+	// Pages is the number of distinct pages of the host whose blocks were tracked.
+	Pages int `datastore:"pages"`
+	// Segments are the tracked blocks, most frequent first.
+	Segments []SegmentCount `datastore:"segments,noindex"`
+	// URLHashes are hashes of the URLs of the most recently tracked pages, so that a page fetched
+	// again is not counted twice.
+	URLHashes []int64   `datastore:"url_hashes,noindex"`
+	UpdatedAt time.Time `datastore:"updated_at"`
+}
+
+// SegmentCount is a text block tracked for a host.
+type SegmentCount struct {
+	// Simhash is the simhash of the block text; blocks with close simhashes count as the same.
+	Simhash int64 `datastore:"simhash"`
+	// Pages is the number of pages the block was seen on.
+	Pages int `datastore:"pages"`
+	// LastSeen is the value of DomainBoilerplate.Pages when the block was last seen.
+	LastSeen int `datastore:"last_seen"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// EventsCursorKind is the Datastore kind name for EventsCursor entities
+const EventsCursorKind = "EventsCursor"
+
+// EventsCursor records up to which analysis of a mode the likely jokes were queued for the
+// webhooks, so that a restarted server queues those analyzed while it was down.
+type EventsCursor struct {
+	Mode AnalysisMode `datastore:"mode"`
+	// Since is the AnalyzedAt of the latest analysis queued, or skipped as not a likely joke.
+	Since     time.Time `datastore:"since"`
+	UpdatedAt time.Time `datastore:"updated_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+// FeedAuthType is the kind of credentials a private feed requires.
+type FeedAuthType string
+
+const (
+	// FeedAuthBasic sends HTTP basic auth with Username and the secret as password.
+	FeedAuthBasic FeedAuthType = "basic"
+	// FeedAuthBearer sends "Authorization: Bearer <secret>".
+	FeedAuthBearer FeedAuthType = "bearer"
+	// FeedAuthHeader sends the secret as the value of the header named Header.
+	FeedAuthHeader FeedAuthType = "header"
+)
+
+// FeedAuth references the credentials needed to fetch a private feed and its articles.
+// The secret itself lives in the secrets provider (see lib.ReadSecret) and is referenced by name,
+// so it is never stored alongside the feed.
+type FeedAuth struct {
+	Type FeedAuthType `datastore:"type"`
+	// Username is the basic auth user name. Only used by FeedAuthBasic.
+	Username string `datastore:"username"`
+	// Header is the name of the header to send. Only used by FeedAuthHeader.
+	Header string `datastore:"header"`
+	// SecretName is the name of the secret holding the password, token or header value.
+	SecretName string `datastore:"secret_name"`
+}
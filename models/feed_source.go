@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// FeedSourceKind is the Datastore kind name for FeedSource entities
+const FeedSourceKind = "FeedSource"
+
+// FeedSource is a feed registered for crawling, so that the set of feeds lives in the Datastore
+// instead of being passed on the command line of every run. Feeds are keyed by URL.
+type FeedSource struct {
+	// URL is the URL of the feed, as polled.
+	URL string `datastore:"url"`
+	// Name is a label for the feed, empty if none was given.
+	Name string `datastore:"name,noindex"`
+	// Enabled is false for feeds kept in the registry but not crawled.
+	Enabled bool `datastore:"enabled"`
+	// PollInterval is the time between two polls of the feed by the crawler daemon, zero for
+	// the daemon's default.
+	PollInterval time.Duration `datastore:"poll_interval,noindex"`
+	// Modes are the analysis modes run on the articles of the feed, empty for the crawler's
+	// --mode.
+	Modes []AnalysisMode `datastore:"modes,noindex"`
+	// MaxArticles is the number of newest items fetched per poll, zero for the crawler's --max.
+	MaxArticles int `datastore:"max_articles,noindex"`
+	// HostDelay is the minimum time between the starts of two requests to the same host while
+	// fetching the articles of the feed, zero for the crawler's --host-delay.
+	HostDelay time.Duration `datastore:"host_delay,noindex"`
+	CreatedAt time.Time     `datastore:"created_at"`
+	UpdatedAt time.Time     `datastore:"updated_at"`
+}
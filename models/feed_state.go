@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// FeedStateKind is the Datastore kind name for FeedState entities
+const FeedStateKind = "FeedState"
+
+// FeedState records the last response of a polled feed, so that the next poll sends a
+// conditional request and an unchanged feed is neither downloaded nor parsed again.
+type FeedState struct {
+	// URL is the URL of the feed, as polled.
+	URL string `datastore:"url"`
+	// ETag and LastModified are the validators of the last full response, sent back in
+	// If-None-Match and If-Modified-Since. Empty if the server sent none.
+	ETag         string `datastore:"etag,noindex"`
+	LastModified string `datastore:"last_modified,noindex"`
+	// Items are the items of the last full response, in feed order, used when the server
+	// answers 304 Not Modified. For a paginated feed (RFC 5005), they include the items of the
+	// next pages that were read.
+	Items []FeedStateItem `datastore:"items,noindex"`
+	// NextPage is the URL of the first page of a paginated feed that was not read, to read more
+	// items after a 304 Not Modified. Empty if the last page was read.
+	NextPage string `datastore:"next_page,noindex"`
+	// ModifiedAt is when the feed or one of its pages was last downloaded and parsed.
+	ModifiedAt time.Time `datastore:"modified_at"`
+}
+
+// FeedStateItem is an item of a feed, as recorded in its FeedState.
+type FeedStateItem struct {
+	Link  string `datastore:"link,noindex"`
+	Title string `datastore:"title,noindex"`
+	// Description is the start of the item description, and Published when the item was
+	// published, for the item filters. Published is zero if the item has no date.
+	Description string    `datastore:"description,noindex"`
+	Published   time.Time `datastore:"published,noindex"`
+	// Author and Categories are recorded on the pages of the items (see FeedItemMetadata).
+	Author     string   `datastore:"author,noindex"`
+	Categories []string `datastore:"categories,noindex"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// FetchErrorKind is the Datastore kind name for FetchError entities
+const FetchErrorKind = "FetchError"
+
+// FetchError records the consecutive failed fetches of a URL, so that URLs that keep failing are
+// skipped for a while instead of being fetched again on every poll. It is deleted once the URL
+// is fetched.
+type FetchError struct {
+	// URL is the normalized URL of the page.
+	URL string `datastore:"url"`
+	// StatusCode is the HTTP status of the last failed fetch, 0 if there was no response.
+	StatusCode int `datastore:"status_code"`
+	// Error is the error of the last failed fetch.
+	Error string `datastore:"error,noindex"`
+	// Attempts is the number of consecutive failed fetches.
+	Attempts int `datastore:"attempts"`
+	// FailedAt is when the last fetch failed.
+	FailedAt time.Time `datastore:"failed_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// JokeLabelKind is the Datastore kind name for JokeLabel entities
+const JokeLabelKind = "JokeLabel"
+
+// JokeLabel is a human verdict on whether an article is a joke, used to check how well the
+// LLM's joke percentages are calibrated. There is one label per URL; a new label replaces it.
+type JokeLabel struct {
+	// URL is the normalized URL of the labeled page.
+	URL    string `datastore:"url"`
+	IsJoke bool   `datastore:"is_joke"`
+	// Labeler identifies who labeled the article, e.g. an API token name. Empty if unknown.
+	Labeler   string    `datastore:"labeler"`
+	CreatedAt time.Time `datastore:"created_at"`
+}
+
+// LabelVerdict describes a label verdict: "joke" or "not a joke".
+func LabelVerdict(isJoke bool) string {
+	if isJoke {
+		return "joke"
+	}
+	return "not a joke"
+}
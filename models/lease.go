@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// LeaseKind is the Datastore kind name for Lease entities
+const LeaseKind = "Lease"
+
+// Lease is a time-limited lock on a named resource (e.g. an RSS feed),
+// used so that only one crawler instance works on the resource at a time.
+type Lease struct {
+	// Name identifies the leased resource.
+	Name string `datastore:"name"`
+	// Holder identifies the instance holding the lease.
+	Holder string `datastore:"holder"`
+	// ExpiresAt is when the lease lapses unless renewed by its holder.
+	ExpiresAt time.Time `datastore:"expires_at"`
+}
+
+// Expired reports whether the lease has lapsed at time now.
+func (l *Lease) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
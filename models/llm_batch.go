@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// LlmBatchKind is the Datastore kind name for LlmBatch entities
+const LlmBatchKind = "LlmBatch"
+
+// LlmBatch is a batch of analyses submitted to the OpenAI Batch API. The pending analyses it
+// contains have its ID as their BatchID.
+type LlmBatch struct {
+	// ID is the ID of the batch in the OpenAI API.
+	ID    string `datastore:"id"`
+	Model string `datastore:"model"`
+	// Status is the last status reported by the API: validating, in_progress, finalizing,
+	// completed, failed, expired, cancelling or cancelled.
+	Status       string `datastore:"status"`
+	InputFileID  string `datastore:"input_file_id,noindex"`
+	OutputFileID string `datastore:"output_file_id,noindex"`
+	// Requests is the number of analyses in the batch.
+	Requests int `datastore:"requests,noindex"`
+	// Completed and Failed are the number of requests the API has finished so far.
+	Completed int       `datastore:"completed,noindex"`
+	Failed    int       `datastore:"failed,noindex"`
+	CreatedAt time.Time `datastore:"created_at"`
+	UpdatedAt time.Time `datastore:"updated_at"`
+	// CollectedAt is when the results of the batch were stored, zero while the batch is open.
+	CollectedAt time.Time `datastore:"collected_at"`
+}
+
+// Open reports whether the results of the batch have not been collected yet.
+func (b *LlmBatch) Open() bool {
+	return b.CollectedAt.IsZero()
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// LlmCallKind is the Datastore kind name for LlmCall entities
+const LlmCallKind = "LlmCall"
+
+// LlmCall records one request to an LLM and its response, used to find out weeks later why an
+// article got an unexpected score. Calls are deleted after their retention period.
+type LlmCall struct {
+	// URL is the normalized URL of the page being analyzed, empty for calls made outside an analysis.
+	URL string `datastore:"url"`
+	// Mode is the analysis mode of the call, empty for calls made outside an analysis.
+	Mode     AnalysisMode `datastore:"mode"`
+	Model    string       `datastore:"model"`
+	Provider string       `datastore:"provider"`
+	// PromptHash is the SHA-256 of the prompt, so that calls with the same prompt can be found
+	// without storing whole articles.
+	PromptHash string `datastore:"prompt_hash"`
+	// ImageURL is the image sent with the prompt, empty for text-only calls.
+	ImageURL string `datastore:"image_url"`
+	// Response is the raw text returned by the LLM, empty if the call failed.
+	Response string `datastore:"response,noindex"`
+	// Error is the error of a failed call, empty if it succeeded.
+	Error            string    `datastore:"error,noindex"`
+	LatencyMillis    int64     `datastore:"latency_millis"`
+	PromptTokens     int       `datastore:"prompt_tokens"`
+	CompletionTokens int       `datastore:"completion_tokens"`
+	CreatedAt        time.Time `datastore:"created_at"`
+	// ExpiresAt is when the call may be deleted. A Firestore TTL policy on this field deletes
+	// expired calls automatically.
+	ExpiresAt time.Time `datastore:"expires_at"`
+}
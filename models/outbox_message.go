@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// OutboxMessageKind is the Datastore kind name for OutboxMessage entities
+const OutboxMessageKind = "OutboxMessage"
+
+// OutboxStatus is the delivery progress of an OutboxMessage.
+type OutboxStatus string
+
+const (
+	// OutboxStatusPending messages are waiting for their first or next delivery attempt.
+	OutboxStatusPending OutboxStatus = "pending"
+	// OutboxStatusDelivered messages were accepted by their destination.
+	OutboxStatusDelivered OutboxStatus = "delivered"
+	// OutboxStatusFailed messages were given up after too many failed attempts.
+	OutboxStatusFailed OutboxStatus = "failed"
+)
+
+// OutboxMessage is a notification to send to a webhook. It is stored before any delivery
+// attempt, so that it is retried if the destination or the sending process fails.
+type OutboxMessage struct {
+	// ID identifies the message, derived from its destination and content so that the same
+	// notification queued by several instances is only stored once. It is sent to the
+	// destination to let it ignore repeated deliveries.
+	ID          string `datastore:"id"`
+	Destination string `datastore:"destination"`
+	// Event is the type of notification, e.g. "item" for a newly analyzed likely joke.
+	Event string `datastore:"event"`
+	// Payload is the JSON body sent to the destination.
+	Payload []byte       `datastore:"payload,noindex"`
+	Status  OutboxStatus `datastore:"status"`
+	// Attempts is the number of failed delivery attempts so far.
+	Attempts int `datastore:"attempts,noindex"`
+	// LastError is the failure of the latest attempt, empty if there was none.
+	LastError string `datastore:"last_error,noindex"`
+	// NextAttemptAt is when a pending message is due for delivery.
+	NextAttemptAt time.Time `datastore:"next_attempt_at"`
+	CreatedAt     time.Time `datastore:"created_at"`
+	// DeliveredAt is when the destination accepted the message, zero until then.
+	DeliveredAt time.Time `datastore:"delivered_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// PageEmbeddingKind is the Datastore kind name for PageEmbedding entities
+const PageEmbeddingKind = "PageEmbedding"
+
+// PageEmbedding is the embedding vector of a crawled page, used to find near-duplicate articles.
+type PageEmbedding struct {
+	// URL is the normalized URL of the page.
+	URL string `datastore:"url"`
+	// Model is the embedding model that produced Vector. Vectors from different models can't be compared.
+	Model string `datastore:"model"`
+	// Vector is the embedding of the page title and content.
+	Vector []float64 `datastore:"vector,noindex"`
+	// CreatedAt is when the embedding was computed.
+	CreatedAt time.Time `datastore:"created_at"`
+}
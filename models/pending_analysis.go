@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// PendingAnalysisKind is the Datastore kind name for PendingAnalysis entities
+const PendingAnalysisKind = "PendingAnalysis"
+
+// PendingAnalysis marks a crawled page whose analysis was deferred because the LLM was unavailable,
+// or queued for the OpenAI Batch API. A backfill pass, or the collection of the batch, analyzes the
+// page later and removes the marker.
+type PendingAnalysis struct {
+	// URL is the URL of the crawled page.
+	URL string `datastore:"url"`
+	// Mode is the analysis mode to run.
+	Mode AnalysisMode `datastore:"mode"`
+	// Feed is the URL of the RSS feed the page came from, empty for single URL fetches.
+	Feed string `datastore:"feed"`
+	// Error is the last error that kept the page from being analyzed.
+	Error string `datastore:"error,noindex"`
+	// Attempts is the number of analyses tried so far, including the one that was deferred.
+	Attempts int `datastore:"attempts"`
+	// CreatedAt is when the analysis was first deferred.
+	CreatedAt time.Time `datastore:"created_at"`
+	// UpdatedAt is when the marker was last written.
+	UpdatedAt time.Time `datastore:"updated_at"`
+	// Batch is true if the analysis waits for the Batch API rather than a backfill pass.
+	Batch bool `datastore:"batch"`
+	// BatchID is the ID of the LlmBatch the analysis was submitted in, empty until it is submitted.
+	BatchID string `datastore:"batch_id"`
+	// PromptHash is the SHA-256 of the prompt submitted in the batch.
+	PromptHash string `datastore:"prompt_hash,noindex"`
+}
@@ -3,39 +3,145 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/crawler/config"
+	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/crawler/socialfetcher"
+	"github.com/zeace/poisson/crawler/utils"
 	"github.com/zeace/poisson/graph"
 	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+	"github.com/zeace/poisson/models"
+	"github.com/zeace/poisson/server"
 )
 
 func main() {
 	ctx := context.Background()
 
+	// Log level and format come from POISSON_LOG_LEVEL and POISSON_LOG_FORMAT
+	if err := logging.Init("", ""); err != nil {
+		fatal("Invalid logging configuration", err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "create-token" {
+		runCreateToken(ctx, os.Args[2:])
+		return
+	}
+
 	// Initialize Datastore client with embedded credentials
 	datastoreClient, err := lib.CreateDatastoreClient(ctx)
 	if err != nil {
-		log.Fatalf("Failed to create datastore client: %v", err)
+		fatal("Failed to create datastore client", err)
 	}
 	defer datastoreClient.Close()
 
+	// Prompt templates are read again while the server runs, so that prompt changes don't need a redeploy
+	if source := config.GetPromptSource(""); source != "" {
+		loadCtx, loadCancel := config.NewPromptLoadContext()
+		loaded, err := analyzer.LoadPromptTemplates(loadCtx, source)
+		loadCancel()
+		if err != nil {
+			fatal("Invalid POISSON_PROMPTS", err)
+		}
+		slog.Info("Loaded prompt templates", "source", source, "modes", loaded)
+		if interval := getPromptReloadInterval(); interval > 0 {
+			go analyzer.WatchPromptTemplates(ctx, source, interval)
+		}
+	}
+
+	// Joke keywords are part of the joke prompt fingerprint, so set them before any analysis
+	jokeKeywords, err := analyzer.ParseJokeKeywords(config.GetJokeKeywords(""))
+	if err != nil {
+		fatal("Invalid POISSON_JOKE_KEYWORDS", err)
+	}
+	analyzer.JokeScoring.Keywords = jokeKeywords
+	minContentLengths, err := analyzer.ParseMinContentLengths(config.GetMinContentLengths(""))
+	if err != nil {
+		fatal("Invalid POISSON_MIN_CONTENT_LENGTH", err)
+	}
+	analyzer.SetMinContentLengths(minContentLengths)
+	minWordCounts, err := analyzer.ParseMinWordCounts(config.GetMinWordCounts(""))
+	if err != nil {
+		fatal("Invalid POISSON_MIN_WORD_COUNT", err)
+	}
+	analyzer.SetMinWordCounts(minWordCounts)
+
+	// Start the background workers for crawlUrl/reanalyze jobs
+	maxAge, err := utils.ParseMaxAge(config.GetMaxAnalysisAge(""))
+	if err != nil {
+		fatal("Invalid POISSON_MAX_ANALYSIS_AGE", err)
+	}
+	llmOptions := analyzer.LlmOptions{
+		APIKey:  config.GetOpenAIKey(""),
+		BaseURL: config.GetOpenAIBaseURL(""),
+		Model:   config.GetOpenAIModel(""),
+		MaxAge:  maxAge,
+	}
+	// Serverless deployments without a writable disk set POISSON_PAGE_CACHE to memory or a bucket
+	fileCacheMaxSize, err := fetcher.ParseFileCacheMaxSize(config.GetFileCacheMaxSize(""))
+	if err != nil {
+		fatal("Invalid POISSON_FILE_CACHE_MAX_SIZE", err)
+	}
+	pageCache, err := fetcher.OpenPageCache(config.GetPageCache(""), fileCacheMaxSize)
+	if err != nil {
+		fatal("Invalid POISSON_PAGE_CACHE", err)
+	}
+	// Submitted URLs are refused on the internal network unless it is allowed
+	fetchOptions := fetcher.Options{AllowPrivateAddresses: getAllowPrivateAddresses(), Cache: pageCache}
+	jobQueue := server.NewJobQueue(datastoreClient, server.NewPipelineProcessor(datastoreClient, fetchOptions, llmOptions),
+		getJobWorkers(), server.DefaultJobQueueSize)
+	jobQueue.Start(ctx)
+
+	// Poll for new likely jokes to send on the /events stream
+	feedEvents := server.NewFeedEvents(datastoreClient, analyzer.AnalysisModeJoke,
+		getEventsMinConfidence(), server.DefaultEventsInterval)
+	// Also send them to webhooks, through an outbox that retries failed deliveries
+	if webhooks := getWebhooks(); len(webhooks) > 0 {
+		outbox := server.NewOutbox(datastoreClient, server.DefaultOutboxInterval, server.DefaultOutboxMaxAttempts)
+		outbox.Start(ctx)
+		feedEvents.SendToWebhooks(outbox, webhooks)
+	}
+	feedEvents.Start(ctx)
+
+	// Queue the articles shared in the watched Mastodon and Bluesky accounts and hashtags
+	socialSources, err := socialfetcher.ParseSources(os.Getenv("POISSON_SOCIAL_SOURCES"))
+	if err != nil {
+		fatal("Invalid POISSON_SOCIAL_SOURCES", err)
+	}
+	if len(socialSources) > 0 {
+		socialOptions := socialfetcher.Options{MastodonToken: os.Getenv("POISSON_MASTODON_TOKEN")}
+		server.NewSocialWatcher(jobQueue, socialSources, socialOptions, analyzer.AnalysisModeJoke).Start(ctx)
+		slog.Info("Watching social sources", "sources", len(socialSources))
+	}
+
+	// Serve the feed from cache, refreshing stale feeds in the background
+	var feedCache *server.FeedCache
+	if ttl := getFeedCacheTTL(); ttl > 0 {
+		feedCache = server.NewFeedCache(datastoreClient, ttl, server.DefaultFeedCacheMaxStale)
+	}
+
 	// Set up and start the server
-	server := setupServer(datastoreClient)
+	httpServer := setupServer(datastoreClient, jobQueue, feedCache, feedEvents)
 	port := getPort()
 
-	log.Printf("Starting GraphQL server on port %s", port)
-	if err := http.ListenAndServe(":"+port, server); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	slog.Info("Starting GraphQL server", "port", port)
+	if err := http.ListenAndServe(":"+port, httpServer); err != nil {
+		fatal("Server failed to start", err)
 	}
 }
 
-func NewGraphQLHandler(datastoreClient lib.DatastoreClient) (*handler.Server, error) {
+func NewGraphQLHandler(datastoreClient lib.DatastoreClient, jobQueue *server.JobQueue, feedCache *server.FeedCache) (*handler.Server, error) {
 	// Create resolver
-	resolver := graph.NewResolver(datastoreClient)
+	resolver := graph.NewResolverWithJobQueue(datastoreClient, jobQueue).WithFeedCache(feedCache)
 
 	// Create executable schema
 	executableSchema := graph.NewExecutableSchema(graph.Config{
@@ -54,33 +160,50 @@ func NewPlaygroundHandler() http.Handler {
 }
 
 // setupServer creates and configures the HTTP server with all routes
-func setupServer(datastoreClient lib.DatastoreClient) http.Handler {
+func setupServer(datastoreClient lib.DatastoreClient, jobQueue *server.JobQueue, feedCache *server.FeedCache, feedEvents *server.FeedEvents) http.Handler {
 	// Create GraphQL handler
-	graphqlHandler, err := NewGraphQLHandler(datastoreClient)
+	graphqlHandler, err := NewGraphQLHandler(datastoreClient, jobQueue, feedCache)
 	if err != nil {
-		log.Fatalf("Failed to create GraphQL handler: %v", err)
+		fatal("Failed to create GraphQL handler", err)
 	}
 
 	playgroundHandler := NewPlaygroundHandler()
 
 	// Set up HTTP routes
 	mux := http.NewServeMux()
-	setupRoutes(mux, graphqlHandler, playgroundHandler)
+	requireAPIToken := getRequireAPIToken()
+	setupRoutes(mux,
+		withAPIToken(datastoreClient, requireAPIToken, graphqlHandler),
+		withAPIToken(datastoreClient, requireAPIToken, server.NewSubmissionsHandler(jobQueue)),
+		withAPIToken(datastoreClient, requireAPIToken, feedEvents),
+		playgroundHandler)
 
 	return mux
 }
 
 // setupRoutes registers all HTTP routes with the provided mux
-func setupRoutes(mux *http.ServeMux, graphqlHandler *handler.Server, playgroundHandler http.Handler) {
+func setupRoutes(mux *http.ServeMux, graphqlHandler, submissionsHandler, eventsHandler, playgroundHandler http.Handler) {
 	// GraphQL endpoints with CORS middleware
 	mux.HandleFunc("/", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("graphql request\n")
-		graphqlHandler.ServeHTTP(w, r)
+		slog.InfoContext(r.Context(), "graphql request", "path", r.URL.Path)
+		graphqlHandler.ServeHTTP(w, withIdempotencyKey(r))
 	}))
 
 	mux.HandleFunc("/graphql", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("graphql request\n")
-		graphqlHandler.ServeHTTP(w, r)
+		slog.InfoContext(r.Context(), "graphql request", "path", r.URL.Path)
+		graphqlHandler.ServeHTTP(w, withIdempotencyKey(r))
+	}))
+
+	// Batches of URLs submitted by external services (webhooks, other scrapers)
+	mux.HandleFunc("/api/v1/submissions", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "submissions request", "path", r.URL.Path)
+		submissionsHandler.ServeHTTP(w, withIdempotencyKey(r))
+	}))
+
+	// Server-Sent Events stream of new likely jokes, for dashboards
+	mux.HandleFunc("/events", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "events request", "path", r.URL.Path)
+		eventsHandler.ServeHTTP(w, r)
 	}))
 
 	// Health check endpoint
@@ -88,7 +211,7 @@ func setupRoutes(mux *http.ServeMux, graphqlHandler *handler.Server, playgroundH
 
 	// GraphQL playground endpoint
 	mux.HandleFunc("/graphiql", func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("playground request\n")
+		slog.InfoContext(r.Context(), "playground request")
 		playgroundHandler.ServeHTTP(w, r)
 	})
 }
@@ -97,11 +220,110 @@ func setupRoutes(mux *http.ServeMux, graphqlHandler *handler.Server, playgroundH
 func healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(map[string]string{"status": "ok"}); err != nil {
-		log.Printf("Failed to encode health response: %v", err)
+		slog.ErrorContext(r.Context(), "Failed to encode health response", "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
 
+// fatal logs an error and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// withIdempotencyKey stores the Idempotency-Key header of the request in its context
+// so that job mutations can deduplicate retried requests.
+func withIdempotencyKey(r *http.Request) *http.Request {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		return r
+	}
+	return r.WithContext(server.WithIdempotencyKey(r.Context(), key))
+}
+
+// withAPIToken authenticates the bearer token sent in the Authorization header, if any, and stores
+// it in the request context for the resolvers' scope checks. Requests with an invalid token are
+// refused. If required is true, resolvers also refuse requests without a token.
+func withAPIToken(datastoreClient lib.DatastoreClient, required bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var token *models.APIToken
+		if raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			var err error
+			token, err = server.AuthenticateAPIToken(r.Context(), datastoreClient, raw)
+			if err != nil {
+				slog.WarnContext(r.Context(), "API token authentication failed", "error", err)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(server.WithAPIToken(r.Context(), token, required)))
+	})
+}
+
+// getRequireAPIToken returns whether POISSON_REQUIRE_API_TOKEN requires an API token on every request
+func getRequireAPIToken() bool {
+	required, _ := strconv.ParseBool(os.Getenv("POISSON_REQUIRE_API_TOKEN"))
+	return required
+}
+
+// getAllowPrivateAddresses returns whether POISSON_ALLOW_PRIVATE_ADDRESSES lets submitted pages be
+// fetched from private, loopback and link-local addresses
+func getAllowPrivateAddresses() bool {
+	allowed, _ := strconv.ParseBool(os.Getenv("POISSON_ALLOW_PRIVATE_ADDRESSES"))
+	return allowed
+}
+
+// getEventsMinConfidence returns the lowest joke confidence sent on the /events stream from the
+// POISSON_EVENTS_MIN_CONFIDENCE environment variable or the default
+func getEventsMinConfidence() int {
+	minConfidence, err := strconv.Atoi(os.Getenv("POISSON_EVENTS_MIN_CONFIDENCE"))
+	if err != nil || minConfidence < 0 {
+		return server.DefaultEventsMinConfidence
+	}
+	return minConfidence
+}
+
+// getWebhooks returns the URLs notified of new likely jokes from the comma-separated
+// POISSON_WEBHOOK_URLS environment variable
+func getWebhooks() []string {
+	var webhooks []string
+	for _, webhook := range strings.Split(os.Getenv("POISSON_WEBHOOK_URLS"), ",") {
+		if webhook = strings.TrimSpace(webhook); webhook != "" {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks
+}
+
+// getJobWorkers returns the number of job workers from the POISSON_JOB_WORKERS environment variable or the default
+func getJobWorkers() int {
+	workers, err := strconv.Atoi(os.Getenv("POISSON_JOB_WORKERS"))
+	if err != nil || workers <= 0 {
+		return server.DefaultJobWorkers
+	}
+	return workers
+}
+
+// getFeedCacheTTL returns how long a cached feed is served without being refreshed from the
+// POISSON_FEED_CACHE_TTL environment variable or the default. 0 disables the feed cache.
+func getFeedCacheTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("POISSON_FEED_CACHE_TTL"))
+	if err != nil || ttl < 0 {
+		return server.DefaultFeedCacheTTL
+	}
+	return ttl
+}
+
+// getPromptReloadInterval returns how often the prompt templates are read again from the
+// POISSON_PROMPTS_RELOAD_INTERVAL environment variable or the default. 0 disables reloading.
+func getPromptReloadInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("POISSON_PROMPTS_RELOAD_INTERVAL"))
+	if err != nil || interval < 0 {
+		return config.DefaultPromptReloadInterval
+	}
+	return interval
+}
+
 // getPort returns the server port from environment variable or default
 func getPort() string {
 	port := os.Getenv("PORT")
@@ -117,7 +339,7 @@ func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		// Set CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key, Authorization")
 
 		// Handle preflight OPTIONS requests
 		if r.Method == "OPTIONS" {
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/server"
+)
+
+// runCreateToken creates an API token from the command line and prints it. Requests without a
+// token can't create tokens, so the first admin token is created this way.
+func runCreateToken(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("create-token", flag.ExitOnError)
+	name := flags.String("name", "admin", "Name of the token")
+	scopes := flags.String("scopes", "admin", "Comma-separated scopes of the token")
+	flags.Parse(args)
+
+	parsedScopes, err := server.ParseAPIScopes(strings.Split(*scopes, ","))
+	if err != nil {
+		fatal("Invalid --scopes", err)
+	}
+
+	datastoreClient, err := lib.CreateDatastoreClient(ctx)
+	if err != nil {
+		fatal("Failed to create datastore client", err)
+	}
+	defer datastoreClient.Close()
+
+	token, raw, err := server.CreateAPIToken(ctx, datastoreClient, *name, parsedScopes)
+	if err != nil {
+		fatal("Failed to create API token", err)
+	}
+	fmt.Fprintf(os.Stderr, "Created API token %s (%s), send it as \"Authorization: Bearer <token>\":\n", token.ID, *scopes)
+	fmt.Println(raw)
+}
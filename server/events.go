@@ -0,0 +1,295 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+	"github.com/zeace/poisson/models"
+)
+
+const (
+	// DefaultEventsInterval is how often the Datastore is polled for new analyses.
+	DefaultEventsInterval = 10 * time.Second
+	// DefaultEventsMinConfidence is the lowest joke confidence of the items sent to subscribers
+	// that don't ask for a threshold.
+	DefaultEventsMinConfidence = 70
+	// eventsKeepAlive is how often a comment is sent on idle streams so proxies don't close them.
+	eventsKeepAlive = 30 * time.Second
+	// eventsBuffer is how many items a slow subscriber can fall behind before items are dropped.
+	eventsBuffer = 16
+)
+
+// FeedEvent is a newly analyzed article sent to the subscribers of the events stream.
+type FeedEvent struct {
+	URL            string `json:"url"`
+	Title          string `json:"title"`
+	Mode           string `json:"mode"`
+	JokeConfidence int    `json:"jokeConfidence"`
+	Language       string `json:"language,omitempty"`
+	Feed           string `json:"feed,omitempty"`
+	// PublishedAt and AnalyzedAt are RFC 3339 times, PublishedAt is empty if unknown.
+	PublishedAt string `json:"publishedAt,omitempty"`
+	AnalyzedAt  string `json:"analyzedAt"`
+}
+
+// FeedEvents polls the Datastore for analyses stored since the previous poll, by any crawler
+// or server instance, and sends those of pages that are likely jokes to its subscribers.
+type FeedEvents struct {
+	datastoreClient lib.DatastoreClient
+	mode            models.AnalysisMode
+	minConfidence   int
+	interval        time.Duration
+	// outbox delivers the events to webhooks, nil if there are none.
+	outbox   *Outbox
+	webhooks []string
+
+	mu          sync.Mutex
+	subscribers map[chan FeedEvent]int
+	// since is the AnalyzedAt of the latest analysis seen.
+	since time.Time
+}
+
+// NewFeedEvents creates the events source for mode, sending items with a joke confidence of
+// at least minConfidence to subscribers that don't ask for a higher threshold.
+// Call Start to begin polling every interval.
+func NewFeedEvents(
+	datastoreClient lib.DatastoreClient,
+	mode models.AnalysisMode,
+	minConfidence int,
+	interval time.Duration,
+) *FeedEvents {
+	if interval <= 0 {
+		interval = DefaultEventsInterval
+	}
+	return &FeedEvents{
+		datastoreClient: datastoreClient,
+		mode:            mode,
+		minConfidence:   minConfidence,
+		interval:        interval,
+		subscribers:     make(map[chan FeedEvent]int),
+		since:           time.Now(),
+	}
+}
+
+// SendToWebhooks makes e also send the events meeting its threshold to each of webhooks, as
+// "item" messages delivered by outbox. How far the analyses were queued is recorded in the
+// Datastore (see models.EventsCursor), so that Start resumes from there and the likely jokes
+// analyzed while no server was running are sent too. It must be called before Start.
+func (e *FeedEvents) SendToWebhooks(outbox *Outbox, webhooks []string) {
+	e.outbox = outbox
+	e.webhooks = webhooks
+}
+
+// Start polls the Datastore in the background until ctx is done.
+func (e *FeedEvents) Start(ctx context.Context) {
+	if len(e.webhooks) > 0 {
+		e.resume(ctx)
+	}
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				e.poll(ctx)
+			}
+		}
+	}()
+}
+
+// resume starts polling from the analysis the webhooks were last sent, if it is recorded.
+func (e *FeedEvents) resume(ctx context.Context) {
+	cursor, found, err := e.datastoreClient.ReadEventsCursor(ctx, e.mode)
+	if err != nil {
+		slog.WarnContext(ctx, "Error reading the webhook events cursor, sending only new analyses", "mode", e.mode, "error", err)
+		return
+	}
+	if found {
+		e.mu.Lock()
+		e.since = cursor.Since
+		e.mu.Unlock()
+	}
+}
+
+// poll sends the analyses stored since the previous poll to the subscribers and the webhooks.
+// An analysis whose webhook messages can't be queued is tried again on the next poll, with the
+// analyses after it.
+func (e *FeedEvents) poll(ctx context.Context) {
+	ctx = logging.WithAttrs(ctx, "mode", e.mode)
+	e.mu.Lock()
+	if len(e.subscribers) == 0 && len(e.webhooks) == 0 {
+		// Nobody to notify, skip the analyses made in the meantime
+		e.since = time.Now()
+		e.mu.Unlock()
+		return
+	}
+	since := e.since
+	e.mu.Unlock()
+
+	results, err := e.datastoreClient.ListAnalysisResultsSince(ctx, e.mode, since)
+	if err != nil {
+		slog.WarnContext(ctx, "Error polling for new analyses", "error", err)
+		return
+	}
+
+	polled := since
+	for _, result := range results {
+		if result.JokePercentage != nil && *result.JokePercentage >= e.minConfidence {
+			event := e.toEvent(ctx, result)
+			if err := e.notifyWebhooks(ctx, event); err != nil {
+				slog.WarnContext(ctx, "Error queuing webhook notification", "url", event.URL, "error", err)
+				break
+			}
+			e.publish(event)
+		}
+		if result.AnalyzedAt.After(since) {
+			since = result.AnalyzedAt
+		}
+	}
+
+	e.mu.Lock()
+	e.since = since
+	e.mu.Unlock()
+	if len(e.webhooks) > 0 && since.After(polled) {
+		cursor := &models.EventsCursor{Mode: e.mode, Since: since, UpdatedAt: time.Now()}
+		if err := e.datastoreClient.WriteEventsCursor(ctx, cursor); err != nil {
+			slog.WarnContext(ctx, "Error saving the webhook events cursor", "error", err)
+		}
+	}
+}
+
+// toEvent converts a stored analysis to an event, with the title and dates of its page.
+func (e *FeedEvents) toEvent(ctx context.Context, result *models.AnalysisResult) FeedEvent {
+	event := FeedEvent{
+		URL:            result.URL,
+		Mode:           string(result.Mode),
+		JokeConfidence: *result.JokePercentage,
+		Language:       result.Language,
+		Feed:           result.Feed,
+		AnalyzedAt:     result.AnalyzedAt.Format(time.RFC3339),
+	}
+	page, found, err := e.datastoreClient.ReadCrawledPage(ctx, result.URL)
+	if err != nil {
+		slog.WarnContext(ctx, "Error reading crawled page for event", "url", result.URL, "error", err)
+	}
+	if found {
+		event.Title = page.Title
+		if published := page.PublishedTime(); !published.IsZero() {
+			event.PublishedAt = published.Format(time.RFC3339)
+		}
+	}
+	return event
+}
+
+// publish sends event to every subscriber whose threshold it meets. Subscribers that fall
+// behind miss events rather than blocking the others.
+func (e *FeedEvents) publish(event FeedEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch, minConfidence := range e.subscribers {
+		if event.JokeConfidence < minConfidence {
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+			slog.Warn("Dropping event for slow subscriber", "url", event.URL)
+		}
+	}
+}
+
+// notifyWebhooks queues event for delivery to the webhooks. Instances polling the same analysis,
+// or a poll queuing it again, queue messages with the same ID, so each webhook is sent the event
+// once.
+func (e *FeedEvents) notifyWebhooks(ctx context.Context, event FeedEvent) error {
+	for _, webhook := range e.webhooks {
+		id := lib.ContentHash(strings.Join([]string{webhook, event.Mode, event.URL, event.AnalyzedAt}, "\n"))
+		if err := e.outbox.Enqueue(ctx, id, webhook, "item", event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a channel receiving the events with a joke confidence of at least
+// minConfidence (or the FeedEvents threshold if higher), and a function to unsubscribe.
+func (e *FeedEvents) Subscribe(minConfidence int) (<-chan FeedEvent, func()) {
+	ch := make(chan FeedEvent, eventsBuffer)
+	e.mu.Lock()
+	e.subscribers[ch] = max(minConfidence, e.minConfidence)
+	e.mu.Unlock()
+
+	return ch, func() {
+		e.mu.Lock()
+		delete(e.subscribers, ch)
+		e.mu.Unlock()
+	}
+}
+
+// ServeHTTP streams events to the client as Server-Sent Events, one "item" event per article,
+// until the client disconnects. The minConfidence query parameter raises the threshold.
+// Requests need the read:feed scope when they carry an API token (see RequireScope).
+func (e *FeedEvents) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if err := RequireScope(ctx, models.ScopeReadFeed); err != nil {
+		code := http.StatusForbidden
+		if errors.Is(err, ErrAPITokenRequired) {
+			code = http.StatusUnauthorized
+		}
+		writeJSONError(w, code, err.Error())
+		return
+	}
+	minConfidence := 0
+	if value := r.URL.Query().Get("minConfidence"); value != "" {
+		var err error
+		if minConfidence, err = strconv.Atoi(value); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid minConfidence: %v", err))
+			return
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	events, unsubscribe := e.Subscribe(minConfidence)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to encode event", "error", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: item\ndata: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+}
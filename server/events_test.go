@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// storeAnalysis stores a joke analysis of url made at analyzedAt, and its page.
+func storeAnalysis(mockDS *lib.MockDatastoreClient, url string, percentage int, analyzedAt time.Time) {
+	mockDS.Pages[url] = &models.CrawledPage{URL: url, Title: "Title of " + url}
+	mockDS.AnalysisResults[lib.UrlToAnalysisKey(url, analyzer.AnalysisModeJoke)] = &models.AnalysisResult{
+		URL:            url,
+		Mode:           analyzer.AnalysisModeJoke,
+		JokePercentage: &percentage,
+		AnalyzedAt:     analyzedAt,
+	}
+}
+
+func TestFeedEvents_Poll(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	events := NewFeedEvents(mockDS, analyzer.AnalysisModeJoke, 70, time.Hour)
+	start := events.since
+
+	storeAnalysis(mockDS, "example.com/before", 95, start.Add(-time.Minute))
+	storeAnalysis(mockDS, "example.com/serious", 20, start.Add(time.Second))
+	storeAnalysis(mockDS, "example.com/likely", 80, start.Add(2*time.Second))
+	storeAnalysis(mockDS, "example.com/certain", 99, start.Add(3*time.Second))
+
+	all, unsubscribeAll := events.Subscribe(0)
+	defer unsubscribeAll()
+	strict, unsubscribeStrict := events.Subscribe(90)
+	defer unsubscribeStrict()
+
+	events.poll(ctx)
+
+	var urls []string
+	for len(all) > 0 {
+		event := <-all
+		urls = append(urls, event.URL)
+	}
+	if strings.Join(urls, " ") != "example.com/likely example.com/certain" {
+		t.Errorf("subscriber without threshold got %v, want the likely and certain jokes", urls)
+	}
+	if len(strict) != 1 {
+		t.Fatalf("subscriber with threshold 90 got %d events, want 1", len(strict))
+	}
+	if event := <-strict; event.URL != "example.com/certain" || event.Title != "Title of example.com/certain" {
+		t.Errorf("subscriber with threshold 90 got %+v", event)
+	}
+
+	// Analyses already sent are not sent again
+	events.poll(ctx)
+	if len(all) != 0 {
+		t.Errorf("second poll sent %d events, want 0", len(all))
+	}
+}
+
+func TestFeedEvents_ServeHTTP(t *testing.T) {
+	mockDS := lib.NewMockDatastoreClient()
+	events := NewFeedEvents(mockDS, analyzer.AnalysisModeJoke, 70, time.Hour)
+	httpServer := httptest.NewServer(events)
+	defer httpServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, httpServer.URL+"?minConfidence=75", nil)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("GET /events: %v", err)
+	}
+	defer response.Body.Close()
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", contentType)
+	}
+
+	storeAnalysis(mockDS, "example.com/joke", 85, time.Now().Add(time.Second))
+	events.poll(context.Background())
+
+	reader := bufio.NewReader(response.Body)
+	eventLine, _ := reader.ReadString('\n')
+	dataLine, _ := reader.ReadString('\n')
+	if eventLine != "event: item\n" {
+		t.Fatalf("got %q, want an item event", eventLine)
+	}
+	var event FeedEvent
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(dataLine), "data: ")), &event); err != nil {
+		t.Fatalf("error decoding %q: %v", dataLine, err)
+	}
+	if event.URL != "example.com/joke" || event.JokeConfidence != 85 {
+		t.Errorf("event = %+v, want example.com/joke at 85", event)
+	}
+}
+
+func TestFeedEvents_ServeHTTP_Rejects(t *testing.T) {
+	events := NewFeedEvents(lib.NewMockDatastoreClient(), analyzer.AnalysisModeJoke, 70, time.Hour)
+	reader := &models.APIToken{ID: "reader", Scopes: []models.APIScope{models.ScopeReadUsage}}
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		query    string
+		wantCode int
+	}{
+		{"token required", WithAPIToken(context.Background(), nil, true), "", http.StatusUnauthorized},
+		{"token without read:feed", WithAPIToken(context.Background(), reader, false), "", http.StatusForbidden},
+		{"invalid threshold", context.Background(), "?minConfidence=high", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/events"+tt.query, nil).WithContext(tt.ctx)
+			recorder := httptest.NewRecorder()
+			events.ServeHTTP(recorder, request)
+			if recorder.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+)
+
+const (
+	// DefaultFeedCacheTTL is how long a cached feed is served without being refreshed.
+	DefaultFeedCacheTTL = 30 * time.Second
+	// DefaultFeedCacheMaxStale is how long after its TTL a cached feed is still served while it
+	// is refreshed in the background. Older feeds are generated again before responding.
+	DefaultFeedCacheMaxStale = 10 * time.Minute
+	// maxFeedCacheEntries bounds the number of cached feeds; the oldest is evicted first.
+	maxFeedCacheEntries = 256
+	// feedRefreshTimeout bounds a background refresh, which outlives the request that started it.
+	feedRefreshTimeout = time.Minute
+)
+
+// FeedQuery holds the arguments of GetFeed, identifying a cached feed.
+type FeedQuery struct {
+	MaxArticles  int
+	OldestDate   time.Time
+	Mode         string
+	Language     string
+	Source       string
+	ExcludeStale bool
+	AsOf         time.Time
+}
+
+// feedCacheEntry is a cached feed.
+type feedCacheEntry struct {
+	items       []FeedItem
+	generatedAt time.Time
+	// refreshing is true while a background refresh of the entry runs.
+	refreshing bool
+}
+
+// feedCall is a generation of a feed that concurrent requests for the same missing feed wait for.
+type feedCall struct {
+	done  chan struct{}
+	items []FeedItem
+	err   error
+}
+
+// FeedCache caches the feeds returned by GetFeed with stale-while-revalidate: a feed is served
+// from the cache for ttl, then served stale for up to maxStale more while a single background
+// refresh replaces it, so that only the first request for a feed, or one after a long idle
+// period, waits for the Datastore. Concurrent requests for a missing feed share one generation.
+type FeedCache struct {
+	ttl      time.Duration
+	maxStale time.Duration
+	// generate is GetFeed, replaced in tests.
+	generate func(ctx context.Context, query FeedQuery) ([]FeedItem, error)
+
+	mu      sync.Mutex
+	entries map[FeedQuery]*feedCacheEntry
+	calls   map[FeedQuery]*feedCall
+}
+
+// NewFeedCache creates a feed cache. A non-positive ttl or maxStale means DefaultFeedCacheTTL or
+// DefaultFeedCacheMaxStale.
+func NewFeedCache(datastoreClient lib.DatastoreClient, ttl, maxStale time.Duration) *FeedCache {
+	if ttl <= 0 {
+		ttl = DefaultFeedCacheTTL
+	}
+	if maxStale <= 0 {
+		maxStale = DefaultFeedCacheMaxStale
+	}
+	cache := &FeedCache{
+		ttl:      ttl,
+		maxStale: maxStale,
+		entries:  make(map[FeedQuery]*feedCacheEntry),
+		calls:    make(map[FeedQuery]*feedCall),
+	}
+	cache.generate = func(ctx context.Context, query FeedQuery) ([]FeedItem, error) {
+		return GetFeed(ctx, datastoreClient, query.MaxArticles, query.OldestDate, query.Mode, query.Language, query.Source,
+			query.ExcludeStale, query.AsOf)
+	}
+	return cache
+}
+
+// Get returns the feed of query from the cache if it is fresh or at most maxStale past its TTL,
+// refreshing it in the background in the latter case, and generates it otherwise. The ages of
+// the items are measured when Get is called, except for feeds as of a past time.
+func (c *FeedCache) Get(ctx context.Context, query FeedQuery) ([]FeedItem, error) {
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.entries[query]
+	if ok && now.Sub(entry.generatedAt) < c.ttl+c.maxStale {
+		if now.Sub(entry.generatedAt) >= c.ttl && !entry.refreshing {
+			entry.refreshing = true
+			go c.refresh(context.WithoutCancel(ctx), query)
+		}
+		items := entry.items
+		c.mu.Unlock()
+		return withAges(items, query, now), nil
+	}
+
+	// Missing or too old: generate it, or wait for the request already generating it
+	call, waiting := c.calls[query]
+	if !waiting {
+		call = &feedCall{done: make(chan struct{})}
+		c.calls[query] = call
+	}
+	c.mu.Unlock()
+
+	if !waiting {
+		call.items, call.err = c.generate(ctx, query)
+		c.mu.Lock()
+		if call.err == nil {
+			c.store(query, call.items, now)
+		}
+		delete(c.calls, query)
+		c.mu.Unlock()
+		close(call.done)
+	}
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if call.err != nil {
+		return nil, call.err
+	}
+	return withAges(call.items, query, now), nil
+}
+
+// refresh generates the feed of query again and replaces its cache entry. On failure, the stale
+// entry is kept, to be refreshed again by the next request.
+func (c *FeedCache) refresh(ctx context.Context, query FeedQuery) {
+	ctx, cancel := context.WithTimeout(ctx, feedRefreshTimeout)
+	defer cancel()
+
+	started := time.Now()
+	items, err := c.generate(ctx, query)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		slog.WarnContext(ctx, "Error refreshing cached feed", "mode", query.Mode, "error", err)
+		if entry, ok := c.entries[query]; ok {
+			entry.refreshing = false
+		}
+		return
+	}
+	c.store(query, items, started)
+}
+
+// store caches items as the feed of query generated at generatedAt, unless a more recent one is
+// cached, evicting the oldest entry if the cache is full. c.mu must be held.
+func (c *FeedCache) store(query FeedQuery, items []FeedItem, generatedAt time.Time) {
+	existing, ok := c.entries[query]
+	if ok && existing.generatedAt.After(generatedAt) {
+		return
+	}
+	if !ok && len(c.entries) >= maxFeedCacheEntries {
+		var oldest FeedQuery
+		var oldestAt time.Time
+		for key, entry := range c.entries {
+			if oldestAt.IsZero() || entry.generatedAt.Before(oldestAt) {
+				oldest, oldestAt = key, entry.generatedAt
+			}
+		}
+		delete(c.entries, oldest)
+	}
+	c.entries[query] = &feedCacheEntry{items: items, generatedAt: generatedAt}
+}
+
+// withAges returns a copy of items with their ages measured at now, or items as is for a feed
+// as of a past time, whose ages are measured from that time.
+func withAges(items []FeedItem, query FeedQuery, now time.Time) []FeedItem {
+	if !query.AsOf.IsZero() {
+		return items
+	}
+	aged := make([]FeedItem, len(items))
+	for i, item := range items {
+		item.PublishedAge = age(now, item.PublishedAt)
+		item.AnalyzedAge = age(now, item.AnalyzedAt)
+		aged[i] = item
+	}
+	return aged
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestFeedCache returns a feed cache whose feeds are generated by generate.
+func newTestFeedCache(generate func(ctx context.Context, query FeedQuery) ([]FeedItem, error)) *FeedCache {
+	cache := NewFeedCache(nil, time.Minute, time.Hour)
+	cache.generate = generate
+	return cache
+}
+
+// ageEntry moves the generation time of the cached feed of query back by d.
+func ageEntry(cache *FeedCache, query FeedQuery, d time.Duration) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.entries[query].generatedAt = cache.entries[query].generatedAt.Add(-d)
+}
+
+func TestFeedCache_Get(t *testing.T) {
+	var calls atomic.Int32
+	var fail atomic.Bool
+	cache := newTestFeedCache(func(ctx context.Context, query FeedQuery) ([]FeedItem, error) {
+		n := calls.Add(1)
+		if fail.Load() {
+			return nil, errors.New("datastore unavailable")
+		}
+		return []FeedItem{{URL: fmt.Sprintf("example.com/%d", n)}}, nil
+	})
+	ctx := context.Background()
+	query := FeedQuery{MaxArticles: 10, Mode: "joke"}
+
+	get := func(wantURL string) {
+		t.Helper()
+		items, err := cache.Get(ctx, query)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if len(items) != 1 || items[0].URL != wantURL {
+			t.Fatalf("Get() = %+v, want %s", items, wantURL)
+		}
+	}
+	// waitGenerated waits for the feed to have been generated n times, and refreshed if it was
+	// in the background.
+	waitGenerated := func(n int32) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			cache.mu.Lock()
+			refreshing := cache.entries[query].refreshing
+			cache.mu.Unlock()
+			if calls.Load() == n && !refreshing {
+				return
+			}
+		}
+		t.Fatalf("generated %d time(s), want %d", calls.Load(), n)
+	}
+
+	// Missing: generated before responding
+	get("example.com/1")
+	// Fresh: served from cache
+	get("example.com/1")
+	waitGenerated(1)
+
+	// Stale: served from cache while refreshed once in the background
+	ageEntry(cache, query, 2*time.Minute)
+	get("example.com/1")
+	get("example.com/1")
+	waitGenerated(2)
+	get("example.com/2")
+
+	// Failed refresh: the stale feed is kept, and refreshed again by the next request
+	fail.Store(true)
+	ageEntry(cache, query, 2*time.Minute)
+	get("example.com/2")
+	waitGenerated(3)
+	get("example.com/2")
+	waitGenerated(4)
+
+	// Too old: generated again before responding
+	fail.Store(false)
+	ageEntry(cache, query, 2*time.Hour)
+	get("example.com/5")
+
+	// Other arguments: cached separately
+	query.Language = "fr"
+	get("example.com/6")
+	waitGenerated(6)
+}
+
+func TestFeedCache_GetCoalescesMisses(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	cache := newTestFeedCache(func(ctx context.Context, query FeedQuery) ([]FeedItem, error) {
+		calls.Add(1)
+		<-release
+		return []FeedItem{{URL: "example.com/a"}}, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			items, err := cache.Get(context.Background(), FeedQuery{Mode: "joke"})
+			if err != nil || len(items) != 1 {
+				t.Errorf("Get() = %+v, %v", items, err)
+			}
+		}()
+	}
+	// Let the requests reach the cache before the feed is generated
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Errorf("generated %d time(s), want 1", calls.Load())
+	}
+}
+
+func TestFeedCache_GetError(t *testing.T) {
+	var calls atomic.Int32
+	cache := newTestFeedCache(func(ctx context.Context, query FeedQuery) ([]FeedItem, error) {
+		calls.Add(1)
+		return nil, errors.New("datastore unavailable")
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Get(context.Background(), FeedQuery{}); err == nil {
+			t.Error("Get() expected an error")
+		}
+	}
+	// Errors aren't cached
+	if calls.Load() != 2 {
+		t.Errorf("generated %d time(s), want 2", calls.Load())
+	}
+}
+
+func TestWithAges(t *testing.T) {
+	now := time.Date(2025, 4, 1, 12, 0, 0, 0, time.UTC)
+	items := []FeedItem{{
+		PublishedAt:  now.Add(-3 * time.Hour),
+		PublishedAge: time.Hour,
+		AnalyzedAge:  time.Hour,
+	}}
+
+	aged := withAges(items, FeedQuery{}, now)
+	if aged[0].PublishedAge != 3*time.Hour || aged[0].AnalyzedAge != 0 {
+		t.Errorf("withAges() = %+v, want ages measured at now", aged[0])
+	}
+	if items[0].PublishedAge != time.Hour {
+		t.Error("withAges() modified the cached items")
+	}
+
+	asOf := withAges(items, FeedQuery{AsOf: now.Add(-2 * time.Hour)}, now)
+	if asOf[0].PublishedAge != time.Hour {
+		t.Errorf("withAges() as of a past time = %+v, want ages unchanged", asOf[0])
+	}
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/crawler/utils"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+var (
+	// ErrFeedExists is returned by AddFeed for a feed already in the registry.
+	ErrFeedExists = errors.New("feed already registered")
+	// ErrFeedNotFound is returned by UpdateFeed and DeleteFeed for a feed not in the registry.
+	ErrFeedNotFound = errors.New("feed not registered")
+)
+
+const (
+	// MinPollInterval is the shortest poll interval of a registered feed.
+	MinPollInterval = time.Minute
+	// MaxFeedArticles is the largest max articles of a registered feed: every poll may fetch
+	// and analyze that many articles.
+	MaxFeedArticles = 100
+	// MaxFeedModes is the largest number of analysis modes of a registered feed, each of which
+	// costs an LLM call per new article.
+	MaxFeedModes = 5
+)
+
+// FeedUpdate lists the settings of a registered feed to change. Unset fields are left unchanged.
+// Empty Modes and zero MaxArticles, PollInterval and HostDelay bring back the crawler's defaults.
+type FeedUpdate struct {
+	Name    *string
+	Enabled *bool
+	// PollInterval is zero for the crawler daemon's default (see ParsePollInterval).
+	PollInterval *time.Duration
+	// Modes are the analysis modes of the feed (see ParseFeedModes).
+	Modes       *[]models.AnalysisMode
+	MaxArticles *int
+	// HostDelay is the politeness delay of the feed (see ParseHostDelay).
+	HostDelay *time.Duration
+}
+
+// ParseFeedModes validates the analysis modes of a registered feed, removing duplicates.
+func ParseFeedModes(names []string) ([]models.AnalysisMode, error) {
+	var modes []models.AnalysisMode
+	for _, name := range names {
+		mode, err := analyzer.VerifyValidMode(strings.TrimSpace(name))
+		if err != nil {
+			return nil, fmt.Errorf("invalid mode: %w", err)
+		}
+		if !slices.Contains(modes, mode) {
+			modes = append(modes, mode)
+		}
+	}
+	return modes, nil
+}
+
+// ParseHostDelay parses the minimum time between two requests to the same host while fetching
+// the articles of a registered feed: a Go duration such as "500ms" or "2s". The empty string
+// means the crawler's default and is returned as zero.
+func ParseHostDelay(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	delay, err := time.ParseDuration(s)
+	if err != nil || delay < 0 {
+		return 0, fmt.Errorf("invalid host delay %q (want e.g. 500ms or 2s)", s)
+	}
+	return delay, nil
+}
+
+// validate checks the settings that are not parsed from a string.
+func (u FeedUpdate) validate() error {
+	if u.MaxArticles != nil && (*u.MaxArticles < 0 || *u.MaxArticles > MaxFeedArticles) {
+		return fmt.Errorf("invalid max articles %d: must be between 0 and %d", *u.MaxArticles, MaxFeedArticles)
+	}
+	if u.Modes != nil && len(*u.Modes) > MaxFeedModes {
+		return fmt.Errorf("invalid modes: at most %d modes, got %d", MaxFeedModes, len(*u.Modes))
+	}
+	return nil
+}
+
+// ParsePollInterval parses the poll interval of a registered feed: a number of days such as
+// "1d" or a Go duration such as "30m", at least MinPollInterval. The empty string means the
+// crawler daemon's default and is returned as zero.
+func ParsePollInterval(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	interval, err := utils.ParseMaxAge(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid poll interval %q (want e.g. 1d or 30m)", s)
+	}
+	if interval < MinPollInterval {
+		return 0, fmt.Errorf("invalid poll interval %q: must be at least %s", s, MinPollInterval)
+	}
+	return interval, nil
+}
+
+// apply changes the settings of feed set in u.
+func (u FeedUpdate) apply(feed *models.FeedSource) {
+	if u.Name != nil {
+		feed.Name = strings.TrimSpace(*u.Name)
+	}
+	if u.Enabled != nil {
+		feed.Enabled = *u.Enabled
+	}
+	if u.PollInterval != nil {
+		feed.PollInterval = *u.PollInterval
+	}
+	if u.Modes != nil {
+		feed.Modes = *u.Modes
+	}
+	if u.MaxArticles != nil {
+		feed.MaxArticles = *u.MaxArticles
+	}
+	if u.HostDelay != nil {
+		feed.HostDelay = *u.HostDelay
+	}
+}
+
+// AddFeed registers the feed at url for crawling, enabled unless settings says otherwise.
+func AddFeed(ctx context.Context, datastoreClient lib.DatastoreClient, url string, settings FeedUpdate) (*models.FeedSource, error) {
+	url = strings.TrimSpace(url)
+	if err := utils.ValidateRSSURL(url); err != nil {
+		return nil, err
+	}
+	if err := settings.validate(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	feed := &models.FeedSource{
+		URL:       url,
+		Enabled:   true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	settings.apply(feed)
+	added, err := datastoreClient.AddFeedSource(ctx, feed)
+	if err != nil {
+		return nil, fmt.Errorf("error saving feed: %w", err)
+	}
+	if !added {
+		return nil, ErrFeedExists
+	}
+	return feed, nil
+}
+
+// UpdateFeed applies update to the registered feed at url in one transaction, so that
+// concurrent updates of different settings are all kept, and returns the updated feed.
+func UpdateFeed(ctx context.Context, datastoreClient lib.DatastoreClient, url string, update FeedUpdate) (*models.FeedSource, error) {
+	if err := update.validate(); err != nil {
+		return nil, err
+	}
+	feed, found, err := datastoreClient.UpdateFeedSource(ctx, strings.TrimSpace(url), func(feed *models.FeedSource) {
+		update.apply(feed)
+		feed.UpdatedAt = time.Now()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error saving feed: %w", err)
+	}
+	if !found {
+		return nil, ErrFeedNotFound
+	}
+	return feed, nil
+}
+
+// DeleteFeed removes the feed at url from the registry and returns it.
+func DeleteFeed(ctx context.Context, datastoreClient lib.DatastoreClient, url string) (*models.FeedSource, error) {
+	feed, err := readFeed(ctx, datastoreClient, url)
+	if err != nil {
+		return nil, err
+	}
+	if err := datastoreClient.DeleteFeedSource(ctx, feed.URL); err != nil {
+		return nil, fmt.Errorf("error deleting feed: %w", err)
+	}
+	return feed, nil
+}
+
+// readFeed returns the registered feed at url, or ErrFeedNotFound.
+func readFeed(ctx context.Context, datastoreClient lib.DatastoreClient, url string) (*models.FeedSource, error) {
+	feed, found, err := datastoreClient.ReadFeedSource(ctx, strings.TrimSpace(url))
+	if err != nil {
+		return nil, fmt.Errorf("error reading feed: %w", err)
+	}
+	if !found {
+		return nil, ErrFeedNotFound
+	}
+	return feed, nil
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestFeedRegistry(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	const url = "https://example.com/feed.xml"
+
+	name := "Example"
+	feed, err := AddFeed(ctx, mockDS, " "+url+" ", FeedUpdate{Name: &name})
+	if err != nil {
+		t.Fatalf("AddFeed returned error: %v", err)
+	}
+	if feed.URL != url || feed.Name != "Example" || !feed.Enabled || feed.PollInterval != 0 || feed.CreatedAt.IsZero() {
+		t.Errorf("unexpected feed %+v", feed)
+	}
+	if _, err := AddFeed(ctx, mockDS, url, FeedUpdate{}); !errors.Is(err, ErrFeedExists) {
+		t.Errorf("AddFeed of a registered feed returned %v, want ErrFeedExists", err)
+	}
+	if _, err := AddFeed(ctx, mockDS, "http://example.com/feed.xml", FeedUpdate{}); !errors.Is(err, ErrFeedExists) {
+		t.Errorf("AddFeed of a registered feed over http returned %v, want ErrFeedExists", err)
+	}
+	if _, err := AddFeed(ctx, mockDS, "not a url", FeedUpdate{}); err == nil {
+		t.Error("expected error for an invalid url")
+	}
+
+	disabled := false
+	interval := time.Hour
+	feed, err = UpdateFeed(ctx, mockDS, "http://example.com/feed.xml", FeedUpdate{Enabled: &disabled, PollInterval: &interval})
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if feed.Enabled || feed.PollInterval != time.Hour || feed.Name != "Example" || feed.URL != url {
+		t.Errorf("expected a disabled feed polled hourly keeping its name, got %+v", feed)
+	}
+	modes := []models.AnalysisMode{"joke", "test"}
+	maxArticles := 20
+	delay := 2 * time.Second
+	feed, err = UpdateFeed(ctx, mockDS, url, FeedUpdate{Modes: &modes, MaxArticles: &maxArticles, HostDelay: &delay})
+	if err != nil {
+		t.Fatalf("UpdateFeed returned error: %v", err)
+	}
+	if !slices.Equal(feed.Modes, modes) || feed.MaxArticles != 20 || feed.HostDelay != 2*time.Second || feed.PollInterval != time.Hour {
+		t.Errorf("expected the new modes, max articles and host delay keeping the poll interval, got %+v", feed)
+	}
+	negative := -1
+	if _, err := UpdateFeed(ctx, mockDS, url, FeedUpdate{MaxArticles: &negative}); err == nil {
+		t.Error("expected error for negative max articles")
+	}
+	tooMany := MaxFeedArticles + 1
+	if _, err := UpdateFeed(ctx, mockDS, url, FeedUpdate{MaxArticles: &tooMany}); err == nil {
+		t.Error("expected error for max articles above MaxFeedArticles")
+	}
+	manyModes := make([]models.AnalysisMode, MaxFeedModes+1)
+	if _, err := UpdateFeed(ctx, mockDS, url, FeedUpdate{Modes: &manyModes}); err == nil {
+		t.Error("expected error for more than MaxFeedModes modes")
+	}
+
+	feeds, err := mockDS.ListFeedSources(ctx)
+	if err != nil || len(feeds) != 1 || feeds[0].Enabled {
+		t.Errorf("ListFeedSources = %+v, %v, want the disabled feed", feeds, err)
+	}
+
+	if _, err := DeleteFeed(ctx, mockDS, url); err != nil {
+		t.Fatalf("DeleteFeed returned error: %v", err)
+	}
+	if _, err := DeleteFeed(ctx, mockDS, url); !errors.Is(err, ErrFeedNotFound) {
+		t.Errorf("DeleteFeed of a deleted feed returned %v, want ErrFeedNotFound", err)
+	}
+	if _, err := UpdateFeed(ctx, mockDS, url, FeedUpdate{}); !errors.Is(err, ErrFeedNotFound) {
+		t.Errorf("UpdateFeed of a deleted feed returned %v, want ErrFeedNotFound", err)
+	}
+}
+
+func TestUpdateFeed_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	const url = "https://example.com/feed.xml"
+	if _, err := AddFeed(ctx, mockDS, url, FeedUpdate{}); err != nil {
+		t.Fatalf("AddFeed returned error: %v", err)
+	}
+
+	// Updates of different settings don't overwrite each other
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			update := FeedUpdate{}
+			if i%2 == 0 {
+				name := "Example"
+				update.Name = &name
+			} else {
+				maxArticles := 5
+				update.MaxArticles = &maxArticles
+			}
+			if _, err := UpdateFeed(ctx, mockDS, url, update); err != nil {
+				t.Errorf("UpdateFeed returned error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	feed, found, err := mockDS.ReadFeedSource(ctx, url)
+	if err != nil || !found || feed.Name != "Example" || feed.MaxArticles != 5 {
+		t.Errorf("ReadFeedSource = %+v, %v, %v, want both updates", feed, found, err)
+	}
+}
+
+func TestParsePollInterval(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{input: "", want: 0},
+		{input: "30m", want: 30 * time.Minute},
+		{input: "1d", want: 24 * time.Hour},
+		{input: "30s", wantErr: true},
+		{input: "often", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePollInterval(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePollInterval(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParsePollInterval(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFeedModes(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []string
+		want    []models.AnalysisMode
+		wantErr bool
+	}{
+		{name: "none", input: nil, want: nil},
+		{name: "valid", input: []string{"joke", " Test "}, want: []models.AnalysisMode{"joke", "test"}},
+		{name: "duplicates", input: []string{"joke", "JOKE"}, want: []models.AnalysisMode{"joke"}},
+		{name: "unknown", input: []string{"joke", "satire"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFeedModes(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFeedModes(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseFeedModes(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHostDelay(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{input: "", want: 0},
+		{input: "500ms", want: 500 * time.Millisecond},
+		{input: "2s", want: 2 * time.Second},
+		{input: "-1s", wantErr: true},
+		{input: "slowly", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseHostDelay(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHostDelay(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseHostDelay(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
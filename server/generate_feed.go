@@ -2,31 +2,68 @@ package server
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/zeace/poisson/crawler/analyzer"
 	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+	"github.com/zeace/poisson/models"
 )
 
 // FeedItem represents a single item in the feed
 type FeedItem struct {
 	URL            string
 	Title          string
-	JokeConfidence int // JokePercentage from AnalysisResult
+	JokeConfidence int    // JokePercentage from AnalysisResult
+	Language       string // Language from CrawledPage, empty if unknown
+	CacheSource    string // CacheSource from AnalysisResult: where the analyzed content came from
+	// PublishedAt is when the article was published, as declared by the page or by the feed
+	// item it was linked from (see models.CrawledPage.PublishedTime), zero if unknown.
+	PublishedAt time.Time
+	// Description is the summary declared by the page, empty if none.
+	Description string
+	// Screenshot is where the screenshot of the page is stored (see models.CrawledPage), empty
+	// if none was taken.
+	Screenshot string
+	// WordCount and ReadingMinutes are the length of the page (see models.CrawledPage), zero for
+	// pages stored before they were recorded.
+	WordCount      int
+	ReadingMinutes int
+	// AnalyzedAt is when the analysis was made, zero for analyses made before this was recorded.
+	AnalyzedAt time.Time
+	// PublishedAge and AnalyzedAge are the ages of PublishedAt and AnalyzedAt when the feed
+	// was generated. They are zero when the corresponding time is unknown.
+	PublishedAge time.Duration
+	AnalyzedAge  time.Duration
+	// Stale is true if the analysis was made with an older prompt than the current one.
+	Stale bool
+	// Source is the source the page was stored from, zero if unknown.
+	Source models.SourceRef
 }
 
-// GetFeed retrieves analysis results since oldest_date, ranks them by jokeConfidence,
-// and returns up to max_articles items.
+// GetFeed retrieves analysis results since oldest_date, ranks them by jokeConfidence, the most
+// recently published first among equals, and returns up to max_articles items.
 // It uses the CrawledPage DateTime to filter by date since AnalysisResult doesn't have a timestamp.
+// If language is non-empty, only pages detected to be in that language (ISO 639-1 code) are included.
+// If source is non-empty, only pages stored from that source are included (see models.SourceRef.Matches).
+// If excludeStale is true, items whose analysis was made with an older prompt are left out.
+// If asOf is non-zero, the feed is reconstructed as it was at that time (see feedItemAsOf).
 func GetFeed(
 	ctx context.Context,
 	datastoreClient lib.DatastoreClient,
 	maxArticles int,
 	oldestDate time.Time,
 	modeStr string,
+	language string,
+	source string,
+	excludeStale bool,
+	asOf time.Time,
 ) ([]FeedItem, error) {
+	ctx = logging.WithAttrs(ctx, "oldest_date", oldestDate, "mode", modeStr)
+
 	// Get all CrawledPages since oldestDate
 	pages, err := datastoreClient.GetCrawledPagesSince(ctx, oldestDate)
 	if err != nil {
@@ -40,29 +77,73 @@ func GetFeed(
 
 	// For each page, get its analysis result and build feed items
 	var items []FeedItem
+	now := time.Now()
+	if !asOf.IsZero() {
+		now = asOf
+	}
 
 	for _, page := range pages {
+		if language != "" && !strings.EqualFold(page.Language, language) {
+			continue // Skip pages in other (or undetected) languages
+		}
+		if source != "" && !page.Source.Matches(source) {
+			continue // Skip pages from other (or unknown) sources
+		}
+
 		// Try to get analysis result for the specified mode
 		analysis, found, err := datastoreClient.ReadAnalysisResult(ctx, page.URL, mode)
 		if err != nil {
-			log.Printf("GetFeed %v error reading analysis result for page %v: %v", oldestDate, page.URL, err)
+			slog.WarnContext(ctx, "GetFeed error reading analysis result", "url", page.URL, "error", err)
 			continue // Skip on error
 		}
+		if !found {
+			analysis = nil
+		}
+		if !asOf.IsZero() {
+			analysis, found, err = analysisAsOf(ctx, datastoreClient, page, mode, oldestDate, asOf, analysis)
+			if err != nil {
+				slog.WarnContext(ctx, "GetFeed error reading audit trail", "url", page.URL, "error", err)
+				continue // Skip on error
+			}
+		}
 		if !found || analysis == nil || analysis.JokePercentage == nil {
-			log.Printf("GetFeed %v no analysis result or no joke percentage for page %v", oldestDate, page.URL)
+			slog.DebugContext(ctx, "GetFeed no analysis result or no joke percentage", "url", page.URL)
 			continue // Skip if no analysis or no joke percentage
 		}
 
+		stale, err := analyzer.IsStale(analysis)
+		if err != nil {
+			return nil, err
+		}
+		if stale && excludeStale {
+			continue
+		}
+
 		items = append(items, FeedItem{
 			URL:            page.URL,
 			Title:          page.Title,
 			JokeConfidence: *analysis.JokePercentage,
+			Language:       page.Language,
+			CacheSource:    string(analysis.CacheSource),
+			PublishedAt:    page.PublishedTime(),
+			Description:    page.Description,
+			Screenshot:     page.Screenshot,
+			WordCount:      page.WordCount,
+			ReadingMinutes: page.ReadingMinutes,
+			AnalyzedAt:     analysis.AnalyzedAt,
+			PublishedAge:   age(now, page.PublishedTime()),
+			AnalyzedAge:    age(now, analysis.AnalyzedAt),
+			Stale:          stale,
+			Source:         page.Source,
 		})
 	}
 
-	// Sort by joke confidence (descending)
-	sort.Slice(items, func(i, j int) bool {
-		return items[i].JokeConfidence > items[j].JokeConfidence
+	// Sort by joke confidence (descending), then by publication time (newest first, undated last)
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].JokeConfidence != items[j].JokeConfidence {
+			return items[i].JokeConfidence > items[j].JokeConfidence
+		}
+		return items[i].PublishedAt.After(items[j].PublishedAt)
 	})
 
 	// Take up to maxArticles
@@ -72,3 +153,71 @@ func GetFeed(
 
 	return items, nil
 }
+
+// analysisAsOf returns the analysis of page in mode as it was at time asOf, if the page was
+// crawled between oldestDate and asOf. current is the stored analysis, nil if there is none.
+//
+// The crawl time and analysis are taken from the last fetched and analyzed (or copied) events of
+// the page's audit trail up to asOf. Without such events, e.g. for pages processed before the
+// audit trail was recorded, the page's crawl time and current are used if they predate asOf.
+// Analyses without an AnalyzedAt can't be dated and are left out.
+func analysisAsOf(
+	ctx context.Context,
+	datastoreClient lib.DatastoreClient,
+	page models.CrawledPage,
+	mode analyzer.AnalysisMode,
+	oldestDate, asOf time.Time,
+	current *models.AnalysisResult,
+) (*models.AnalysisResult, bool, error) {
+	events, err := datastoreClient.ListAuditEvents(ctx, lib.NormalizeURL(page.URL))
+	if err != nil {
+		return nil, false, err
+	}
+
+	var crawledAt time.Time
+	var analysis *models.AnalysisResult
+	analyzed := false
+	for _, event := range events {
+		if event.CreatedAt.After(asOf) {
+			break
+		}
+		switch {
+		case event.Action == models.AuditActionFetched:
+			crawledAt = event.CreatedAt
+		case event.Mode != mode:
+		case event.Action == models.AuditActionAnalyzed || event.Action == models.AuditActionCopied:
+			analyzed = true
+			analysis = &models.AnalysisResult{
+				URL:               page.URL,
+				Mode:              mode,
+				JokePercentage:    event.JokePercentage,
+				PromptFingerprint: event.PromptFingerprint,
+				PromptVersion:     event.PromptVersion,
+				Model:             event.Model,
+				AnalyzedAt:        event.CreatedAt,
+			}
+		case event.Action == models.AuditActionDeleted:
+			analyzed = true
+			analysis = nil
+		}
+	}
+
+	if crawledAt.IsZero() && !page.DateTime.After(asOf) {
+		crawledAt = page.DateTime
+	}
+	if crawledAt.IsZero() || crawledAt.Before(oldestDate) {
+		return nil, false, nil
+	}
+	if !analyzed && current != nil && !current.AnalyzedAt.IsZero() && !current.AnalyzedAt.After(asOf) {
+		analysis = current
+	}
+	return analysis, analysis != nil, nil
+}
+
+// age returns how long before now t was, or zero if t is unknown.
+func age(now, t time.Time) time.Duration {
+	if t.IsZero() {
+		return 0
+	}
+	return now.Sub(t)
+}
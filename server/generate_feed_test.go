@@ -16,7 +16,7 @@ func TestGetFeed_EmptyResult(t *testing.T) {
 	mockDS := lib.NewMockDatastoreClient()
 
 	oldestDate := time.Now().Add(-24 * time.Hour)
-	items, err := GetFeed(ctx, mockDS, 10, oldestDate, "joke")
+	items, err := GetFeed(ctx, mockDS, 10, oldestDate, "joke", "", "", false, time.Time{})
 
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
@@ -39,7 +39,7 @@ func TestGetFeed_NoAnalysisResults(t *testing.T) {
 	}
 
 	oldestDate := now.Add(-1 * time.Hour)
-	items, err := GetFeed(ctx, mockDS, 10, oldestDate, "joke")
+	items, err := GetFeed(ctx, mockDS, 10, oldestDate, "joke", "", "", false, time.Time{})
 
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
@@ -66,6 +66,7 @@ func TestGetFeed_SingleItem(t *testing.T) {
 	result := &models.AnalysisResult{
 		Mode:           analyzer.AnalysisModeJoke,
 		JokePercentage: &jokePercentage,
+		CacheSource:    models.CacheSourceNetwork,
 	}
 	err = mockDS.WriteAnalysisResult(ctx, page.URL, result)
 	if err != nil {
@@ -73,7 +74,7 @@ func TestGetFeed_SingleItem(t *testing.T) {
 	}
 
 	oldestDate := now.Add(-1 * time.Hour)
-	items, err := GetFeed(ctx, mockDS, 10, oldestDate, "joke")
+	items, err := GetFeed(ctx, mockDS, 10, oldestDate, "joke", "", "", false, time.Time{})
 
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
@@ -94,6 +95,10 @@ func TestGetFeed_SingleItem(t *testing.T) {
 	if items[0].JokeConfidence != 75 {
 		t.Errorf("Expected joke confidence 75, got %d", items[0].JokeConfidence)
 	}
+
+	if items[0].CacheSource != "network" {
+		t.Errorf("Expected cache source network, got %q", items[0].CacheSource)
+	}
 }
 
 func TestGetFeed_MultipleItemsSorted(t *testing.T) {
@@ -132,7 +137,7 @@ func TestGetFeed_MultipleItemsSorted(t *testing.T) {
 	}
 
 	oldestDate := now.Add(-1 * time.Hour)
-	items, err := GetFeed(ctx, mockDS, 10, oldestDate, "joke")
+	items, err := GetFeed(ctx, mockDS, 10, oldestDate, "joke", "", "", false, time.Time{})
 
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
@@ -179,7 +184,7 @@ func TestGetFeed_MaxArticlesLimit(t *testing.T) {
 	}
 
 	oldestDate := now.Add(-1 * time.Hour)
-	items, err := GetFeed(ctx, mockDS, 3, oldestDate, "joke")
+	items, err := GetFeed(ctx, mockDS, 3, oldestDate, "joke", "", "", false, time.Time{})
 
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
@@ -238,7 +243,7 @@ func TestGetFeed_FiltersByDate(t *testing.T) {
 
 	// Query with oldestDate that should only include the new page
 	oldestDate := now.Add(-24 * time.Hour) // 1 day ago
-	items, err := GetFeed(ctx, mockDS, 10, oldestDate, "joke")
+	items, err := GetFeed(ctx, mockDS, 10, oldestDate, "joke", "", "", false, time.Time{})
 
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
@@ -289,7 +294,7 @@ func TestGetFeed_SkipsPagesWithoutJokePercentage(t *testing.T) {
 	}
 
 	oldestDate := now.Add(-1 * time.Hour)
-	items, err := GetFeed(ctx, mockDS, 10, oldestDate, "joke")
+	items, err := GetFeed(ctx, mockDS, 10, oldestDate, "joke", "", "", false, time.Time{})
 
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
@@ -309,9 +314,271 @@ func TestGetFeed_InvalidMode(t *testing.T) {
 	mockDS := lib.NewMockDatastoreClient()
 
 	oldestDate := time.Now().Add(-24 * time.Hour)
-	_, err := GetFeed(ctx, mockDS, 10, oldestDate, "invalid-mode")
+	_, err := GetFeed(ctx, mockDS, 10, oldestDate, "invalid-mode", "", "", false, time.Time{})
 
 	if err == nil {
 		t.Fatal("Expected error for invalid mode, got nil")
 	}
 }
+
+func TestGetFeed_FiltersByLanguage(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	now := time.Now()
+	languages := map[string]string{
+		"https://example.com/english": "en",
+		"https://example.com/german":  "de",
+		"https://example.com/unknown": "",
+	}
+	for url, language := range languages {
+		page := &models.CrawledPage{URL: url, Title: "Article", Content: "Content", DateTime: now, Language: language}
+		if err := mockDS.SaveCrawledPage(ctx, page); err != nil {
+			t.Fatalf("Failed to save crawled page: %v", err)
+		}
+		jokePercent := 50
+		err := mockDS.WriteAnalysisResult(ctx, page.URL, &models.AnalysisResult{
+			Mode:           analyzer.AnalysisModeJoke,
+			JokePercentage: &jokePercent,
+		})
+		if err != nil {
+			t.Fatalf("Failed to write analysis result: %v", err)
+		}
+	}
+
+	oldestDate := now.Add(-1 * time.Hour)
+	items, err := GetFeed(ctx, mockDS, 10, oldestDate, "joke", "DE", "", false, time.Time{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("Expected 1 German item, got %d", len(items))
+	}
+	if items[0].URL != "https://example.com/german" || items[0].Language != "de" {
+		t.Errorf("Expected German page, got %+v", items[0])
+	}
+
+	items, err = GetFeed(ctx, mockDS, 10, oldestDate, "joke", "", "", false, time.Time{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(items) != 3 {
+		t.Errorf("Expected all 3 items without a language filter, got %d", len(items))
+	}
+}
+
+func TestGetFeed_FiltersBySource(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	now := time.Now()
+	feed := models.SourceRef{Kind: models.SourceKindRSS, ID: "https://example.com/feed.xml"}
+	sources := map[string]models.SourceRef{
+		"example.com/from-feed":   feed,
+		"example.com/other-feed":  {Kind: models.SourceKindRSS, ID: "https://example.org/feed.xml"},
+		"example.com/submitted":   {Kind: models.SourceKindSubmission, ID: "zapier"},
+		"example.com/before-refs": {},
+	}
+	jokePercent := 50
+	for url, source := range sources {
+		mockDS.SaveCrawledPage(ctx, &models.CrawledPage{URL: url, Title: "Article", DateTime: now, Source: source})
+		mockDS.WriteAnalysisResult(ctx, url, &models.AnalysisResult{Mode: analyzer.AnalysisModeJoke, JokePercentage: &jokePercent})
+	}
+
+	oldestDate := now.Add(-1 * time.Hour)
+	tests := []struct {
+		source string
+		want   int
+	}{
+		{source: "", want: 4},
+		{source: "https://example.com/feed.xml", want: 1},
+		{source: "rss", want: 2},
+		{source: "zapier", want: 1},
+		{source: "https://unknown.example/feed.xml", want: 0},
+	}
+	for _, tt := range tests {
+		items, err := GetFeed(ctx, mockDS, 10, oldestDate, "joke", "", tt.source, false, time.Time{})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(items) != tt.want {
+			t.Errorf("GetFeed(source %q) returned %d item(s), want %d", tt.source, len(items), tt.want)
+		}
+		if tt.source == feed.ID && len(items) == 1 && items[0].Source != feed {
+			t.Errorf("Expected item source %+v, got %+v", feed, items[0].Source)
+		}
+	}
+}
+
+func TestGetFeed_AgesAndStaleness(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	now := time.Now()
+	fingerprint, err := analyzer.GeneratePromptFingerprint(analyzer.AnalysisModeJoke)
+	if err != nil {
+		t.Fatalf("Failed to generate fingerprint: %v", err)
+	}
+	jokePercent := 50
+
+	current := &models.CrawledPage{URL: "https://example.com/current", Title: "Current", DateTime: now,
+		PublishedAt: now.Add(-48 * time.Hour)}
+	mockDS.SaveCrawledPage(ctx, current)
+	mockDS.WriteAnalysisResult(ctx, current.URL, &models.AnalysisResult{
+		Mode:              analyzer.AnalysisModeJoke,
+		JokePercentage:    &jokePercent,
+		PromptFingerprint: fingerprint,
+		PromptVersion:     2,
+		AnalyzedAt:        now.Add(-2 * time.Hour),
+	})
+
+	old := &models.CrawledPage{URL: "https://example.com/old", Title: "Old", DateTime: now}
+	mockDS.SaveCrawledPage(ctx, old)
+	mockDS.WriteAnalysisResult(ctx, old.URL, &models.AnalysisResult{
+		Mode:              analyzer.AnalysisModeJoke,
+		JokePercentage:    &jokePercent,
+		PromptFingerprint: 12345,
+	})
+
+	oldestDate := now.Add(-1 * time.Hour)
+	items, err := GetFeed(ctx, mockDS, 10, oldestDate, "joke", "", "", false, time.Time{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(items))
+	}
+	for _, item := range items {
+		switch item.URL {
+		case current.URL:
+			if item.Stale {
+				t.Error("Expected current analysis not to be stale")
+			}
+			if item.PublishedAge < 48*time.Hour || item.PublishedAge > 49*time.Hour {
+				t.Errorf("Expected published age of about 48h, got %v", item.PublishedAge)
+			}
+			if item.AnalyzedAge < 2*time.Hour || item.AnalyzedAge > 3*time.Hour {
+				t.Errorf("Expected analyzed age of about 2h, got %v", item.AnalyzedAge)
+			}
+		case old.URL:
+			if !item.Stale {
+				t.Error("Expected analysis with an old fingerprint to be stale")
+			}
+			if item.PublishedAge != 0 || item.AnalyzedAge != 0 || !item.AnalyzedAt.IsZero() {
+				t.Errorf("Expected unknown ages to be zero, got %+v", item)
+			}
+		}
+	}
+
+	items, err = GetFeed(ctx, mockDS, 10, oldestDate, "joke", "", "", true, time.Time{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(items) != 1 || items[0].URL != current.URL {
+		t.Errorf("Expected only the current analysis with excludeStale, got %+v", items)
+	}
+}
+
+func TestGetFeed_FeedItemPublishedTime(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	now := time.Now()
+	jokePercent := 50
+	pages := []*models.CrawledPage{
+		{URL: "https://example.com/undated", Title: "Undated", DateTime: now},
+		{URL: "https://example.com/older", Title: "Older", DateTime: now,
+			FeedItem: models.FeedItemMetadata{Feed: "https://example.com/feed", PublishedAt: now.Add(-5 * time.Hour)}},
+		// The date declared by the page wins over the date of the feed item
+		{URL: "https://example.com/newer", Title: "Newer", DateTime: now, PublishedAt: now.Add(-2 * time.Hour),
+			FeedItem: models.FeedItemMetadata{Feed: "https://example.com/feed", PublishedAt: now.Add(-10 * time.Hour)}},
+	}
+	for _, page := range pages {
+		mockDS.SaveCrawledPage(ctx, page)
+		mockDS.WriteAnalysisResult(ctx, page.URL, &models.AnalysisResult{
+			Mode:           analyzer.AnalysisModeJoke,
+			JokePercentage: &jokePercent,
+		})
+	}
+
+	items, err := GetFeed(ctx, mockDS, 10, now.Add(-time.Hour), "joke", "", "", false, time.Time{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 items, got %d", len(items))
+	}
+	// Items with the same confidence are ranked newest published first
+	wantURLs := []string{"https://example.com/newer", "https://example.com/older", "https://example.com/undated"}
+	for i, item := range items {
+		if item.URL != wantURLs[i] {
+			t.Errorf("Expected item %d to be %s, got %s", i, wantURLs[i], item.URL)
+		}
+	}
+	if !items[1].PublishedAt.Equal(now.Add(-5*time.Hour)) || items[1].PublishedAge < 5*time.Hour || items[1].PublishedAge > 6*time.Hour {
+		t.Errorf("Expected the publication date of the feed item, got %v (age %v)", items[1].PublishedAt, items[1].PublishedAge)
+	}
+	if !items[0].PublishedAt.Equal(now.Add(-2 * time.Hour)) {
+		t.Errorf("Expected the publication date of the page, got %v", items[0].PublishedAt)
+	}
+}
+
+func TestGetFeed_AsOf(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	now := time.Now()
+	asOf := now.Add(-24 * time.Hour)
+	oldestDate := now.Add(-72 * time.Hour)
+	score := func(percent int) *int { return &percent }
+	save := func(url string, crawledAt time.Time, analysis *models.AnalysisResult, events ...models.AuditEvent) {
+		mockDS.SaveCrawledPage(ctx, &models.CrawledPage{URL: url, Title: url, DateTime: crawledAt})
+		analysis.Mode = analyzer.AnalysisModeJoke
+		mockDS.WriteAnalysisResult(ctx, url, analysis)
+		for _, event := range events {
+			event.URL = lib.NormalizeURL(url)
+			if event.Action != models.AuditActionFetched {
+				event.Mode = analyzer.AnalysisModeJoke
+			}
+			mockDS.AppendAuditEvent(ctx, &event)
+		}
+	}
+
+	// Without audit trail, the current analysis is used as it predates asOf
+	save("https://example.com/untracked", now.Add(-48*time.Hour),
+		&models.AnalysisResult{JokePercentage: score(80), AnalyzedAt: now.Add(-47 * time.Hour)})
+	// Re-analyzed after asOf: the earlier analysis is used
+	save("https://example.com/reanalyzed", now.Add(-48*time.Hour),
+		&models.AnalysisResult{JokePercentage: score(90), AnalyzedAt: now.Add(-time.Hour)},
+		models.AuditEvent{Action: models.AuditActionFetched, CreatedAt: now.Add(-48 * time.Hour)},
+		models.AuditEvent{Action: models.AuditActionAnalyzed, JokePercentage: score(30), CreatedAt: now.Add(-47 * time.Hour)},
+		models.AuditEvent{Action: models.AuditActionAnalyzed, JokePercentage: score(90), CreatedAt: now.Add(-time.Hour)})
+	// Crawled after asOf
+	save("https://example.com/new", now.Add(-time.Hour),
+		&models.AnalysisResult{JokePercentage: score(100), AnalyzedAt: now.Add(-time.Hour)})
+	// Deleted before asOf, analyzed again after it
+	save("https://example.com/deleted", now.Add(-48*time.Hour),
+		&models.AnalysisResult{JokePercentage: score(70), AnalyzedAt: now.Add(-time.Hour)},
+		models.AuditEvent{Action: models.AuditActionAnalyzed, JokePercentage: score(60), CreatedAt: now.Add(-47 * time.Hour)},
+		models.AuditEvent{Action: models.AuditActionDeleted, CreatedAt: now.Add(-30 * time.Hour)},
+		models.AuditEvent{Action: models.AuditActionAnalyzed, JokePercentage: score(70), CreatedAt: now.Add(-time.Hour)})
+	// Analysis without AnalyzedAt can't be dated
+	save("https://example.com/undated", now.Add(-48*time.Hour), &models.AnalysisResult{JokePercentage: score(50)})
+
+	items, err := GetFeed(ctx, mockDS, 10, oldestDate, "joke", "", "", false, asOf)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %+v", items)
+	}
+	if items[0].URL != "https://example.com/untracked" || items[0].JokeConfidence != 80 {
+		t.Errorf("Expected the untracked page first with 80%%, got %+v", items[0])
+	}
+	if items[1].URL != "https://example.com/reanalyzed" || items[1].JokeConfidence != 30 {
+		t.Errorf("Expected the analysis before asOf of the reanalyzed page, got %+v", items[1])
+	}
+	if items[1].AnalyzedAge != 23*time.Hour {
+		t.Errorf("Expected an analyzed age of 23h as of asOf, got %v", items[1].AnalyzedAge)
+	}
+}
@@ -0,0 +1,383 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/crawler/fetcher"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+	"github.com/zeace/poisson/models"
+)
+
+const (
+	// DefaultJobWorkers is the default number of jobs processed in parallel
+	DefaultJobWorkers = 2
+	// DefaultJobQueueSize is the default number of jobs of each priority that can wait for a worker
+	DefaultJobQueueSize = 100
+	// IdempotencyKeyTTL is how long an idempotency key maps to the job it created
+	IdempotencyKeyTTL = 24 * time.Hour
+	// jobTimeout bounds the fetch and analysis of a single job
+	jobTimeout = 2 * time.Minute
+)
+
+var (
+	// ErrJobQueueFull is returned by Enqueue when no more jobs can wait for a worker.
+	ErrJobQueueFull = errors.New("job queue is full")
+	// ErrIdempotencyKeyReused is returned by Enqueue when a key is reused for a different request.
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+)
+
+// JobProcessor performs the work of a job.
+type JobProcessor func(ctx context.Context, job *models.CrawlJob) error
+
+// JobQueue runs crawl and reanalyze jobs in the background and records their status in the Datastore.
+// Interactive and bulk jobs wait in separate lanes: workers take interactive jobs first, and a
+// full bulk lane doesn't reject interactive jobs.
+type JobQueue struct {
+	datastoreClient lib.DatastoreClient
+	process         JobProcessor
+	workers         int
+	interactive     chan *models.CrawlJob
+	bulk            chan *models.CrawlJob
+	wg              sync.WaitGroup
+
+	// mu guards reserved, the slots of each lane taken by jobs being saved before they are queued
+	mu       sync.Mutex
+	reserved map[models.JobPriority]int
+}
+
+// NewJobQueue creates a job queue with the given number of workers and queue size per priority.
+// Call Start to begin processing.
+func NewJobQueue(datastoreClient lib.DatastoreClient, process JobProcessor, workers, queueSize int) *JobQueue {
+	if workers <= 0 {
+		workers = DefaultJobWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultJobQueueSize
+	}
+	return &JobQueue{
+		datastoreClient: datastoreClient,
+		process:         process,
+		workers:         workers,
+		interactive:     make(chan *models.CrawlJob, queueSize),
+		bulk:            make(chan *models.CrawlJob, queueSize),
+		reserved:        make(map[models.JobPriority]int),
+	}
+}
+
+// Start launches the workers. They stop once ctx is done.
+func (q *JobQueue) Start(ctx context.Context) {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for {
+				// Interactive jobs go first; bulk jobs only run when none are waiting
+				select {
+				case job := <-q.interactive:
+					q.run(ctx, job)
+					continue
+				default:
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-q.interactive:
+					q.run(ctx, job)
+				case job := <-q.bulk:
+					q.run(ctx, job)
+				}
+			}
+		}()
+	}
+}
+
+// Wait blocks until all workers have stopped.
+func (q *JobQueue) Wait() {
+	q.wg.Wait()
+}
+
+// Enqueue records a new job and queues it for processing in the lane of priority.
+// If idempotencyKey is non-empty and was already used for the same request within IdempotencyKeyTTL,
+// the existing job is returned and nothing is queued. If the job can't be queued, the key is
+// released so that a retry queues it.
+func (q *JobQueue) Enqueue(
+	ctx context.Context,
+	jobType models.JobType,
+	url string,
+	mode models.AnalysisMode,
+	priority models.JobPriority,
+	source models.SourceRef,
+	idempotencyKey string,
+) (*models.CrawlJob, error) {
+	lane, err := q.lane(priority)
+	if err != nil {
+		return nil, err
+	}
+	if !q.reserve(priority, lane) {
+		return nil, ErrJobQueueFull
+	}
+	queued := false
+	defer func() {
+		if !queued {
+			q.unreserve(priority)
+		}
+	}()
+
+	now := time.Now()
+	job := &models.CrawlJob{
+		ID:        newJobID(),
+		Type:      jobType,
+		URL:       lib.NormalizeURL(url),
+		Mode:      mode,
+		Status:    models.JobStatusQueued,
+		Priority:  priority,
+		Source:    source,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if idempotencyKey != "" {
+		record, claimed, err := q.datastoreClient.ClaimIdempotencyKey(ctx, &models.IdempotencyKey{
+			Key:         idempotencyKey,
+			RequestHash: requestHash(jobType, job.URL, mode),
+			JobID:       job.ID,
+			ExpiresAt:   now.Add(IdempotencyKeyTTL),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error claiming idempotency key: %w", err)
+		}
+		if !claimed {
+			return q.existingJob(ctx, record, jobType, job.URL, mode)
+		}
+	}
+
+	if err := q.datastoreClient.WriteCrawlJob(ctx, job); err != nil {
+		q.releaseKey(ctx, idempotencyKey, job.ID)
+		return nil, fmt.Errorf("error saving job: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		q.releaseKey(ctx, idempotencyKey, job.ID)
+		return nil, err
+	}
+
+	// Workers update the queued job, so return a copy taken before queuing it
+	jobCopy := *job
+	q.mu.Lock()
+	lane <- job // The reserved slot keeps this send from blocking
+	q.reserved[priority]--
+	q.mu.Unlock()
+	queued = true
+
+	return &jobCopy, nil
+}
+
+// reserve takes a slot of lane for a job of priority, unless the jobs waiting in the lane and
+// those being saved already fill it.
+func (q *JobQueue) reserve(priority models.JobPriority, lane chan *models.CrawlJob) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(lane)+q.reserved[priority] >= cap(lane) {
+		return false
+	}
+	q.reserved[priority]++
+	return true
+}
+
+// releaseKey releases the idempotency key claimed for a job that wasn't queued. The request may
+// be cancelled already, so the key is released without its deadline.
+func (q *JobQueue) releaseKey(ctx context.Context, idempotencyKey, jobID string) {
+	if idempotencyKey == "" {
+		return
+	}
+	if err := q.datastoreClient.ReleaseIdempotencyKey(context.WithoutCancel(ctx), idempotencyKey, jobID); err != nil {
+		slog.WarnContext(ctx, "Error releasing idempotency key", "key", idempotencyKey, "error", err)
+	}
+}
+
+// unreserve gives back a slot taken by reserve for a job that wasn't queued.
+func (q *JobQueue) unreserve(priority models.JobPriority) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.reserved[priority]--
+}
+
+// EnqueueSelection queues bulk reanalyze jobs for the stored pages matched by selector, in URL
+// order, until the bulk lane is full. It returns the number of matched pages and the queued
+// jobs. A non-empty idempotencyKey is combined with each page URL, so a retried request returns
+// the jobs of the pages queued by the original one instead of queuing them twice.
+func (q *JobQueue) EnqueueSelection(
+	ctx context.Context,
+	selector analyzer.PageSelector,
+	mode models.AnalysisMode,
+	idempotencyKey string,
+) (int, []*models.CrawlJob, error) {
+	pages, err := analyzer.SelectPages(ctx, q.datastoreClient, selector, mode)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var jobs []*models.CrawlJob
+	for _, page := range pages {
+		key := idempotencyKey
+		if key != "" {
+			key += "|" + page.URL
+		}
+		job, err := q.Enqueue(ctx, models.JobTypeReanalyze, page.URL, mode, models.JobPriorityBulk, page.Source, key)
+		if errors.Is(err, ErrJobQueueFull) {
+			break
+		}
+		if err != nil {
+			return len(pages), jobs, err
+		}
+		jobs = append(jobs, job)
+	}
+	return len(pages), jobs, nil
+}
+
+// lane returns the channel jobs of priority wait in.
+func (q *JobQueue) lane(priority models.JobPriority) (chan *models.CrawlJob, error) {
+	switch priority {
+	case models.JobPriorityInteractive:
+		return q.interactive, nil
+	case models.JobPriorityBulk:
+		return q.bulk, nil
+	default:
+		return nil, fmt.Errorf("unknown job priority %q", priority)
+	}
+}
+
+// existingJob returns the job recorded for a previously used idempotency key.
+func (q *JobQueue) existingJob(
+	ctx context.Context,
+	record *models.IdempotencyKey,
+	jobType models.JobType,
+	url string,
+	mode models.AnalysisMode,
+) (*models.CrawlJob, error) {
+	if record.RequestHash != requestHash(jobType, url, mode) {
+		return nil, ErrIdempotencyKeyReused
+	}
+
+	job, found, err := q.datastoreClient.ReadCrawlJob(ctx, record.JobID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading job: %w", err)
+	}
+	if !found {
+		// The original request claimed the key but hasn't saved its job yet
+		return &models.CrawlJob{ID: record.JobID, Type: jobType, URL: url, Mode: mode, Status: models.JobStatusQueued}, nil
+	}
+	return job, nil
+}
+
+// run processes a job and records its final status.
+func (q *JobQueue) run(ctx context.Context, job *models.CrawlJob) {
+	ctx = logging.WithAttrs(ctx, "job", job.ID, "url", job.URL, "mode", job.Mode, "priority", job.Priority)
+
+	q.setStatus(ctx, job, models.JobStatusRunning, nil)
+
+	jobCtx, cancel := context.WithTimeout(ctx, jobTimeout)
+	err := q.process(jobCtx, job)
+	cancel()
+
+	if err != nil {
+		slog.WarnContext(ctx, "Job failed", "error", err)
+		q.setStatus(ctx, job, models.JobStatusFailed, err)
+		return
+	}
+	q.setStatus(ctx, job, models.JobStatusDone, nil)
+}
+
+func (q *JobQueue) setStatus(ctx context.Context, job *models.CrawlJob, status models.JobStatus, jobErr error) {
+	job.Status = status
+	job.UpdatedAt = time.Now()
+	if jobErr != nil {
+		job.Error = jobErr.Error()
+	}
+	if err := q.datastoreClient.WriteCrawlJob(ctx, job); err != nil {
+		slog.WarnContext(ctx, "Error saving job status", "status", status, "error", err)
+	}
+}
+
+// NewPipelineProcessor returns a JobProcessor that fetches and analyzes pages
+// with the crawler's fetcher, configured by fetchOptions, and analyzer.
+func NewPipelineProcessor(datastoreClient lib.DatastoreClient, fetchOptions fetcher.Options, llmOptions analyzer.LlmOptions) JobProcessor {
+	return func(ctx context.Context, job *models.CrawlJob) error {
+		var page *models.CrawledPage
+		if job.Type == models.JobTypeReanalyze {
+			stored, found, err := lib.ReadLinkedPage(ctx, datastoreClient, job.URL)
+			if err != nil {
+				return fmt.Errorf("error reading crawled page: %w", err)
+			}
+			if found {
+				page = stored
+			}
+		}
+		if page == nil {
+			jobOptions := fetchOptions
+			jobOptions.Source = job.Source
+			fetched, _, err := fetcher.FetchArticleContent(ctx, job.URL, false, datastoreClient, jobOptions)
+			if err != nil {
+				return err
+			}
+			page = fetched
+		}
+
+		switch job.Type {
+		case models.JobTypeCrawl:
+			_, err := analyzer.Analyze(ctx, page, llmOptions, job.Mode, datastoreClient, false)
+			return err
+		case models.JobTypeReanalyze:
+			_, err := analyzer.Reanalyze(ctx, page, llmOptions, job.Mode, datastoreClient, false)
+			return err
+		default:
+			return fmt.Errorf("unknown job type %q", job.Type)
+		}
+	}
+}
+
+// newJobID returns a random job ID.
+func newJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestHash identifies the operation and arguments of a job request.
+func requestHash(jobType models.JobType, url string, mode models.AnalysisMode) string {
+	h := sha256.Sum256([]byte(string(jobType) + "\x00" + url + "\x00" + string(mode)))
+	return hex.EncodeToString(h[:])
+}
+
+// SubmissionSource returns the source of the URLs submitted in a request: a submission named
+// after the request's API token, if it has one.
+func SubmissionSource(ctx context.Context) models.SourceRef {
+	source := models.SourceRef{Kind: models.SourceKindSubmission}
+	if token := APITokenFromContext(ctx); token != nil {
+		source.ID = token.Name
+	}
+	return source
+}
+
+type idempotencyKeyContextKey struct{}
+
+// WithIdempotencyKey returns a context carrying the client-supplied idempotency key of the request.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// IdempotencyKeyFromContext returns the idempotency key stored by WithIdempotencyKey, or "".
+func IdempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyContextKey{}).(string)
+	return key
+}
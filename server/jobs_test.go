@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// waitForJobStatus polls the mock Datastore until the job reaches status or the test times out.
+func waitForJobStatus(t *testing.T, mockDS *lib.MockDatastoreClient, id string, status models.JobStatus) *models.CrawlJob {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		job, found, _ := mockDS.ReadCrawlJob(context.Background(), id)
+		if found && job.Status == status {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not reach status %q", id, status)
+	return nil
+}
+
+func TestJobQueue_RunsJobs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mockDS := lib.NewMockDatastoreClient()
+
+	processErr := errors.New("fetch failed")
+	queue := NewJobQueue(mockDS, func(ctx context.Context, job *models.CrawlJob) error {
+		if job.URL == "example.com/broken" {
+			return processErr
+		}
+		return nil
+	}, 2, 10)
+	queue.Start(ctx)
+
+	okJob, err := queue.Enqueue(ctx, models.JobTypeCrawl, "https://example.com/article", analyzer.AnalysisModeJoke, models.JobPriorityInteractive, models.SourceRef{}, "")
+	if err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+	if okJob.Status != models.JobStatusQueued || okJob.URL != "example.com/article" {
+		t.Errorf("Enqueue returned %+v, want queued job for normalized URL", okJob)
+	}
+	failJob, _ := queue.Enqueue(ctx, models.JobTypeCrawl, "https://example.com/broken", analyzer.AnalysisModeJoke, models.JobPriorityInteractive, models.SourceRef{}, "")
+
+	waitForJobStatus(t, mockDS, okJob.ID, models.JobStatusDone)
+	failed := waitForJobStatus(t, mockDS, failJob.ID, models.JobStatusFailed)
+	if failed.Error != processErr.Error() {
+		t.Errorf("failed job Error = %q, want %q", failed.Error, processErr.Error())
+	}
+}
+
+func TestJobQueue_IdempotencyKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mockDS := lib.NewMockDatastoreClient()
+
+	var mu sync.Mutex
+	processed := 0
+	queue := NewJobQueue(mockDS, func(ctx context.Context, job *models.CrawlJob) error {
+		mu.Lock()
+		processed++
+		mu.Unlock()
+		return nil
+	}, 1, 10)
+	queue.Start(ctx)
+
+	first, err := queue.Enqueue(ctx, models.JobTypeCrawl, "https://example.com/a", analyzer.AnalysisModeJoke, models.JobPriorityInteractive, models.SourceRef{}, "key-1")
+	if err != nil {
+		t.Fatalf("first Enqueue returned error: %v", err)
+	}
+	waitForJobStatus(t, mockDS, first.ID, models.JobStatusDone)
+
+	// A retry with the same key returns the original job without queuing another
+	retry, err := queue.Enqueue(ctx, models.JobTypeCrawl, "http://example.com/a", analyzer.AnalysisModeJoke, models.JobPriorityInteractive, models.SourceRef{}, "key-1")
+	if err != nil {
+		t.Fatalf("retried Enqueue returned error: %v", err)
+	}
+	if retry.ID != first.ID || retry.Status != models.JobStatusDone {
+		t.Errorf("retry returned job %s (%s), want %s (done)", retry.ID, retry.Status, first.ID)
+	}
+
+	// The same key with different arguments is rejected
+	if _, err := queue.Enqueue(ctx, models.JobTypeReanalyze, "https://example.com/a", analyzer.AnalysisModeJoke, models.JobPriorityInteractive, models.SourceRef{}, "key-1"); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("Enqueue with reused key error = %v, want %v", err, ErrIdempotencyKeyReused)
+	}
+
+	// Once the key has expired it can be used again
+	mockDS.IdempotencyKeys["key-1"].ExpiresAt = time.Now().Add(-time.Second)
+	again, err := queue.Enqueue(ctx, models.JobTypeCrawl, "https://example.com/a", analyzer.AnalysisModeJoke, models.JobPriorityInteractive, models.SourceRef{}, "key-1")
+	if err != nil {
+		t.Fatalf("Enqueue after expiry returned error: %v", err)
+	}
+	if again.ID == first.ID {
+		t.Error("expected a new job after the idempotency key expired")
+	}
+	waitForJobStatus(t, mockDS, again.ID, models.JobStatusDone)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if processed != 2 {
+		t.Errorf("processed %d jobs, want 2", processed)
+	}
+}
+
+func TestJobQueue_Full(t *testing.T) {
+	mockDS := lib.NewMockDatastoreClient()
+	queue := NewJobQueue(mockDS, func(ctx context.Context, job *models.CrawlJob) error { return nil }, 1, 1)
+	// Workers are not started, so the single slot stays taken
+
+	ctx := context.Background()
+	if _, err := queue.Enqueue(ctx, models.JobTypeCrawl, "https://example.com/a", analyzer.AnalysisModeJoke, models.JobPriorityInteractive, models.SourceRef{}, ""); err != nil {
+		t.Fatalf("first Enqueue returned error: %v", err)
+	}
+	if _, err := queue.Enqueue(ctx, models.JobTypeCrawl, "https://example.com/b", analyzer.AnalysisModeJoke, models.JobPriorityInteractive, models.SourceRef{}, ""); !errors.Is(err, ErrJobQueueFull) {
+		t.Errorf("Enqueue on full queue error = %v, want %v", err, ErrJobQueueFull)
+	}
+}
+
+func TestJobQueue_FullConcurrent(t *testing.T) {
+	mockDS := lib.NewMockDatastoreClient()
+	queue := NewJobQueue(mockDS, func(ctx context.Context, job *models.CrawlJob) error { return nil }, 1, 3)
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	queued, full := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := queue.Enqueue(ctx, models.JobTypeCrawl, fmt.Sprintf("https://example.com/%d", i), analyzer.AnalysisModeJoke, models.JobPriorityInteractive, models.SourceRef{}, "")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				queued++
+			case errors.Is(err, ErrJobQueueFull):
+				full++
+			default:
+				t.Errorf("Enqueue returned error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if queued != 3 || full != 7 {
+		t.Errorf("queued %d jobs and rejected %d, want 3 and 7", queued, full)
+	}
+}
+
+func TestJobQueue_CancelledReleasesKey(t *testing.T) {
+	mockDS := lib.NewMockDatastoreClient()
+	queue := NewJobQueue(mockDS, func(ctx context.Context, job *models.CrawlJob) error { return nil }, 1, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := queue.Enqueue(ctx, models.JobTypeCrawl, "https://example.com/a", analyzer.AnalysisModeJoke, models.JobPriorityInteractive, models.SourceRef{}, "key-1"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Enqueue with cancelled context error = %v, want %v", err, context.Canceled)
+	}
+	if _, exists := mockDS.IdempotencyKeys["key-1"]; exists {
+		t.Error("expected the idempotency key of the cancelled request to be released")
+	}
+
+	// The retry queues the job, in the slot the cancelled request gave back
+	job, err := queue.Enqueue(context.Background(), models.JobTypeCrawl, "https://example.com/a", analyzer.AnalysisModeJoke, models.JobPriorityInteractive, models.SourceRef{}, "key-1")
+	if err != nil {
+		t.Fatalf("retried Enqueue returned error: %v", err)
+	}
+	if record := mockDS.IdempotencyKeys["key-1"]; record == nil || record.JobID != job.ID {
+		t.Errorf("idempotency key maps to %+v, want job %s", record, job.ID)
+	}
+}
+
+func TestJobQueue_Priority(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mockDS := lib.NewMockDatastoreClient()
+
+	var mu sync.Mutex
+	var order []string
+	queue := NewJobQueue(mockDS, func(ctx context.Context, job *models.CrawlJob) error {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, job.URL)
+		return nil
+	}, 1, 2)
+
+	// Queue before starting the worker, so both lanes are waiting
+	var last *models.CrawlJob
+	for _, url := range []string{"https://example.com/bulk-1", "https://example.com/bulk-2"} {
+		job, err := queue.Enqueue(ctx, models.JobTypeCrawl, url, analyzer.AnalysisModeJoke, models.JobPriorityBulk, models.SourceRef{}, "")
+		if err != nil {
+			t.Fatalf("Enqueue returned error: %v", err)
+		}
+		last = job
+	}
+	// A full bulk lane doesn't reject interactive jobs
+	if _, err := queue.Enqueue(ctx, models.JobTypeCrawl, "https://example.com/bulk-3", analyzer.AnalysisModeJoke, models.JobPriorityBulk, models.SourceRef{}, ""); !errors.Is(err, ErrJobQueueFull) {
+		t.Errorf("Enqueue on full bulk lane error = %v, want %v", err, ErrJobQueueFull)
+	}
+	interactive, err := queue.Enqueue(ctx, models.JobTypeCrawl, "https://example.com/interactive", analyzer.AnalysisModeJoke, models.JobPriorityInteractive, models.SourceRef{}, "")
+	if err != nil {
+		t.Fatalf("Enqueue returned error: %v", err)
+	}
+	if interactive.Priority != models.JobPriorityInteractive {
+		t.Errorf("Priority = %q, want %q", interactive.Priority, models.JobPriorityInteractive)
+	}
+
+	queue.Start(ctx)
+	waitForJobStatus(t, mockDS, last.ID, models.JobStatusDone)
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"example.com/interactive", "example.com/bulk-1", "example.com/bulk-2"}
+	if len(order) != len(want) {
+		t.Fatalf("processed %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Errorf("processed %v, want %v", order, want)
+			break
+		}
+	}
+
+	if _, err := queue.Enqueue(ctx, models.JobTypeCrawl, "https://example.com/a", analyzer.AnalysisModeJoke, models.JobPriority("urgent"), models.SourceRef{}, ""); err == nil {
+		t.Error("expected error for unknown priority")
+	}
+}
+
+func TestJobQueue_EnqueueSelection(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	now := time.Now()
+	for _, url := range []string{"example.com/c", "example.com/a", "example.com/b", "other.com/d"} {
+		mockDS.WriteCrawledPage(ctx, url, "Title", "Content", now)
+	}
+	queue := NewJobQueue(mockDS, func(ctx context.Context, job *models.CrawlJob) error { return nil }, 1, 2)
+	// Workers are not started yet, so the bulk lane fills up after two jobs
+
+	selector := analyzer.PageSelector{Domain: "example.com"}
+	matched, jobs, err := queue.EnqueueSelection(ctx, selector, analyzer.AnalysisModeJoke, "key-1")
+	if err != nil {
+		t.Fatalf("EnqueueSelection returned error: %v", err)
+	}
+	if matched != 3 || len(jobs) != 2 {
+		t.Fatalf("EnqueueSelection = %d matched, %d jobs, want 3 matched and 2 jobs", matched, len(jobs))
+	}
+	for i, url := range []string{"example.com/a", "example.com/b"} {
+		if jobs[i].URL != url || jobs[i].Type != models.JobTypeReanalyze || jobs[i].Priority != models.JobPriorityBulk {
+			t.Errorf("jobs[%d] = %+v, want a bulk reanalyze job for %s", i, jobs[i], url)
+		}
+	}
+
+	// Once the lane has room, a retried request returns the same jobs and queues the rest
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	queue.Start(runCtx)
+	waitForJobStatus(t, mockDS, jobs[1].ID, models.JobStatusDone)
+	_, retried, err := queue.EnqueueSelection(ctx, selector, analyzer.AnalysisModeJoke, "key-1")
+	if err != nil || len(retried) != 3 || retried[0].ID != jobs[0].ID || retried[1].ID != jobs[1].ID || retried[2].URL != "example.com/c" {
+		t.Errorf("retried EnqueueSelection = %v, %v, want the original jobs and one for example.com/c", retried, err)
+	}
+}
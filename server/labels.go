@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+	"github.com/zeace/poisson/models"
+)
+
+// LabelArticle stores a human verdict on whether the article at url is a joke, replacing any
+// earlier label of the article. The name of the request's API token, if any, is recorded as the labeler.
+func LabelArticle(
+	ctx context.Context,
+	datastoreClient lib.DatastoreClient,
+	url string,
+	isJoke bool,
+) (*models.JokeLabel, error) {
+	if url == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	label := &models.JokeLabel{
+		URL:       lib.NormalizeURL(url),
+		IsJoke:    isJoke,
+		CreatedAt: time.Now(),
+	}
+	if token := APITokenFromContext(ctx); token != nil {
+		label.Labeler = token.Name
+	}
+	ctx = logging.WithAttrs(ctx, "url", label.URL)
+	if err := datastoreClient.WriteJokeLabel(ctx, label); err != nil {
+		return nil, err
+	}
+	lib.RecordAuditEvent(ctx, datastoreClient, &models.AuditEvent{
+		URL:    label.URL,
+		Action: models.AuditActionLabeled,
+		Detail: models.LabelVerdict(label.IsJoke),
+		Actor:  label.Labeler,
+	})
+	return label, nil
+}
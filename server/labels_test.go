@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestLabelArticle(t *testing.T) {
+	mockDS := lib.NewMockDatastoreClient()
+	ctx := WithAPIToken(context.Background(), &models.APIToken{Name: "reviewer"}, true)
+
+	label, err := LabelArticle(ctx, mockDS, "https://www.example.com/story", true)
+	if err != nil {
+		t.Fatalf("LabelArticle returned error: %v", err)
+	}
+	if label.URL != lib.NormalizeURL("https://www.example.com/story") || !label.IsJoke || label.Labeler != "reviewer" {
+		t.Errorf("unexpected label %+v", label)
+	}
+
+	if _, err := LabelArticle(ctx, mockDS, "https://www.example.com/story", false); err != nil {
+		t.Fatalf("LabelArticle returned error: %v", err)
+	}
+	labels, err := mockDS.ListJokeLabels(ctx)
+	if err != nil {
+		t.Fatalf("ListJokeLabels returned error: %v", err)
+	}
+	if len(labels) != 1 || labels[0].IsJoke {
+		t.Errorf("expected the second label to replace the first, got %+v", labels)
+	}
+
+	if _, err := LabelArticle(ctx, mockDS, "", true); err == nil {
+		t.Error("expected error for empty url")
+	}
+}
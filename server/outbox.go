@@ -0,0 +1,189 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+const (
+	// DefaultOutboxInterval is how often the outbox looks for messages due for delivery.
+	DefaultOutboxInterval = 15 * time.Second
+	// DefaultOutboxMaxAttempts is how many times delivery of a message is tried before giving up.
+	DefaultOutboxMaxAttempts = 10
+	// outboxBaseBackoff is the wait after the first failed attempt, doubled after each other one.
+	outboxBaseBackoff = 30 * time.Second
+	// outboxMaxBackoff bounds the wait between two attempts.
+	outboxMaxBackoff = 6 * time.Hour
+	// outboxDeliveryTimeout bounds each delivery request.
+	outboxDeliveryTimeout = 10 * time.Second
+	// outboxLeaseName is the lease held while delivering, so that a message isn't sent by
+	// several instances at once.
+	outboxLeaseName = "outbox"
+	// outboxLeaseTTL is how long the outbox lease lasts without renewal.
+	outboxLeaseTTL = time.Minute
+)
+
+// Outbox delivers notifications to webhooks. Messages are stored in the OutboxMessage
+// collection before being sent and retried with exponential backoff until the destination
+// accepts them, so they survive failures of the destination and restarts of the server.
+// Delivery is at least once: destinations should ignore repeated X-Poisson-Delivery IDs.
+type Outbox struct {
+	datastoreClient lib.DatastoreClient
+	httpClient      *http.Client
+	interval        time.Duration
+	maxAttempts     int
+	holder          string
+}
+
+// NewOutbox creates an outbox that tries each message up to maxAttempts times (or
+// DefaultOutboxMaxAttempts if not positive). Call Start to deliver messages every interval.
+func NewOutbox(datastoreClient lib.DatastoreClient, interval time.Duration, maxAttempts int) *Outbox {
+	if interval <= 0 {
+		interval = DefaultOutboxInterval
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultOutboxMaxAttempts
+	}
+	return &Outbox{
+		datastoreClient: datastoreClient,
+		httpClient:      &http.Client{Timeout: outboxDeliveryTimeout},
+		interval:        interval,
+		maxAttempts:     maxAttempts,
+		holder:          lib.LeaseHolderID(),
+	}
+}
+
+// Enqueue stores a message sending payload as JSON to destination, due for immediate delivery.
+// id identifies the notification: a message with the same ID is only stored once.
+func (o *Outbox) Enqueue(ctx context.Context, id, destination, event string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding %s message: %w", event, err)
+	}
+	now := time.Now()
+	message := &models.OutboxMessage{
+		ID:            id,
+		Destination:   destination,
+		Event:         event,
+		Payload:       body,
+		Status:        models.OutboxStatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	if _, err := o.datastoreClient.CreateOutboxMessage(ctx, message); err != nil {
+		return fmt.Errorf("error storing %s message for %s: %w", event, destination, err)
+	}
+	return nil
+}
+
+// Start delivers due messages in the background every interval until ctx is done.
+func (o *Outbox) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(o.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := o.DeliverDue(ctx); err != nil {
+					slog.WarnContext(ctx, "Error delivering outbox messages", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// DeliverDue tries to deliver the messages that are due and returns how many were accepted.
+// It does nothing if another instance is delivering.
+func (o *Outbox) DeliverDue(ctx context.Context) (int, error) {
+	delivered := 0
+	_, err := lib.RunWithLease(ctx, o.datastoreClient, outboxLeaseName, o.holder, outboxLeaseTTL,
+		func(ctx context.Context) error {
+			messages, err := o.datastoreClient.ListDueOutboxMessages(ctx, time.Now())
+			if err != nil {
+				return fmt.Errorf("error listing due outbox messages: %w", err)
+			}
+			for _, message := range messages {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if o.deliver(ctx, message) {
+					delivered++
+				}
+			}
+			return nil
+		})
+	return delivered, err
+}
+
+// deliver sends message and records the outcome, returning whether the destination accepted it.
+// A failed message is scheduled for another attempt, or marked failed after maxAttempts.
+func (o *Outbox) deliver(ctx context.Context, message *models.OutboxMessage) bool {
+	sendErr := o.send(ctx, message)
+	now := time.Now()
+	if sendErr == nil {
+		message.Status = models.OutboxStatusDelivered
+		message.DeliveredAt = now
+		message.LastError = ""
+	} else {
+		message.Attempts++
+		message.LastError = sendErr.Error()
+		message.NextAttemptAt = now.Add(outboxBackoff(message.Attempts))
+		if message.Attempts >= o.maxAttempts {
+			message.Status = models.OutboxStatusFailed
+			slog.ErrorContext(ctx, "Giving up outbox message", "id", message.ID,
+				"destination", message.Destination, "attempts", message.Attempts, "error", sendErr)
+		} else {
+			slog.WarnContext(ctx, "Outbox delivery failed", "id", message.ID,
+				"destination", message.Destination, "attempts", message.Attempts, "error", sendErr)
+		}
+	}
+
+	// A message whose outcome isn't stored stays due and is sent again
+	if err := o.datastoreClient.WriteOutboxMessage(context.WithoutCancel(ctx), message); err != nil {
+		slog.WarnContext(ctx, "Error storing outbox message", "id", message.ID, "error", err)
+	}
+	return sendErr == nil
+}
+
+// send posts the payload of message to its destination. Any 2xx response accepts it.
+func (o *Outbox) send(ctx context.Context, message *models.OutboxMessage) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, message.Destination,
+		bytes.NewReader(message.Payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Poisson-Event", message.Event)
+	request.Header.Set("X-Poisson-Delivery", message.ID)
+
+	response, err := o.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("destination returned %s", response.Status)
+	}
+	return nil
+}
+
+// outboxBackoff returns the wait before the next attempt of a message that failed attempts times.
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxBaseBackoff
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, outboxMaxBackoff)
+}
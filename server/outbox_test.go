@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// webhookRecorder is a webhook failing its first failures requests and recording the others.
+type webhookRecorder struct {
+	mu         sync.Mutex
+	failures   int
+	deliveries []string
+	events     []FeedEvent
+}
+
+func (w *webhookRecorder) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failures > 0 {
+		w.failures--
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var event FeedEvent
+	json.NewDecoder(r.Body).Decode(&event)
+	w.deliveries = append(w.deliveries, r.Header.Get("X-Poisson-Delivery"))
+	w.events = append(w.events, event)
+}
+
+// makeDue makes every pending message of mockDS due for delivery.
+func makeDue(mockDS *lib.MockDatastoreClient) {
+	for _, message := range mockDS.OutboxMessages {
+		message.NextAttemptAt = time.Now().Add(-time.Second)
+	}
+}
+
+func TestOutbox_RetriesUntilDelivered(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	webhook := &webhookRecorder{failures: 2}
+	httpServer := httptest.NewServer(webhook)
+	defer httpServer.Close()
+
+	outbox := NewOutbox(mockDS, time.Hour, 5)
+	if err := outbox.Enqueue(ctx, "message-1", httpServer.URL, "item", FeedEvent{URL: "example.com/joke"}); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	// The same notification is only stored once
+	if err := outbox.Enqueue(ctx, "message-1", httpServer.URL, "item", FeedEvent{URL: "example.com/joke"}); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		if delivered, err := outbox.DeliverDue(ctx); err != nil || delivered != 0 {
+			t.Fatalf("attempt %d: DeliverDue() = %d, %v, want a failed delivery", attempt, delivered, err)
+		}
+		message := mockDS.OutboxMessages["message-1"]
+		if message.Status != models.OutboxStatusPending || message.Attempts != attempt || message.LastError == "" {
+			t.Fatalf("attempt %d: message = %+v, want a pending message with an error", attempt, message)
+		}
+		if wait := time.Until(message.NextAttemptAt); wait < outboxBackoff(attempt)-time.Minute {
+			t.Errorf("attempt %d: next attempt in %v, want about %v", attempt, wait, outboxBackoff(attempt))
+		}
+		// Not due yet
+		if delivered, _ := outbox.DeliverDue(ctx); delivered != 0 {
+			t.Errorf("attempt %d: message was retried before its backoff", attempt)
+		}
+		makeDue(mockDS)
+	}
+
+	if delivered, err := outbox.DeliverDue(ctx); err != nil || delivered != 1 {
+		t.Fatalf("DeliverDue() = %d, %v, want 1 delivery", delivered, err)
+	}
+	message := mockDS.OutboxMessages["message-1"]
+	if message.Status != models.OutboxStatusDelivered || message.DeliveredAt.IsZero() {
+		t.Errorf("message = %+v, want a delivered message", message)
+	}
+	if len(webhook.deliveries) != 1 || webhook.deliveries[0] != "message-1" || webhook.events[0].URL != "example.com/joke" {
+		t.Errorf("webhook got %v %+v, want message-1 once", webhook.deliveries, webhook.events)
+	}
+}
+
+func TestOutbox_GivesUp(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	webhook := &webhookRecorder{failures: 10}
+	httpServer := httptest.NewServer(webhook)
+	defer httpServer.Close()
+
+	outbox := NewOutbox(mockDS, time.Hour, 2)
+	outbox.Enqueue(ctx, "message-1", httpServer.URL, "item", FeedEvent{})
+	for range 3 {
+		outbox.DeliverDue(ctx)
+		makeDue(mockDS)
+	}
+	if message := mockDS.OutboxMessages["message-1"]; message.Status != models.OutboxStatusFailed || message.Attempts != 2 {
+		t.Errorf("message = %+v, want failed after 2 attempts", message)
+	}
+}
+
+func TestOutbox_SkipsWhileAnotherInstanceDelivers(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	mockDS.AcquireLease(ctx, outboxLeaseName, "other-instance", time.Hour)
+
+	outbox := NewOutbox(mockDS, time.Hour, 5)
+	outbox.Enqueue(ctx, "message-1", "http://127.0.0.1:1", "item", FeedEvent{})
+	if delivered, err := outbox.DeliverDue(ctx); err != nil || delivered != 0 {
+		t.Errorf("DeliverDue() = %d, %v, want nothing delivered", delivered, err)
+	}
+	if message := mockDS.OutboxMessages["message-1"]; message.Attempts != 0 {
+		t.Errorf("message = %+v, want no attempt", message)
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{20, outboxMaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := outboxBackoff(tt.attempts); got != tt.want {
+			t.Errorf("outboxBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestFeedEvents_Webhooks(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	outbox := NewOutbox(mockDS, time.Hour, 5)
+
+	// Two instances polling the same analyses queue each notification once
+	first := NewFeedEvents(mockDS, analyzer.AnalysisModeJoke, 70, time.Hour)
+	second := NewFeedEvents(mockDS, analyzer.AnalysisModeJoke, 70, time.Hour)
+	webhooks := []string{"https://hooks.example.com/a", "https://hooks.example.com/b"}
+	first.SendToWebhooks(outbox, webhooks)
+	second.SendToWebhooks(outbox, webhooks)
+	second.since = first.since
+
+	storeAnalysis(mockDS, "example.com/serious", 20, first.since.Add(time.Second))
+	storeAnalysis(mockDS, "example.com/likely", 80, first.since.Add(2*time.Second))
+	first.poll(ctx)
+	second.poll(ctx)
+
+	if len(mockDS.OutboxMessages) != 2 {
+		t.Fatalf("got %d outbox messages, want 1 per webhook", len(mockDS.OutboxMessages))
+	}
+	for _, message := range mockDS.OutboxMessages {
+		var event FeedEvent
+		if err := json.Unmarshal(message.Payload, &event); err != nil || event.URL != "example.com/likely" {
+			t.Errorf("message payload = %s, want the likely joke", message.Payload)
+		}
+		if message.Event != "item" || message.Status != models.OutboxStatusPending {
+			t.Errorf("message = %+v, want a pending item message", message)
+		}
+	}
+}
+
+func TestFeedEvents_WebhooksResume(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	outbox := NewOutbox(mockDS, time.Hour, 5)
+	webhooks := []string{"https://hooks.example.com/a"}
+
+	first := NewFeedEvents(mockDS, analyzer.AnalysisModeJoke, 70, time.Hour)
+	first.SendToWebhooks(outbox, webhooks)
+	start := first.since
+	storeAnalysis(mockDS, "example.com/first", 80, start.Add(time.Second))
+
+	// An analysis whose message can't be queued is queued by the next poll
+	mockDS.OutboxError = errors.New("datastore unavailable")
+	first.poll(ctx)
+	if !first.since.Equal(start) {
+		t.Errorf("since = %v after a failed poll, want %v", first.since, start)
+	}
+	mockDS.OutboxError = nil
+	first.poll(ctx)
+	if len(mockDS.OutboxMessages) != 1 {
+		t.Fatalf("got %d outbox messages, want the first joke", len(mockDS.OutboxMessages))
+	}
+
+	// A server started later resumes from the recorded cursor
+	storeAnalysis(mockDS, "example.com/while-down", 90, start.Add(2*time.Second))
+	restarted := NewFeedEvents(mockDS, analyzer.AnalysisModeJoke, 70, time.Hour)
+	restarted.SendToWebhooks(outbox, webhooks)
+	restarted.resume(ctx)
+	restarted.poll(ctx)
+	if len(mockDS.OutboxMessages) != 2 {
+		t.Fatalf("got %d outbox messages, want the joke analyzed while no server ran too", len(mockDS.OutboxMessages))
+	}
+	if cursor := mockDS.EventsCursors[string(analyzer.AnalysisModeJoke)]; cursor == nil || !cursor.Since.Equal(start.Add(2*time.Second)) {
+		t.Errorf("cursor = %+v, want the latest analysis", cursor)
+	}
+}
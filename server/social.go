@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/zeace/poisson/crawler/socialfetcher"
+	"github.com/zeace/poisson/models"
+)
+
+// socialLinkBuffer is the number of shared links that can wait to be queued.
+const socialLinkBuffer = 100
+
+// MaxSocialLinksPerHour is the largest number of links queued for one source per hour.
+const MaxSocialLinksPerHour = 60
+
+// ErrSocialQuotaExceeded is why a shared link is dropped when its source has used its hourly quota.
+var ErrSocialQuotaExceeded = errors.New("hourly quota of the source exceeded")
+
+// SocialWatcher queues crawl jobs for the article links shared in watched Mastodon and Bluesky
+// accounts and hashtags (see socialfetcher.Watch). A link shared several times is queued once
+// per IdempotencyKeyTTL, across all the instances of the server, and each source queues at most
+// MaxSocialLinksPerHour links per hour on each instance.
+type SocialWatcher struct {
+	jobQueue *JobQueue
+	sources  []socialfetcher.Source
+	options  socialfetcher.Options
+	mode     models.AnalysisMode
+
+	// quotas are the links queued in the current hour of each source. Only queueLinks uses them.
+	quotas map[string]*socialQuota
+}
+
+// socialQuota counts the links queued for a source since start.
+type socialQuota struct {
+	start time.Time
+	count int
+}
+
+// NewSocialWatcher creates a watcher queuing the links shared in sources for analysis in mode.
+// Call Start to begin watching.
+func NewSocialWatcher(jobQueue *JobQueue, sources []socialfetcher.Source, options socialfetcher.Options, mode models.AnalysisMode) *SocialWatcher {
+	return &SocialWatcher{jobQueue: jobQueue, sources: sources, options: options, mode: mode, quotas: make(map[string]*socialQuota)}
+}
+
+// Start watches the sources in the background until ctx is done.
+func (w *SocialWatcher) Start(ctx context.Context) {
+	links := make(chan socialfetcher.Link, socialLinkBuffer)
+	go func() {
+		socialfetcher.Watch(ctx, w.sources, w.options, links)
+		close(links)
+	}()
+	go w.queueLinks(ctx, links)
+}
+
+// queueLinks queues a bulk crawl job for each link received until links is closed. Links
+// arriving while the bulk lane is full or once their source has used its quota are dropped.
+func (w *SocialWatcher) queueLinks(ctx context.Context, links <-chan socialfetcher.Link) {
+	for link := range links {
+		job, err := w.queueLink(ctx, link)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			level := slog.LevelWarn
+			if errors.Is(err, ErrJobQueueFull) || errors.Is(err, ErrSocialQuotaExceeded) {
+				level = slog.LevelInfo
+			}
+			slog.Log(ctx, level, "Dropping shared link", "url", link.URL, "source", link.Source, "error", err)
+			continue
+		}
+		slog.DebugContext(ctx, "Queued shared link", "url", link.URL, "source", link.Source, "post", link.PostURL, "job", job.ID)
+	}
+}
+
+// queueLink queues a bulk crawl job for link, if its source has quota left.
+func (w *SocialWatcher) queueLink(ctx context.Context, link socialfetcher.Link) (*models.CrawlJob, error) {
+	now := time.Now()
+	quota := w.quotas[link.Source]
+	if quota == nil || now.Sub(quota.start) >= time.Hour {
+		quota = &socialQuota{start: now}
+		w.quotas[link.Source] = quota
+	}
+	if quota.count >= MaxSocialLinksPerHour {
+		return nil, ErrSocialQuotaExceeded
+	}
+
+	job, err := w.jobQueue.Enqueue(ctx, models.JobTypeCrawl, link.URL, w.mode, models.JobPriorityBulk,
+		models.SourceRef{Kind: models.SourceKindSocial, ID: link.Source}, "social|"+link.URL)
+	if err != nil {
+		return nil, err
+	}
+	quota.count++
+	return job, nil
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/crawler/socialfetcher"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestSocialWatcher_QueueLinks(t *testing.T) {
+	mockDS := lib.NewMockDatastoreClient()
+	// Not started, so queued jobs stay in the bulk lane
+	queue := NewJobQueue(mockDS, func(ctx context.Context, job *models.CrawlJob) error { return nil }, 1, 2)
+	watcher := NewSocialWatcher(queue, nil, socialfetcher.Options{}, analyzer.AnalysisModeJoke)
+
+	links := make(chan socialfetcher.Link, 4)
+	for _, url := range []string{
+		"https://news.example.com/a",
+		"https://news.example.com/a", // Shared again
+		"https://news.example.com/b",
+		"https://news.example.com/c", // Bulk lane full
+	} {
+		links <- socialfetcher.Link{URL: url, Source: "bluesky:#april"}
+	}
+	close(links)
+	watcher.queueLinks(context.Background(), links)
+
+	var urls []string
+	for _, job := range mockDS.CrawlJobs {
+		if job.Priority != models.JobPriorityBulk || job.Mode != analyzer.AnalysisModeJoke {
+			t.Errorf("unexpected job %+v", job)
+		}
+		urls = append(urls, job.URL)
+	}
+	sort.Strings(urls)
+	if got, want := strings.Join(urls, " "), "news.example.com/a news.example.com/b"; got != want {
+		t.Errorf("queued jobs for %q, want %q", got, want)
+	}
+	if len(queue.bulk) != 2 {
+		t.Errorf("bulk lane has %d job(s), want 2", len(queue.bulk))
+	}
+}
+
+func TestSocialWatcher_Quota(t *testing.T) {
+	mockDS := lib.NewMockDatastoreClient()
+	queue := NewJobQueue(mockDS, func(ctx context.Context, job *models.CrawlJob) error { return nil }, 1, 2*MaxSocialLinksPerHour+1)
+	watcher := NewSocialWatcher(queue, nil, socialfetcher.Options{}, analyzer.AnalysisModeJoke)
+
+	links := make(chan socialfetcher.Link, 2*MaxSocialLinksPerHour+1)
+	for i := 0; i <= MaxSocialLinksPerHour; i++ {
+		links <- socialfetcher.Link{URL: fmt.Sprintf("https://spam.example.com/%d", i), Source: "bluesky:#april"}
+	}
+	for i := 0; i < MaxSocialLinksPerHour; i++ {
+		links <- socialfetcher.Link{URL: fmt.Sprintf("https://news.example.com/%d", i), Source: "bluesky:@news.bsky.social"}
+	}
+	close(links)
+	watcher.queueLinks(context.Background(), links)
+
+	if got, want := len(mockDS.CrawlJobs), 2*MaxSocialLinksPerHour; got != want {
+		t.Errorf("queued %d job(s), want %d", got, want)
+	}
+	for _, job := range mockDS.CrawlJobs {
+		if job.URL == fmt.Sprintf("spam.example.com/%d", MaxSocialLinksPerHour) {
+			t.Errorf("queued %s beyond the quota of its source", job.URL)
+		}
+	}
+
+	// The quota starts over after an hour
+	watcher.quotas["bluesky:#april"].start = time.Now().Add(-time.Hour)
+	if _, err := watcher.queueLink(context.Background(), socialfetcher.Link{URL: "https://spam.example.com/next", Source: "bluesky:#april"}); err != nil {
+		t.Errorf("queueLink() after an hour error = %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/crawler/utils"
+	"github.com/zeace/poisson/models"
+)
+
+// MaxSubmissionURLs is the largest number of URLs accepted in one submission.
+const MaxSubmissionURLs = 100
+
+// maxSubmissionBytes bounds the size of a submission request body.
+const maxSubmissionBytes = 1 << 20
+
+// SubmissionRequest is the body of a POST to the submissions endpoint.
+type SubmissionRequest struct {
+	URLs []string `json:"urls"`
+	// Mode is the analysis mode, "joke" if empty.
+	Mode string `json:"mode"`
+}
+
+// SubmissionResult is the outcome of one submitted URL: the queued job, or why it wasn't queued.
+type SubmissionResult struct {
+	URL    string `json:"url"`
+	JobID  string `json:"job_id,omitempty"`
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SubmissionResponse is the response of the submissions endpoint, with one result per submitted URL
+// in request order.
+type SubmissionResponse struct {
+	Results []SubmissionResult `json:"results"`
+}
+
+// NewSubmissionsHandler returns the handler of the submissions endpoint, which queues crawl jobs
+// for a batch of URLs sent by an external service. Requests need an API token with the
+// write:crawl scope, even when the server doesn't require tokens for GraphQL, and must be
+// wrapped in a handler that stores the token with WithAPIToken.
+// An Idempotency-Key header applies to each URL of the batch, so a retried batch returns the
+// original jobs.
+func NewSubmissionsHandler(jobQueue *JobQueue) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSONError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+
+		token := APITokenFromContext(ctx)
+		if token == nil {
+			writeJSONError(w, http.StatusUnauthorized, ErrAPITokenRequired.Error())
+			return
+		}
+		if err := RequireScope(ctx, models.ScopeWriteCrawl); err != nil {
+			writeJSONError(w, http.StatusForbidden, err.Error())
+			return
+		}
+
+		var request SubmissionRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSubmissionBytes)).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+		if len(request.URLs) == 0 {
+			writeJSONError(w, http.StatusBadRequest, "no URLs submitted")
+			return
+		}
+		if len(request.URLs) > MaxSubmissionURLs {
+			writeJSONError(w, http.StatusBadRequest,
+				fmt.Sprintf("too many URLs: %d (at most %d)", len(request.URLs), MaxSubmissionURLs))
+			return
+		}
+
+		modeName := request.Mode
+		if modeName == "" {
+			modeName = "joke"
+		}
+		mode, err := analyzer.VerifyValidMode(modeName)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid mode: %v", err))
+			return
+		}
+
+		idempotencyKey := IdempotencyKeyFromContext(ctx)
+		response := SubmissionResponse{Results: make([]SubmissionResult, len(request.URLs))}
+		for i, rawURL := range request.URLs {
+			response.Results[i] = submitURL(r, jobQueue, rawURL, mode, idempotencyKey)
+		}
+		slog.InfoContext(ctx, "Accepted submission", "token", token.ID, "urls", len(request.URLs), "mode", mode)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			slog.ErrorContext(ctx, "Failed to encode submission response", "error", err)
+		}
+	})
+}
+
+// submitURL queues a crawl job for one submitted URL.
+func submitURL(
+	r *http.Request,
+	jobQueue *JobQueue,
+	rawURL string,
+	mode models.AnalysisMode,
+	idempotencyKey string,
+) SubmissionResult {
+	result := SubmissionResult{URL: rawURL}
+	url, err := utils.Normalize(rawURL)
+	if err != nil {
+		result.Error = fmt.Sprintf("invalid URL: %v", err)
+		return result
+	}
+
+	key := ""
+	if idempotencyKey != "" {
+		key = idempotencyKey + "|" + url
+	}
+	job, err := jobQueue.Enqueue(r.Context(), models.JobTypeCrawl, url, mode, models.JobPriorityBulk, SubmissionSource(r.Context()), key)
+	if err != nil {
+		if !errors.Is(err, ErrJobQueueFull) {
+			slog.WarnContext(r.Context(), "Error queuing submitted URL", "url", url, "error", err)
+		}
+		result.Error = err.Error()
+		return result
+	}
+
+	result.JobID = job.ID
+	result.Status = string(job.Status)
+	return result
+}
+
+// writeJSONError writes a JSON error response with the given status code.
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// postSubmission sends body to the submissions handler as token and returns the recorded response.
+func postSubmission(handler http.Handler, token *models.APIToken, idempotencyKey, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/submissions", strings.NewReader(body))
+	ctx := WithAPIToken(request.Context(), token, false)
+	if idempotencyKey != "" {
+		ctx = WithIdempotencyKey(ctx, idempotencyKey)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request.WithContext(ctx))
+	return recorder
+}
+
+func TestSubmissionsHandler_QueuesJobs(t *testing.T) {
+	mockDS := lib.NewMockDatastoreClient()
+	queue := NewJobQueue(mockDS, func(ctx context.Context, job *models.CrawlJob) error { return nil }, 1, 10)
+	handler := NewSubmissionsHandler(queue)
+	token := &models.APIToken{ID: "zapier", Scopes: []models.APIScope{models.ScopeWriteCrawl}}
+
+	body := `{"urls": ["https://example.com/a", "not a url", "https://example.com/b"]}`
+	recorder := postSubmission(handler, token, "batch-1", body)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d (body %s)", recorder.Code, http.StatusAccepted, recorder.Body)
+	}
+
+	var response SubmissionResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if len(response.Results) != 3 {
+		t.Fatalf("got %d results, want 3", len(response.Results))
+	}
+	for _, i := range []int{0, 2} {
+		result := response.Results[i]
+		if result.JobID == "" || result.Status != string(models.JobStatusQueued) || result.Error != "" {
+			t.Errorf("result %d = %+v, want queued job", i, result)
+		}
+		if job := mockDS.CrawlJobs[result.JobID]; job == nil || job.Type != models.JobTypeCrawl || job.Mode != "joke" {
+			t.Errorf("stored job for result %d = %+v, want joke crawl job", i, job)
+		}
+	}
+	if response.Results[1].JobID != "" || response.Results[1].Error == "" {
+		t.Errorf("result 1 = %+v, want an error for the invalid URL", response.Results[1])
+	}
+
+	// A retried batch returns the same jobs
+	var retried SubmissionResponse
+	json.NewDecoder(postSubmission(handler, token, "batch-1", body).Body).Decode(&retried)
+	if len(retried.Results) != 3 || retried.Results[0].JobID != response.Results[0].JobID ||
+		retried.Results[2].JobID != response.Results[2].JobID {
+		t.Errorf("retried results = %+v, want the original jobs %+v", retried.Results, response.Results)
+	}
+}
+
+func TestSubmissionsHandler_Rejects(t *testing.T) {
+	queue := NewJobQueue(lib.NewMockDatastoreClient(), func(ctx context.Context, job *models.CrawlJob) error { return nil }, 1, 10)
+	handler := NewSubmissionsHandler(queue)
+	writer := &models.APIToken{ID: "writer", Scopes: []models.APIScope{models.ScopeWriteCrawl}}
+	reader := &models.APIToken{ID: "reader", Scopes: []models.APIScope{models.ScopeReadFeed}}
+
+	tests := []struct {
+		name     string
+		token    *models.APIToken
+		body     string
+		wantCode int
+	}{
+		{"no token", nil, `{"urls": ["https://example.com/a"]}`, http.StatusUnauthorized},
+		{"token without write:crawl", reader, `{"urls": ["https://example.com/a"]}`, http.StatusForbidden},
+		{"invalid JSON", writer, `{"urls": `, http.StatusBadRequest},
+		{"no URLs", writer, `{"urls": []}`, http.StatusBadRequest},
+		{"unknown mode", writer, `{"urls": ["https://example.com/a"], "mode": "nope"}`, http.StatusBadRequest},
+		{"too many URLs", writer, `{"urls": [` + strings.Repeat(`"https://example.com/a",`, MaxSubmissionURLs) +
+			`"https://example.com/b"]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := postSubmission(handler, tt.token, "", tt.body)
+			if recorder.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d (body %s)", recorder.Code, tt.wantCode, recorder.Body)
+			}
+		})
+	}
+}
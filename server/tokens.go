@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+// apiTokenPrefix starts every API token so that leaked tokens are easy to recognize.
+const apiTokenPrefix = "psn_"
+
+var (
+	// ErrInvalidAPIToken is returned by AuthenticateAPIToken for unknown, malformed or revoked tokens.
+	ErrInvalidAPIToken = errors.New("invalid API token")
+	// ErrAPITokenRequired is returned by RequireScope when the request has no token and the scope
+	// or the server requires one.
+	ErrAPITokenRequired = errors.New("an API token is required")
+	// ErrAPITokenNotFound is returned by RevokeAPIToken for an unknown token ID.
+	ErrAPITokenNotFound = errors.New("API token not found")
+)
+
+// ParseAPIScopes validates scope names.
+func ParseAPIScopes(names []string) ([]models.APIScope, error) {
+	if len(names) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	scopes := make([]models.APIScope, 0, len(names))
+	for _, name := range names {
+		scope := models.APIScope(name)
+		if !slices.Contains(models.APIScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", name)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// CreateAPIToken stores a new token with the given scopes and returns it along with the
+// token string to give to the client. The token string can't be recovered later.
+func CreateAPIToken(
+	ctx context.Context,
+	datastoreClient lib.DatastoreClient,
+	name string,
+	scopes []models.APIScope,
+) (*models.APIToken, string, error) {
+	id := randomHex(8)
+	secret := randomHex(24)
+	token := &models.APIToken{
+		ID:         id,
+		Name:       name,
+		SecretHash: secretHash(secret),
+		Scopes:     scopes,
+		CreatedAt:  time.Now(),
+	}
+	if err := datastoreClient.WriteAPIToken(ctx, token); err != nil {
+		return nil, "", fmt.Errorf("error saving API token: %w", err)
+	}
+	return token, apiTokenPrefix + id + "." + secret, nil
+}
+
+// RevokeAPIToken marks the token with id as revoked. Revoking a revoked token is a no-op.
+func RevokeAPIToken(ctx context.Context, datastoreClient lib.DatastoreClient, id string) (*models.APIToken, error) {
+	token, found, err := datastoreClient.ReadAPIToken(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error reading API token: %w", err)
+	}
+	if !found {
+		return nil, ErrAPITokenNotFound
+	}
+	if token.Revoked() {
+		return token, nil
+	}
+
+	token.RevokedAt = time.Now()
+	if err := datastoreClient.WriteAPIToken(ctx, token); err != nil {
+		return nil, fmt.Errorf("error saving API token: %w", err)
+	}
+	return token, nil
+}
+
+// AuthenticateAPIToken returns the active token matching the token string sent by a client
+// and records the request against it.
+func AuthenticateAPIToken(ctx context.Context, datastoreClient lib.DatastoreClient, raw string) (*models.APIToken, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(raw, apiTokenPrefix), ".")
+	if !ok || id == "" || secret == "" {
+		return nil, ErrInvalidAPIToken
+	}
+
+	token, found, err := datastoreClient.ReadAPIToken(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("error reading API token: %w", err)
+	}
+	if !found || token.Revoked() ||
+		subtle.ConstantTimeCompare([]byte(token.SecretHash), []byte(secretHash(secret))) != 1 {
+		return nil, ErrInvalidAPIToken
+	}
+
+	// A failure to count the request shouldn't fail it
+	if err := datastoreClient.RecordAPITokenRequest(ctx, id, time.Now()); err != nil {
+		slog.WarnContext(ctx, "Error recording API token request", "token", id, "error", err)
+	}
+	return token, nil
+}
+
+type apiTokenContextKey struct{}
+
+type apiAuth struct {
+	token    *models.APIToken
+	required bool
+}
+
+// WithAPIToken returns a context carrying the authenticated token of the request, which may be nil.
+// If required is true, requests without a token are refused by RequireScope.
+func WithAPIToken(ctx context.Context, token *models.APIToken, required bool) context.Context {
+	return context.WithValue(ctx, apiTokenContextKey{}, apiAuth{token: token, required: required})
+}
+
+// APITokenFromContext returns the token stored by WithAPIToken, or nil.
+func APITokenFromContext(ctx context.Context) *models.APIToken {
+	auth, _ := ctx.Value(apiTokenContextKey{}).(apiAuth)
+	return auth.token
+}
+
+// RequireScope returns an error unless the request's token grants scope. Requests without a
+// token are only allowed read scopes (see models.APIScope.ReadOnly), and only if tokens were not
+// required by WithAPIToken.
+func RequireScope(ctx context.Context, scope models.APIScope) error {
+	auth, _ := ctx.Value(apiTokenContextKey{}).(apiAuth)
+	if auth.token == nil {
+		if auth.required || !scope.ReadOnly() {
+			return ErrAPITokenRequired
+		}
+		return nil
+	}
+	if !auth.token.HasScope(scope) {
+		return fmt.Errorf("API token lacks the %s scope", scope)
+	}
+	return nil
+}
+
+// TokenStats are the requests made with API tokens, for the stats query.
+type TokenStats struct {
+	// Requests is the number of requests made with any token.
+	Requests int
+	// Tokens are all the tokens, revoked or not, with the most used first.
+	Tokens []*models.APIToken
+}
+
+// GetTokenStats returns the request counts of the API tokens.
+func GetTokenStats(ctx context.Context, datastoreClient lib.DatastoreClient) (*TokenStats, error) {
+	tokens, err := datastoreClient.ListAPITokens(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing API tokens: %w", err)
+	}
+	stats := &TokenStats{Tokens: tokens}
+	for _, token := range tokens {
+		stats.Requests += token.RequestCount
+	}
+	slices.SortStableFunc(stats.Tokens, func(a, b *models.APIToken) int {
+		return b.RequestCount - a.RequestCount
+	})
+	return stats, nil
+}
+
+// randomHex returns n random bytes, hex encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// secretHash returns the hex SHA-256 of a token secret.
+func secretHash(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
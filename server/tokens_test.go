@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestAPIToken_CreateAuthenticateRevoke(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	token, raw, err := CreateAPIToken(ctx, mockDS, "partner", []models.APIScope{models.ScopeReadFeed})
+	if err != nil {
+		t.Fatalf("CreateAPIToken returned error: %v", err)
+	}
+	if stored := mockDS.APITokens[token.ID]; stored == nil || stored.SecretHash == "" || stored.SecretHash == raw {
+		t.Fatalf("Expected token stored with a secret hash, got %+v", stored)
+	}
+
+	for i := 0; i < 2; i++ {
+		authenticated, err := AuthenticateAPIToken(ctx, mockDS, raw)
+		if err != nil {
+			t.Fatalf("AuthenticateAPIToken returned error: %v", err)
+		}
+		if authenticated.ID != token.ID {
+			t.Errorf("AuthenticateAPIToken returned token %q, want %q", authenticated.ID, token.ID)
+		}
+	}
+	if stored := mockDS.APITokens[token.ID]; stored.RequestCount != 2 || stored.LastUsedAt.IsZero() {
+		t.Errorf("Expected 2 recorded requests, got RequestCount=%d LastUsedAt=%v", stored.RequestCount, stored.LastUsedAt)
+	}
+
+	if _, err := RevokeAPIToken(ctx, mockDS, token.ID); err != nil {
+		t.Fatalf("RevokeAPIToken returned error: %v", err)
+	}
+	if _, err := AuthenticateAPIToken(ctx, mockDS, raw); !errors.Is(err, ErrInvalidAPIToken) {
+		t.Errorf("AuthenticateAPIToken after revocation error = %v, want %v", err, ErrInvalidAPIToken)
+	}
+	if _, err := RevokeAPIToken(ctx, mockDS, "unknown"); !errors.Is(err, ErrAPITokenNotFound) {
+		t.Errorf("RevokeAPIToken(unknown) error = %v, want %v", err, ErrAPITokenNotFound)
+	}
+}
+
+func TestAuthenticateAPIToken_Invalid(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	token, _, err := CreateAPIToken(ctx, mockDS, "partner", []models.APIScope{models.ScopeReadFeed})
+	if err != nil {
+		t.Fatalf("CreateAPIToken returned error: %v", err)
+	}
+
+	tests := []string{
+		"",
+		"garbage",
+		apiTokenPrefix + "unknown.secret",
+		apiTokenPrefix + token.ID + ".wrong-secret",
+		apiTokenPrefix + token.ID + ".",
+	}
+	for _, raw := range tests {
+		if _, err := AuthenticateAPIToken(ctx, mockDS, raw); !errors.Is(err, ErrInvalidAPIToken) {
+			t.Errorf("AuthenticateAPIToken(%q) error = %v, want %v", raw, err, ErrInvalidAPIToken)
+		}
+	}
+	if stored := mockDS.APITokens[token.ID]; stored.RequestCount != 0 {
+		t.Errorf("Expected failed attempts not to be counted, got RequestCount=%d", stored.RequestCount)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	readToken := &models.APIToken{ID: "read", Scopes: []models.APIScope{models.ScopeReadFeed}}
+	adminToken := &models.APIToken{ID: "admin", Scopes: []models.APIScope{models.ScopeAdmin}}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		scope   models.APIScope
+		wantErr bool
+	}{
+		{"no auth information, read scope", context.Background(), models.ScopeReadFeed, false},
+		{"no auth information, write scope", context.Background(), models.ScopeWriteCrawl, true},
+		{"no token, not required", WithAPIToken(context.Background(), nil, false), models.ScopeReadUsage, false},
+		{"no token, write scope", WithAPIToken(context.Background(), nil, false), models.ScopeWriteFeeds, true},
+		{"no token, admin scope", WithAPIToken(context.Background(), nil, false), models.ScopeAdmin, true},
+		{"no token, required", WithAPIToken(context.Background(), nil, true), models.ScopeReadFeed, true},
+		{"token with scope", WithAPIToken(context.Background(), readToken, true), models.ScopeReadFeed, false},
+		{"token without scope", WithAPIToken(context.Background(), readToken, false), models.ScopeWriteCrawl, true},
+		{"admin token", WithAPIToken(context.Background(), adminToken, true), models.ScopeWriteCrawl, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RequireScope(tt.ctx, tt.scope)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RequireScope() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetTokenStats(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+	for _, usage := range []struct {
+		name     string
+		requests int
+	}{{"quiet", 1}, {"busy", 2}} {
+		_, raw, err := CreateAPIToken(ctx, mockDS, usage.name, []models.APIScope{models.ScopeReadFeed})
+		if err != nil {
+			t.Fatalf("CreateAPIToken returned error: %v", err)
+		}
+		for i := 0; i < usage.requests; i++ {
+			if _, err := AuthenticateAPIToken(ctx, mockDS, raw); err != nil {
+				t.Fatalf("AuthenticateAPIToken returned error: %v", err)
+			}
+		}
+	}
+
+	stats, err := GetTokenStats(ctx, mockDS)
+	if err != nil {
+		t.Fatalf("GetTokenStats returned error: %v", err)
+	}
+	if stats.Requests != 3 || len(stats.Tokens) != 2 || stats.Tokens[0].Name != "busy" || stats.Tokens[0].RequestCount != 2 {
+		t.Errorf("unexpected stats: %d requests, tokens %+v", stats.Requests, stats.Tokens)
+	}
+}
+
+func TestParseAPIScopes(t *testing.T) {
+	scopes, err := ParseAPIScopes([]string{"read:feed", "write:crawl", "read:feed"})
+	if err != nil {
+		t.Fatalf("ParseAPIScopes returned error: %v", err)
+	}
+	if len(scopes) != 2 || scopes[0] != models.ScopeReadFeed || scopes[1] != models.ScopeWriteCrawl {
+		t.Errorf("ParseAPIScopes = %v, want [read:feed write:crawl]", scopes)
+	}
+
+	for _, names := range [][]string{nil, {"write:everything"}} {
+		if _, err := ParseAPIScopes(names); err == nil {
+			t.Errorf("ParseAPIScopes(%v) error = nil, want error", names)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/lib/logging"
+)
+
+// GetUsage aggregates the LLM usage and estimated cost of all analyses in the given mode
+// for pages crawled since oldestDate.
+func GetUsage(
+	ctx context.Context,
+	datastoreClient lib.DatastoreClient,
+	oldestDate time.Time,
+	modeStr string,
+) (analyzer.UsageTotals, error) {
+	var totals analyzer.UsageTotals
+
+	mode, err := analyzer.VerifyValidMode(modeStr)
+	if err != nil {
+		return totals, err
+	}
+
+	ctx = logging.WithAttrs(ctx, "oldest_date", oldestDate, "mode", modeStr)
+	pages, err := datastoreClient.GetCrawledPagesSince(ctx, oldestDate)
+	if err != nil {
+		return totals, err
+	}
+
+	for _, page := range pages {
+		analysis, found, err := datastoreClient.ReadAnalysisResult(ctx, page.URL, mode)
+		if err != nil {
+			slog.WarnContext(ctx, "GetUsage error reading analysis result", "url", page.URL, "error", err)
+			continue // Skip on error
+		}
+		if !found {
+			continue
+		}
+		totals.Add(analysis)
+	}
+
+	return totals, nil
+}
+
+// FeedUsage is the LLM usage of the analyses in one mode for pages from one feed.
+type FeedUsage struct {
+	// Feed is the RSS feed URL, or empty for pages analyzed on their own.
+	Feed   string
+	Mode   analyzer.AnalysisMode
+	Totals analyzer.UsageTotals
+}
+
+// GetUsageByFeed aggregates the LLM usage and estimated cost of all analyses, in every mode,
+// for pages crawled since oldestDate, broken down by source feed and mode.
+// The result is sorted by cost, most expensive first.
+func GetUsageByFeed(
+	ctx context.Context,
+	datastoreClient lib.DatastoreClient,
+	oldestDate time.Time,
+) ([]FeedUsage, error) {
+	ctx = logging.WithAttrs(ctx, "oldest_date", oldestDate)
+	pages, err := datastoreClient.GetCrawledPagesSince(ctx, oldestDate)
+	if err != nil {
+		return nil, err
+	}
+
+	type feedMode struct {
+		feed string
+		mode analyzer.AnalysisMode
+	}
+	totals := make(map[feedMode]*analyzer.UsageTotals)
+	for _, page := range pages {
+		for _, name := range analyzer.ModeNames() {
+			mode := analyzer.AnalysisMode(name)
+			analysis, found, err := datastoreClient.ReadAnalysisResult(ctx, page.URL, mode)
+			if err != nil {
+				slog.WarnContext(ctx, "GetUsageByFeed error reading analysis result",
+					"url", page.URL, "mode", mode, "error", err)
+				continue // Skip on error
+			}
+			if !found {
+				continue
+			}
+			key := feedMode{feed: analysis.Feed, mode: mode}
+			if totals[key] == nil {
+				totals[key] = &analyzer.UsageTotals{}
+			}
+			totals[key].Add(analysis)
+		}
+	}
+
+	usage := make([]FeedUsage, 0, len(totals))
+	for key, t := range totals {
+		usage = append(usage, FeedUsage{Feed: key.feed, Mode: key.mode, Totals: *t})
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Totals.CostUSD != usage[j].Totals.CostUSD {
+			return usage[i].Totals.CostUSD > usage[j].Totals.CostUSD
+		}
+		if usage[i].Feed != usage[j].Feed {
+			return usage[i].Feed < usage[j].Feed
+		}
+		return usage[i].Mode < usage[j].Mode
+	})
+	return usage, nil
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zeace/poisson/crawler/analyzer"
+	"github.com/zeace/poisson/lib"
+	"github.com/zeace/poisson/models"
+)
+
+func TestGetUsage_SumsAnalyses(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	now := time.Now()
+	for i, url := range []string{"https://example.com/a", "https://example.com/b"} {
+		page, err := mockDS.WriteCrawledPage(ctx, url, "Article", "Content", now)
+		if err != nil {
+			t.Fatalf("Failed to write crawled page: %v", err)
+		}
+		err = mockDS.WriteAnalysisResult(ctx, page.URL, &models.AnalysisResult{
+			Mode:             analyzer.AnalysisModeJoke,
+			PromptTokens:     1000 * (i + 1),
+			CompletionTokens: 100,
+			CostUSD:          0.01,
+		})
+		if err != nil {
+			t.Fatalf("Failed to write analysis result: %v", err)
+		}
+	}
+
+	// A page crawled before oldestDate must not be counted
+	oldPage, _ := mockDS.WriteCrawledPage(ctx, "https://example.com/old", "Old", "Content", now.Add(-48*time.Hour))
+	mockDS.WriteAnalysisResult(ctx, oldPage.URL, &models.AnalysisResult{Mode: analyzer.AnalysisModeJoke, PromptTokens: 5000})
+
+	totals, err := GetUsage(ctx, mockDS, now.Add(-1*time.Hour), "joke")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if totals.Analyses != 2 {
+		t.Errorf("Expected 2 analyses, got %d", totals.Analyses)
+	}
+	if totals.PromptTokens != 3000 || totals.CompletionTokens != 200 {
+		t.Errorf("Expected 3000 prompt and 200 completion tokens, got %d and %d", totals.PromptTokens, totals.CompletionTokens)
+	}
+	if totals.CostUSD < 0.0199 || totals.CostUSD > 0.0201 {
+		t.Errorf("Expected cost 0.02, got %f", totals.CostUSD)
+	}
+}
+
+func TestGetUsage_InvalidMode(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	_, err := GetUsage(ctx, mockDS, time.Now(), "invalid-mode")
+	if err == nil {
+		t.Fatal("Expected error for invalid mode, got nil")
+	}
+}
+
+func TestGetUsageByFeed_GroupsByFeedAndMode(t *testing.T) {
+	ctx := context.Background()
+	mockDS := lib.NewMockDatastoreClient()
+
+	now := time.Now()
+	results := []struct {
+		url  string
+		feed string
+		mode models.AnalysisMode
+		cost float64
+	}{
+		{"https://example.com/a", "https://example.com/feed.xml", analyzer.AnalysisModeJoke, 0.01},
+		{"https://example.com/b", "https://example.com/feed.xml", analyzer.AnalysisModeJoke, 0.02},
+		{"https://example.com/b", "https://example.com/feed.xml", analyzer.AnalysisModeTest, 0.001},
+		{"https://other.com/c", "https://other.com/rss", analyzer.AnalysisModeJoke, 0.05},
+		{"https://example.com/d", "", analyzer.AnalysisModeJoke, 0.002},
+	}
+	for _, r := range results {
+		if _, err := mockDS.WriteCrawledPage(ctx, r.url, "Article", "Content", now); err != nil {
+			t.Fatalf("Failed to write crawled page: %v", err)
+		}
+		err := mockDS.WriteAnalysisResult(ctx, r.url, &models.AnalysisResult{
+			Mode:         r.mode,
+			Feed:         r.feed,
+			PromptTokens: 100,
+			CostUSD:      r.cost,
+		})
+		if err != nil {
+			t.Fatalf("Failed to write analysis result: %v", err)
+		}
+	}
+
+	usage, err := GetUsageByFeed(ctx, mockDS, now.Add(-1*time.Hour))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	want := []struct {
+		feed     string
+		mode     models.AnalysisMode
+		analyses int
+		cost     float64
+	}{
+		{"https://other.com/rss", analyzer.AnalysisModeJoke, 1, 0.05},
+		{"https://example.com/feed.xml", analyzer.AnalysisModeJoke, 2, 0.03},
+		{"", analyzer.AnalysisModeJoke, 1, 0.002},
+		{"https://example.com/feed.xml", analyzer.AnalysisModeTest, 1, 0.001},
+	}
+	if len(usage) != len(want) {
+		t.Fatalf("Expected %d entries, got %d: %+v", len(want), len(usage), usage)
+	}
+	for i, w := range want {
+		got := usage[i]
+		if got.Feed != w.feed || got.Mode != w.mode {
+			t.Errorf("Entry %d: expected %q/%s, got %q/%s", i, w.feed, w.mode, got.Feed, got.Mode)
+		}
+		if got.Totals.Analyses != w.analyses {
+			t.Errorf("Entry %d: expected %d analyses, got %d", i, w.analyses, got.Totals.Analyses)
+		}
+		if got.Totals.CostUSD < w.cost-1e-9 || got.Totals.CostUSD > w.cost+1e-9 {
+			t.Errorf("Entry %d: expected cost %f, got %f", i, w.cost, got.Totals.CostUSD)
+		}
+	}
+}
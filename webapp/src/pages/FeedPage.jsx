@@ -10,6 +10,8 @@ const FEED_QUERY = `
       url
       title
       jokeConfidence
+      publishedAt
+      description
     }
   }
 `
@@ -71,12 +73,16 @@ function FeedPage() {
                     <div className="feed-item-header">
                       <span className="feed-rank">#{index + 1}</span>
                       <span className="feed-confidence">{item.jokeConfidence}%</span>
+                      {item.publishedAt && (
+                        <span className="feed-date">{new Date(item.publishedAt).toLocaleDateString()}</span>
+                      )}
                     </div>
                     <h3 className="feed-title">
                       <a href={`/analysis?url=${encodeURIComponent(item.url)}`}>
                         {item.title}
                       </a>
                     </h3>
+                    {item.description && <p className="feed-description">{item.description}</p>}
                     <p className="feed-url">
                       <a href={item.url} target="_blank" rel="noopener noreferrer">
                         {item.url}